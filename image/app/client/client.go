@@ -0,0 +1,90 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+// Package client is the Go client of the API for the automation (e.g., CI pipelines synchronizing a repository with a dataset),
+// the methods are generated from the endpoints of the OpenAPI document (see client_gen.go)
+package client
+
+//go:generate go run ../openapi/gen -o client_gen.go
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/common"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// defaultHttpClient does not retry: the calls changing the state (e.g., store) must not be sent twice
+var defaultHttpClient = &http.Client{}
+
+type Client struct {
+	BaseUrl    string       // e.g., https://rdm.example.org
+	ApiKey     string       // service API key, created with the admin API
+	HttpClient *http.Client // a client with the default transport (without retries) when not set
+	Target     string       // the Dataverse target of the requests (see the dataverseTargets option), the default server when empty
+}
+
+func New(baseUrl, apiKey string) *Client {
+	return &Client{BaseUrl: strings.TrimSuffix(baseUrl, "/"), ApiKey: apiKey}
+}
+
+// Error is the error response of the API, see the code for the failure class (e.g., "dataset_locked")
+type Error struct {
+	Status int
+	common.ApiError
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d %v: %v", e.Status, e.Code, e.Message)
+}
+
+func (c *Client) call(ctx context.Context, method, path string, req, res interface{}) error {
+	var body io.Reader
+	if req != nil {
+		b, err := json.Marshal(req)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(b)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, c.BaseUrl+path, body)
+	if err != nil {
+		return err
+	}
+	if req != nil {
+		request.Header.Set("Content-Type", "application/json")
+	}
+	if c.ApiKey != "" {
+		request.Header.Set("Authorization", "ApiKey "+c.ApiKey)
+	}
+	if c.Target != "" {
+		request.Header.Set("X-Dataverse-Target", c.Target)
+	}
+	httpClient := c.HttpClient
+	if httpClient == nil {
+		httpClient = defaultHttpClient
+	}
+	r, err := httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode >= 300 {
+		e := &Error{Status: r.StatusCode}
+		if json.Unmarshal(b, &e.ApiError) != nil || e.Code == "" {
+			e.Code, e.Message = "unknown", string(b)
+		}
+		return e
+	}
+	if res == nil {
+		return nil
+	}
+	return json.Unmarshal(b, res)
+}
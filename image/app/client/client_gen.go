@@ -0,0 +1,365 @@
+// Code generated by openapi/gen from the endpoints of the OpenAPI document; DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/frontend"
+	"integration/app/plugin/funcs/compare"
+	"integration/app/plugin/funcs/estimate"
+	"integration/app/plugin/types"
+)
+
+// CompareRepository starts the comparison of a repository with a dataset, poll the result with the returned key at /api/common/cached (POST /api/plugin/compare)
+func (c *Client) CompareRepository(ctx context.Context, req types.CompareRequest) (common.Key, error) {
+	res := common.Key{}
+	err := c.call(ctx, "POST", "/api/plugin/compare", req, &res)
+	return res, err
+}
+
+// Options lists the options (e.g., branches or folders) of a repository (POST /api/plugin/options)
+func (c *Client) Options(ctx context.Context, req types.OptionsRequest) ([]types.SelectItem, error) {
+	res := []types.SelectItem{}
+	err := c.call(ctx, "POST", "/api/plugin/options", req, &res)
+	return res, err
+}
+
+// Search searches the repositories of the plugin (POST /api/plugin/search)
+func (c *Client) Search(ctx context.Context, req types.OptionsRequest) ([]types.SelectItem, error) {
+	res := []types.SelectItem{}
+	err := c.call(ctx, "POST", "/api/plugin/search", req, &res)
+	return res, err
+}
+
+// Estimate estimates the size of a repository before the comparison (POST /api/plugin/estimate)
+func (c *Client) Estimate(ctx context.Context, req types.CompareRequest) (estimate.EstimateResponse, error) {
+	res := estimate.EstimateResponse{}
+	err := c.call(ctx, "POST", "/api/plugin/estimate", req, &res)
+	return res, err
+}
+
+// Batch syncs the same source (or its subfolders) with several datasets: the datasets are compared one by one and their store jobs are queued (POST /api/plugin/batch)
+func (c *Client) Batch(ctx context.Context, req compare.BatchRequest) (compare.BatchResponse, error) {
+	res := compare.BatchResponse{}
+	err := c.call(ctx, "POST", "/api/plugin/batch", req, &res)
+	return res, err
+}
+
+// BatchStatus returns the status of the datasets of a batch, with the progress and the reports of their jobs (POST /api/plugin/batchstatus)
+func (c *Client) BatchStatus(ctx context.Context, req compare.BatchStatusRequest) (compare.BatchStatus, error) {
+	res := compare.BatchStatus{}
+	err := c.call(ctx, "POST", "/api/plugin/batchstatus", req, &res)
+	return res, err
+}
+
+// Migrate creates a dataset for each source (or folder) in its collection, with the metadata of the metadata file of the source, and syncs the files (POST /api/plugin/migrate)
+func (c *Client) Migrate(ctx context.Context, req compare.MigrationRequest) (compare.BatchResponse, error) {
+	res := compare.BatchResponse{}
+	err := c.call(ctx, "POST", "/api/plugin/migrate", req, &res)
+	return res, err
+}
+
+// MigrationStatus returns the status of the rows of a migration, with the created datasets and the progress and the reports of their jobs (POST /api/plugin/migrationstatus)
+func (c *Client) MigrationStatus(ctx context.Context, req compare.BatchStatusRequest) (compare.MigrationStatus, error) {
+	res := compare.MigrationStatus{}
+	err := c.call(ctx, "POST", "/api/plugin/migrationstatus", req, &res)
+	return res, err
+}
+
+// Schedule repeats a batch every interval (in minutes), with the credentials of the request stored encrypted in the history database (POST /api/plugin/schedule)
+func (c *Client) Schedule(ctx context.Context, req compare.ScheduleRequest) (core.Schedule, error) {
+	res := core.Schedule{}
+	err := c.call(ctx, "POST", "/api/plugin/schedule", req, &res)
+	return res, err
+}
+
+// Schedules lists the schedules of the user, with the batch started by their last run (GET /api/plugin/schedules)
+func (c *Client) Schedules(ctx context.Context) (compare.SchedulesResponse, error) {
+	res := compare.SchedulesResponse{}
+	err := c.call(ctx, "GET", "/api/plugin/schedules", nil, &res)
+	return res, err
+}
+
+// Unschedule deletes the schedule of the user, with its credentials (POST /api/plugin/unschedule)
+func (c *Client) Unschedule(ctx context.Context, req compare.ScheduleIdRequest) error {
+	return c.call(ctx, "POST", "/api/plugin/unschedule", req, nil)
+}
+
+// Compare compares the given nodes with the dataset (POST /api/common/compare)
+func (c *Client) Compare(ctx context.Context, req common.CompareRequest) (core.CompareResponse, error) {
+	res := core.CompareResponse{}
+	err := c.call(ctx, "POST", "/api/common/compare", req, &res)
+	return res, err
+}
+
+// CachedResponse returns the result of a comparison started in the background when ready, optionally filtered, sorted and paged (POST /api/common/cached)
+func (c *Client) CachedResponse(ctx context.Context, req common.CachedRequest) (common.CachedResponse, error) {
+	res := common.CachedResponse{}
+	err := c.call(ctx, "POST", "/api/common/cached", req, &res)
+	return res, err
+}
+
+// Selection changes (or returns) the persisted selection of the nodes of a comparison, stored by its key with /api/common/store (POST /api/common/selection)
+func (c *Client) Selection(ctx context.Context, req common.SelectionRequest) (common.SelectionResponse, error) {
+	res := common.SelectionResponse{}
+	err := c.call(ctx, "POST", "/api/common/selection", req, &res)
+	return res, err
+}
+
+// Store starts the job writing the selected nodes to the dataset (POST /api/common/store)
+func (c *Client) Store(ctx context.Context, req common.StoreRequest) (common.StoreResult, error) {
+	res := common.StoreResult{}
+	err := c.call(ctx, "POST", "/api/common/store", req, &res)
+	return res, err
+}
+
+// NewDataset creates a new dataset (POST /api/common/newdataset)
+func (c *Client) NewDataset(ctx context.Context, req common.NewDatasetRequest) (common.NewDatasetResponse, error) {
+	res := common.NewDatasetResponse{}
+	err := c.call(ctx, "POST", "/api/common/newdataset", req, &res)
+	return res, err
+}
+
+// DatasetCollections lists the collections where the user can create datasets, for choosing the collection of a new dataset (POST /api/common/newdatasetcollections)
+func (c *Client) DatasetCollections(ctx context.Context, req common.DatasetCollectionsRequest) ([]types.SelectItem, error) {
+	res := []types.SelectItem{}
+	err := c.call(ctx, "POST", "/api/common/newdatasetcollections", req, &res)
+	return res, err
+}
+
+// DvObjects lists the collections or the datasets of the user (POST /api/common/dvobjects)
+func (c *Client) DvObjects(ctx context.Context, req common.DvObjectsRequest) ([]types.SelectItem, error) {
+	res := []types.SelectItem{}
+	err := c.call(ctx, "POST", "/api/common/dvobjects", req, &res)
+	return res, err
+}
+
+// Datasets lists a page of the datasets where the user has a role (or a role allowing to edit), for the dataset picker (POST /api/common/datasets)
+func (c *Client) Datasets(ctx context.Context, req common.DatasetsRequest) (core.DatasetPage, error) {
+	res := core.DatasetPage{}
+	err := c.call(ctx, "POST", "/api/common/datasets", req, &res)
+	return res, err
+}
+
+// Collection lists the subcollections and the datasets of a collection, for browsing the collection tree (POST /api/common/collection)
+func (c *Client) Collection(ctx context.Context, req common.CollectionRequest) (common.CollectionResponse, error) {
+	res := common.CollectionResponse{}
+	err := c.call(ctx, "POST", "/api/common/collection", req, &res)
+	return res, err
+}
+
+// Report returns the report of the last (or running) job of the dataset (POST /api/common/report)
+func (c *Client) Report(ctx context.Context, req common.ReportRequest) (common.ReportResponse, error) {
+	res := common.ReportResponse{}
+	err := c.call(ctx, "POST", "/api/common/report", req, &res)
+	return res, err
+}
+
+// ArchivedJobs lists the archived jobs of the dataset (POST /api/common/archivedjobs)
+func (c *Client) ArchivedJobs(ctx context.Context, req common.ReportRequest) (common.ArchivedJobsResponse, error) {
+	res := common.ArchivedJobsResponse{}
+	err := c.call(ctx, "POST", "/api/common/archivedjobs", req, &res)
+	return res, err
+}
+
+// History lists the finished jobs of the dataset or the user (POST /api/common/history)
+func (c *Client) History(ctx context.Context, req common.HistoryRequest) (common.HistoryResponse, error) {
+	res := common.HistoryResponse{}
+	err := c.call(ctx, "POST", "/api/common/history", req, &res)
+	return res, err
+}
+
+// Fixity starts the fixity verification of the dataset (POST /api/common/fixity)
+func (c *Client) Fixity(ctx context.Context, req common.ReportRequest) error {
+	return c.call(ctx, "POST", "/api/common/fixity", req, nil)
+}
+
+// FixityReport returns the report of the last (or running) fixity verification of the dataset (POST /api/common/fixityreport)
+func (c *Client) FixityReport(ctx context.Context, req common.ReportRequest) (common.FixityResponse, error) {
+	res := common.FixityResponse{}
+	err := c.call(ctx, "POST", "/api/common/fixityreport", req, &res)
+	return res, err
+}
+
+// Bag starts the export of the dataset version (or of the selected files) as a BagIt bag to the export storage (POST /api/common/bag)
+func (c *Client) Bag(ctx context.Context, req common.BagRequest) error {
+	return c.call(ctx, "POST", "/api/common/bag", req, nil)
+}
+
+// BagReport returns the report of the last (or running) bag export of the dataset (POST /api/common/bagreport)
+func (c *Client) BagReport(ctx context.Context, req common.BagRequest) (common.BagResponse, error) {
+	res := common.BagResponse{}
+	err := c.call(ctx, "POST", "/api/common/bagreport", req, &res)
+	return res, err
+}
+
+// ExportTargets lists the targets the dataset files can be exported to (GET /api/common/exporttargets)
+func (c *Client) ExportTargets(ctx context.Context) (common.ExportTargetsResponse, error) {
+	res := common.ExportTargetsResponse{}
+	err := c.call(ctx, "GET", "/api/common/exporttargets", nil, &res)
+	return res, err
+}
+
+// Export starts the export of the dataset version (or of the selected files) to a folder of an export target (POST /api/common/export)
+func (c *Client) Export(ctx context.Context, req common.ExportRequest) error {
+	return c.call(ctx, "POST", "/api/common/export", req, nil)
+}
+
+// ExportReport returns the report of the last export job of the dataset (POST /api/common/exportreport)
+func (c *Client) ExportReport(ctx context.Context, req common.ExportRequest) (common.ExportReportResponse, error) {
+	res := common.ExportReportResponse{}
+	err := c.call(ctx, "POST", "/api/common/exportreport", req, &res)
+	return res, err
+}
+
+// InvalidateCache removes the cached hashes of the dataset (POST /api/common/invalidatecache)
+func (c *Client) InvalidateCache(ctx context.Context, req common.ReportRequest) error {
+	return c.call(ctx, "POST", "/api/common/invalidatecache", req, nil)
+}
+
+// Connections lists the repositories previously synchronized by the user (GET /api/common/connections)
+func (c *Client) Connections(ctx context.Context) (common.ConnectionsResponse, error) {
+	res := common.ConnectionsResponse{}
+	err := c.call(ctx, "GET", "/api/common/connections", nil, &res)
+	return res, err
+}
+
+// UserData lists the data stored for the user (GET /api/common/userdata)
+func (c *Client) UserData(ctx context.Context) (common.UserDataResponse, error) {
+	res := common.UserDataResponse{}
+	err := c.call(ctx, "GET", "/api/common/userdata", nil, &res)
+	return res, err
+}
+
+// RevokeUserData deletes the requested (or all) data stored for the user (POST /api/common/revoke)
+func (c *Client) RevokeUserData(ctx context.Context, req common.RevokeRequest) (common.UserDataResponse, error) {
+	res := common.UserDataResponse{}
+	err := c.call(ctx, "POST", "/api/common/revoke", req, &res)
+	return res, err
+}
+
+// Credential stores the Dataverse API key on the server and returns the reference sent instead of the key (POST /api/common/credential)
+func (c *Client) Credential(ctx context.Context, req common.CredentialRequest) (common.CredentialResponse, error) {
+	res := common.CredentialResponse{}
+	err := c.call(ctx, "POST", "/api/common/credential", req, &res)
+	return res, err
+}
+
+// ProvisionedCredential looks up or (re)creates the Dataverse API token of the logged in user and returns the reference sent instead of the key (POST /api/common/credential/provision)
+func (c *Client) ProvisionedCredential(ctx context.Context, req common.ProvisionedCredentialRequest) (common.CredentialResponse, error) {
+	res := common.CredentialResponse{}
+	err := c.call(ctx, "POST", "/api/common/credential/provision", req, &res)
+	return res, err
+}
+
+// OauthToken exchanges the OAuth authorization code of a plugin for a token, kept by the server (POST /api/common/oauthtoken)
+func (c *Client) OauthToken(ctx context.Context, req common.OauthTokenRequest) (core.TokenResponse, error) {
+	res := core.TokenResponse{}
+	err := c.call(ctx, "POST", "/api/common/oauthtoken", req, &res)
+	return res, err
+}
+
+// Session starts or updates the server side session with the Dataverse API key and the plugin tokens of the user (POST /api/auth/session)
+func (c *Client) Session(ctx context.Context, req common.SessionRequest) (common.SessionResponse, error) {
+	res := common.SessionResponse{}
+	err := c.call(ctx, "POST", "/api/auth/session", req, &res)
+	return res, err
+}
+
+// Me returns the identity of the authenticated user (GET /api/auth/me)
+func (c *Client) Me(ctx context.Context) (core.Identity, error) {
+	res := core.Identity{}
+	err := c.call(ctx, "GET", "/api/auth/me", nil, &res)
+	return res, err
+}
+
+// AdoptJob takes over the job of a dataset (POST /api/admin/adoptjob)
+func (c *Client) AdoptJob(ctx context.Context, req common.AdoptJobRequest) error {
+	return c.call(ctx, "POST", "/api/admin/adoptjob", req, nil)
+}
+
+// Audit returns the audit log (POST /api/admin/audit)
+func (c *Client) Audit(ctx context.Context, req common.AuditRequest) (common.AuditResponse, error) {
+	res := common.AuditResponse{}
+	err := c.call(ctx, "POST", "/api/admin/audit", req, &res)
+	return res, err
+}
+
+// AdminStatus returns the locks, the queues, the running jobs and the cached responses (POST /api/admin/status)
+func (c *Client) AdminStatus(ctx context.Context, req common.AdminRequest) (common.AdminStatusResponse, error) {
+	res := common.AdminStatusResponse{}
+	err := c.call(ctx, "POST", "/api/admin/status", req, &res)
+	return res, err
+}
+
+// AdminConfig returns the backend configuration with the secrets redacted (POST /api/admin/config)
+func (c *Client) AdminConfig(ctx context.Context, req common.AdminRequest) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	err := c.call(ctx, "POST", "/api/admin/config", req, &res)
+	return res, err
+}
+
+// ForceUnlock removes the lock of the dataset (POST /api/admin/unlock)
+func (c *Client) ForceUnlock(ctx context.Context, req common.AdminRequest) error {
+	return c.call(ctx, "POST", "/api/admin/unlock", req, nil)
+}
+
+// FlushCaches removes the cached responses and hashes of the dataset (or of all datasets) (POST /api/admin/flush)
+func (c *Client) FlushCaches(ctx context.Context, req common.AdminRequest) error {
+	return c.call(ctx, "POST", "/api/admin/flush", req, nil)
+}
+
+// Orphans reports (and optionally removes) the stored files that are not registered in Dataverse (POST /api/admin/orphans)
+func (c *Client) Orphans(ctx context.Context, req common.OrphansRequest) (common.OrphansResponse, error) {
+	res := common.OrphansResponse{}
+	err := c.call(ctx, "POST", "/api/admin/orphans", req, &res)
+	return res, err
+}
+
+// ApiKeys lists the service API keys (POST /api/admin/apikeys)
+func (c *Client) ApiKeys(ctx context.Context, req common.ApiKeyRequest) ([]core.ServiceApiKey, error) {
+	res := []core.ServiceApiKey{}
+	err := c.call(ctx, "POST", "/api/admin/apikeys", req, &res)
+	return res, err
+}
+
+// CreateApiKey creates a service API key, the key is only returned once (POST /api/admin/apikeys/create)
+func (c *Client) CreateApiKey(ctx context.Context, req common.ApiKeyRequest) (common.ApiKeyResponse, error) {
+	res := common.ApiKeyResponse{}
+	err := c.call(ctx, "POST", "/api/admin/apikeys/create", req, &res)
+	return res, err
+}
+
+// RevokeApiKey revokes a service API key (POST /api/admin/apikeys/revoke)
+func (c *Client) RevokeApiKey(ctx context.Context, req common.ApiKeyRequest) error {
+	return c.call(ctx, "POST", "/api/admin/apikeys/revoke", req, nil)
+}
+
+// Healthz reports that the process is up (GET /healthz)
+func (c *Client) Healthz(ctx context.Context) error {
+	return c.call(ctx, "GET", "/healthz", nil, nil)
+}
+
+// Readyz reports whether the application can serve requests and process jobs (GET /readyz)
+func (c *Client) Readyz(ctx context.Context) (common.ReadinessResponse, error) {
+	res := common.ReadinessResponse{}
+	err := c.call(ctx, "GET", "/readyz", nil, &res)
+	return res, err
+}
+
+// FrontendConfig returns the configuration of the frontend (GET /api/frontend/config)
+func (c *Client) FrontendConfig(ctx context.Context) (config.Configuration, error) {
+	res := config.Configuration{}
+	err := c.call(ctx, "GET", "/api/frontend/config", nil, &res)
+	return res, err
+}
+
+// PluginCatalog returns the source systems of the frontend configuration with the fields of their forms and their OAuth login (GET /api/frontend/plugins)
+func (c *Client) PluginCatalog(ctx context.Context) ([]frontend.CatalogPlugin, error) {
+	res := []frontend.CatalogPlugin{}
+	err := c.call(ctx, "GET", "/api/frontend/plugins", nil, &res)
+	return res, err
+}
@@ -0,0 +1,123 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+)
+
+type AdminRequest struct {
+	DataverseKey string `json:"dataverseKey"`
+	PersistentId string `json:"persistentId,omitempty"` // dataset to unlock or flush (all datasets are flushed when empty)
+}
+
+type AdminStatusResponse struct {
+	Locks           []core.LockInfo           `json:"locks"`
+	Queues          map[string]int64          `json:"queues"`
+	Running         []core.RunningJob         `json:"running"`
+	CachedResponses []core.CachedResponseInfo `json:"cachedResponses"`
+	Destinations    []core.DestinationInfo    `json:"destinations"` // the Dataverse installations with their versions and features
+}
+
+// readAdminRequest parses the request and verifies that the user is a superuser, writes the error response and returns false otherwise
+func readAdminRequest(w http.ResponseWriter, r *http.Request, req *AdminRequest) bool {
+	if !DecodeRequest(w, r, req) {
+		return false
+	}
+	return requireSuperuser(w, r, req.DataverseKey)
+}
+
+func requireSuperuser(w http.ResponseWriter, r *http.Request, dataverseKey string) bool {
+	user := core.GetUserFromHeader(r.Header)
+	superuser, err := core.Destination.IsSuperuser(r.Context(), dataverseKey, user)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+	if !superuser {
+		WriteError(w, r, http.StatusForbidden, errors.New("only superusers can use the admin API"))
+		return false
+	}
+	return true
+}
+
+func writeJson(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// AdminStatus returns the active locks, the queue depths, the running jobs with their progress and the cached compare responses
+func AdminStatus(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := AdminRequest{}
+	if !readAdminRequest(w, r, &req) {
+		return
+	}
+	res := AdminStatusResponse{Destinations: core.Destinations()}
+	var err error
+	if res.Locks, err = core.ListLocks(r.Context()); err == nil {
+		if res.Queues, err = core.QueueDepths(r.Context()); err == nil {
+			if res.Running, err = core.RunningJobs(r.Context()); err == nil {
+				res.CachedResponses, err = core.CachedResponses(r.Context())
+			}
+		}
+	}
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, r, res)
+}
+
+// AdminConfig returns the backend configuration with the secrets redacted
+func AdminConfig(w http.ResponseWriter, r *http.Request) {
+	req := AdminRequest{}
+	if !readAdminRequest(w, r, &req) {
+		return
+	}
+	res, err := core.RedactedConfig()
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, r, res)
+}
+
+// ForceUnlock removes the lock of a dataset, e.g., after a job got stuck
+func ForceUnlock(w http.ResponseWriter, r *http.Request) {
+	req := AdminRequest{}
+	if !readAdminRequest(w, r, &req) {
+		return
+	}
+	err := core.ForceUnlock(r.Context(), req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// FlushCaches removes the cached compare responses and known hashes of a dataset, or of all datasets
+func FlushCaches(w http.ResponseWriter, r *http.Request) {
+	req := AdminRequest{}
+	if !readAdminRequest(w, r, &req) {
+		return
+	}
+	err := core.FlushCaches(r.Context(), req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
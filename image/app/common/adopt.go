@@ -0,0 +1,54 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+)
+
+type AdoptJobRequest struct {
+	PersistentId string `json:"persistentId"`
+	DataverseKey string `json:"dataverseKey"`
+	Token        string `json:"token"`
+	StreamUser   string `json:"streamUser,omitempty"`
+}
+
+// AdoptJob lets a data steward (a superuser) take over the in-flight or failed job of a dataset under their own credentials, or
+// the user that started the job continue it with new credentials
+func AdoptJob(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := AdoptJobRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	if owner, ok := core.JobOwner(r.Context(), req.PersistentId); !ok || owner != user {
+		// the job of another user is only taken over by a superuser
+		if !requireSuperuser(w, r, req.DataverseKey) {
+			return
+		}
+	}
+	err := core.Destination.CheckPermission(r.Context(), req.DataverseKey, user, req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	err = core.AdoptJob(r.Context(), req.PersistentId, core.Adoption{
+		DataverseKey: req.DataverseKey,
+		User:         user,
+		Token:        req.Token,
+		StreamUser:   req.StreamUser,
+	})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
@@ -0,0 +1,119 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"integration/app/core"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+type ApiKeyRequest struct {
+	DataverseKey  string   `json:"dataverseKey"`
+	Id            string   `json:"id,omitempty"`            // key to revoke
+	Name          string   `json:"name,omitempty"`          // description of the new key
+	User          string   `json:"user,omitempty"`          // user of the new key, the calling superuser when empty
+	Plugins       []string `json:"plugins,omitempty"`       // allowed plugins of the new key, all plugins when empty
+	PersistentIds []string `json:"persistentIds,omitempty"` // allowed datasets of the new key, all datasets when empty
+	RateLimit     int      `json:"rateLimit,omitempty"`     // requests per minute of the new key, unlimited when not set
+}
+
+type ApiKeyResponse struct {
+	Key    string             `json:"key"` // only returned once, when the key is created
+	ApiKey core.ServiceApiKey `json:"apiKey"`
+}
+
+func readApiKeyRequest(w http.ResponseWriter, r *http.Request, req *ApiKeyRequest) bool {
+	if !DecodeRequest(w, r, req) {
+		return false
+	}
+	return requireSuperuser(w, r, req.DataverseKey)
+}
+
+// ApiKeys lists the service API keys (without the keys themselves)
+func ApiKeys(w http.ResponseWriter, r *http.Request) {
+	req := ApiKeyRequest{}
+	if !readApiKeyRequest(w, r, &req) {
+		return
+	}
+	keys, err := core.ListApiKeys(r.Context())
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, r, keys)
+}
+
+func CreateApiKey(w http.ResponseWriter, r *http.Request) {
+	req := ApiKeyRequest{}
+	if !readApiKeyRequest(w, r, &req) {
+		return
+	}
+	caller := core.GetUserFromHeader(r.Header)
+	if req.User == "" {
+		req.User = caller
+	}
+	key, created, err := core.CreateApiKey(r.Context(), core.ServiceApiKey{
+		Name:          req.Name,
+		User:          req.User,
+		Plugins:       req.Plugins,
+		PersistentIds: req.PersistentIds,
+		RateLimit:     req.RateLimit,
+		CreatedBy:     caller,
+	})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, r, ApiKeyResponse{Key: key, ApiKey: created})
+}
+
+func RevokeApiKey(w http.ResponseWriter, r *http.Request) {
+	req := ApiKeyRequest{}
+	if !readApiKeyRequest(w, r, &req) {
+		return
+	}
+	err := core.RevokeApiKey(r.Context(), req.Id)
+	if err != nil {
+		WriteError(w, r, http.StatusNotFound, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// checkRequestScope checks the persistentId and the plugin ("plugin" and "pluginId" fields) of the decoded request against the
+// scope of the API key, so that every request addressing a dataset is checked; the requests without a persistentId field are
+// not checked here (e.g., the batch items are checked one by one)
+func checkRequestScope(r *http.Request, v interface{}) error {
+	if identity, ok := core.IdentityFromContext(r.Context()); !ok || identity.ApiKey == nil {
+		return nil
+	}
+	value := reflect.ValueOf(v)
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return nil
+	}
+	hasPersistentId, persistentId, plugins := false, "", []string{}
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || value.Field(i).Kind() != reflect.String {
+			continue
+		}
+		switch name {
+		case "persistentId":
+			hasPersistentId, persistentId = true, value.Field(i).String()
+		case "plugin", "pluginId":
+			if p := value.Field(i).String(); p != "" {
+				plugins = append(plugins, p)
+			}
+		}
+	}
+	if !hasPersistentId {
+		return nil
+	}
+	return core.CheckScope(r.Context(), plugins, persistentId)
+}
@@ -0,0 +1,52 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"integration/app/core"
+	"net/http"
+	"time"
+)
+
+type AuditRequest struct {
+	DataverseKey string    `json:"dataverseKey"`
+	PersistentId string    `json:"persistentId"`
+	User         string    `json:"user"`
+	Since        time.Time `json:"since"`
+	Until        time.Time `json:"until"`
+	Format       string    `json:"format"` // "json" (default) or "csv"
+}
+
+type AuditResponse struct {
+	Events []core.AuditEvent `json:"events"`
+}
+
+// Audit returns the audit log to the Dataverse superusers, as JSON or as CSV
+func Audit(w http.ResponseWriter, r *http.Request) {
+	req := AuditRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	if !requireSuperuser(w, r, req.DataverseKey) {
+		return
+	}
+	events, err := core.GetAuditEvents(r.Context(), core.AuditQuery{PersistentId: req.PersistentId, User: req.User, Since: req.Since, Until: req.Until})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if req.Format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=\"audit.csv\"")
+		core.WriteAuditCsv(w, events)
+		return
+	}
+	b, err := json.Marshal(AuditResponse{Events: events})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
@@ -0,0 +1,93 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"integration/app/core"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Login redirects to the OIDC identity provider, the user comes back to the (relative) redirect parameter after the login
+func Login(w http.ResponseWriter, r *http.Request) {
+	if !core.OidcEnabled() {
+		WriteError(w, r, http.StatusNotFound, errors.New("OIDC login is not configured"))
+		return
+	}
+	redirect := r.URL.Query().Get("redirect")
+	if !isLocalRedirect(redirect) {
+		redirect = "/"
+	}
+	u, err := core.OidcLoginUrl(r.Context(), redirect)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	http.Redirect(w, r, u, http.StatusFound)
+}
+
+// isLocalRedirect only accepts a path on this site, otherwise the login could be used to send the users to any site: the browsers
+// ignore the control characters (e.g., "/\t/evil.com") and read a backslash as a slash ("/\\evil.com")
+func isLocalRedirect(redirect string) bool {
+	if strings.ContainsFunc(redirect, unicode.IsControl) {
+		return false
+	}
+	u, err := url.Parse(redirect)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.User != nil {
+		return false
+	}
+	return strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(u.Path, "//") && !strings.HasPrefix(u.Path, "/\\")
+}
+
+// LoginCallback completes the login and sets the session cookie
+func LoginCallback(w http.ResponseWriter, r *http.Request) {
+	if e := r.URL.Query().Get("error"); e != "" {
+		WriteError(w, r, http.StatusUnauthorized, fmt.Errorf("login failed: %v %v", e, r.URL.Query().Get("error_description")))
+		return
+	}
+	sessionId, redirect, err := core.CompleteOidcLogin(r.Context(), r.URL.Query().Get("code"), r.URL.Query().Get("state"))
+	if err != nil {
+		WriteError(w, r, http.StatusUnauthorized, fmt.Errorf("login failed: %v", err))
+		return
+	}
+	http.SetCookie(w, sessionCookie(r, sessionId, 0))
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// Logout revokes the session and the OAuth tokens obtained in the session, with the "all" parameter all sessions of the user
+func Logout(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(core.SessionCookieName); err == nil {
+		core.EndSession(r.Context(), c.Value)
+	}
+	if user := core.GetUserFromHeader(r.Header); r.URL.Query().Get("all") == "true" && user != "" {
+		core.EndUserSessions(r.Context(), user)
+	}
+	http.SetCookie(w, sessionCookie(r, "", -1))
+	w.Write([]byte("OK"))
+}
+
+// Me returns the identity of the authenticated user
+func Me(w http.ResponseWriter, r *http.Request) {
+	identity, ok := core.IdentityFromContext(r.Context())
+	if !ok {
+		WriteError(w, r, http.StatusUnauthorized, errors.New("not authenticated"))
+		return
+	}
+	writeJson(w, r, identity)
+}
+
+func sessionCookie(r *http.Request, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     core.SessionCookieName,
+		Value:    value,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,119 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"net/http"
+)
+
+type BagRequest struct {
+	PersistentId string   `json:"persistentId"`
+	DataverseKey string   `json:"dataverseKey"`
+	Version      string   `json:"version,omitempty"` // ":latest" (default), ":draft", ":latest-published" or a version number (e.g., "1.2")
+	Files        []string `json:"files,omitempty"`   // paths of the files in the dataset (e.g., the selection of a comparison), all files when empty
+}
+
+type BagResponse struct {
+	Found  bool           `json:"found"`
+	Report core.BagReport `json:"report"`
+}
+
+// starts the job writing the dataset version (or the selected files) as a BagIt bag to the export storage
+func Bag(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req, user, ok := decodeBagRequest(w, r)
+	if !ok {
+		return
+	}
+	if !core.BagExportEnabled() {
+		WriteError(w, r, http.StatusBadRequest, errors.New("bag export storage is not configured, use /api/common/bagdownload"))
+		return
+	}
+	err := core.AddBagExportJob(r.Context(), req.DataverseKey, user, req.PersistentId, req.Version, req.Files)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// streams the dataset version (or the selected files) as a BagIt bag (zip)
+func BagDownload(w http.ResponseWriter, r *http.Request) {
+	req, user, ok := decodeBagRequest(w, r)
+	if !ok {
+		return
+	}
+	nodes, err := core.DatasetFiles(r.Context(), req.DataverseKey, user, req.PersistentId, req.Version, req.Files)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", core.BagName(req.PersistentId)+".zip"))
+	version := req.Version
+	if version == "" {
+		version = core.LatestVersion
+	}
+	_, _, err = core.WriteBag(r.Context(), w, req.DataverseKey, user, req.PersistentId, version, nodes)
+	if err != nil {
+		// the status is already sent: the client sees a truncated (invalid) zip
+		logging.Logger.ErrorContext(r.Context(), "bag download failed", "persistentId", req.PersistentId, "error", err)
+	}
+}
+
+// returns the report of the last (or running) bag export job of the dataset
+func BagReport(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req, _, ok := decodeBagRequest(w, r)
+	if !ok {
+		return
+	}
+	report, found := core.GetBagReport(r.Context(), req.PersistentId)
+	b, err := json.Marshal(BagResponse{Found: found, Report: report})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+func decodeBagRequest(w http.ResponseWriter, r *http.Request) (BagRequest, string, bool) {
+	req := BagRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return req, "", false
+	}
+	user, ok := checkDatasetAccess(w, r, req.DataverseKey, req.PersistentId, req.Version)
+	return req, user, ok
+}
+
+// checkDatasetAccess validates the version and checks that the user can access the dataset, the error is written when not
+func checkDatasetAccess(w http.ResponseWriter, r *http.Request, dataverseKey, persistentId, version string) (string, bool) {
+	if !core.ValidVersion(version) {
+		WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid dataset version: %v", version))
+		return "", false
+	}
+	err := core.CheckScope(r.Context(), nil, persistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusForbidden, err)
+		return "", false
+	}
+	user := core.GetUserFromHeader(r.Header)
+	err = core.Destination.CheckPermission(r.Context(), dataverseKey, user, persistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return "", false
+	}
+	return user, true
+}
@@ -0,0 +1,162 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/plugin/types"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// the pages of the dataset picker are cached shortly, as the user pages back and forth
+var browseCacheDuration = 5 * time.Minute
+
+// DatasetsRequest lists a page of the datasets of the user, so that the frontend can offer a dataset picker
+type DatasetsRequest struct {
+	DataverseKey string `json:"dataverseKey"`
+	core.DatasetQuery
+	Refresh bool `json:"refresh,omitempty"` // the cached page is not used
+}
+
+// CollectionRequest lists the subcollections and the datasets of a collection, for browsing the collection tree
+type CollectionRequest struct {
+	DataverseKey string `json:"dataverseKey"`
+	Collection   string `json:"collection,omitempty"` // alias or database id of the collection, the root collection when empty
+	Refresh      bool   `json:"refresh,omitempty"`    // the cached contents are not used
+}
+
+// DatasetCollectionsRequest lists the collections where the user can create datasets, for choosing the collection of a new dataset
+type DatasetCollectionsRequest struct {
+	DataverseKey string `json:"dataverseKey"`
+	SearchTerm   string `json:"searchTerm,omitempty"`
+	Refresh      bool   `json:"refresh,omitempty"` // the cached collections are not used
+}
+
+type CollectionResponse struct {
+	Collection string                `json:"collection,omitempty"`
+	Items      []core.CollectionItem `json:"items"`
+}
+
+// browseKey identifies the cached answer of the user (the hash of the key, as the API key of the user is part of it), also per
+// Dataverse target
+func browseKey(ctx context.Context, user, token string, req interface{}) string {
+	b, _ := json.Marshal(req)
+	h := sha256.Sum256([]byte(strings.Join([]string{user, token, config.TargetName(ctx), string(b)}, "\n")))
+	return "browse: " + hex.EncodeToString(h[:16])
+}
+
+// cachedBrowse returns the cached answer, the answer is listed again when Redis is not ready
+func cachedBrowse(ctx context.Context, key string, res interface{}) bool {
+	if !config.RedisReady(ctx) {
+		return false
+	}
+	cached, _ := config.GetRedis().Get(ctx, key)
+	return cached != "" && json.Unmarshal([]byte(cached), res) == nil
+}
+
+func cacheBrowse(ctx context.Context, key string, res interface{}) {
+	if !config.RedisReady(ctx) {
+		return
+	}
+	if b, err := json.Marshal(res); err == nil {
+		config.GetRedis().Set(ctx, key, string(b), browseCacheDuration)
+	}
+}
+
+// Datasets returns a page of the datasets where the user has a role (or a role allowing to edit), the datasets that the service
+// API key of the call is not allowed to access are left out
+func Datasets(w http.ResponseWriter, r *http.Request) {
+	req := DatasetsRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	if core.Destination.ListDatasets == nil {
+		WriteError(w, r, http.StatusNotFound, errors.New("listing the datasets is not supported by the destination"))
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	key := browseKey(r.Context(), user, req.DataverseKey, req.DatasetQuery)
+	res := core.DatasetPage{}
+	if req.Refresh || !cachedBrowse(r.Context(), key, &res) {
+		var err error
+		res, err = core.Destination.ListDatasets(r.Context(), req.DataverseKey, user, req.DatasetQuery)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		cacheBrowse(r.Context(), key, res)
+	}
+	items := []core.DatasetItem{}
+	for _, v := range res.Items {
+		if core.CheckScope(r.Context(), nil, v.PersistentId) == nil {
+			items = append(items, v)
+		}
+	}
+	res.Items = items
+	writeJson(w, r, res)
+}
+
+// Collection returns the subcollections and the datasets of the collection that the user can see
+func Collection(w http.ResponseWriter, r *http.Request) {
+	req := CollectionRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	if core.Destination.CollectionContents == nil {
+		WriteError(w, r, http.StatusNotFound, errors.New("browsing the collections is not supported by the destination"))
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	key := browseKey(r.Context(), user, req.DataverseKey, "collection: "+req.Collection)
+	res := CollectionResponse{Collection: req.Collection}
+	if req.Refresh || !cachedBrowse(r.Context(), key, &res) {
+		items, err := core.Destination.CollectionContents(r.Context(), req.DataverseKey, user, req.Collection)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		res.Items = items
+		cacheBrowse(r.Context(), key, res)
+	}
+	items := []core.CollectionItem{}
+	for _, v := range res.Items {
+		if v.Type != "dataset" || core.CheckScope(r.Context(), nil, v.Id) == nil {
+			items = append(items, v)
+		}
+	}
+	res.Items = items
+	writeJson(w, r, res)
+}
+
+// DatasetCollections returns the collections where the user can create datasets, as the options of the collection of /api/common/newdataset
+func DatasetCollections(w http.ResponseWriter, r *http.Request) {
+	req := DatasetCollectionsRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	if core.Destination.DatasetCollections == nil {
+		WriteError(w, r, http.StatusNotFound, errors.New("listing the collections is not supported by the destination"))
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	key := browseKey(r.Context(), user, req.DataverseKey, "dataset collections: "+req.SearchTerm)
+	res := []types.SelectItem{}
+	if req.Refresh || !cachedBrowse(r.Context(), key, &res) {
+		var err error
+		res, err = core.Destination.DatasetCollections(r.Context(), req.SearchTerm, req.DataverseKey, user)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		cacheBrowse(r.Context(), key, res)
+	}
+	writeJson(w, r, res)
+}
@@ -3,14 +3,20 @@
 package common
 
 import (
+	"cmp"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"integration/app/config"
 	"integration/app/core"
+	"integration/app/logging"
 	"integration/app/tree"
-	"io"
 	"net/http"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -24,94 +30,208 @@ type Key struct {
 	Key string `json:"key"`
 }
 
+// CachedRequest selects the nodes of a cached compare response, all nodes are returned (and the response is removed from the cache)
+// when no page size and no filter are set
+type CachedRequest struct {
+	Key        string   `json:"key"`
+	Page       int      `json:"page,omitempty"`       // zero based
+	PageSize   int      `json:"pageSize,omitempty"`   // all matching nodes when not set
+	Sort       string   `json:"sort,omitempty"`       // "path" (default), "name", "size" or "status", prefixed with "-" for the descending order
+	Status     []string `json:"status,omitempty"`     // "new", "updated", "deleted", "equal" or "unknown", all when empty
+	PathPrefix string   `json:"pathPrefix,omitempty"` // folder of the nodes
+	Name       string   `json:"name,omitempty"`       // case insensitive substring of the file name
+}
+
 type CachedResponse struct {
 	Key          string               `json:"key"`
 	Ready        bool                 `json:"ready"`
 	Response     core.CompareResponse `json:"res"`
 	ErrorMessage string               `json:"err"`
+	ComparedAt   time.Time            `json:"comparedAt,omitempty"` // when the repository was compared, older for the pre-warmed results
+	Prewarmed    bool                 `json:"prewarmed,omitempty"`  // the result of a background compare
+	Total        int                  `json:"total,omitempty"`      // number of the nodes matching the filter, when paged or filtered
+	Page         int                  `json:"page,omitempty"`
+	PageSize     int                  `json:"pageSize,omitempty"`
 }
 
 var cacheMaxDuration = 5 * time.Minute
 
+// the paged responses are kept while the pages are fetched
+var pagedCacheDuration = 30 * time.Minute
+
+var nodeSorts = map[string]func(a, b tree.Node) int{
+	"path":   func(a, b tree.Node) int { return strings.Compare(a.Id, b.Id) },
+	"name":   func(a, b tree.Node) int { return strings.Compare(a.Name, b.Name) },
+	"size":   func(a, b tree.Node) int { return cmp.Compare(a.Size(), b.Size()) },
+	"status": func(a, b tree.Node) int { return cmp.Compare(a.Status, b.Status) },
+}
+
 func CacheResponse(res CachedResponse) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
 	defer cancel()
-	b, _ := json.Marshal(res)
-	config.GetRedis().Set(ctx, res.Key, string(b), cacheMaxDuration)
+	encoded, err := core.EncodeCached(res)
+	if err != nil {
+		encoded, _ = core.EncodeCached(CachedResponse{Key: res.Key, ErrorMessage: fmt.Sprintf("caching the compare response failed: %v", err)})
+	}
+	config.GetRedis().Set(ctx, res.Key, encoded, cacheMaxDuration)
+	config.GetRedis().SAdd(ctx, core.CachedResponsesKey, res.Key)
+	event := core.ProgressEvent{Type: core.EventDone, Key: res.Key, Status: "finished"}
+	if res.ErrorMessage != "" {
+		event.Status, event.Error = "failed", res.ErrorMessage
+	}
+	core.PublishEvent(ctx, event)
 }
 
 // this is called after specific compare request (e.g. github compare)
 func GetCachedResponse(w http.ResponseWriter, r *http.Request) {
 	if !config.RedisReady(r.Context()) {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - cache not ready"))
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
 		return
 	}
 	//process request
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+
+	req := CachedRequest{}
+	if !DecodeRequest(w, r, &req) {
 		return
 	}
-
-	key := Key{}
-	err = json.Unmarshal(b, &key)
+	paged := req.PageSize > 0 || len(req.Status) > 0 || req.PathPrefix != "" || req.Name != ""
+	filter, err := req.filter()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+		WriteError(w, r, http.StatusBadRequest, err)
 		return
 	}
 
-	res := CachedResponse{Key: key.Key}
-	cached := config.GetRedis().Get(r.Context(), res.Key)
-	if cached.Val() != "" {
-		json.Unmarshal([]byte(cached.Val()), &res)
-		config.GetRedis().Del(r.Context(), res.Key)
+	res := CachedResponse{Key: req.Key}
+	cached, _ := config.GetRedis().Get(r.Context(), res.Key)
+	// the ETag of the cached value and the selection: the unchanged pages are not decoded again
+	etag := cachedETag(cached, req)
+	if cached != "" && notModified(w, r, etag) {
+		return
+	}
+	if cached != "" {
+		if err := core.DecodeCached(cached, &res); err != nil {
+			WriteError(w, r, http.StatusInternalServerError, fmt.Errorf("decoding the cached response failed: %v", err))
+			return
+		}
+		if paged {
+			config.GetRedis().Expire(r.Context(), res.Key, pagedCacheDuration)
+		} else {
+			config.GetRedis().Del(r.Context(), res.Key)
+			config.GetRedis().SRem(r.Context(), core.CachedResponsesKey, res.Key)
+		}
 		res.Ready = true
 	}
 	if res.ErrorMessage != "" {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", res.ErrorMessage)))
+		WriteError(w, r, http.StatusInternalServerError, cachedError(res.ErrorMessage))
 		return
 	}
-	b, err = json.Marshal(res)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
-		return
+	if paged && res.Ready {
+		res.Response.Data, res.Total = filter(res.Response.Data)
+		res.Page, res.PageSize = req.Page, req.PageSize
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if res.Ready {
+		w.Header().Set("ETag", etag)
+	}
+	// encoded as a stream, the nodes of a large repository are not marshalled into one more copy
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		logging.Logger.WarnContext(r.Context(), "writing the cached response failed", "key", res.Key, "error", err)
 	}
-	w.Write(b)
+}
+
+// cachedETag identifies the response of the cached value for the request: the cached value changes when the repository is
+// compared again, the request selects the nodes of the response
+func cachedETag(cached string, req CachedRequest) string {
+	h := sha256.New()
+	h.Write([]byte(cached))
+	selection, _ := json.Marshal(req)
+	h.Write(selection)
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified writes 304 Not Modified when the client already has the response (the If-None-Match header), e.g., when the pages
+// of a large compare response are fetched again
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimSpace(match)
+		if match == "*" || strings.TrimPrefix(match, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.Header().Set("ETag", etag)
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+	return false
+}
+
+// filter returns the function selecting, sorting and paging the nodes, it also returns the number of the matching nodes
+func (req CachedRequest) filter() (func([]tree.Node) ([]tree.Node, int), error) {
+	if req.Page < 0 || req.PageSize < 0 {
+		return nil, fmt.Errorf("page and pageSize must not be negative")
+	}
+	statuses := map[int]bool{}
+	for _, s := range req.Status {
+		status, ok := tree.StatusByName(s)
+		if !ok {
+			return nil, fmt.Errorf("unknown status %v", s)
+		}
+		statuses[status] = true
+	}
+	sortBy, descending := strings.CutPrefix(req.Sort, "-")
+	if sortBy == "" {
+		sortBy = "path"
+	}
+	compare, ok := nodeSorts[sortBy]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort %v", req.Sort)
+	}
+	prefix := strings.TrimSuffix(req.PathPrefix, "/")
+	name := strings.ToLower(req.Name)
+	return func(nodes []tree.Node) ([]tree.Node, int) {
+		res := []tree.Node{}
+		for _, n := range nodes {
+			if len(statuses) > 0 && !statuses[n.Status] {
+				continue
+			}
+			if prefix != "" && n.Path != prefix && !strings.HasPrefix(n.Path, prefix+"/") {
+				continue
+			}
+			if name != "" && !strings.Contains(strings.ToLower(n.Name), name) {
+				continue
+			}
+			res = append(res, n)
+		}
+		slices.SortStableFunc(res, func(a, b tree.Node) int {
+			// the id breaks the ties, so that the pages are stable
+			c := cmp.Or(compare(a, b), strings.Compare(a.Id, b.Id))
+			if descending {
+				return -c
+			}
+			return c
+		})
+		total := len(res)
+		if req.PageSize == 0 {
+			return res, total
+		}
+		start := min(req.Page*req.PageSize, total)
+		return res[start:min(start+req.PageSize, total)], total
+	}, nil
 }
 
 // this is called when polling for status changes, after specific compare is finished or store is calleed
 func Compare(w http.ResponseWriter, r *http.Request) {
 	if !config.RedisReady(r.Context()) {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - cache not ready"))
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
 		return
 	}
 	//process request
 	req := CompareRequest{}
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
-		return
-	}
-	err = json.Unmarshal(b, &req)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !DecodeRequest(w, r, &req) {
 		return
 	}
 
-	errMessage := config.GetRedis().Get(r.Context(), fmt.Sprintf("error %v", req.PersistentId))
-	if errMessage != nil && errMessage.Val() != "" {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("Job failed: %v", errMessage)))
+	errMessage, _ := config.GetRedis().Get(r.Context(), fmt.Sprintf("error %v", req.PersistentId))
+	if errMessage != "" {
+		WriteError(w, r, http.StatusInternalServerError, fmt.Errorf("job failed: %w", cachedError(errMessage)))
 		return
 	}
 
@@ -124,10 +244,9 @@ func Compare(w http.ResponseWriter, r *http.Request) {
 	//compare and write response
 	user := core.GetUserFromHeader(r.Header)
 	res := core.Compare(r.Context(), nm, req.PersistentId, req.DataverseKey, user, false)
-	b, err = json.Marshal(res)
+	b, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
@@ -0,0 +1,92 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+	"time"
+)
+
+type CredentialRequest struct {
+	DataverseKey string `json:"dataverseKey"`
+}
+
+type CredentialResponse struct {
+	Reference string    `json:"reference"` // sent instead of the Dataverse API key (the "dataverseKey" field) in the other calls
+	Expires   time.Time `json:"expires"`
+}
+
+// Credential stores the Dataverse API key of the user on the server and returns a reference to it: the clients send the reference
+// instead of the key, so that the key itself does not travel in every request body
+func Credential(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := CredentialRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	if req.DataverseKey == "" || core.IsCredentialRef(req.DataverseKey) {
+		WriteError(w, r, http.StatusBadRequest, fmt.Errorf("dataverseKey must be a Dataverse API key"))
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	// only valid keys are stored
+	if _, err := core.Destination.GetUserEmail(r.Context(), req.DataverseKey, user); err != nil {
+		WriteError(w, r, http.StatusUnauthorized, fmt.Errorf("the Dataverse API key is not valid: %w", err))
+		return
+	}
+	ref, err := core.CredentialRef(r.Context(), req.DataverseKey)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	core.RegisterUserData(r.Context(), user, core.UserDataEntry{
+		Type:        "credential",
+		Key:         core.CredentialKey(ref),
+		Description: "Dataverse API key referenced by the requests and the jobs",
+	}, core.CredentialExpiration())
+	writeJson(w, r, CredentialResponse{Reference: ref, Expires: time.Now().Add(core.CredentialExpiration())})
+}
+
+type ProvisionedCredentialRequest struct {
+	Recreate bool `json:"recreate,omitempty"` // a new API token is created even when the stored token is still valid
+}
+
+// ProvisionedCredential returns a reference to the Dataverse API token of the logged in user, the token is looked up or (re)created
+// on the server (see the apiTokenProvisioning option): the users then never copy their API token into the form
+func ProvisionedCredential(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	if !config.GetConfig().Options.ApiTokenProvisioning {
+		WriteError(w, r, http.StatusNotFound, fmt.Errorf("the provisioning of the API tokens is not enabled"))
+		return
+	}
+	req := ProvisionedCredentialRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	if user == "" {
+		WriteError(w, r, http.StatusUnauthorized, fmt.Errorf("login required"))
+		return
+	}
+	ref, err := core.ProvisionedCredential(r.Context(), user, req.Recreate)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, fmt.Errorf("the API token could not be provisioned: %w", err))
+		return
+	}
+	core.RegisterUserData(r.Context(), user, core.UserDataEntry{
+		Type:        "credential",
+		Key:         core.CredentialKey(ref),
+		Description: "Dataverse API token created for the user, referenced by the requests and the jobs",
+	}, core.CredentialExpiration())
+	writeJson(w, r, CredentialResponse{Reference: ref, Expires: time.Now().Add(core.CredentialExpiration())})
+}
@@ -4,9 +4,7 @@ package common
 
 import (
 	"encoding/json"
-	"fmt"
 	"integration/app/core"
-	"io"
 	"net/http"
 )
 
@@ -20,31 +18,19 @@ type DvObjectsRequest struct {
 func DvObjects(w http.ResponseWriter, r *http.Request) {
 	user := core.GetUserFromHeader(r.Header)
 	//process request
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
-		return
-	}
 
 	req := DvObjectsRequest{}
-	err = json.Unmarshal(b, &req)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !DecodeRequest(w, r, &req) {
 		return
 	}
 	res, err := core.Destination.Options(r.Context(), req.ObjectType, req.Collection, req.SearchTerm, req.Token, user)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
-	b, err = json.Marshal(res)
+	b, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
@@ -0,0 +1,132 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"integration/app/core"
+	"integration/app/httpclient"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// error codes of the API, the frontend reacts on the code (e.g., asks the user to log in to the repository again) and shows the message
+const (
+	CodeBadRequest         = "bad_request"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodePermissionDenied   = "permission_denied"
+	CodeNotFound           = "not_found"
+	CodeDatasetLocked      = "dataset_locked"
+	CodeTooLarge           = "too_large"
+	CodeQuotaExceeded      = "quota_exceeded"
+	CodeRateLimited        = "rate_limited"
+	CodeUnsupported        = "unsupported"
+	CodePluginUnauthorized = "plugin_unauthorized"
+	CodePluginScope        = "plugin_insufficient_scope"
+	CodeTimeout            = "timeout"
+	CodeUnavailable        = "unavailable"
+	CodeInternal           = "internal"
+)
+
+// ApiError is the body of the error responses
+type ApiError struct {
+	Code          string      `json:"code"`
+	Message       string      `json:"message"`
+	Details       interface{} `json:"details,omitempty"`
+	Retryable     bool        `json:"retryable"` // the same call can succeed later, e.g., when the dataset is no longer locked
+	CorrelationId string      `json:"correlationId,omitempty"`
+}
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusConflict:              CodeDatasetLocked,
+	http.StatusRequestEntityTooLarge: CodeTooLarge,
+	http.StatusTooManyRequests:       CodeRateLimited,
+	http.StatusGatewayTimeout:        CodeTimeout,
+	http.StatusServiceUnavailable:    CodeUnavailable,
+}
+
+// WriteError writes the error response: the status and the code follow from the failure class of the error (see core/errors.go),
+// or from the given status when the error is not classified
+func WriteError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	status, apiError := classifyError(status, err)
+	apiError.CorrelationId = logging.CorrelationId(r.Context())
+	if status >= http.StatusInternalServerError {
+		logging.Logger.ErrorContext(r.Context(), "request failed", "path", r.URL.Path, "status", status, "error", err)
+	}
+	b, _ := json.Marshal(apiError)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// cachedError restores the failure class of an error cached as a message (e.g., of the compare running in the background), the
+// messages of the wrapping errors contain the message of the wrapped error
+func cachedError(message string) error {
+	for _, e := range []error{core.ErrPermissionDenied, core.ErrDatasetLocked, core.ErrRateLimited, core.ErrQuotaExceeded, core.ErrUnsupported, types.ErrUnauthorized, types.ErrInsufficientScope, types.ErrRateLimited} {
+		if strings.Contains(message, e.Error()+": ") {
+			return cachedErr{message, e}
+		}
+	}
+	return errors.New(message)
+}
+
+type cachedErr struct {
+	message string
+	class   error
+}
+
+func (e cachedErr) Error() string {
+	return e.message
+}
+
+func (e cachedErr) Unwrap() error {
+	return e.class
+}
+
+func classifyError(status int, err error) (int, ApiError) {
+	res := ApiError{Message: err.Error()}
+	var requestError *RequestError
+	var netError net.Error
+	switch {
+	case errors.As(err, &requestError):
+		status = requestError.Status
+	case errors.Is(err, core.ErrPermissionDenied):
+		status, res.Code = http.StatusForbidden, CodePermissionDenied
+	case errors.Is(err, core.ErrDatasetLocked):
+		status, res.Code, res.Retryable = http.StatusConflict, CodeDatasetLocked, true
+	case errors.Is(err, core.ErrQuotaExceeded):
+		status, res.Code = http.StatusRequestEntityTooLarge, CodeQuotaExceeded
+	case errors.Is(err, core.ErrUnsupported):
+		status, res.Code = http.StatusNotImplemented, CodeUnsupported
+	case errors.Is(err, core.ErrRateLimited) || errors.Is(err, types.ErrRateLimited):
+		status, res.Retryable = http.StatusTooManyRequests, true
+	case errors.Is(err, httpclient.ErrCircuitOpen):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, types.ErrUnauthorized):
+		status, res.Code = http.StatusUnauthorized, CodePluginUnauthorized
+	case errors.Is(err, types.ErrInsufficientScope):
+		status, res.Code = http.StatusForbidden, CodePluginScope
+	case errors.Is(err, context.DeadlineExceeded) || errors.As(err, &netError) && netError.Timeout():
+		status, res.Retryable = http.StatusGatewayTimeout, true
+	}
+	if res.Code == "" {
+		res.Code = CodeInternal
+		if code, ok := statusCodes[status]; ok {
+			res.Code = code
+		}
+	}
+	if status == http.StatusServiceUnavailable || status == http.StatusTooManyRequests {
+		res.Retryable = true
+	}
+	return status, res
+}
@@ -0,0 +1,107 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+	"time"
+)
+
+// comment lines keep the idle streams open through the proxies
+const eventsHeartbeat = 30 * time.Second
+
+// Events streams the progress events (Server-Sent Events) of a compare (?key=...) or of the jobs of a dataset (?persistentId=...),
+// the compare stream ends with its "done" event, the result is then fetched from /api/common/cached as before
+func Events(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	key, persistentId := r.URL.Query().Get("key"), r.URL.Query().Get("persistentId")
+	if (key == "") == (persistentId == "") {
+		WriteError(w, r, http.StatusBadRequest, errors.New("either key or persistentId must be set"))
+		return
+	}
+	channel := core.CompareEventsChannel(key)
+	if persistentId != "" {
+		if err := core.CheckScope(r.Context(), nil, persistentId); err != nil {
+			WriteError(w, r, http.StatusForbidden, err)
+			return
+		}
+		channel = core.DatasetEventsChannel(persistentId)
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		WriteError(w, r, http.StatusInternalServerError, errors.New("streaming is not supported"))
+		return
+	}
+	events, unsubscribe, err := core.SubscribeEvents(r.Context(), channel)
+	if err != nil {
+		WriteError(w, r, http.StatusServiceUnavailable, err)
+		return
+	}
+	defer unsubscribe()
+
+	// the stream is not limited by the read and write timeouts of the server
+	rc := http.NewResponseController(w)
+	rc.SetReadDeadline(time.Time{})
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	// the compare could have finished before the subscription
+	if key != "" {
+		if cached, _ := config.GetRedis().Get(r.Context(), key); cached != "" {
+			res := CachedResponse{}
+			core.DecodeCached(cached, &res)
+			event := core.ProgressEvent{Type: core.EventDone, Key: key, Status: "finished", Time: time.Now()}
+			if res.ErrorMessage != "" {
+				event.Status, event.Error = "failed", res.ErrorMessage
+			}
+			writeEvent(w, event)
+			flusher.Flush()
+			return
+		}
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	heartbeat := time.NewTicker(eventsHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-core.Stop:
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			// the dataset stream only shows the jobs of the user
+			if persistentId != "" && event.User != user {
+				continue
+			}
+			writeEvent(w, event)
+			if event.Type == core.EventDone && key != "" {
+				flusher.Flush()
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, event core.ProgressEvent) {
+	b, _ := json.Marshal(event)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, b)
+}
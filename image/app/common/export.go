@@ -0,0 +1,89 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/export"
+	"net/http"
+)
+
+type ExportRequest struct {
+	PersistentId string   `json:"persistentId"`
+	DataverseKey string   `json:"dataverseKey"`
+	Version      string   `json:"version,omitempty"` // ":latest" (default), ":draft", ":latest-published" or a version number (e.g., "1.2")
+	Files        []string `json:"files,omitempty"`   // paths of the files in the dataset, all files when empty
+	Target       string   `json:"target"`            // id of the export target, see /api/common/exporttargets
+	Folder       string   `json:"folder,omitempty"`  // folder within the target the files are written to, the files keep their paths in the dataset
+	Token        string   `json:"token,omitempty"`   // credentials of the user at the target (e.g., the WebDAV password or the Globus access token)
+}
+
+type ExportTargetsResponse struct {
+	Targets []export.TargetInfo `json:"targets"`
+}
+
+type ExportReportResponse struct {
+	Found  bool           `json:"found"`
+	Report core.JobReport `json:"report"`
+}
+
+// lists the configured export targets
+func ExportTargets(w http.ResponseWriter, r *http.Request) {
+	b, err := json.Marshal(ExportTargetsResponse{Targets: export.Targets()})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// starts the job exporting the dataset version (or the selected files) to the export target
+func Export(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := ExportRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	user, ok := checkDatasetAccess(w, r, req.DataverseKey, req.PersistentId, req.Version)
+	if !ok {
+		return
+	}
+	if err := export.Check(req.Target, req.Folder); err != nil {
+		WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	err := core.AddExportJob(r.Context(), req.DataverseKey, user, req.PersistentId, req.Version, req.Files, req.Target, req.Folder, req.Token)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// returns the report of the last export job of the dataset
+func ExportReport(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := ExportRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	if _, ok := checkDatasetAccess(w, r, req.DataverseKey, req.PersistentId, req.Version); !ok {
+		return
+	}
+	report, found := core.GetExportReport(r.Context(), req.PersistentId)
+	b, err := json.Marshal(ExportReportResponse{Found: found, Report: report})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
@@ -0,0 +1,67 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+)
+
+type FixityResponse struct {
+	Found  bool              `json:"found"`
+	Report core.FixityReport `json:"report"`
+}
+
+// starts a fixity verification job for all files of the dataset
+func Fixity(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := ReportRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	err := core.Destination.CheckPermission(r.Context(), req.DataverseKey, user, req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	err = core.AddFixityJob(r.Context(), req.DataverseKey, user, req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// returns the report of the last (or running) fixity verification job for the dataset
+func FixityReport(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := ReportRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	err := core.Destination.CheckPermission(r.Context(), req.DataverseKey, user, req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	report, found := core.GetFixityReport(r.Context(), req.PersistentId)
+	b, err := json.Marshal(FixityResponse{Found: found, Report: report})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
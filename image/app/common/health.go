@@ -0,0 +1,61 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+	"time"
+)
+
+const readinessTimeout = 5 * time.Second
+
+type ReadinessResponse struct {
+	Status string            `json:"status"` // "ok" or "unavailable"
+	Checks map[string]string `json:"checks"` // "ok" or the error per check
+}
+
+// Healthz reports that the process is up
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// Readyz reports whether the application can serve requests and process jobs: 503 when one of the checks fails
+func Readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	res := ReadinessResponse{Status: "ok", Checks: map[string]string{}}
+	check := func(name string, err error) {
+		if err != nil {
+			res.Status = "unavailable"
+			res.Checks[name] = err.Error()
+		} else {
+			res.Checks[name] = "ok"
+		}
+	}
+	check("config", config.Validate())
+	redisReady := config.RedisReady(ctx)
+	if redisReady {
+		check("redis", nil)
+	} else {
+		check("redis", errors.New("redis is not reachable"))
+	}
+	check("dataverse", core.Destination.Ping(ctx))
+	if !redisReady {
+		check("workers", errors.New("unknown: redis is not reachable"))
+	} else if core.WorkersAlive(ctx) {
+		check("workers", nil)
+	} else {
+		check("workers", errors.New("no worker heartbeat"))
+	}
+	b, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	if res.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(b)
+}
@@ -0,0 +1,82 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"integration/app/core"
+	"net/http"
+	"time"
+)
+
+type HistoryRequest struct {
+	PersistentId string    `json:"persistentId"` // when empty, only the jobs of the current user are returned
+	DataverseKey string    `json:"dataverseKey"`
+	Since        time.Time `json:"since"`
+	Until        time.Time `json:"until"`
+	Limit        int       `json:"limit"`
+}
+
+type HistoryResponse struct {
+	Jobs []core.HistoryRecord `json:"jobs"`
+}
+
+type ConnectionsResponse struct {
+	Connections []core.Connection `json:"connections"`
+}
+
+// returns the finished jobs of the dataset (or of the current user) from the history database
+func History(w http.ResponseWriter, r *http.Request) {
+	req := HistoryRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	query := core.HistoryQuery{PersistentId: req.PersistentId, Since: req.Since, Until: req.Until, Limit: req.Limit}
+	if req.PersistentId == "" {
+		if user == "" {
+			WriteError(w, r, http.StatusForbidden, errors.New("unknown user: persistentId is required"))
+			return
+		}
+		query.User = user
+	} else {
+		err := core.Destination.CheckPermission(r.Context(), req.DataverseKey, user, req.PersistentId)
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	jobs, err := core.GetHistory(r.Context(), query)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	b, err := json.Marshal(HistoryResponse{Jobs: jobs})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// returns the source repositories previously synchronized by the current user
+func Connections(w http.ResponseWriter, r *http.Request) {
+	user := core.GetUserFromHeader(r.Header)
+	if user == "" {
+		WriteError(w, r, http.StatusForbidden, errors.New("unknown user"))
+		return
+	}
+	connections, err := core.GetConnections(r.Context(), user)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	b, err := json.Marshal(ConnectionsResponse{Connections: connections})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
@@ -0,0 +1,35 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+)
+
+// removes the cached hashes of the dataset files, e.g., after the files were replaced outside of this application
+func InvalidateCache(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := ReportRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	err := core.Destination.CheckPermission(r.Context(), req.DataverseKey, user, req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if core.IsLocked(r.Context(), req.PersistentId) {
+		WriteError(w, r, http.StatusConflict, errors.New("a job for this dataset is in progress"))
+		return
+	}
+	core.InvalidateKnownHashes(r.Context(), req.PersistentId)
+	w.Write([]byte("OK"))
+}
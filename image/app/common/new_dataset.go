@@ -4,15 +4,14 @@ package common
 
 import (
 	"encoding/json"
-	"fmt"
 	"integration/app/core"
-	"io"
 	"net/http"
 )
 
 type NewDatasetRequest struct {
-	Collection   string `json:"collection"`
-	DataverseKey string `json:"dataverseKey"`
+	Collection   string               `json:"collection"`
+	DataverseKey string               `json:"dataverseKey"`
+	Metadata     core.DatasetMetadata `json:"metadata"`
 }
 
 type NewDatasetResponse struct {
@@ -21,36 +20,31 @@ type NewDatasetResponse struct {
 
 func NewDataset(w http.ResponseWriter, r *http.Request) {
 	req := NewDatasetRequest{}
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !DecodeRequest(w, r, &req) {
 		return
 	}
-	err = json.Unmarshal(b, &req)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	// the API keys limited to datasets can not create new ones
+	if err := core.CheckScope(r.Context(), nil, ""); err != nil {
+		WriteError(w, r, http.StatusForbidden, err)
 		return
 	}
 
 	user := core.GetUserFromHeader(r.Header)
-	pid, err := core.Destination.CreateNewRepo(r.Context(), req.Collection, req.DataverseKey, user)
+	metadata := req.Metadata.WithOrcidContributor(r.Context(), user)
+	pid, err := core.Destination.CreateNewRepo(r.Context(), req.Collection, req.DataverseKey, user, metadata)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
+	core.AuditDatasetCreated(r.Context(), user, req.Collection, pid)
 
 	res := NewDatasetResponse{
 		PersistentId: pid,
 	}
 
-	b, err = json.Marshal(res)
+	b, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
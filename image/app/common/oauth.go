@@ -6,7 +6,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"integration/app/core"
-	"io"
 	"net/http"
 )
 
@@ -18,32 +17,48 @@ type OauthTokenRequest struct {
 
 func GetOauthToken(w http.ResponseWriter, r *http.Request) {
 	req := OauthTokenRequest{}
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
-		return
-	}
-	err = json.Unmarshal(b, &req)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !DecodeRequest(w, r, &req) {
 		return
 	}
 
 	sessionId := core.GetSessionId(r.Header)
 	res, err := core.GetOauthToken(r.Context(), req.PluginId, req.Code, "", sessionId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
+	user := core.GetUserFromHeader(r.Header)
+	core.RegisterUserData(r.Context(), user, core.UserDataEntry{
+		Type:        "oauth token",
+		Key:         core.TokenCacheKey(req.PluginId, sessionId),
+		Description: fmt.Sprintf("OAuth access and refresh tokens for %v", req.PluginId),
+	}, res.Expiration)
+	if req.PluginId == core.OrcidPluginId {
+		// the ORCID login identifies the user, the ORCID iD is recorded in the audit log and the created datasets
+		err = core.LinkOrcid(r.Context(), user, core.Orcid{Id: res.Orcid, Name: res.Name})
+		if err != nil {
+			WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if _, id, ok := core.SessionFromContext(r.Context()); ok && req.PluginId != core.OrcidPluginId {
+		// the token stays on the server: the requests of the plugin without a token use the token of the session
+		_, err = core.UpdateSession(r.Context(), id, func(session *core.Session) {
+			if session.Tokens == nil {
+				session.Tokens = map[string]string{}
+			}
+			session.Tokens[req.PluginId] = sessionId
+		})
+		if err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		res.SessionId = ""
+	}
 
-	b, err = json.Marshal(res)
+	b, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
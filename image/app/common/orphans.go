@@ -0,0 +1,40 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"integration/app/core"
+	"net/http"
+	"time"
+)
+
+type OrphansRequest struct {
+	DataverseKey string `json:"dataverseKey"`
+	PersistentId string `json:"persistentId,omitempty"` // dataset to scan, the datasets with the files of failed jobs when empty
+	OlderThan    int    `json:"olderThan,omitempty"`    // minimum age in days of the reported files, 7 by default
+	Remove       bool   `json:"remove,omitempty"`       // remove the reported files
+}
+
+type OrphansResponse struct {
+	Orphans []core.Orphan `json:"orphans"`
+}
+
+// Orphans reports (and optionally removes) the files in the storage that are not registered in Dataverse, e.g., written by a job
+// that crashed before registering them; meant to be called periodically, e.g., by a cron job
+func Orphans(w http.ResponseWriter, r *http.Request) {
+	req := OrphansRequest{}
+	if !DecodeRequest(w, r, &req) || !requireSuperuser(w, r, req.DataverseKey) {
+		return
+	}
+	olderThan := core.DefaultOrphanAge
+	if req.OlderThan > 0 {
+		olderThan = time.Duration(req.OlderThan) * 24 * time.Hour
+	}
+	user := core.GetUserFromHeader(r.Header)
+	orphans, err := core.FindOrphans(r.Context(), req.DataverseKey, user, req.PersistentId, olderThan, req.Remove)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, r, OrphansResponse{Orphans: orphans})
+}
@@ -0,0 +1,77 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+)
+
+type ReportRequest struct {
+	PersistentId string `json:"persistentId"`
+	DataverseKey string `json:"dataverseKey"`
+}
+
+type ReportResponse struct {
+	Found  bool           `json:"found"`
+	Report core.JobReport `json:"report"`
+}
+
+type ArchivedJobsResponse struct {
+	Jobs []core.ArchivedJob `json:"jobs"`
+}
+
+// returns the report of the last finished job for the dataset
+func Report(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := ReportRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	err := core.Destination.CheckPermission(r.Context(), req.DataverseKey, user, req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	report, found := core.GetJobReport(r.Context(), req.PersistentId)
+	b, err := json.Marshal(ReportResponse{Found: found, Report: report})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// returns the jobs exported to the long-term archive for the dataset
+func ArchivedJobs(w http.ResponseWriter, r *http.Request) {
+	req := ReportRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	user := core.GetUserFromHeader(r.Header)
+	err := core.Destination.CheckPermission(r.Context(), req.DataverseKey, user, req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	jobs, err := core.GetArchivedJobs(r.Context(), req.PersistentId)
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	b, err := json.Marshal(ArchivedJobsResponse{Jobs: jobs})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
@@ -0,0 +1,83 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/core"
+	"io"
+	"net/http"
+)
+
+// default maximum size of a request body, the compare and store requests of large repositories contain all their files
+const defaultMaxRequestSize = 32 << 20
+
+// RequestError is a rejected request body: too large (413) or not a valid request (400)
+type RequestError struct {
+	Status  int
+	Message string
+}
+
+func (e *RequestError) Error() string {
+	return "invalid request: " + e.Message
+}
+
+// DecodeRequest decodes the JSON body of the request into v, writes the 400 (or 413) response and returns false when the body is
+// not valid: malformed JSON, unknown fields (unless allowUnknownRequestFields is set), wrong types or too large; the missing
+// credentials are taken from the session of the request (see fillFromSession) and the dataset and the plugin of the request
+// are checked against the scope of the API key (see checkRequestScope), the 403 response is written when not allowed
+func DecodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := decodeRequest(w, r, v)
+	if err != nil {
+		WriteError(w, r, err.Status, err)
+		return false
+	}
+	if session, _, ok := core.SessionFromContext(r.Context()); ok {
+		fillFromSession(v, session)
+	}
+	if err := checkRequestScope(r, v); err != nil {
+		WriteError(w, r, http.StatusForbidden, err)
+		return false
+	}
+	return true
+}
+
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}) *RequestError {
+	maxSize := config.GetConfig().Options.MaxRequestSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxRequestSize
+	}
+	body := http.MaxBytesReader(w, r.Body, maxSize)
+	defer body.Close()
+	decoder := json.NewDecoder(body)
+	if !config.GetConfig().Options.AllowUnknownRequestFields {
+		decoder.DisallowUnknownFields()
+	}
+	err := decoder.Decode(v)
+	if err == nil && decoder.More() {
+		err = errors.New("unexpected data after the JSON object")
+	}
+	if err == nil {
+		return nil
+	}
+	var maxBytesError *http.MaxBytesError
+	var syntaxError *json.SyntaxError
+	var typeError *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &maxBytesError):
+		return &RequestError{http.StatusRequestEntityTooLarge, fmt.Sprintf("the request body is larger than %d bytes", maxBytesError.Limit)}
+	case errors.Is(err, io.EOF):
+		return &RequestError{http.StatusBadRequest, "empty request body"}
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return &RequestError{http.StatusBadRequest, "incomplete JSON"}
+	case errors.As(err, &syntaxError):
+		return &RequestError{http.StatusBadRequest, fmt.Sprintf("malformed JSON at offset %d", syntaxError.Offset)}
+	case errors.As(err, &typeError):
+		return &RequestError{http.StatusBadRequest, fmt.Sprintf("field %q must be of type %v", typeError.Field, typeError.Type)}
+	}
+	// e.g., json: unknown field "x"
+	return &RequestError{http.StatusBadRequest, err.Error()}
+}
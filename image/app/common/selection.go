@@ -0,0 +1,201 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/tree"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the compared nodes are kept while the user selects the nodes to store
+var selectionCacheDuration = 24 * time.Hour
+
+// SelectionRequest changes the persisted selection of the compare response with the key, the store call then only references the key
+type SelectionRequest struct {
+	Key     string         `json:"key"`
+	Actions map[string]int `json:"actions,omitempty"` // node id -> action: 0 (ignore), 1 (copy), 2 (update) or 3 (delete)
+	Reset   bool           `json:"reset,omitempty"`   // all nodes are ignored before the actions are applied
+}
+
+type SelectionResponse struct {
+	Key      string         `json:"key"`
+	Selected map[string]int `json:"selected"` // node id -> action of the nodes that are not ignored
+}
+
+// selection holds the compared nodes with the selected actions
+type selection struct {
+	User         string               `json:"user"`
+	PersistentId string               `json:"persistentId"`
+	Nodes        map[string]tree.Node `json:"nodes"`
+}
+
+func selectionKey(key string) string {
+	return "selection: " + key
+}
+
+// KeepSelection keeps the nodes of the compare response with the key (with the actions set by the compare, if any), so that the
+// user can persist the selection and store it by the key
+func KeepSelection(key, user string, res core.CompareResponse) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	s := selection{User: user, PersistentId: res.Id, Nodes: map[string]tree.Node{}}
+	for _, v := range res.Data {
+		s.Nodes[v.Id] = v
+	}
+	saveSelection(ctx, key, s)
+}
+
+func saveSelection(ctx context.Context, key string, s selection) error {
+	encoded, err := core.EncodeCached(s)
+	if err != nil {
+		return err
+	}
+	return config.GetRedis().Set(ctx, selectionKey(key), encoded, selectionCacheDuration)
+}
+
+// loadSelection returns the selection of the key, only to the user that started the comparison
+func loadSelection(ctx context.Context, key, user string) (selection, int, error) {
+	s := selection{}
+	cached, _ := config.GetRedis().Get(ctx, selectionKey(key))
+	if cached == "" {
+		return s, http.StatusNotFound, fmt.Errorf("no compared nodes for key %v, compare again", key)
+	}
+	if err := core.DecodeCached(cached, &s); err != nil {
+		return s, http.StatusInternalServerError, err
+	}
+	if s.User != user {
+		return s, http.StatusForbidden, fmt.Errorf("the selection of key %v belongs to another user", key)
+	}
+	return s, http.StatusOK, nil
+}
+
+// apply sets the actions of the nodes, the nodes must be compared nodes
+func (s selection) apply(actions map[string]int) error {
+	for id, action := range actions {
+		node, ok := s.Nodes[id]
+		if !ok {
+			return fmt.Errorf("unknown node %v", id)
+		}
+		if action < tree.Ignore || action > tree.Delete {
+			return fmt.Errorf("unknown action %v for node %v", action, id)
+		}
+		node.Action = action
+		s.Nodes[id] = node
+	}
+	return nil
+}
+
+// the folder actions of the store requests
+const (
+	FolderCopy   = "copy"   // the new files are copied and the updated (or unknown) files updated, the other files are ignored
+	FolderDelete = "delete" // the files in the dataset are deleted, the new files are ignored
+	FolderIgnore = "ignore"
+)
+
+// applyFolders sets the actions of the files of the folders (including their subfolders, "" is the root folder): the parent
+// folders first, so that the action of a subfolder replaces the action of its parent
+func (s selection) applyFolders(actions map[string]string) error {
+	folders := []string{}
+	for folder, action := range actions {
+		if action != FolderCopy && action != FolderDelete && action != FolderIgnore {
+			return fmt.Errorf("unknown action %q for folder %v: use %q, %q or %q", action, folder, FolderCopy, FolderDelete, FolderIgnore)
+		}
+		folders = append(folders, folder)
+	}
+	depth := func(folder string) int {
+		if folder = strings.Trim(folder, "/"); folder == "" {
+			return 0
+		}
+		return strings.Count(folder, "/") + 1
+	}
+	sort.Slice(folders, func(i, j int) bool {
+		if depth(folders[i]) != depth(folders[j]) {
+			return depth(folders[i]) < depth(folders[j])
+		}
+		return folders[i] < folders[j]
+	})
+	for _, folder := range folders {
+		prefix := strings.Trim(folder, "/")
+		found := false
+		for id, node := range s.Nodes {
+			if prefix != "" && node.Path != prefix && !strings.HasPrefix(node.Path, prefix+"/") {
+				continue
+			}
+			found = true
+			node.Action = folderAction(actions[folder], node)
+			s.Nodes[id] = node
+		}
+		if !found {
+			return fmt.Errorf("unknown folder %v", folder)
+		}
+	}
+	return nil
+}
+
+func folderAction(action string, node tree.Node) int {
+	switch {
+	case action == FolderCopy && node.Status == tree.New:
+		return tree.Copy
+	case action == FolderCopy && (node.Status == tree.Updated || node.Status == tree.Unknown):
+		return tree.Update
+	case action == FolderDelete && node.Status != tree.New:
+		return tree.Delete
+	}
+	return tree.Ignore
+}
+
+func (s selection) selected() map[string]tree.Node {
+	res := map[string]tree.Node{}
+	for id, v := range s.Nodes {
+		if v.Action != tree.Ignore {
+			res[id] = v
+		}
+	}
+	return res
+}
+
+// Selection applies the actions to the persisted selection and returns the selected nodes, without actions it only returns them
+func Selection(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := SelectionRequest{}
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+	s, status, err := loadSelection(r.Context(), req.Key, core.GetUserFromHeader(r.Header))
+	if err != nil {
+		WriteError(w, r, status, err)
+		return
+	}
+	if req.Reset {
+		for id, v := range s.Nodes {
+			v.Action = tree.Ignore
+			s.Nodes[id] = v
+		}
+	}
+	if err = s.apply(req.Actions); err != nil {
+		WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	if req.Reset || len(req.Actions) > 0 {
+		if err = saveSelection(r.Context(), req.Key, s); err != nil {
+			WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	res := SelectionResponse{Key: req.Key, Selected: map[string]int{}}
+	for id, v := range s.selected() {
+		res.Selected[id] = v.Action
+	}
+	writeJson(w, r, res)
+}
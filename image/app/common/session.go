@@ -0,0 +1,145 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type SessionRequest struct {
+	DataverseKey string            `json:"dataverseKey,omitempty"` // kept in the session and used for the requests without a dataverseKey
+	Tokens       map[string]string `json:"tokens,omitempty"`       // by plugin id: kept in the session and used for the requests of the plugin without a token, an empty token removes it
+}
+
+// SessionResponse describes the session without its secrets
+type SessionResponse struct {
+	User         string    `json:"user"`
+	Expires      time.Time `json:"expires"`
+	DataverseKey bool      `json:"dataverseKey"` // true when the session has a Dataverse API key
+	Plugins      []string  `json:"plugins"`      // the plugins with a token in the session
+}
+
+// Session starts the server side session (or updates the session of the cookie) with the credentials of the user: after this
+// call, the browser sends only the session cookie, the requests without the Dataverse API key or the token of a plugin use the
+// credentials of the session
+func Session(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := SessionRequest{}
+	// not DecodeRequest: the credentials of the request are not completed from the session
+	if err := decodeRequest(w, r, &req); err != nil {
+		WriteError(w, r, err.Status, err)
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	if req.DataverseKey != "" {
+		// only valid keys are stored
+		if _, err := core.Destination.GetUserEmail(r.Context(), req.DataverseKey, user); err != nil {
+			WriteError(w, r, http.StatusUnauthorized, fmt.Errorf("the Dataverse API key is not valid: %w", err))
+			return
+		}
+	}
+	update := func(session *core.Session) {
+		if req.DataverseKey != "" {
+			session.DataverseKey = req.DataverseKey
+		}
+		for pluginId, token := range req.Tokens {
+			if session.Tokens == nil {
+				session.Tokens = map[string]string{}
+			}
+			if token == "" {
+				delete(session.Tokens, pluginId)
+			} else {
+				session.Tokens[pluginId] = token
+			}
+		}
+	}
+	var session core.Session
+	var err error
+	if _, sessionId, ok := core.SessionFromContext(r.Context()); ok {
+		session, err = core.UpdateSession(r.Context(), sessionId, update)
+	} else {
+		identity, ok := core.IdentityFromContext(r.Context())
+		if !ok {
+			identity = core.Identity{User: user, Method: "session"}
+		}
+		session = core.Session{Identity: identity}
+		update(&session)
+		var sessionId string
+		sessionId, err = core.NewSession(r.Context(), session)
+		if err == nil {
+			session, _ = core.GetSession(r.Context(), sessionId)
+			http.SetCookie(w, sessionCookie(r, sessionId, 0))
+		}
+	}
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	writeJson(w, r, sessionResponse(session))
+}
+
+func sessionResponse(session core.Session) SessionResponse {
+	res := SessionResponse{User: session.User, Expires: session.Expires, DataverseKey: session.DataverseKey != "", Plugins: []string{}}
+	for pluginId := range session.Tokens {
+		res.Plugins = append(res.Plugins, pluginId)
+	}
+	sort.Strings(res.Plugins)
+	return res
+}
+
+// fillFromSession sets the empty "dataverseKey" fields, and the empty "token" fields next to a "pluginId" field, of the decoded
+// request to the credentials of the session
+func fillFromSession(v interface{}, session core.Session) {
+	fillValue(reflect.ValueOf(v), session)
+}
+
+func fillValue(v reflect.Value, session core.Session) {
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !v.IsNil() {
+			fillValue(v.Elem(), session)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			fillValue(v.Index(i), session)
+		}
+	case reflect.Struct:
+		fillStruct(v, session)
+	}
+}
+
+func fillStruct(v reflect.Value, session core.Session) {
+	pluginId := ""
+	var token reflect.Value
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		switch {
+		case value.Kind() != reflect.String:
+			fillValue(value, session)
+		case name == "dataverseKey" && value.String() == "" && value.CanSet():
+			value.SetString(session.DataverseKey)
+		case name == "pluginId":
+			pluginId = value.String()
+		case name == "token" && value.String() == "" && value.CanSet():
+			token = value
+		}
+	}
+	if token.IsValid() && pluginId != "" {
+		token.SetString(session.Tokens[pluginId])
+	}
+}
@@ -4,12 +4,12 @@ package common
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"integration/app/config"
 	"integration/app/core"
 	"integration/app/plugin/types"
 	"integration/app/tree"
-	"io"
 	"net/http"
 )
 
@@ -24,40 +24,70 @@ type StoreRequest struct {
 	PersistentId      string             `json:"persistentId"`
 	DataverseKey      string             `json:"dataverseKey"`
 	SelectedNodes     []tree.Node        `json:"selectedNodes"`
+	SelectionKey      string             `json:"selectionKey,omitempty"`  // key of the compare response: the persisted selection (see /api/common/selection) is stored instead of the selected nodes
+	Overrides         map[string]int     `json:"overrides,omitempty"`     // node id -> action applied to the persisted selection of the selection key
+	FolderActions     map[string]string  `json:"folderActions,omitempty"` // folder path -> "copy", "delete" or "ignore", expanded to the files of the folder in the persisted selection before the overrides
+	Version           string             `json:"version,omitempty"`       // dataset version the selected nodes were compared with, ":latest" when empty
 	SendEmailOnSucces bool               `json:"sendEmailOnSucces"`
+	Publish           string             `json:"publish,omitempty"`          // "major" or "minor" for publishing the dataset after the sync
+	StorageDriver     string             `json:"storageDriver,omitempty"`    // storage driver id of the dataset, queried from Dataverse when not set
+	Bundles           []string           `json:"bundles,omitempty"`          // folders written as a single archive file, e.g., "data/raw" as "data/raw.zip"
+	BundleFormat      string             `json:"bundleFormat,omitempty"`     // "zip" (default) or "tar"
+	UnpackArchives    bool               `json:"unpackArchives,omitempty"`   // the selected archives (.zip, .tar.gz, .tgz and .tar) are written as the files they contain
+	ContinueOnError   bool               `json:"continueOnError,omitempty"`  // a failed file does not stop the job, only the failed files are retried
+	SkipCleanStorage  bool               `json:"skipCleanStorage,omitempty"` // the cleanStorage API is not called after the job, also when enabled in the configuration
 }
 
 func Store(w http.ResponseWriter, r *http.Request) {
 	if !config.RedisReady(r.Context()) {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - cache not ready"))
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
 		return
 	}
 	req := StoreRequest{}
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !DecodeRequest(w, r, &req) {
+		return
+	}
+
+	if !core.ValidVersion(req.Version) {
+		WriteError(w, r, http.StatusBadRequest, fmt.Errorf("unsupported dataset version: %v", req.Version))
 		return
 	}
-	err = json.Unmarshal(b, &req)
+	if req.Publish != "" && req.Publish != "major" && req.Publish != "minor" {
+		WriteError(w, r, http.StatusBadRequest, fmt.Errorf("unsupported publish version type: %v", req.Publish))
+		return
+	}
+
+	err := core.CheckScope(r.Context(), []string{req.Plugin, req.StreamParams.PluginId}, req.PersistentId)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+		WriteError(w, r, http.StatusForbidden, err)
 		return
 	}
 
+	user := core.GetUserFromHeader(r.Header)
 	selected := map[string]tree.Node{}
 	for _, v := range req.SelectedNodes {
 		selected[v.Id] = v
 	}
-
-	user := core.GetUserFromHeader(r.Header)
+	if req.SelectionKey == "" && len(req.FolderActions) > 0 {
+		WriteError(w, r, http.StatusBadRequest, fmt.Errorf("folderActions need a selectionKey: the folders are expanded to the compared files"))
+		return
+	}
+	if req.SelectionKey != "" {
+		status, err := persistedSelection(r, req, user, selected)
+		if err != nil {
+			WriteError(w, r, status, err)
+			return
+		}
+	}
+	selected, bundles, err := core.BundleNodes(selected, req.Bundles, req.BundleFormat)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
 	if req.StreamParams.User == "" {
 		req.StreamParams.User = user
 	}
-	err = core.AddJob(r.Context(), core.Job{
+	job := core.Job{
 		DataverseKey:      req.DataverseKey,
 		User:              user,
 		SessionId:         req.StreamParams.Token,
@@ -65,22 +95,64 @@ func Store(w http.ResponseWriter, r *http.Request) {
 		WritableNodes:     selected,
 		Plugin:            req.Plugin,
 		StreamParams:      req.StreamParams,
+		Version:           req.Version,
 		SendEmailOnSucces: req.SendEmailOnSucces,
-	})
+		Publish:           req.Publish,
+		StorageDriver:     req.StorageDriver,
+		Bundles:           bundles,
+		UnpackArchives:    req.UnpackArchives,
+		ContinueOnError:   req.ContinueOnError,
+		SkipCleanStorage:  req.SkipCleanStorage,
+	}
+	err = core.CheckJobLimits(req.Plugin, req.StreamParams.PluginId, req.PersistentId, selected, bundles)
+	if err == nil {
+		err = core.CheckStorageLimits(r.Context(), job)
+	}
+	if err != nil {
+		WriteError(w, r, http.StatusRequestEntityTooLarge, err)
+		return
+	}
+	err = core.AddJob(r.Context(), job)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
+	if req.SelectionKey != "" {
+		config.GetRedis().Del(r.Context(), selectionKey(req.SelectionKey))
+	}
 	res := StoreResult{
 		Status:    "OK",
-		DatsetUrl: core.Destination.GetRepoUrl(req.PersistentId, true),
+		DatsetUrl: core.Destination.GetRepoUrl(r.Context(), req.PersistentId, true),
 	}
-	b, err = json.Marshal(res)
+	b, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
 }
+
+// persistedSelection adds the nodes of the persisted selection, with the overrides, to the selected nodes: the stored nodes are then
+// exactly the compared nodes
+func persistedSelection(r *http.Request, req StoreRequest, user string, selected map[string]tree.Node) (int, error) {
+	if len(req.SelectedNodes) > 0 {
+		return http.StatusBadRequest, fmt.Errorf("selectedNodes can not be combined with a selectionKey, use the overrides")
+	}
+	s, status, err := loadSelection(r.Context(), req.SelectionKey, user)
+	if err != nil {
+		return status, err
+	}
+	if s.PersistentId != req.PersistentId {
+		return http.StatusBadRequest, fmt.Errorf("the selection of key %v is for dataset %v", req.SelectionKey, s.PersistentId)
+	}
+	if err = s.applyFolders(req.FolderActions); err != nil {
+		return http.StatusBadRequest, err
+	}
+	if err = s.apply(req.Overrides); err != nil {
+		return http.StatusBadRequest, err
+	}
+	for id, v := range s.selected() {
+		selected[id] = v
+	}
+	return http.StatusOK, nil
+}
@@ -0,0 +1,64 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"integration/app/config"
+	"integration/app/core"
+	"net/http"
+)
+
+type RevokeRequest struct {
+	Keys []string `json:"keys"` // everything stored for the user is revoked when empty
+}
+
+type UserDataResponse struct {
+	User    string               `json:"user"`
+	Entries []core.UserDataEntry `json:"entries"`
+}
+
+// UserData lists everything the service currently stores for the user (cached OAuth tokens, failed jobs, etc.)
+func UserData(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	if user == "" {
+		WriteError(w, r, http.StatusBadRequest, errors.New("user is not known"))
+		return
+	}
+	b, err := json.Marshal(UserDataResponse{User: user, Entries: core.ListUserData(r.Context(), user)})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// RevokeUserData deletes the requested (or all) data stored for the user
+func RevokeUserData(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := RevokeRequest{}
+	// all data is revoked when the request has no body
+	if r.ContentLength != 0 && !DecodeRequest(w, r, &req) {
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	revoked, err := core.RevokeUserData(r.Context(), user, req.Keys)
+	if err != nil {
+		WriteError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	b, err := json.Marshal(UserDataResponse{User: user, Entries: revoked})
+	if err != nil {
+		WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
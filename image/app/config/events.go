@@ -0,0 +1,83 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"context"
+	"fmt"
+)
+
+// buffered messages per subscriber, the messages are dropped for the subscribers that do not keep up
+const subscriberBuffer = 100
+
+// Publish sends the message to the subscribers of the channel: Redis pub/sub reaches the subscribers on all replicas,
+// the in-memory backend only the subscribers in this process
+func Publish(ctx context.Context, channel, message string) error {
+	switch c := rdb.(type) {
+	case *RedisBackend:
+		return c.client.Publish(ctx, channel, message).Err()
+	case *MemoryClient:
+		c.publish(channel, message)
+	}
+	return nil
+}
+
+// Subscribe returns the messages published on the channel until the returned function is called
+func Subscribe(ctx context.Context, channel string) (<-chan string, func(), error) {
+	switch c := rdb.(type) {
+	case *RedisBackend:
+		pubsub := c.client.Subscribe(ctx, channel)
+		// wait for the confirmation, so that no message published after Subscribe returns is missed
+		if _, err := pubsub.Receive(ctx); err != nil {
+			pubsub.Close()
+			return nil, nil, err
+		}
+		res := make(chan string, subscriberBuffer)
+		go func() {
+			defer close(res)
+			for msg := range pubsub.Channel() {
+				select {
+				case res <- msg.Payload:
+				default:
+				}
+			}
+		}()
+		return res, func() { pubsub.Close() }, nil
+	case *MemoryClient:
+		res, unsubscribe := c.subscribe(channel)
+		return res, unsubscribe, nil
+	}
+	return nil, nil, fmt.Errorf("the backend does not support subscriptions")
+}
+
+func (m *MemoryClient) publish(channel, message string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for sub := range m.subscribers[channel] {
+		select {
+		case sub <- message:
+		default:
+		}
+	}
+}
+
+func (m *MemoryClient) subscribe(channel string) (<-chan string, func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sub := make(chan string, subscriberBuffer)
+	if m.subscribers[channel] == nil {
+		m.subscribers[channel] = map[chan string]bool{}
+	}
+	m.subscribers[channel][sub] = true
+	return sub, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.subscribers[channel][sub] {
+			delete(m.subscribers[channel], sub)
+			if len(m.subscribers[channel]) == 0 {
+				delete(m.subscribers, channel)
+			}
+			close(sub)
+		}
+	}
+}
@@ -46,4 +46,5 @@ type Configuration struct {
 	StoreDvToken            bool         `json:"storeDvToken,omitempty"`
 	SendMails               bool         `json:"sendMails"`
 	Plugins                 []RepoPlugin `json:"plugins"`
+	Orcid                   *TokenGetter `json:"orcid,omitempty"` // login with ORCID identifying the user by the ORCID iD, the client secret is configured as for the plugins
 }
@@ -0,0 +1,215 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"integration/app/logging"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigVersion is the version of the configuration file format understood by this build
+const ConfigVersion = 1
+
+// EnvOverridePrefix starts the environment variables overriding the configuration file,
+// the path is separated by double underscores and matched case-insensitively, e.g., BACKEND__OPTIONS__MAXFILESIZE=1073741824
+const EnvOverridePrefix = "BACKEND__"
+
+var configMutex sync.RWMutex
+var reloadHooks []func(Config)
+var reloadMutex sync.Mutex
+
+// loadConfig reads the configuration file (JSON, or YAML when the file ends with .yaml or .yml) and applies the environment overrides
+func loadConfig(path string) (Config, error) {
+	res := Config{}
+	values := map[string]interface{}{}
+	if path != "" {
+		b, err := os.ReadFile(path)
+		if err != nil {
+			return res, err
+		}
+		values, err = parseConfigFile(path, b)
+		if err != nil {
+			return res, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	if err := applyEnvOverrides(values, os.Environ()); err != nil {
+		return res, err
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return res, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&res); err != nil {
+		// unknown fields are reported, but do not prevent the start (e.g., options of a newer or older release)
+		logging.Logger.Warn("configuration contains unknown or invalid fields", "file", path, "error", err)
+		res = Config{}
+		if err := json.Unmarshal(b, &res); err != nil {
+			return res, fmt.Errorf("%v: %v", path, err)
+		}
+	}
+	if res.Version > ConfigVersion {
+		return res, fmt.Errorf("%v: configuration version %v is not supported, this release supports version %v", path, res.Version, ConfigVersion)
+	}
+	return res, nil
+}
+
+func parseConfigFile(path string, b []byte) (map[string]interface{}, error) {
+	res := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &res); err != nil {
+			return nil, err
+		}
+	default:
+		if err := json.Unmarshal(b, &res); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// applyEnvOverrides sets the values of the BACKEND__ environment variables in the parsed configuration,
+// the values are parsed as JSON when possible (numbers, booleans, lists, objects) and used as strings otherwise
+func applyEnvOverrides(values map[string]interface{}, environ []string) error {
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(strings.ToUpper(name), EnvOverridePrefix) {
+			continue
+		}
+		path := strings.Split(name[len(EnvOverridePrefix):], "__")
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			parsed = value
+		}
+		if err := setPath(values, reflect.TypeOf(Config{}), path, parsed); err != nil {
+			return fmt.Errorf("environment variable %v: %v", name, err)
+		}
+		logging.Logger.Info("configuration overridden from environment", "variable", name)
+	}
+	return nil
+}
+
+func setPath(values map[string]interface{}, t reflect.Type, path []string, value interface{}) error {
+	key, fieldType, err := jsonKey(values, t, path[0])
+	if err != nil {
+		return err
+	}
+	if len(path) == 1 {
+		values[key] = value
+		return nil
+	}
+	child, ok := values[key].(map[string]interface{})
+	if !ok {
+		child = map[string]interface{}{}
+		values[key] = child
+	}
+	return setPath(child, fieldType, path[1:], value)
+}
+
+// jsonKey finds the JSON name of the field (or the existing map key) matching the name case-insensitively
+func jsonKey(values map[string]interface{}, t reflect.Type, name string) (string, reflect.Type, error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if tag == "" {
+				tag = f.Name
+			}
+			if strings.EqualFold(tag, name) {
+				return tag, f.Type, nil
+			}
+		}
+		return "", nil, fmt.Errorf("unknown configuration field %v", name)
+	case reflect.Map:
+		for k := range values {
+			if strings.EqualFold(k, name) {
+				return k, t.Elem(), nil
+			}
+		}
+		return name, t.Elem(), nil
+	}
+	return "", nil, fmt.Errorf("%v can not be set: the parent is not an object", name)
+}
+
+// OnReload registers a function called with the new configuration after each successful reload
+func OnReload(hook func(Config)) {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	reloadHooks = append(reloadHooks, hook)
+}
+
+// Reload re-reads the configuration file and applies the options that can change at runtime:
+// maxFileSize, jobLimits, maxDvObjectPages, knownHashesTTL, snapshotTTL, shutdownGracePeriod, workers, autoscaling, logLevel, rateLimits, prewarm and compare.
+// The other (structural) options, e.g., the servers and storage drivers, need a restart.
+func Reload() error {
+	reloadMutex.Lock()
+	defer reloadMutex.Unlock()
+	loaded, err := loadConfig(os.Getenv("BACKEND_CONFIG_FILE"))
+	if err != nil {
+		return err
+	}
+	if err := loaded.validateOptions(); err != nil {
+		return err
+	}
+	configMutex.Lock()
+	config.Options.MaxFileSize = loaded.Options.MaxFileSize
+	config.Options.MaxFileSizes = loaded.Options.MaxFileSizes
+	config.Options.JobLimits = loaded.Options.JobLimits
+	config.Options.MaxDvObjectPages = loaded.Options.MaxDvObjectPages
+	config.Options.KnownHashesTTL = loaded.Options.KnownHashesTTL
+	config.Options.SnapshotTTL = loaded.Options.SnapshotTTL
+	config.Options.ShutdownGracePeriod = loaded.Options.ShutdownGracePeriod
+	config.Options.Workers = loaded.Options.Workers
+	config.Options.Autoscaling = loaded.Options.Autoscaling
+	config.Options.LogLevel = loaded.Options.LogLevel
+	config.Options.RateLimits = loaded.Options.RateLimits
+	config.Options.Prewarm = loaded.Options.Prewarm
+	config.Options.Compare = loaded.Options.Compare
+	reloaded := config
+	configMutex.Unlock()
+	setLogLevel(reloaded.Options.LogLevel)
+	for _, hook := range reloadHooks {
+		hook(reloaded)
+	}
+	logging.Logger.Info("configuration reloaded")
+	return nil
+}
+
+// reloadOnSignal reloads the configuration on SIGHUP
+func reloadOnSignal() {
+	signalChannel := make(chan os.Signal, 1)
+	signal.Notify(signalChannel, syscall.SIGHUP)
+	go func() {
+		for range signalChannel {
+			if err := Reload(); err != nil {
+				logging.Logger.Error("configuration reload failed, keeping the current configuration", "error", err)
+			}
+		}
+	}()
+}
+
+func setLogLevel(level string) {
+	if level == "" {
+		return
+	}
+	if err := logging.SetLevel(level); err != nil {
+		logging.Logger.Warn("log level not changed", "error", err)
+	}
+}
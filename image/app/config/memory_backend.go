@@ -0,0 +1,311 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maximum number of queued values per queue of the in-memory backend
+const memoryQueueCapacity = 100000
+
+type memoryEntry struct {
+	value      string
+	expiration time.Time
+}
+
+func (e memoryEntry) expired() bool {
+	return !e.expiration.IsZero() && e.expiration.Before(time.Now())
+}
+
+// MemoryClient is the in-process backend: sync.Map cache and locks, channel based queues and pub/sub.
+// It can only be used when the workers run in the same process as the http server.
+type MemoryClient struct {
+	cache  sync.Map
+	mu     sync.Mutex
+	queues map[string]chan string
+	sets   map[string]map[string]bool
+	logs   map[string][]string
+
+	subscribers map[string]map[chan string]bool // pub/sub channel -> subscribers
+}
+
+func NewMemoryClient() *MemoryClient {
+	return &MemoryClient{
+		queues: map[string]chan string{},
+		sets:   map[string]map[string]bool{},
+		logs:   map[string][]string{},
+
+		subscribers: map[string]map[chan string]bool{},
+	}
+}
+
+func newMemoryEntry(value interface{}, expiration time.Duration) memoryEntry {
+	e := memoryEntry{value: fmt.Sprintf("%v", value)}
+	if expiration > 0 {
+		e.expiration = time.Now().Add(expiration)
+	}
+	return e
+}
+
+func (m *MemoryClient) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (m *MemoryClient) Get(ctx context.Context, key string) (string, error) {
+	v, ok := m.cache.Load(key)
+	if !ok {
+		return "", ErrNotFound
+	}
+	e := v.(memoryEntry)
+	if e.expired() {
+		m.cache.CompareAndDelete(key, e)
+		return "", ErrNotFound
+	}
+	return e.value, nil
+}
+
+func (m *MemoryClient) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	m.cache.Store(key, newMemoryEntry(value, expiration))
+	return nil
+}
+
+// set if Not eXists
+func (m *MemoryClient) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	e := newMemoryEntry(value, expiration)
+	for {
+		v, loaded := m.cache.LoadOrStore(key, e)
+		if !loaded {
+			return true, nil
+		}
+		if !v.(memoryEntry).expired() {
+			return false, nil
+		}
+		m.cache.CompareAndDelete(key, v)
+	}
+}
+
+func (m *MemoryClient) Del(ctx context.Context, keys ...string) (int64, error) {
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := m.cache.LoadAndDelete(key); ok {
+			deleted++
+		}
+	}
+	return int64(deleted), nil
+}
+
+// Expire sets a new expiration on an existing key, false is returned when the key does not exist
+func (m *MemoryClient) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	for {
+		v, ok := m.cache.Load(key)
+		if !ok || v.(memoryEntry).expired() {
+			return false, nil
+		}
+		if m.cache.CompareAndSwap(key, v, newMemoryEntry(v.(memoryEntry).value, expiration)) {
+			return true, nil
+		}
+	}
+}
+
+// IncrBy adds the increment to the integer value of the key, a missing key starts at 0 without expiration
+func (m *MemoryClient) IncrBy(ctx context.Context, key string, increment int64) (int64, error) {
+	for {
+		v, ok := m.cache.Load(key)
+		if !ok || v.(memoryEntry).expired() {
+			if ok {
+				m.cache.CompareAndDelete(key, v)
+			}
+			if _, loaded := m.cache.LoadOrStore(key, newMemoryEntry(increment, 0)); !loaded {
+				return increment, nil
+			}
+			continue
+		}
+		e := v.(memoryEntry)
+		n, err := strconv.ParseInt(e.value, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value of %v is not an integer", key)
+		}
+		if m.cache.CompareAndSwap(key, v, memoryEntry{strconv.FormatInt(n+increment, 10), e.expiration}) {
+			return n + increment, nil
+		}
+	}
+}
+
+func (m *MemoryClient) queue(key string) chan string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	q, ok := m.queues[key]
+	if !ok {
+		q = make(chan string, memoryQueueCapacity)
+		m.queues[key] = q
+	}
+	return q
+}
+
+func (m *MemoryClient) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	q := m.queue(key)
+	for _, v := range values {
+		select {
+		case q <- fmt.Sprintf("%v", v):
+		default:
+			return 0, fmt.Errorf("queue %v is full", key)
+		}
+	}
+	return int64(len(q)), nil
+}
+
+func (m *MemoryClient) RPop(ctx context.Context, key string) (string, error) {
+	select {
+	case v := <-m.queue(key):
+		return v, nil
+	default:
+		return "", ErrNotFound
+	}
+}
+
+func (m *MemoryClient) LLen(ctx context.Context, key string) (int64, error) {
+	return int64(len(m.queue(key))), nil
+}
+
+func (m *MemoryClient) RPopLPush(ctx context.Context, source, destination string) (string, error) {
+	// the queues are only shared by the goroutines of this process: the value is not lost when the process stops, as the queues
+	// are lost as well
+	v, err := m.RPop(ctx, source)
+	if err != nil {
+		return "", err
+	}
+	_, err = m.LPush(ctx, destination, v)
+	return v, err
+}
+
+func (m *MemoryClient) LRem(ctx context.Context, key string, value string) (int64, error) {
+	q := m.queue(key)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := int64(0)
+	for n := len(q); n > 0; n-- {
+		var v string
+		select {
+		case v = <-q:
+		default:
+			return removed, nil
+		}
+		if v == value && removed == 0 {
+			removed++
+			continue
+		}
+		q <- v
+	}
+	return removed, nil
+}
+
+// RenewLease extends the expiration of the key when it is held by the owner
+func (m *MemoryClient) RenewLease(ctx context.Context, key, owner string, expiration time.Duration) (bool, error) {
+	for {
+		v, ok := m.cache.Load(key)
+		if !ok || v.(memoryEntry).expired() || v.(memoryEntry).value != owner {
+			return false, nil
+		}
+		if m.cache.CompareAndSwap(key, v, newMemoryEntry(owner, expiration)) {
+			return true, nil
+		}
+	}
+}
+
+// ReleaseLease deletes the key when it is held by the owner
+func (m *MemoryClient) ReleaseLease(ctx context.Context, key, owner string) (bool, error) {
+	v, ok := m.cache.Load(key)
+	if !ok || v.(memoryEntry).expired() || v.(memoryEntry).value != owner {
+		return false, nil
+	}
+	return m.cache.CompareAndDelete(key, v), nil
+}
+
+func (m *MemoryClient) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, v := range values {
+		m.logs[key] = append(m.logs[key], fmt.Sprintf("%v", v))
+	}
+	return int64(len(m.logs[key])), nil
+}
+
+func (m *MemoryClient) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	values := m.logs[key]
+	n := int64(len(values))
+	if start < 0 {
+		start = max(n+start, 0)
+	}
+	if stop < 0 {
+		stop = n + stop
+	}
+	stop = min(stop, n-1)
+	if start > stop {
+		return []string{}, nil
+	}
+	return append([]string{}, values[start:stop+1]...), nil
+}
+
+func (m *MemoryClient) SAdd(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.sets[key] == nil {
+		m.sets[key] = map[string]bool{}
+	}
+	added := 0
+	for _, member := range members {
+		v := fmt.Sprintf("%v", member)
+		if !m.sets[key][v] {
+			m.sets[key][v] = true
+			added++
+		}
+	}
+	return int64(added), nil
+}
+
+func (m *MemoryClient) SRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	removed := 0
+	for _, member := range members {
+		v := fmt.Sprintf("%v", member)
+		if m.sets[key][v] {
+			delete(m.sets[key], v)
+			removed++
+		}
+	}
+	return int64(removed), nil
+}
+
+func (m *MemoryClient) SMembers(ctx context.Context, key string) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	res := []string{}
+	for v := range m.sets[key] {
+		res = append(res, v)
+	}
+	return res, nil
+}
+
+// CleanupExpired removes the expired entries that were not read since they expired
+func (m *MemoryClient) CleanupExpired() {
+	m.cache.Range(func(key, value any) bool {
+		if value.(memoryEntry).expired() {
+			m.cache.CompareAndDelete(key, value)
+		}
+		return true
+	})
+}
+
+func (m *MemoryClient) cleanupEvery(interval time.Duration) {
+	for range time.Tick(interval) {
+		m.CleanupExpired()
+	}
+}
@@ -0,0 +1,192 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	var m RedisClient = NewMemoryClient()
+	if _, err := m.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a missing key, got %v", err)
+	}
+	if err := m.Set(ctx, "key", 42, 0); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := m.Get(ctx, "key"); err != nil || v != "42" {
+		t.Fatalf("expected 42, got %q (%v)", v, err)
+	}
+	if ok, _ := m.Expire(ctx, "key", time.Millisecond); !ok {
+		t.Fatal("expire of an existing key returned false")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if _, err := m.Get(ctx, "key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected the key to be expired, got %v", err)
+	}
+	if ok, _ := m.Expire(ctx, "key", time.Minute); ok {
+		t.Fatal("expire of an expired key returned true")
+	}
+	m.Set(ctx, "a", "1", 0)
+	m.Set(ctx, "b", "2", 0)
+	if n, _ := m.Del(ctx, "a", "b", "c"); n != 2 {
+		t.Fatalf("expected 2 deleted keys, got %d", n)
+	}
+}
+
+func TestMemoryIncrBy(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryClient()
+	if n, err := m.IncrBy(ctx, "counter", 5); err != nil || n != 5 {
+		t.Fatalf("expected 5, got %d (%v)", n, err)
+	}
+	m.Expire(ctx, "counter", 20*time.Millisecond)
+	if n, _ := m.IncrBy(ctx, "counter", 3); n != 8 {
+		t.Fatalf("expected 8, got %d", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if n, _ := m.IncrBy(ctx, "counter", 1); n != 1 {
+		t.Fatalf("expected the counter to expire and start again, got %d", n)
+	}
+	m.Set(ctx, "text", "abc", 0)
+	if _, err := m.IncrBy(ctx, "text", 1); err == nil {
+		t.Fatal("expected an error for a value that is not an integer")
+	}
+}
+
+func TestMemorySetNX(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryClient()
+	if ok, _ := m.SetNX(ctx, "lock", "w1", time.Millisecond); !ok {
+		t.Fatal("first SetNX failed")
+	}
+	if ok, _ := m.SetNX(ctx, "lock", "w2", time.Minute); ok {
+		t.Fatal("second SetNX succeeded while the lock is held")
+	}
+	time.Sleep(5 * time.Millisecond)
+	if ok, _ := m.SetNX(ctx, "lock", "w2", time.Minute); !ok {
+		t.Fatal("SetNX failed after the lock expired")
+	}
+	if v, _ := m.Get(ctx, "lock"); v != "w2" {
+		t.Fatalf("expected w2 to hold the lock, got %q", v)
+	}
+}
+
+func TestMemoryQueue(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryClient()
+	if _, err := m.RPop(ctx, "q"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an empty queue, got %v", err)
+	}
+	m.LPush(ctx, "q", "first")
+	if n, _ := m.LPush(ctx, "q", "second"); n != 2 {
+		t.Fatalf("expected 2 queued values, got %d", n)
+	}
+	for _, expected := range []string{"first", "second"} {
+		if v, err := m.RPop(ctx, "q"); err != nil || v != expected {
+			t.Fatalf("expected %q, got %q (%v)", expected, v, err)
+		}
+	}
+	if n, _ := m.LLen(ctx, "q"); n != 0 {
+		t.Fatalf("expected an empty queue, got %d values", n)
+	}
+}
+
+func TestMemorySets(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryClient()
+	if n, _ := m.SAdd(ctx, "s", "a", "b", "a"); n != 2 {
+		t.Fatalf("expected 2 added members, got %d", n)
+	}
+	if n, _ := m.SRem(ctx, "s", "a", "c"); n != 1 {
+		t.Fatalf("expected 1 removed member, got %d", n)
+	}
+	members, err := m.SMembers(ctx, "s")
+	if err != nil || !slices.Equal(members, []string{"b"}) {
+		t.Fatalf("expected [b], got %v (%v)", members, err)
+	}
+}
+
+func TestMemoryPubSub(t *testing.T) {
+	m := NewMemoryClient()
+	messages, unsubscribe := m.subscribe("events")
+	m.publish("events", "hello")
+	m.publish("other", "ignored")
+	select {
+	case msg := <-messages:
+		if msg != "hello" {
+			t.Fatalf("expected hello, got %q", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("message not received")
+	}
+	unsubscribe()
+	if _, ok := <-messages; ok {
+		t.Fatal("channel not closed after unsubscribe")
+	}
+}
+
+func TestMemoryLeases(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryClient()
+	m.Set(ctx, "lease", "w1", time.Minute)
+	if ok, _ := m.RenewLease(ctx, "lease", "w2", time.Minute); ok {
+		t.Fatal("lease renewed by another owner")
+	}
+	if ok, _ := m.RenewLease(ctx, "lease", "w1", time.Minute); !ok {
+		t.Fatal("lease not renewed by its owner")
+	}
+	if ok, _ := m.ReleaseLease(ctx, "lease", "w2"); ok {
+		t.Fatal("lease released by another owner")
+	}
+	if ok, _ := m.ReleaseLease(ctx, "lease", "w1"); !ok {
+		t.Fatal("lease not released by its owner")
+	}
+	if ok, _ := m.RenewLease(ctx, "lease", "w1", time.Minute); ok {
+		t.Fatal("released lease renewed")
+	}
+}
+
+func TestMemoryProcessingQueue(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryClient()
+	m.LPush(ctx, "q", "a", "b")
+	if v, err := m.RPopLPush(ctx, "q", "processing"); err != nil || v != "a" {
+		t.Fatalf("expected a, got %q (%v)", v, err)
+	}
+	m.RPopLPush(ctx, "q", "processing")
+	if n, _ := m.LRem(ctx, "processing", "a"); n != 1 {
+		t.Fatalf("expected 1 removed value, got %d", n)
+	}
+	if v, _ := m.RPop(ctx, "processing"); v != "b" {
+		t.Fatalf("expected b to stay in the processing queue, got %q", v)
+	}
+	if _, err := m.RPopLPush(ctx, "q", "processing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for an empty queue, got %v", err)
+	}
+}
+
+func TestMemoryLogs(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemoryClient()
+	if values, _ := m.LRange(ctx, "log", 0, -1); len(values) != 0 {
+		t.Fatalf("expected an empty log, got %v", values)
+	}
+	m.RPush(ctx, "log", "a", "b")
+	if n, _ := m.RPush(ctx, "log", "c"); n != 3 {
+		t.Fatalf("expected 3 values, got %d", n)
+	}
+	for _, c := range []struct {
+		start, stop int64
+		expected    []string
+	}{{0, -1, []string{"a", "b", "c"}}, {1, 1, []string{"b"}}, {-2, 10, []string{"b", "c"}}, {2, 1, []string{}}} {
+		if values, _ := m.LRange(ctx, "log", c.start, c.stop); !slices.Equal(values, c.expected) {
+			t.Errorf("LRange(%d, %d): expected %v, got %v", c.start, c.stop, c.expected, values)
+		}
+	}
+}
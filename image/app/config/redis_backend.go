@@ -0,0 +1,101 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"context"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// the leases are compared with their owner and changed in one step, so that an owner that lost its lease does not take it back
+var renewLeaseScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("PEXPIRE", KEYS[1], ARGV[2]) end return 0`)
+var releaseLeaseScript = redis.NewScript(`if redis.call("GET", KEYS[1]) == ARGV[1] then return redis.call("DEL", KEYS[1]) end return 0`)
+
+// RedisBackend is the backend shared by all instances, the commands of the go-redis client with their results as plain values
+type RedisBackend struct {
+	client *redis.Client
+}
+
+func NewRedisBackend(client *redis.Client) *RedisBackend {
+	return &RedisBackend{client}
+}
+
+func (r *RedisBackend) Ping(ctx context.Context) error {
+	return r.client.Ping(ctx).Err()
+}
+
+func (r *RedisBackend) Get(ctx context.Context, key string) (string, error) {
+	return r.client.Get(ctx, key).Result()
+}
+
+func (r *RedisBackend) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) error {
+	return r.client.Set(ctx, key, value, expiration).Err()
+}
+
+func (r *RedisBackend) Del(ctx context.Context, keys ...string) (int64, error) {
+	return r.client.Del(ctx, keys...).Result()
+}
+
+func (r *RedisBackend) Expire(ctx context.Context, key string, expiration time.Duration) (bool, error) {
+	return r.client.Expire(ctx, key, expiration).Result()
+}
+
+func (r *RedisBackend) IncrBy(ctx context.Context, key string, increment int64) (int64, error) {
+	return r.client.IncrBy(ctx, key, increment).Result()
+}
+
+func (r *RedisBackend) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) (bool, error) {
+	return r.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (r *RedisBackend) LPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return r.client.LPush(ctx, key, values...).Result()
+}
+
+func (r *RedisBackend) RPop(ctx context.Context, key string) (string, error) {
+	return r.client.RPop(ctx, key).Result()
+}
+
+func (r *RedisBackend) LLen(ctx context.Context, key string) (int64, error) {
+	return r.client.LLen(ctx, key).Result()
+}
+
+func (r *RedisBackend) RPopLPush(ctx context.Context, source, destination string) (string, error) {
+	return r.client.RPopLPush(ctx, source, destination).Result()
+}
+
+func (r *RedisBackend) LRem(ctx context.Context, key string, value string) (int64, error) {
+	return r.client.LRem(ctx, key, 1, value).Result()
+}
+
+func (r *RedisBackend) RPush(ctx context.Context, key string, values ...interface{}) (int64, error) {
+	return r.client.RPush(ctx, key, values...).Result()
+}
+
+func (r *RedisBackend) LRange(ctx context.Context, key string, start, stop int64) ([]string, error) {
+	return r.client.LRange(ctx, key, start, stop).Result()
+}
+
+func (r *RedisBackend) SAdd(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return r.client.SAdd(ctx, key, members...).Result()
+}
+
+func (r *RedisBackend) SRem(ctx context.Context, key string, members ...interface{}) (int64, error) {
+	return r.client.SRem(ctx, key, members...).Result()
+}
+
+func (r *RedisBackend) SMembers(ctx context.Context, key string) ([]string, error) {
+	return r.client.SMembers(ctx, key).Result()
+}
+
+func (r *RedisBackend) RenewLease(ctx context.Context, key, owner string, expiration time.Duration) (bool, error) {
+	n, err := renewLeaseScript.Run(ctx, r.client, []string{key}, owner, expiration.Milliseconds()).Int()
+	return n == 1, err
+}
+
+func (r *RedisBackend) ReleaseLease(ctx context.Context, key, owner string) (bool, error) {
+	n, err := releaseLeaseScript.Run(ctx, r.client, []string{key}, owner).Int()
+	return n == 1, err
+}
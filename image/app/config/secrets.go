@@ -0,0 +1,385 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/logging"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	awscfg "github.com/aws/aws-sdk-go-v2/config"
+)
+
+// names of the secrets, as used for the files in the secrets directory and the keys in Vault or AWS Secrets Manager
+const (
+	SecretApiKey             = "apiKey"
+	SecretUnblockKey         = "unblockKey"
+	SecretRedisPassword      = "redisPassword"
+	SecretSmtpPassword       = "smtpPassword"
+	SecretOauthSecrets       = "oauthSecrets" // JSON object: client id -> OauthSecret
+	SecretAwsAccessKeyId     = "awsAccessKeyId"
+	SecretAwsSecretAccessKey = "awsSecretAccessKey"
+	SecretTokenEncryptionKey = "tokenEncryptionKey" // encryption of the tokens and API keys stored in Redis, comma separated for rotation
+	SecretOidcClientSecret   = "oidcClientSecret"
+)
+
+var ErrSecretNotFound = errors.New("secret not found")
+
+const secretsCtxDuration = 30 * time.Second
+
+// SecretsProvider fetches the secrets at runtime, ErrSecretNotFound is returned for the unknown secrets
+type SecretsProvider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+var secretsProvider SecretsProvider
+var fallbackSecrets SecretsProvider // the secrets not found by the remote provider are read from the files
+var remoteSecrets = false
+var secrets = map[string]string{}
+var secretsMutex sync.Mutex
+
+// the requests to Vault and AWS Secrets Manager share the connections
+var secretsClient = &http.Client{Transport: NewTLSTransport(&http.Transport{Proxy: http.ProxyFromEnvironment}), Timeout: secretsCtxDuration}
+
+// cachingSecretsProvider is a provider reading all secrets at once, invalidate makes it fetch them again
+type cachingSecretsProvider interface {
+	invalidate()
+}
+
+func initSecrets() {
+	c := config.Options.Secrets
+	// the pathTo* options remain supported, next to the files in the secrets directory
+	paths := map[string]string{
+		SecretApiKey:             config.Options.PathToApiKey,
+		SecretUnblockKey:         config.Options.PathToUnblockKey,
+		SecretRedisPassword:      config.Options.PathToRedisPassword,
+		SecretSmtpPassword:       config.Options.PathToSmtpPassword,
+		SecretOauthSecrets:       config.Options.PathToOauthSecrets,
+		SecretTokenEncryptionKey: config.Options.PathToTokenEncryptionKey,
+		SecretOidcClientSecret:   config.Options.Oidc.PathToClientSecret,
+	}
+	for name, t := range config.Options.DataverseTargets {
+		paths[TargetSecretName(SecretApiKey, name)] = t.PathToApiKey
+		paths[TargetSecretName(SecretUnblockKey, name)] = t.PathToUnblockKey
+	}
+	fallbackSecrets = fileSecrets{dir: c.Dir, paths: paths}
+	switch c.Provider {
+	case "vault":
+		logging.Logger.Info("secrets are read from Vault", "address", c.Vault.Address, "path", c.Vault.Path)
+		secretsProvider = &vaultSecrets{conf: c.Vault}
+		remoteSecrets = true
+	case "aws":
+		logging.Logger.Info("secrets are read from AWS Secrets Manager", "secretId", c.Aws.SecretId)
+		secretsProvider = &awsSecrets{conf: c.Aws}
+		remoteSecrets = true
+	default:
+		secretsProvider = fallbackSecrets
+	}
+	if c.RefreshInterval > 0 {
+		go refreshSecretsEvery(time.Duration(c.RefreshInterval) * time.Second)
+	}
+}
+
+// Secret returns the (cached) value of the secret, empty when the secret is not configured. The secrets are fetched when the
+// configuration is loaded, which fails when a secret can not be fetched: a secret that can not be fetched later on (e.g., the secret
+// of a target that is only read when used) is empty, use LookupSecret where an empty secret must not be used instead (e.g., the
+// encryption key)
+func Secret(name string) string {
+	v, _ := LookupSecret(name)
+	return v
+}
+
+// LookupSecret returns the (cached) value of the secret, empty when the secret is not configured and the error when it could not be fetched
+func LookupSecret(name string) (string, error) {
+	secretsMutex.Lock()
+	v, ok := secrets[name]
+	secretsMutex.Unlock()
+	if ok {
+		return v, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretsCtxDuration)
+	defer cancel()
+	return fetchSecret(ctx, name)
+}
+
+// SetSecret replaces the cached value of the secret, e.g., in the tests
+func SetSecret(name, value string) {
+	secretsMutex.Lock()
+	defer secretsMutex.Unlock()
+	secrets[name] = value
+}
+
+// RefreshSecret fetches the secret again (e.g., after an authentication failure), true is returned when the value has changed,
+// the cached value is kept when the secret can not be fetched
+func RefreshSecret(ctx context.Context, name string) bool {
+	invalidateSecrets()
+	return refreshSecret(ctx, name)
+}
+
+func invalidateSecrets() {
+	if p, ok := secretsProvider.(cachingSecretsProvider); ok {
+		p.invalidate()
+	}
+}
+
+func refreshSecret(ctx context.Context, name string) bool {
+	secretsMutex.Lock()
+	old, ok := secrets[name]
+	secretsMutex.Unlock()
+	v, err := fetchSecret(ctx, name)
+	if err != nil {
+		return false
+	}
+	changed := ok && v != old
+	if changed {
+		logging.Logger.InfoContext(ctx, "secret rotated", "secret", name)
+	}
+	return changed
+}
+
+func fetchSecret(ctx context.Context, name string) (string, error) {
+	v, err := secretsProvider.GetSecret(ctx, name)
+	if errors.Is(err, ErrSecretNotFound) && remoteSecrets {
+		v, err = fallbackSecrets.GetSecret(ctx, name)
+	}
+	if errors.Is(err, ErrSecretNotFound) {
+		v, err = "", nil
+	}
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "fetching secret failed", "secret", name, "error", err)
+		return "", err
+	}
+	secretsMutex.Lock()
+	secrets[name] = v
+	secretsMutex.Unlock()
+	return v, nil
+}
+
+func refreshSecretsEvery(interval time.Duration) {
+	for {
+		time.Sleep(interval)
+		secretsMutex.Lock()
+		names := []string{}
+		for name := range secrets {
+			names = append(names, name)
+		}
+		secretsMutex.Unlock()
+		ctx, cancel := context.WithTimeout(context.Background(), secretsCtxDuration)
+		invalidateSecrets()
+		for _, name := range names {
+			refreshSecret(ctx, name)
+		}
+		cancel()
+	}
+}
+
+func ApiKey() string {
+	return Secret(SecretApiKey)
+}
+
+func UnblockKey() string {
+	return Secret(SecretUnblockKey)
+}
+
+func SmtpPassword() string {
+	return Secret(SecretSmtpPassword)
+}
+
+// fileSecrets reads the secrets from files: one file per secret in dir (e.g., a mounted Kubernetes secret) or the configured paths
+type fileSecrets struct {
+	dir   string
+	paths map[string]string
+}
+
+func (f fileSecrets) GetSecret(_ context.Context, name string) (string, error) {
+	path := f.paths[name]
+	if f.dir != "" {
+		if _, err := os.Stat(filepath.Join(f.dir, name)); err == nil {
+			path = filepath.Join(f.dir, name)
+		}
+	}
+	if path == "" {
+		return "", ErrSecretNotFound
+	}
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", ErrSecretNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// secretsDocument is the JSON object of a remote provider holding all secrets, fetched once for all secret names
+type secretsDocument struct {
+	mu     sync.Mutex
+	values map[string]interface{}
+}
+
+func (d *secretsDocument) get(ctx context.Context, name string, fetch func(context.Context) (map[string]interface{}, error)) (string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.values == nil {
+		values, err := fetch(ctx)
+		if err != nil {
+			return "", err
+		}
+		d.values = values
+	}
+	return secretValue(d.values, name)
+}
+
+func (d *secretsDocument) invalidate() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.values = nil
+}
+
+// vaultSecrets reads the secrets from a key/value (version 2) secret in HashiCorp Vault, the keys are the secret names
+type vaultSecrets struct {
+	conf VaultConfig
+	secretsDocument
+}
+
+func (v *vaultSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	return v.get(ctx, name, v.fetch)
+}
+
+func (v *vaultSecrets) fetch(ctx context.Context) (map[string]interface{}, error) {
+	token := os.Getenv("VAULT_TOKEN")
+	if v.conf.PathToToken != "" {
+		b, err := os.ReadFile(v.conf.PathToToken)
+		if err != nil {
+			return nil, err
+		}
+		token = strings.TrimSpace(string(b))
+	}
+	mount := v.conf.Mount
+	if mount == "" {
+		mount = "secret"
+	}
+	u := fmt.Sprintf("%s/v1/%s/data/%s", strings.TrimSuffix(v.conf.Address, "/"), mount, strings.TrimPrefix(v.conf.Path, "/"))
+	request, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("X-Vault-Token", token)
+	if v.conf.Namespace != "" {
+		request.Header.Add("X-Vault-Namespace", v.conf.Namespace)
+	}
+	b, err := doSecretsRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("reading from Vault failed: %v", err)
+	}
+	res := struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	if res.Data.Data == nil {
+		return map[string]interface{}{}, nil
+	}
+	return res.Data.Data, nil
+}
+
+// awsSecrets reads the secrets from a secret in AWS Secrets Manager containing a JSON object, the keys are the secret names
+type awsSecrets struct {
+	conf      AwsSecretsConfig
+	awsConfig *aws.Config // loaded at the first fetch, the credentials are cached by the configuration
+	secretsDocument
+}
+
+func (a *awsSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	return a.get(ctx, name, a.fetch)
+}
+
+// fetch is called with the lock of the document held
+func (a *awsSecrets) fetch(ctx context.Context) (map[string]interface{}, error) {
+	if a.awsConfig == nil {
+		awsConfig, err := awscfg.LoadDefaultConfig(ctx, awscfg.WithRegion(a.conf.Region))
+		if err != nil {
+			return nil, err
+		}
+		a.awsConfig = &awsConfig
+	}
+	credentials, err := a.awsConfig.Credentials.Retrieve(ctx)
+	if err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(map[string]string{"SecretId": a.conf.SecretId})
+	u := fmt.Sprintf("https://secretsmanager.%s.amazonaws.com/", a.awsConfig.Region)
+	request, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Content-Type", "application/x-amz-json-1.1")
+	request.Header.Add("X-Amz-Target", "secretsmanager.GetSecretValue")
+	payloadHash := sha256.Sum256(body)
+	err = v4.NewSigner().SignHTTP(ctx, credentials, request, hex.EncodeToString(payloadHash[:]), "secretsmanager", a.awsConfig.Region, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	b, err := doSecretsRequest(request)
+	if err != nil {
+		return nil, fmt.Errorf("reading from AWS Secrets Manager failed: %v", err)
+	}
+	res := struct {
+		SecretString string `json:"SecretString"`
+	}{}
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(res.SecretString), &values); err != nil {
+		return nil, fmt.Errorf("secret %v is not a JSON object: %v", a.conf.SecretId, err)
+	}
+	return values, nil
+}
+
+func doSecretsRequest(request *http.Request) ([]byte, error) {
+	r, err := secretsClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s responded with %d - %s", (&url.URL{Scheme: request.URL.Scheme, Host: request.URL.Host}).String(), r.StatusCode, string(b))
+	}
+	return b, nil
+}
+
+// secretValue returns the string values as they are and the other values (e.g., the OAuth secrets object) as JSON
+func secretValue(values map[string]interface{}, name string) (string, error) {
+	v, ok := values[name]
+	if !ok || v == nil {
+		return "", ErrSecretNotFound
+	}
+	if s, ok := v.(string); ok {
+		return s, nil
+	}
+	b, err := json.Marshal(v)
+	return string(b), err
+}
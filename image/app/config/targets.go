@@ -0,0 +1,72 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import "context"
+
+type targetKey struct{}
+
+// WithTarget selects the Dataverse installation (one of the dataverseTargets) called with the context, the default installation
+// (the dataverseServer) is called when the name is empty
+func WithTarget(ctx context.Context, name string) context.Context {
+	if name == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, targetKey{}, name)
+}
+
+// TargetName returns the name of the installation selected with WithTarget, empty for the default installation
+func TargetName(ctx context.Context) string {
+	name, _ := ctx.Value(targetKey{}).(string)
+	return name
+}
+
+func TargetExists(name string) bool {
+	_, ok := GetConfig().Options.DataverseTargets[name]
+	return name == "" || ok
+}
+
+// GetTarget returns the configuration of the installation of the context, the default installation is configured with the
+// dataverseServer and the top-level options; a target that is no longer configured (e.g., of a queued job) has no server,
+// its calls fail instead of being sent to another installation
+func GetTarget(ctx context.Context) TargetConfig {
+	c := GetConfig()
+	if name := TargetName(ctx); name != "" {
+		return c.Options.DataverseTargets[name]
+	}
+	return TargetConfig{
+		DataverseServer:      c.DataverseServer,
+		DataverseExternalUrl: c.Options.DataverseExternalUrl,
+		PathToApiKey:         c.Options.PathToApiKey,
+		PathToUnblockKey:     c.Options.PathToUnblockKey,
+		DefaultDriver:        c.Options.DefaultDriver,
+		StorageDrivers:       c.Options.StorageDrivers,
+	}
+}
+
+// TargetSecretName is the name of the secret (SecretApiKey or SecretUnblockKey) of the installation, e.g., "apiKey.test"
+func TargetSecretName(secret, target string) string {
+	if target == "" {
+		return secret
+	}
+	return secret + "." + target
+}
+
+// TargetApiKey returns the admin API key of the installation of the context
+func TargetApiKey(ctx context.Context) string {
+	return Secret(TargetSecretName(SecretApiKey, TargetName(ctx)))
+}
+
+// TargetUnblockKey returns the unblock key of the installation of the context
+func TargetUnblockKey(ctx context.Context) string {
+	return Secret(TargetSecretName(SecretUnblockKey, TargetName(ctx)))
+}
+
+// TargetExternalUrl returns the URL of the links to the datasets of the installation of the context
+func TargetExternalUrl(ctx context.Context) string {
+	t := GetTarget(ctx)
+	if t.DataverseExternalUrl != "" {
+		return t.DataverseExternalUrl
+	}
+	return t.DataverseServer
+}
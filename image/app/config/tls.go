@@ -0,0 +1,144 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"integration/app/logging"
+	"net/http"
+	"os"
+	"sync"
+)
+
+type tlsPolicy struct {
+	insecure bool
+	roots    *x509.CertPool
+}
+
+func (p tlsPolicy) config() *tls.Config {
+	return &tls.Config{RootCAs: p.roots, InsecureSkipVerify: p.insecure}
+}
+
+var tlsMutex sync.RWMutex
+var tlsGeneration int // incremented when the policies change, so that the transports rebuild their per-host clones
+var defaultTlsPolicy = tlsPolicy{roots: systemRoots()}
+var endpointTlsPolicies = map[string]tlsPolicy{}
+
+// TLSTransport sends the requests through a clone of the base transport per host, each verifying the certificates with the standard
+// verification (including the host name or IP address) against the trusted CAs of that host
+type TLSTransport struct {
+	base       *http.Transport
+	mu         sync.Mutex
+	generation int
+	hosts      map[string]*http.Transport
+}
+
+// NewTLSTransport returns the transport applying the TLS settings of the configuration to the base transport
+func NewTLSTransport(base *http.Transport) *TLSTransport {
+	return &TLSTransport{base: base, hosts: map[string]*http.Transport{}}
+}
+
+func (t *TLSTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return t.transport(r.URL.Hostname()).RoundTrip(r)
+}
+
+func (t *TLSTransport) transport(host string) *http.Transport {
+	tlsMutex.RLock()
+	generation, policy := tlsGeneration, tlsPolicyOf(host)
+	tlsMutex.RUnlock()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.generation != generation {
+		for _, old := range t.hosts {
+			old.CloseIdleConnections()
+		}
+		t.hosts = map[string]*http.Transport{}
+		t.generation = generation
+	}
+	res, ok := t.hosts[host]
+	if !ok {
+		res = t.base.Clone()
+		res.TLSClientConfig = policy.config()
+		t.hosts[host] = res
+	}
+	return res
+}
+
+func (t *TLSTransport) CloseIdleConnections() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, h := range t.hosts {
+		h.CloseIdleConnections()
+	}
+}
+
+func tlsPolicyOf(host string) tlsPolicy {
+	if policy, ok := endpointTlsPolicies[host]; ok {
+		return policy
+	}
+	return defaultTlsPolicy
+}
+
+// SetInsecure disables the certificate verification for all endpoints
+func SetInsecure() {
+	configMutex.Lock()
+	config.Options.TLS.Insecure = true
+	configMutex.Unlock()
+	initTLS()
+}
+
+func initTLS() {
+	c := GetConfig().Options.TLS
+	defaultPolicy, err := newTlsPolicy(c.Insecure, nil, c.PathToCaBundle)
+	if err != nil {
+		panic(err)
+	}
+	if c.Insecure {
+		logging.Logger.Warn("TLS certificate verification is disabled")
+	}
+	policies := map[string]tlsPolicy{}
+	for host, e := range c.Endpoints {
+		policies[host], err = newTlsPolicy(e.Insecure, defaultPolicy.roots, e.PathToCaBundle)
+		if err != nil {
+			panic(err)
+		}
+		if e.Insecure {
+			logging.Logger.Warn("TLS certificate verification is disabled", "host", host)
+		}
+	}
+	tlsMutex.Lock()
+	defaultTlsPolicy, endpointTlsPolicies = defaultPolicy, policies
+	tlsGeneration++
+	tlsMutex.Unlock()
+	// the libraries using the default transport directly only get the global settings
+	http.DefaultTransport.(*http.Transport).TLSClientConfig = defaultPolicy.config()
+}
+
+func systemRoots() *x509.CertPool {
+	roots, _ := x509.SystemCertPool()
+	if roots == nil {
+		roots = x509.NewCertPool()
+	}
+	return roots
+}
+
+func newTlsPolicy(insecure bool, roots *x509.CertPool, pathToCaBundle string) (tlsPolicy, error) {
+	if roots == nil {
+		roots = systemRoots()
+	}
+	if pathToCaBundle == "" {
+		return tlsPolicy{insecure, roots}, nil
+	}
+	b, err := os.ReadFile(pathToCaBundle)
+	if err != nil {
+		return tlsPolicy{}, fmt.Errorf("CA bundle could not be read from %v: %v", pathToCaBundle, err)
+	}
+	roots = roots.Clone()
+	if !roots.AppendCertsFromPEM(b) {
+		return tlsPolicy{}, fmt.Errorf("no certificates found in the CA bundle %v", pathToCaBundle)
+	}
+	logging.Logger.Info("CA bundle read from file", "file", pathToCaBundle)
+	return tlsPolicy{insecure, roots}, nil
+}
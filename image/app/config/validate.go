@@ -0,0 +1,181 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"errors"
+	"fmt"
+	"integration/app/logging"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Validate checks the loaded configuration, all problems found are reported in the returned error
+func Validate() error {
+	c := GetConfig()
+	errs := []error{}
+	if c.DataverseServer == "" {
+		errs = append(errs, fmt.Errorf("dataverseServer is not configured"))
+	} else if u, err := url.Parse(c.DataverseServer); err != nil || u.Scheme == "" || u.Host == "" {
+		errs = append(errs, fmt.Errorf("dataverseServer is not a valid URL: %v", c.DataverseServer))
+	}
+	for name, t := range c.Options.DataverseTargets {
+		if u, err := url.Parse(t.DataverseServer); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, fmt.Errorf("dataverseTargets.%v.dataverseServer is not a valid URL: %v", name, t.DataverseServer))
+		}
+		if _, ok := t.StorageDrivers[t.DefaultDriver]; t.DefaultDriver != "" && !ok {
+			errs = append(errs, fmt.Errorf("dataverseTargets.%v.defaultDriver must be one of its storageDrivers, got %q", name, t.DefaultDriver))
+		}
+	}
+	if _, ok := rdb.(*RedisBackend); ok && c.RedisHost == "" {
+		errs = append(errs, fmt.Errorf("redisHost is not configured"))
+	}
+	if _, ok := rdb.(*RedisBackend); ok && Secret(SecretTokenEncryptionKey) == "" && !c.Options.AllowUnencryptedTokens {
+		errs = append(errs, fmt.Errorf("no token encryption key configured: configure the tokenEncryptionKey secret, or set allowUnencryptedTokens to store the tokens unencrypted in Redis"))
+	}
+	if c.Options.Backend != "" && c.Options.Backend != "redis" && c.Options.Backend != "memory" {
+		errs = append(errs, fmt.Errorf("backend must be \"redis\" or \"memory\", got %q", c.Options.Backend))
+	}
+	if err := c.validateOptions(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// validateOptions checks the options that can be changed with a reload and compiles their patterns
+func (c *Config) validateOptions() error {
+	errs := []error{}
+	if c.Options.MaxFileSize < 0 {
+		errs = append(errs, fmt.Errorf("maxFileSize can not be negative"))
+	}
+	for name, sizes := range map[string]map[string]int64{"plugins": c.Options.MaxFileSizes.Plugins, "storageDrivers": c.Options.MaxFileSizes.StorageDrivers, "uploads": c.Options.MaxFileSizes.Uploads} {
+		for k, v := range sizes {
+			if v < 0 {
+				errs = append(errs, fmt.Errorf("maxFileSizes.%v.%v can not be negative", name, k))
+			}
+		}
+	}
+	for u := range c.Options.MaxFileSizes.Uploads {
+		if u != "direct" && u != "signedUrl" && u != "sword" && u != "api" {
+			errs = append(errs, fmt.Errorf("maxFileSizes.uploads: the upload path must be \"direct\", \"signedUrl\", \"sword\" or \"api\", got %q", u))
+		}
+	}
+	if c.Options.MaxDvObjectPages < 0 {
+		errs = append(errs, fmt.Errorf("maxDvObjectPages can not be negative"))
+	}
+	if c.Options.KnownHashesTTL < 0 {
+		errs = append(errs, fmt.Errorf("knownHashesTTL can not be negative"))
+	}
+	if c.Options.SnapshotTTL < -1 {
+		errs = append(errs, fmt.Errorf("snapshotTTL must be -1 (disabled) or more"))
+	}
+	if c.Options.ShutdownGracePeriod < 0 {
+		errs = append(errs, fmt.Errorf("shutdownGracePeriod can not be negative"))
+	}
+	if c.Options.LockHeartbeat < 0 {
+		errs = append(errs, fmt.Errorf("lockHeartbeat can not be negative"))
+	}
+	if c.Options.MaxRequestSize < 0 {
+		errs = append(errs, fmt.Errorf("maxRequestSize can not be negative"))
+	}
+	if c.Options.Workers < 0 {
+		errs = append(errs, fmt.Errorf("workers can not be negative"))
+	}
+	if a := c.Options.Autoscaling; a.MaxWorkers < 0 || a.JobsPerWorker < 0 || a.Interval < 0 || a.IdleTimeout < 0 || a.MemoryPerWorker < 0 {
+		errs = append(errs, fmt.Errorf("autoscaling: values can not be negative"))
+	} else if a.MaxWorkers > 0 && c.Options.Workers > a.MaxWorkers {
+		errs = append(errs, fmt.Errorf("autoscaling: maxWorkers can not be less than workers"))
+	}
+	if c.Options.LogLevel != "" && !logging.ValidLevel(c.Options.LogLevel) {
+		errs = append(errs, fmt.Errorf("logLevel must be \"debug\", \"info\", \"warn\" or \"error\", got %q", c.Options.LogLevel))
+	}
+	if o := c.Options.Oidc; o.Issuer != "" && o.Audience != "" && o.Audience == o.ClientId {
+		errs = append(errs, fmt.Errorf("oidc.audience must differ from oidc.clientId: the ID tokens can not be used as bearer tokens"))
+	}
+	for group, limit := range c.Options.RateLimits {
+		if group != "compare" && group != "store" {
+			errs = append(errs, fmt.Errorf("rateLimits: unknown group %q, must be \"compare\" or \"store\"", group))
+		}
+		if limit.PerMinute < 0 || limit.Burst < 0 {
+			errs = append(errs, fmt.Errorf("rateLimits.%v can not be negative", group))
+		}
+	}
+	for name, limits := range c.Options.JobLimits.all() {
+		if limits.MaxFiles < 0 || limits.MaxTotalSize < 0 {
+			errs = append(errs, fmt.Errorf("jobLimits%v can not be negative", name))
+		}
+	}
+	if s := c.Options.Symlinks; s != "" && s != "follow" && s != "skip" && s != "pointer" {
+		errs = append(errs, fmt.Errorf("symlinks must be \"follow\", \"skip\" or \"pointer\", got %q", s))
+	}
+	if e := c.Options.CachedResponseEncoding; e != "" && e != "gzip" && e != "json" {
+		errs = append(errs, fmt.Errorf("cachedResponseEncoding must be \"gzip\" or \"json\", got %q", e))
+	}
+	if c.Options.Prewarm.Interval < 0 || c.Options.Prewarm.Expiration < 0 {
+		errs = append(errs, fmt.Errorf("prewarm.interval and prewarm.expiration can not be negative"))
+	}
+	if p := c.Options.PermissionCheck; p != "" && p != "admin" && p != "native" && p != "none" {
+		errs = append(errs, fmt.Errorf("permissionCheck must be \"admin\", \"native\" or \"none\", got %q", p))
+	}
+	if t := c.Options.DataverseAuth.Type; t != "" && t != "apiKey" && t != "bearer" {
+		errs = append(errs, fmt.Errorf("dataverseAuth.type must be \"apiKey\" or \"bearer\", got %q", t))
+	}
+	if c.Options.Compare.Timeout < 0 || c.Options.Compare.BackgroundAfter < 0 || c.Options.Compare.BackgroundWorkers < 0 {
+		errs = append(errs, fmt.Errorf("compare.timeout, compare.backgroundAfter and compare.backgroundWorkers can not be negative"))
+	}
+	if t := c.Options.BagExport.Storage.Type; t != "" && t != "file" && c.Options.BagExport.Bucket == "" {
+		errs = append(errs, fmt.Errorf("bagExport.bucket is required for the %q driver", t))
+	}
+	for name, t := range c.Options.ExportTargets {
+		switch t.Type {
+		case "storage":
+			if t.Storage.Type != "file" && t.Bucket == "" {
+				errs = append(errs, fmt.Errorf("exportTargets.%s.bucket is required for the %q driver", name, t.Storage.Type))
+			}
+		case "webdav", "globus", "sftp":
+			if u, err := url.Parse(t.Url); t.Url == "" || err != nil || u.Host == "" {
+				errs = append(errs, fmt.Errorf("exportTargets.%s.url is not a valid URL: %q", name, t.Url))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("exportTargets.%s.type must be \"storage\", \"webdav\", \"globus\" or \"sftp\", got %q", name, t.Type))
+		}
+	}
+	for i, route := range c.Options.JobRouting {
+		if route.Label == "" {
+			errs = append(errs, fmt.Errorf("jobRouting[%d].label is required", i))
+		}
+		if u := route.Upload; u != "" && u != "direct" && u != "signedUrl" && u != "sword" && u != "api" {
+			errs = append(errs, fmt.Errorf("jobRouting[%d].upload must be \"direct\", \"signedUrl\", \"sword\" or \"api\", got %q", i, u))
+		}
+	}
+	for _, o := range c.Options.Cors.AllowedOrigins {
+		if u, err := url.Parse(o); o != "*" && (err != nil || u.Scheme == "" || u.Host == "" || strings.Trim(u.Path, "/") != "") {
+			errs = append(errs, fmt.Errorf("cors.allowedOrigins: %q is not an origin (scheme://host[:port])", o))
+		}
+	}
+	if p := c.Options.TransformHook.FilePattern; p != "" {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("transformHook.filePattern is not a valid regular expression: %v", err))
+		}
+		c.Options.TransformHook.filePattern = re
+	}
+	if c.Options.Cors.AllowCredentials && slices.Contains(c.Options.Cors.AllowedOrigins, "*") {
+		errs = append(errs, fmt.Errorf("cors.allowCredentials can not be combined with the \"*\" origin"))
+	}
+	return errors.Join(errs...)
+}
+
+// all returns the default limits and the limits of the plugins and datasets, by their path in the configuration
+func (c JobLimitsConfig) all() map[string]JobLimits {
+	res := map[string]JobLimits{"": {MaxFiles: c.MaxFiles, MaxTotalSize: c.MaxTotalSize}}
+	for k, v := range c.Plugins {
+		res[".plugins."+k] = v
+	}
+	for k, v := range c.Datasets {
+		res[".datasets."+k] = v
+	}
+	return res
+}
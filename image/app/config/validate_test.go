@@ -0,0 +1,31 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import (
+	"testing"
+)
+
+func TestTransformHookPattern(t *testing.T) {
+	c := Config{}
+	c.Options.TransformHook = TransformHook{Command: []string{"cat"}, FilePattern: `\.(dcm|jpe?g)$`}
+	if err := c.validateOptions(); err != nil {
+		t.Fatal(err)
+	}
+	hook := c.Options.TransformHook
+	if !hook.Matches("scans/a.dcm") || hook.Matches("notes.txt") {
+		t.Errorf("pattern %q does not select the expected files", hook.FilePattern)
+	}
+
+	c.Options.TransformHook.FilePattern = `(\.dcm$`
+	if err := c.validateOptions(); err == nil {
+		t.Errorf("expected an error for the invalid pattern")
+	}
+	if c.Options.TransformHook.Matches("scans/a.dcm") {
+		t.Errorf("the invalid pattern must not select any file")
+	}
+
+	if !(TransformHook{}).Matches("notes.txt") {
+		t.Errorf("all files must be selected without a pattern")
+	}
+}
@@ -0,0 +1,23 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package config
+
+import "runtime/debug"
+
+// Version can be set while building, e.g., go build -ldflags "-X integration/app/config.Version=v1.2.3"
+var Version = ""
+
+// GetVersion returns the configured version, or the VCS revision recorded by the Go toolchain when not set
+func GetVersion() string {
+	if Version != "" {
+		return Version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, s := range info.Settings {
+			if s.Key == "vcs.revision" {
+				return s.Value
+			}
+		}
+	}
+	return "dev"
+}
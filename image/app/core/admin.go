@@ -0,0 +1,265 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// CachedResponsesKey is the set of the keys of the cached compare responses
+const CachedResponsesKey = "cached responses"
+
+// the queues known to the application
+var queues = []string{"jobs", "archive"}
+
+type LockInfo struct {
+	PersistentId string `json:"persistentId"`
+	Running      bool   `json:"running"` // false when the job is queued (or the lock is orphaned)
+}
+
+type RunningJob struct {
+	PersistentId  string `json:"persistentId"`
+	User          string `json:"user"`
+	Plugin        string `json:"plugin"`
+	RepoName      string `json:"repoName,omitempty"`
+	Worker        string `json:"worker"` // lease holder, empty when the lease expired
+	Processed     int    `json:"processed"`
+	Total         int    `json:"total"`
+	Throughput    int64  `json:"throughput,omitempty"`
+	CorrelationId string `json:"correlationId,omitempty"`
+}
+
+type CachedResponseInfo struct {
+	Key          string `json:"key"`
+	PersistentId string `json:"persistentId"`
+	Size         int    `json:"size"`
+}
+
+// DestinationInfo is the version of a destination installation (the default one or a Dataverse target) and its optional features
+type DestinationInfo struct {
+	Target   string   `json:"target,omitempty"`
+	Server   string   `json:"server"`
+	Version  string   `json:"version"`
+	Detected bool     `json:"detected"` // false when the version could not be read and a default version is assumed
+	Features []string `json:"features"`
+}
+
+// Destinations returns the version and the features of the default installation and of the Dataverse targets
+func Destinations() []DestinationInfo {
+	res := []DestinationInfo{}
+	if Destination.Info == nil {
+		return res
+	}
+	targets := []string{""}
+	for name := range config.GetConfig().Options.DataverseTargets {
+		targets = append(targets, name)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		res = append(res, Destination.Info(config.WithTarget(context.Background(), target)))
+	}
+	return res
+}
+
+type progress struct {
+	Processed int `json:"processed"`
+	Total     int `json:"total"`
+}
+
+func progressKey(persistentId string) string {
+	return "progress: " + persistentId
+}
+
+func setProgress(ctx context.Context, persistentId, user string, processed, total int) {
+	b, _ := json.Marshal(progress{processed, total})
+	config.GetRedis().Set(ctx, progressKey(persistentId), string(b), config.LockMaxDuration)
+	PublishEvent(ctx, ProgressEvent{Type: EventProgress, PersistentId: persistentId, User: user, Processed: processed, Total: total})
+}
+
+// GetProgress returns the number of the processed and of all files of the running job of the dataset
+func GetProgress(ctx context.Context, persistentId string) (int, int, bool) {
+	p := progress{}
+	cached, _ := config.GetRedis().Get(ctx, progressKey(persistentId))
+	if cached == "" || json.Unmarshal([]byte(cached), &p) != nil {
+		return 0, 0, false
+	}
+	return p.Processed, p.Total, true
+}
+
+// ListLocks returns the locked datasets, the expired locks are removed from the set
+func ListLocks(ctx context.Context) ([]LockInfo, error) {
+	pids, err := config.GetRedis().SMembers(ctx, "locks")
+	if err != nil {
+		return nil, err
+	}
+	res := []LockInfo{}
+	for _, pid := range pids {
+		if !IsLocked(ctx, pid) {
+			config.GetRedis().SRem(ctx, "locks", pid)
+			continue
+		}
+		running, _ := config.GetRedis().Get(ctx, "running: "+pid)
+		res = append(res, LockInfo{
+			PersistentId: pid,
+			Running:      running != "",
+		})
+	}
+	return res, nil
+}
+
+func QueueDepths(ctx context.Context) (map[string]int64, error) {
+	res := map[string]int64{}
+	for _, q := range append(queues, routedQueues()...) {
+		n, err := config.GetRedis().LLen(ctx, q)
+		if err != nil {
+			return nil, err
+		}
+		res[q] = n
+	}
+	return res, nil
+}
+
+func RunningJobs(ctx context.Context) ([]RunningJob, error) {
+	pids, err := config.GetRedis().SMembers(ctx, "running jobs")
+	if err != nil {
+		return nil, err
+	}
+	res := []RunningJob{}
+	for _, pid := range pids {
+		running, _ := config.GetRedis().Get(ctx, "running: "+pid)
+		job, err := unmarshalJob([]byte(running))
+		if err != nil {
+			continue
+		}
+		p := progress{Total: len(job.WritableNodes)}
+		cached, _ := config.GetRedis().Get(ctx, progressKey(pid))
+		json.Unmarshal([]byte(cached), &p)
+		worker, _ := config.GetRedis().Get(ctx, "lease: "+pid)
+		res = append(res, RunningJob{
+			PersistentId:  pid,
+			User:          job.User,
+			Plugin:        job.Plugin,
+			RepoName:      job.StreamParams.RepoName,
+			Worker:        worker,
+			Processed:     p.Processed,
+			Total:         p.Total,
+			Throughput:    GetThroughput(ctx, pid),
+			CorrelationId: job.CorrelationId,
+		})
+	}
+	return res, nil
+}
+
+func CachedResponses(ctx context.Context) ([]CachedResponseInfo, error) {
+	keys, err := config.GetRedis().SMembers(ctx, CachedResponsesKey)
+	if err != nil {
+		return nil, err
+	}
+	res := []CachedResponseInfo{}
+	for _, key := range keys {
+		cached, _ := config.GetRedis().Get(ctx, key)
+		if cached == "" {
+			config.GetRedis().SRem(ctx, CachedResponsesKey, key)
+			continue
+		}
+		response := struct {
+			Response CompareResponse `json:"res"`
+		}{}
+		DecodeCached(cached, &response)
+		res = append(res, CachedResponseInfo{Key: key, PersistentId: response.Response.Id, Size: len(cached)})
+	}
+	return res, nil
+}
+
+// ForceUnlock removes the lock of the dataset, a job that is still running is not stopped
+func ForceUnlock(ctx context.Context, persistentId string) error {
+	if !IsLocked(ctx, persistentId) {
+		return fmt.Errorf("dataset %v is not locked", persistentId)
+	}
+	unlock(persistentId)
+	config.GetRedis().Del(ctx, "running: "+persistentId, "lease: "+persistentId, progressKey(persistentId))
+	config.GetRedis().SRem(ctx, "running jobs", persistentId)
+	logging.Logger.WarnContext(ctx, "dataset force-unlocked", "persistentId", persistentId)
+	return nil
+}
+
+// FlushCaches removes the cached compare responses and the known hashes (of the dataset, or all when the persistent id is empty)
+func FlushCaches(ctx context.Context, persistentId string) error {
+	pids := []string{persistentId}
+	if persistentId == "" {
+		var err error
+		pids, err = config.GetRedis().SMembers(ctx, "hashed datasets")
+		if err != nil {
+			return err
+		}
+	}
+	for _, pid := range pids {
+		InvalidateKnownHashes(ctx, pid)
+	}
+	responses, err := CachedResponses(ctx)
+	if err != nil {
+		return err
+	}
+	for _, r := range responses {
+		if persistentId == "" || r.PersistentId == persistentId {
+			config.GetRedis().Del(ctx, r.Key)
+			config.GetRedis().SRem(ctx, CachedResponsesKey, r.Key)
+		}
+	}
+	logging.Logger.InfoContext(ctx, "caches flushed", "persistentId", persistentId)
+	return nil
+}
+
+// RedactedConfig returns the backend configuration with the values of the secret fields replaced
+func RedactedConfig() (map[string]interface{}, error) {
+	b, err := json.Marshal(config.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]interface{}{}
+	err = json.Unmarshal(b, &res)
+	if err != nil {
+		return nil, err
+	}
+	redact(res)
+	return res, nil
+}
+
+func redact(v interface{}) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, value := range t {
+			lower := strings.ToLower(k)
+			secret := strings.Contains(lower, "secret") || strings.Contains(lower, "password") || strings.Contains(lower, "token") || strings.HasSuffix(lower, "key")
+			if secret && !strings.HasPrefix(lower, "pathto") && value != "" {
+				t[k] = "***"
+				continue
+			}
+			if str, ok := value.(string); ok {
+				t[k] = redactUrl(str)
+				continue
+			}
+			redact(value)
+		}
+	case []interface{}:
+		for _, value := range t {
+			redact(value)
+		}
+	}
+}
+
+// redactUrl hides the password of the URLs with user info (e.g., proxy URLs)
+func redactUrl(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,136 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/tree"
+	"time"
+)
+
+// Adoption holds the credentials of the data steward taking over an in-flight or failed job
+type Adoption struct {
+	DataverseKey string `json:"dataverseKey"`
+	User         string `json:"user"`
+	Token        string `json:"token"`                // repository token or session id of the cached OAuth token (as in the store request)
+	StreamUser   string `json:"streamUser,omitempty"` // repository user, when required by the plugin (e.g., iRODS)
+}
+
+// storeFailedJob keeps the remaining work (not processed files) of a job that failed permanently, so it can be adopted later
+func storeFailedJob(job Job) {
+	if job.Plugin == "hash-only" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	if len(notProcessed(job)) == 0 {
+		config.GetRedis().Del(ctx, "failed job: "+job.PersistentId)
+		return
+	}
+	// the files given up in the ContinueOnError mode are resumed as well, with new attempts
+	writableNodes := map[string]tree.Node{}
+	for k, v := range job.FailedNodes {
+		writableNodes[k] = v
+	}
+	for k, v := range job.WritableNodes {
+		writableNodes[k] = v
+	}
+	job.WritableNodes, job.FailedNodes, job.FileAttempts = writableNodes, nil, nil
+	b, err := marshalJob(job)
+	if err != nil {
+		logging.Logger.Error("marshalling failed job failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	config.GetRedis().Set(ctx, "failed job: "+job.PersistentId, string(b), config.LockMaxDuration)
+	RegisterUserData(ctx, job.User, UserDataEntry{
+		Type:        "failed job",
+		Key:         "failed job: " + job.PersistentId,
+		Description: fmt.Sprintf("failed job for %v, including the credentials needed to resume it", job.PersistentId),
+	}, config.LockMaxDuration)
+}
+
+// JobOwner returns the user of the failed or running job of the dataset, false when there is no such job (e.g., it is still queued)
+func JobOwner(ctx context.Context, persistentId string) (string, bool) {
+	for _, key := range []string{"failed job: ", "running: "} {
+		stored, _ := config.GetRedis().Get(ctx, key+persistentId)
+		job := Job{}
+		if stored != "" && json.Unmarshal([]byte(stored), &job) == nil {
+			return job.User, true
+		}
+	}
+	return "", false
+}
+
+// AdoptJob transfers the job of the dataset to the data steward: a failed job is restarted with the remaining files,
+// an in-flight job continues under the new credentials from the next retry on
+func AdoptJob(ctx context.Context, persistentId string, adoption Adoption) error {
+	failed, _ := config.GetRedis().Get(ctx, "failed job: "+persistentId)
+	if failed != "" {
+		job, err := unmarshalJob([]byte(failed))
+		if err != nil {
+			return err
+		}
+		job = applyAdoption(job, adoption)
+		err = AddJob(ctx, job)
+		if err != nil {
+			return err
+		}
+		config.GetRedis().Del(ctx, "failed job: "+persistentId)
+		logging.Logger.InfoContext(ctx, "failed job adopted", "persistentId", persistentId, "user", adoption.User)
+		return nil
+	}
+	if !IsLocked(ctx, persistentId) {
+		return fmt.Errorf("no in-flight or failed job found for %v", persistentId)
+	}
+	b, err := json.Marshal(adoption)
+	if err != nil {
+		return err
+	}
+	config.GetRedis().Set(ctx, "adopt: "+persistentId, string(b), config.LockMaxDuration)
+	RegisterUserData(ctx, adoption.User, UserDataEntry{
+		Type:        "job adoption",
+		Key:         "adopt: " + persistentId,
+		Description: fmt.Sprintf("pending adoption of the job for %v, including the credentials needed to continue it", persistentId),
+	}, config.LockMaxDuration)
+	logging.Logger.InfoContext(ctx, "job will be adopted", "persistentId", persistentId, "user", adoption.User)
+	return nil
+}
+
+// adoptIfRequested is called by the workers before (re)starting a job
+func adoptIfRequested(job Job) Job {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	requested, _ := config.GetRedis().Get(ctx, "adopt: "+job.PersistentId)
+	if requested == "" {
+		return job
+	}
+	config.GetRedis().Del(ctx, "adopt: "+job.PersistentId)
+	adoption := Adoption{}
+	err := json.Unmarshal([]byte(requested), &adoption)
+	if err != nil {
+		logging.Logger.Warn("malformed job adoption", "persistentId", job.PersistentId, "error", err)
+		return job
+	}
+	job = applyAdoption(job, adoption)
+	job.Deadline = time.Now().Add(config.LockMaxDuration)
+	config.GetRedis().Set(ctx, "lock: "+job.PersistentId, true, config.LockMaxDuration)
+	config.GetRedis().SAdd(ctx, "locks", job.PersistentId)
+	logging.Logger.Info("job adopted", "persistentId", job.PersistentId, "user", adoption.User)
+	return job
+}
+
+func applyAdoption(job Job, adoption Adoption) Job {
+	job.DataverseKey = adoption.DataverseKey
+	job.User = adoption.User
+	job.SessionId = adoption.Token
+	job.StreamParams.Token = adoption.Token
+	if adoption.StreamUser != "" {
+		job.StreamParams.User = adoption.StreamUser
+	}
+	job.ErrCnt = 0
+	return job
+}
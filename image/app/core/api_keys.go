@@ -0,0 +1,138 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeyPrefix  = "rdmk_"
+	apiKeysSetKey = "api keys"
+)
+
+// ServiceApiKey is a key for machine-to-machine use (e.g., CI pipelines), only its hash is stored
+type ServiceApiKey struct {
+	Id            string    `json:"id"`                      // public identifier of the key, used to revoke it
+	Name          string    `json:"name"`                    // description, e.g., the pipeline using the key
+	User          string    `json:"user"`                    // the user (as known by Dataverse) the calls are made for
+	Plugins       []string  `json:"plugins,omitempty"`       // allowed plugins (plugin types or plugin ids), all plugins when empty
+	PersistentIds []string  `json:"persistentIds,omitempty"` // allowed datasets, all datasets when empty
+	RateLimit     int       `json:"rateLimit,omitempty"`     // requests per minute, unlimited when not set
+	Created       time.Time `json:"created"`
+	CreatedBy     string    `json:"createdBy"`
+}
+
+func apiKeyHash(key string) string {
+	h := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(h[:])
+}
+
+func apiKeyStoreKey(hash string) string {
+	return "api key: " + hash
+}
+
+// CreateApiKey stores the hash of a new key and returns the key, it can not be retrieved later
+func CreateApiKey(ctx context.Context, key ServiceApiKey) (string, ServiceApiKey, error) {
+	if key.User == "" {
+		return "", key, fmt.Errorf("the user of the key is not set")
+	}
+	secret := apiKeyPrefix + randomString()
+	hash := apiKeyHash(secret)
+	key.Id = hash[:16]
+	key.Created = time.Now()
+	b, err := json.Marshal(key)
+	if err != nil {
+		return "", key, err
+	}
+	// stored without expiration: the keys are valid until they are revoked
+	err = config.GetRedis().Set(ctx, apiKeyStoreKey(hash), string(b), 0)
+	if err != nil {
+		return "", key, err
+	}
+	config.GetRedis().SAdd(ctx, apiKeysSetKey, hash)
+	return secret, key, nil
+}
+
+func ListApiKeys(ctx context.Context) ([]ServiceApiKey, error) {
+	hashes, err := config.GetRedis().SMembers(ctx, apiKeysSetKey)
+	if err != nil {
+		return nil, err
+	}
+	res := []ServiceApiKey{}
+	for _, hash := range hashes {
+		key := ServiceApiKey{}
+		if cached, _ := config.GetRedis().Get(ctx, apiKeyStoreKey(hash)); json.Unmarshal([]byte(cached), &key) == nil {
+			res = append(res, key)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created.Before(res[j].Created) })
+	return res, nil
+}
+
+func RevokeApiKey(ctx context.Context, id string) error {
+	hashes, err := config.GetRedis().SMembers(ctx, apiKeysSetKey)
+	if err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if id != "" && strings.HasPrefix(hash, id) {
+			config.GetRedis().Del(ctx, apiKeyStoreKey(hash))
+			config.GetRedis().SRem(ctx, apiKeysSetKey, hash)
+			return nil
+		}
+	}
+	return fmt.Errorf("API key %v not found", id)
+}
+
+// AuthenticateApiKey returns the identity of a valid key, the rate limit of the key is applied to each call
+func AuthenticateApiKey(ctx context.Context, secret string) (Identity, error) {
+	if !strings.HasPrefix(secret, apiKeyPrefix) {
+		return Identity{}, fmt.Errorf("invalid API key")
+	}
+	key := ServiceApiKey{}
+	cached, _ := config.GetRedis().Get(ctx, apiKeyStoreKey(apiKeyHash(secret)))
+	if cached == "" || json.Unmarshal([]byte(cached), &key) != nil {
+		return Identity{}, fmt.Errorf("invalid API key")
+	}
+	if allowed, _ := TakeToken(ctx, "api key: "+key.Id, float64(key.RateLimit), key.RateLimit); !allowed {
+		return Identity{}, ErrRateLimited
+	}
+	return Identity{User: key.User, Name: key.Name, Method: "api key", ApiKey: &key}, nil
+}
+
+// CheckScope verifies that the API key (when the call is authenticated with one) allows the plugin and the dataset,
+// the plugins are not checked when the call does not use a plugin (e.g., the fixity verification), an empty persistentId
+// (no dataset or all datasets) is refused to the keys limited to datasets
+func CheckScope(ctx context.Context, plugins []string, persistentId string) error {
+	identity, ok := IdentityFromContext(ctx)
+	if !ok || identity.ApiKey == nil {
+		return nil
+	}
+	key := identity.ApiKey
+	if len(key.PersistentIds) > 0 && persistentId == "" {
+		// e.g., creating a dataset or listing the jobs of all datasets
+		return fmt.Errorf("API key %v is limited to datasets %v", key.Id, strings.Join(key.PersistentIds, ", "))
+	}
+	if len(key.PersistentIds) > 0 && !slices.Contains(key.PersistentIds, persistentId) {
+		return fmt.Errorf("API key %v is not allowed to access dataset %v", key.Id, persistentId)
+	}
+	if len(key.Plugins) == 0 || len(plugins) == 0 {
+		return nil
+	}
+	for _, p := range plugins {
+		if p != "" && slices.Contains(key.Plugins, p) {
+			return nil
+		}
+	}
+	return fmt.Errorf("API key %v is not allowed to use plugin %v", key.Id, strings.Join(plugins, "/"))
+}
@@ -0,0 +1,228 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/storage"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+const archiveSchemaVersion = 1
+
+// ArchivedJob is the JSON document written to the archive bucket for each finished job (see README for the schema)
+type ArchivedJob struct {
+	SchemaVersion int          `json:"schemaVersion"`
+	PersistentId  string       `json:"persistentId"`
+	User          string       `json:"user"`
+	Plugin        string       `json:"plugin"`
+	PluginId      string       `json:"pluginId"`
+	RepoName      string       `json:"repoName"`
+	Url           string       `json:"url"`
+	Option        string       `json:"option"`
+	Status        string       `json:"status"`
+	ErrCnt        int          `json:"errCnt"`
+	NotProcessed  []string     `json:"notProcessed,omitempty"`
+	Report        JobReport    `json:"report"`
+	Audit         []AuditEvent `json:"audit,omitempty"` // the audit log entries of the job, without the files listed in the report
+	Archived      time.Time    `json:"archived"`
+}
+
+func archiveConfig() config.JobArchive {
+	res := config.GetConfig().Options.JobArchive
+	if res.Prefix == "" {
+		res.Prefix = "jobs/"
+	}
+	if res.ExportInterval <= 0 {
+		res.ExportInterval = 300
+	}
+	return res
+}
+
+func archiveEnabled() bool {
+	return config.GetConfig().Options.JobArchive.S3Config.AWSBucket != ""
+}
+
+func archiveJob(job Job, audit *AuditEvent) {
+	if !archiveEnabled() || job.Plugin == "hash-only" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	status := "completed"
+	remaining := notProcessed(job)
+	if len(remaining) > 0 {
+		status = "failed"
+	}
+	job.Report.PersistentId = job.PersistentId
+	var events []AuditEvent
+	if audit != nil {
+		event := *audit
+		event.Files = nil
+		events = append(events, event)
+	}
+	b, err := json.Marshal(ArchivedJob{
+		SchemaVersion: archiveSchemaVersion,
+		PersistentId:  job.PersistentId,
+		User:          job.User,
+		Plugin:        job.Plugin,
+		PluginId:      job.StreamParams.PluginId,
+		RepoName:      job.StreamParams.RepoName,
+		Url:           job.StreamParams.Url,
+		Option:        job.StreamParams.Option,
+		Status:        status,
+		ErrCnt:        job.ErrCnt,
+		NotProcessed:  remaining,
+		Report:        job.Report,
+		Audit:         events,
+	})
+	if err != nil {
+		logging.Logger.Error("marshalling archived job failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	config.GetRedis().LPush(ctx, "archive", string(b))
+}
+
+// the queue of the archived jobs being exported, and the lock of the export (only one instance exports at a time)
+const (
+	archiveExportingKey = "archive: exporting"
+	archiveExportLock   = "archive: export lock"
+)
+
+// ExportJobArchive periodically moves the finished jobs queued in Redis to the archive bucket, starting at once with the jobs left
+// by an export that did not finish (e.g., a crash of the instance)
+func ExportJobArchive() {
+	defer Wait.Done()
+	if !archiveEnabled() {
+		return
+	}
+	interval := time.Duration(archiveConfig().ExportInterval) * time.Second
+	for {
+		n, err := exportArchivedJobs()
+		if err != nil {
+			logging.Logger.Error("exporting archived jobs failed", "error", err)
+		}
+		if n > 0 {
+			logging.Logger.Info("exported archived jobs", "jobs", n)
+		}
+		select {
+		case <-Stop:
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+// exportArchivedJobs moves each job to the exporting queue while it is written to the bucket, it is only removed from that queue
+// once it is written: the jobs left in the exporting queue by a failed or interrupted export are exported again by the next export
+func exportArchivedJobs() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	if ok, err := config.GetRedis().SetNX(ctx, archiveExportLock, workerId, 2*redisCtxDuration); !ok || err != nil {
+		return 0, err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+		defer cancel()
+		config.GetRedis().ReleaseLease(ctx, archiveExportLock, workerId)
+	}()
+	c := archiveConfig()
+	client, err := storage.NewS3Client(ctx, c.S3Config)
+	if err != nil {
+		return 0, err
+	}
+	// no other export is running: the jobs in the exporting queue were left by a previous export and are queued again
+	for {
+		_, err := config.GetRedis().RPopLPush(ctx, archiveExportingKey, "archive")
+		if errors.Is(err, config.ErrNotFound) {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	n := 0
+	for {
+		popped, err := config.GetRedis().RPopLPush(ctx, "archive", archiveExportingKey)
+		if errors.Is(err, config.ErrNotFound) {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		archived := ArchivedJob{}
+		err = json.Unmarshal([]byte(popped), &archived)
+		if err != nil {
+			logging.Logger.Warn("dropping malformed archived job", "error", err)
+			config.GetRedis().LRem(ctx, archiveExportingKey, popped)
+			continue
+		}
+		archived.Archived = time.Now()
+		b, _ := json.Marshal(archived)
+		key := fmt.Sprintf("%s%s/%s.json", c.Prefix, archived.PersistentId, archived.Report.Finished.UTC().Format("20060102T150405.000000000Z"))
+		_, err = client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket:      aws.String(c.S3Config.AWSBucket),
+			Key:         aws.String(key),
+			Body:        bytes.NewReader(b),
+			ContentType: aws.String("application/json"),
+		})
+		if err != nil {
+			return n, err
+		}
+		if _, err = config.GetRedis().LRem(ctx, archiveExportingKey, popped); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func GetArchivedJobs(ctx context.Context, persistentId string) ([]ArchivedJob, error) {
+	res := []ArchivedJob{}
+	if !archiveEnabled() {
+		return res, fmt.Errorf("job archive is not configured")
+	}
+	c := archiveConfig()
+	client, err := storage.NewS3Client(ctx, c.S3Config)
+	if err != nil {
+		return nil, err
+	}
+	paginator := s3.NewListObjectsV2Paginator(client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(c.S3Config.AWSBucket),
+		Prefix: aws.String(c.Prefix + persistentId + "/"),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, o := range page.Contents {
+			obj, err := client.GetObject(ctx, &s3.GetObjectInput{
+				Bucket: aws.String(c.S3Config.AWSBucket),
+				Key:    o.Key,
+			})
+			if err != nil {
+				return nil, err
+			}
+			b, err := io.ReadAll(obj.Body)
+			obj.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			archived := ArchivedJob{}
+			err = json.Unmarshal(b, &archived)
+			if err != nil {
+				return nil, fmt.Errorf("archived job %v is malformed: %v", *o.Key, err)
+			}
+			res = append(res, archived)
+		}
+	}
+	return res, nil
+}
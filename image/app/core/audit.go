@@ -0,0 +1,214 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	auditStore         = "store"
+	auditBagExport     = "bag export"
+	auditExport        = "export"
+	auditCreateDataset = "create dataset"
+)
+
+// auditLogKey is the list of the audit events in the backend, oldest first
+const auditLogKey = "audit log"
+
+// AuditEvent is a line of the audit log
+type AuditEvent struct {
+	Time          time.Time             `json:"time"`
+	Action        string                `json:"action"` // "store", "bag export", "export" or "create dataset"
+	User          string                `json:"user"`
+	Orcid         string                `json:"orcid,omitempty"` // the ORCID iD linked to the user with the ORCID login
+	PersistentId  string                `json:"persistentId"`
+	Collection    string                `json:"collection,omitempty"`
+	Plugin        string                `json:"plugin,omitempty"`
+	PluginId      string                `json:"pluginId,omitempty"`
+	RepoName      string                `json:"repoName,omitempty"`
+	Url           string                `json:"url,omitempty"`
+	Option        string                `json:"option,omitempty"`
+	Status        string                `json:"status,omitempty"`
+	Started       time.Time             `json:"started,omitempty"`
+	Files         map[string]FileResult `json:"files,omitempty"`
+	CorrelationId string                `json:"correlationId,omitempty"`
+}
+
+// AuditQuery filters the audit log, the empty fields are not used for filtering
+type AuditQuery struct {
+	PersistentId string    `json:"persistentId"`
+	User         string    `json:"user"`
+	Since        time.Time `json:"since"`
+	Until        time.Time `json:"until"`
+}
+
+var auditMutex sync.Mutex
+
+func auditEnabled() bool {
+	c := config.GetConfig().Options.AuditLog
+	return c.Enabled || c.Path != ""
+}
+
+// writeAuditEvent returns the written event with its time, nil when the audit log is not configured
+func writeAuditEvent(ctx context.Context, event AuditEvent) *AuditEvent {
+	if !auditEnabled() {
+		return nil
+	}
+	event.Time = time.Now().UTC()
+	b, err := json.Marshal(event)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "marshalling audit event failed", "persistentId", event.PersistentId, "error", err)
+		return nil
+	}
+	if _, err = config.GetRedis().RPush(ctx, auditLogKey, string(b)); err != nil {
+		logging.Logger.ErrorContext(ctx, "storing audit event failed", "persistentId", event.PersistentId, "error", err)
+	}
+	path := config.GetConfig().Options.AuditLog.Path
+	if path == "" {
+		return &event
+	}
+	auditMutex.Lock()
+	defer auditMutex.Unlock()
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "opening audit log failed", "persistentId", event.PersistentId, "error", err)
+		return &event
+	}
+	defer f.Close()
+	_, err = f.Write(append(b, '\n'))
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "writing audit event failed", "persistentId", event.PersistentId, "error", err)
+	}
+	return &event
+}
+
+// auditJob returns the written event, nil when the job is not audited
+func auditJob(job Job) *AuditEvent {
+	if job.Plugin == "hash-only" || job.Plugin == fixityPlugin {
+		return nil
+	}
+	status := "completed"
+	if len(notProcessed(job)) > 0 {
+		status = "failed"
+	}
+	action := auditStore
+	switch job.Plugin {
+	case bagPlugin:
+		action = auditBagExport
+	case exportPlugin:
+		action = auditExport
+	}
+	p := job.StreamParams
+	return writeAuditEvent(logging.WithCorrelationId(context.Background(), job.CorrelationId), AuditEvent{
+		Action:        action,
+		User:          job.User,
+		Orcid:         job.Orcid.Id,
+		PersistentId:  job.PersistentId,
+		Plugin:        job.Plugin,
+		PluginId:      p.PluginId,
+		RepoName:      p.RepoName,
+		Url:           p.Url,
+		Option:        p.Option,
+		Status:        status,
+		Started:       job.Report.Started,
+		Files:         job.Report.Files,
+		CorrelationId: job.CorrelationId,
+	})
+}
+
+func AuditDatasetCreated(ctx context.Context, user, collection, persistentId string) {
+	orcid, _ := GetOrcid(ctx, user)
+	writeAuditEvent(ctx, AuditEvent{
+		Action:        auditCreateDataset,
+		User:          user,
+		Orcid:         orcid.Id,
+		PersistentId:  persistentId,
+		Collection:    collection,
+		CorrelationId: logging.CorrelationId(ctx),
+	})
+}
+
+// GetAuditEvents reads the audit log of all instances from the backend, oldest first; the malformed events are skipped
+func GetAuditEvents(ctx context.Context, q AuditQuery) ([]AuditEvent, error) {
+	if !auditEnabled() {
+		return nil, fmt.Errorf("audit log is not configured")
+	}
+	stored, err := config.GetRedis().LRange(ctx, auditLogKey, 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	res := []AuditEvent{}
+	for i, v := range stored {
+		event := AuditEvent{}
+		if err := json.Unmarshal([]byte(v), &event); err != nil {
+			logging.Logger.WarnContext(ctx, "skipping malformed audit event", "index", i, "error", err)
+			continue
+		}
+		if q.PersistentId != "" && event.PersistentId != q.PersistentId ||
+			q.User != "" && event.User != q.User ||
+			!q.Since.IsZero() && event.Time.Before(q.Since) ||
+			!q.Until.IsZero() && !event.Time.Before(q.Until) {
+			continue
+		}
+		res = append(res, event)
+	}
+	return res, nil
+}
+
+// csvCell neutralises the values that the spreadsheet applications would run as a formula (e.g., a file named "=HYPERLINK(...)")
+func csvCell(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// csvWriter escapes the cells of all rows with csvCell
+type csvWriter struct {
+	*csv.Writer
+}
+
+func (c csvWriter) Write(row []string) error {
+	escaped := make([]string, len(row))
+	for i, v := range row {
+		escaped[i] = csvCell(v)
+	}
+	return c.Writer.Write(escaped)
+}
+
+// WriteAuditCsv writes the events with one row per file (one row without file columns for the events without files)
+func WriteAuditCsv(w io.Writer, events []AuditEvent) error {
+	c := csvWriter{csv.NewWriter(w)}
+	c.Write([]string{"time", "action", "user", "orcid", "persistentId", "collection", "plugin", "pluginId", "repoName", "url", "option", "status", "file", "result", "hashType", "hash", "size", "correlationId"})
+	for _, e := range events {
+		row := []string{e.Time.Format(time.RFC3339), e.Action, e.User, e.Orcid, e.PersistentId, e.Collection, e.Plugin, e.PluginId, e.RepoName, e.Url, e.Option, e.Status}
+		if len(e.Files) == 0 {
+			c.Write(append(row, "", "", "", "", "", e.CorrelationId))
+			continue
+		}
+		ids := []string{}
+		for id := range e.Files {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			f := e.Files[id]
+			c.Write(append(append([]string{}, row...), id, f.Result, f.HashType, f.Hash, strconv.FormatInt(f.Size, 10), e.CorrelationId))
+		}
+	}
+	c.Flush()
+	return c.Error()
+}
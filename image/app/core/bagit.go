@@ -0,0 +1,273 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/storage"
+	"integration/app/tree"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const bagPlugin = "bagit"
+
+// BagReport is the state of the last (or running) bag export job of a dataset
+type BagReport struct {
+	PersistentId string    `json:"persistentId"`
+	Version      string    `json:"version"`
+	Started      time.Time `json:"started"`
+	Finished     time.Time `json:"finished,omitempty"`
+	Files        int       `json:"files"`
+	Bytes        int64     `json:"bytes"`
+	Location     string    `json:"location,omitempty"` // key of the bag in the export storage
+	Error        string    `json:"error,omitempty"`
+}
+
+func bagReportKey(persistentId string) string {
+	return "bag: " + persistentId
+}
+
+func bagExportConfig() config.BagExport {
+	res := config.GetConfig().Options.BagExport
+	if res.Prefix == "" {
+		res.Prefix = "bags/"
+	}
+	return res
+}
+
+func BagExportEnabled() bool {
+	return config.GetConfig().Options.BagExport.Storage.Type != ""
+}
+
+// BagName is the name of the bag (the top folder of the serialized bag), e.g., "doi-10.5072-FK2-ABCDEF" for doi:10.5072/FK2/ABCDEF
+func BagName(persistentId string) string {
+	return strings.NewReplacer(":", "-", "/", "-").Replace(persistentId)
+}
+
+// DatasetFiles returns the files of the dataset version, only the selected files (by their path in the dataset) when the selection is not empty
+func DatasetFiles(ctx context.Context, dataverseKey, user, persistentId, version string, selection []string) (map[string]tree.Node, error) {
+	if version == "" {
+		version = LatestVersion
+	}
+	nodes, err := Destination.Query(ctx, persistentId, version, dataverseKey, user)
+	if err != nil {
+		return nil, err
+	}
+	if len(selection) == 0 {
+		return nodes, nil
+	}
+	res := map[string]tree.Node{}
+	for _, id := range selection {
+		v, ok := nodes[id]
+		if !ok {
+			return nil, fmt.Errorf("file %v is not in version %v of dataset %v", id, version, persistentId)
+		}
+		res[id] = v
+	}
+	return res, nil
+}
+
+// AddBagExportJob schedules the export of the dataset version (or of the selected files) as a bag written to the export storage
+func AddBagExportJob(ctx context.Context, dataverseKey, user, persistentId, version string, selection []string) error {
+	if !BagExportEnabled() {
+		return fmt.Errorf("bag export storage is not configured, the bags can only be downloaded")
+	}
+	nodes, err := DatasetFiles(ctx, dataverseKey, user, persistentId, version, selection)
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("dataset %v has no files to export", persistentId)
+	}
+	if IsLocked(ctx, persistentId) {
+		return fmt.Errorf("%w: a job for this dataset is already in progress", ErrDatasetLocked)
+	}
+	if version == "" {
+		version = LatestVersion
+	}
+	storeBagReport(ctx, BagReport{PersistentId: persistentId, Version: version, Started: time.Now()})
+	return AddJob(ctx, Job{
+		DataverseKey:  dataverseKey,
+		User:          user,
+		PersistentId:  persistentId,
+		WritableNodes: nodes,
+		Plugin:        bagPlugin,
+	})
+}
+
+// doBagExport streams the bag to the export storage, the bag is written as a whole: a failed job writes it again
+func doBagExport(ctx context.Context, in Job) (out Job, err error) {
+	out = in
+	err = Destination.CheckPermission(ctx, in.DataverseKey, in.User, in.PersistentId)
+	if err != nil {
+		return
+	}
+	report, _ := GetBagReport(ctx, in.PersistentId)
+	report.PersistentId, report.Error = in.PersistentId, ""
+	if report.Version == "" {
+		report.Version = LatestVersion
+	}
+	defer func() {
+		if err != nil {
+			report.Error = err.Error()
+		}
+		storeBagReport(ctx, report)
+	}()
+	c := bagExportConfig()
+	st, err := storage.New(c.Storage, c.Bucket)
+	if err != nil {
+		return
+	}
+	key := fmt.Sprintf("%s%s/%s.zip", c.Prefix, BagName(in.PersistentId), time.Now().UTC().Format("20060102T150405Z"))
+	pr, pw := io.Pipe()
+	written := make(chan error, 1)
+	go func() {
+		files, size, err := WriteBag(ctx, pw, in.DataverseKey, in.User, in.PersistentId, report.Version, in.WritableNodes)
+		report.Files, report.Bytes = files, size
+		pw.CloseWithError(err)
+		written <- err
+	}()
+	err = st.Create(ctx, key, pr, -1)
+	pr.CloseWithError(err)
+	if bagErr := <-written; err == nil {
+		err = bagErr
+	}
+	if err != nil {
+		return
+	}
+	report.Location, report.Finished = key, time.Now()
+	for k := range in.WritableNodes {
+		delete(out.WritableNodes, k)
+	}
+	logging.Logger.InfoContext(ctx, "bag exported", "persistentId", in.PersistentId, "location", key, "files", report.Files, "bytes", report.Bytes)
+	return
+}
+
+// WriteBag writes the files as a serialized BagIt bag (zip), the files are read as stored and their checksums are verified against
+// the checksums known by Dataverse; the payload manifest uses SHA-256
+func WriteBag(ctx context.Context, w io.Writer, dataverseKey, user, persistentId, version string, nodes map[string]tree.Node) (int, int64, error) {
+	pid, err := trimProtocol(persistentId)
+	if err != nil {
+		return 0, 0, err
+	}
+	ids := []string{}
+	for k, v := range nodes {
+		if v.Attributes.IsFile {
+			ids = append(ids, k)
+		}
+	}
+	sort.Strings(ids)
+	name := BagName(persistentId)
+	zw := zip.NewWriter(w)
+	manifest := bytes.Buffer{}
+	size := int64(0)
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return 0, 0, err
+		}
+		n, sum, err := addBagFile(ctx, zw, name, dataverseKey, user, pid, nodes[id])
+		if err != nil {
+			return 0, 0, fmt.Errorf("adding %v to the bag failed: %v", id, err)
+		}
+		size += n
+		fmt.Fprintf(&manifest, "%s  %s\n", sum, bagPath("data/"+id))
+	}
+	bagInfo := bytes.Buffer{}
+	fmt.Fprintf(&bagInfo, "External-Identifier: %s\n", persistentId)
+	fmt.Fprintf(&bagInfo, "External-Description: files of version %s of dataset %s (%s)\n", version, persistentId, Destination.GetRepoUrl(ctx, persistentId, false))
+	fmt.Fprintf(&bagInfo, "Bagging-Date: %s\n", time.Now().Format(time.DateOnly))
+	fmt.Fprintf(&bagInfo, "Payload-Oxum: %d.%d\n", size, len(ids))
+	fmt.Fprintf(&bagInfo, "Bag-Software-Agent: rdm-integration\n")
+	tagFiles := []struct {
+		name    string
+		content []byte
+	}{
+		{"bagit.txt", []byte("BagIt-Version: 1.0\nTag-File-Character-Encoding: UTF-8\n")},
+		{"bag-info.txt", bagInfo.Bytes()},
+		{"manifest-sha256.txt", manifest.Bytes()},
+	}
+	tagManifest := bytes.Buffer{}
+	for _, t := range tagFiles {
+		if err := addBagEntry(zw, name+"/"+t.name, bytes.NewReader(t.content)); err != nil {
+			return 0, 0, err
+		}
+		fmt.Fprintf(&tagManifest, "%x  %s\n", sha256.Sum256(t.content), t.name)
+	}
+	if err := addBagEntry(zw, name+"/tagmanifest-sha256.txt", &tagManifest); err != nil {
+		return 0, 0, err
+	}
+	return len(ids), size, zw.Close()
+}
+
+func addBagFile(ctx context.Context, zw *zip.Writer, name, dataverseKey, user, pid string, node tree.Node) (int64, string, error) {
+	reader, err := openDatasetFile(ctx, dataverseKey, user, pid, node.Attributes.DestinationFile.StorageIdentifier, node.Attributes.DestinationFile.Id)
+	if err != nil {
+		return 0, "", err
+	}
+	defer reader.Close()
+	sha := sha256.New()
+	sizeHasher := &FileSizeHash{}
+	var source io.Reader = hashingReader{hashingReader{reader, sha}, sizeHasher}
+	expected := node.Attributes.DestinationFile
+	var verify hash.Hash
+	if expected.Hash != "" {
+		hasher, err := getHash(expected.HashType, expected.Filesize)
+		if err != nil {
+			return 0, "", err
+		}
+		defer closeHash(hasher)
+		source, verify = hashingReader{source, hasher}, hasher
+	}
+	if err := addBagEntry(zw, name+"/data/"+node.Id, source); err != nil {
+		return 0, "", err
+	}
+	if verify != nil && fmt.Sprintf("%x", verify.Sum(nil)) != expected.Hash {
+		return 0, "", fmt.Errorf("%v checksum does not match the checksum in Dataverse", expected.HashType)
+	}
+	return sizeHasher.FileSize, fmt.Sprintf("%x", sha.Sum(nil)), nil
+}
+
+func addBagEntry(zw *zip.Writer, name string, content io.Reader) error {
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	return err
+}
+
+// bagPath encodes the characters that can not be used in the file paths of the manifests (BagIt 1.0, section 2.1.3)
+func bagPath(path string) string {
+	return strings.NewReplacer("%", "%25", "\n", "%0A", "\r", "%0D").Replace(path)
+}
+
+func storeBagReport(ctx context.Context, report BagReport) {
+	b, err := json.Marshal(report)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "marshalling bag report failed", "persistentId", report.PersistentId, "error", err)
+		return
+	}
+	config.GetRedis().Set(ctx, bagReportKey(report.PersistentId), string(b), config.LockMaxDuration)
+}
+
+// GetBagReport returns the report of the last (or running) bag export job of the dataset
+func GetBagReport(ctx context.Context, persistentId string) (BagReport, bool) {
+	res := BagReport{}
+	cached, _ := config.GetRedis().Get(ctx, bagReportKey(persistentId))
+	if cached == "" {
+		return res, false
+	}
+	err := json.Unmarshal([]byte(cached), &res)
+	return res, err == nil
+}
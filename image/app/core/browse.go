@@ -0,0 +1,37 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+// DatasetQuery selects a page of the datasets of the user, for the dataset picker of the frontend
+type DatasetQuery struct {
+	SearchTerm string `json:"searchTerm,omitempty"`
+	Collection string `json:"collection,omitempty"` // alias of the collection, all collections when empty
+	Editable   bool   `json:"editable,omitempty"`   // only the datasets where the user has one of the myDataRoleIds roles, otherwise any role
+	Page       int    `json:"page,omitempty"`       // starts at 1, the first page when not set
+}
+
+type DatasetItem struct {
+	PersistentId   string   `json:"persistentId"`
+	Title          string   `json:"title"`
+	Collection     string   `json:"collection,omitempty"` // alias of the collection of the dataset
+	CollectionName string   `json:"collectionName,omitempty"`
+	VersionState   string   `json:"versionState,omitempty"` // e.g., "DRAFT" or "RELEASED"
+	UpdatedAt      string   `json:"updatedAt,omitempty"`
+	Roles          []string `json:"roles,omitempty"` // roles of the user on the dataset
+	Url            string   `json:"url"`             // link to the page of the dataset
+}
+
+type DatasetPage struct {
+	Items       []DatasetItem `json:"items"`
+	Page        int           `json:"page"`
+	HasNextPage bool          `json:"hasNextPage"`
+	Total       int           `json:"total"`
+}
+
+// CollectionItem is a child of a collection: a subcollection, identified by its database id (usable as the collection of the next
+// call), or a dataset, identified by its persistent identifier
+type CollectionItem struct {
+	Type  string `json:"type"` // "collection" or "dataset"
+	Id    string `json:"id"`
+	Title string `json:"title,omitempty"` // only known for the collections
+}
@@ -0,0 +1,266 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	BundleZip          = "zip"
+	BundleTar          = "tar"
+	bundleManifestName = ".bundle-manifest.json"
+)
+
+// Bundle is a folder written as a single archive file in the dataset, the members are streamed from the repository into the archive
+type Bundle struct {
+	Folder  string
+	Format  string
+	Members map[string]tree.Node
+}
+
+// BundleManifest is the last entry of the archive, listing the members with the checksums calculated while they were written
+type BundleManifest struct {
+	Folder  string           `json:"folder"`
+	Created time.Time        `json:"created"`
+	Files   []BundleFileInfo `json:"files"`
+}
+
+type BundleFileInfo struct {
+	Path     string `json:"path"` // relative to the folder
+	Size     int64  `json:"size"`
+	HashType string `json:"hashType"`
+	Hash     string `json:"hash"`
+}
+
+// BundleNodes replaces the selected files (to copy or to update) in the folders by one archive file per folder,
+// e.g., "data/raw" becomes "data/raw.zip"; the zip files are written double-zipped by Dataverse, so that they are not unpacked
+func BundleNodes(selected map[string]tree.Node, folders []string, format string) (map[string]tree.Node, map[string]Bundle, error) {
+	if format == "" {
+		format = BundleZip
+	}
+	if format != BundleZip && format != BundleTar {
+		return nil, nil, fmt.Errorf("unsupported bundle format: %v", format)
+	}
+	res := map[string]tree.Node{}
+	for k, v := range selected {
+		res[k] = v
+	}
+	bundles := map[string]Bundle{}
+	for _, folder := range folders {
+		folder = strings.Trim(folder, "/")
+		if folder == "" {
+			return nil, nil, fmt.Errorf("the root folder can not be bundled")
+		}
+		members := map[string]tree.Node{}
+		for k, v := range res {
+			if v.Attributes.IsFile && (v.Action == tree.Copy || v.Action == tree.Update) && strings.HasPrefix(k, folder+"/") {
+				members[k] = v
+				delete(res, k)
+			}
+		}
+		if len(members) == 0 {
+			continue
+		}
+		id := folder + "." + format
+		if _, ok := res[id]; ok {
+			return nil, nil, fmt.Errorf("bundle %v collides with a selected file", id)
+		}
+		name := id[strings.LastIndex(id, "/")+1:]
+		res[id] = tree.Node{
+			Id:     id,
+			Name:   name,
+			Path:   strings.TrimSuffix(strings.TrimSuffix(id, name), "/"),
+			Action: tree.Copy,
+			Attributes: tree.Attributes{
+				IsFile:         true,
+				RemoteHash:     types.NotNeeded, // the archive is created during the job, there is nothing to verify against
+				RemoteHashType: types.Md5,
+			},
+		}
+		bundles[id] = Bundle{Folder: folder, Format: format, Members: members}
+	}
+	return res, bundles, nil
+}
+
+// streamedNodes are the nodes the plugin streams: the members of the bundles instead of the archives
+func streamedNodes(job Job) map[string]tree.Node {
+	if len(job.Bundles) == 0 {
+		return job.WritableNodes
+	}
+	res := map[string]tree.Node{}
+	for k, v := range job.WritableNodes {
+		b, ok := job.Bundles[k]
+		if !ok {
+			res[k] = v
+			continue
+		}
+		for mk, mv := range b.Members {
+			res[mk] = mv
+		}
+	}
+	return res
+}
+
+// bundleStreams adds the streams of the archives: the members are taken from the streams of the plugin
+func bundleStreams(streams map[string]types.Stream, bundles map[string]Bundle) {
+	for id, b := range bundles {
+		streams[id] = bundleStream(b, streams)
+	}
+}
+
+func bundleStream(b Bundle, streams map[string]types.Stream) types.Stream {
+	var pr *io.PipeReader
+	var done chan struct{}
+	return types.Stream{
+		Open: func(ctx context.Context) (io.Reader, error) {
+			var pw *io.PipeWriter
+			pr, pw = io.Pipe()
+			done = make(chan struct{})
+			go func() {
+				defer close(done)
+				pw.CloseWithError(writeBundle(ctx, b, streams, pw))
+			}()
+			return pr, nil
+		},
+		Close: func() error {
+			if pr == nil {
+				return nil
+			}
+			pr.Close()
+			<-done
+			return nil
+		},
+	}
+}
+
+func writeBundle(ctx context.Context, b Bundle, streams map[string]types.Stream, w io.Writer) error {
+	ids := []string{}
+	for k := range b.Members {
+		ids = append(ids, k)
+	}
+	sort.Strings(ids)
+	archive := newArchiveWriter(b.Format, w)
+	manifest := BundleManifest{Folder: b.Folder, Created: time.Now()}
+	hashType := config.GetConfig().Options.DefaultHash
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		s, ok := streams[id]
+		if !ok {
+			return fmt.Errorf("no stream for %v", id)
+		}
+		path := strings.TrimPrefix(id, b.Folder+"/")
+		info, err := addToArchive(ctx, archive, path, s, hashType)
+		if err != nil {
+			return fmt.Errorf("bundling %v failed: %v", id, err)
+		}
+		manifest.Files = append(manifest.Files, info)
+	}
+	m, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := archive.add(bundleManifestName, int64(len(m)), strings.NewReader(string(m))); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+func addToArchive(ctx context.Context, archive archiveWriter, path string, s types.Stream, hashType string) (BundleFileInfo, error) {
+	res := BundleFileInfo{Path: path, HashType: hashType}
+	hasher, err := getHash(hashType, 0)
+	if err != nil {
+		return res, err
+	}
+	defer closeHash(hasher)
+	reader, err := s.Open(ctx)
+	if err != nil {
+		return res, err
+	}
+	defer s.Close()
+	sizeHasher := &FileSizeHash{}
+	var content io.Reader = hashingReader{hashingReader{reader, hasher}, sizeHasher}
+	size := int64(-1)
+	if archive.needsSize() {
+		// the tar header needs the size before the content: the file is spooled first
+		tmp, err := os.CreateTemp("", "bundle-*")
+		if err != nil {
+			return res, err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if size, err = io.Copy(tmp, content); err != nil {
+			return res, err
+		}
+		if _, err = tmp.Seek(0, io.SeekStart); err != nil {
+			return res, err
+		}
+		content = tmp
+	}
+	if err := archive.add(path, size, content); err != nil {
+		return res, err
+	}
+	res.Size, res.Hash = sizeHasher.FileSize, fmt.Sprintf("%x", hasher.Sum(nil))
+	return res, nil
+}
+
+type archiveWriter interface {
+	add(name string, size int64, content io.Reader) error
+	needsSize() bool
+	Close() error
+}
+
+func newArchiveWriter(format string, w io.Writer) archiveWriter {
+	if format == BundleTar {
+		return tarArchive{tar.NewWriter(w)}
+	}
+	return zipArchive{zip.NewWriter(w)}
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (z zipArchive) add(name string, _ int64, content io.Reader) error {
+	f, err := z.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, content)
+	return err
+}
+
+func (z zipArchive) needsSize() bool {
+	return false
+}
+
+type tarArchive struct {
+	*tar.Writer
+}
+
+func (t tarArchive) add(name string, size int64, content io.Reader) error {
+	err := t.WriteHeader(&tar.Header{Name: name, Size: size, Mode: 0644, ModTime: time.Now(), Typeflag: tar.TypeReg})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(t, content)
+	return err
+}
+
+func (t tarArchive) needsSize() bool {
+	return true
+}
@@ -0,0 +1,46 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"integration/app/config"
+	"strings"
+)
+
+// the first bytes of a gzip stream, a JSON value never starts with them
+const gzipMagic = "\x1f\x8b"
+
+// EncodeCached encodes the large cached values (the compare responses, the selections and the pre-warmed results) for Redis: JSON
+// compressed with gzip, or plain JSON when the cachedResponseEncoding option is "json". The JSON is encoded as a stream into the
+// compressor, the uncompressed JSON of a large repository is never held in memory.
+func EncodeCached(v interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	if config.GetConfig().Options.CachedResponseEncoding == "json" {
+		err := json.NewEncoder(buf).Encode(v)
+		return buf.String(), err
+	}
+	gz, _ := gzip.NewWriterLevel(buf, gzip.BestSpeed)
+	if err := json.NewEncoder(gz).Encode(v); err != nil {
+		return "", err
+	}
+	if err := gz.Close(); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// DecodeCached decodes a value of EncodeCached, in either encoding (e.g., stored before the option was changed)
+func DecodeCached(cached string, v interface{}) error {
+	if !strings.HasPrefix(cached, gzipMagic) {
+		return json.Unmarshal([]byte(cached), v)
+	}
+	gz, err := gzip.NewReader(strings.NewReader(cached))
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	return json.NewDecoder(gz).Decode(v)
+}
@@ -0,0 +1,201 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"time"
+)
+
+const (
+	compareQueue          = "compare queue"
+	runningComparesKey    = "running compares"
+	defaultCompareTimeout = 2 * time.Hour
+	// a compare that stopped its replica that many times (e.g., running out of memory) is not re-queued again
+	maxCompareAttempts = 3
+)
+
+// CompareJob is a compare, run at once by the handler or queued as a background job, stored with references to the credentials of
+// the user while it waits or runs; the result is cached under the key
+type CompareJob struct {
+	Key           string               `json:"key"`
+	User          string               `json:"user"`
+	Request       types.CompareRequest `json:"request"`
+	CorrelationId string               `json:"correlationId,omitempty"`
+	Target        string               `json:"target,omitempty"` // the Dataverse target of the request (see the dataverseTargets option)
+	Queued        time.Time            `json:"queued"`
+	Attempts      int                  `json:"attempts,omitempty"`
+}
+
+func runningCompareKey(key string) string {
+	return "running compare: " + key
+}
+
+func compareLeaseKey(key string) string {
+	return "compare lease: " + key
+}
+
+// CompareTimeout is the time a compare can take, see the compare option
+func CompareTimeout() time.Duration {
+	if s := config.GetConfig().Options.Compare.Timeout; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultCompareTimeout
+}
+
+// marshalCompareJob serializes the compare with references to the credentials, as the store jobs (see marshalJob)
+func marshalCompareJob(job CompareJob) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	var err error
+	for _, secret := range []*string{&job.Request.DataverseKey, &job.Request.Token} {
+		*secret, err = CredentialRef(ctx, *secret)
+		if err != nil {
+			return "", err
+		}
+	}
+	b, err := json.Marshal(job)
+	return string(b), err
+}
+
+func unmarshalCompareJob(s string) (CompareJob, error) {
+	job := CompareJob{}
+	err := json.Unmarshal([]byte(s), &job)
+	if err != nil {
+		return job, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	for _, secret := range []*string{&job.Request.DataverseKey, &job.Request.Token} {
+		*secret = resolveCredential(ctx, *secret)
+	}
+	return job, nil
+}
+
+// QueueCompare adds the compare to the queue of the background compares, run by the instances of the HTTP server (see PopCompare);
+// the compares run at once by the handler are also queued when their instance stops before they finish (see StartCompareLease)
+func QueueCompare(ctx context.Context, job CompareJob) error {
+	if job.CorrelationId == "" {
+		job.CorrelationId = logging.CorrelationId(ctx)
+	}
+	if job.Queued.IsZero() {
+		job.Queued = time.Now()
+	}
+	s, err := marshalCompareJob(job)
+	if err != nil {
+		return err
+	}
+	_, err = config.GetRedis().LPush(ctx, compareQueue, s)
+	return err
+}
+
+// PopCompare takes the next queued compare, StartCompareLease must be called before it is run
+func PopCompare(ctx context.Context) (CompareJob, bool) {
+	popped, err := config.GetRedis().RPop(ctx, compareQueue)
+	if err != nil {
+		return CompareJob{}, false
+	}
+	job, err := unmarshalCompareJob(popped)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "failed to unmarshall a queued compare", "error", err)
+		return job, false
+	}
+	return job, true
+}
+
+// StartCompareLease keeps a copy of the running compare (re-queued by ReclaimOrphanedCompares when the instance stops, e.g., on
+// a pod restart) and renews the lease until the returned function is called with the compare finished; when it is called with
+// finished set to false (the compare was interrupted by the shutdown), the copy is kept and the compare is re-queued once the lease expired
+func StartCompareLease(job CompareJob) func(finished bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	job.Attempts++
+	s, err := marshalCompareJob(job)
+	if err != nil {
+		logging.Logger.Error("marshalling running compare failed", "key", job.Key, "error", err)
+		return func(bool) {}
+	}
+	config.GetRedis().Set(ctx, runningCompareKey(job.Key), s, CompareTimeout()+leaseDuration())
+	config.GetRedis().Set(ctx, compareLeaseKey(job.Key), workerId, leaseDuration())
+	config.GetRedis().SAdd(ctx, runningComparesKey, job.Key)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockHeartbeat())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), lockHeartbeat())
+				ok, err := config.GetRedis().RenewLease(ctx, compareLeaseKey(job.Key), workerId, leaseDuration())
+				cancel()
+				if !ok && err == nil {
+					// re-queued by another instance: that instance caches the result
+					logging.Logger.Warn("compare lease lost", "key", job.Key)
+					return
+				}
+			}
+		}
+	}()
+	return func(finished bool) {
+		close(done)
+		if !finished {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+		defer cancel()
+		if released, err := config.GetRedis().ReleaseLease(ctx, compareLeaseKey(job.Key), workerId); err == nil && !released {
+			return
+		}
+		config.GetRedis().Del(ctx, runningCompareKey(job.Key))
+		config.GetRedis().SRem(ctx, runningComparesKey, job.Key)
+	}
+}
+
+// ReclaimOrphanedCompares re-queues the running compares whose instance stopped renewing the lease, the compares that are not
+// re-queued (interrupted too many times, or without a readable copy) are returned: their result must be cached as failed, so that
+// the polling clients get an answer
+func ReclaimOrphanedCompares() []CompareJob {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	running, err := config.GetRedis().SMembers(ctx, runningComparesKey)
+	if err != nil {
+		return nil
+	}
+	failed := []CompareJob{}
+	for _, key := range running {
+		if lease, _ := config.GetRedis().Get(ctx, compareLeaseKey(key)); lease != "" {
+			continue
+		}
+		// only one instance reclaims the compare
+		if ok, _ := config.GetRedis().SetNX(ctx, "reclaim compare: "+key, workerId, leaseDuration()); !ok {
+			continue
+		}
+		cached, _ := config.GetRedis().Get(ctx, runningCompareKey(key))
+		config.GetRedis().Del(ctx, runningCompareKey(key))
+		config.GetRedis().SRem(ctx, runningComparesKey, key)
+		job, err := unmarshalCompareJob(cached)
+		if cached == "" || err != nil {
+			logging.Logger.Warn("dropping orphaned compare", "key", key)
+			failed = append(failed, CompareJob{Key: key})
+			continue
+		}
+		logCtx := logging.WithCorrelationId(ctx, job.CorrelationId)
+		if job.Attempts >= maxCompareAttempts {
+			logging.Logger.ErrorContext(logCtx, "orphaned compare was interrupted too many times, not re-queued", "key", key, "attempts", job.Attempts)
+			failed = append(failed, job)
+			continue
+		}
+		logging.Logger.WarnContext(logCtx, "lease expired, re-queuing the orphaned compare", "key", key)
+		if err := QueueCompare(ctx, job); err != nil {
+			logging.Logger.ErrorContext(logCtx, "re-queuing orphaned compare failed", "key", key, "error", err)
+			failed = append(failed, job)
+		}
+	}
+	return failed
+}
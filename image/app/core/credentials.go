@@ -0,0 +1,139 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"strings"
+	"time"
+)
+
+// credentialRefPrefix marks the references to the credentials stored on the server (see CredentialRef)
+const credentialRefPrefix = "cref_"
+
+// CredentialKey is the Redis key of the stored credential, listed in the user data so that the user can revoke it
+func CredentialKey(ref string) string {
+	return "credential: " + ref
+}
+
+// CredentialExpiration is how long a stored credential can be used: as long as a job can run, the expiration is renewed each time
+// the credential is stored again (e.g., when a job is re-queued)
+func CredentialExpiration() time.Duration {
+	return config.LockMaxDuration
+}
+
+func IsCredentialRef(value string) bool {
+	return strings.HasPrefix(value, credentialRefPrefix)
+}
+
+// CredentialRef stores the secret (a Dataverse API key or a repository token, encrypted when the token encryption key is
+// configured) and returns an opaque reference to it: the jobs and the queued compares hold the references instead of the secrets,
+// and the clients can send the reference instead of the Dataverse API key. The same secret gives the same reference.
+func CredentialRef(ctx context.Context, secret string) (string, error) {
+	if secret == "" {
+		return secret, nil
+	}
+	if IsCredentialRef(secret) {
+		// e.g., sent by the client: kept as long as the job using it
+		config.GetRedis().Expire(ctx, CredentialKey(secret), CredentialExpiration())
+		return secret, nil
+	}
+	h := sha256.Sum256([]byte(secret))
+	ref := credentialRefPrefix + hex.EncodeToString(h[:16])
+	stored, err := encryptSecret(secret, CredentialKey(ref))
+	if err != nil {
+		return "", err
+	}
+	err = config.GetRedis().Set(ctx, CredentialKey(ref), stored, CredentialExpiration())
+	if err != nil {
+		return "", err
+	}
+	return ref, nil
+}
+
+// ResolveCredential returns the secret of the reference, other values are returned as they are (decrypted when they were stored
+// encrypted, e.g., in a job queued before the references were used)
+func ResolveCredential(ctx context.Context, value string) (string, error) {
+	if !IsCredentialRef(value) {
+		return decryptSecret(value, "")
+	}
+	stored, _ := config.GetRedis().Get(ctx, CredentialKey(value))
+	if stored == "" {
+		return "", fmt.Errorf("%w: the credential reference is expired or unknown", ErrPermissionDenied)
+	}
+	return decryptSecret(stored, CredentialKey(value))
+}
+
+// resolveCredential is ResolveCredential for the stored jobs: a reference that can not be resolved is kept, the calls made with
+// it fail as unauthorized
+func resolveCredential(ctx context.Context, value string) string {
+	res, err := ResolveCredential(ctx, value)
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "resolving credential failed", "error", err)
+		return value
+	}
+	return res
+}
+
+// provisionedCredentialKey is per Dataverse target, as the users of the targets are not the same
+func provisionedCredentialKey(ctx context.Context, user string) string {
+	if target := config.TargetName(ctx); target != "" {
+		return "provisioned credential: " + target + ": " + user
+	}
+	return "provisioned credential: " + user
+}
+
+// ProvisionedCredential returns the reference to the Dataverse API token of the user, created with the native users API when there
+// is no valid token stored for the user yet (or when recreate is set): the token is kept per user and not per session, as each
+// creation replaces the previous token of the user in Dataverse (also used by the other sessions and jobs of the user)
+func ProvisionedCredential(ctx context.Context, user string, recreate bool) (string, error) {
+	previous, _ := config.GetRedis().Get(ctx, provisionedCredentialKey(ctx, user))
+	if previous != "" && !recreate {
+		if token, err := ResolveCredential(ctx, previous); err == nil {
+			// checked with the token itself, without the user the request is not signed
+			if _, err = Destination.GetUserEmail(ctx, token, ""); err == nil {
+				// the reference is kept as long as it is used
+				config.GetRedis().Expire(ctx, provisionedCredentialKey(ctx, user), CredentialExpiration())
+				return CredentialRef(ctx, token)
+			}
+		}
+	}
+	// only one token is created at a time, the concurrent calls wait for it
+	lockKey := provisionedCredentialKey(ctx, user) + " lock"
+	for i := 0; ; i++ {
+		if ok, _ := config.GetRedis().SetNX(ctx, lockKey, workerId, time.Minute); ok {
+			break
+		}
+		if i == 60 {
+			return "", fmt.Errorf("waiting for the creation of the API token timed out")
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+		}
+		if ref, _ := config.GetRedis().Get(ctx, provisionedCredentialKey(ctx, user)); ref != "" && ref != previous {
+			return ref, nil
+		}
+	}
+	defer config.GetRedis().Del(ctx, lockKey)
+	token, err := Destination.CreateApiToken(ctx, user)
+	if err != nil {
+		return "", err
+	}
+	ref, err := CredentialRef(ctx, token)
+	if err != nil {
+		return "", err
+	}
+	err = config.GetRedis().Set(ctx, provisionedCredentialKey(ctx, user), ref, CredentialExpiration())
+	if err != nil {
+		return "", err
+	}
+	logging.Logger.InfoContext(ctx, "API token of the user created", "user", user)
+	return ref, nil
+}
@@ -7,22 +7,36 @@ import (
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
-	"sync"
 )
 
 var Destination DestinationPlugin
 
 type DestinationPlugin struct {
-	IsDirectUpload        func() bool
+	IsDirectUpload        func(ctx context.Context) bool
+	IsSignedUrlUpload     func() bool
+	UploadToSignedUrls    func(ctx context.Context, token, user, persistentId string, size int64, reader io.Reader) (string, error)
 	CheckPermission       func(ctx context.Context, token, user, persistentId string) error
-	CreateNewRepo         func(ctx context.Context, collection, token, userName string) (string, error)
-	GetRepoUrl            func(pid string, draft bool) string
-	WriteOverWire         func(ctx context.Context, dbId int64, nodeMapId, token, user, persistentId string, wg *sync.WaitGroup, async_err *ErrorHolder) (io.WriteCloser, error)
+	CreateNewRepo         func(ctx context.Context, collection, token, userName string, metadata DatasetMetadata) (string, error)
+	GetRepoUrl            func(ctx context.Context, pid string, draft bool) string
+	WriteOverWire         func(ctx context.Context, dbId int64, nodeMapId, description, token, user, persistentId string, group *ErrGroup) (io.WriteCloser, error)
 	SaveAfterDirectUpload func(ctx context.Context, replace bool, token, user, persistentId string, storageIdentifiers []string, nodes []tree.Node) error
-	CleanupLeftOverFiles  func(ctx context.Context, persistentId, token, user string) error
+	CleanupLeftOverFiles  func(ctx context.Context, persistentId, token, user string, dryRun bool) ([]string, error)
 	DeleteFile            func(ctx context.Context, token, user string, id int64) error
 	Options               func(ctx context.Context, objectType, collection, searchTerm, token, user string) ([]types.SelectItem, error)
 	GetStream             func(ctx context.Context, token, user string, id int64) (io.ReadCloser, error)
-	Query                 func(ctx context.Context, persistentId, token, user string) (map[string]tree.Node, error)
+	Query                 func(ctx context.Context, persistentId, version, token, user string) (map[string]tree.Node, error)
 	GetUserEmail          func(ctx context.Context, token, user string) (string, error)
+	Publish               func(ctx context.Context, token, user, persistentId, versionType string) error
+	GetStorageDriver      func(ctx context.Context, token, user, persistentId string) (string, error)
+	StorageIdentifiers    func(ctx context.Context, token, user, persistentId string) ([]string, error)
+	GetCollectionUsage    func(ctx context.Context, token, user, persistentId string) (CollectionUsage, error)
+	GetStorageLimits      func(ctx context.Context, token, user, persistentId string) (StorageLimits, error)
+	GetLastUpdateTime     func(ctx context.Context, token, user, persistentId string) (string, error)
+	IsSuperuser           func(ctx context.Context, token, user string) (bool, error)
+	CreateApiToken        func(ctx context.Context, user string) (string, error)
+	ListDatasets          func(ctx context.Context, token, user string, query DatasetQuery) (DatasetPage, error)
+	CollectionContents    func(ctx context.Context, token, user, collection string) ([]CollectionItem, error)
+	DatasetCollections    func(ctx context.Context, searchTerm, token, user string) ([]types.SelectItem, error)
+	Info                  func(ctx context.Context) DestinationInfo
+	Ping                  func(ctx context.Context) error
 }
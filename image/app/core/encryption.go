@@ -0,0 +1,146 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// the prefix marks the encrypted values, the values without the prefix were stored before the encryption was configured
+const encryptedPrefix = "enc:v2:"
+
+// encryptionKeyInfo separates the keys derived from the secret for the encryption from any other use of the secret
+const encryptionKeyInfo = "rdm-integration token encryption"
+
+// encryptionSecrets returns the "tokenEncryptionKey" secret: a comma separated list where the first key encrypts and all keys
+// decrypt, so that the key can be rotated without losing the stored tokens
+func encryptionSecrets() ([]string, error) {
+	secret, err := config.LookupSecret(config.SecretTokenEncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("the token encryption key could not be fetched: %v", err)
+	}
+	res := []string{}
+	for _, k := range strings.Split(secret, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			res = append(res, k)
+		}
+	}
+	return res, nil
+}
+
+// deriveKey derives the AES-256 key from the secret with HKDF-SHA256
+func deriveKey(secret string) ([]byte, error) {
+	key := make([]byte, 32)
+	_, err := io.ReadFull(hkdf.New(sha256.New, []byte(secret), nil, []byte(encryptionKeyInfo)), key)
+	return key, err
+}
+
+// encryptSecret encrypts the tokens and API keys before they are stored in Redis under the given key (AES-GCM), the key is
+// authenticated with the value so that it can not be moved to another key; the values are stored as they are when no encryption
+// key is configured (see the allowUnencryptedTokens option)
+func encryptSecret(plain, redisKey string) (string, error) {
+	secrets, err := encryptionSecrets()
+	if err != nil {
+		return "", err
+	}
+	if plain == "" || len(secrets) == 0 {
+		return plain, nil
+	}
+	key, err := deriveKey(secrets[0])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := newGcm(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := gcm.Seal(nonce, nonce, []byte(plain), []byte(redisKey))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptSecret decrypts the value read from the given Redis key
+func decryptSecret(stored, redisKey string) (string, error) {
+	encoded, encrypted := strings.CutPrefix(stored, encryptedPrefix)
+	if !encrypted {
+		return stored, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	secrets, err := encryptionSecrets()
+	if err != nil {
+		return "", err
+	}
+	for _, secret := range secrets {
+		key, err := deriveKey(secret)
+		if err != nil {
+			return "", err
+		}
+		gcm, err := newGcm(key)
+		if err != nil {
+			return "", err
+		}
+		if len(sealed) < gcm.NonceSize() {
+			return "", fmt.Errorf("encrypted value is too short")
+		}
+		plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(redisKey))
+		if err == nil {
+			return string(plain), nil
+		}
+	}
+	return "", fmt.Errorf("decrypting failed: no matching token encryption key")
+}
+
+func newGcm(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// marshalJob serializes the job for Redis with references to the Dataverse API key and the repository token instead of the
+// secrets themselves (see CredentialRef)
+func marshalJob(job Job) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	var err error
+	for _, secret := range []*string{&job.DataverseKey, &job.StreamParams.Token, &job.SessionId} {
+		*secret, err = CredentialRef(ctx, *secret)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(job)
+}
+
+func unmarshalJob(b []byte) (Job, error) {
+	job := Job{}
+	err := json.Unmarshal(b, &job)
+	if err != nil {
+		return job, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	for _, secret := range []*string{&job.DataverseKey, &job.StreamParams.Token, &job.SessionId} {
+		*secret = resolveCredential(ctx, *secret)
+	}
+	return job, nil
+}
@@ -0,0 +1,44 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"integration/app/config"
+	"strings"
+	"testing"
+)
+
+func TestEncryptSecret(t *testing.T) {
+	defer config.SetSecret(config.SecretTokenEncryptionKey, "")
+	config.SetSecret(config.SecretTokenEncryptionKey, "first key")
+	stored, err := encryptSecret("token", "session: a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(stored, encryptedPrefix) || strings.Contains(stored, "token") {
+		t.Fatalf("the value is not encrypted: %v", stored)
+	}
+	if plain, err := decryptSecret(stored, "session: a"); err != nil || plain != "token" {
+		t.Errorf("round trip failed: %q, %v", plain, err)
+	}
+
+	// the value is bound to its Redis key
+	if _, err := decryptSecret(stored, "session: b"); err == nil {
+		t.Errorf("the value was decrypted under another Redis key")
+	}
+
+	// the rotated keys still decrypt, an unknown key does not
+	config.SetSecret(config.SecretTokenEncryptionKey, "second key, first key")
+	if plain, err := decryptSecret(stored, "session: a"); err != nil || plain != "token" {
+		t.Errorf("decrypting with the rotated key failed: %q, %v", plain, err)
+	}
+	config.SetSecret(config.SecretTokenEncryptionKey, "wrong key")
+	if _, err := decryptSecret(stored, "session: a"); err == nil {
+		t.Errorf("the value was decrypted with the wrong key")
+	}
+
+	// the values stored before the encryption was configured are returned as they are
+	if plain, err := decryptSecret("plain token", "session: a"); err != nil || plain != "plain token" {
+		t.Errorf("the unencrypted value was not returned as is: %q, %v", plain, err)
+	}
+}
@@ -0,0 +1,43 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"sync"
+)
+
+// ErrGroup runs the goroutines of a single task (e.g., copying a file into a pipe and uploading the other end of the pipe), the
+// first error cancels the context of the group and is returned by Wait; same semantics as golang.org/x/sync/errgroup
+type ErrGroup struct {
+	cancel context.CancelCauseFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// NewErrGroup returns the group and its context, cancelled (with the error as cause) when a goroutine of the group fails
+func NewErrGroup(ctx context.Context) (*ErrGroup, context.Context) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	return &ErrGroup{cancel: cancel}, ctx
+}
+
+func (g *ErrGroup) Go(f func() error) {
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := f(); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel(err)
+			})
+		}
+	}()
+}
+
+// Wait waits for all goroutines of the group and returns the first error
+func (g *ErrGroup) Wait() error {
+	g.wg.Wait()
+	g.cancel(nil)
+	return g.err
+}
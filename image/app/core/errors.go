@@ -0,0 +1,28 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"errors"
+	"strings"
+)
+
+// the failure classes wrapped by the returned errors, so that the API can respond with the matching status and error code
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrDatasetLocked    = errors.New("dataset locked")
+	ErrRateLimited      = errors.New("rate limit exceeded")
+	ErrQuotaExceeded    = errors.New("quota exceeded")
+	ErrUnsupported      = errors.New("not supported by the destination")
+)
+
+// ChecksumMismatchError reports the files that Dataverse registered with another checksum or size than the streamed content (e.g.,
+// corrupted by a proxy or by the storage), with the database ids of the registered files by node id: the next attempt replaces them
+type ChecksumMismatchError struct {
+	Files   map[string]int64
+	Details []string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return "the registered file does not match the uploaded file: " + strings.Join(e.Details, "; ")
+}
@@ -0,0 +1,96 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"integration/app/config"
+	"integration/app/logging"
+	"time"
+)
+
+// types of the progress events
+const (
+	EventCompare  = "compare"  // stage of a compare, identified by its key
+	EventProgress = "progress" // files processed by a job (transfer or rehashing)
+	EventFile     = "file"     // file written or deleted by a job
+	EventDone     = "done"     // end of a compare or a job
+)
+
+// ProgressEvent is streamed to the GUI instead of polling the cached compare responses and the job status
+type ProgressEvent struct {
+	Type         string    `json:"type"`
+	Key          string    `json:"key,omitempty"`
+	PersistentId string    `json:"persistentId,omitempty"`
+	User         string    `json:"-"` // only the events of the own jobs are streamed
+	Stage        string    `json:"stage,omitempty"`
+	File         string    `json:"file,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	Processed    int       `json:"processed,omitempty"`
+	Total        int       `json:"total,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+// the user is kept in the published message, but not in the streamed event
+type publishedEvent struct {
+	ProgressEvent
+	User string `json:"user,omitempty"`
+}
+
+func CompareEventsChannel(key string) string {
+	return "events: compare: " + key
+}
+
+func DatasetEventsChannel(persistentId string) string {
+	return "events: dataset: " + persistentId
+}
+
+// PublishEvent publishes the event on the channel of the compare (when the key is set) or the dataset, failures are only logged
+func PublishEvent(ctx context.Context, event ProgressEvent) {
+	event.Time = time.Now()
+	channel := DatasetEventsChannel(event.PersistentId)
+	if event.Key != "" {
+		channel = CompareEventsChannel(event.Key)
+	}
+	b, _ := json.Marshal(publishedEvent{event, event.User})
+	shortContext, cancel := context.WithTimeout(ctx, redisCtxDuration)
+	defer cancel()
+	if err := config.Publish(shortContext, channel, string(b)); err != nil {
+		logging.Logger.WarnContext(ctx, "publishing event failed", "channel", channel, "error", err)
+	}
+}
+
+func publishJobDone(ctx context.Context, job Job, err error) {
+	event := ProgressEvent{Type: EventDone, PersistentId: job.PersistentId, User: job.User, Status: "finished"}
+	if err != nil {
+		event.Status, event.Error = "failed", err.Error()
+	}
+	PublishEvent(ctx, event)
+}
+
+// SubscribeEvents returns the events published on the channel until the returned function is called
+func SubscribeEvents(ctx context.Context, channel string) (<-chan ProgressEvent, func(), error) {
+	messages, unsubscribe, err := config.Subscribe(ctx, channel)
+	if err != nil {
+		return nil, nil, err
+	}
+	res := make(chan ProgressEvent)
+	go func() {
+		defer close(res)
+		for msg := range messages {
+			published := publishedEvent{}
+			if json.Unmarshal([]byte(msg), &published) != nil {
+				continue
+			}
+			published.ProgressEvent.User = published.User
+			select {
+			case res <- published.ProgressEvent:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return res, unsubscribe, nil
+}
@@ -0,0 +1,164 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"integration/app/export"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"io"
+	"time"
+)
+
+const (
+	exportPlugin = "export"
+	fileExported = "exported"
+)
+
+func exportReportKey(persistentId string) string {
+	return "export: " + persistentId
+}
+
+// AddExportJob schedules the export of the dataset version (or of the selected files) to the folder of the export target,
+// the token authenticates the user at the target (e.g., the WebDAV password or the Globus access token)
+func AddExportJob(ctx context.Context, dataverseKey, user, persistentId, version string, selection []string, target, folder, token string) error {
+	err := export.Check(target, folder)
+	if err != nil {
+		return err
+	}
+	nodes, err := DatasetFiles(ctx, dataverseKey, user, persistentId, version, selection)
+	if err != nil {
+		return err
+	}
+	for k, v := range nodes {
+		if !v.Attributes.IsFile {
+			delete(nodes, k)
+		}
+	}
+	if len(nodes) == 0 {
+		return fmt.Errorf("dataset %v has no files to export", persistentId)
+	}
+	if IsLocked(ctx, persistentId) {
+		return fmt.Errorf("%w: a job for this dataset is already in progress", ErrDatasetLocked)
+	}
+	return AddJob(ctx, Job{
+		DataverseKey:  dataverseKey,
+		User:          user,
+		PersistentId:  persistentId,
+		WritableNodes: nodes,
+		Plugin:        exportPlugin,
+		StreamParams:  types.StreamParams{PluginId: target, Option: folder, Token: token},
+	})
+}
+
+// doExport streams the files from the dataset to the export target, the exported files are removed from the writable nodes
+// so that a re-queued job only exports the remaining files
+func doExport(ctx context.Context, in Job) (out Job, err error) {
+	out = in
+	err = Destination.CheckPermission(ctx, in.DataverseKey, in.User, in.PersistentId)
+	if err != nil {
+		return
+	}
+	pid, err := trimProtocol(in.PersistentId)
+	if err != nil {
+		return
+	}
+	i := 0
+	total := len(in.WritableNodes)
+	for k, node := range in.WritableNodes {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		default:
+		}
+		if stopping() {
+			err = errStopping
+			return
+		}
+		i++
+		setProgress(ctx, in.PersistentId, in.User, i, total)
+		size, exportErr := exportFile(ctx, in, pid, node)
+		if exportErr != nil {
+			err = fmt.Errorf("exporting %v failed: %v", k, exportErr)
+			return
+		}
+		f := node.Attributes.DestinationFile
+		out.Report.FilesWritten++
+		out.Report.BytesWritten += size
+		out.Report.addFile(k, FileResult{Result: fileExported, HashType: f.HashType, Hash: f.Hash, Size: size})
+		logging.Logger.InfoContext(ctx, "file exported", "persistentId", in.PersistentId, "file", k, "target", in.StreamParams.PluginId, "size", size)
+		PublishEvent(ctx, ProgressEvent{Type: EventFile, PersistentId: in.PersistentId, User: in.User, File: k, Status: fileExported})
+		delete(out.WritableNodes, k)
+	}
+	return
+}
+
+// exportFile writes the file as stored to the target while verifying its checksum against the checksum known by Dataverse
+func exportFile(ctx context.Context, job Job, pid string, node tree.Node) (int64, error) {
+	expected := node.Attributes.DestinationFile
+	reader, err := openDatasetFile(ctx, job.DataverseKey, job.User, pid, expected.StorageIdentifier, expected.Id)
+	if err != nil {
+		return 0, err
+	}
+	defer reader.Close()
+	sizeHasher := &FileSizeHash{}
+	var source io.Reader = hashingReader{reader, sizeHasher}
+	var verify hash.Hash
+	if expected.Hash != "" {
+		hasher, err := getHash(expected.HashType, expected.Filesize)
+		if err != nil {
+			return 0, err
+		}
+		defer closeHash(hasher)
+		source, verify = hashingReader{source, hasher}, hasher
+	}
+	size := expected.Filesize
+	if size <= 0 {
+		size = -1
+	}
+	p := job.StreamParams
+	err = export.Write(ctx, p.PluginId, p.Token, p.Option, node.Id, source, size)
+	if err != nil {
+		return 0, err
+	}
+	if verify != nil && fmt.Sprintf("%x", verify.Sum(nil)) != expected.Hash {
+		return 0, fmt.Errorf("%v checksum does not match the checksum in Dataverse", expected.HashType)
+	}
+	return sizeHasher.FileSize, nil
+}
+
+// storeExportReport keeps the report of the export job apart from the report of the store jobs, the files that could not
+// be exported are marked as failed
+func storeExportReport(job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	for k := range job.WritableNodes {
+		job.Report.addFile(k, FileResult{Result: fileFailed})
+	}
+	job.Report.PersistentId = job.PersistentId
+	job.Report.Finished = time.Now()
+	b, err := json.Marshal(job.Report)
+	if err != nil {
+		logging.Logger.Error("marshalling export report failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	config.GetRedis().Set(ctx, exportReportKey(job.PersistentId), string(b), config.LockMaxDuration)
+}
+
+// GetExportReport returns the report of the last export job of the dataset
+func GetExportReport(ctx context.Context, persistentId string) (JobReport, bool) {
+	res := JobReport{}
+	cached, _ := config.GetRedis().Get(ctx, exportReportKey(persistentId))
+	if cached == "" {
+		return res, false
+	}
+	err := json.Unmarshal([]byte(cached), &res)
+	return res, err == nil
+}
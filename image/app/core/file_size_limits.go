@@ -0,0 +1,74 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"integration/app/config"
+	"strings"
+)
+
+// FileSizeLimit is the maximum size of a file with the setting it comes from
+type FileSizeLimit struct {
+	Limit  int64  `json:"limit"`  // in bytes, 0 when unlimited
+	Source string `json:"source"` // "maxFileSize", "maxFileSizes.plugins.<plugin>", "maxFileSizes.storageDrivers.<driver>", "maxFileSizes.uploads.<path>" or "dataverse" (:MaxFileUploadSizeInBytes)
+}
+
+// Exceeded is true when the size exceeds the limit
+func (l FileSizeLimit) Exceeded(size int64) bool {
+	return l.Limit > 0 && size > l.Limit
+}
+
+func smallerLimit(a, b FileSizeLimit) FileSizeLimit {
+	if b.Limit > 0 && (a.Limit <= 0 || b.Limit < a.Limit) {
+		return b
+	}
+	return a
+}
+
+// FileSizeLimits are the limits on the files of a transfer from a plugin to a dataset, the upload path depends on the file
+type FileSizeLimits struct {
+	files  FileSizeLimit
+	zips   FileSizeLimit // the .zip files are written through SWORD when not uploaded directly
+	unpack bool
+}
+
+// NewFileSizeLimits computes the limits for the plugin and the storage driver of the dataset (when known) from the configuration
+// (see config.MaxFileSizes), with the maximum upload size of the destination (0 when unknown)
+func NewFileSizeLimits(ctx context.Context, plugin, pluginId, storageDriver string, destinationLimit int64, unpackArchives bool) FileSizeLimits {
+	c := config.GetConfig().Options
+	base := FileSizeLimit{Limit: c.MaxFileSize, Source: "maxFileSize"}
+	for _, p := range []string{plugin, pluginId} {
+		if v, ok := c.MaxFileSizes.Plugins[p]; ok && p != "" {
+			base = FileSizeLimit{Limit: v, Source: "maxFileSizes.plugins." + p}
+		}
+	}
+	if v, ok := c.MaxFileSizes.StorageDrivers[storageDriver]; ok && storageDriver != "" {
+		base = smallerLimit(base, FileSizeLimit{Limit: v, Source: "maxFileSizes.storageDrivers." + storageDriver})
+	}
+	base = smallerLimit(base, FileSizeLimit{Limit: destinationLimit, Source: "dataverse"})
+	upload := func(mode string) FileSizeLimit {
+		if v, ok := c.MaxFileSizes.Uploads[mode]; ok {
+			return smallerLimit(base, FileSizeLimit{Limit: v, Source: "maxFileSizes.uploads." + mode})
+		}
+		return base
+	}
+	return FileSizeLimits{
+		files:  upload(fileUploadMode(ctx, "", unpackArchives)),
+		zips:   upload(fileUploadMode(ctx, ".zip", unpackArchives)),
+		unpack: unpackArchives,
+	}
+}
+
+// Files returns the limit of the files that are not .zip files, e.g., to show it in the UI
+func (l FileSizeLimits) Files() FileSizeLimit {
+	return l.files
+}
+
+// For returns the limit of the file with the id (its path in the dataset)
+func (l FileSizeLimits) For(id string) FileSizeLimit {
+	if !l.unpack && strings.HasSuffix(id, ".zip") {
+		return l.zips
+	}
+	return l.files
+}
@@ -0,0 +1,171 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/tree"
+	"time"
+)
+
+const fixityPlugin = "fixity"
+
+type FixityResult struct {
+	HashType   string `json:"hashType"`
+	Expected   string `json:"expected"`
+	Calculated string `json:"calculated,omitempty"`
+	Passed     bool   `json:"passed"`
+	Error      string `json:"error,omitempty"`
+}
+
+// FixityReport is the result of a fixity verification job, the files are keyed by their path in the dataset
+type FixityReport struct {
+	PersistentId string                  `json:"persistentId"`
+	Started      time.Time               `json:"started"`
+	Finished     time.Time               `json:"finished,omitempty"`
+	Total        int                     `json:"total"`
+	Passed       int                     `json:"passed"`
+	Failed       int                     `json:"failed"` // the calculated checksum differs from the recorded one
+	Errors       int                     `json:"errors"` // the file could not be read (e.g., a failed download), the result has the error
+	Files        map[string]FixityResult `json:"files"`
+}
+
+func fixityKey(persistentId string) string {
+	return "fixity: " + persistentId
+}
+
+// AddFixityJob schedules the verification of the checksums of all files in the latest version of the dataset
+func AddFixityJob(ctx context.Context, dataverseKey, user, persistentId string) error {
+	nodes, err := Destination.Query(ctx, persistentId, LatestVersion, dataverseKey, user)
+	if err != nil {
+		return err
+	}
+	toCheck := map[string]tree.Node{}
+	for k, v := range nodes {
+		if v.Attributes.DestinationFile.Hash == "" {
+			continue
+		}
+		v.Attributes.RemoteHashType = v.Attributes.DestinationFile.HashType
+		toCheck[k] = v
+	}
+	if len(toCheck) == 0 {
+		return fmt.Errorf("dataset %v has no files with a checksum", persistentId)
+	}
+	report := FixityReport{
+		PersistentId: persistentId,
+		Started:      time.Now(),
+		Total:        len(toCheck),
+		Files:        map[string]FixityResult{},
+	}
+	if IsLocked(ctx, persistentId) {
+		return fmt.Errorf("Job for this dataverse is already in progress")
+	}
+	storeFixityReport(ctx, report)
+	return AddJob(ctx, Job{
+		DataverseKey:  dataverseKey,
+		User:          user,
+		PersistentId:  persistentId,
+		WritableNodes: toCheck,
+		Plugin:        fixityPlugin,
+	})
+}
+
+// doFixity hashes the files as stored (directly from the storage when configured, through the Dataverse API otherwise);
+// the report is stored after each file, so a retried job continues where it stopped
+func doFixity(ctx context.Context, in Job) (out Job, err error) {
+	out = in
+	err = Destination.CheckPermission(ctx, in.DataverseKey, in.User, in.PersistentId)
+	if err != nil {
+		return
+	}
+	report, _ := GetFixityReport(ctx, in.PersistentId)
+	if report.Files == nil {
+		report = FixityReport{PersistentId: in.PersistentId, Started: time.Now(), Total: len(in.WritableNodes), Files: map[string]FixityResult{}}
+	}
+	for k, node := range in.WritableNodes {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		default:
+		}
+		if stopping() {
+			err = errStopping
+			return
+		}
+		res := FixityResult{
+			HashType: node.Attributes.DestinationFile.HashType,
+			Expected: node.Attributes.DestinationFile.Hash,
+		}
+		h, hashErr := doHash(ctx, in.DataverseKey, in.User, in.PersistentId, node)
+		if hashErr == nil && fmt.Sprintf("%x", h) != res.Expected && readsFromStorage(ctx, node.Attributes.DestinationFile.StorageIdentifier) {
+			// an ingested tabular file is stored in the tabular format, its recorded checksum is the one of the original
+			h, hashErr = doHashDownloaded(ctx, in.DataverseKey, in.User, node)
+		}
+		if hashErr != nil {
+			if ctx.Err() != nil {
+				err = ctx.Err()
+				return
+			}
+			res.Error = hashErr.Error()
+			logging.Logger.WarnContext(ctx, "fixity check could not read the file", "persistentId", in.PersistentId, "file", k, "error", hashErr)
+		} else {
+			res.Calculated = fmt.Sprintf("%x", h)
+			res.Passed = res.Calculated == res.Expected
+			if !res.Passed {
+				logging.Logger.WarnContext(ctx, "fixity check failed", "persistentId", in.PersistentId, "file", k)
+			}
+		}
+		report.Files[k] = res
+		storeFixityReport(ctx, report)
+		delete(out.WritableNodes, k)
+	}
+	return
+}
+
+func finishFixityReport(job Job) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	report, ok := GetFixityReport(ctx, job.PersistentId)
+	if !ok {
+		return
+	}
+	report.Passed, report.Failed, report.Errors = 0, 0, 0
+	for _, v := range report.Files {
+		switch {
+		case v.Passed:
+			report.Passed++
+		case v.Error != "":
+			report.Errors++
+		default:
+			report.Failed++
+		}
+	}
+	report.Finished = time.Now()
+	storeFixityReport(ctx, report)
+	logging.Logger.InfoContext(ctx, "fixity check finished", "persistentId", job.PersistentId, "passed", report.Passed, "failed", report.Failed, "errors", report.Errors, "notChecked", len(job.WritableNodes))
+}
+
+func storeFixityReport(ctx context.Context, report FixityReport) {
+	b, err := json.Marshal(report)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "marshalling fixity report failed", "persistentId", report.PersistentId, "error", err)
+		return
+	}
+	config.GetRedis().Set(ctx, fixityKey(report.PersistentId), string(b), config.LockMaxDuration)
+}
+
+// GetFixityReport returns the report of the last (or running) fixity job of the dataset
+func GetFixityReport(ctx context.Context, persistentId string) (FixityReport, bool) {
+	res := FixityReport{}
+	cached, _ := config.GetRedis().Get(ctx, fixityKey(persistentId))
+	if cached == "" {
+		return res, false
+	}
+	err := json.Unmarshal([]byte(cached), &res)
+	return res, err == nil
+}
@@ -0,0 +1,74 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+)
+
+// SpillingGitHash calculates the git blob hash when the file size is not known on beforehand:
+// the git hash is prefixed with the size, so the content is spilled to a temporary file and hashed when the sum is requested
+type SpillingGitHash struct {
+	file *os.File
+	size int64
+	err  error
+}
+
+func (h *SpillingGitHash) Write(p []byte) (n int, err error) {
+	if h.err != nil {
+		return 0, h.err
+	}
+	if h.file == nil {
+		h.file, h.err = os.CreateTemp("", "git-hash-*")
+		if h.err != nil {
+			return 0, h.err
+		}
+	}
+	n, h.err = h.file.Write(p)
+	h.size = h.size + int64(n)
+	return n, h.err
+}
+
+// Sum returns nil when spilling the content failed, which never matches the expected hash
+func (h *SpillingGitHash) Sum(b []byte) []byte {
+	if h.err != nil {
+		return nil
+	}
+	hasher := sha1.New()
+	hasher.Write([]byte(fmt.Sprintf("blob %d\x00", h.size)))
+	if h.file != nil {
+		_, err := h.file.Seek(0, io.SeekStart)
+		if err == nil {
+			_, err = io.Copy(hasher, h.file)
+		}
+		if err != nil {
+			return nil
+		}
+	}
+	return hasher.Sum(b)
+}
+
+func (h *SpillingGitHash) Reset() {
+	h.Close()
+	*h = SpillingGitHash{}
+}
+
+func (h *SpillingGitHash) Size() int {
+	return sha1.Size
+}
+
+func (h *SpillingGitHash) BlockSize() int {
+	return sha1.BlockSize
+}
+
+// Close removes the temporary file
+func (h *SpillingGitHash) Close() error {
+	if h.file == nil {
+		return nil
+	}
+	h.file.Close()
+	return os.Remove(h.file.Name())
+}
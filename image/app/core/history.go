@@ -0,0 +1,368 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// HistoryRecord is a finished job as stored in the history database
+type HistoryRecord struct {
+	Id           int64                 `json:"id"`
+	PersistentId string                `json:"persistentId"`
+	User         string                `json:"user"`
+	Plugin       string                `json:"plugin"`
+	PluginId     string                `json:"pluginId"`
+	RepoName     string                `json:"repoName"`
+	Url          string                `json:"url"`
+	Option       string                `json:"option"`
+	Status       string                `json:"status"`
+	ErrCnt       int                   `json:"errCnt"`
+	FilesWritten int                   `json:"filesWritten"`
+	BytesWritten int64                 `json:"bytesWritten"`
+	Started      time.Time             `json:"started"`
+	Finished     time.Time             `json:"finished"`
+	Files        map[string]FileResult `json:"files,omitempty"`
+}
+
+// HistoryQuery filters the history, the empty fields are not used for filtering
+type HistoryQuery struct {
+	PersistentId string    `json:"persistentId"`
+	User         string    `json:"user"`
+	Since        time.Time `json:"since"`
+	Until        time.Time `json:"until"`
+	Limit        int       `json:"limit"`
+}
+
+// Connection is a source repository used by the user for a dataset
+type Connection struct {
+	User         string    `json:"user"`
+	PersistentId string    `json:"persistentId"`
+	Plugin       string    `json:"plugin"`
+	PluginId     string    `json:"pluginId"`
+	RepoName     string    `json:"repoName"`
+	Url          string    `json:"url"`
+	Option       string    `json:"option"`
+	LastUsed     time.Time `json:"lastUsed"`
+}
+
+var historySchema = []string{
+	`CREATE TABLE IF NOT EXISTS jobs (
+		id BIGSERIAL PRIMARY KEY,
+		persistent_id TEXT NOT NULL,
+		user_name TEXT NOT NULL,
+		plugin TEXT NOT NULL,
+		plugin_id TEXT NOT NULL,
+		repo_name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		option TEXT NOT NULL,
+		status TEXT NOT NULL,
+		err_cnt INTEGER NOT NULL,
+		files_written INTEGER NOT NULL,
+		bytes_written BIGINT NOT NULL,
+		started TIMESTAMPTZ NOT NULL,
+		finished TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS jobs_persistent_id_finished ON jobs (persistent_id, finished)`,
+	`CREATE INDEX IF NOT EXISTS jobs_user_name_finished ON jobs (user_name, finished)`,
+	`CREATE TABLE IF NOT EXISTS file_results (
+		job_id BIGINT NOT NULL REFERENCES jobs (id) ON DELETE CASCADE,
+		file_id TEXT NOT NULL,
+		result TEXT NOT NULL,
+		hash_type TEXT NOT NULL,
+		hash TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		PRIMARY KEY (job_id, file_id)
+	)`,
+	// the outcome of the failed files and the ids of the written files, added to the tables created by the earlier versions
+	`ALTER TABLE file_results ADD COLUMN IF NOT EXISTS error TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE file_results ADD COLUMN IF NOT EXISTS duration BIGINT NOT NULL DEFAULT 0`,
+	`ALTER TABLE file_results ADD COLUMN IF NOT EXISTS data_file_id BIGINT NOT NULL DEFAULT 0`,
+	`CREATE TABLE IF NOT EXISTS connections (
+		user_name TEXT NOT NULL,
+		persistent_id TEXT NOT NULL,
+		plugin TEXT NOT NULL,
+		plugin_id TEXT NOT NULL,
+		repo_name TEXT NOT NULL,
+		url TEXT NOT NULL,
+		option TEXT NOT NULL,
+		last_used TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (user_name, persistent_id, plugin_id, repo_name, url, option)
+	)`,
+	// the periodic batch syncs (see Schedule), with the encrypted credentials
+	`CREATE TABLE IF NOT EXISTS schedules (
+		id TEXT PRIMARY KEY,
+		user_name TEXT NOT NULL,
+		target TEXT NOT NULL,
+		request TEXT NOT NULL,
+		dataverse_key TEXT NOT NULL,
+		token TEXT NOT NULL,
+		interval_minutes INTEGER NOT NULL,
+		next_run TIMESTAMPTZ NOT NULL,
+		last_run TIMESTAMPTZ,
+		last_batch TEXT NOT NULL DEFAULT '',
+		last_error TEXT NOT NULL DEFAULT '',
+		created TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS schedules_next_run ON schedules (next_run)`,
+	`CREATE INDEX IF NOT EXISTS schedules_user_name ON schedules (user_name)`,
+}
+
+var historyDb *sql.DB
+var historyMutex sync.Mutex
+
+// after a failed initialisation, the database is not tried again before historyRetry, the backoff doubles up to maxHistoryBackoff
+var historyRetry time.Time
+var historyBackoff time.Duration
+
+const maxHistoryBackoff = 5 * time.Minute
+
+func historyEnabled() bool {
+	return config.GetConfig().Options.History.PathToDataSourceName != ""
+}
+
+// getHistoryDb opens the database and creates the tables on first use, a failed attempt (e.g., the database was not reachable yet)
+// is retried on a later use, with a backoff
+func getHistoryDb(ctx context.Context) (*sql.DB, error) {
+	if !historyEnabled() {
+		return nil, fmt.Errorf("job history is not configured")
+	}
+	historyMutex.Lock()
+	db, retry := historyDb, historyRetry
+	historyMutex.Unlock()
+	if db != nil {
+		return db, nil
+	}
+	if time.Now().Before(retry) {
+		return nil, fmt.Errorf("history database is not available, next attempt at %v", retry.Format(time.RFC3339))
+	}
+	// opened without holding the lock: the schema statements can take long when the database is slow or not reachable
+	db, err := openHistoryDb(ctx)
+	historyMutex.Lock()
+	defer historyMutex.Unlock()
+	if err != nil {
+		historyBackoff = min(max(2*historyBackoff, time.Second), maxHistoryBackoff)
+		historyRetry = time.Now().Add(historyBackoff)
+		return nil, err
+	}
+	historyBackoff, historyRetry = 0, time.Time{}
+	if historyDb != nil {
+		// opened concurrently by another request
+		db.Close()
+		return historyDb, nil
+	}
+	historyDb = db
+	return historyDb, nil
+}
+
+func openHistoryDb(ctx context.Context) (*sql.DB, error) {
+	c := config.GetConfig().Options.History
+	driver := c.Driver
+	if driver == "" {
+		driver = "postgres"
+	}
+	b, err := os.ReadFile(c.PathToDataSourceName)
+	if err != nil {
+		return nil, fmt.Errorf("reading history data source name failed: %v", err)
+	}
+	db, err := sql.Open(driver, strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("opening history database failed: %v", err)
+	}
+	for _, stmt := range historySchema {
+		if _, err = db.ExecContext(ctx, stmt); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("creating history tables failed: %v", err)
+		}
+	}
+	return db, nil
+}
+
+func recordHistory(job Job) {
+	if !historyEnabled() || job.Plugin == "hash-only" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	err := insertHistory(ctx, job)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "recording job history failed", "persistentId", job.PersistentId, "error", err)
+	}
+}
+
+func insertHistory(ctx context.Context, job Job) error {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	status := "completed"
+	if len(notProcessed(job)) > 0 {
+		status = "failed"
+	}
+	finished := time.Now()
+	started := job.Report.Started
+	if started.IsZero() {
+		started = finished
+	}
+	p := job.StreamParams
+	var id int64
+	err = tx.QueryRowContext(ctx, `INSERT INTO jobs (persistent_id, user_name, plugin, plugin_id, repo_name, url, option, status, err_cnt, files_written, bytes_written, started, finished)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+		job.PersistentId, job.User, job.Plugin, p.PluginId, p.RepoName, p.Url, p.Option, status, job.ErrCnt, job.Report.FilesWritten, job.Report.BytesWritten, started, finished).Scan(&id)
+	if err != nil {
+		return err
+	}
+	files := map[string]FileResult{}
+	for k, v := range job.Report.Files {
+		files[k] = v
+	}
+	for _, k := range notProcessed(job) {
+		// the error of the last attempt is kept for the files that failed
+		if files[k].Result != fileFailed {
+			files[k] = FileResult{Result: fileFailed}
+		}
+	}
+	for k, v := range files {
+		_, err = tx.ExecContext(ctx, `INSERT INTO file_results (job_id, file_id, result, hash_type, hash, size, error, duration, data_file_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			id, k, v.Result, v.HashType, v.Hash, v.Size, v.Error, v.Duration, v.DataFileId)
+		if err != nil {
+			return err
+		}
+	}
+	if job.Plugin != fixityPlugin {
+		_, err = tx.ExecContext(ctx, `INSERT INTO connections (user_name, persistent_id, plugin, plugin_id, repo_name, url, option, last_used)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			ON CONFLICT (user_name, persistent_id, plugin_id, repo_name, url, option) DO UPDATE SET last_used = EXCLUDED.last_used`,
+			job.User, job.PersistentId, job.Plugin, p.PluginId, p.RepoName, p.Url, p.Option, finished)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetHistory returns the finished jobs matching the query, most recent first
+func GetHistory(ctx context.Context, q HistoryQuery) ([]HistoryRecord, error) {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	where := []string{"TRUE"}
+	args := []interface{}{}
+	add := func(cond string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+	if q.PersistentId != "" {
+		add("persistent_id = $%d", q.PersistentId)
+	}
+	if q.User != "" {
+		add("user_name = $%d", q.User)
+	}
+	if !q.Since.IsZero() {
+		add("finished >= $%d", q.Since)
+	}
+	if !q.Until.IsZero() {
+		add("finished < $%d", q.Until)
+	}
+	if q.Limit <= 0 || q.Limit > 1000 {
+		q.Limit = 100
+	}
+	args = append(args, q.Limit)
+	rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT id, persistent_id, user_name, plugin, plugin_id, repo_name, url, option, status, err_cnt, files_written, bytes_written, started, finished
+		FROM jobs WHERE %s ORDER BY finished DESC LIMIT $%d`, strings.Join(where, " AND "), len(args)), args...)
+	if err != nil {
+		return nil, err
+	}
+	res := []HistoryRecord{}
+	for rows.Next() {
+		r := HistoryRecord{}
+		err = rows.Scan(&r.Id, &r.PersistentId, &r.User, &r.Plugin, &r.PluginId, &r.RepoName, &r.Url, &r.Option, &r.Status, &r.ErrCnt, &r.FilesWritten, &r.BytesWritten, &r.Started, &r.Finished)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res = append(res, r)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(res) == 0 {
+		return res, nil
+	}
+	ids := make([]int64, len(res))
+	for i, r := range res {
+		ids[i] = r.Id
+	}
+	files, err := getFileResults(ctx, db, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range res {
+		res[i].Files = files[res[i].Id]
+	}
+	return res, nil
+}
+
+// getFileResults returns the file results of the jobs, by job id, in one query
+func getFileResults(ctx context.Context, db *sql.DB, jobIds []int64) (map[int64]map[string]FileResult, error) {
+	rows, err := db.QueryContext(ctx, `SELECT job_id, file_id, result, hash_type, hash, size, error, duration, data_file_id FROM file_results WHERE job_id = ANY($1)`, pq.Array(jobIds))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := map[int64]map[string]FileResult{}
+	for rows.Next() {
+		var jobId int64
+		var id string
+		f := FileResult{}
+		if err = rows.Scan(&jobId, &id, &f.Result, &f.HashType, &f.Hash, &f.Size, &f.Error, &f.Duration, &f.DataFileId); err != nil {
+			return nil, err
+		}
+		if res[jobId] == nil {
+			res[jobId] = map[string]FileResult{}
+		}
+		res[jobId][id] = f
+	}
+	return res, rows.Err()
+}
+
+// GetConnections returns the source repositories used by the user, most recently used first
+func GetConnections(ctx context.Context, user string) ([]Connection, error) {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT user_name, persistent_id, plugin, plugin_id, repo_name, url, option, last_used
+		FROM connections WHERE user_name = $1 ORDER BY last_used DESC`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []Connection{}
+	for rows.Next() {
+		c := Connection{}
+		err = rows.Scan(&c.User, &c.PersistentId, &c.Plugin, &c.PluginId, &c.RepoName, &c.Url, &c.Option, &c.LastUsed)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, c)
+	}
+	return res, rows.Err()
+}
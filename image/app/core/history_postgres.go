@@ -0,0 +1,6 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+// registers the "postgres" database/sql driver used by the job history
+import _ "github.com/lib/pq"
@@ -8,22 +8,18 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"crypto/sha512"
-	"errors"
 	"fmt"
 	"hash"
+	"hash/crc32"
 	"integration/app/config"
 	"integration/app/plugin/types"
+	"integration/app/storage"
 	"integration/app/tree"
 	"io"
 	"os"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	cfg "github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 )
 
@@ -33,7 +29,7 @@ func (r hashingReader) Read(buf []byte) (n int, err error) {
 	return
 }
 
-func getStorage(storageIdentifier string) storage {
+func getStorage(storageIdentifier string) storageLocation {
 	driver := ""
 	filename := ""
 	bucket := ""
@@ -47,7 +43,7 @@ func getStorage(storageIdentifier string) storage {
 			filename = second[1]
 		}
 	}
-	return storage{driver, bucket, filename}
+	return storageLocation{driver, bucket, filename}
 }
 
 func generateFileName() string {
@@ -57,16 +53,24 @@ func generateFileName() string {
 	return fmt.Sprintf("%x-%x", hexTimestamp, hexRandom)
 }
 
-func generateStorageIdentifier(fileName string) string {
+func generateStorageIdentifier(ctx context.Context, driver, fileName string) string {
+	d, _ := config.GetStorageDriver(ctx, driver)
 	b := ""
-	if config.GetConfig().Options.DefaultDriver == "s3" {
-		b = config.GetConfig().Options.S3Config.AWSBucket + ":"
+	switch d.Type {
+	case "s3":
+		b = d.S3Config.AWSBucket + ":"
+	case "gcs":
+		b = d.GCSConfig.Bucket + ":"
+	case "azure":
+		b = d.AzureConfig.Container + ":"
+	case "swift":
+		b = d.SwiftConfig.Container + ":"
 	}
-	return fmt.Sprintf("%s://%s%s", config.GetConfig().Options.DefaultDriver, b, fileName)
+	return fmt.Sprintf("%s://%s%s", driver, b, fileName)
 }
 
 func getHash(hashType string, fileSize int64) (hasher hash.Hash, err error) {
-	lowerHashType := strings.ToLower(hashType)
+	lowerHashType := strings.ToLower(types.NormalizeHashType(hashType))
 	if lowerHashType == strings.ToLower(types.Md5) {
 		hasher = md5.New()
 	} else if lowerHashType == strings.ToLower(types.SHA1) {
@@ -75,12 +79,16 @@ func getHash(hashType string, fileSize int64) (hasher hash.Hash, err error) {
 		hasher = sha256.New()
 	} else if lowerHashType == strings.ToLower(types.SHA512) {
 		hasher = sha512.New()
+	} else if lowerHashType == strings.ToLower(types.GitHash) && fileSize <= 0 {
+		hasher = &SpillingGitHash{}
 	} else if lowerHashType == strings.ToLower(types.GitHash) {
 		hasher = sha1.New()
 		hasher.Write([]byte(fmt.Sprintf("blob %d\x00", fileSize)))
 	} else if lowerHashType == strings.ToLower(types.QuickXorHash) {
 		hasher = &QuickXorHash{}
-	} else if lowerHashType == strings.ToLower(types.FileSize) {
+	} else if lowerHashType == strings.ToLower(types.CRC32C) {
+		hasher = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	} else if lowerHashType == strings.ToLower(types.FileSize) || lowerHashType == strings.ToLower(types.SizeAndTime) {
 		hasher = &FileSizeHash{}
 	} else {
 		err = fmt.Errorf("unsupported hash type: %v", hashType)
@@ -88,97 +96,173 @@ func getHash(hashType string, fileSize int64) (hasher hash.Hash, err error) {
 	return
 }
 
-func newS3Client(ctx context.Context) (*s3.Client, error) {
-	awsConfig, err := cfg.LoadDefaultConfig(ctx,
-		cfg.WithRegion(config.GetConfig().Options.S3Config.AWSRegion),
-	)
+// emptyFileHash returns the hash of the empty content, the empty Dataverse files do not need to be downloaded to be rehashed
+func emptyFileHash(hashType string) (string, bool) {
+	if hashType == types.SizeAndTime {
+		return "", false
+	}
+	hasher, err := getHash(hashType, 0)
 	if err != nil {
-		return nil, err
+		return "", false
+	}
+	defer closeHash(hasher)
+	return fmt.Sprintf("%x", hasher.Sum(nil)), true
+}
+
+// closeHash releases the resources of the hashers that need them (e.g., temporary files)
+func closeHash(hasher hash.Hash) {
+	if c, ok := hasher.(io.Closer); ok {
+		c.Close()
 	}
-	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
-		o.BaseEndpoint = aws.String(config.GetConfig().Options.S3Config.AWSEndpoint)
-		o.UsePathStyle = config.GetConfig().Options.S3Config.AWSPathstyle
-	}), nil
 }
 
-func write(ctx context.Context, dbId int64, dataverseKey, user string, fileStream types.Stream, storageIdentifier, persistentId, hashType, remoteHashType, id string, fileSize int64) (hash []byte, remoteHash []byte, size int64, retErr error) {
+type writeResult struct {
+	hash              []byte
+	remoteHash        []byte
+	size              int64
+	transformed       bool
+	storageIdentifier string // can be different from the requested one, e.g., when assigned by Dataverse for signed URL uploads
+}
+
+// write streams the file over the Dataverse API, or directly to the storage identified by the storage identifier when direct is set
+func write(ctx context.Context, direct bool, dbId int64, dataverseKey, user string, fileStream types.Stream, storageIdentifier, persistentId, hashType, remoteHashType, id, description string, fileSize int64) (res writeResult, retErr error) {
+	res.storageIdentifier = storageIdentifier
 	pid, err := trimProtocol(persistentId)
 	if err != nil {
-		return nil, nil, 0, err
+		return res, err
 	}
 	s := getStorage(storageIdentifier)
 	hasher, err := getHash(hashType, fileSize)
 	if err != nil {
-		return nil, nil, 0, err
+		return res, err
 	}
+	defer closeHash(hasher)
 	sizeHasher := &FileSizeHash{}
 	remoteHasher, err := getHash(remoteHashType, fileSize)
 	if err != nil {
-		return nil, nil, 0, err
+		return res, err
 	}
-	readStream, err := fileStream.Open()
+	defer closeHash(remoteHasher)
+	reserved, err := reserveStreamMemory(ctx, fileSize)
 	if err != nil {
-		return nil, nil, 0, err
+		return res, err
+	}
+	defer releaseStreamMemory(reserved)
+	readStream, err := fileStream.Open(ctx)
+	if err != nil {
+		return res, err
 	}
 	defer fileStream.Close()
-	reader := hashingReader{readStream, hasher}
+	// the remote hash is always calculated on the original content, the local hash and size on the stored (possibly transformed) content
+	var source io.Reader = hashingReader{readStream, remoteHasher}
+	if transformApplies(id) {
+		transformedStream, err := transform(ctx, id, source)
+		if err != nil {
+			return res, err
+		}
+		defer func() {
+			if err := transformedStream.Close(); err != nil && retErr == nil {
+				retErr = err
+			}
+		}()
+		source = transformedStream
+		res.transformed = true
+	}
+	reader := hashingReader{source, hasher}
 	reader = hashingReader{reader, sizeHasher}
-	reader = hashingReader{reader, remoteHasher}
 
-	if s.driver == "file" || !Destination.IsDirectUpload() {
-		wg := &sync.WaitGroup{}
-		async_err := &ErrorHolder{}
-		f, err := getFile(ctx, dbId, wg, dataverseKey, user, persistentId, pid, s, id, async_err)
+	if !direct {
+		group, groupCtx := NewErrGroup(ctx)
+		f, err := Destination.WriteOverWire(groupCtx, dbId, id, description, dataverseKey, user, persistentId, group)
 		if err != nil {
-			return nil, nil, 0, err
+			group.Wait()
+			return res, err
 		}
-		_, err_copy := io.Copy(f, reader)
-		err_close := f.Close()
-		wg.Wait()
-		if err_copy != nil || err_close != nil || async_err.Err != nil {
-			return nil, nil, 0, fmt.Errorf("writing failed: %v: %v: %v", err_close, err_copy, async_err.Err)
-		}
-	} else if s.driver == "s3" {
-		client, err := newS3Client(ctx)
+		err = copyAndClose(group, f, reader)
 		if err != nil {
-			return nil, nil, 0, err
+			return res, err
 		}
-		uploader := manager.NewUploader(client)
-		uploader.PartSize = 1024 * 1024 * 1024
-		uploader.MaxUploadParts = 1000
-		uploader.Concurrency = 2
-		_, err = uploader.Upload(ctx, &s3.PutObjectInput{
-			Bucket: aws.String(s.bucket),
-			Key:    aws.String(pid + "/" + s.filename),
-			Body:   reader,
-		})
+	} else if Destination.IsSignedUrlUpload() {
+		res.storageIdentifier, err = uploadToSignedUrls(ctx, dataverseKey, user, persistentId, fileSize, res.transformed, reader)
 		if err != nil {
-			return nil, nil, 0, err
+			return res, err
 		}
 	} else {
-		return nil, nil, 0, fmt.Errorf("unsupported driver: %s", s.driver)
+		err = writeToStorage(ctx, s, pid, reader, fileSize)
+		if err != nil {
+			return res, err
+		}
 	}
 
-	return hasher.Sum(nil), remoteHasher.Sum(nil), sizeHasher.FileSize, nil
+	res.hash, res.remoteHash, res.size = hasher.Sum(nil), remoteHasher.Sum(nil), sizeHasher.FileSize
+	return res, nil
 }
 
-func getFile(ctx context.Context, dbId int64, wg *sync.WaitGroup, dataverseKey, user, persistentId, pid string, s storage, id string, async_err *ErrorHolder) (io.WriteCloser, error) {
-	if !Destination.IsDirectUpload() {
-		return Destination.WriteOverWire(ctx, dbId, id, dataverseKey, user, persistentId, wg, async_err)
+// uploadToSignedUrls needs the exact size before the upload starts: when it is not known on beforehand
+// (e.g., not provided by the plugin or changed by the transformation), the file is first spooled to a temporary file
+func uploadToSignedUrls(ctx context.Context, dataverseKey, user, persistentId string, fileSize int64, transformed bool, reader io.Reader) (string, error) {
+	if fileSize > 0 && !transformed {
+		return Destination.UploadToSignedUrls(ctx, dataverseKey, user, persistentId, fileSize, reader)
 	}
-	path := config.GetConfig().Options.PathToFilesDir + pid + "/"
-	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
-		err := os.MkdirAll(path, os.ModePerm)
-		if err != nil {
-			return nil, err
+	tmp, err := os.CreateTemp("", "upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return "", err
+	}
+	_, err = tmp.Seek(0, io.SeekStart)
+	if err != nil {
+		return "", err
+	}
+	return Destination.UploadToSignedUrls(ctx, dataverseKey, user, persistentId, size, tmp)
+}
+
+// copyAndClose copies the reader to the writer returned by WriteOverWire, as a goroutine of the group of the upload: a failed upload
+// aborts the copy (the writes fail with the error of the upload) and a failed copy aborts the upload, the first error is returned
+func copyAndClose(group *ErrGroup, f io.WriteCloser, reader io.Reader) error {
+	group.Go(func() error {
+		if _, err := io.Copy(f, reader); err != nil {
+			if aborter, ok := f.(interface{ CloseWithError(error) error }); ok {
+				aborter.CloseWithError(err)
+			} else {
+				f.Close()
+			}
+			return err
 		}
+		return f.Close()
+	})
+	if err := group.Wait(); err != nil {
+		return fmt.Errorf("writing failed: %w", err)
+	}
+	return nil
+}
+
+func openStorage(ctx context.Context, s storageLocation) (storage.Storage, error) {
+	d, ok := config.GetStorageDriver(ctx, s.driver)
+	if !ok {
+		return nil, fmt.Errorf("storage driver %v is not configured", s.driver)
 	}
-	file := path + s.filename
-	f, err := os.Create(file)
+	return storage.New(d, s.bucket)
+}
+
+func writeToStorage(ctx context.Context, s storageLocation, pid string, reader io.Reader, fileSize int64) error {
+	st, err := openStorage(ctx, s)
+	if err != nil {
+		return err
+	}
+	return st.Create(ctx, pid+"/"+s.filename, reader, fileSize)
+}
+
+func readFromStorage(ctx context.Context, s storageLocation, pid string) (io.ReadCloser, error) {
+	st, err := openStorage(ctx, s)
 	if err != nil {
 		return nil, err
 	}
-	return f, nil
+	return st.Open(ctx, pid+"/"+s.filename)
 }
 
 func doHash(ctx context.Context, dataverseKey, user, persistentId string, node tree.Node) ([]byte, error) {
@@ -192,47 +276,49 @@ func doHash(ctx context.Context, dataverseKey, user, persistentId string, node t
 	if err != nil {
 		return nil, err
 	}
-	s := getStorage(storageIdentifier)
-	var reader io.Reader
-	if !Destination.IsDirectUpload() {
-		readCloser, err := Destination.GetStream(ctx, dataverseKey, user, node.Attributes.DestinationFile.Id)
-		if err != nil {
-			return nil, err
-		}
-		defer readCloser.Close()
-		reader = readCloser
-	} else if s.driver == "file" {
-		file := config.GetConfig().Options.PathToFilesDir + pid + "/" + s.filename
-		f, err := os.Open(file)
-		if err != nil {
-			return nil, err
-		}
-		defer f.Close()
-		reader = f
-	} else if s.driver == "s3" {
-		client, err := newS3Client(ctx)
-		if err != nil {
-			return nil, err
-		}
-		rawObject, err := client.GetObject(ctx,
-			&s3.GetObjectInput{
-				Bucket: aws.String(s.bucket),
-				Key:    aws.String(pid + "/" + s.filename),
-			})
-		if err != nil {
-			return nil, err
-		}
-		defer rawObject.Body.Close()
-		reader = rawObject.Body
-	} else {
-		return nil, fmt.Errorf("unsupported driver: %s", s.driver)
+	defer closeHash(hasher)
+	readCloser, err := openDatasetFile(ctx, dataverseKey, user, pid, storageIdentifier, node.Attributes.DestinationFile.Id)
+	if err != nil {
+		return nil, err
 	}
+	defer readCloser.Close()
 
-	r := hashingReader{reader, hasher}
+	r := hashingReader{readCloser, hasher}
 	_, err = io.Copy(io.Discard, r)
 	return hasher.Sum(nil), err
 }
 
+// doHashDownloaded hashes the file downloaded through the Dataverse API, i.e., the original of an ingested tabular file (the
+// storage holds the tabular version of such a file under its storage identifier)
+func doHashDownloaded(ctx context.Context, dataverseKey, user string, node tree.Node) ([]byte, error) {
+	hasher, err := getHash(node.Attributes.RemoteHashType, node.Attributes.DestinationFile.Filesize)
+	if err != nil {
+		return nil, err
+	}
+	defer closeHash(hasher)
+	readCloser, err := Destination.GetStream(ctx, dataverseKey, user, node.Attributes.DestinationFile.Id)
+	if err != nil {
+		return nil, err
+	}
+	defer readCloser.Close()
+	_, err = io.Copy(io.Discard, hashingReader{readCloser, hasher})
+	return hasher.Sum(nil), err
+}
+
+// readsFromStorage is true when the files of the dataset are read directly from the storage (see openDatasetFile)
+func readsFromStorage(ctx context.Context, storageIdentifier string) bool {
+	_, configured := config.GetStorageDriver(ctx, getStorage(storageIdentifier).driver)
+	return Destination.IsDirectUpload(ctx) && !Destination.IsSignedUrlUpload() && configured
+}
+
+// openDatasetFile reads the file as stored: directly from the storage when configured, through the Dataverse API otherwise
+func openDatasetFile(ctx context.Context, dataverseKey, user, pid, storageIdentifier string, id int64) (io.ReadCloser, error) {
+	if !readsFromStorage(ctx, storageIdentifier) {
+		return Destination.GetStream(ctx, dataverseKey, user, id)
+	}
+	return readFromStorage(ctx, getStorage(storageIdentifier), pid)
+}
+
 func trimProtocol(persistentId string) (string, error) {
 	s := strings.Split(persistentId, ":")
 	if len(s) < 2 {
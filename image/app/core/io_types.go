@@ -8,7 +8,7 @@ import (
 	"mime/multipart"
 )
 
-type storage struct {
+type storageLocation struct {
 	driver   string
 	bucket   string
 	filename string
@@ -19,17 +19,13 @@ type hashingReader struct {
 	hasher hash.Hash
 }
 
-type ErrorHolder struct {
-	Err error
-}
-
 type WriterCloser struct {
 	writer io.Writer
 	closer io.Closer
-	pw     io.WriteCloser
+	pw     *io.PipeWriter
 }
 
-func NewWritterCloser(writer io.Writer, closer io.Closer, pipeWriter io.WriteCloser) WriterCloser {
+func NewWritterCloser(writer io.Writer, closer io.Closer, pipeWriter *io.PipeWriter) WriterCloser {
 	return WriterCloser{writer, closer, pipeWriter}
 }
 
@@ -42,6 +38,12 @@ func (z WriterCloser) Close() error {
 	return z.closer.Close()
 }
 
+// CloseWithError aborts the upload without finishing the content (e.g., the zip or the multipart form): the reading side gets
+// the error instead of a truncated, but otherwise valid, file
+func (z WriterCloser) CloseWithError(err error) error {
+	return z.pw.CloseWithError(err)
+}
+
 type FileWriter struct {
 	part1writtern bool
 	part1bytes    []byte
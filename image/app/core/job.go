@@ -4,18 +4,22 @@ package core
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"integration/app/config"
+	"integration/app/httpclient"
 	"integration/app/logging"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const maxErrors = 100
 
+// the workers wait that long before taking the next job when the Dataverse of the job is unavailable
+var unavailablePause = 5 * time.Second
+
 type Job struct {
 	DataverseKey      string
 	User              string
@@ -25,32 +29,61 @@ type Job struct {
 	Plugin            string
 	Streams           map[string]map[string]interface{}
 	StreamParams      types.StreamParams
+	Version           string // dataset version the writable nodes were compared with, the latest version when empty
 	ErrCnt            int
 	Deadline          time.Time
 	SendEmailOnSucces bool
+	Publish           string // "major" or "minor" when the dataset should be published after all files are written
+	Report            JobReport
+	StorageDriver     string            // optional: storage driver id of the dataset, queried from the destination when empty and named drivers are configured
+	CorrelationId     string            // correlation id of the request that added the job, attached to all log lines of the job
+	Bundles           map[string]Bundle // the archives (by their id in WritableNodes) written from the files of the bundled folders
+	UnpackArchives    bool              // the .zip, .tar.gz, .tgz and .tar files are written as the files they contain
+	Revision          string            // revision (e.g., the commit) of the repository when the job started, recorded in the RO-Crate and the provenance
+	Target            string            // the Dataverse installation of the dataset (one of the dataverseTargets), the default installation when empty
+	SkipCleanStorage  bool              // the cleanStorage API is not called after the job (see cleanStorage)
+	Orcid             Orcid             // the ORCID iD linked to the user when the job was added, recorded in the audit log, the provenance and the RO-Crate
+
+	// a failed file does not stop the job: the other files are written and only the failed files are retried, a file is given up
+	// after maxFileAttempts failed attempts
+	ContinueOnError bool
+	FileAttempts    map[string]int       // failed attempts per file
+	FailedNodes     map[string]tree.Node // the files that were given up
 }
 
 var Stop = make(chan struct{})
 var Wait = sync.WaitGroup{}
 
+// number of workers of this process running a job, used by the autoscaling
+var busyWorkers atomic.Int64
+
 var redisCtxDuration = 5 * time.Minute
 
+// jobContext carries the correlation id and the Dataverse installation of the job
+func jobContext(job Job) context.Context {
+	return config.WithTarget(logging.WithCorrelationId(context.Background(), job.CorrelationId), job.Target)
+}
+
 func IsLocked(ctx context.Context, persistentId string) bool {
-	l := config.GetRedis().Get(ctx, "lock: "+persistentId)
-	return l.Val() != ""
+	l, _ := config.GetRedis().Get(ctx, "lock: "+persistentId)
+	return l != ""
 }
 
 func lock(persistentId string) bool {
 	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
 	defer cancel()
-	ok := config.GetRedis().SetNX(ctx, "lock: "+persistentId, true, config.LockMaxDuration)
-	return ok.Val()
+	ok, _ := config.GetRedis().SetNX(ctx, "lock: "+persistentId, true, config.LockMaxDuration)
+	if ok {
+		config.GetRedis().SAdd(ctx, "locks", persistentId)
+	}
+	return ok
 }
 
 func unlock(persistentId string) {
 	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
 	defer cancel()
 	config.GetRedis().Del(ctx, "lock: "+persistentId)
+	config.GetRedis().SRem(ctx, "locks", persistentId)
 }
 
 func AddJob(ctx context.Context, job Job) error {
@@ -59,7 +92,7 @@ func AddJob(ctx context.Context, job Job) error {
 	}
 	err := addJob(ctx, job, true)
 	if err == nil {
-		logging.Logger.Println("job added for " + job.PersistentId)
+		logging.Logger.InfoContext(ctx, "job added", "persistentId", job.PersistentId, "files", len(job.WritableNodes))
 	}
 	return err
 }
@@ -69,73 +102,191 @@ func addJob(ctx context.Context, job Job, requireLock bool) error {
 		return nil
 	}
 	if requireLock && !lock(job.PersistentId) {
-		return fmt.Errorf("Job for this dataverse is already in progress")
+		return fmt.Errorf("%w: a job for this dataset is already in progress", ErrDatasetLocked)
 	}
 	if requireLock {
 		job.Deadline = time.Now().Add(config.LockMaxDuration)
+		job.Report.Started = time.Now()
+	}
+	if job.CorrelationId == "" {
+		job.CorrelationId = logging.CorrelationId(ctx)
+	}
+	if job.CorrelationId == "" {
+		job.CorrelationId = logging.NewCorrelationId()
+	}
+	if job.Target == "" {
+		job.Target = config.TargetName(ctx)
+	}
+	if requireLock && job.Orcid.Id == "" {
+		job.Orcid, _ = GetOrcid(ctx, job.User)
 	}
-	b, err := json.Marshal(job)
+	b, err := marshalJob(job)
 	if err != nil {
 		return err
 	}
-	cmd := config.GetRedis().LPush(ctx, "jobs", string(b))
-	return cmd.Err()
+	_, err = config.GetRedis().LPush(ctx, jobQueue(job), string(b))
+	return err
 }
 
-func popJob() (Job, bool) {
+// popJob takes the next job from the queues of this worker, the jobs routed to its labels first; the job is moved to the processing
+// queue of this process in the same step, where it stays until startLease takes its lease (or it is re-queued)
+func popJob() (Job, string, bool) {
 	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
 	defer cancel()
-	cmd := config.GetRedis().RPop(ctx, "jobs")
-	err := cmd.Err()
-	if err != nil {
-		return Job{}, false
-	}
-	v := cmd.Val()
-	job := Job{}
-	err = json.Unmarshal([]byte(v), &job)
-	if err != nil {
-		logging.Logger.Println("failed to unmarshall a job:", err)
-		return job, false
+	for _, q := range workerQueues() {
+		popped, err := config.GetRedis().RPopLPush(ctx, q, processingKey(workerId))
+		if err != nil {
+			continue
+		}
+		job, err := unmarshalJob([]byte(popped))
+		if err != nil {
+			logging.Logger.Error("failed to unmarshall a job", "error", err)
+			config.GetRedis().LRem(ctx, processingKey(workerId), popped)
+			return job, "", false
+		}
+		return job, popped, true
 	}
-	return job, true
+	return Job{}, "", false
+}
+
+// requeuePopped puts the popped job back in its queue, without taking its lease
+func requeuePopped(job Job, popped string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	err := addJob(ctx, job, false)
+	config.GetRedis().LRem(ctx, processingKey(workerId), popped)
+	return err
 }
 
-func ProcessJobs() {
+// ProcessJobs runs a worker until the Stop channel or the quit channel (when the number of workers is reduced) is closed
+func ProcessJobs(quit <-chan struct{}) {
 	defer Wait.Done()
-	defer logging.Logger.Println("worker exited grecefully")
+	defer logging.Logger.Info("worker exited grecefully")
 	for {
 		select {
 		case <-Stop:
 			return
+		case <-quit:
+			return
 		case <-time.After(1 * time.Second):
 		}
-		job, ok := popJob()
+		job, popped, ok := popJob()
+		if ok && !httpclient.Available(config.GetTarget(jobContext(job)).DataverseServer) {
+			// Dataverse is down (circuit breaker open): the job goes back to the queue and the worker pauses, instead of failing the job
+			err := requeuePopped(job, popped)
+			if err != nil {
+				logging.Logger.ErrorContext(jobContext(job), "re-adding job failed (no retry)", "persistentId", job.PersistentId, "error", err)
+				finishJob(job)
+				publishJobDone(jobContext(job), job, err)
+			}
+			select {
+			case <-Stop:
+				return
+			case <-quit:
+				return
+			case <-time.After(unavailablePause):
+			}
+			continue
+		}
 		if ok {
+			busyWorkers.Add(1)
+			job = adoptIfRequested(job)
 			persistentId := job.PersistentId
-			logging.Logger.Printf("%v: job started\n", persistentId)
-			job, err := doWork(job)
-			if err != nil {
+			logCtx := jobContext(job)
+			logging.Logger.InfoContext(logCtx, "job started", "persistentId", persistentId, "plugin", job.Plugin, "files", len(job.WritableNodes))
+			leaseCtx, endLease := startLease(job, popped)
+			job, err := doWork(leaseCtx, job)
+			if context.Cause(leaseCtx) == errLeaseLost {
+				// another worker took over the job: its state (the lock, the queue and the report) is no longer ours to change
+				logging.Logger.ErrorContext(logCtx, "job aborted after the lease was lost", "persistentId", persistentId, "error", err)
+				endLease()
+				busyWorkers.Add(-1)
+				continue
+			}
+			if err != nil && stopping() {
+				// interrupted by the shutdown: not counted as an error, the remaining files are re-queued for the next start (or another instance)
+				logging.Logger.InfoContext(logCtx, "job interrupted by shutdown, re-queuing remaining files", "persistentId", persistentId, "files", len(job.WritableNodes), "error", err)
+			} else if httpclient.IsCircuitOpen(err) {
+				// Dataverse went down: not counted as an error, the job waits in the queue until Dataverse is available again
+				logging.Logger.WarnContext(logCtx, "job paused while Dataverse is unavailable, re-queuing remaining files", "persistentId", persistentId, "files", len(job.WritableNodes), "error", err)
+			} else if err != nil {
 				job.ErrCnt = job.ErrCnt + 1
 				if job.ErrCnt == maxErrors {
-					logging.Logger.Println("job failed and will not be retried:", persistentId, err)
+					logging.Logger.ErrorContext(logCtx, "job failed and will not be retried", "persistentId", persistentId, "error", err)
 					sendJobFailedMail(err, job)
+				} else if len(job.WritableNodes) == 0 {
+					// nothing left to retry, e.g., publishing failed or the failed files were given up in the ContinueOnError mode
+					logging.Logger.ErrorContext(logCtx, "job failed", "persistentId", persistentId, "error", err)
 				} else {
-					logging.Logger.Println("job failed, but will retry:", persistentId, err)
+					logging.Logger.WarnContext(logCtx, "job failed, but will retry", "persistentId", persistentId, "error", err)
+					storeJobReport(job, false)
 					time.Sleep(10 * time.Second)
 				}
 			}
+			if !endLease() {
+				logging.Logger.ErrorContext(logCtx, "job result dropped after the lease was lost", "persistentId", persistentId)
+				busyWorkers.Add(-1)
+				continue
+			}
 			if len(job.WritableNodes) > 0 && job.ErrCnt < maxErrors {
 				ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
 				err = addJob(ctx, job, false)
 				cancel()
 				if err != nil {
-					logging.Logger.Println("re-adding job failed (no retry):", persistentId, err)
-					unlock(persistentId)
+					logging.Logger.ErrorContext(logCtx, "re-adding job failed (no retry)", "persistentId", persistentId, "error", err)
+					finishJob(job)
+					publishJobDone(logCtx, job, err)
 				}
 			} else {
-				unlock(persistentId)
-				logging.Logger.Printf("%v: job ended\n", persistentId)
+				finishJob(job)
+				publishJobDone(logCtx, job, err)
+				logging.Logger.InfoContext(logCtx, "job ended", "persistentId", persistentId, "filesWritten", job.Report.FilesWritten, "bytesWritten", job.Report.BytesWritten, "notProcessed", len(notProcessed(job)))
 			}
+			busyWorkers.Add(-1)
+		}
+	}
+}
+
+// BusyWorkers returns the number of workers of this process that are running a job
+func BusyWorkers() int {
+	return int(busyWorkers.Load())
+}
+
+// QueuedJobs returns the number of jobs waiting for a worker of this process
+func QueuedJobs(ctx context.Context) (int, error) {
+	res := 0
+	for _, q := range workerQueues() {
+		n, err := config.GetRedis().LLen(ctx, q)
+		if err != nil {
+			return 0, err
 		}
+		res += int(n)
+	}
+	return res, nil
+}
+
+func finishJob(job Job) {
+	if job.Plugin == fixityPlugin {
+		finishFixityReport(job)
+		unlock(job.PersistentId)
+		return
+	}
+	if job.Plugin == bagPlugin {
+		unlock(job.PersistentId)
+		return
+	}
+	if job.Plugin == exportPlugin {
+		storeExportReport(job)
+		unlock(job.PersistentId)
+		return
 	}
+	storeFailedJob(job)
+	writeProvenance(job)
+	writeRoCrate(job)
+	storeJobReport(job, true)
+	audit := auditJob(job)
+	archiveJob(job, audit)
+	recordHistory(job)
+	checkQuota(job)
+	unlock(job.PersistentId)
 }
@@ -0,0 +1,57 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"fmt"
+	"integration/app/config"
+	"integration/app/tree"
+)
+
+// CheckJobLimits returns an error wrapping ErrQuotaExceeded when the files selected for copy or update exceed the limits
+// of the plugin and the dataset (see the "jobLimits" option), a bundle counts as one file with the size of its members
+func CheckJobLimits(plugin, pluginId, persistentId string, nodes map[string]tree.Node, bundles map[string]Bundle) error {
+	files, size := 0, int64(0)
+	for _, v := range nodes {
+		if v.Attributes.IsFile && (v.Action == tree.Copy || v.Action == tree.Update) {
+			files, size = files+1, size+v.Attributes.RemoteFilesize
+		}
+	}
+	for _, b := range bundles {
+		for _, v := range b.Members {
+			size += v.Attributes.RemoteFilesize
+		}
+	}
+	if exceeded := exceededLimits(config.GetJobLimits(plugin, pluginId, persistentId), files, size); exceeded != "" {
+		return fmt.Errorf("%w: %v", ErrQuotaExceeded, exceeded)
+	}
+	return nil
+}
+
+// JobLimitsWarning checks the limits at compare time, for the files that are selected by default (the new and updated files)
+func JobLimitsWarning(plugin, pluginId, persistentId string, nodes []tree.Node) (Warning, bool) {
+	files, size := 0, int64(0)
+	for _, v := range nodes {
+		if v.Status == tree.New || v.Status == tree.Updated {
+			files, size = files+1, size+v.Attributes.RemoteFilesize
+		}
+	}
+	exceeded := exceededLimits(config.GetJobLimits(plugin, pluginId, persistentId), files, size)
+	if exceeded == "" {
+		return Warning{}, false
+	}
+	return Warning{
+		Type:    WarningQuotaExceeded,
+		Message: fmt.Sprintf("%v: %v, select fewer files and synchronize them in several jobs", ErrQuotaExceeded, exceeded),
+	}, true
+}
+
+func exceededLimits(limits config.JobLimits, files int, size int64) string {
+	switch {
+	case limits.MaxFiles > 0 && files > limits.MaxFiles:
+		return fmt.Sprintf("%d files to copy or update, at most %d files are allowed in one job", files, limits.MaxFiles)
+	case limits.MaxTotalSize > 0 && size > limits.MaxTotalSize:
+		return fmt.Sprintf("%d bytes to copy or update, at most %d bytes are allowed in one job", size, limits.MaxTotalSize)
+	}
+	return ""
+}
@@ -0,0 +1,244 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const defaultLockHeartbeat = 30 * time.Second
+
+var errLeaseLost = errors.New("the lease of the job was lost")
+
+// identifies the worker process holding the leases
+var workerId = func() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%v-%v-%v", host, os.Getpid(), uuid.New().String()[:8])
+}()
+
+func lockHeartbeat() time.Duration {
+	if s := config.GetConfig().Options.LockHeartbeat; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultLockHeartbeat
+}
+
+// a lease expires after three missed heartbeats
+func leaseDuration() time.Duration {
+	return 3 * lockHeartbeat()
+}
+
+// processingKey is the queue of the jobs popped by the workers of this process that do not have a lease yet
+func processingKey(worker string) string {
+	return "processing: " + worker
+}
+
+func workerHeartbeatKey(worker string) string {
+	return "worker heartbeat: " + worker
+}
+
+// startLease keeps a copy of the running job (so it can be re-queued when the worker dies), takes the lease and renews it until
+// the returned function is called; the returned context is cancelled when the lease is lost (e.g., the worker could not renew it
+// in time and the job was re-queued for another worker), the returned function then returns false and the job must be dropped
+// by this worker. The popped value is removed from the processing queue once the lease is taken.
+func startLease(job Job, popped string) (context.Context, func() bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	leaseCtx, abort := context.WithCancelCause(jobContext(job))
+	b, err := marshalJob(job)
+	if err != nil {
+		logging.Logger.Error("marshalling running job failed", "persistentId", job.PersistentId, "error", err)
+		b = []byte(popped)
+	}
+	config.GetRedis().Set(ctx, "running: "+job.PersistentId, string(b), config.LockMaxDuration)
+	config.GetRedis().Set(ctx, "lease: "+job.PersistentId, workerId, leaseDuration())
+	config.GetRedis().SAdd(ctx, "running jobs", job.PersistentId)
+	config.GetRedis().LRem(ctx, processingKey(workerId), popped)
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockHeartbeat())
+		defer ticker.Stop()
+		renewed := time.Now()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), lockHeartbeat())
+				ok, err := config.GetRedis().RenewLease(ctx, "lease: "+job.PersistentId, workerId, leaseDuration())
+				cancel()
+				if ok {
+					renewed = time.Now()
+					continue
+				}
+				if err == nil || time.Since(renewed) > leaseDuration() {
+					// the lease expired or is held by another worker: this worker stops, the job belongs to the new owner
+					logging.Logger.ErrorContext(leaseCtx, "lease lost, aborting the job", "persistentId", job.PersistentId, "error", err)
+					abort(errLeaseLost)
+					return
+				}
+			}
+		}
+	}()
+	return leaseCtx, func() bool {
+		close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+		defer cancel()
+		if leaseCtx.Err() != nil {
+			return false
+		}
+		if released, err := config.GetRedis().ReleaseLease(ctx, "lease: "+job.PersistentId, workerId); err == nil && !released {
+			logging.Logger.ErrorContext(leaseCtx, "lease lost, dropping the job", "persistentId", job.PersistentId)
+			abort(errLeaseLost)
+			return false
+		}
+		abort(nil)
+		config.GetRedis().Del(ctx, "running: "+job.PersistentId, progressKey(job.PersistentId))
+		config.GetRedis().SRem(ctx, "running jobs", job.PersistentId)
+		return true
+	}
+}
+
+// HoldLease sets the key to the id of this process and renews it until the returned function is called, so that the other
+// instances can tell when the work done in the background of this process (e.g., a migration) was interrupted by its stop
+func HoldLease(key string) func() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	config.GetRedis().Set(ctx, key, workerId, leaseDuration())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(lockHeartbeat())
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), lockHeartbeat())
+				config.GetRedis().Set(ctx, key, workerId, leaseDuration())
+				cancel()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+		defer cancel()
+		config.GetRedis().ReleaseLease(ctx, key, workerId)
+	}
+}
+
+// LeaseHeld tells whether a process still renews the lease of the key (see HoldLease)
+func LeaseHeld(ctx context.Context, key string) bool {
+	owner, _ := config.GetRedis().Get(ctx, key)
+	return owner != ""
+}
+
+// ReclaimOrphanedLocks periodically re-queues the running jobs whose worker stopped renewing the lease (e.g., after a crash),
+// it also publishes the heartbeat of the workers of this process (see WorkersAlive)
+func ReclaimOrphanedLocks() {
+	defer Wait.Done()
+	workersHeartbeat()
+	for {
+		select {
+		case <-Stop:
+			return
+		case <-time.After(lockHeartbeat()):
+		}
+		workersHeartbeat()
+		reclaimOrphanedLocks()
+	}
+}
+
+func workersHeartbeat() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	config.GetRedis().Set(ctx, "workers heartbeat", workerId, leaseDuration())
+	config.GetRedis().Set(ctx, workerHeartbeatKey(workerId), workerId, leaseDuration())
+	config.GetRedis().SAdd(ctx, "workers", workerId)
+}
+
+// WorkersAlive reports whether the workers of at least one process sent a heartbeat within the lease duration
+func WorkersAlive(ctx context.Context) bool {
+	heartbeat, _ := config.GetRedis().Get(ctx, "workers heartbeat")
+	return heartbeat != ""
+}
+
+func reclaimOrphanedLocks() {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	reclaimProcessing(ctx)
+	running, err := config.GetRedis().SMembers(ctx, "running jobs")
+	if err != nil {
+		return
+	}
+	for _, pid := range running {
+		if lease, _ := config.GetRedis().Get(ctx, "lease: "+pid); lease != "" {
+			continue
+		}
+		// only one janitor (of possibly many instances) reclaims the job
+		if ok, _ := config.GetRedis().SetNX(ctx, "reclaim: "+pid, workerId, leaseDuration()); !ok {
+			continue
+		}
+		cached, _ := config.GetRedis().Get(ctx, "running: "+pid)
+		config.GetRedis().Del(ctx, "running: "+pid)
+		config.GetRedis().SRem(ctx, "running jobs", pid)
+		job, err := unmarshalJob([]byte(cached))
+		if cached == "" || err != nil {
+			logging.Logger.Warn("releasing orphaned lock", "persistentId", pid)
+			unlock(pid)
+			continue
+		}
+		logging.Logger.WarnContext(logging.WithCorrelationId(ctx, job.CorrelationId), "lease expired, re-queuing the orphaned job", "persistentId", pid)
+		err = addJob(ctx, job, false)
+		if err != nil {
+			logging.Logger.ErrorContext(logging.WithCorrelationId(ctx, job.CorrelationId), "re-queuing orphaned job failed", "persistentId", pid, "error", err)
+			unlock(pid)
+		}
+	}
+}
+
+// reclaimProcessing re-queues the jobs popped by the workers that stopped before they took the lease of the job, the jobs with a
+// running copy are re-queued by reclaimOrphanedLocks once their lease expired
+func reclaimProcessing(ctx context.Context) {
+	workers, err := config.GetRedis().SMembers(ctx, "workers")
+	if err != nil {
+		return
+	}
+	for _, worker := range workers {
+		if heartbeat, _ := config.GetRedis().Get(ctx, workerHeartbeatKey(worker)); heartbeat != "" {
+			continue
+		}
+		if ok, _ := config.GetRedis().SetNX(ctx, "reclaim: "+processingKey(worker), workerId, leaseDuration()); !ok {
+			continue
+		}
+		for {
+			popped, err := config.GetRedis().RPop(ctx, processingKey(worker))
+			if err != nil {
+				break
+			}
+			job, err := unmarshalJob([]byte(popped))
+			if err != nil {
+				logging.Logger.Warn("dropping malformed popped job", "worker", worker, "error", err)
+				continue
+			}
+			if running, _ := config.GetRedis().Get(ctx, "running: "+job.PersistentId); running != "" {
+				continue
+			}
+			logging.Logger.WarnContext(logging.WithCorrelationId(ctx, job.CorrelationId), "worker stopped before starting the job, re-queuing it", "persistentId", job.PersistentId, "worker", worker)
+			if err := addJob(ctx, job, false); err != nil {
+				logging.Logger.ErrorContext(logging.WithCorrelationId(ctx, job.CorrelationId), "re-queuing popped job failed", "persistentId", job.PersistentId, "error", err)
+				unlock(job.PersistentId)
+			}
+		}
+		config.GetRedis().SRem(ctx, "workers", worker)
+	}
+}
@@ -0,0 +1,31 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"integration/app/config"
+	"testing"
+)
+
+func TestHoldLease(t *testing.T) {
+	config.SetRedis(config.NewMemoryClient())
+	ctx := context.Background()
+	key := "migration lease: test"
+	release := HoldLease(key)
+	if !LeaseHeld(ctx, key) {
+		t.Fatal("the lease is not held")
+	}
+	release()
+	if LeaseHeld(ctx, key) {
+		t.Fatal("the lease is still held after the release")
+	}
+
+	// the lease taken over by another process is not released
+	release = HoldLease(key)
+	config.GetRedis().Set(ctx, key, "other", leaseDuration())
+	release()
+	if !LeaseHeld(ctx, key) {
+		t.Fatal("the lease of the other process was released")
+	}
+}
@@ -0,0 +1,201 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type DatasetMetadata struct {
+	Title        string        `json:"title,omitempty"`
+	Description  string        `json:"description,omitempty"`
+	Subjects     []string      `json:"subjects,omitempty"`
+	Authors      []Author      `json:"authors,omitempty"`
+	Contacts     []Contact     `json:"contacts,omitempty"`
+	Contributors []Contributor `json:"contributors,omitempty"`
+}
+
+type Author struct {
+	Name        string `json:"name"`
+	Affiliation string `json:"affiliation,omitempty"`
+	Identifier  string `json:"identifier,omitempty"`
+}
+
+type Contact struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Contributor is a contributor of the citation metadata, the type is one of the contributor types of Dataverse (e.g., "Data Curator")
+type Contributor struct {
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	Identifier string `json:"identifier,omitempty"` // ORCID iD
+}
+
+// MetadataFiles are the metadata files of a repository that can be read into the dataset metadata, in order of preference
+var MetadataFiles = []string{"CITATION.cff", "codemeta.json"}
+
+// Merge fills the missing metadata with the metadata of the other, e.g., the metadata read from a file with the defaults
+func (md DatasetMetadata) Merge(other DatasetMetadata) DatasetMetadata {
+	if md.Title == "" {
+		md.Title = other.Title
+	}
+	if md.Description == "" {
+		md.Description = other.Description
+	}
+	if len(md.Subjects) == 0 {
+		md.Subjects = other.Subjects
+	}
+	if len(md.Authors) == 0 {
+		md.Authors = other.Authors
+	}
+	if len(md.Contacts) == 0 {
+		md.Contacts = other.Contacts
+	}
+	if len(md.Contributors) == 0 {
+		md.Contributors = other.Contributors
+	}
+	return md
+}
+
+// ParseMetadataFile reads the metadata from the content of one of the MetadataFiles, the keywords are not mapped on the subjects
+// as the subjects of Dataverse are a controlled vocabulary
+func ParseMetadataFile(name string, content []byte) (DatasetMetadata, error) {
+	switch name {
+	case "CITATION.cff":
+		return metadataFromCff(content)
+	case "codemeta.json":
+		return metadataFromCodemeta(content)
+	}
+	return DatasetMetadata{}, fmt.Errorf("unsupported metadata file: %v", name)
+}
+
+type cffPerson struct {
+	GivenNames  string `yaml:"given-names"`
+	FamilyNames string `yaml:"family-names"`
+	Name        string `yaml:"name"` // entities, e.g., an organization
+	Affiliation string `yaml:"affiliation"`
+	Orcid       string `yaml:"orcid"`
+	Email       string `yaml:"email"`
+}
+
+func (p cffPerson) name() string {
+	return personName(p.GivenNames, p.FamilyNames, p.Name)
+}
+
+type cff struct {
+	Title    string      `yaml:"title"`
+	Abstract string      `yaml:"abstract"`
+	Authors  []cffPerson `yaml:"authors"`
+	Contact  []cffPerson `yaml:"contact"`
+}
+
+func metadataFromCff(content []byte) (DatasetMetadata, error) {
+	c := cff{}
+	if err := yaml.Unmarshal(content, &c); err != nil {
+		return DatasetMetadata{}, fmt.Errorf("parsing CITATION.cff failed: %w", err)
+	}
+	res := DatasetMetadata{Title: strings.TrimSpace(c.Title), Description: strings.TrimSpace(c.Abstract)}
+	for _, a := range c.Authors {
+		if a.name() != "" {
+			res.Authors = append(res.Authors, Author{Name: a.name(), Affiliation: a.Affiliation, Identifier: orcid(a.Orcid)})
+		}
+	}
+	for _, p := range c.Contact {
+		if p.Email != "" {
+			res.Contacts = append(res.Contacts, Contact{Name: p.name(), Email: p.Email})
+		}
+	}
+	return res, nil
+}
+
+type codemetaPerson struct {
+	Id          string          `json:"@id"`
+	GivenName   string          `json:"givenName"`
+	FamilyName  string          `json:"familyName"`
+	Name        string          `json:"name"`
+	Email       string          `json:"email"`
+	Affiliation json.RawMessage `json:"affiliation"` // a name or an organization
+}
+
+type codemeta struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Author      json.RawMessage `json:"author"` // a person or a list of persons
+	Maintainer  json.RawMessage `json:"maintainer"`
+}
+
+func metadataFromCodemeta(content []byte) (DatasetMetadata, error) {
+	c := codemeta{}
+	if err := json.Unmarshal(content, &c); err != nil {
+		return DatasetMetadata{}, fmt.Errorf("parsing codemeta.json failed: %w", err)
+	}
+	res := DatasetMetadata{Title: strings.TrimSpace(c.Name), Description: strings.TrimSpace(c.Description)}
+	for _, a := range codemetaPersons(c.Author) {
+		name := personName(a.GivenName, a.FamilyName, a.Name)
+		if name != "" {
+			res.Authors = append(res.Authors, Author{Name: name, Affiliation: codemetaAffiliation(a.Affiliation), Identifier: orcid(a.Id)})
+		}
+	}
+	// the maintainers are the contacts, the authors when there are none
+	contacts := codemetaPersons(c.Maintainer)
+	if len(contacts) == 0 {
+		contacts = codemetaPersons(c.Author)
+	}
+	for _, p := range contacts {
+		if p.Email != "" {
+			res.Contacts = append(res.Contacts, Contact{Name: personName(p.GivenName, p.FamilyName, p.Name), Email: p.Email})
+		}
+	}
+	return res, nil
+}
+
+func codemetaPersons(raw json.RawMessage) []codemetaPerson {
+	res := []codemetaPerson{}
+	if json.Unmarshal(raw, &res) == nil {
+		return res
+	}
+	p := codemetaPerson{}
+	if json.Unmarshal(raw, &p) == nil {
+		return []codemetaPerson{p}
+	}
+	return nil
+}
+
+func codemetaAffiliation(raw json.RawMessage) string {
+	name := ""
+	if json.Unmarshal(raw, &name) == nil {
+		return name
+	}
+	org := struct {
+		Name string `json:"name"`
+	}{}
+	json.Unmarshal(raw, &org)
+	return org.Name
+}
+
+// personName is the name as Dataverse shows the authors: "Family, Given", or the name of an organization
+func personName(given, family, name string) string {
+	given, family = strings.TrimSpace(given), strings.TrimSpace(family)
+	switch {
+	case family != "" && given != "":
+		return family + ", " + given
+	case family != "":
+		return family
+	}
+	return strings.TrimSpace(name)
+}
+
+// orcid returns the ORCID iD without the URL prefix, empty when the identifier is not an ORCID iD
+func orcid(id string) string {
+	id = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(id), "https://orcid.org/"), "http://orcid.org/")
+	if len(id) != 19 || strings.Count(id, "-") != 3 {
+		return ""
+	}
+	return id
+}
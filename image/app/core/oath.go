@@ -6,13 +6,16 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"integration/app/config"
+	"integration/app/httpclient"
 	"integration/app/logging"
 	"io"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -28,6 +31,8 @@ type OauthTokenRequest struct {
 
 type OauthTokenResponse struct {
 	AccessToken           string `json:"access_token"`
+	Orcid                 string `json:"orcid,omitempty"` // only in the responses of ORCID, with the name of the user
+	Name                  string `json:"name,omitempty"`
 	JwtToken              string `json:"id_token"`
 	ExpiresIn             int    `json:"expires_in"`
 	RefreshToken          string `json:"refresh_token"`
@@ -42,6 +47,8 @@ type OauthTokenResponse struct {
 
 type OauthTokenResponseStrings struct {
 	AccessToken           string `json:"access_token"`
+	Orcid                 string `json:"orcid,omitempty"`
+	Name                  string `json:"name,omitempty"`
 	JwtToken              string `json:"id_token"`
 	ExpiresIn             string `json:"expires_in"`
 	RefreshToken          string `json:"refresh_token"`
@@ -55,6 +62,10 @@ type OauthTokenResponseStrings struct {
 
 type TokenResponse struct {
 	SessionId string `json:"session_id"`
+	Orcid     string `json:"orcid,omitempty"` // the ORCID iD of the ORCID login
+	Name      string `json:"name,omitempty"`
+	// Expiration of the cached tokens, e.g., for the index of the user data
+	Expiration time.Duration `json:"-"`
 }
 
 type ExchangeRequest struct {
@@ -72,8 +83,23 @@ type ExchangeResponse struct {
 var PluginConfig = map[string]config.RepoPlugin{}
 var RedirectUri string
 
+func TokenCacheKey(pluginId, sessionId string) string {
+	return fmt.Sprintf("%v-%v", pluginId, sessionId)
+}
+
+// errClientRejected is returned when the token endpoint refuses the client credentials, e.g., after the client secret has been rotated
+var errClientRejected = errors.New("client credentials rejected")
+
 func GetOauthToken(ctx context.Context, pluginId, code, refreshToken, sessionId string) (TokenResponse, error) {
-	res := TokenResponse{sessionId}
+	res, err := getOauthToken(ctx, pluginId, code, refreshToken, sessionId)
+	if errors.Is(err, errClientRejected) && config.RefreshSecret(ctx, config.SecretOauthSecrets) {
+		return getOauthToken(ctx, pluginId, code, refreshToken, sessionId)
+	}
+	return res, err
+}
+
+func getOauthToken(ctx context.Context, pluginId, code, refreshToken, sessionId string) (TokenResponse, error) {
+	res := TokenResponse{SessionId: sessionId}
 	clientId := PluginConfig[pluginId].TokenGetter.OauthClientId
 	redirectUri := RedirectUri
 	clientSecret, resource, postUrl, exchange, err := config.ClientSecret(clientId)
@@ -91,13 +117,16 @@ func GetOauthToken(ctx context.Context, pluginId, code, refreshToken, sessionId
 	//request.Header.Add("Content-Type", "application/json")
 	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	request.Header.Add("Accept", "application/json")
-	r, err := http.DefaultClient.Do(request)
+	r, err := httpclient.Get("oauth").Do(request)
 	if err != nil {
 		return res, fmt.Errorf("getting API token failed: %v", err)
 	}
 	defer r.Body.Close()
 	if r.StatusCode != 200 {
 		b, _ := io.ReadAll(r.Body)
+		if r.StatusCode == http.StatusUnauthorized || strings.Contains(string(b), "invalid_client") {
+			return res, fmt.Errorf("getting API token failed: %w: %d - %s", errClientRejected, r.StatusCode, string(b))
+		}
 		return res, fmt.Errorf("getting API token failed: %d - %s", r.StatusCode, string(b))
 	}
 	b, err := io.ReadAll(r.Body)
@@ -113,6 +142,8 @@ func GetOauthToken(ctx context.Context, pluginId, code, refreshToken, sessionId
 		exp2, _ := strconv.Atoi(resultStrings.RefreshTokenExpiresIn)
 		result = OauthTokenResponse{
 			AccessToken:           resultStrings.AccessToken,
+			Orcid:                 resultStrings.Orcid,
+			Name:                  resultStrings.Name,
 			ExpiresIn:             exp,
 			RefreshToken:          resultStrings.RefreshToken,
 			RefreshTokenExpiresIn: exp2,
@@ -140,6 +171,10 @@ func GetOauthToken(ctx context.Context, pluginId, code, refreshToken, sessionId
 			TokenType:             params.Get("token_type"),
 		}
 	}
+	if result.RefreshToken == "" && refreshToken != "" {
+		// not every server rotates the refresh token, the old one remains valid then
+		result.RefreshToken = refreshToken
+	}
 	if exchange != "" {
 		result, err = doExchange(ctx, result, exchange)
 		if err != nil {
@@ -147,40 +182,103 @@ func GetOauthToken(ctx context.Context, pluginId, code, refreshToken, sessionId
 		}
 	}
 	result.Issued = time.Now()
+	res.Orcid, res.Name = result.Orcid, result.Name
 	tokenBytes, err := json.Marshal(result)
 	if err != nil {
 		return res, err
 	}
-	config.GetRedis().Set(ctx, fmt.Sprintf("%v-%v", pluginId, sessionId), string(tokenBytes), config.LockMaxDuration)
+	encrypted, err := encryptSecret(string(tokenBytes), TokenCacheKey(pluginId, sessionId))
+	if err != nil {
+		return res, err
+	}
+	res.Expiration = tokenTTL(result)
+	config.GetRedis().Set(ctx, TokenCacheKey(pluginId, sessionId), encrypted, res.Expiration)
 	return res, nil
 }
 
+// tokenTTL keeps the tokens as long as they can be used: until the access token expires, or the refresh token when there is one
+func tokenTTL(token OauthTokenResponse) time.Duration {
+	switch {
+	case token.RefreshToken != "" && token.RefreshTokenExpiresIn > 0:
+		return time.Duration(token.RefreshTokenExpiresIn) * time.Second
+	case token.RefreshToken == "" && token.ExpiresIn > 0:
+		return time.Duration(token.ExpiresIn) * time.Second
+	}
+	return config.LockMaxDuration
+}
+
+// tokenRefreshMargin: the access tokens are refreshed this long before they expire
+const tokenRefreshMargin = 5 * time.Minute
+
+func tokenExpired(token OauthTokenResponse) bool {
+	if token.ExpiresIn <= 0 {
+		return false // no expiration announced by the server
+	}
+	return time.Now().After(token.Issued.Add(time.Duration(token.ExpiresIn)*time.Second - tokenRefreshMargin))
+}
+
+// GetTokenFromCache returns the access token of the session, refreshed with the refresh token when it is about to expire,
+// the token itself is returned when there is no OAuth token for the session
 func GetTokenFromCache(ctx context.Context, token, sessionId, pluginId string) string {
 	res, ok := getTokenFromCache(ctx, pluginId, sessionId)
 	if !ok {
 		return token
 	}
-	expired := time.Now().After(res.Issued.Add(time.Duration((res.ExpiresIn - 5*60)) * time.Second))
-	ok = true
-	if expired {
-		_, err := GetOauthToken(ctx, pluginId, "", res.RefreshToken, sessionId)
-		if err != nil {
-			logging.Logger.Println("token refresh failed:", err)
-			return res.AccessToken
+	if !tokenExpired(res) || res.RefreshToken == "" {
+		return res.AccessToken
+	}
+	refreshed, err := refreshOauthToken(ctx, pluginId, sessionId, res)
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "token refresh failed", "pluginId", pluginId, "error", err)
+		return res.AccessToken
+	}
+	return refreshed.AccessToken
+}
+
+// refreshOauthToken refreshes the token of the session once for all requests and workers:
+// the refresh tokens are often single use (e.g., GitLab), concurrent refreshes would invalidate the session
+func refreshOauthToken(ctx context.Context, pluginId, sessionId string, expired OauthTokenResponse) (OauthTokenResponse, error) {
+	lockKey := "token refresh: " + TokenCacheKey(pluginId, sessionId)
+	for i := 0; ; i++ {
+		if ok, _ := config.GetRedis().SetNX(ctx, lockKey, workerId, time.Minute); ok {
+			break
+		}
+		if i == 60 {
+			return expired, fmt.Errorf("waiting for the token refresh timed out")
+		}
+		select {
+		case <-ctx.Done():
+			return expired, ctx.Err()
+		case <-time.After(time.Second):
 		}
-		res, ok = getTokenFromCache(ctx, pluginId, sessionId)
-		if !ok {
-			logging.Logger.Println("token not in cache after refresh for plugin id:", pluginId)
-			return token
+		if t, ok := getTokenFromCache(ctx, pluginId, sessionId); ok && !tokenExpired(t) {
+			return t, nil
 		}
 	}
-	return res.AccessToken
+	defer config.GetRedis().Del(ctx, lockKey)
+	if t, ok := getTokenFromCache(ctx, pluginId, sessionId); ok && !tokenExpired(t) {
+		return t, nil // refreshed in the meantime
+	}
+	_, err := GetOauthToken(ctx, pluginId, "", expired.RefreshToken, sessionId)
+	if err != nil {
+		return expired, err
+	}
+	t, ok := getTokenFromCache(ctx, pluginId, sessionId)
+	if !ok {
+		return expired, fmt.Errorf("token not in cache after refresh")
+	}
+	logging.Logger.InfoContext(ctx, "token refreshed", "pluginId", pluginId)
+	return t, nil
 }
 
 func getTokenFromCache(ctx context.Context, pluginId, sessionId string) (OauthTokenResponse, bool) {
-	cached := config.GetRedis().Get(ctx, fmt.Sprintf("%v-%v", pluginId, sessionId))
-	jsonString := cached.Val()
-	if jsonString == "" {
+	cached, _ := config.GetRedis().Get(ctx, TokenCacheKey(pluginId, sessionId))
+	if cached == "" {
+		return OauthTokenResponse{}, false
+	}
+	jsonString, err := decryptSecret(cached, TokenCacheKey(pluginId, sessionId))
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "cached token could not be decrypted", "pluginId", pluginId, "error", err)
 		return OauthTokenResponse{}, false
 	}
 	res := OauthTokenResponse{}
@@ -217,7 +315,7 @@ func doExchange(ctx context.Context, in OauthTokenResponse, url string) (OauthTo
 	request, _ := http.NewRequestWithContext(ctx, "POST", url, body)
 	request.Header.Add("Content-Type", "application/json")
 	request.Header.Add("Accept", "application/json")
-	r, err := http.DefaultClient.Do(request)
+	r, err := httpclient.Get("oauth").Do(request)
 	if err != nil {
 		return res, fmt.Errorf("exchanging API token failed: %v", err)
 	}
@@ -0,0 +1,206 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcLoginDuration     = 10 * time.Minute
+	defaultOidcUserClaim  = "sub"
+	oidcDiscoveryDuration = time.Hour
+)
+
+// Identity is the authenticated user of an API call
+type Identity struct {
+	User    string         `json:"user"`
+	Email   string         `json:"email,omitempty"`
+	Name    string         `json:"name,omitempty"`
+	Method  string         `json:"method"` // "session", "bearer" or "api key"
+	Expires time.Time      `json:"expires,omitempty"`
+	ApiKey  *ServiceApiKey `json:"apiKey,omitempty"` // the scopes of the key when authenticated with a service API key
+}
+
+// oidcProvider is the discovered identity provider, with the verifiers of the ID tokens (issued for the client id) and of the
+// access tokens (issued for the configured audience), the signing keys are fetched again by the verifiers when they rotate
+type oidcProvider struct {
+	*oidc.Provider
+	idTokens     *oidc.IDTokenVerifier
+	accessTokens *oidc.IDTokenVerifier
+	discovered   time.Time
+}
+
+type oidcLogin struct {
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	Redirect string `json:"redirect"`
+}
+
+var provider *oidcProvider
+var providerMutex sync.Mutex
+
+type identityKey struct{}
+
+func WithIdentity(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// IdentityFromContext returns the identity of the user authenticated by the server (OIDC session or bearer token)
+func IdentityFromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
+
+// OidcEnabled is true when the API authenticates the users itself (instead of trusting the user header set by the Shibboleth proxy)
+func OidcEnabled() bool {
+	return config.GetConfig().Options.Oidc.Issuer != ""
+}
+
+func getProvider(ctx context.Context) (*oidcProvider, error) {
+	providerMutex.Lock()
+	defer providerMutex.Unlock()
+	if provider != nil && time.Since(provider.discovered) < oidcDiscoveryDuration {
+		return provider, nil
+	}
+	c := config.GetConfig().Options.Oidc
+	// the keys are fetched later with the context of the provider: the client is kept, the cancellation of the request is not
+	p, err := oidc.NewProvider(oidc.ClientContext(context.WithoutCancel(ctx), httpclient.Get("oidc")), strings.TrimSuffix(c.Issuer, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery failed: %v", err)
+	}
+	provider = &oidcProvider{
+		Provider:     p,
+		idTokens:     p.Verifier(&oidc.Config{ClientID: c.ClientId}),
+		accessTokens: p.Verifier(&oidc.Config{ClientID: c.Audience}),
+		discovered:   time.Now(),
+	}
+	return provider, nil
+}
+
+func oauthConfig(p *oidcProvider) *oauth2.Config {
+	c := config.GetConfig().Options.Oidc
+	scopes := c.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	return &oauth2.Config{
+		ClientID:     c.ClientId,
+		ClientSecret: config.Secret(config.SecretOidcClientSecret),
+		Endpoint:     p.Endpoint(),
+		RedirectURL:  c.RedirectUrl,
+		Scopes:       scopes,
+	}
+}
+
+func randomString() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// OidcLoginUrl starts the authorization code flow (with PKCE), the user is sent back to redirect after the login
+func OidcLoginUrl(ctx context.Context, redirect string) (string, error) {
+	p, err := getProvider(ctx)
+	if err != nil {
+		return "", err
+	}
+	state := randomString()
+	login := oidcLogin{Verifier: oauth2.GenerateVerifier(), Nonce: randomString(), Redirect: redirect}
+	b, _ := json.Marshal(login)
+	err = config.GetRedis().Set(ctx, "oidc login: "+state, string(b), oidcLoginDuration)
+	if err != nil {
+		return "", err
+	}
+	return oauthConfig(p).AuthCodeURL(state, oauth2.S256ChallengeOption(login.Verifier), oauth2.SetAuthURLParam("nonce", login.Nonce)), nil
+}
+
+// CompleteOidcLogin exchanges the code for the ID token and starts a session, the session id and the redirect of the login are returned
+func CompleteOidcLogin(ctx context.Context, code, state string) (sessionId, redirect string, err error) {
+	cached, _ := config.GetRedis().Get(ctx, "oidc login: "+state)
+	if cached == "" {
+		return "", "", fmt.Errorf("unknown or expired login")
+	}
+	config.GetRedis().Del(ctx, "oidc login: "+state)
+	login := oidcLogin{}
+	json.Unmarshal([]byte(cached), &login)
+	p, err := getProvider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	token, err := oauthConfig(p).Exchange(context.WithValue(ctx, oauth2.HTTPClient, httpclient.Get("oidc")), code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return "", "", err
+	}
+	rawIdToken, _ := token.Extra("id_token").(string)
+	if rawIdToken == "" {
+		return "", "", fmt.Errorf("no ID token in the token response")
+	}
+	idToken, err := p.idTokens.Verify(ctx, rawIdToken)
+	if err != nil {
+		return "", "", err
+	}
+	if idToken.Nonce != login.Nonce {
+		return "", "", fmt.Errorf("ID token nonce does not match")
+	}
+	identity, err := identityFromToken(idToken, "session")
+	if err != nil {
+		return "", "", err
+	}
+	sessionId, err = NewSession(ctx, Session{Identity: identity})
+	return sessionId, login.Redirect, err
+}
+
+// AuthenticateBearer verifies an access token (JWT) issued by the identity provider for the configured audience, the ID tokens
+// (issued for the client id) are not accepted
+func AuthenticateBearer(ctx context.Context, token string) (Identity, error) {
+	if config.GetConfig().Options.Oidc.Audience == "" {
+		return Identity{}, fmt.Errorf("bearer tokens are not accepted: no audience configured")
+	}
+	p, err := getProvider(ctx)
+	if err != nil {
+		return Identity{}, err
+	}
+	accessToken, err := p.accessTokens.Verify(ctx, token)
+	if err != nil {
+		return Identity{}, err
+	}
+	identity, err := identityFromToken(accessToken, "bearer")
+	if err != nil {
+		return identity, err
+	}
+	identity.Expires = accessToken.Expiry
+	return identity, nil
+}
+
+// identityFromToken keys the user on the "sub" claim (unique and never reassigned by the identity provider), or on the configured
+// user claim, that must be as immutable
+func identityFromToken(token *oidc.IDToken, method string) (Identity, error) {
+	claims := map[string]interface{}{}
+	if err := token.Claims(&claims); err != nil {
+		return Identity{}, err
+	}
+	userClaim := config.GetConfig().Options.Oidc.UserClaim
+	if userClaim == "" {
+		userClaim = defaultOidcUserClaim
+	}
+	user, _ := claims[userClaim].(string)
+	if user == "" {
+		return Identity{}, fmt.Errorf("token has no %v claim", userClaim)
+	}
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	return Identity{User: user, Email: email, Name: name, Method: method}, nil
+}
@@ -0,0 +1,108 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"regexp"
+	"time"
+)
+
+// OrcidPluginId is the id of the ORCID login in the OAuth flow (the token getter of the frontend configuration is registered under
+// this id), the token response of ORCID contains the ORCID iD and the name of the user
+const OrcidPluginId = "orcid"
+
+const orcidUrl = "https://orcid.org/"
+
+var orcidPattern = regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{3}[\dX]$`)
+
+// Orcid is the ORCID iD linked to the user by the ORCID login
+type Orcid struct {
+	Id     string    `json:"orcid"`
+	Name   string    `json:"name,omitempty"`
+	Linked time.Time `json:"linked"`
+}
+
+// Url is the ORCID iD as URI, as it should be displayed
+func (o Orcid) Url() string {
+	return orcidUrl + o.Id
+}
+
+func orcidKey(user string) string {
+	return "orcid: " + user
+}
+
+// LinkOrcid links the ORCID iD of the ORCID login to the user, until the user revokes it with the other stored data
+func LinkOrcid(ctx context.Context, user string, orcid Orcid) error {
+	if user == "" {
+		return fmt.Errorf("the ORCID iD can only be linked to a logged in user")
+	}
+	if !orcidPattern.MatchString(orcid.Id) {
+		return fmt.Errorf("invalid ORCID iD: %q", orcid.Id)
+	}
+	orcid.Linked = time.Now()
+	b, err := json.Marshal(orcid)
+	if err != nil {
+		return err
+	}
+	// not registered in the user data index (the entries of the index expire), it is listed by orcidUserData instead
+	return config.GetRedis().Set(ctx, orcidKey(user), string(b), 0)
+}
+
+// orcidUserData is the user data entry of the linked ORCID iD, false when the user did not log in with ORCID
+func orcidUserData(ctx context.Context, user string) (UserDataEntry, bool) {
+	orcid, ok := GetOrcid(ctx, user)
+	if !ok {
+		return UserDataEntry{}, false
+	}
+	return UserDataEntry{
+		Type:        "orcid",
+		Key:         orcidKey(user),
+		Description: "ORCID iD and name from the ORCID login, recorded in the audit log and the created datasets",
+		Created:     orcid.Linked,
+	}, true
+}
+
+// GetOrcid returns the ORCID iD linked to the user, false when the user did not log in with ORCID
+func GetOrcid(ctx context.Context, user string) (Orcid, bool) {
+	res := Orcid{}
+	if user == "" {
+		return res, false
+	}
+	s, _ := config.GetRedis().Get(ctx, orcidKey(user))
+	if s == "" || json.Unmarshal([]byte(s), &res) != nil || res.Id == "" {
+		return Orcid{}, false
+	}
+	return res, true
+}
+
+// orcidContributorType is the contributor type of the linked ORCID iDs in the created datasets, empty when they are not added
+func orcidContributorType() string {
+	switch t := config.GetConfig().Options.OrcidContributorType; t {
+	case "":
+		return "Other"
+	case "none":
+		return ""
+	default:
+		return t
+	}
+}
+
+// WithOrcidContributor adds the ORCID iD linked to the user as a contributor of the dataset to create
+func (md DatasetMetadata) WithOrcidContributor(ctx context.Context, user string) DatasetMetadata {
+	contributorType := orcidContributorType()
+	orcid, ok := GetOrcid(ctx, user)
+	if !ok || contributorType == "" {
+		return md
+	}
+	for _, c := range md.Contributors {
+		if c.Identifier == orcid.Id {
+			return md
+		}
+	}
+	md.Contributors = append(append([]Contributor{}, md.Contributors...), Contributor{Name: orcid.Name, Type: contributorType, Identifier: orcid.Id})
+	return md
+}
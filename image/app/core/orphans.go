@@ -0,0 +1,324 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/storage"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultOrphanAge is the age of the stored files that are not registered in Dataverse from which they are reported as orphans,
+// the younger files can still be registered by a running job
+const DefaultOrphanAge = 7 * 24 * time.Hour
+
+// the files written directly to the storage are tracked in Redis until they are registered in Dataverse, so that the files of a
+// failed or crashed job can be removed; the datasets with tracked files are in the "pending uploads" set
+const pendingUploadsSet = "pending uploads"
+
+func pendingUploadsKey(persistentId string) string {
+	return "pending uploads: " + persistentId
+}
+
+// Orphan is a stored file of a dataset that is not registered in any version of the dataset
+type Orphan struct {
+	PersistentId      string    `json:"persistentId"`
+	StorageIdentifier string    `json:"storageIdentifier"`
+	Size              int64     `json:"size,omitempty"` // not known for the tracked files of the drivers that can not be listed
+	Modified          time.Time `json:"modified"`
+	Removed           bool      `json:"removed"`
+}
+
+// trackUpload remembers the file written directly to the storage until it is registered (see untrackUploads)
+func trackUpload(ctx context.Context, persistentId, storageIdentifier string) {
+	shortContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), redisCtxDuration)
+	defer cancel()
+	config.GetRedis().SAdd(shortContext, pendingUploadsKey(persistentId), storageIdentifier)
+	config.GetRedis().SAdd(shortContext, pendingUploadsSet, persistentId)
+}
+
+func untrackUploads(ctx context.Context, persistentId string, storageIdentifiers []string) {
+	if len(storageIdentifiers) == 0 {
+		return
+	}
+	shortContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), redisCtxDuration)
+	defer cancel()
+	members := []interface{}{}
+	for _, id := range storageIdentifiers {
+		members = append(members, id)
+	}
+	config.GetRedis().SRem(shortContext, pendingUploadsKey(persistentId), members...)
+	if pending, err := config.GetRedis().SMembers(shortContext, pendingUploadsKey(persistentId)); err == nil && len(pending) == 0 {
+		config.GetRedis().SRem(shortContext, pendingUploadsSet, persistentId)
+	}
+}
+
+// discardUploads removes the files that were written to the storage but are not registered in Dataverse (e.g., the registration
+// failed), the files that could not be removed remain tracked
+func discardUploads(ctx context.Context, persistentId string, storageIdentifiers []string) {
+	shortContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteAndCleanupCtxDuration)
+	defer cancel()
+	removed := []string{}
+	for _, id := range storageIdentifiers {
+		if err := removeStored(shortContext, persistentId, id); err != nil {
+			logging.Logger.WarnContext(ctx, "removing the unregistered file failed", "persistentId", persistentId, "storageIdentifier", id, "error", err)
+			continue
+		}
+		logging.Logger.InfoContext(ctx, "unregistered file removed", "persistentId", persistentId, "storageIdentifier", id)
+		removed = append(removed, id)
+	}
+	untrackUploads(ctx, persistentId, removed)
+}
+
+func removeStored(ctx context.Context, persistentId, storageIdentifier string) error {
+	pid, err := trimProtocol(persistentId)
+	if err != nil {
+		return err
+	}
+	s := getStorage(storageIdentifier)
+	st, err := openStorage(ctx, s)
+	if err != nil {
+		return err
+	}
+	if exists, err := st.Exists(ctx, pid+"/"+s.filename); err != nil || !exists {
+		return err
+	}
+	return st.Delete(ctx, pid+"/"+s.filename)
+}
+
+// pendingUploads returns the tracked files of the dataset with the time they were written
+func pendingUploads(ctx context.Context, persistentId string) map[string]time.Time {
+	res := map[string]time.Time{}
+	ids, _ := config.GetRedis().SMembers(ctx, pendingUploadsKey(persistentId))
+	for _, id := range ids {
+		res[id] = writtenAt(getStorage(id).filename)
+	}
+	return res
+}
+
+// writtenAt returns the time in the generated file name (see generateFileName), the zero time when the name was not generated
+func writtenAt(fileName string) time.Time {
+	hexTimestamp, _, _ := strings.Cut(fileName, "-")
+	millis, err := strconv.ParseInt(hexTimestamp, 16, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis)
+}
+
+// registeredFiles returns the file names (without the driver and the bucket) of the storage identifiers of all versions of the dataset
+func registeredFiles(ctx context.Context, dataverseKey, user, persistentId string) (map[string]bool, error) {
+	ids, err := Destination.StorageIdentifiers(ctx, dataverseKey, user, persistentId)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]bool{}
+	for _, id := range ids {
+		res[getStorage(id).filename] = true
+	}
+	return res, nil
+}
+
+// discardPendingUploads removes the files left by a previous attempt of the job that crashed between writing the files and
+// registering them, called before the job writes to the dataset (no other job writes to it then)
+func discardPendingUploads(ctx context.Context, job Job) {
+	pending := pendingUploads(ctx, job.PersistentId)
+	if len(pending) == 0 {
+		return
+	}
+	registered, err := registeredFiles(ctx, job.DataverseKey, job.User, job.PersistentId)
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "listing the registered files failed, the unregistered files are not removed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	unregistered, kept := []string{}, []string{}
+	for id := range pending {
+		if registered[getStorage(id).filename] {
+			kept = append(kept, id)
+		} else {
+			unregistered = append(unregistered, id)
+		}
+	}
+	untrackUploads(ctx, job.PersistentId, kept)
+	discardUploads(ctx, job.PersistentId, unregistered)
+}
+
+// FindOrphans reports the stored files of the dataset older than olderThan that are not registered in any version of the dataset:
+// the files in the dataset folder of the drivers that can be listed (the file driver) and the tracked files of the failed jobs;
+// without persistentId, the datasets with tracked files are scanned; the datasets with a running job are skipped
+func FindOrphans(ctx context.Context, dataverseKey, user, persistentId string, olderThan time.Duration, remove bool) ([]Orphan, error) {
+	pids := []string{persistentId}
+	if persistentId == "" {
+		var err error
+		if pids, err = config.GetRedis().SMembers(ctx, pendingUploadsSet); err != nil {
+			return nil, err
+		}
+		sort.Strings(pids)
+	}
+	res := []Orphan{}
+	for _, pid := range pids {
+		if IsLocked(ctx, pid) {
+			if persistentId != "" {
+				return nil, fmt.Errorf("%w: a job is running for %v", ErrDatasetLocked, pid)
+			}
+			continue
+		}
+		orphans, err := datasetOrphans(ctx, dataverseKey, user, pid, time.Now().Add(-olderThan), remove)
+		if err != nil {
+			return nil, fmt.Errorf("scanning %v failed: %w", pid, err)
+		}
+		res = append(res, orphans...)
+	}
+	return res, nil
+}
+
+func datasetOrphans(ctx context.Context, dataverseKey, user, persistentId string, before time.Time, remove bool) ([]Orphan, error) {
+	registered, err := registeredFiles(ctx, dataverseKey, user, persistentId)
+	if err != nil {
+		return nil, err
+	}
+	candidates := map[string]Orphan{} // by file name
+	for id, written := range pendingUploads(ctx, persistentId) {
+		candidates[getStorage(id).filename] = Orphan{PersistentId: persistentId, StorageIdentifier: id, Modified: written}
+	}
+	if err := listStored(ctx, dataverseKey, user, persistentId, candidates); err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for name := range candidates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	res, tracked := []Orphan{}, []string{}
+	for _, name := range names {
+		o := candidates[name]
+		// the derived files (e.g., the original of an ingested tabular file or the thumbnails) are named after the registered file
+		base, _, _ := strings.Cut(name, ".")
+		if registered[name] || registered[base] {
+			tracked = append(tracked, o.StorageIdentifier)
+			continue
+		}
+		if o.Modified.After(before) {
+			continue
+		}
+		if remove {
+			if err := removeStored(ctx, persistentId, o.StorageIdentifier); err != nil {
+				logging.Logger.WarnContext(ctx, "removing the orphan failed", "persistentId", persistentId, "storageIdentifier", o.StorageIdentifier, "error", err)
+			} else {
+				o.Removed = true
+				tracked = append(tracked, o.StorageIdentifier)
+				logging.Logger.InfoContext(ctx, "orphan removed", "persistentId", persistentId, "storageIdentifier", o.StorageIdentifier, "size", o.Size)
+			}
+		}
+		res = append(res, o)
+	}
+	untrackUploads(ctx, persistentId, tracked)
+	return res, nil
+}
+
+// listStored adds the files of the dataset folder to the candidates when the storage driver of the dataset can be listed
+func listStored(ctx context.Context, dataverseKey, user, persistentId string, candidates map[string]Orphan) error {
+	driver, direct := storageDriver(ctx, Job{DataverseKey: dataverseKey, User: user, PersistentId: persistentId})
+	if !direct || driver == "" {
+		return nil
+	}
+	pid, err := trimProtocol(persistentId)
+	if err != nil {
+		return err
+	}
+	storageIdentifier := generateStorageIdentifier(ctx, driver, "")
+	st, err := openStorage(ctx, getStorage(storageIdentifier))
+	if err != nil {
+		return err
+	}
+	lister, ok := st.(storage.Lister)
+	if !ok {
+		return nil
+	}
+	objects, err := lister.List(ctx, pid+"/")
+	if err != nil {
+		return err
+	}
+	for _, o := range objects {
+		name := path.Base(o.Key)
+		candidates[name] = Orphan{PersistentId: persistentId, StorageIdentifier: storageIdentifier + name, Size: o.Size, Modified: o.Modified}
+	}
+	return nil
+}
+
+// the outcomes of cleanStorage in the job report
+const (
+	storageCleaned = "cleaned"
+	storageSkipped = "skipped"
+	storageRefused = "refused"
+	storageFailed  = "failed"
+)
+
+// cleanStorage removes the tracked files that this application could not remove itself (e.g., uploaded with signed URLs) with the
+// cleanStorage API of Dataverse; that API removes all unregistered files of the dataset, also the files of the direct uploads of
+// other tools that are not registered yet: its dry run must list only the tracked files, the storage is not cleaned otherwise;
+// the outcome is recorded in the report of the job
+func cleanStorage(ctx context.Context, job *Job) {
+	pending := pendingUploads(ctx, job.PersistentId)
+	if len(pending) == 0 {
+		return
+	}
+	if !config.GetConfig().Options.CleanStorage || job.SkipCleanStorage {
+		logging.Logger.InfoContext(ctx, "cleaning the storage is disabled, the failed uploads are left in the storage", "persistentId", job.PersistentId, "files", len(pending))
+		job.Report.StorageCleanup = storageSkipped
+		return
+	}
+	shortContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteAndCleanupCtxDuration)
+	defer cancel()
+	tracked := map[string]string{} // file name -> storage identifier
+	for id := range pending {
+		tracked[getStorage(id).filename] = id
+	}
+	listed, err := Destination.CleanupLeftOverFiles(shortContext, job.PersistentId, job.DataverseKey, job.User, true)
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "listing the unregistered files failed, the storage is not cleaned", "persistentId", job.PersistentId, "error", err)
+		job.Report.StorageCleanup = storageFailed
+		return
+	}
+	registered, err := registeredFiles(shortContext, job.DataverseKey, job.User, job.PersistentId)
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "listing the registered files failed, the storage is not cleaned", "persistentId", job.PersistentId, "error", err)
+		job.Report.StorageCleanup = storageFailed
+		return
+	}
+	unexplained := []string{}
+	for _, name := range listed {
+		base, _, _ := strings.Cut(name, ".")
+		if _, ok := tracked[base]; !ok || registered[base] {
+			unexplained = append(unexplained, name)
+		}
+	}
+	if len(unexplained) > 0 {
+		logging.Logger.WarnContext(ctx, "the storage is not cleaned: cleanStorage would remove files that were not written by this application", "persistentId", job.PersistentId, "files", unexplained)
+		job.Report.StorageCleanup = storageRefused
+		return
+	}
+	if len(listed) > 0 {
+		removed, err := Destination.CleanupLeftOverFiles(shortContext, job.PersistentId, job.DataverseKey, job.User, false)
+		if err != nil {
+			logging.Logger.WarnContext(ctx, "cleaning the storage failed", "persistentId", job.PersistentId, "error", err)
+			job.Report.StorageCleanup = storageFailed
+			return
+		}
+		logging.Logger.InfoContext(ctx, "storage cleaned", "persistentId", job.PersistentId, "removed", removed)
+	}
+	// the tracked files that were not listed are no longer in the storage, or they were registered meanwhile
+	ids := []string{}
+	for _, id := range tracked {
+		ids = append(ids, id)
+	}
+	untrackUploads(ctx, job.PersistentId, ids)
+	job.Report.StorageCleanup = storageCleaned
+}
@@ -0,0 +1,73 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"integration/app/httpclient"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"sort"
+)
+
+// in the ContinueOnError mode, a file is given up after maxFileAttempts failed attempts, and the attempt stops after
+// maxConsecutiveFailures failed files in a row (e.g., Dataverse rejects all files)
+const (
+	maxFileAttempts        = 3
+	maxConsecutiveFailures = 10
+)
+
+// continueAfter tells whether the job continues with the next file after a failed file, the failures that would make all
+// other files fail as well (e.g., a cancelled job, an exceeded quota, an unavailable Dataverse or an exceeded rate limit of the
+// repository) always stop the attempt
+func continueAfter(ctx context.Context, job Job, err error, consecutive int) bool {
+	if !job.ContinueOnError || ctx.Err() != nil || stopping() || consecutive >= maxConsecutiveFailures {
+		return false
+	}
+	return !errors.Is(err, ErrPermissionDenied) && !errors.Is(err, ErrQuotaExceeded) && !errors.Is(err, ErrDatasetLocked) && !errors.Is(err, types.ErrRateLimited) && !httpclient.IsCircuitOpen(err)
+}
+
+// giveUpFailed counts the failed attempts of the files that failed in the ContinueOnError mode: the files that failed maxFileAttempts
+// times are moved to the FailedNodes and are not retried; the returned error re-queues the job when other failed files remain
+func giveUpFailed(ctx context.Context, job *Job, failed map[string]error) error {
+	if job.FileAttempts == nil {
+		job.FileAttempts = map[string]int{}
+	}
+	if job.FailedNodes == nil {
+		job.FailedNodes = map[string]tree.Node{}
+	}
+	retried := []string{}
+	for k, err := range failed {
+		job.FileAttempts[k]++
+		if job.FileAttempts[k] < maxFileAttempts {
+			retried = append(retried, k)
+			continue
+		}
+		logging.Logger.WarnContext(ctx, "file failed too many times and is not retried", "persistentId", job.PersistentId, "file", k, "attempts", job.FileAttempts[k], "error", err)
+		job.FailedNodes[k] = job.WritableNodes[k]
+		delete(job.WritableNodes, k)
+	}
+	if len(retried) == 0 {
+		return nil
+	}
+	sort.Strings(retried)
+	return fmt.Errorf("%d files failed and will be retried, %v: %w", len(retried), retried[0], failed[retried[0]])
+}
+
+// notProcessed returns the files of the job that were not written: the remaining files and the files given up in the ContinueOnError mode
+func notProcessed(job Job) []string {
+	res := []string{}
+	for k := range job.WritableNodes {
+		res = append(res, k)
+	}
+	for k := range job.FailedNodes {
+		if _, ok := job.WritableNodes[k]; !ok {
+			res = append(res, k)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
@@ -4,6 +4,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"integration/app/config"
 	"integration/app/logging"
@@ -16,12 +17,18 @@ import (
 var FileNamesInCacheDuration = 5 * time.Minute
 var deleteAndCleanupCtxDuration = 5 * time.Minute
 
-func doWork(job Job) (Job, error) {
-	ctx, cancel := context.WithDeadline(context.Background(), job.Deadline)
+func doWork(leaseCtx context.Context, job Job) (Job, error) {
+	ctx, cancel := context.WithDeadline(leaseCtx, job.Deadline)
 	defer cancel()
+	// on shutdown, the job stops after the current file; the transfer is cancelled when that takes longer than the grace period
 	go func() {
 		select {
 		case <-Stop:
+		case <-ctx.Done():
+			return
+		}
+		select {
+		case <-time.After(ShutdownGracePeriod()):
 			cancel()
 		case <-ctx.Done():
 		}
@@ -29,15 +36,37 @@ func doWork(job Job) (Job, error) {
 	if job.Plugin == "hash-only" {
 		return doRehash(ctx, job.DataverseKey, job.User, job.PersistentId, job.WritableNodes, job)
 	}
+	if job.Plugin == fixityPlugin {
+		return doFixity(ctx, job)
+	}
+	if job.Plugin == bagPlugin {
+		return doBagExport(ctx, job)
+	}
+	if job.Plugin == exportPlugin {
+		return doExport(ctx, job)
+	}
 
 	job.StreamParams.Token = GetTokenFromCache(ctx, job.StreamParams.Token, job.SessionId, job.StreamParams.PluginId)
-	streams, err := stream.Streams(ctx, job.WritableNodes, job.Plugin, job.StreamParams)
+	// the OAuth tokens can expire during long jobs: the plugins get the refreshed token when opening the streams
+	token, sessionId, pluginId := job.StreamParams.Token, job.SessionId, job.StreamParams.PluginId
+	job.StreamParams.TokenSource = func() string {
+		return GetTokenFromCache(ctx, token, sessionId, pluginId)
+	}
+	if (config.GetConfig().Options.RoCrate.Enabled || config.GetConfig().Options.Provenance.Enabled) && job.Revision == "" {
+		revision, err := stream.Revision(ctx, job.Plugin, job.StreamParams)
+		job.Revision = revision
+		if err != nil {
+			logging.Logger.WarnContext(ctx, "getting the repository revision failed", "persistentId", job.PersistentId, "error", err)
+		}
+	}
+	streams, err := stream.Streams(ctx, streamedNodes(job), job.Plugin, job.StreamParams)
 	if err != nil {
 		return job, err
 	}
 	if streams.Cleanup != nil {
 		defer streams.Cleanup()
 	}
+	bundleStreams(streams.Streams, job.Bundles)
 	knownHashes := getKnownHashes(ctx, job.PersistentId)
 	//filter not valid actions (when someone had browser open for a very long time and other job started and finished)
 	writableNodes, err := filterRedundant(ctx, job, knownHashes)
@@ -46,14 +75,29 @@ func doWork(job Job) (Job, error) {
 	}
 	job.WritableNodes = writableNodes
 	j, err := doPersistNodeMap(ctx, streams.Streams, job, knownHashes)
+	recordDataFileIds(ctx, &j)
+	cleanStorage(ctx, &j)
 	if err != nil {
 		return j, err
 	}
+	if len(j.FailedNodes) > 0 && len(j.WritableNodes) == 0 {
+		// the dataset is not published with missing files
+		return j, sendJobFailedMail(fmt.Errorf("%d files could not be written, see the job report for the errors", len(j.FailedNodes)), j)
+	}
+	if j.Publish != "" && len(j.WritableNodes) == 0 {
+		logging.Logger.InfoContext(ctx, "publishing dataset", "persistentId", j.PersistentId, "version", j.Publish)
+		err = Destination.Publish(ctx, j.DataverseKey, j.User, j.PersistentId, j.Publish)
+		if err != nil {
+			j.Report.PublishError = err.Error()
+			return j, sendJobFailedMail(fmt.Errorf("publishing failed: %v", err), j)
+		}
+		j.Report.Published, j.Report.PublishError = j.Publish, ""
+	}
 	return j, sendJobSuccesMail(j)
 }
 
 func sendJobFailedMail(errIn error, job Job) error {
-	shortContext, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	shortContext, cancel := context.WithTimeout(jobContext(job), 5*time.Minute)
 	defer cancel()
 	config.GetRedis().Set(shortContext, fmt.Sprintf("error %v", job.PersistentId), errIn.Error(), FileNamesInCacheDuration)
 	to, err := Destination.GetUserEmail(shortContext, job.DataverseKey, job.User)
@@ -73,7 +117,7 @@ func sendJobSuccesMail(job Job) error {
 	if !job.SendEmailOnSucces {
 		return nil
 	}
-	shortContext, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	shortContext, cancel := context.WithTimeout(jobContext(job), 5*time.Minute)
 	defer cancel()
 	to, err := Destination.GetUserEmail(shortContext, job.DataverseKey, job.User)
 	if err != nil {
@@ -90,30 +134,38 @@ func sendJobSuccesMail(job Job) error {
 
 func filterRedundant(ctx context.Context, job Job, knownHashes map[string]calculatedHashes) (map[string]tree.Node, error) {
 	filteredEqual := map[string]tree.Node{}
-	isDelete := false
+	needsQuery := false
+	// the file ids of a compare with the latest version are those of the version the job writes to
+	comparedWithLatest := job.Version == "" || job.Version == LatestVersion
 	for k, v := range job.WritableNodes {
 		localHash := knownHashes[k].LocalHashValue
 		h, ok := knownHashes[k].RemoteHashes[v.Attributes.RemoteHashType]
 		if v.Action == tree.Delete {
-			isDelete = true
+			needsQuery = true
 		} else if ok && h == v.Attributes.RemoteHash && localHash == v.Attributes.DestinationFile.Hash {
 			continue
 		}
+		// an archive of a bundle replaces the archive written by a previous job
+		_, bundle := job.Bundles[k]
+		needsQuery = needsQuery || bundle || v.Attributes.DestinationFile.Id != 0 && !comparedWithLatest
 		filteredEqual[k] = v
 	}
-	if !isDelete {
+	if !needsQuery {
 		return filteredEqual, nil
 	}
+	// the compare could have been done against another version (e.g., latest published),
+	// the job always writes to the draft: resolve the file ids against the latest version (the draft when it exists)
 	res := map[string]tree.Node{}
-	nm, err := Destination.Query(ctx, job.PersistentId, job.DataverseKey, job.User)
+	nm, err := Destination.Query(ctx, job.PersistentId, LatestVersion, job.DataverseKey, job.User)
 	if err != nil {
 		return nil, err
 	}
 	for k, v := range filteredEqual {
-		_, ok := nm[k]
+		current, ok := nm[k]
 		if v.Action == tree.Delete && !ok {
 			continue
 		}
+		v.Attributes.DestinationFile.Id = current.Attributes.DestinationFile.Id
 		res[k] = v
 	}
 	return res, nil
@@ -126,8 +178,14 @@ func doPersistNodeMap(ctx context.Context, streams map[string]types.Stream, in J
 		return
 	}
 	defer storeKnownHashes(ctx, persistentId, knownHashes)
+	copied := getCopiedVersions(ctx, persistentId)
+	defer storeCopiedVersions(ctx, persistentId, copied)
 
 	out = in
+	driver, direct := storageDriver(ctx, in)
+	if direct && !Destination.IsSignedUrlUpload() {
+		discardPendingUploads(ctx, in)
+	}
 	i := 0
 	total := len(writableNodes)
 	writtenKeys := []string{}
@@ -135,69 +193,87 @@ func doPersistNodeMap(ctx context.Context, streams map[string]types.Stream, in J
 	toAddNodes := &[]tree.Node{}
 	toReplaceIdentifiers := &[]string{}
 	toReplaceNodes := &[]tree.Node{}
+	failed := map[string]error{} // the failed files in the ContinueOnError mode
+	consecutive := 0
+	throttle := newJobThrottle(persistentId)
+	defer throttle.done(ctx)
 	defer doFlush(ctx, toAddNodes, toReplaceNodes, &out, knownHashes, toAddIdentifiers, toReplaceIdentifiers)
 
-	for k, v := range writableNodes {
-		select {
-		case <-ctx.Done():
-			err = ctx.Err()
-			return
-		default:
-		}
-		i++
-		if i%10 == 0 && i < total {
-			storeKnownHashes(ctx, persistentId, knownHashes) //if we have many files to hash -> polling at the gui is happier to see some progress
-			logging.Logger.Printf("%v: processed %v/%v\n", persistentId, i, total)
-		}
-
-		redisKey := fmt.Sprintf("%v -> %v", persistentId, k)
-		if v.Action == tree.Delete {
-			err = deleteFile(ctx, dataverseKey, user, v.Attributes.DestinationFile.Id)
-			if err != nil {
-				return
+	// writeFile writes one file, the files written directly to the storage are registered in Dataverse when flushing
+	writeFile := func(k string, v tree.Node, fileStream types.Stream) (writeErr error) {
+		start := time.Now()
+		defer func() {
+			if writeErr != nil {
+				out.Report.addFile(k, FileResult{Result: fileFailed, Error: writeErr.Error(), Duration: time.Since(start).Milliseconds()})
 			}
-			delete(knownHashes, v.Id)
-			delete(out.WritableNodes, k)
-			config.GetRedis().Set(ctx, redisKey, types.Deleted, FileNamesInCacheDuration)
-			writtenKeys = append(writtenKeys, redisKey)
-			continue
+		}()
+		redisKey := fmt.Sprintf("%v -> %v", persistentId, k)
+		storageIdentifier := ""
+		if direct {
+			storageIdentifier = generateStorageIdentifier(ctx, driver, generateFileName())
+		}
+		if direct && !Destination.IsSignedUrlUpload() {
+			// the file is removed again when it is not written completely or can not be registered
+			trackUpload(ctx, persistentId, storageIdentifier)
+			defer func() {
+				if writeErr != nil {
+					discardUploads(ctx, persistentId, []string{storageIdentifier})
+				}
+			}()
 		}
-
-		fileStream := streams[k]
-		fileName := generateFileName()
-		storageIdentifier := generateStorageIdentifier(fileName)
 		hashType := config.GetConfig().Options.DefaultHash
 		remoteHashType := v.Attributes.RemoteHashType
 
-		var h []byte
-		var remoteH []byte
-		var size int64
-		h, remoteH, size, err = write(ctx, v.Attributes.DestinationFile.Id, dataverseKey, user, fileStream, storageIdentifier, persistentId, hashType, remoteHashType, k, v.Attributes.RemoteFilesize)
+		written, err := write(ctx, direct, v.Attributes.DestinationFile.Id, dataverseKey, user, fileStream, storageIdentifier, persistentId, hashType, remoteHashType, k, v.Description(), v.Attributes.RemoteFilesize)
 		if err != nil {
-			return
+			keepRegistered(out.WritableNodes, err)
+			return err
+		}
+		storageIdentifier = written.storageIdentifier
+		if direct && Destination.IsSignedUrlUpload() {
+			// the identifier is assigned by Dataverse, the file can only be removed with cleanStorage when it is not registered
+			trackUpload(ctx, persistentId, storageIdentifier)
 		}
 
-		hashValue := fmt.Sprintf("%x", h)
+		hashValue := fmt.Sprintf("%x", written.hash)
 		v.Attributes.DestinationFile.Hash = hashValue
 		v.Attributes.DestinationFile.HashType = hashType
-		v.Attributes.DestinationFile.Filesize = size
+		v.Attributes.DestinationFile.Filesize = written.size
 
 		//updated or new: always rehash
-		remoteHashVlaue := fmt.Sprintf("%x", remoteH)
-		if remoteHashType == types.GitHash {
-			remoteHashVlaue = v.Attributes.RemoteHash // gitlab does not provide filesize... If we do not know the filesize before calculating the hash, we can't calculate the git hash
+		remoteHashVlaue := fmt.Sprintf("%x", written.remoteHash)
+		if remoteHashType == types.GitHash && v.Attributes.RemoteFilesize > 0 && v.Attributes.RemoteFilesize != written.size {
+			// the git hash was calculated with the reported size as prefix, it can't match when the source reported a wrong size
+			logging.Logger.WarnContext(ctx, "reported size differs from the downloaded size, the git hash is not verified", "persistentId", persistentId, "file", k, "reportedSize", v.Attributes.RemoteFilesize, "size", written.size)
+			remoteHashVlaue = v.Attributes.RemoteHash
+		}
+		if remoteHashType == types.SizeAndTime {
+			// nothing to verify without a checksum, the size and time of the copied version are remembered for the next compare
+			remoteHashVlaue = v.Attributes.RemoteHash
 		}
 		if v.Attributes.RemoteHash != remoteHashVlaue && v.Attributes.RemoteHash != types.NotNeeded { // not all local file system hashes are calculated on beforehand (types.NotNeeded)
 			if remoteHashType == types.QuickXorHash { //some sharepoint hashes fail
-				logging.Logger.Println("WARNING: quickXorHash not equal, expected", v.Attributes.RemoteHash, "got", remoteHashVlaue)
+				logging.Logger.WarnContext(ctx, "quickXorHash not equal", "persistentId", persistentId, "file", k, "expected", v.Attributes.RemoteHash, "got", remoteHashVlaue)
 				remoteHashVlaue = v.Attributes.RemoteHash
 			} else {
-				err = fmt.Errorf("downloaded file hash not equal")
-				return
+				return fmt.Errorf("downloaded file hash not equal")
 			}
 		}
 
-		if Destination.IsDirectUpload() {
+		if written.transformed {
+			out.Report.addTransformation(k, Transformation{
+				Hook:                transformHookName(),
+				OriginalHashType:    remoteHashType,
+				OriginalHash:        remoteHashVlaue,
+				TransformedHashType: hashType,
+				TransformedHash:     hashValue,
+				TransformedSize:     written.size,
+				Time:                time.Now(),
+			})
+			logging.Logger.InfoContext(ctx, "file transformed", "persistentId", persistentId, "file", k, "hook", transformHookName())
+		}
+
+		if direct {
 			if v.Attributes.DestinationFile.Id != 0 {
 				*toReplaceIdentifiers = append(*toReplaceIdentifiers, storageIdentifier)
 				*toReplaceNodes = append(*toReplaceNodes, v)
@@ -207,7 +283,9 @@ func doPersistNodeMap(ctx context.Context, streams map[string]types.Stream, in J
 			}
 		}
 
-		if hashValue != remoteHashVlaue {
+		if remoteHashType == types.SizeAndTime {
+			copied[v.Id] = copiedVersion{LocalHashType: hashType, LocalHashValue: hashValue, SizeAndTime: remoteHashVlaue}
+		} else if hashValue != remoteHashVlaue {
 			knownHashes[v.Id] = calculatedHashes{
 				LocalHashType:  hashType,
 				LocalHashValue: hashValue,
@@ -216,7 +294,92 @@ func doPersistNodeMap(ctx context.Context, streams map[string]types.Stream, in J
 		}
 		config.GetRedis().Set(ctx, redisKey, types.Written, FileNamesInCacheDuration)
 		writtenKeys = append(writtenKeys, redisKey)
+		out.Report.FilesWritten++
+		out.Report.BytesWritten += written.size
+		result := fileAdded
+		if v.Attributes.DestinationFile.Id != 0 {
+			result = fileUpdated
+		}
+		out.Report.addFile(k, FileResult{Result: result, HashType: hashType, Hash: hashValue, Size: written.size, Duration: time.Since(start).Milliseconds()})
+		logging.Logger.InfoContext(ctx, "file written", "persistentId", persistentId, "file", k, "size", written.size, "hashType", hashType, "hash", hashValue)
+		PublishEvent(ctx, ProgressEvent{Type: EventFile, PersistentId: persistentId, User: user, File: k, Status: result})
+		return nil
+	}
 
+	for k, v := range writableNodes {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		default:
+		}
+		if stopping() {
+			err = errStopping
+			return
+		}
+		i++
+		setProgress(ctx, persistentId, user, i, total)
+		if i%10 == 0 && i < total {
+			storeKnownHashes(ctx, persistentId, knownHashes) //if we have many files to hash -> polling at the gui is happier to see some progress
+			logging.Logger.InfoContext(ctx, "job progress", "persistentId", persistentId, "processed", i, "total", total)
+		}
+
+		redisKey := fmt.Sprintf("%v -> %v", persistentId, k)
+		if v.Action == tree.Delete {
+			start := time.Now()
+			err = deleteFile(ctx, dataverseKey, user, v.Attributes.DestinationFile.Id)
+			if err != nil {
+				out.Report.addFile(k, FileResult{Result: fileFailed, Error: err.Error(), Duration: time.Since(start).Milliseconds()})
+				if !continueAfter(ctx, in, err, consecutive) {
+					return
+				}
+				failed[k], err = err, nil
+				consecutive++
+				continue
+			}
+			consecutive = 0
+			delete(knownHashes, v.Id)
+			delete(out.WritableNodes, k)
+			out.Report.addFile(k, FileResult{
+				Result:   fileDeleted,
+				HashType: v.Attributes.DestinationFile.HashType,
+				Hash:     v.Attributes.DestinationFile.Hash,
+				Size:     v.Attributes.DestinationFile.Filesize,
+				Duration: time.Since(start).Milliseconds(),
+			})
+			logging.Logger.InfoContext(ctx, "file deleted", "persistentId", persistentId, "file", k)
+			PublishEvent(ctx, ProgressEvent{Type: EventFile, PersistentId: persistentId, User: user, File: k, Status: fileDeleted})
+			config.GetRedis().Set(ctx, redisKey, types.Deleted, FileNamesInCacheDuration)
+			writtenKeys = append(writtenKeys, redisKey)
+			continue
+		}
+
+		if in.UnpackArchives && isArchive(k) {
+			var entries []string
+			entries, err = unpackArchive(ctx, in, k, throttle.stream(streams[k]), writeFile)
+			// the entries are registered right away: only the archive (and not its entries) can be retried
+			doFlush(ctx, toAddNodes, toReplaceNodes, &out, knownHashes, toAddIdentifiers, toReplaceIdentifiers)
+			complete := dropEntries(out.WritableNodes, entries)
+			if err != nil {
+				return
+			}
+			if complete {
+				delete(out.WritableNodes, k)
+			}
+			continue
+		}
+
+		err = writeFile(k, v, throttle.stream(streams[k]))
+		if err != nil {
+			if !continueAfter(ctx, in, err, consecutive) {
+				return
+			}
+			logging.Logger.WarnContext(ctx, "file failed, continuing with the other files", "persistentId", persistentId, "file", k, "error", err)
+			failed[k], err = err, nil
+			consecutive++
+			continue
+		}
+		consecutive = 0
 		delete(out.WritableNodes, k)
 	}
 
@@ -229,32 +392,82 @@ func doPersistNodeMap(ctx context.Context, streams map[string]types.Stream, in J
 		//err = cleanup(ctx, in.DataverseKey, in.User, in.PersistentId, writtenKeys)
 		err = cleanup(writtenKeys)
 	}
+	if err == nil && len(failed) > 0 {
+		err = giveUpFailed(ctx, &out, failed)
+	}
 	return
 }
 
+// storageDriver returns the storage driver of the dataset and whether the files can be written directly to that storage,
+// the driver is taken from the job, the dataset (when named drivers are configured) or the default driver
+func storageDriver(ctx context.Context, job Job) (string, bool) {
+	if !Destination.IsDirectUpload(ctx) {
+		return "", false
+	}
+	if Destination.IsSignedUrlUpload() {
+		return "", true
+	}
+	driver := job.StorageDriver
+	if driver == "" && len(config.GetTarget(ctx).StorageDrivers) > 0 {
+		var err error
+		driver, err = Destination.GetStorageDriver(ctx, job.DataverseKey, job.User, job.PersistentId)
+		if err != nil {
+			logging.Logger.WarnContext(ctx, "getting storage driver failed, files are written over the API", "persistentId", job.PersistentId, "error", err)
+			return "", false
+		}
+	}
+	if driver == "" {
+		driver = config.GetTarget(ctx).DefaultDriver
+	}
+	_, ok := config.GetStorageDriver(ctx, driver)
+	if !ok {
+		logging.Logger.InfoContext(ctx, "storage driver is not configured, files are written over the API", "persistentId", job.PersistentId, "driver", driver)
+	}
+	return driver, ok
+}
+
 func doFlush(ctx context.Context, toAddNodes *[]tree.Node, toReplaceNodes *[]tree.Node, job *Job, knownHashes map[string]calculatedHashes, toAddIdentifiers, toReplaceIdentifiers *[]string) {
 	if len(*toAddNodes) > 0 || len(*toReplaceNodes) > 0 {
-		logging.Logger.Printf("%v: flushing added: %v replaced: %v...\n", job.PersistentId, len(*toAddNodes), len(*toReplaceNodes))
+		logging.Logger.InfoContext(ctx, "flushing", "persistentId", job.PersistentId, "added", len(*toAddNodes), "replaced", len(*toReplaceNodes))
 		flushed, err := flush(ctx, job.DataverseKey, job.User, job.PersistentId, *toAddIdentifiers, *toReplaceIdentifiers, *toAddNodes, *toReplaceNodes)
 		if err != nil {
+			logging.Logger.WarnContext(ctx, "flushing failed, the files that are not registered are written again", "persistentId", job.PersistentId, "error", err)
 			rollback := *toAddNodes
 			rollback = append(rollback, *toReplaceNodes...)
+			identifiers := append(append([]string{}, *toAddIdentifiers...), *toReplaceIdentifiers...)
+			registered := registeredOnMismatch(err)
+			kept, unregistered := []string{}, []string{}
 			shortContext, cancel := context.WithTimeout(context.Background(), deleteAndCleanupCtxDuration)
 			defer cancel()
-			for _, rb := range rollback {
+			for i, rb := range rollback {
 				k := rb.Id
+				if flushed[k] || registered[k] {
+					kept = append(kept, identifiers[i])
+				} else {
+					unregistered = append(unregistered, identifiers[i])
+				}
 				if !flushed[k] {
 					job.WritableNodes[k] = rb
 					delete(knownHashes, k)
 					config.GetRedis().Del(shortContext, k)
+					failed := job.Report.Files[k]
+					failed.Result, failed.Error = fileFailed, err.Error()
+					job.Report.addFile(k, failed)
 				}
 			}
+			keepRegistered(job.WritableNodes, err)
+			untrackUploads(ctx, job.PersistentId, kept)
+			if !Destination.IsSignedUrlUpload() {
+				discardUploads(ctx, job.PersistentId, unregistered)
+			}
+		} else {
+			untrackUploads(ctx, job.PersistentId, append(*toAddIdentifiers, *toReplaceIdentifiers...))
 		}
 		*toAddNodes = []tree.Node{}
 		*toAddIdentifiers = []string{}
 		*toReplaceNodes = []tree.Node{}
 		*toReplaceIdentifiers = []string{}
-		logging.Logger.Printf("%v: flushed\n", job.PersistentId)
+		logging.Logger.InfoContext(ctx, "flushed", "persistentId", job.PersistentId)
 	}
 }
 
@@ -262,25 +475,61 @@ func flush(ctx context.Context, dataverseKey, user, persistentId string, toAddId
 	res = make(map[string]bool)
 	if len(toAddNodes) > 0 {
 		err = Destination.SaveAfterDirectUpload(ctx, false, dataverseKey, user, persistentId, toAddIdentifiers, toAddNodes)
+		markFlushed(res, toAddNodes, err)
 		if err != nil {
 			return
 		}
-		for _, node := range toAddNodes {
-			res[node.Id] = true
-		}
 	}
 	if len(toReplaceNodes) > 0 {
 		err = Destination.SaveAfterDirectUpload(ctx, true, dataverseKey, user, persistentId, toReplaceIdentifiers, toReplaceNodes)
+		markFlushed(res, toReplaceNodes, err)
 		if err != nil {
 			return
 		}
-		for _, node := range toReplaceNodes {
-			res[node.Id] = true
-		}
 	}
 	return
 }
 
+// markFlushed marks the registered nodes, all nodes on success and the nodes registered as uploaded on a checksum mismatch
+func markFlushed(flushed map[string]bool, nodes []tree.Node, err error) {
+	mismatch := &ChecksumMismatchError{}
+	if err != nil && !errors.As(err, &mismatch) {
+		return
+	}
+	for _, node := range nodes {
+		if _, ok := mismatch.Files[node.Id]; !ok {
+			flushed[node.Id] = true
+		}
+	}
+}
+
+// registeredOnMismatch returns the nodes that Dataverse registered with another checksum or size, their files must be kept
+func registeredOnMismatch(err error) map[string]bool {
+	res := map[string]bool{}
+	mismatch := &ChecksumMismatchError{}
+	if errors.As(err, &mismatch) {
+		for k := range mismatch.Files {
+			res[k] = true
+		}
+	}
+	return res
+}
+
+// keepRegistered points the nodes that Dataverse registered with another checksum or size to the registered files, so that the next
+// attempt replaces these files instead of adding them again
+func keepRegistered(writableNodes map[string]tree.Node, err error) {
+	mismatch := &ChecksumMismatchError{}
+	if !errors.As(err, &mismatch) {
+		return
+	}
+	for k, id := range mismatch.Files {
+		if node, ok := writableNodes[k]; ok {
+			node.Attributes.DestinationFile.Id = id
+			writableNodes[k] = node
+		}
+	}
+}
+
 // func cleanup(ctx context.Context, token, user, persistentId string, writtenKeys []string) error {
 func cleanup(writtenKeys []string) error {
 	go cleanRedis(writtenKeys)
@@ -297,8 +546,9 @@ func cleanRedis(writtenKeys []string) {
 	}
 }
 
-func deleteFile(_ context.Context, token, user string, id int64) error {
-	shortContext, cancel := context.WithTimeout(context.Background(), deleteAndCleanupCtxDuration)
+func deleteFile(ctx context.Context, token, user string, id int64) error {
+	// the delete is not interrupted with the job, only the installation of the job is kept
+	shortContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteAndCleanupCtxDuration)
 	defer cancel()
 	return Destination.DeleteFile(shortContext, token, user, id)
 }
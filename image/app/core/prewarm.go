@@ -0,0 +1,119 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"strings"
+	"time"
+)
+
+const (
+	prewarmsSetKey           = "prewarms"
+	defaultPrewarmExpiration = 30 // days
+)
+
+// Prewarm is a connection registered by the user for the background compare, stored with the credentials of the user
+type Prewarm struct {
+	Id         string               `json:"id"`
+	User       string               `json:"user"`
+	Request    types.CompareRequest `json:"request"`
+	Target     string               `json:"target,omitempty"` // the Dataverse target of the registration (see the dataverseTargets option)
+	Registered time.Time            `json:"registered"`
+}
+
+// PrewarmId identifies the connection (dataset, version and repository) of the user on the Dataverse target of the context
+func PrewarmId(ctx context.Context, user string, req types.CompareRequest) string {
+	fields := []string{user, req.PersistentId, req.Version, req.Plugin, req.PluginId, req.Url, req.RepoName, req.Option}
+	if req.Folder != "" {
+		fields = append(fields, req.Folder)
+	}
+	if target := config.TargetName(ctx); target != "" {
+		fields = append(fields, "target: "+target)
+	}
+	h := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(h[:16])
+}
+
+func prewarmKey(id string) string {
+	return "prewarm: " + id
+}
+
+func PrewarmEnabled() bool {
+	return config.GetConfig().Options.Prewarm.Interval > 0
+}
+
+func prewarmExpiration() time.Duration {
+	if d := config.GetConfig().Options.Prewarm.Expiration; d > 0 {
+		return time.Duration(d) * 24 * time.Hour
+	}
+	return defaultPrewarmExpiration * 24 * time.Hour
+}
+
+// RegisterPrewarm stores (or renews) the connection for the background compare, the credentials are encrypted
+func RegisterPrewarm(ctx context.Context, user string, req types.CompareRequest) error {
+	if user == "" {
+		return fmt.Errorf("user is not known")
+	}
+	// the metadata is only copied once, by the compare of the user
+	req.NewlyCreated = false
+	p := Prewarm{Id: PrewarmId(ctx, user, req), User: user, Request: req, Target: config.TargetName(ctx), Registered: time.Now()}
+	var err error
+	p.Request.DataverseKey, err = encryptSecret(req.DataverseKey, prewarmKey(p.Id))
+	if err != nil {
+		return err
+	}
+	p.Request.Token, err = encryptSecret(req.Token, prewarmKey(p.Id))
+	if err != nil {
+		return err
+	}
+	b, _ := json.Marshal(p)
+	err = config.GetRedis().Set(ctx, prewarmKey(p.Id), string(b), prewarmExpiration())
+	if err != nil {
+		return err
+	}
+	config.GetRedis().SAdd(ctx, prewarmsSetKey, p.Id)
+	RegisterUserData(ctx, user, UserDataEntry{
+		Type:        "prewarm",
+		Key:         prewarmKey(p.Id),
+		Description: fmt.Sprintf("background compare of %v with %v, including the credentials needed for it", req.RepoName, req.PersistentId),
+	}, prewarmExpiration())
+	return nil
+}
+
+// ListPrewarms returns the registered connections with their credentials, the expired and revoked registrations are removed from the set
+func ListPrewarms(ctx context.Context) ([]Prewarm, error) {
+	ids, err := config.GetRedis().SMembers(ctx, prewarmsSetKey)
+	if err != nil {
+		return nil, err
+	}
+	res := []Prewarm{}
+	for _, id := range ids {
+		cached, _ := config.GetRedis().Get(ctx, prewarmKey(id))
+		if cached == "" {
+			config.GetRedis().SRem(ctx, prewarmsSetKey, id)
+			continue
+		}
+		p := Prewarm{}
+		err := json.Unmarshal([]byte(cached), &p)
+		if err == nil {
+			p.Request.DataverseKey, err = decryptSecret(p.Request.DataverseKey, prewarmKey(id))
+		}
+		if err == nil {
+			p.Request.Token, err = decryptSecret(p.Request.Token, prewarmKey(id))
+		}
+		if err != nil {
+			logging.Logger.WarnContext(ctx, "reading prewarm registration failed", "id", id, "error", err)
+			continue
+		}
+		res = append(res, p)
+	}
+	return res, nil
+}
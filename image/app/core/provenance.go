@@ -0,0 +1,155 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/tree"
+	"time"
+)
+
+const provenanceNamespace = "https://github.com/libis/rdm-integration#"
+
+func provenanceFileName() string {
+	if name := config.GetConfig().Options.Provenance.FileName; name != "" {
+		return name
+	}
+	return "provenance.json"
+}
+
+// isGeneratedFile is true for the files written in the dataset after each sync (the provenance and the RO-Crate metadata), they
+// are not compared with the repository: they are neither offered for deletion nor overwritten by a file of the repository
+func isGeneratedFile(id string) bool {
+	options := config.GetConfig().Options
+	return (options.Provenance.Enabled && id == provenanceFileName()) || (options.RoCrate.Enabled && id == roCrateFileName)
+}
+
+func withoutGeneratedFiles(nodes map[string]tree.Node) map[string]tree.Node {
+	res := make(map[string]tree.Node, len(nodes))
+	for k, v := range nodes {
+		if !isGeneratedFile(k) {
+			res[k] = v
+		}
+	}
+	return res
+}
+
+// provenanceDocument describes the last sync of the dataset in PROV-JSON (https://www.w3.org/submissions/prov-json/),
+// the earlier syncs remain available in the file versions of the dataset
+func provenanceDocument(job Job, finished time.Time) map[string]interface{} {
+	p := job.StreamParams
+	source := map[string]string{
+		"prov:location": p.Url,
+		"rdm:plugin":    job.Plugin,
+		"rdm:pluginId":  p.PluginId,
+		"rdm:repoName":  p.RepoName,
+		"rdm:option":    p.Option, // branch, tag or folder
+	}
+	if job.Revision != "" {
+		source["rdm:ref"] = job.Revision // the synchronized commit
+	}
+	deleted := 0
+	for _, f := range job.Report.Files {
+		if f.Result == fileDeleted {
+			deleted++
+		}
+	}
+	return map[string]interface{}{
+		"prefix": map[string]string{
+			"prov": "http://www.w3.org/ns/prov#",
+			"rdm":  provenanceNamespace,
+		},
+		"entity": map[string]interface{}{
+			"rdm:dataset": map[string]string{
+				"prov:label": job.PersistentId,
+			},
+			"rdm:source": source,
+		},
+		"activity": map[string]interface{}{
+			"rdm:sync": map[string]interface{}{
+				"prov:startTime":    job.Report.Started.UTC().Format(time.RFC3339),
+				"prov:endTime":      finished.UTC().Format(time.RFC3339),
+				"rdm:filesWritten":  job.Report.FilesWritten,
+				"rdm:bytesWritten":  job.Report.BytesWritten,
+				"rdm:filesDeleted":  deleted,
+				"rdm:correlationId": job.CorrelationId,
+			},
+		},
+		"agent": map[string]interface{}{
+			"rdm:tool": map[string]string{
+				"prov:type":   "prov:SoftwareAgent",
+				"prov:label":  "rdm-integration",
+				"rdm:version": config.GetVersion(),
+			},
+			"rdm:user": provenanceUser(job),
+		},
+		"used": map[string]interface{}{
+			"_:used": map[string]string{"prov:activity": "rdm:sync", "prov:entity": "rdm:source"},
+		},
+		"wasGeneratedBy": map[string]interface{}{
+			"_:generated": map[string]string{"prov:entity": "rdm:dataset", "prov:activity": "rdm:sync"},
+		},
+		"wasDerivedFrom": map[string]interface{}{
+			"_:derived": map[string]string{"prov:generatedEntity": "rdm:dataset", "prov:usedEntity": "rdm:source", "prov:activity": "rdm:sync"},
+		},
+		"wasAssociatedWith": map[string]interface{}{
+			"_:tool": map[string]string{"prov:activity": "rdm:sync", "prov:agent": "rdm:tool"},
+			"_:user": map[string]string{"prov:activity": "rdm:sync", "prov:agent": "rdm:user"},
+		},
+	}
+}
+
+// provenanceUser is the user that started the sync, with the ORCID iD when the user logged in with ORCID
+func provenanceUser(job Job) map[string]string {
+	res := map[string]string{
+		"prov:type":  "prov:Person",
+		"prov:label": job.User,
+	}
+	if job.Orcid.Id != "" {
+		res["rdm:orcid"] = job.Orcid.Url()
+	}
+	return res
+}
+
+// writeProvenance adds (or replaces) the provenance file in the dataset after a successful sync, while the dataset is still locked
+func writeProvenance(job Job) {
+	if !config.GetConfig().Options.Provenance.Enabled || job.Plugin == "hash-only" || job.Plugin == fixityPlugin {
+		return
+	}
+	if len(job.WritableNodes) > 0 || len(job.Report.Files) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(jobContext(job), redisCtxDuration)
+	defer cancel()
+	b, err := json.MarshalIndent(provenanceDocument(job, time.Now()), "", "  ")
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "marshalling provenance failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	name := provenanceFileName()
+	nodes, err := Destination.Query(ctx, job.PersistentId, LatestVersion, job.DataverseKey, job.User)
+	if err == nil {
+		err = writeDatasetFile(ctx, job, nodes, name, b)
+	}
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "writing provenance failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	logging.Logger.InfoContext(ctx, "provenance written", "persistentId", job.PersistentId, "file", name)
+}
+
+// writeDatasetFile adds the generated file to the dataset, or replaces it when it is present in the nodes of the latest version
+func writeDatasetFile(ctx context.Context, job Job, nodes map[string]tree.Node, name string, content []byte) error {
+	dbId := nodes[name].Attributes.DestinationFile.Id
+	group, groupCtx := NewErrGroup(ctx)
+	f, err := Destination.WriteOverWire(groupCtx, dbId, name, "", job.DataverseKey, job.User, job.PersistentId, group)
+	if err != nil {
+		group.Wait()
+		return err
+	}
+	return copyAndClose(group, f, bytes.NewReader(content))
+}
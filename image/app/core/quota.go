@@ -0,0 +1,149 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"integration/app/logging"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const topConsumersCount = 5
+
+const transferStatsDuration = 30 * 24 * time.Hour
+
+type CollectionUsage struct {
+	Collection string   `json:"collection"`
+	Quota      int64    `json:"quota"` // 0 when no quota is set
+	Used       int64    `json:"used"`
+	Contacts   []string `json:"contacts,omitempty"`
+}
+
+type QuotaNotification struct {
+	CollectionUsage
+	TopConsumers []DatasetTransfers `json:"topConsumers"`
+}
+
+type DatasetTransfers struct {
+	PersistentId string `json:"persistentId"`
+	Bytes        int64  `json:"bytes"`
+}
+
+// transfer statistics: bytes written by the jobs per dataset in the last transferStatsDuration, counted per collection with a
+// counter per dataset, so that the concurrent jobs do not overwrite each other's counts
+func recordTransfers(ctx context.Context, collection, persistentId string, written int64) map[string]int64 {
+	key := "transfer stats: " + collection
+	config.GetRedis().IncrBy(ctx, key+": "+persistentId, written)
+	config.GetRedis().Expire(ctx, key+": "+persistentId, transferStatsDuration)
+	config.GetRedis().SAdd(ctx, key, persistentId)
+	stats := map[string]int64{}
+	datasets, _ := config.GetRedis().SMembers(ctx, key)
+	for _, pid := range datasets {
+		v, err := config.GetRedis().Get(ctx, key+": "+pid)
+		if err != nil {
+			// no transfers in the last transferStatsDuration
+			config.GetRedis().SRem(ctx, key, pid)
+			continue
+		}
+		stats[pid], _ = strconv.ParseInt(v, 10, 64)
+	}
+	return stats
+}
+
+func topConsumers(stats map[string]int64) []DatasetTransfers {
+	res := []DatasetTransfers{}
+	for k, v := range stats {
+		res = append(res, DatasetTransfers{k, v})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Bytes > res[j].Bytes })
+	if len(res) > topConsumersCount {
+		res = res[:topConsumersCount]
+	}
+	return res
+}
+
+// checkQuota records the transfer statistics of a finished job and notifies the collection administrators
+// when the storage usage of the collection exceeds the configured fraction of its quota
+func checkQuota(job Job) {
+	conf := config.GetConfig().Options.QuotaNotifications
+	if conf.Threshold <= 0 || job.Report.BytesWritten == 0 || Destination.GetCollectionUsage == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(jobContext(job), redisCtxDuration)
+	defer cancel()
+	usage, err := Destination.GetCollectionUsage(ctx, job.DataverseKey, job.User, job.PersistentId)
+	if err != nil {
+		logging.Logger.Warn("getting collection usage failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	stats := recordTransfers(ctx, usage.Collection, job.PersistentId, job.Report.BytesWritten)
+	if q, ok := conf.Quotas[usage.Collection]; ok {
+		usage.Quota = q
+	}
+	if usage.Quota <= 0 || float64(usage.Used) < conf.Threshold*float64(usage.Quota) {
+		return
+	}
+	interval := 24 * time.Hour
+	if conf.Interval > 0 {
+		interval = time.Duration(conf.Interval) * time.Hour
+	}
+	if ok, _ := config.GetRedis().SetNX(ctx, "quota notified: "+usage.Collection, true, interval); !ok {
+		return
+	}
+	notification := QuotaNotification{usage, topConsumers(stats)}
+	logging.Logger.Info("sending quota notifications", "collection", usage.Collection, "used", usage.Used, "quota", usage.Quota)
+	if err := sendQuotaMail(ctx, notification, append(usage.Contacts, conf.Recipients...)); err != nil {
+		logging.Logger.Error("sending quota notification mail failed", "collection", usage.Collection, "error", err)
+	}
+	if conf.WebhookUrl != "" {
+		if err := postQuotaWebhook(ctx, conf.WebhookUrl, notification); err != nil {
+			logging.Logger.Error("sending quota notification webhook failed", "collection", usage.Collection, "error", err)
+		}
+	}
+}
+
+func sendQuotaMail(ctx context.Context, n QuotaNotification, to []string) error {
+	if len(to) == 0 {
+		return nil
+	}
+	datasets := []string{}
+	for _, d := range n.TopConsumers {
+		datasets = append(datasets, fmt.Sprintf("<li><a href=\"%v\">%v</a>: %v bytes</li>", Destination.GetRepoUrl(ctx, d.PersistentId, false), d.PersistentId, d.Bytes))
+	}
+	subject := fmt.Sprintf("[rdm-integration] Collection %v is nearing its storage quota", n.Collection)
+	content := fmt.Sprintf("The collection %v uses %v of its %v bytes storage quota (%.0f%%). The datasets with the most transferred data are:<ul>%v</ul>",
+		n.Collection, n.Used, n.Quota, 100*float64(n.Used)/float64(n.Quota), strings.Join(datasets, ""))
+	msg := fmt.Sprintf("To: %v\r\nMIME-version: 1.0;\r\nContent-Type: text/html; charset=\"UTF-8\";\r\n"+
+		"Subject: %v\r\n\r\n<html><body>%v</body>\r\n", strings.Join(to, ", "), subject, content)
+	return SendMail(msg, to)
+}
+
+func postQuotaWebhook(ctx context.Context, url string, n QuotaNotification) error {
+	b, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	r, err := httpclient.Get("quota").Do(request)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		return fmt.Errorf("webhook returned status %d", r.StatusCode)
+	}
+	return nil
+}
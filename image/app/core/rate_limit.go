@@ -0,0 +1,70 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"integration/app/config"
+	"math"
+	"time"
+)
+
+const (
+	rateLimitLockRetries  = 20
+	rateLimitLockInterval = 5 * time.Millisecond
+)
+
+// tokenBucket is the state of a rate limit as stored in Redis
+type tokenBucket struct {
+	Tokens  float64   `json:"tokens"`
+	Updated time.Time `json:"updated"`
+}
+
+// TakeToken takes a token from the bucket of the key, shared by all instances through Redis: the bucket holds at most burst tokens
+// (perMinute rounded up when not set) and is refilled with perMinute tokens per minute. When the bucket is empty, the time until
+// the next token is returned. The calls are not limited when perMinute is not set or Redis is not available.
+func TakeToken(ctx context.Context, key string, perMinute float64, burst int) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+	if burst <= 0 {
+		burst = int(math.Ceil(perMinute))
+	}
+	lockKey := "rate limit lock: " + key
+	for i := 0; ; i++ {
+		locked, err := config.GetRedis().SetNX(ctx, lockKey, true, time.Second)
+		if err != nil {
+			return true, 0
+		}
+		if locked {
+			break
+		}
+		if i == rateLimitLockRetries {
+			return false, time.Second // too many concurrent calls for the same key
+		}
+		time.Sleep(rateLimitLockInterval)
+	}
+	defer config.GetRedis().Del(ctx, lockKey)
+
+	bucketKey := "rate limit: " + key
+	now := time.Now()
+	bucket := tokenBucket{Tokens: float64(burst), Updated: now}
+	if cached, _ := config.GetRedis().Get(ctx, bucketKey); cached != "" {
+		json.Unmarshal([]byte(cached), &bucket)
+	}
+	bucket.Tokens = math.Min(float64(burst), bucket.Tokens+now.Sub(bucket.Updated).Minutes()*perMinute)
+	bucket.Updated = now
+	allowed := bucket.Tokens >= 1
+	if allowed {
+		bucket.Tokens--
+	}
+	b, _ := json.Marshal(bucket)
+	// the bucket is full again when it expires
+	refill := time.Duration(float64(burst) / perMinute * float64(time.Minute))
+	config.GetRedis().Set(ctx, bucketKey, string(b), refill+time.Second)
+	if allowed {
+		return true, 0
+	}
+	return false, time.Duration((1 - bucket.Tokens) / perMinute * float64(time.Minute))
+}
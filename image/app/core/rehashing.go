@@ -10,6 +10,7 @@ import (
 	"integration/app/logging"
 	"integration/app/plugin/types"
 	"integration/app/tree"
+	"time"
 )
 
 type calculatedHashes struct {
@@ -18,8 +19,17 @@ type calculatedHashes struct {
 	RemoteHashes   map[string]string
 }
 
+// copiedVersion is the version of a file without checksum at the source (types.SizeAndTime) copied by this application, with the
+// checksum of the written Dataverse file: the record only applies while the Dataverse file is not replaced
+type copiedVersion struct {
+	LocalHashType  string
+	LocalHashValue string
+	SizeAndTime    string
+}
+
 func localRehashToMatchRemoteHashType(ctx context.Context, dataverseKey, user, persistentId string, nodes map[string]tree.Node, addJobs bool) (map[string]tree.Node, bool) {
 	knownHashes := getKnownHashes(ctx, persistentId)
+	copied := getCopiedVersions(ctx, persistentId)
 	jobNodes := map[string]tree.Node{}
 	res := map[string]tree.Node{}
 	for k, node := range nodes {
@@ -29,7 +39,7 @@ func localRehashToMatchRemoteHashType(ctx context.Context, dataverseKey, user, p
 				value, ok = node.Attributes.DestinationFile.Hash, true
 			}
 			redisKey := fmt.Sprintf("%v -> %v", persistentId, k)
-			redisValue := config.GetRedis().Get(ctx, redisKey).Val()
+			redisValue, _ := config.GetRedis().Get(ctx, redisKey)
 			if redisValue == types.Written {
 				node.Attributes.DestinationFile.HashType = node.Attributes.RemoteHashType
 				value, ok = node.Attributes.RemoteHash, true
@@ -37,7 +47,18 @@ func localRehashToMatchRemoteHashType(ctx context.Context, dataverseKey, user, p
 			if redisValue == types.Deleted {
 				value, ok = "", true
 			}
-			if !ok && node.Attributes.DestinationFile.Hash != "" {
+			empty, emptyOk := emptyFileHash(node.Attributes.RemoteHashType)
+			switch {
+			case ok || node.Attributes.DestinationFile.Hash == "":
+			case node.Attributes.RemoteHashType == types.SizeAndTime:
+				// there is no checksum to rehash to: the size and the modification time are compared with the copied version
+				value = node.Attributes.DestinationFile.Hash
+				if sizeAndTimeMatch(node, copied[node.Id]) {
+					value = weakMatch
+				}
+			case node.Attributes.DestinationFile.Filesize == 0 && emptyOk:
+				value = empty
+			default:
 				jobNodes[k] = node
 				value = "?"
 			}
@@ -56,12 +77,50 @@ func localRehashToMatchRemoteHashType(ctx context.Context, dataverseKey, user, p
 			},
 		)
 		if err != nil {
-			logging.Logger.Println("adding rehashing job failed: " + err.Error())
+			logging.Logger.ErrorContext(ctx, "adding rehashing job failed", "persistentId", persistentId, "error", err)
 		}
 	}
 	return res, len(jobNodes) > 0
 }
 
+// weakMatch replaces the destination hash of the files that only match on the size and the modification time (tree.WeakEqual)
+const weakMatch = "~"
+
+// sizeAndTimeMatch: the file has the size and the modification time (at the precision of the source) of the version copied to the
+// Dataverse file, the files that were not copied by this application (or replaced since) are considered updated
+func sizeAndTimeMatch(node tree.Node, copied copiedVersion) bool {
+	a := node.Attributes
+	return copied.SizeAndTime != "" && copied.SizeAndTime == a.RemoteHash &&
+		copied.LocalHashType == a.DestinationFile.HashType && copied.LocalHashValue == a.DestinationFile.Hash
+}
+
+// the copied versions are not invalidated with the known hashes when the dataset changes, each record is checked against the
+// checksum of the Dataverse file instead
+func getCopiedVersions(ctx context.Context, persistentId string) map[string]copiedVersion {
+	shortContext, cancel := context.WithTimeout(ctx, redisCtxDuration)
+	defer cancel()
+	res := map[string]copiedVersion{}
+	cache, _ := config.GetRedis().Get(shortContext, "copied versions: "+persistentId)
+	if err := json.Unmarshal([]byte(cache), &res); err != nil {
+		return map[string]copiedVersion{}
+	}
+	return res
+}
+
+func storeCopiedVersions(ctx context.Context, persistentId string, copied map[string]copiedVersion) {
+	if len(copied) == 0 {
+		return
+	}
+	shortContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), redisCtxDuration)
+	defer cancel()
+	b, err := json.Marshal(copied)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "marshalling copied versions failed", "persistentId", persistentId, "error", err)
+		return
+	}
+	config.GetRedis().Set(shortContext, "copied versions: "+persistentId, string(b), knownHashesDuration())
+}
+
 func doRehash(ctx context.Context, dataverseKey, user, persistentId string, nodes map[string]tree.Node, in Job) (out Job, err error) {
 	err = Destination.CheckPermission(ctx, dataverseKey, user, persistentId)
 	if err != nil {
@@ -75,14 +134,19 @@ func doRehash(ctx context.Context, dataverseKey, user, persistentId string, node
 	i := 0
 	total := len(nodes)
 	for k, node := range nodes {
+		if stopping() {
+			err = errStopping
+			return
+		}
 		err = calculateHash(ctx, dataverseKey, user, persistentId, node, knownHashes)
 		if err != nil {
 			return
 		}
 		i++
+		setProgress(ctx, persistentId, user, i, total)
 		if i%10 == 0 && i < total {
 			storeKnownHashes(ctx, persistentId, knownHashes) //if we have many files to hash -> polling at the gui is happier to see some progress
-			logging.Logger.Printf("%v: processed %v/%v\n", persistentId, i, total)
+			logging.Logger.InfoContext(ctx, "hashing progress", "persistentId", persistentId, "processed", i, "total", total)
 		}
 		delete(out.WritableNodes, k)
 	}
@@ -93,8 +157,8 @@ func getKnownHashes(ctx context.Context, persistentId string) map[string]calcula
 	shortContext, cancel := context.WithTimeout(ctx, redisCtxDuration)
 	defer cancel()
 	res := map[string]calculatedHashes{}
-	cache := config.GetRedis().Get(shortContext, "hashes: "+persistentId)
-	err := json.Unmarshal([]byte(cache.Val()), &res)
+	cache, _ := config.GetRedis().Get(shortContext, "hashes: "+persistentId)
+	err := json.Unmarshal([]byte(cache), &res)
 	if err != nil {
 		return map[string]calculatedHashes{}
 	}
@@ -106,16 +170,23 @@ func storeKnownHashes(ctx context.Context, persistentId string, knownHashes map[
 	defer cancel()
 	knownHashesJson, err := json.Marshal(knownHashes)
 	if err != nil {
-		logging.Logger.Println("marshalling hashes failed")
+		logging.Logger.ErrorContext(ctx, "marshalling hashes failed", "persistentId", persistentId, "error", err)
 		return
 	}
-	config.GetRedis().Set(shortContext, "hashes: "+persistentId, string(knownHashesJson), 0)
+	config.GetRedis().Set(shortContext, "hashes: "+persistentId, string(knownHashesJson), knownHashesDuration())
+	config.GetRedis().SAdd(shortContext, "hashed datasets", persistentId)
+}
+
+// the known hashes are kept forever when no TTL is configured
+func knownHashesDuration() time.Duration {
+	return time.Duration(config.GetConfig().Options.KnownHashesTTL) * time.Hour
 }
 
-func invalidateKnownHashes(ctx context.Context, persistentId string) {
+func InvalidateKnownHashes(ctx context.Context, persistentId string) {
 	shortContext, cancel := context.WithTimeout(ctx, redisCtxDuration)
 	defer cancel()
-	config.GetRedis().Del(shortContext, "hashes: "+persistentId)
+	config.GetRedis().Del(shortContext, "hashes: "+persistentId, DatasetSnapshotKey(persistentId))
+	config.GetRedis().SRem(shortContext, "hashed datasets", persistentId)
 }
 
 func calculateHash(ctx context.Context, dataverseKey, user, persistentId string, node tree.Node, knownHashes map[string]calculatedHashes) error {
@@ -142,16 +213,24 @@ func calculateHash(ctx context.Context, dataverseKey, user, persistentId string,
 	return nil
 }
 
+// CheckKnownHashes removes the known hashes of the files that were replaced outside of this application: the hashes only apply to the
+// Dataverse file with the checksum they were calculated for, the other changes of the dataset (e.g., metadata edits) keep them
 func CheckKnownHashes(ctx context.Context, persistentId string, mapped map[string]tree.Node) {
 	knownHashes := getKnownHashes(ctx, persistentId)
+	stale := []string{}
 	for k, v := range mapped {
-		if knownHashes[k].LocalHashValue == "" {
+		known, ok := knownHashes[k]
+		if !ok || known.LocalHashValue == "" {
 			continue
 		}
-		invalid := knownHashes[k].LocalHashValue != v.Attributes.DestinationFile.Hash || knownHashes[k].LocalHashType != v.Attributes.DestinationFile.HashType
-		if invalid {
-			invalidateKnownHashes(ctx, persistentId)
-			break
+		if known.LocalHashValue != v.Attributes.DestinationFile.Hash || known.LocalHashType != v.Attributes.DestinationFile.HashType {
+			delete(knownHashes, k)
+			stale = append(stale, k)
 		}
 	}
+	// the running job stores its own hashes when it finishes
+	if len(stale) > 0 && !IsLocked(ctx, persistentId) {
+		logging.Logger.InfoContext(ctx, "files changed since their hashes were calculated, removing their known hashes", "persistentId", persistentId, "files", len(stale))
+		storeKnownHashes(ctx, persistentId, knownHashes)
+	}
 }
@@ -0,0 +1,117 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"integration/app/config"
+	"integration/app/logging"
+	"time"
+)
+
+type JobReport struct {
+	PersistentId    string                    `json:"persistentId"`
+	Started         time.Time                 `json:"started"`
+	Finished        time.Time                 `json:"finished,omitempty"`
+	Transformations map[string]Transformation `json:"transformations,omitempty"`
+	FilesWritten    int                       `json:"filesWritten"`
+	BytesWritten    int64                     `json:"bytesWritten"`
+	Files           map[string]FileResult     `json:"files,omitempty"`
+	StorageCleanup  string                    `json:"storageCleanup,omitempty"` // "cleaned", "skipped" (disabled), "refused" (other unregistered files found) or "failed", when failed uploads were left in the storage
+	Published       string                    `json:"published,omitempty"`      // "major" or "minor" when the dataset was published after the sync
+	PublishError    string                    `json:"publishError,omitempty"`   // why publishing the dataset after the sync failed
+}
+
+const (
+	fileAdded   = "added"
+	fileUpdated = "updated"
+	fileDeleted = "deleted"
+	fileFailed  = "failed"
+)
+
+// FileResult is the outcome of a processed file, the checksum is the one of the file in the destination (before deletion for the deleted files)
+type FileResult struct {
+	Result     string `json:"result"` // "added", "updated", "deleted", "exported" or "failed" (the failed attempts, and the files that were not processed in the history and the export reports)
+	HashType   string `json:"hashType,omitempty"`
+	Hash       string `json:"hash,omitempty"`
+	Size       int64  `json:"size,omitempty"`
+	Error      string `json:"error,omitempty"`      // why the last attempt failed
+	Duration   int64  `json:"duration,omitempty"`   // milliseconds spent writing (or deleting) the file in the last attempt
+	DataFileId int64  `json:"dataFileId,omitempty"` // database id of the written file in Dataverse (of the new version for the replaced files)
+}
+
+type Transformation struct {
+	Hook                string    `json:"hook"`
+	OriginalHashType    string    `json:"originalHashType"`
+	OriginalHash        string    `json:"originalHash"`
+	TransformedHashType string    `json:"transformedHashType"`
+	TransformedHash     string    `json:"transformedHash"`
+	TransformedSize     int64     `json:"transformedSize"`
+	Time                time.Time `json:"time"`
+}
+
+func (r *JobReport) addFile(id string, result FileResult) {
+	if r.Files == nil {
+		r.Files = map[string]FileResult{}
+	}
+	r.Files[id] = result
+}
+
+func (r *JobReport) addTransformation(id string, t Transformation) {
+	if r.Transformations == nil {
+		r.Transformations = map[string]Transformation{}
+	}
+	r.Transformations[id] = t
+}
+
+// storeJobReport stores the report of the finished job, or of the job that is retried so that the failed files are shown meanwhile
+func storeJobReport(job Job, finished bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisCtxDuration)
+	defer cancel()
+	job.Report.PersistentId = job.PersistentId
+	if finished {
+		job.Report.Finished = time.Now()
+	}
+	b, err := json.Marshal(job.Report)
+	if err != nil {
+		logging.Logger.Error("marshalling job report failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	config.GetRedis().Set(ctx, "report: "+job.PersistentId, string(b), config.LockMaxDuration)
+}
+
+func GetJobReport(ctx context.Context, persistentId string) (JobReport, bool) {
+	res := JobReport{}
+	cached, _ := config.GetRedis().Get(ctx, "report: "+persistentId)
+	if cached == "" {
+		return res, false
+	}
+	err := json.Unmarshal([]byte(cached), &res)
+	return res, err == nil
+}
+
+// recordDataFileIds adds the database ids of the added and updated files to the report, as listed in the latest version of the
+// dataset after the job (or after a failed attempt)
+func recordDataFileIds(ctx context.Context, job *Job) {
+	missing := false
+	for _, v := range job.Report.Files {
+		missing = missing || (v.Result == fileAdded || v.Result == fileUpdated) && v.DataFileId == 0
+	}
+	if !missing {
+		return
+	}
+	shortContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), deleteAndCleanupCtxDuration)
+	defer cancel()
+	nm, err := Destination.Query(shortContext, job.PersistentId, LatestVersion, job.DataverseKey, job.User)
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "listing the written files failed, the report has no file ids", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	for k, v := range job.Report.Files {
+		if node, ok := nm[k]; ok && (v.Result == fileAdded || v.Result == fileUpdated) && v.DataFileId == 0 {
+			v.DataFileId = node.Attributes.DestinationFile.Id
+			job.Report.Files[k] = v
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/tree"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	roCrateFileName = "ro-crate-metadata.json"
+	roCrateContext  = "https://w3id.org/ro/crate/1.1/context"
+	roCrateSpec     = "https://w3id.org/ro/crate/1.1"
+)
+
+// the license files in the root of the dataset, e.g., LICENSE, LICENSE.md or COPYING.txt
+var licenseFileR = regexp.MustCompile(`(?i)^(licen[cs]e|copying)(\.[a-z]+)?$`)
+
+type roCrateRef struct {
+	Id string `json:"@id"`
+}
+
+// roCrateDocument describes the dataset as an RO-Crate (https://www.researchobject.org/ro-crate/1.1/): the files of the
+// dataset, the source repository with the synchronized revision, the license and the sync that created the crate
+func roCrateDocument(job Job, nodes map[string]tree.Node, finished time.Time) map[string]interface{} {
+	p := job.StreamParams
+	ids := []string{}
+	for k, v := range nodes {
+		if v.Attributes.IsFile && k != roCrateFileName {
+			ids = append(ids, k)
+		}
+	}
+	sort.Strings(ids)
+	files := []interface{}{}
+	parts := []roCrateRef{}
+	licenses := []roCrateRef{}
+	for _, id := range ids {
+		v := nodes[id]
+		ref := roCrateRef{roCrateId(id)}
+		parts = append(parts, ref)
+		files = append(files, map[string]interface{}{
+			"@id":         ref.Id,
+			"@type":       "File",
+			"name":        v.Name,
+			"contentSize": v.Attributes.DestinationFile.Filesize,
+		})
+		if v.Path == "" && licenseFileR.MatchString(v.Name) {
+			licenses = append(licenses, ref)
+		}
+	}
+	if license := config.GetConfig().Options.RoCrate.License; license != "" {
+		licenses = []roCrateRef{{license}}
+	}
+	source := roCrateSource(p.Url, p.RepoName)
+	root := map[string]interface{}{
+		"@id":           "./",
+		"@type":         "Dataset",
+		"identifier":    job.PersistentId,
+		"name":          job.PersistentId,
+		"description":   fmt.Sprintf("Files of dataset %s synchronized from repository %s (%s)", job.PersistentId, p.RepoName, job.Plugin),
+		"url":           Destination.GetRepoUrl(jobContext(job), job.PersistentId, false),
+		"datePublished": finished.UTC().Format(time.RFC3339),
+		"hasPart":       parts,
+		"isBasedOn":     roCrateRef{source},
+	}
+	if len(licenses) == 1 {
+		root["license"] = licenses[0]
+	} else if len(licenses) > 1 {
+		root["license"] = licenses
+	}
+	repository := map[string]interface{}{
+		"@id":            source,
+		"@type":          "SoftwareSourceCode",
+		"name":           p.RepoName,
+		"codeRepository": source,
+		"identifier":     job.Plugin + "/" + p.PluginId,
+	}
+	if p.Option != "" {
+		repository["alternateName"] = p.Option // branch, tag or folder
+	}
+	if job.Revision != "" {
+		repository["version"] = job.Revision
+	}
+	graph := []interface{}{
+		map[string]interface{}{
+			"@id":        roCrateFileName,
+			"@type":      "CreativeWork",
+			"conformsTo": roCrateRef{roCrateSpec},
+			"about":      roCrateRef{"./"},
+		},
+		root,
+		repository,
+		map[string]interface{}{
+			"@id":        "#sync",
+			"@type":      "CreateAction",
+			"name":       "Synchronization of the dataset with the repository",
+			"startTime":  job.Report.Started.UTC().Format(time.RFC3339),
+			"endTime":    finished.UTC().Format(time.RFC3339),
+			"instrument": roCrateRef{"#rdm-integration"},
+			"agent":      roCrateRef{"#user"},
+			"object":     roCrateRef{source},
+			"result":     roCrateRef{"./"},
+		},
+		map[string]interface{}{
+			"@id":     "#rdm-integration",
+			"@type":   "SoftwareApplication",
+			"name":    "rdm-integration",
+			"version": config.GetVersion(),
+		},
+		roCrateUser(job),
+	}
+	graph = append(graph, files...)
+	return map[string]interface{}{
+		"@context": roCrateContext,
+		"@graph":   graph,
+	}
+}
+
+// roCrateUser is the user that started the sync, identified by the ORCID iD when the user logged in with ORCID
+func roCrateUser(job Job) map[string]interface{} {
+	res := map[string]interface{}{
+		"@id":   "#user",
+		"@type": "Person",
+		"name":  job.User,
+	}
+	if job.Orcid.Id != "" {
+		res["identifier"] = job.Orcid.Url()
+	}
+	return res
+}
+
+// roCrateId is the relative URI of the file, the path segments are escaped (e.g., the spaces)
+func roCrateId(id string) string {
+	segments := strings.Split(id, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// roCrateSource is the URL of the repository, the plugins get the repository name (e.g., "owner/repo") next to the server URL;
+// the sources without URL (e.g., the local folders) are described in the crate itself
+func roCrateSource(u, repoName string) string {
+	u = strings.TrimSuffix(u, "/")
+	if !strings.HasPrefix(u, "http") {
+		return "#source"
+	}
+	if repoName == "" || strings.HasSuffix(u, "/"+repoName) {
+		return u
+	}
+	return u + "/" + repoName
+}
+
+// writeRoCrate adds (or replaces) the RO-Crate metadata file in the root of the dataset after a successful sync, while the dataset is still locked
+func writeRoCrate(job Job) {
+	if !config.GetConfig().Options.RoCrate.Enabled || job.Plugin == "hash-only" || job.Plugin == fixityPlugin {
+		return
+	}
+	if len(job.WritableNodes) > 0 || len(job.Report.Files) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(jobContext(job), redisCtxDuration)
+	defer cancel()
+	nodes, err := Destination.Query(ctx, job.PersistentId, LatestVersion, job.DataverseKey, job.User)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "writing RO-Crate failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	b, err := json.MarshalIndent(roCrateDocument(job, nodes, time.Now()), "", "  ")
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "marshalling RO-Crate failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	err = writeDatasetFile(ctx, job, nodes, roCrateFileName, b)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "writing RO-Crate failed", "persistentId", job.PersistentId, "error", err)
+		return
+	}
+	logging.Logger.InfoContext(ctx, "RO-Crate written", "persistentId", job.PersistentId, "file", roCrateFileName)
+}
@@ -0,0 +1,88 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"integration/app/config"
+	"integration/app/tree"
+	"slices"
+	"strings"
+)
+
+// the queue of the jobs not matched by a routing rule, consumed by all workers
+const defaultQueue = "jobs"
+
+// labels of the workers of this process (--labels), the jobs routed to these labels are consumed next to the unrouted jobs
+var workerLabels []string
+
+func SetWorkerLabels(labels []string) {
+	workerLabels = labels
+}
+
+func labelQueue(label string) string {
+	return defaultQueue + ": " + label
+}
+
+// jobQueue returns the queue of the job: the queue of the label of the first matching routing rule, the default queue otherwise
+func jobQueue(job Job) string {
+	for _, route := range config.GetConfig().Options.JobRouting {
+		if len(route.Plugins) > 0 && !slices.Contains(route.Plugins, job.Plugin) {
+			continue
+		}
+		if route.Upload != "" && route.Upload != uploadMode(job) {
+			continue
+		}
+		return labelQueue(route.Label)
+	}
+	return defaultQueue
+}
+
+// uploadMode tells how the files of the job are written to the dataset, as matched by the "upload" of the routing rules
+func uploadMode(job Job) string {
+	ctx := jobContext(job)
+	nativeReplace := !config.GetConfig().Options.DeleteAndAddOnReplace
+	for id, node := range job.WritableNodes {
+		// the replaced .zip files are written double-zipped with the native replace API
+		replaced := nativeReplace && node.Attributes.DestinationFile.Id != 0
+		if node.Action != tree.Delete && !replaced && fileUploadMode(ctx, id, job.UnpackArchives) == "sword" {
+			return "sword"
+		}
+	}
+	return fileUploadMode(ctx, "", job.UnpackArchives)
+}
+
+// fileUploadMode tells how a file is written to the dataset: the .zip files are written through SWORD when not uploaded directly,
+// unless the archives are unpacked
+func fileUploadMode(ctx context.Context, id string, unpackArchives bool) string {
+	if Destination.IsDirectUpload(ctx) {
+		if Destination.IsSignedUrlUpload() {
+			return "signedUrl"
+		}
+		return "direct"
+	}
+	if !unpackArchives && strings.HasSuffix(id, ".zip") {
+		return "sword"
+	}
+	return "api"
+}
+
+// workerQueues returns the queues consumed by the workers of this process, the labeled queues first
+func workerQueues() []string {
+	res := []string{}
+	for _, label := range workerLabels {
+		res = append(res, labelQueue(label))
+	}
+	return append(res, defaultQueue)
+}
+
+// routedQueues returns the queues of all labels of the routing rules
+func routedQueues() []string {
+	res := []string{}
+	for _, route := range config.GetConfig().Options.JobRouting {
+		if q := labelQueue(route.Label); !slices.Contains(res, q) {
+			res = append(res, q)
+		}
+	}
+	return res
+}
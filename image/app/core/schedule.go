@@ -0,0 +1,154 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Schedule is a batch sync repeated every Interval minutes, stored in the history database with the encrypted credentials of the user
+type Schedule struct {
+	Id        string          `json:"id"`
+	User      string          `json:"user"`
+	Target    string          `json:"target,omitempty"` // the Dataverse target of the schedule (see the dataverseTargets option)
+	Request   json.RawMessage `json:"request"`          // the batch request, without the credentials
+	Interval  int             `json:"interval"`         // minutes
+	NextRun   time.Time       `json:"nextRun"`
+	LastRun   time.Time       `json:"lastRun,omitempty"`
+	LastBatch string          `json:"lastBatch,omitempty"` // the id of the batch started by the last run (see /api/plugin/batchstatus)
+	LastError string          `json:"lastError,omitempty"` // the error of the last run, when the batch could not be started
+	Created   time.Time       `json:"created"`
+
+	// the credentials of the batch request, only set for the due schedules (see ClaimDueSchedules)
+	DataverseKey string `json:"-"`
+	Token        string `json:"-"`
+}
+
+const scheduleColumns = `id, user_name, target, request, dataverse_key, token, interval_minutes, next_run, last_run, last_batch, last_error, created`
+
+// scheduleKey binds the encrypted credentials to the schedule, as the Redis key for the values stored in Redis
+func scheduleKey(id string) string {
+	return "schedule: " + id
+}
+
+// SchedulesEnabled tells whether the schedules can be stored, they need the history database
+func SchedulesEnabled() bool {
+	return historyEnabled()
+}
+
+// CreateSchedule stores the schedule, the first run is after one interval; the credentials are encrypted
+func CreateSchedule(ctx context.Context, s Schedule) (Schedule, error) {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return s, err
+	}
+	s.Id = uuid.New().String()
+	s.Created = time.Now()
+	s.NextRun = s.Created.Add(time.Duration(s.Interval) * time.Minute)
+	dataverseKey, err := encryptSecret(s.DataverseKey, scheduleKey(s.Id))
+	if err != nil {
+		return s, err
+	}
+	token, err := encryptSecret(s.Token, scheduleKey(s.Id))
+	if err != nil {
+		return s, err
+	}
+	_, err = db.ExecContext(ctx, `INSERT INTO schedules (id, user_name, target, request, dataverse_key, token, interval_minutes, next_run, created)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+		s.Id, s.User, s.Target, string(s.Request), dataverseKey, token, s.Interval, s.NextRun, s.Created)
+	s.DataverseKey, s.Token = "", ""
+	return s, err
+}
+
+// ListSchedules returns the schedules of the user, without the credentials
+func ListSchedules(ctx context.Context, user string) ([]Schedule, error) {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT `+scheduleColumns+` FROM schedules WHERE user_name = $1 ORDER BY created`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		s.DataverseKey, s.Token = "", ""
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// DeleteSchedule deletes the schedule of the user with its credentials, false when the user has no such schedule
+func DeleteSchedule(ctx context.Context, user, id string) (bool, error) {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return false, err
+	}
+	res, err := db.ExecContext(ctx, `DELETE FROM schedules WHERE id = $1 AND user_name = $2`, id, user)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+// ClaimDueSchedules moves the next run of (at most limit) due schedules one interval further and returns them with their decrypted
+// credentials: the rows are locked while they are claimed, so that each run is claimed by only one of the instances
+func ClaimDueSchedules(ctx context.Context, limit int) ([]Schedule, error) {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, `UPDATE schedules SET last_run = $1, next_run = $1 + interval_minutes * INTERVAL '1 minute'
+		WHERE id IN (SELECT id FROM schedules WHERE next_run <= $1 ORDER BY next_run LIMIT $2 FOR UPDATE SKIP LOCKED)
+		RETURNING `+scheduleColumns, time.Now(), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	res := []Schedule{}
+	for rows.Next() {
+		s, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		if s.DataverseKey, err = decryptSecret(s.DataverseKey, scheduleKey(s.Id)); err != nil {
+			return nil, fmt.Errorf("schedule %v: %v", s.Id, err)
+		}
+		if s.Token, err = decryptSecret(s.Token, scheduleKey(s.Id)); err != nil {
+			return nil, fmt.Errorf("schedule %v: %v", s.Id, err)
+		}
+		res = append(res, s)
+	}
+	return res, rows.Err()
+}
+
+// SetScheduleRun records the outcome of the last run: the id of the started batch or the error
+func SetScheduleRun(ctx context.Context, id, batchId, runErr string) error {
+	db, err := getHistoryDb(ctx)
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, `UPDATE schedules SET last_batch = $2, last_error = $3 WHERE id = $1`, id, batchId, runErr)
+	return err
+}
+
+func scanSchedule(rows *sql.Rows) (Schedule, error) {
+	s := Schedule{}
+	var request string
+	var lastRun sql.NullTime
+	err := rows.Scan(&s.Id, &s.User, &s.Target, &request, &s.DataverseKey, &s.Token, &s.Interval, &s.NextRun, &lastRun, &s.LastBatch, &s.LastError, &s.Created)
+	s.Request, s.LastRun = json.RawMessage(request), lastRun.Time
+	return s, err
+}
@@ -0,0 +1,160 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"time"
+)
+
+const (
+	SessionCookieName = "rdm_session"
+	defaultSessionTTL = 8 * time.Hour
+)
+
+// Session is the server side state of a login: the identity of the user and the credentials of the session (the Dataverse API key
+// and the repository tokens), so that the browser sends only the session cookie after the login. The session is stored encrypted,
+// under the hash of its id, and expires after the sessionTTL.
+type Session struct {
+	Identity
+	DataverseKey string            `json:"dataverseKey,omitempty"`
+	Tokens       map[string]string `json:"tokens,omitempty"` // by plugin id: the tokens entered by the user or the ids of the OAuth tokens of the session
+}
+
+type sessionContextKey struct{}
+
+type sessionValue struct {
+	id      string
+	session Session
+}
+
+// WithSession attaches the session of the request to the context
+func WithSession(ctx context.Context, sessionId string, session Session) context.Context {
+	return context.WithValue(ctx, sessionContextKey{}, sessionValue{sessionId, session})
+}
+
+// SessionFromContext returns the session of the request and its id
+func SessionFromContext(ctx context.Context) (Session, string, bool) {
+	v, ok := ctx.Value(sessionContextKey{}).(sessionValue)
+	return v.session, v.id, ok
+}
+
+func sessionTTL() time.Duration {
+	if h := config.GetConfig().Options.SessionTTL; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	if h := config.GetConfig().Options.Oidc.SessionTTL; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultSessionTTL
+}
+
+// sessionKey: only the hash of the session id is stored, the session id itself is only known to the browser
+func sessionKey(sessionId string) string {
+	h := sha256.Sum256([]byte(sessionId))
+	return "session: " + hex.EncodeToString(h[:])
+}
+
+// userSessionsKey is the set of the session keys of the user, so that all sessions of the user can be ended at once
+func userSessionsKey(user string) string {
+	return "sessions: " + user
+}
+
+// NewSession stores the session with a new (random) id, which is returned
+func NewSession(ctx context.Context, session Session) (string, error) {
+	session.Expires = time.Now().Add(sessionTTL())
+	sessionId := randomString()
+	if err := saveSession(ctx, sessionId, session); err != nil {
+		return "", err
+	}
+	if session.User != "" {
+		config.GetRedis().SAdd(ctx, userSessionsKey(session.User), sessionKey(sessionId))
+		config.GetRedis().Expire(ctx, userSessionsKey(session.User), sessionTTL())
+		RegisterUserData(ctx, session.User, UserDataEntry{
+			Type:        "session",
+			Key:         sessionKey(sessionId),
+			Description: "login session with the Dataverse API key and the repository tokens of the session",
+		}, sessionTTL())
+	}
+	return sessionId, nil
+}
+
+func saveSession(ctx context.Context, sessionId string, session Session) error {
+	ttl := time.Until(session.Expires)
+	if ttl <= 0 {
+		return fmt.Errorf("the session is expired")
+	}
+	b, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptSecret(string(b), sessionKey(sessionId))
+	if err != nil {
+		return err
+	}
+	return config.GetRedis().Set(ctx, sessionKey(sessionId), encrypted, ttl)
+}
+
+// GetSession returns a valid session
+func GetSession(ctx context.Context, sessionId string) (Session, bool) {
+	res := Session{}
+	if sessionId == "" {
+		return res, false
+	}
+	cached, _ := config.GetRedis().Get(ctx, sessionKey(sessionId))
+	if cached == "" {
+		return res, false
+	}
+	decrypted, err := decryptSecret(cached, sessionKey(sessionId))
+	if err != nil || json.Unmarshal([]byte(decrypted), &res) != nil {
+		return res, false
+	}
+	return res, time.Now().Before(res.Expires)
+}
+
+// UpdateSession changes the credentials of a valid session, the expiration does not change
+func UpdateSession(ctx context.Context, sessionId string, update func(*Session)) (Session, error) {
+	session, ok := GetSession(ctx, sessionId)
+	if !ok {
+		return session, fmt.Errorf("%w: the session is expired or unknown", ErrPermissionDenied)
+	}
+	update(&session)
+	return session, saveSession(ctx, sessionId, session)
+}
+
+// EndSession revokes the session and the OAuth tokens obtained in the session
+func EndSession(ctx context.Context, sessionId string) {
+	if session, ok := GetSession(ctx, sessionId); ok {
+		endSession(ctx, sessionKey(sessionId), session)
+		config.GetRedis().SRem(ctx, userSessionsKey(session.User), sessionKey(sessionId))
+	}
+	config.GetRedis().Del(ctx, sessionKey(sessionId))
+}
+
+// EndUserSessions revokes all sessions of the user (e.g., the sessions in the other browsers), it returns their number
+func EndUserSessions(ctx context.Context, user string) int {
+	keys, _ := config.GetRedis().SMembers(ctx, userSessionsKey(user))
+	for _, key := range keys {
+		session := Session{}
+		if cached, _ := config.GetRedis().Get(ctx, key); cached != "" {
+			if decrypted, err := decryptSecret(cached, key); err == nil && json.Unmarshal([]byte(decrypted), &session) == nil {
+				endSession(ctx, key, session)
+			}
+		}
+		config.GetRedis().Del(ctx, key)
+	}
+	config.GetRedis().Del(ctx, userSessionsKey(user))
+	return len(keys)
+}
+
+func endSession(ctx context.Context, key string, session Session) {
+	for pluginId, token := range session.Tokens {
+		// nothing is deleted for the tokens entered by the user
+		config.GetRedis().Del(ctx, TokenCacheKey(pluginId, token))
+	}
+}
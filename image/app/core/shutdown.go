@@ -0,0 +1,56 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"errors"
+	"integration/app/config"
+	"integration/app/logging"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const defaultShutdownGracePeriod = 25 * time.Second
+
+// errStopping is returned by the running jobs when they stopped between two files because of a shutdown, the remaining files are re-queued
+var errStopping = errors.New("stopped for shutdown")
+
+var stopOnce sync.Once
+
+// ShutdownGracePeriod is the time given to the running jobs and HTTP requests to finish after SIGTERM or SIGINT
+func ShutdownGracePeriod() time.Duration {
+	if s := config.GetConfig().Options.ShutdownGracePeriod; s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	return defaultShutdownGracePeriod
+}
+
+// StopOnSignal closes the Stop channel on SIGTERM or SIGINT
+func StopOnSignal() {
+	signalChannel := make(chan os.Signal, 2)
+	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signalChannel
+		logging.Logger.Info("quiting...", "gracePeriod", ShutdownGracePeriod())
+		StopAll()
+	}()
+}
+
+// StopAll closes the Stop channel (at most once)
+func StopAll() {
+	stopOnce.Do(func() {
+		close(Stop)
+	})
+}
+
+func stopping() bool {
+	select {
+	case <-Stop:
+		return true
+	default:
+		return false
+	}
+}
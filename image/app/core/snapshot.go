@@ -0,0 +1,68 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/tree"
+	"time"
+)
+
+const defaultSnapshotTTL = 24 // hours
+
+// Snapshot is the cached tree of a repository (or a dataset) at a revision, e.g., a commit or the last update time of the dataset,
+// so that the next compare only needs the changes since that revision
+type Snapshot struct {
+	Revision string               `json:"revision"`
+	Nodes    map[string]tree.Node `json:"nodes"`
+}
+
+// SnapshotsEnabled is false when the snapshots are disabled with a negative snapshotTTL
+func SnapshotsEnabled() bool {
+	return config.GetConfig().Options.SnapshotTTL >= 0
+}
+
+func snapshotDuration() time.Duration {
+	if h := config.GetConfig().Options.SnapshotTTL; h > 0 {
+		return time.Duration(h) * time.Hour
+	}
+	return defaultSnapshotTTL * time.Hour
+}
+
+func RepositorySnapshotKey(plugin, url, repoName, option string) string {
+	return "snapshot: " + plugin + " " + url + " " + repoName + "@" + option
+}
+
+func DatasetSnapshotKey(persistentId string) string {
+	return "snapshot: dataset: " + persistentId
+}
+
+func GetSnapshot(ctx context.Context, key string) (Snapshot, bool) {
+	shortContext, cancel := context.WithTimeout(ctx, redisCtxDuration)
+	defer cancel()
+	res := Snapshot{}
+	cached, _ := config.GetRedis().Get(shortContext, key)
+	if cached == "" || json.Unmarshal([]byte(cached), &res) != nil || res.Revision == "" {
+		return Snapshot{}, false
+	}
+	return res, true
+}
+
+// StoreSnapshot copies the nodes, failures are only logged: the next compare then queries the full tree again
+func StoreSnapshot(ctx context.Context, key, revision string, nodes map[string]tree.Node) {
+	if !SnapshotsEnabled() || revision == "" {
+		return
+	}
+	shortContext, cancel := context.WithTimeout(ctx, redisCtxDuration)
+	defer cancel()
+	b, err := json.Marshal(Snapshot{revision, nodes})
+	if err == nil {
+		err = config.GetRedis().Set(shortContext, key, string(b), snapshotDuration())
+	}
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "storing snapshot failed", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,91 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"integration/app/logging"
+	"integration/app/tree"
+)
+
+// StorageLimits are the limits of the destination on the files written to a dataset
+type StorageLimits struct {
+	MaxFileSize    int64  `json:"maxFileSize,omitempty"` // largest file that can be uploaded, 0 when not limited
+	StorageDriver  string `json:"storageDriver,omitempty"`
+	HasQuota       bool   `json:"hasQuota"`
+	QuotaRemaining int64  `json:"quotaRemaining"`       // bytes left in the storage quota of the dataset or its collection
+	Collection     string `json:"collection,omitempty"` // set when the quota is the quota of the collection
+}
+
+// GetStorageLimits returns the storage limits of the dataset, no limits when the destination does not support them or they can
+// not be read (the upload then fails at the destination when it exceeds them)
+func GetStorageLimits(ctx context.Context, token, user, persistentId string) StorageLimits {
+	if Destination.GetStorageLimits == nil {
+		return StorageLimits{}
+	}
+	limits, err := Destination.GetStorageLimits(ctx, token, user, persistentId)
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "getting the storage limits failed", "persistentId", persistentId, "error", err)
+		return StorageLimits{}
+	}
+	return limits
+}
+
+// CheckStorageLimits returns an error wrapping ErrQuotaExceeded when the files of the job selected for copy or update do not fit
+// in the remaining storage quota, or when a file exceeds its size limit (see FileSizeLimits); a bundle counts with the size of its
+// members
+func CheckStorageLimits(ctx context.Context, job Job) error {
+	limits := GetStorageLimits(ctx, job.DataverseKey, job.User, job.PersistentId)
+	sizeLimits := NewFileSizeLimits(ctx, job.Plugin, job.StreamParams.PluginId, limits.StorageDriver, limits.MaxFileSize, job.UnpackArchives)
+	size := int64(0)
+	for id, v := range job.WritableNodes {
+		if !v.Attributes.IsFile || (v.Action != tree.Copy && v.Action != tree.Update) {
+			continue
+		}
+		fileSize := v.Attributes.RemoteFilesize
+		if b, ok := job.Bundles[id]; ok {
+			for _, m := range b.Members {
+				fileSize += m.Attributes.RemoteFilesize
+			}
+		}
+		if limit := sizeLimits.For(id); limit.Exceeded(fileSize) {
+			return fmt.Errorf("%w: %v has %d bytes, the limit is %d bytes (%v)", ErrQuotaExceeded, id, fileSize, limit.Limit, limit.Source)
+		}
+		size += fileSize
+	}
+	if exceeded := limits.exceededQuota(size); exceeded != "" {
+		return fmt.Errorf("%w: %v", ErrQuotaExceeded, exceeded)
+	}
+	return nil
+}
+
+// StorageQuotaWarning checks the remaining storage quota at compare time, for the files that are selected by default (the new and
+// updated files)
+func (limits StorageLimits) StorageQuotaWarning(nodes []tree.Node) (Warning, bool) {
+	size := int64(0)
+	for _, v := range nodes {
+		if v.Status == tree.New || v.Status == tree.Updated {
+			size += v.Attributes.RemoteFilesize
+		}
+	}
+	exceeded := limits.exceededQuota(size)
+	if exceeded == "" {
+		return Warning{}, false
+	}
+	return Warning{
+		Type:    WarningQuotaExceeded,
+		Message: fmt.Sprintf("%v: %v, free storage or ask the administrators for a larger quota", ErrQuotaExceeded, exceeded),
+	}, true
+}
+
+// the updated files are counted with their full size, as the replaced files remain in the published versions
+func (limits StorageLimits) exceededQuota(size int64) string {
+	if !limits.HasQuota || size <= limits.QuotaRemaining {
+		return ""
+	}
+	if limits.Collection != "" {
+		return fmt.Sprintf("%d bytes to copy or update, %d bytes are left in the storage quota of collection %v", size, limits.QuotaRemaining, limits.Collection)
+	}
+	return fmt.Sprintf("%d bytes to copy or update, %d bytes are left in the storage quota of the dataset", size, limits.QuotaRemaining)
+}
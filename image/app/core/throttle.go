@@ -0,0 +1,242 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	throughputInterval      = 2 * time.Second
+	defaultStreamBufferSize = 1024 * 1024
+)
+
+// rateLimiter is a token bucket allowing bursts of at most one second worth of bytes
+type rateLimiter struct {
+	mu        sync.Mutex
+	rate      float64
+	allowance float64
+	last      time.Time
+}
+
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{rate: float64(bytesPerSecond), allowance: float64(bytesPerSecond), last: time.Now()}
+}
+
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	now := time.Now()
+	l.allowance += now.Sub(l.last).Seconds() * l.rate
+	if l.allowance > l.rate {
+		l.allowance = l.rate
+	}
+	l.last = now
+	l.allowance -= float64(n)
+	var delay time.Duration
+	if l.allowance < 0 {
+		delay = time.Duration(-l.allowance / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+	if delay == 0 {
+		return nil
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(delay):
+		return nil
+	}
+}
+
+var globalLimiter *rateLimiter
+var globalLimiterOnce sync.Once
+
+// the global limit is shared by all workers of this instance
+func getGlobalLimiter() *rateLimiter {
+	globalLimiterOnce.Do(func() {
+		globalLimiter = newRateLimiter(config.GetConfig().Options.Throttling.GlobalBytesPerSecond)
+	})
+	return globalLimiter
+}
+
+// memoryLimiter is a semaphore on the bytes buffered by the streamed files: a stream waits until its reservation fits in the limit,
+// one stream is always let through so that a reservation above the limit does not wait forever
+type memoryLimiter struct {
+	mu      sync.Mutex
+	limit   int64
+	used    int64
+	changed chan struct{}
+}
+
+func newMemoryLimiter(limit int64) *memoryLimiter {
+	if limit <= 0 {
+		return nil
+	}
+	return &memoryLimiter{limit: limit, changed: make(chan struct{})}
+}
+
+func (l *memoryLimiter) acquire(ctx context.Context, n int64) error {
+	if l == nil {
+		return nil
+	}
+	for {
+		l.mu.Lock()
+		if l.used == 0 || l.used+n <= l.limit {
+			l.used += n
+			l.mu.Unlock()
+			return nil
+		}
+		changed := l.changed
+		l.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+func (l *memoryLimiter) release(n int64) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.used -= n
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+var streamMemory *memoryLimiter
+var streamMemoryOnce sync.Once
+
+// the stream memory limit is shared by all workers of this instance
+func getStreamMemory() *memoryLimiter {
+	streamMemoryOnce.Do(func() {
+		streamMemory = newMemoryLimiter(config.GetConfig().Options.Throttling.MaxStreamMemory)
+	})
+	return streamMemory
+}
+
+// reserveStreamMemory waits until the buffers of a streamed file (the copy buffer, the zip compression of the SWORD uploads and the
+// bundles, the HTTP buffers) fit in the stream memory limit, the returned reservation must be released when the file is written
+func reserveStreamMemory(ctx context.Context, fileSize int64) (int64, error) {
+	l := getStreamMemory()
+	if l == nil {
+		return 0, nil
+	}
+	n := config.GetConfig().Options.Throttling.StreamBufferSize
+	if n <= 0 {
+		n = defaultStreamBufferSize
+	}
+	if fileSize > 0 && fileSize < n {
+		n = fileSize
+	}
+	start := time.Now()
+	if err := l.acquire(ctx, n); err != nil {
+		return 0, err
+	}
+	if waited := time.Since(start); waited > time.Second {
+		logging.Logger.DebugContext(ctx, "stream waited for buffer memory", "waited", waited.String(), "reserved", n)
+	}
+	return n, nil
+}
+
+func releaseStreamMemory(n int64) {
+	if n > 0 {
+		getStreamMemory().release(n)
+	}
+}
+
+// jobThrottle limits the transfer rate of a job and measures its throughput, published in Redis for the job progress API
+type jobThrottle struct {
+	persistentId string
+	limiters     []*rateLimiter
+	mu           sync.Mutex
+	bytes        int64
+	since        time.Time
+}
+
+func newJobThrottle(persistentId string) *jobThrottle {
+	limiters := []*rateLimiter{}
+	if l := getGlobalLimiter(); l != nil {
+		limiters = append(limiters, l)
+	}
+	if l := newRateLimiter(config.GetConfig().Options.Throttling.JobBytesPerSecond); l != nil {
+		limiters = append(limiters, l)
+	}
+	return &jobThrottle{persistentId: persistentId, limiters: limiters, since: time.Now()}
+}
+
+func (t *jobThrottle) transferred(ctx context.Context, n int) error {
+	for _, l := range t.limiters {
+		if err := l.wait(ctx, n); err != nil {
+			return err
+		}
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.bytes += int64(n)
+	if elapsed := time.Since(t.since); elapsed >= throughputInterval {
+		throughput := int64(float64(t.bytes) / elapsed.Seconds())
+		config.GetRedis().Set(ctx, throughputKey(t.persistentId), strconv.FormatInt(throughput, 10), 5*throughputInterval)
+		t.bytes, t.since = 0, time.Now()
+	}
+	return nil
+}
+
+func (t *jobThrottle) done(ctx context.Context) {
+	config.GetRedis().Del(ctx, throughputKey(t.persistentId))
+}
+
+func (t *jobThrottle) stream(s types.Stream) types.Stream {
+	return types.Stream{
+		Open: func(ctx context.Context) (io.Reader, error) {
+			reader, err := s.Open(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return throttledReader{ctx, reader, t}, nil
+		},
+		Close: s.Close,
+	}
+}
+
+type throttledReader struct {
+	ctx      context.Context
+	reader   io.Reader
+	throttle *jobThrottle
+}
+
+func (r throttledReader) Read(buf []byte) (n int, err error) {
+	n, err = r.reader.Read(buf)
+	if throttleErr := r.throttle.transferred(r.ctx, n); throttleErr != nil && err == nil {
+		err = throttleErr
+	}
+	return
+}
+
+func throughputKey(persistentId string) string {
+	return fmt.Sprintf("throughput: %v", persistentId)
+}
+
+// GetThroughput returns the current transfer rate (bytes per second) of the running job, 0 when not known
+func GetThroughput(ctx context.Context, persistentId string) int64 {
+	cached, _ := config.GetRedis().Get(ctx, throughputKey(persistentId))
+	res, _ := strconv.ParseInt(cached, 10, 64)
+	return res
+}
@@ -0,0 +1,110 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// commandWaitDelay bounds the wait for the output of a stopped command, e.g., still held open by the processes it started
+const commandWaitDelay = 10 * time.Second
+
+// commandReader reads the output of the transformation command, closing it before the end of the output (e.g., after a failed
+// upload) kills the command, which would otherwise block on writing its output
+type commandReader struct {
+	io.ReadCloser
+	cmd    *exec.Cmd
+	stderr *bytes.Buffer
+	eof    bool
+}
+
+func (r *commandReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err == io.EOF {
+		r.eof = true
+	}
+	return n, err
+}
+
+func (r *commandReader) Close() error {
+	if !r.eof {
+		// the remaining output is discarded when Wait closes the pipe
+		r.cmd.Process.Kill()
+		r.cmd.Wait()
+		return fmt.Errorf("transformation command stopped before the end of its output")
+	}
+	err := r.cmd.Wait()
+	if err != nil {
+		return fmt.Errorf("transformation command failed: %v: %s", err, strings.TrimSpace(r.stderr.String()))
+	}
+	return nil
+}
+
+func transformHookName() string {
+	hook := config.GetConfig().Options.TransformHook
+	if len(hook.Command) > 0 {
+		return strings.Join(hook.Command, " ")
+	}
+	return hook.WebhookUrl
+}
+
+func transformApplies(id string) bool {
+	hook := config.GetConfig().Options.TransformHook
+	if len(hook.Command) == 0 && hook.WebhookUrl == "" {
+		return false
+	}
+	return hook.Matches(id)
+}
+
+// transform passes the file content through the configured hook (e.g., stripping patient identifiers) before it is staged,
+// the returned reader must be closed after reading in order to collect the errors of the hook
+func transform(ctx context.Context, id string, in io.Reader) (io.ReadCloser, error) {
+	hook := config.GetConfig().Options.TransformHook
+	if len(hook.Command) > 0 {
+		return runCommand(ctx, hook.Command, id, in)
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", hook.WebhookUrl, in)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("Content-Type", "application/octet-stream")
+	request.Header.Add("X-File-Id", id)
+	r, err := httpclient.Get("transform").Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("transformation webhook failed: %v", err)
+	}
+	if r.StatusCode != 200 {
+		b, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		return nil, fmt.Errorf("transformation webhook failed: %d - %s", r.StatusCode, string(b))
+	}
+	return r.Body, nil
+}
+
+// runCommand starts the command with the content as its input and the file id in the FILE_ID environment variable
+func runCommand(ctx context.Context, command []string, id string, in io.Reader) (io.ReadCloser, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), "FILE_ID="+id)
+	cmd.Stdin = in
+	cmd.WaitDelay = commandWaitDelay
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting transformation command failed: %v", err)
+	}
+	return &commandReader{ReadCloser: out, cmd: cmd, stderr: stderr}, nil
+}
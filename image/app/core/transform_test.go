@@ -0,0 +1,58 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCommand(t *testing.T) {
+	out, err := runCommand(context.Background(), []string{"sh", "-c", `tr a-z A-Z; echo " $FILE_ID"`}, "data/a.txt", strings.NewReader("abc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "ABC data/a.txt\n" {
+		t.Fatalf("unexpected output %q", b)
+	}
+	if err = out.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	out, err = runCommand(context.Background(), []string{"sh", "-c", "echo failed >&2; exit 3"}, "a.txt", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(out)
+	if err = out.Close(); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Fatalf("expected the error of the command with its stderr, got %v", err)
+	}
+}
+
+func TestRunCommandClosedEarly(t *testing.T) {
+	// the command keeps writing its output: closing the reader must stop it instead of waiting for it
+	out, err := runCommand(context.Background(), []string{"yes"}, "a.txt", strings.NewReader(""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = out.Read(make([]byte, 16)); err != nil {
+		t.Fatal(err)
+	}
+	closed := make(chan error, 1)
+	go func() { closed <- out.Close() }()
+	select {
+	case err = <-closed:
+		if err == nil {
+			t.Fatal("expected an error for the output that was not read to the end")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("closing the reader did not stop the command")
+	}
+}
@@ -5,6 +5,7 @@ package core
 import (
 	"context"
 	"integration/app/tree"
+	"regexp"
 )
 
 const (
@@ -14,12 +15,30 @@ const (
 )
 
 type CompareResponse struct {
-	Id          string      `json:"id"`
-	Status      int         `json:"status"`
-	Data        []tree.Node `json:"data"`
-	Url         string      `json:"url"`
-	MaxFileSize int64       `json:"maxFileSize,omitempty"`
-	Rejected    []string    `json:"rejected,omitempty"`
+	Id          string                   `json:"id"`
+	Status      int                      `json:"status"`
+	Data        []tree.Node              `json:"data"`
+	Url         string                   `json:"url"`
+	MaxFileSize int64                    `json:"maxFileSize,omitempty"`
+	Rejected    []string                 `json:"rejected,omitempty"`
+	TooLarge    map[string]FileSizeLimit `json:"tooLarge,omitempty"` // the rejected files exceeding their size limit, with the applied limit
+	Warnings    []Warning                `json:"warnings,omitempty"`
+	Throughput  int64                    `json:"throughput,omitempty"` // current transfer rate of the running job in bytes per second
+	Summary     *tree.Summary            `json:"summary,omitempty"`    // the files per status, in total and per folder (of all files, also when the data is paged or filtered)
+}
+
+const (
+	WarningCollision     = "collision"     // the paths map to the same path in the dataset, the files are not synchronized
+	WarningCaseCollision = "caseCollision" // the paths only differ in case, they clash when the dataset is downloaded on a case-insensitive file system
+	WarningQuotaExceeded = "quotaExceeded" // the new and updated files exceed the job limits or the storage quota, the store is refused unless fewer files are selected
+)
+
+// Warning is a problem found by the compare that the user can solve in the repository, e.g., by renaming the files
+type Warning struct {
+	Type    string   `json:"type"`
+	Id      string   `json:"id,omitempty"`    // the path in the dataset
+	Paths   []string `json:"paths,omitempty"` // the paths in the repository
+	Message string   `json:"message"`
 }
 
 func MergeNodeMaps(to, from map[string]tree.Node) map[string]tree.Node {
@@ -39,6 +58,9 @@ func MergeNodeMaps(to, from map[string]tree.Node) map[string]tree.Node {
 			node.Attributes.RemoteHash = v.Attributes.RemoteHash
 			node.Attributes.RemoteHashType = v.Attributes.RemoteHashType
 			node.Attributes.URL = v.Attributes.URL
+			node.Attributes.RemoteFilesize = v.Attributes.RemoteFilesize
+			node.Attributes.RemoteModified = v.Attributes.RemoteModified
+			node.Attributes.OriginalPath = v.Attributes.OriginalPath
 		}
 		res[k] = node
 	}
@@ -46,6 +68,7 @@ func MergeNodeMaps(to, from map[string]tree.Node) map[string]tree.Node {
 }
 
 func Compare(ctx context.Context, in map[string]tree.Node, pid, dataverseKey, user string, addJobs bool) CompareResponse {
+	in = withoutGeneratedFiles(in)
 	in, jobNeeded := localRehashToMatchRemoteHashType(ctx, dataverseKey, user, pid, in, addJobs)
 	data := []tree.Node{}
 	empty := false
@@ -59,6 +82,8 @@ func Compare(ctx context.Context, in map[string]tree.Node, pid, dataverseKey, us
 				v.Status = tree.New
 			case v.Attributes.DestinationFile.Hash == "?":
 				v.Status = tree.Unknown
+			case v.Attributes.DestinationFile.Hash == weakMatch:
+				v.Status = tree.WeakEqual
 			case v.Attributes.DestinationFile.Hash != v.Attributes.RemoteHash:
 				v.Status = tree.Updated
 			case v.Attributes.DestinationFile.Hash == v.Attributes.RemoteHash:
@@ -70,16 +95,39 @@ func Compare(ctx context.Context, in map[string]tree.Node, pid, dataverseKey, us
 		data = append(data, v)
 		empty = empty || v.Attributes.DestinationFile.Hash != ""
 	}
+	summary := tree.Summarize(data)
 	status := Finished
+	throughput := int64(0)
 	if jobNeeded || IsLocked(ctx, pid) {
 		status = Updating
+		throughput = GetThroughput(ctx, pid)
 	} else if empty {
 		status = New
 	}
 	return CompareResponse{
-		Id:     pid,
-		Status: status,
-		Data:   data,
-		Url:    Destination.GetRepoUrl(pid, false),
+		Id:         pid,
+		Status:     status,
+		Data:       data,
+		Url:        Destination.GetRepoUrl(ctx, pid, false),
+		Throughput: throughput,
+		Summary:    &summary,
+	}
+}
+
+// dataset versions that can be used in compare, the store jobs always write to the draft version
+const (
+	LatestVersion          = ":latest"
+	DraftVersion           = ":draft"
+	LatestPublishedVersion = ":latest-published"
+)
+
+var versionNumberR = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?$`)
+
+// ValidVersion returns true for an empty version (same as ":latest"), the symbolic versions and version numbers (e.g., "1.2")
+func ValidVersion(version string) bool {
+	switch version {
+	case "", LatestVersion, DraftVersion, LatestPublishedVersion:
+		return true
 	}
+	return versionNumberR.MatchString(version)
 }
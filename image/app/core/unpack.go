@@ -0,0 +1,181 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"integration/app/config"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"io"
+	"os"
+	pathpkg "path"
+	"strings"
+)
+
+var archiveExtensions = []string{".zip", ".tar.gz", ".tgz", ".tar"}
+
+// isArchive is true for the files that are unpacked when the job has UnpackArchives set
+func isArchive(id string) bool {
+	return archiveExtension(id) != ""
+}
+
+func archiveExtension(id string) string {
+	lower := strings.ToLower(id)
+	for _, ext := range archiveExtensions {
+		if strings.HasSuffix(lower, ext) && len(id) > len(ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// unpackArchive writes the regular files of the archive as separate files in the folder named after the archive (e.g.,
+// the entries of "export/run1.tar.gz" in "export/run1"), each entry is hashed while it is written; the ids of the written entries are returned
+func unpackArchive(ctx context.Context, job Job, id string, s types.Stream, writeFile func(string, tree.Node, types.Stream) error) ([]string, error) {
+	existing, err := Destination.Query(ctx, job.PersistentId, LatestVersion, job.DataverseKey, job.User)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := s.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	ext := archiveExtension(id)
+	dir := id[:len(id)-len(ext)]
+	written := []string{}
+	writeEntry := func(name string, size int64, entry types.Stream) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		node := entryNode(dir, name, size, existing)
+		if err := writeFile(node.Id, node, entry); err != nil {
+			return fmt.Errorf("unpacking %v from %v failed: %v", name, id, err)
+		}
+		written = append(written, node.Id)
+		return nil
+	}
+	if ext == ".zip" {
+		return written, unpackZip(reader, writeEntry)
+	}
+	if ext != ".tar" {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return written, err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return written, unpackTar(reader, writeEntry)
+}
+
+// unpackZip: the zip directory is at the end of the file, the archive is spooled to a temporary file first;
+// the CRC-32 of each entry is verified while reading it
+func unpackZip(reader io.Reader, writeEntry func(string, int64, types.Stream) error) error {
+	tmp, err := os.CreateTemp("", "unpack-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	size, err := io.Copy(tmp, reader)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(tmp, size)
+	if err != nil {
+		return err
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		var rc io.ReadCloser
+		err = writeEntry(f.Name, int64(f.UncompressedSize64), types.Stream{
+			Open: func(context.Context) (io.Reader, error) {
+				var err error
+				rc, err = f.Open()
+				return rc, err
+			},
+			Close: func() error {
+				if rc == nil {
+					return nil
+				}
+				return rc.Close()
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unpackTar streams the entries in the order of the archive, nothing is spooled
+func unpackTar(reader io.Reader, writeEntry func(string, int64, types.Stream) error) error {
+	tr := tar.NewReader(reader)
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		err = writeEntry(h.Name, h.Size, types.Stream{
+			Open:  func(context.Context) (io.Reader, error) { return tr, nil },
+			Close: func() error { return nil },
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// entryNode maps the path of the entry to a dataset path (see tree.SanitizeId), the entries already in the dataset are replaced
+func entryNode(dir, name string, size int64, existing map[string]tree.Node) tree.Node {
+	path := dir + "/" + strings.TrimPrefix(pathpkg.Clean("/"+name), "/")
+	id := tree.SanitizeId(path)
+	fileName := id[strings.LastIndex(id, "/")+1:]
+	node := tree.Node{
+		Id:     id,
+		Name:   fileName,
+		Path:   strings.TrimSuffix(strings.TrimSuffix(id, fileName), "/"),
+		Action: tree.Copy,
+		Attributes: tree.Attributes{
+			IsFile:         true,
+			RemoteHash:     types.NotNeeded, // the archives do not carry the checksums of the entries (zip only has CRC-32, verified when reading)
+			RemoteHashType: config.GetConfig().Options.DefaultHash,
+			RemoteFilesize: size,
+		},
+	}
+	if id != path {
+		node.Attributes.OriginalPath = path
+	}
+	if current, ok := existing[id]; ok {
+		node.Action = tree.Update
+		node.Attributes.DestinationFile.Id = current.Attributes.DestinationFile.Id
+	}
+	return node
+}
+
+// dropEntries removes the entries put back in the remaining nodes by a failed flush, the archive stays in the remaining
+// nodes and is unpacked again when the job is retried; true is returned when all entries are registered in Dataverse
+func dropEntries(nodes map[string]tree.Node, entries []string) bool {
+	complete := true
+	for _, e := range entries {
+		if _, ok := nodes[e]; ok {
+			delete(nodes, e)
+			complete = false
+		}
+	}
+	return complete
+}
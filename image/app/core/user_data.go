@@ -0,0 +1,150 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UserDataEntry describes something the service stores for a user (e.g., a cached OAuth token), so it can be listed and revoked
+type UserDataEntry struct {
+	Type        string    `json:"type"`
+	Key         string    `json:"key"`
+	Description string    `json:"description"`
+	Created     time.Time `json:"created"`
+	Expires     time.Time `json:"expires,omitempty"`
+}
+
+// sharedUserDataKeys are the prefixes of the keys of a dataset rather than of a user (e.g., the failed job of the dataset): their
+// value can be replaced by another user, it is only deleted for the user that stored it
+var sharedUserDataKeys = []string{"failed job: ", "adopt: "}
+
+// userDataKey is the set of the (JSON) entries of the user, it expires with the last of its entries
+func userDataKey(user string) string {
+	return "user data: " + user
+}
+
+// getUserDataIndex returns the last registered entry of each key, by key, and the members of the set to remove (replaced,
+// expired or malformed entries)
+func getUserDataIndex(ctx context.Context, user string) (map[string]UserDataEntry, map[string]string, []interface{}) {
+	entries, members, stale := map[string]UserDataEntry{}, map[string]string{}, []interface{}{}
+	stored, _ := config.GetRedis().SMembers(ctx, userDataKey(user))
+	for _, m := range stored {
+		e := UserDataEntry{}
+		if json.Unmarshal([]byte(m), &e) != nil || e.Expires.Before(time.Now()) {
+			stale = append(stale, m)
+			continue
+		}
+		if previous, ok := entries[e.Key]; ok {
+			if previous.Created.After(e.Created) {
+				stale = append(stale, m)
+				continue
+			}
+			stale = append(stale, members[e.Key])
+		}
+		entries[e.Key], members[e.Key] = e, m
+	}
+	return entries, members, stale
+}
+
+// RegisterUserData adds the Redis key to the index of the data stored for the user, with the expiration of the key (the index is
+// kept as long as its last entry); the entries of replaced or expired keys are pruned
+func RegisterUserData(ctx context.Context, user string, entry UserDataEntry, expiration time.Duration) {
+	if user == "" {
+		return
+	}
+	if expiration <= 0 {
+		expiration = config.LockMaxDuration
+	}
+	entry.Created = time.Now()
+	entry.Expires = entry.Created.Add(expiration)
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	entries, members, stale := getUserDataIndex(ctx, user)
+	latest := entry.Expires
+	for k, e := range entries {
+		if k == entry.Key {
+			stale = append(stale, members[k])
+		} else if e.Expires.After(latest) {
+			latest = e.Expires
+		}
+	}
+	config.GetRedis().SAdd(ctx, userDataKey(user), string(b))
+	if len(stale) > 0 {
+		config.GetRedis().SRem(ctx, userDataKey(user), stale...)
+	}
+	config.GetRedis().Expire(ctx, userDataKey(user), time.Until(latest))
+}
+
+// ownedBy tells whether the data of the key still belongs to the user, false when the key is gone
+func ownedBy(ctx context.Context, user, key string) bool {
+	cached, _ := config.GetRedis().Get(ctx, key)
+	if cached == "" {
+		return false
+	}
+	for _, prefix := range sharedUserDataKeys {
+		if strings.HasPrefix(key, prefix) {
+			// the failed jobs and the adoptions both have the user field
+			owner := struct{ User string }{}
+			return json.Unmarshal([]byte(cached), &owner) == nil && owner.User == user
+		}
+	}
+	return true
+}
+
+// ListUserData returns the entries that are still stored for the user, the most recent first
+func ListUserData(ctx context.Context, user string) []UserDataEntry {
+	res := []UserDataEntry{}
+	entries, _, _ := getUserDataIndex(ctx, user)
+	for _, e := range entries {
+		if ownedBy(ctx, user, e.Key) {
+			res = append(res, e)
+		}
+	}
+	if e, ok := orcidUserData(ctx, user); ok {
+		res = append(res, e)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Created.After(res[j].Created) })
+	return res
+}
+
+// RevokeUserData deletes the given keys (all stored data when no keys are given), only the keys registered for the user can be revoked
+func RevokeUserData(ctx context.Context, user string, keys []string) ([]UserDataEntry, error) {
+	if user == "" {
+		return nil, fmt.Errorf("user is not known")
+	}
+	toRevoke := map[string]bool{}
+	for _, k := range keys {
+		toRevoke[k] = true
+	}
+	revoked := []UserDataEntry{}
+	removed := []interface{}{}
+	entries, members, _ := getUserDataIndex(ctx, user)
+	for k, e := range entries {
+		if len(keys) > 0 && !toRevoke[k] {
+			continue
+		}
+		// a shared key replaced by another user (e.g., a new failed job of the dataset) is only removed from the index
+		if ownedBy(ctx, user, k) {
+			config.GetRedis().Del(ctx, k)
+		}
+		revoked = append(revoked, e)
+		removed = append(removed, members[k])
+	}
+	if len(removed) > 0 {
+		config.GetRedis().SRem(ctx, userDataKey(user), removed...)
+	}
+	if e, ok := orcidUserData(ctx, user); ok && (len(keys) == 0 || toRevoke[e.Key]) {
+		config.GetRedis().Del(ctx, e.Key)
+		revoked = append(revoked, e)
+	}
+	return revoked, nil
+}
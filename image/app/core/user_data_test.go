@@ -0,0 +1,46 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package core
+
+import (
+	"context"
+	"integration/app/config"
+	"testing"
+	"time"
+)
+
+func TestRevokeSharedUserData(t *testing.T) {
+	config.SetRedis(config.NewMemoryClient())
+	ctx := context.Background()
+	key := "failed job: doi:10.5072/FK2/SHARED"
+	config.GetRedis().Set(ctx, key, `{"User": "alice"}`, time.Hour)
+	RegisterUserData(ctx, "alice", UserDataEntry{Type: "failed job", Key: key}, time.Hour)
+	RegisterUserData(ctx, "alice", UserDataEntry{Type: "failed job", Key: key}, time.Hour)
+	if entries := ListUserData(ctx, "alice"); len(entries) != 1 || entries[0].Key != key {
+		t.Fatalf("expected one entry for %v, got %+v", key, entries)
+	}
+
+	// a new failed job of another user replaces the value of the shared key
+	config.GetRedis().Set(ctx, key, `{"User": "bob"}`, time.Hour)
+	RegisterUserData(ctx, "bob", UserDataEntry{Type: "failed job", Key: key}, time.Hour)
+	if entries := ListUserData(ctx, "alice"); len(entries) != 0 {
+		t.Errorf("the replaced key is still listed for the previous user: %+v", entries)
+	}
+	if _, err := RevokeUserData(ctx, "alice", nil); err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := config.GetRedis().Get(ctx, key); stored == "" {
+		t.Fatal("the key of the other user was deleted")
+	}
+
+	revoked, err := RevokeUserData(ctx, "bob", []string{key})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := config.GetRedis().Get(ctx, key); stored != "" || len(revoked) != 1 {
+		t.Errorf("the key of the user was not revoked: %v, %+v", stored, revoked)
+	}
+	if members, _ := config.GetRedis().SMembers(ctx, userDataKey("bob")); len(members) != 0 {
+		t.Errorf("the revoked entries are still in the index: %v", members)
+	}
+}
@@ -3,21 +3,27 @@
 package core
 
 import (
+	"context"
 	"fmt"
 	"integration/app/config"
 	"integration/app/logging"
 	"net/http"
 	"net/smtp"
+	"strings"
 
 	"github.com/google/uuid"
 )
 
 func GetUserFromHeader(h http.Header) string {
-	hn := "Ajp_uid"
+	return getValueFromHeader(h, UserHeaderName())
+}
+
+// UserHeaderName is the header with the user name, set by the proxy (Shibboleth) or by the OIDC authentication of the server
+func UserHeaderName() string {
 	if config.GetConfig().Options.UserHeaderName != "" {
-		hn = config.GetConfig().Options.UserHeaderName
+		return config.GetConfig().Options.UserHeaderName
 	}
-	return getValueFromHeader(h, hn)
+	return "Ajp_uid"
 }
 
 func GetSessionId(h http.Header) string {
@@ -34,13 +40,22 @@ func getValueFromHeader(h http.Header, hn string) string {
 
 func SendMail(msg string, to []string) error {
 	if config.GetConfig().Options.SmtpConfig.Host == "" {
-		logging.Logger.Println("smtp is not configured: message could not be sent:", msg)
+		logging.Logger.Warn("smtp is not configured: message could not be sent", "message", msg)
 		return nil
 	}
+	err := sendMail(msg, to)
+	// 535: authentication failed, the password may have been rotated
+	if err != nil && strings.HasPrefix(err.Error(), "535") && config.RefreshSecret(context.Background(), config.SecretSmtpPassword) {
+		return sendMail(msg, to)
+	}
+	return err
+}
+
+func sendMail(msg string, to []string) error {
 	conf := config.GetConfig().Options.SmtpConfig
 	var auth smtp.Auth
-	if config.SmtpPassword != "" {
-		auth = smtp.PlainAuth("", conf.From, config.SmtpPassword, conf.Host)
+	if config.SmtpPassword() != "" {
+		auth = smtp.PlainAuth("", conf.From, config.SmtpPassword(), conf.Host)
 	}
 	return smtp.SendMail(conf.Host+":"+conf.Port, auth, conf.From, to, []byte(msg))
 }
@@ -58,7 +73,7 @@ func getContentOnSucces(job Job) string {
 	if config.GetConfig().Options.MailConfig.ContentOnSucces != "" {
 		template = config.GetConfig().Options.MailConfig.ContentOnSucces
 	}
-	return fmt.Sprintf(template, Destination.GetRepoUrl(job.PersistentId, true), job.PersistentId)
+	return fmt.Sprintf(template, Destination.GetRepoUrl(jobContext(job), job.PersistentId, true), job.PersistentId)
 }
 
 func getSubjectOnError(_ error, job Job) string {
@@ -74,5 +89,5 @@ func getContentOnError(_ error, job Job) string {
 	if config.GetConfig().Options.MailConfig.ContentOnError != "" {
 		template = config.GetConfig().Options.MailConfig.ContentOnError
 	}
-	return fmt.Sprintf(template, Destination.GetRepoUrl(job.PersistentId, true), job.PersistentId)
+	return fmt.Sprintf(template, Destination.GetRepoUrl(jobContext(job), job.PersistentId, true), job.PersistentId)
 }
@@ -0,0 +1,51 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"context"
+	"fmt"
+	"integration/app/config"
+	"strings"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+type recreateTokenResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	Data    struct {
+		Message string `json:"message"`
+	} `json:"data"`
+}
+
+// CreateApiToken (re)creates the API token of the user with the native users API, called with a URL signed on behalf of the user:
+// Dataverse keeps one token per user, the previous token of the user stops working
+func CreateApiToken(ctx context.Context, user string) (string, error) {
+	if err := requireFeature(ctx, featureUrlSigning); err != nil {
+		return "", err
+	}
+	if config.TargetApiKey(ctx) == "" || config.TargetUnblockKey(ctx) == "" {
+		return "", fmt.Errorf("the API tokens can only be created with the signed URLs: the admin API key and the unblock key must be configured")
+	}
+	if user == "" {
+		return "", fmt.Errorf("the API token can not be created without user")
+	}
+	// the query is needed by the URL signing of the library, the expiration is added to the message
+	path := "/api/v1/users/token/recreate?returnExpiration=true"
+	res := recreateTokenResponse{}
+	req := GetRequest(ctx, path, "POST", user, "", nil, nil)
+	err := api.Do(ctx, req, &res)
+	if err != nil {
+		return "", err
+	}
+	if res.Status != "OK" {
+		return "", fmt.Errorf("creating the API token failed: %v", res.Message)
+	}
+	// "New token for @user is <token>", followed by " and expires on <date>" when the expiration is returned
+	_, token, ok := strings.Cut(res.Data.Message, " is ")
+	if !ok || len(strings.Fields(token)) == 0 {
+		return "", fmt.Errorf("unexpected response when creating the API token: %v", res.Data.Message)
+	}
+	return strings.Fields(token)[0], nil
+}
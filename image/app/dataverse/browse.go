@@ -0,0 +1,187 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+// the items of the my data call, with the roles of the user that are not in api.Item
+type myDataItem struct {
+	api.Item
+	UserRoles []string `json:"user_roles"`
+}
+
+type myDataResponse struct {
+	Success      bool   `json:"success"`
+	ErrorMessage string `json:"error_message"`
+	Data         struct {
+		Pagination api.Pagination `json:"pagination"`
+		Items      []myDataItem   `json:"items"`
+		TotalCount int            `json:"total_count"`
+	} `json:"data"`
+}
+
+// ListDatasets returns a page of the datasets where the user has a role, found with the "retrieve" my data call
+func ListDatasets(ctx context.Context, token, user string, query core.DatasetQuery) (core.DatasetPage, error) {
+	page := max(query.Page, 1)
+	roleIds := []int{}
+	if query.Editable {
+		roleIds = config.GetConfig().Options.MyDataRoleIds
+	}
+	res := myDataResponse{}
+	path := myDataPath(ctx, "Dataset", query.Collection, query.SearchTerm, token, roleIds, page)
+	err := api.Do(ctx, GetRequest(ctx, path, "GET", user, token, nil, nil), &res)
+	if err != nil {
+		return core.DatasetPage{}, err
+	}
+	if !res.Success {
+		// an empty result is reported as an error by the my data call
+		if strings.Contains(res.ErrorMessage, "no results") {
+			return core.DatasetPage{Items: []core.DatasetItem{}, Page: page}, nil
+		}
+		return core.DatasetPage{}, fmt.Errorf("listing datasets was not successful: %v", res.ErrorMessage)
+	}
+	items := []core.DatasetItem{}
+	for _, v := range res.Data.Items {
+		items = append(items, core.DatasetItem{
+			PersistentId:   v.GlobalId,
+			Title:          v.Name,
+			Collection:     v.IdentifierOfDataverse,
+			CollectionName: v.NameOfDataverse,
+			VersionState:   v.VersionState,
+			UpdatedAt:      v.UpdatedAt,
+			Roles:          v.UserRoles,
+			Url:            GetDatasetUrl(ctx, v.GlobalId, v.IsDraftState),
+		})
+	}
+	return core.DatasetPage{Items: items, Page: page, HasNextPage: res.Data.Pagination.HasNextPageNumber, Total: res.Data.TotalCount}, nil
+}
+
+// CollectionContents returns the subcollections and the datasets of the collection (alias or database id, the root collection
+// when empty) that the user can see
+func CollectionContents(ctx context.Context, token, user, collection string) ([]core.CollectionItem, error) {
+	if collection == "" {
+		collection = config.GetConfig().Options.RootDataverseId
+	}
+	if collection == "" {
+		collection = ":root"
+	}
+	type Child struct {
+		Type       string `json:"type"`
+		Id         int64  `json:"id"`
+		Title      string `json:"title"`
+		Protocol   string `json:"protocol"`
+		Authority  string `json:"authority"`
+		Identifier string `json:"identifier"`
+	}
+	type Res struct {
+		api.DvResponse
+		Data []Child `json:"data"`
+	}
+	res := Res{}
+	path := "/api/v1/dataverses/" + url.PathEscape(collection) + "/contents"
+	err := api.Do(ctx, GetRequest(ctx, path, "GET", user, token, nil, nil), &res)
+	if err != nil {
+		return nil, err
+	}
+	if res.Status != "OK" {
+		return nil, fmt.Errorf("listing the contents of collection %v failed: %v", collection, res.Message)
+	}
+	items := []core.CollectionItem{}
+	for _, v := range res.Data {
+		switch v.Type {
+		case "dataverse":
+			items = append(items, core.CollectionItem{Type: "collection", Id: fmt.Sprint(v.Id), Title: v.Title})
+		case "dataset":
+			items = append(items, core.CollectionItem{Type: "dataset", Id: v.Protocol + ":" + v.Authority + "/" + v.Identifier})
+		}
+	}
+	return items, nil
+}
+
+// DatasetCollections returns the collections where the user has a role (any role, e.g., dataset creator) and can add datasets, as
+// the options of the collection of a new dataset; the permissions are checked as the permissions of the datasets (see
+// permissionCheck), the collections that can not be checked are left out
+func DatasetCollections(ctx context.Context, searchTerm, token, user string) ([]types.SelectItem, error) {
+	collections, err := listDvObjects(ctx, "Dataverse", "", searchTerm, token, user, nil)
+	if err != nil {
+		return nil, err
+	}
+	res := []types.SelectItem{}
+	added := map[string]bool{}
+	for _, v := range collections {
+		if added[v.Identifier] {
+			continue
+		}
+		added[v.Identifier] = true
+		ok, err := canAddDataset(ctx, token, user, v.Identifier)
+		if errors.Is(err, errUnblockKeyRejected) && config.RefreshSecret(ctx, config.SecretUnblockKey) {
+			ok, err = canAddDataset(ctx, token, user, v.Identifier)
+		}
+		if err != nil {
+			logging.Logger.WarnContext(ctx, "checking the permission to add datasets failed", "collection", v.Identifier, "error", err)
+			continue
+		}
+		if ok {
+			res = append(res, types.SelectItem{Label: v.Name + " (" + v.Identifier + ")", Value: v.Identifier})
+		}
+	}
+	return res, nil
+}
+
+// canAddDataset tells whether the user has the AddDataset permission on the collection, checked with the admin API or with the
+// native userPermissions API of the collections (not checked on the installations without that API)
+func canAddDataset(ctx context.Context, token, user, alias string) (bool, error) {
+	shortContext, cancel := context.WithTimeout(ctx, dvContextDuration)
+	defer cancel()
+	switch permissionCheck(ctx) {
+	case "none":
+		return true, nil
+	case "native":
+		type Res struct {
+			api.DvResponse
+			Data struct {
+				CanAddDataset bool `json:"canAddDataset"`
+			} `json:"data"`
+		}
+		res := Res{}
+		req := GetRequest(ctx, "/api/v1/dataverses/"+url.PathEscape(alias)+"/userPermissions", "GET", user, token, nil, nil)
+		if err := api.Do(shortContext, req, &res); err != nil {
+			return false, err
+		}
+		if res.Status != "OK" {
+			if strings.Contains(res.Message, "endpoint does not exist") {
+				return true, nil
+			}
+			return false, fmt.Errorf("permission check status is %s for collection %s: %v", res.Status, alias, res.Message)
+		}
+		return res.Data.CanAddDataset, nil
+	}
+	if config.TargetUnblockKey(ctx) == "" {
+		return false, fmt.Errorf("the permissions can not be checked with the admin API: no unblock key configured")
+	}
+	res := api.Permissions{}
+	path := fmt.Sprintf("/api/v1/admin/permissions/%s?unblock-key=%s", url.PathEscape(alias), config.TargetUnblockKey(ctx))
+	if err := api.Do(shortContext, GetRequest(ctx, path, "GET", user, token, nil, nil), &res); err != nil {
+		return false, err
+	}
+	if res.Status != "OK" {
+		if strings.Contains(strings.ToLower(res.Message), "block") {
+			return false, fmt.Errorf("%w: %v", errUnblockKeyRejected, res.Message)
+		}
+		return false, fmt.Errorf("permission check status is %s for collection %s", res.Status, alias)
+	}
+	return slices.Contains(res.Data.Permissions, "AddDataset"), nil
+}
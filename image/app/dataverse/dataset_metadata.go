@@ -0,0 +1,231 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/core"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+type field struct {
+	TypeName  string      `json:"typeName"`
+	Multiple  bool        `json:"multiple"`
+	TypeClass string      `json:"typeClass"`
+	Value     interface{} `json:"value"`
+}
+
+type metadataBlocksResponse struct {
+	api.DvResponse
+	Data []metadataBlock `json:"data"`
+}
+
+type metadataBlockResponse struct {
+	api.DvResponse
+	Data metadataBlock `json:"data"`
+}
+
+type metadataBlock struct {
+	Name   string                   `json:"name"`
+	Fields map[string]metadataField `json:"fields"`
+}
+
+type metadataField struct {
+	Name                       string   `json:"name"`
+	ControlledVocabularyValues []string `json:"controlledVocabularyValues"`
+}
+
+func primitive(typeName, value string) field {
+	return field{TypeName: typeName, Multiple: false, TypeClass: "primitive", Value: value}
+}
+
+func compound(typeName string, values []map[string]field) field {
+	return field{TypeName: typeName, Multiple: true, TypeClass: "compound", Value: values}
+}
+
+func createDatasetRequestBody(user api.User, md core.DatasetMetadata) (io.Reader, error) {
+	authors := md.Authors
+	if len(authors) == 0 {
+		authors = []core.Author{{
+			Name:        fmt.Sprintf("%v, %v", user.Data.LastName, user.Data.FirstName),
+			Affiliation: user.Data.Affiliation,
+		}}
+	}
+	contacts := md.Contacts
+	if len(contacts) == 0 && user.Data.Email != "" {
+		contacts = []core.Contact{{
+			Name:  fmt.Sprintf("%v, %v", user.Data.LastName, user.Data.FirstName),
+			Email: user.Data.Email,
+		}}
+	}
+
+	fields := []field{}
+	if md.Title != "" {
+		fields = append(fields, primitive("title", md.Title))
+	}
+	authorValues := []map[string]field{}
+	for _, a := range authors {
+		v := map[string]field{"authorName": primitive("authorName", a.Name)}
+		if a.Affiliation != "" {
+			v["authorAffiliation"] = primitive("authorAffiliation", a.Affiliation)
+		}
+		if a.Identifier != "" {
+			if scheme := identifierScheme(a.Identifier); scheme != "" {
+				v["authorIdentifierScheme"] = field{TypeName: "authorIdentifierScheme", TypeClass: "controlledVocabulary", Value: scheme}
+			}
+			v["authorIdentifier"] = primitive("authorIdentifier", a.Identifier)
+		}
+		authorValues = append(authorValues, v)
+	}
+	fields = append(fields, compound("author", authorValues))
+	if len(contacts) > 0 {
+		contactValues := []map[string]field{}
+		for _, c := range contacts {
+			contactValues = append(contactValues, map[string]field{
+				"datasetContactName":  primitive("datasetContactName", c.Name),
+				"datasetContactEmail": primitive("datasetContactEmail", c.Email),
+			})
+		}
+		fields = append(fields, compound("datasetContact", contactValues))
+	}
+	if len(md.Contributors) > 0 {
+		contributorValues := []map[string]field{}
+		for _, c := range md.Contributors {
+			contributorValues = append(contributorValues, map[string]field{
+				"contributorType": {TypeName: "contributorType", TypeClass: "controlledVocabulary", Value: c.Type},
+				"contributorName": primitive("contributorName", contributorName(c)),
+			})
+		}
+		fields = append(fields, compound("contributor", contributorValues))
+	}
+	if md.Description != "" {
+		fields = append(fields, compound("dsDescription", []map[string]field{{
+			"dsDescriptionValue": primitive("dsDescriptionValue", md.Description),
+		}}))
+	}
+	if len(md.Subjects) > 0 {
+		fields = append(fields, field{TypeName: "subject", Multiple: true, TypeClass: "controlledVocabulary", Value: md.Subjects})
+	}
+
+	body := map[string]interface{}{
+		"datasetVersion": map[string]interface{}{
+			"metadataBlocks": map[string]interface{}{
+				"citation": map[string]interface{}{
+					"fields":      fields,
+					"displayName": "Citation Metadata",
+				},
+			},
+		},
+	}
+	b, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
+
+// the author identifier schemes of the citation metadata block, recognized by the URL prefix or by the form of the identifier
+var identifierSchemes = []struct {
+	scheme   string
+	prefixes []string
+	pattern  *regexp.Regexp
+}{
+	{"ORCID", []string{"https://orcid.org/", "http://orcid.org/"}, regexp.MustCompile(`^\d{4}-\d{4}-\d{4}-\d{3}[\dX]$`)},
+	{"ISNI", []string{"https://isni.org/isni/", "http://isni.org/isni/"}, regexp.MustCompile(`^\d{4} ?\d{4} ?\d{4} ?\d{3}[\dX]$`)},
+	{"LCNA", []string{"https://id.loc.gov/authorities/names/", "http://id.loc.gov/authorities/names/"}, regexp.MustCompile(`^n[a-z]?\d{8,10}$`)},
+	{"VIAF", []string{"https://viaf.org/viaf/", "http://viaf.org/viaf/"}, nil},
+	{"GND", []string{"https://d-nb.info/gnd/", "http://d-nb.info/gnd/"}, nil},
+	{"DAI", []string{"info:eu-repo/dai/"}, nil},
+	{"ResearcherID", nil, regexp.MustCompile(`^[A-Z]{1,3}-\d{4}-\d{4}$`)},
+	{"ScopusID", []string{"https://www.scopus.com/authid/detail.uri?authorId="}, nil},
+}
+
+// identifierScheme returns the scheme of the author identifier, empty when it is not recognized (the identifier is then sent without
+// scheme)
+func identifierScheme(identifier string) string {
+	identifier = strings.TrimSpace(identifier)
+	for _, s := range identifierSchemes {
+		for _, prefix := range s.prefixes {
+			if strings.HasPrefix(identifier, prefix) {
+				return s.scheme
+			}
+		}
+		if s.pattern != nil && s.pattern.MatchString(identifier) {
+			return s.scheme
+		}
+	}
+	return ""
+}
+
+// contributorName is the name of the contributor followed by the ORCID iD, the contributors have no identifier field in Dataverse
+func contributorName(c core.Contributor) string {
+	if c.Identifier == "" {
+		return c.Name
+	}
+	orcid := core.Orcid{Id: c.Identifier}.Url()
+	if c.Name == "" {
+		return orcid
+	}
+	return fmt.Sprintf("%v (%v)", c.Name, orcid)
+}
+
+// validates the requested metadata against the metadata blocks enabled in the target collection
+func validateMetadata(ctx context.Context, collection, token, user string, md core.DatasetMetadata) error {
+	blocks := metadataBlocksResponse{}
+	req := GetRequest(ctx, "/api/v1/dataverses/"+url.PathEscape(collection)+"/metadatablocks", "GET", user, token, nil, nil)
+	err := api.Do(ctx, req, &blocks)
+	if err != nil {
+		return err
+	}
+	if blocks.Status != "OK" {
+		return fmt.Errorf("getting metadata blocks of collection %v failed: %v", collection, blocks.Message)
+	}
+	hasCitation := false
+	for _, b := range blocks.Data {
+		hasCitation = hasCitation || b.Name == "citation"
+	}
+	if !hasCitation {
+		return fmt.Errorf("collection %v does not have the citation metadata block enabled", collection)
+	}
+	for _, c := range md.Contacts {
+		if c.Email == "" {
+			return fmt.Errorf("contact %q has no email address", c.Name)
+		}
+	}
+	for _, c := range md.Contributors {
+		if c.Type == "" || contributorName(c) == "" {
+			return fmt.Errorf("contributor %q has no name or no type", contributorName(c))
+		}
+	}
+	if len(md.Subjects) == 0 {
+		return nil
+	}
+
+	citation := metadataBlockResponse{}
+	req = GetRequest(ctx, "/api/v1/metadatablocks/citation", "GET", user, token, nil, nil)
+	err = api.Do(ctx, req, &citation)
+	if err != nil {
+		return err
+	}
+	if citation.Status != "OK" {
+		return fmt.Errorf("getting citation metadata block failed: %v", citation.Message)
+	}
+	allowed := map[string]bool{}
+	for _, v := range citation.Data.Fields["subject"].ControlledVocabularyValues {
+		allowed[strings.ToLower(v)] = true
+	}
+	for _, s := range md.Subjects {
+		if !allowed[strings.ToLower(s)] {
+			return fmt.Errorf("subject %q is not allowed, expected one of: %v", s, citation.Data.Fields["subject"].ControlledVocabularyValues)
+		}
+	}
+	return nil
+}
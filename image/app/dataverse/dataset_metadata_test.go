@@ -0,0 +1,25 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import "testing"
+
+func TestIdentifierScheme(t *testing.T) {
+	for identifier, expected := range map[string]string{
+		"0000-0002-1825-0097":                   "ORCID",
+		"https://orcid.org/0000-0002-1825-009X": "ORCID",
+		"0000 0001 2103 2683":                   "ISNI",
+		"0000000121032683":                      "ISNI",
+		"n79021164":                             "LCNA",
+		"https://viaf.org/viaf/102333412":       "VIAF",
+		"https://d-nb.info/gnd/118540238":       "GND",
+		"info:eu-repo/dai/nl/071792279":         "DAI",
+		"A-1009-2008":                           "ResearcherID",
+		"https://www.scopus.com/authid/detail.uri?authorId=7004212771": "ScopusID",
+		"jdoe": "",
+	} {
+		if scheme := identifierScheme(identifier); scheme != expected {
+			t.Errorf("%v: expected scheme %q, got %q", identifier, expected, scheme)
+		}
+	}
+}
@@ -4,52 +4,172 @@ package dataverse
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/libis/rdm-dataverse-go-api/api"
 	"integration/app/config"
 	"integration/app/core"
+	"integration/app/logging"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 )
 
 var dvContextDuration = 5 * time.Minute
 
-func IsDirectUpload() bool {
-	return directUpload == "true" && config.GetConfig().Options.DefaultDriver != ""
+func IsDirectUpload(ctx context.Context) bool {
+	return supports(ctx, featureDirectUpload) && directUploadConfigured(ctx)
 }
 
-func GetRequest(path, method, user, token string, body io.Reader, header http.Header) *api.Request {
-	client := api.NewClient(config.GetConfig().DataverseServer)
+func directUploadConfigured(ctx context.Context) bool {
+	target := config.GetTarget(ctx)
+	return target.DefaultDriver != "" || len(target.StorageDrivers) > 0 || IsSignedUrlUpload()
+}
+
+func GetRequest(ctx context.Context, path, method, user, token string, body io.Reader, header http.Header) *api.Request {
+	client := api.NewClient(config.GetTarget(ctx).DataverseServer)
 	client.User = user
-	client.Token = token
-	if urlSigning == "true" {
-		client.AdminApiKey = config.ApiKey
-		client.UnblockKey = config.UnblockKey
+	if supports(ctx, featureUrlSigning) {
+		client.AdminApiKey = config.TargetApiKey(ctx)
+		client.UnblockKey = config.TargetUnblockKey(ctx)
+	}
+	if !bearerAuth() {
+		client.Token = apiToken(token)
+	} else if t := apiToken(token); t != "" && (client.AdminApiKey == "" || client.UnblockKey == "" || user == "") {
+		// the signed URLs need no token, otherwise the library only sends the X-Dataverse-key header: the bearer token is added
+		// to the headers of the request
+		header = header.Clone()
+		if header == nil {
+			header = http.Header{}
+		}
+		header.Set("Authorization", "Bearer "+t)
 	}
 	return client.NewRequest(path, method, body, header)
 }
 
-func GetNodeMap(ctx context.Context, persistentId, token, user string) (map[string]tree.Node, error) {
+// bearerAuth tells whether Dataverse is called with the bearer tokens of its identity provider instead of the API tokens (see the
+// dataverseAuth option)
+func bearerAuth() bool {
+	return config.GetConfig().Options.DataverseAuth.Type == "bearer"
+}
+
+// apiToken returns the API key of the credential reference sent by the client (or stored in the job), other tokens are used as they are;
+// with the bearer authentication, the token is the session of the OAuth login and the (refreshed) access token of the session is returned
+func apiToken(token string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), dvContextDuration)
+	defer cancel()
+	if core.IsCredentialRef(token) {
+		res, err := core.ResolveCredential(ctx, token)
+		if err != nil {
+			// the call is made with the reference and fails as unauthorized
+			return token
+		}
+		token = res
+	}
+	if pluginId := config.GetConfig().Options.DataverseAuth.PluginId; bearerAuth() && pluginId != "" && token != "" {
+		return core.GetTokenFromCache(ctx, token, token, pluginId)
+	}
+	return token
+}
+
+// GetNodeMap lists the files of the given version (":latest" when empty, ":draft", ":latest-published" or a version number)
+func GetNodeMap(ctx context.Context, persistentId, version, token, user string) (map[string]tree.Node, error) {
+	shortContext, cancel := context.WithTimeout(ctx, dvContextDuration)
+	defer cancel()
+	if version == "" {
+		version = core.LatestVersion
+	}
+	// the files of the latest version are listed again only when the dataset changed since the snapshot,
+	// the snapshots are not used while a job is writing to the dataset (the file ids must be exact)
+	useSnapshot := version == core.LatestVersion && core.SnapshotsEnabled() && !core.IsLocked(ctx, persistentId)
+	lastUpdateTime := ""
+	if useSnapshot {
+		lastUpdateTime, _ = GetLastUpdateTime(ctx, token, user, persistentId)
+		useSnapshot = lastUpdateTime != ""
+	}
+	var mapped map[string]tree.Node
+	if useSnapshot {
+		if snapshot, ok := core.GetSnapshot(ctx, core.DatasetSnapshotKey(persistentId)); ok && snapshot.Revision == lastUpdateTime {
+			mapped = snapshot.Nodes
+		}
+	}
+	if mapped == nil {
+		path := "/api/v1/datasets/:persistentId/versions/" + version + "/files?persistentId=" + url.QueryEscape(persistentId)
+		res := api.ListResponse{}
+		req := GetRequest(ctx, path, "GET", user, token, nil, nil)
+		err := api.Do(shortContext, req, &res)
+		if err != nil {
+			return nil, err
+		}
+		if res.Status != "OK" {
+			return nil, fmt.Errorf("listing files of version %s for %s failed: %+v", version, persistentId, res)
+		}
+		mapped = mapToNodes(res.Data)
+		if useSnapshot {
+			core.StoreSnapshot(ctx, core.DatasetSnapshotKey(persistentId), lastUpdateTime, mapped)
+		}
+	}
+	//check known hashes cache
+	core.CheckKnownHashes(ctx, persistentId, mapped)
+	return mapped, nil
+}
+
+// GetLastUpdateTime returns the last update time of the latest version of the dataset
+func GetLastUpdateTime(ctx context.Context, token, user, persistentId string) (string, error) {
 	shortContext, cancel := context.WithTimeout(ctx, dvContextDuration)
 	defer cancel()
-	path := "/api/v1/datasets/:persistentId/versions/:latest/files?persistentId=" + persistentId
-	res := api.ListResponse{}
-	req := GetRequest(path, "GET", user, token, nil, nil)
+	type Data struct {
+		LastUpdateTime string `json:"lastUpdateTime"`
+	}
+	type Res struct {
+		api.DvResponse
+		Data Data `json:"data"`
+	}
+	res := Res{}
+	path := "/api/v1/datasets/:persistentId/versions/" + core.LatestVersion + "?excludeFiles=true&persistentId=" + url.QueryEscape(persistentId)
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
 	err := api.Do(shortContext, req, &res)
+	if err != nil {
+		return "", err
+	}
+	if res.Status != "OK" {
+		return "", fmt.Errorf("getting latest version of %v failed: %v", persistentId, res.Message)
+	}
+	return res.Data.LastUpdateTime, nil
+}
+
+// StorageIdentifiers returns the storage identifiers of the files of all versions of the dataset (the files removed from the draft
+// remain stored with the published versions)
+func StorageIdentifiers(ctx context.Context, token, user, persistentId string) ([]string, error) {
+	shortContext, cancel := context.WithTimeout(ctx, dvContextDuration)
+	defer cancel()
+	type Version struct {
+		Files []api.MetaData `json:"files"`
+	}
+	type Res struct {
+		api.DvResponse
+		Data []Version `json:"data"`
+	}
+	res := Res{}
+	path := "/api/v1/datasets/:persistentId/versions?persistentId=" + persistentId
+	err := api.Do(shortContext, GetRequest(ctx, path, "GET", user, token, nil, nil), &res)
 	if err != nil {
 		return nil, err
 	}
 	if res.Status != "OK" {
-		return nil, fmt.Errorf("listing files for %s failed: %+v", persistentId, res)
+		return nil, fmt.Errorf("listing versions of %v failed: %v", persistentId, res.Message)
 	}
-	mapped := mapToNodes(res.Data)
-	//check known hashes cache
-	core.CheckKnownHashes(ctx, persistentId, mapped)
-	return mapped, nil
+	ids := []string{}
+	for _, v := range res.Data {
+		for _, f := range v.Files {
+			ids = append(ids, f.DataFile.StorageIdentifier)
+		}
+	}
+	return ids, nil
 }
 
 func mapToNodes(data []api.MetaData) map[string]tree.Node {
@@ -64,7 +184,7 @@ func mapToNodes(data []api.MetaData) map[string]tree.Node {
 		hashType := types.Md5
 		if hash == "" {
 			hash = d.DataFile.Checksum.Value
-			hashType = d.DataFile.Checksum.Type
+			hashType = types.NormalizeHashType(d.DataFile.Checksum.Type)
 		}
 		res[id] = tree.Node{
 			Id:   id,
@@ -85,14 +205,68 @@ func mapToNodes(data []api.MetaData) map[string]tree.Node {
 	return res
 }
 
+// GetStorageDriver returns the id of the storage driver used by the dataset (it can be configured per collection in Dataverse)
+func GetStorageDriver(ctx context.Context, token, user, persistentId string) (string, error) {
+	type Data struct {
+		Message string `json:"message"` // older versions return only the driver id as message
+		Name    string `json:"name"`
+	}
+	type Res struct {
+		api.DvResponse
+		Data Data `json:"data"`
+	}
+	res := Res{}
+	req := GetRequest(ctx, "/api/v1/datasets/:persistentId/storageDriver?persistentId="+persistentId, "GET", user, token, nil, nil)
+	err := api.Do(ctx, req, &res)
+	if err != nil {
+		return "", err
+	}
+	if res.Status != "OK" {
+		return "", fmt.Errorf("getting storage driver of %v failed: %v", persistentId, res.Message)
+	}
+	if res.Data.Name != "" {
+		return res.Data.Name, nil
+	}
+	return res.Data.Message, nil
+}
+
 func CheckPermission(ctx context.Context, token, user, persistentId string) error {
+	err := checkPermission(ctx, token, user, persistentId)
+	if errors.Is(err, errUnblockKeyRejected) && config.RefreshSecret(ctx, config.SecretUnblockKey) {
+		return checkPermission(ctx, token, user, persistentId)
+	}
+	return err
+}
+
+// errUnblockKeyRejected is returned when the admin API is blocked for the unblock key, e.g., after the key has been rotated
+var errUnblockKeyRejected = errors.New("unblock key rejected")
+
+// permissionCheck returns how the permissions are checked (see the permissionCheck option): with the admin API when the unblock
+// key is configured, with the native API of the dataset otherwise
+func permissionCheck(ctx context.Context) string {
+	if p := config.GetConfig().Options.PermissionCheck; p != "" {
+		return p
+	}
+	if config.TargetUnblockKey(ctx) == "" {
+		return "native"
+	}
+	return "admin"
+}
+
+func checkPermission(ctx context.Context, token, user, persistentId string) error {
+	switch permissionCheck(ctx) {
+	case "none":
+		return nil
+	case "native":
+		return checkUserPermissions(ctx, token, user, persistentId)
+	}
 	shortContext, cancel := context.WithTimeout(ctx, dvContextDuration)
 	defer cancel()
-	if config.UnblockKey == "" {
-		return nil
+	if config.TargetUnblockKey(ctx) == "" {
+		return fmt.Errorf("the permissions can not be checked with the admin API: no unblock key configured")
 	}
-	path := fmt.Sprintf("/api/v1/admin/permissions/:persistentId?persistentId=%s&unblock-key=%s", persistentId, config.UnblockKey)
-	if slashInPermissions != "true" {
+	path := fmt.Sprintf("/api/v1/admin/permissions/:persistentId?persistentId=%s&unblock-key=%s", persistentId, config.TargetUnblockKey(ctx))
+	if !supports(ctx, featureSlashInPermissions) {
 		var err error
 		path, err = noSlashPermissionUrl(shortContext, persistentId, token, user)
 		if err != nil {
@@ -100,12 +274,15 @@ func CheckPermission(ctx context.Context, token, user, persistentId string) erro
 		}
 	}
 	res := api.Permissions{}
-	req := GetRequest(path, "GET", user, token, nil, nil)
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
 	err := api.Do(shortContext, req, &res)
 	if err != nil {
 		return err
 	}
 	if res.Status != "OK" {
+		if strings.Contains(strings.ToLower(res.Message), "block") {
+			return fmt.Errorf("%w: %v", errUnblockKeyRejected, res.Message)
+		}
 		return fmt.Errorf("permission check status is %s for dataset %s", res.Status, persistentId)
 	}
 	for _, v := range res.Data.Permissions {
@@ -113,7 +290,39 @@ func CheckPermission(ctx context.Context, token, user, persistentId string) erro
 			return nil
 		}
 	}
-	return fmt.Errorf("user %v has no permission to edit dataset %v", res.Data.User, persistentId)
+	return fmt.Errorf("%w: user %v has no permission to edit dataset %v", core.ErrPermissionDenied, res.Data.User, persistentId)
+}
+
+// userPermissions is the response of the userPermissions API of the datasets
+type userPermissions struct {
+	api.DvResponse
+	Data struct {
+		CanEditDataset bool `json:"canEditDataset"`
+	} `json:"data"`
+}
+
+// checkUserPermissions checks the permissions with the native API, as the user of the token (no unblock key needed); the
+// installations without that API are not checked, as without the unblock key before
+func checkUserPermissions(ctx context.Context, token, user, persistentId string) error {
+	shortContext, cancel := context.WithTimeout(ctx, dvContextDuration)
+	defer cancel()
+	res := userPermissions{}
+	req := GetRequest(ctx, "/api/v1/datasets/:persistentId/userPermissions?persistentId="+url.QueryEscape(persistentId), "GET", user, token, nil, nil)
+	err := api.Do(shortContext, req, &res)
+	if err != nil {
+		return err
+	}
+	if res.Status != "OK" {
+		if strings.Contains(res.Message, "endpoint does not exist") {
+			logging.Logger.DebugContext(ctx, "userPermissions API not available, permissions not checked", "persistentId", persistentId)
+			return nil
+		}
+		return fmt.Errorf("permission check status is %s for dataset %s: %v", res.Status, persistentId, res.Message)
+	}
+	if !res.Data.CanEditDataset {
+		return fmt.Errorf("%w: no permission to edit dataset %v", core.ErrPermissionDenied, persistentId)
+	}
+	return nil
 }
 
 func noSlashPermissionUrl(ctx context.Context, persistentId, token, user string) (string, error) {
@@ -127,7 +336,7 @@ func noSlashPermissionUrl(ctx context.Context, persistentId, token, user string)
 	}
 	path := "/api/v1/datasets/:persistentId?persistentId=" + persistentId
 	res := Res{}
-	req := GetRequest(path, "GET", user, token, nil, nil)
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
 	err := api.Do(shortContext, req, &res)
 	if err != nil {
 		return "", err
@@ -136,29 +345,26 @@ func noSlashPermissionUrl(ctx context.Context, persistentId, token, user string)
 	if id == 0 {
 		return "", fmt.Errorf("dataset %v not found", persistentId)
 	}
-	return fmt.Sprintf("/api/v1/admin/permissions/%v?&unblock-key=%s", id, config.UnblockKey), nil
+	return fmt.Sprintf("/api/v1/admin/permissions/%v?&unblock-key=%s", id, config.TargetUnblockKey(ctx)), nil
 }
 
-func GetDatasetUrl(pid string, draft bool) string {
+func GetDatasetUrl(ctx context.Context, pid string, draft bool) string {
 	draftVersion := "version=DRAFT&"
 	if !draft {
 		draftVersion = ""
 	}
-	url := config.GetConfig().DataverseServer
-	if config.GetConfig().Options.DataverseExternalUrl != "" {
-		url = config.GetConfig().Options.DataverseExternalUrl
-	}
-	return fmt.Sprintf("%v/dataset.xhtml?%vpersistentId=%v", url, draftVersion, pid)
+	return fmt.Sprintf("%v/dataset.xhtml?%vpersistentId=%v", config.TargetExternalUrl(ctx), draftVersion, pid)
 }
 
+// DownloadFile downloads the file as uploaded: the original of an ingested tabular file, whose checksum is the one recorded in Dataverse
 func DownloadFile(ctx context.Context, token, user string, id int64) (io.ReadCloser, error) {
-	path := fmt.Sprintf("/api/v1/access/datafile/%v", id)
-	req := GetRequest(path, "GET", user, token, nil, nil)
+	path := fmt.Sprintf("/api/v1/access/datafile/%v?format=original", id)
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
 	return api.DoStream(ctx, req)
 }
 
 func DvObjects(ctx context.Context, objectType, collection, searchTerm, token, user string) ([]types.SelectItem, error) {
-	dvObjects, err := listDvObjects(ctx, objectType, collection, searchTerm, token, user)
+	dvObjects, err := listDvObjects(ctx, objectType, collection, searchTerm, token, user, config.GetConfig().Options.MyDataRoleIds)
 	if err != nil {
 		return nil, err
 	}
@@ -181,35 +387,12 @@ func DvObjects(ctx context.Context, objectType, collection, searchTerm, token, u
 	return res, nil
 }
 
-func listDvObjects(ctx context.Context, objectType, collection, searchTermFirstPart, token, user string) ([]api.Item, error) {
-	searchTerm := ""
-	if searchTermFirstPart != "" {
-		searchTerm = "text:\"" + searchTermFirstPart + "\""
-		if collection != "" {
-			searchTerm = " identifierOfDataverse:(+" + collection + ")"
-		}
-	} else if collection != "" {
-		searchTerm = "identifierOfDataverse:(+" + collection + ")"
-	}
-	searchTerm = url.QueryEscape(searchTerm)
+func listDvObjects(ctx context.Context, objectType, collection, searchTerm, token, user string, roleIds []int) ([]api.Item, error) {
 	res := []api.Item{}
 	hasNextPage := true
-	roleIds := ""
-	for _, v := range config.GetConfig().Options.MyDataRoleIds {
-		roleIds = fmt.Sprintf("%v%v%v", roleIds, "&role_ids=", v)
-	}
 	for page := 1; hasNextPage; page++ {
-		path := "/api/v1/mydata/retrieve?" +
-			"selected_page=" + fmt.Sprint(page) +
-			"&dvobject_types=" + objectType +
-			"&published_states=Published&published_states=Unpublished&published_states=Draft" +
-			roleIds + "&mydata_search_term=" + searchTerm
-		if urlSigning != "true" {
-			path = path + "&key=" + token
-		}
-
 		retrieveResponse := api.RetrieveResponse{}
-		req := GetRequest(path, "GET", user, token, nil, nil)
+		req := GetRequest(ctx, myDataPath(ctx, objectType, collection, searchTerm, token, roleIds, page), "GET", user, token, nil, nil)
 		err := api.Do(ctx, req, &retrieveResponse)
 		if err != nil {
 			return nil, err
@@ -224,13 +407,48 @@ func listDvObjects(ctx context.Context, objectType, collection, searchTermFirstP
 	return res, nil
 }
 
+// myDataPath is the path of the page of the "retrieve" my data call, listing the objects where the user has one of the roles
+// (any role when no role ids are given)
+func myDataPath(ctx context.Context, objectType, collection, searchTerm, token string, roleIds []int, page int) string {
+	terms := []string{}
+	if searchTerm != "" {
+		terms = append(terms, "text:\""+searchTerm+"\"")
+	}
+	if collection != "" {
+		terms = append(terms, "identifierOfDataverse:(+"+collection+")")
+	}
+	path := "/api/v1/mydata/retrieve?" +
+		"selected_page=" + fmt.Sprint(page) +
+		"&dvobject_types=" + objectType +
+		"&published_states=Published&published_states=Unpublished&published_states=Draft" +
+		"&mydata_search_term=" + url.QueryEscape(strings.Join(terms, " AND "))
+	for _, v := range roleIds {
+		path = fmt.Sprintf("%v&role_ids=%v", path, v)
+	}
+	if !supports(ctx, featureUrlSigning) && !bearerAuth() {
+		path = path + "&key=" + url.QueryEscape(apiToken(token))
+	}
+	return path
+}
+
 func GetUser(ctx context.Context, token, user string) (res api.User, err error) {
 	path := "/api/v1/users/:me"
-	req := GetRequest(path, "GET", user, token, nil, nil)
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
 	err = api.Do(ctx, req, &res)
+	if err == nil && res.Status != "OK" {
+		err = fmt.Errorf("%w: the user could not be retrieved (e.g., invalid API key)", core.ErrPermissionDenied)
+	}
 	return res, err
 }
 
+func IsSuperuser(ctx context.Context, token, user string) (bool, error) {
+	u, err := GetUser(ctx, token, user)
+	if err != nil {
+		return false, err
+	}
+	return u.Data.Superuser, nil
+}
+
 func GetUserEmail(ctx context.Context, token, user string) (string, error) {
 	u, err := GetUser(ctx, token, user)
 	if err != nil {
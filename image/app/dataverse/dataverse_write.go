@@ -3,6 +3,7 @@
 package dataverse
 
 import (
+	"archive/zip"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -10,15 +11,16 @@ import (
 	"github.com/libis/rdm-dataverse-go-api/api"
 	"integration/app/config"
 	"integration/app/core"
+	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"strings"
-	"sync"
 )
 
-func CreateNewDataset(ctx context.Context, collection, token, userName string) (string, error) {
+func CreateNewDataset(ctx context.Context, collection, token, userName string, metadata core.DatasetMetadata) (string, error) {
 	if collection == "" {
 		collection = config.GetConfig().Options.RootDataverseId
 	}
@@ -29,15 +31,36 @@ func CreateNewDataset(ctx context.Context, collection, token, userName string) (
 	if err != nil {
 		return "", err
 	}
-	body := api.CreateDatasetRequestBody(user)
+	err = validateMetadata(ctx, collection, token, userName, metadata)
+	if err != nil {
+		return "", err
+	}
+	body, err := createDatasetRequestBody(user, metadata)
+	if err != nil {
+		return "", err
+	}
 	res := api.CreateNewDatasetResponse{}
-	path := "/api/v1/dataverses/" + collection + "/datasets?doNotValidate=true"
-	req := GetRequest(path, "POST", userName, token, body, api.JsonContentHeader())
+	path := "/api/v1/dataverses/" + url.PathEscape(collection) + "/datasets"
+	if metadata.Title == "" || metadata.Description == "" || len(metadata.Subjects) == 0 {
+		// the dataset is created as a draft with incomplete metadata, the user completes it later in Dataverse
+		path = path + "?doNotValidate=true"
+	}
+	req := GetRequest(ctx, path, "POST", userName, token, body, api.JsonContentHeader())
 	err = api.Do(ctx, req, &res)
 	return res.Data.PersistentId, err
 }
 
 func SaveAfterDirectUpload(ctx context.Context, replace bool, token, user, persistentId string, storageIdentifiers []string, nodes []tree.Node) error {
+	if replace && config.GetConfig().Options.DeleteAndAddOnReplace {
+		for i, v := range nodes {
+			err := DeleteFile(ctx, token, user, v.Attributes.DestinationFile.Id)
+			if err != nil {
+				return err
+			}
+			nodes[i].Attributes.DestinationFile.Id = 0
+		}
+		replace = false
+	}
 	jsonData := []api.JsonData{}
 	for i, v := range nodes {
 		jsonData = append(jsonData, api.JsonData{
@@ -46,10 +69,11 @@ func SaveAfterDirectUpload(ctx context.Context, replace bool, token, user, persi
 			StorageIdentifier: storageIdentifiers[i],
 			FileName:          v.Name,
 			DirectoryLabel:    v.Path,
+			Description:       v.Description(),
 			MimeType:          "application/octet-stream", // default that will be replaced by Dataverse while adding/replacing the file
 			TabIngest:         false,
 			Checksum: &api.Checksum{
-				Type:  v.Attributes.DestinationFile.HashType,
+				Type:  types.DataverseHashType(v.Attributes.DestinationFile.HashType),
 				Value: v.Attributes.DestinationFile.Hash,
 			},
 		})
@@ -67,7 +91,7 @@ func SaveAfterDirectUpload(ctx context.Context, replace bool, token, user, persi
 	res := api.AddReplaceFileResponse{}
 	reqHeader := http.Header{}
 	reqHeader.Add("Content-Type", formDataContentType)
-	req := GetRequest(path, "POST", user, token, body, reqHeader)
+	req := GetRequest(ctx, path, "POST", user, token, body, reqHeader)
 	err = api.Do(ctx, req, &res)
 	if err != nil {
 		return err
@@ -76,7 +100,17 @@ func SaveAfterDirectUpload(ctx context.Context, replace bool, token, user, persi
 	if res.Status != "OK" {
 		return fmt.Errorf("writting file failed: %+v", res)
 	}
-	return nil
+	streamed := []streamedFile{}
+	for i, v := range nodes {
+		streamed = append(streamed, streamedFile{
+			nodeId:            v.Id,
+			storageIdentifier: storageIdentifiers[i],
+			hashType:          v.Attributes.DestinationFile.HashType,
+			hash:              v.Attributes.DestinationFile.Hash,
+			size:              v.Attributes.DestinationFile.Filesize,
+		})
+	}
+	return verifyRegistered(ctx, persistentId, streamed, res.Data.Files)
 }
 
 func requestBody(data []byte) (io.Reader, string) {
@@ -88,8 +122,9 @@ func requestBody(data []byte) (io.Reader, string) {
 	return body, writer.FormDataContentType()
 }
 
-func ApiAddReplaceFile(ctx context.Context, dbId int64, id, token, user, persistentId string, wg *sync.WaitGroup, async_err *core.ErrorHolder) (io.WriteCloser, error) {
-	if strings.HasSuffix(id, ".zip") {
+func ApiAddReplaceFile(ctx context.Context, dbId int64, id, description, token, user, persistentId string, group *core.ErrGroup) (io.WriteCloser, error) {
+	zipped := strings.HasSuffix(id, ".zip")
+	if zipped && (dbId == 0 || config.GetConfig().Options.DeleteAndAddOnReplace) {
 		// workaround: upload via SWORD api
 		if dbId != 0 {
 			err := DeleteFile(ctx, token, user, dbId)
@@ -97,49 +132,84 @@ func ApiAddReplaceFile(ctx context.Context, dbId int64, id, token, user, persist
 				return nil, err
 			}
 		}
-		return uploadViaSword(ctx, dbId, id, token, user, persistentId, wg, async_err)
+		return uploadViaSword(ctx, dbId, id, token, user, persistentId, group)
 	}
 
+	if dbId != 0 && config.GetConfig().Options.DeleteAndAddOnReplace {
+		err := DeleteFile(ctx, token, user, dbId)
+		if err != nil {
+			return nil, err
+		}
+		dbId = 0
+	}
+
+	// changed files are replaced with the native API: the DataFile id lineage and the file version history are preserved
 	path := "/api/v1/datasets/:persistentId/add?persistentId=" + persistentId
 	if dbId != 0 {
-		path = config.GetConfig().DataverseServer + "/api/v1/files/" + fmt.Sprint(dbId) + "/replace"
+		path = config.GetTarget(ctx).DataverseServer + "/api/v1/files/" + fmt.Sprint(dbId) + "/replace"
 	}
 
 	filename, dir := splitId(id)
 	jsonData := api.JsonData{
 		DirectoryLabel: dir,
 		ForceReplace:   dbId != 0,
+		Description:    description,
 	}
 	jsonDataBytes, _ := json.Marshal(jsonData)
 	pr, pw := io.Pipe()
 	writer := multipart.NewWriter(pw)
 	fw := core.NewFileWriter(filename, jsonDataBytes, writer)
+	sw := newStreamingWriter(fw, fw)
+	if zipped {
+		// Dataverse unpacks the uploaded zip files: the archive is double-zipped, so that it replaces the file as it is
+		zipWriter := zip.NewWriter(fw)
+		entry, err := zipWriter.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		sw = newStreamingWriter(entry, zipCloser{zipWriter, fw})
+	}
 
 	requestHeader := http.Header{}
 	requestHeader.Add("Content-Type", writer.FormDataContentType())
 
-	request := GetRequest(path, "POST", user, token, pr, requestHeader)
+	request := GetRequest(ctx, path, "POST", user, token, pr, requestHeader)
 
-	wg.Add(1)
-	go func(req *api.Request) {
-		defer wg.Done()
-		defer pr.Close()
+	group.Go(func() error {
 		res := api.AddReplaceFileResponse{}
 		err := api.Do(ctx, request, &res)
 		if err != nil {
-			if async_err != nil {
-				async_err.Err = fmt.Errorf("writing file in %s failed: %s", persistentId, err)
+			err = fmt.Errorf("writing file in %s failed: %w", persistentId, err)
+		} else if res.Status != "OK" {
+			err = fmt.Errorf("adding or replacing file failed: %+v", res)
+		} else {
+			var streamed streamedFile
+			streamed, err = sw.streamed(ctx, id)
+			if err == nil {
+				err = verifyRegistered(ctx, persistentId, []streamedFile{streamed}, res.Data.Files)
 			}
-			return
 		}
-		if res.Status != "OK" {
-			if async_err != nil {
-				async_err.Err = fmt.Errorf("adding file failed: %+v", res)
-			}
+		if err != nil {
+			pr.CloseWithError(err)
+			return err
 		}
-	}(request)
+		return pr.Close()
+	})
+
+	return core.NewWritterCloser(sw, sw, pw), nil
+}
+
+// zipCloser finishes the zip before closing the file it is written to
+type zipCloser struct {
+	zipWriter *zip.Writer
+	closer    io.Closer
+}
 
-	return core.NewWritterCloser(fw, fw, pw), nil
+func (z zipCloser) Close() error {
+	if err := z.zipWriter.Close(); err != nil {
+		return err
+	}
+	return z.closer.Close()
 }
 
 func splitId(id string) (string, string) {
@@ -152,30 +222,52 @@ func splitId(id string) (string, string) {
 	return filename, dir
 }
 
-func CleanupLeftOverFiles(ctx context.Context, persistentId, token, user string) error {
-	if filesCleanup != "true" {
-		return nil
+// CleanupLeftOverFiles removes the files of the dataset folder that are not registered in Dataverse (the cleanStorage API), with
+// dryRun the files are only listed; it returns the names of the (to be) removed files
+func CleanupLeftOverFiles(ctx context.Context, persistentId, token, user string, dryRun bool) ([]string, error) {
+	if err := requireFeature(ctx, featureFilesCleanup); err != nil {
+		return nil, err
+	}
+	path := config.GetTarget(ctx).DataverseServer + "/api/v1/datasets/:persistentId/cleanStorage?persistentId=" + persistentId
+	if dryRun {
+		path += "&dryrun=true"
 	}
-	path := config.GetConfig().DataverseServer + "/api/v1/datasets/:persistentId/cleanStorage?persistentId=" + persistentId
 	res := api.CleanupResponse{}
-	req := GetRequest(path, "GET", user, token, nil, nil)
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
 	err := api.Do(ctx, req, &res)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if res.Status != "OK" {
-		return fmt.Errorf("cleaning up files for %s failed: %+v", persistentId, res)
+		return nil, fmt.Errorf("cleaning up files for %s failed: %+v", persistentId, res)
 	}
-	return nil
+	return cleanedFiles(res.Data.Message), nil
+}
+
+// cleanedFiles parses the message of cleanStorage: "Found: <registered files>\nDeleted: <removed files>", comma separated
+func cleanedFiles(message string) []string {
+	res := []string{}
+	for _, line := range strings.Split(message, "\n") {
+		deleted, ok := strings.CutPrefix(strings.TrimSpace(line), "Deleted:")
+		if !ok {
+			continue
+		}
+		for _, name := range strings.Split(deleted, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				res = append(res, name)
+			}
+		}
+	}
+	return res
 }
 
 func DeleteFile(ctx context.Context, token, user string, id int64) error {
-	if nativeApiDelete != "true" {
+	if !supports(ctx, featureNativeApiDelete) {
 		return swordDelete(ctx, token, user, id)
 	}
 	path := "/api/v1/files/" + fmt.Sprint(id)
 	res := api.DvResponse{}
-	req := GetRequest(path, "DELETE", user, token, nil, nil)
+	req := GetRequest(ctx, path, "DELETE", user, token, nil, nil)
 	err := api.Do(ctx, req, &res)
 	if err != nil {
 		return err
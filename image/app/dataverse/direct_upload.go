@@ -0,0 +1,165 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+type uploadUrlsResponse struct {
+	api.DvResponse
+	Data uploadUrls `json:"data"`
+}
+
+type uploadUrls struct {
+	Url               string            `json:"url"`  // single-part upload
+	Urls              map[string]string `json:"urls"` // multipart upload: part number -> URL
+	Abort             string            `json:"abort"`
+	Complete          string            `json:"complete"`
+	PartSize          int64             `json:"partSize"`
+	StorageIdentifier string            `json:"storageIdentifier"`
+}
+
+func IsSignedUrlUpload() bool {
+	return config.GetConfig().Options.SignedUrlUpload
+}
+
+// UploadToSignedUrls streams the file to the storage of the dataset using the direct upload URLs signed by Dataverse
+// (no bucket credentials are needed), the returned storage identifier is used when registering the file in the dataset
+func UploadToSignedUrls(ctx context.Context, token, user, persistentId string, size int64, reader io.Reader) (string, error) {
+	path := fmt.Sprintf("/api/v1/datasets/:persistentId/uploadurls?persistentId=%s&size=%d", persistentId, size)
+	res := uploadUrlsResponse{}
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
+	err := api.Do(ctx, req, &res)
+	if err != nil {
+		return "", err
+	}
+	if res.Status != "OK" {
+		return "", fmt.Errorf("getting upload urls for %s failed: %+v", persistentId, res.DvResponse)
+	}
+	if res.Data.Url != "" {
+		// the tag marks the object as not yet registered in the dataset (only the single-part upload accepts it)
+		_, err = putPart(ctx, res.Data.Url, size, reader, "dv-state=temp")
+		if err == nil {
+			err = checkExhausted(reader, size)
+		}
+		return res.Data.StorageIdentifier, err
+	}
+	err = multipartUpload(ctx, token, user, size, reader, res.Data)
+	if err != nil {
+		abortReq := GetRequest(ctx, res.Data.Abort, "DELETE", user, token, nil, nil)
+		if stream, abortErr := api.DoStream(ctx, abortReq); abortErr == nil {
+			stream.Close()
+		}
+		return "", err
+	}
+	return res.Data.StorageIdentifier, nil
+}
+
+func multipartUpload(ctx context.Context, token, user string, size int64, reader io.Reader, urls uploadUrls) error {
+	if urls.PartSize <= 0 {
+		return fmt.Errorf("multipart upload: invalid part size %d", urls.PartSize)
+	}
+	eTags := map[string]string{}
+	remaining := size
+	// an empty file is uploaded as a single empty part: completing a multipart upload needs at least one part
+	for i := 1; remaining > 0 || i == 1; i++ {
+		partUrl, ok := urls.Urls[strconv.Itoa(i)]
+		if !ok {
+			return fmt.Errorf("multipart upload: missing url for part %d", i)
+		}
+		partSize := urls.PartSize
+		if remaining < partSize {
+			partSize = remaining
+		}
+		eTag, err := putPart(ctx, partUrl, partSize, reader, "")
+		if err != nil {
+			return err
+		}
+		eTags[strconv.Itoa(i)] = eTag
+		remaining -= partSize
+	}
+	if err := checkExhausted(reader, size); err != nil {
+		return err
+	}
+	b, err := json.Marshal(eTags)
+	if err != nil {
+		return err
+	}
+	res := api.DvResponse{}
+	req := GetRequest(ctx, urls.Complete, "PUT", user, token, bytes.NewReader(b), api.JsonContentHeader())
+	err = api.Do(ctx, req, &res)
+	if err != nil {
+		return err
+	}
+	if res.Status != "OK" {
+		return fmt.Errorf("completing multipart upload failed: %v", res.Message)
+	}
+	return nil
+}
+
+// putPart streams exactly size bytes from the reader, so that the memory usage stays bounded for large files; the tagging is only
+// sent when not empty
+func putPart(ctx context.Context, url string, size int64, reader io.Reader, tagging string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, "PUT", url, &exactReader{reader, size})
+	if err != nil {
+		return "", err
+	}
+	request.ContentLength = size
+	if size == 0 {
+		request.Body = http.NoBody
+	}
+	if tagging != "" {
+		request.Header.Add("x-amz-tagging", tagging)
+	}
+	r, err := httpclient.Get("dataverse").Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		b, _ := io.ReadAll(r.Body)
+		return "", fmt.Errorf("uploading to signed url failed: %d - %s", r.StatusCode, string(b))
+	}
+	return strings.Trim(r.Header.Get("ETag"), "\""), nil
+}
+
+// exactReader reads the next size bytes of the stream, and fails when the stream ends before (a file changed while it was read)
+type exactReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.remaining {
+		p = p[:e.remaining]
+	}
+	n, err := e.reader.Read(p)
+	e.remaining -= int64(n)
+	if err == io.EOF && e.remaining > 0 {
+		return n, fmt.Errorf("the file is %d bytes shorter than its size: %w", e.remaining, io.ErrUnexpectedEOF)
+	}
+	return n, err
+}
+
+// checkExhausted fails when the stream has more bytes than the uploaded size, the upload is then incomplete
+func checkExhausted(reader io.Reader, size int64) error {
+	if n, _ := io.ReadFull(reader, make([]byte, 1)); n > 0 {
+		return fmt.Errorf("the file is longer than its size of %d bytes", size)
+	}
+	return nil
+}
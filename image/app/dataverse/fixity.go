@@ -0,0 +1,63 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// getFixityChecksumAlgorithm reads the :FileFixityChecksumAlgorithm setting, the admin API needs the unblock key when it is blocked for remote calls
+func getFixityChecksumAlgorithm() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), dvContextDuration)
+	defer cancel()
+	u := fmt.Sprintf("%s/api/v1/admin/settings/:FileFixityChecksumAlgorithm", config.GetConfig().DataverseServer)
+	if config.UnblockKey() != "" {
+		u = u + "?unblock-key=" + url.QueryEscape(config.UnblockKey())
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return "", err
+	}
+	r, err := httpclient.Get("dataverse").Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	b, _ := io.ReadAll(r.Body)
+	res := struct {
+		Status string `json:"status"`
+		Data   struct {
+			Message string `json:"message"`
+		} `json:"data"`
+	}{}
+	json.Unmarshal(b, &res)
+	if r.StatusCode == http.StatusNotFound {
+		return types.Md5, nil // setting not set: Dataverse defaults to MD5
+	}
+	if r.StatusCode != http.StatusOK || res.Status != "OK" {
+		return "", fmt.Errorf("%d - %s", r.StatusCode, string(b))
+	}
+	return types.NormalizeHashType(res.Data.Message), nil
+}
+
+func initDefaultHash() {
+	if config.DefaultHashConfigured() {
+		return
+	}
+	hashType, err := getFixityChecksumAlgorithm()
+	if err != nil {
+		logging.Logger.Warn("error when getting the fixity checksum algorithm, using default hash", "hash", config.GetConfig().Options.DefaultHash, "error", err)
+		return
+	}
+	logging.Logger.Info("fixity checksum algorithm of Dataverse", "hash", hashType)
+	config.SetDefaultHash(hashType)
+}
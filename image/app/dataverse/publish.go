@@ -0,0 +1,71 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"context"
+	"fmt"
+	"integration/app/logging"
+	"time"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+var lockPollInterval = 5 * time.Second
+
+type locksResponse struct {
+	api.DvResponse
+	Data []lock `json:"data"`
+}
+
+type lock struct {
+	LockType string `json:"lockType"`
+	Date     string `json:"date"`
+	User     string `json:"user"`
+}
+
+func PublishDataset(ctx context.Context, token, user, persistentId, versionType string) error {
+	if versionType != "major" && versionType != "minor" {
+		return fmt.Errorf("unsupported version type for publishing: %v", versionType)
+	}
+	err := waitForUnlock(ctx, token, user, persistentId)
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/api/v1/datasets/:persistentId/actions/:publish?persistentId=%s&type=%s", persistentId, versionType)
+	res := api.DvResponse{}
+	req := GetRequest(ctx, path, "POST", user, token, nil, nil)
+	err = api.Do(ctx, req, &res)
+	if err != nil {
+		return err
+	}
+	if res.Status != "OK" {
+		return fmt.Errorf("publishing dataset %s failed: %s", persistentId, res.Message)
+	}
+	// publishing is finalized asynchronously (e.g., when registering file PIDs or running workflows)
+	return waitForUnlock(ctx, token, user, persistentId)
+}
+
+func waitForUnlock(ctx context.Context, token, user, persistentId string) error {
+	path := "/api/v1/datasets/:persistentId/locks?persistentId=" + persistentId
+	for {
+		res := locksResponse{}
+		req := GetRequest(ctx, path, "GET", user, token, nil, nil)
+		err := api.Do(ctx, req, &res)
+		if err != nil {
+			return err
+		}
+		if res.Status != "OK" {
+			return fmt.Errorf("getting locks of dataset %s failed: %s", persistentId, res.Message)
+		}
+		if len(res.Data) == 0 {
+			return nil
+		}
+		logging.Logger.InfoContext(ctx, "waiting for lock to be released", "persistentId", persistentId, "lockType", res.Data[0].LockType)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("dataset %s is still locked (%v): %v", persistentId, res.Data[0].LockType, ctx.Err())
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
@@ -0,0 +1,169 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/core"
+	"integration/app/logging"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+// the storage quota APIs return the values in a message, e.g., "... 1,024 bytes"
+var bytesR = regexp.MustCompile(`([0-9][0-9,]*) bytes`)
+
+type messageResponse struct {
+	api.DvResponse
+	Data struct {
+		Message string `json:"message"`
+	} `json:"data"`
+}
+
+type owner struct {
+	Type       string `json:"type"`
+	Identifier string `json:"identifier"`
+}
+
+type datasetOwnersResponse struct {
+	api.DvResponse
+	Data struct {
+		IsPartOf owner `json:"isPartOf"`
+	} `json:"data"`
+}
+
+type collectionResponse struct {
+	api.DvResponse
+	Data struct {
+		Alias             string `json:"alias"`
+		DataverseContacts []struct {
+			ContactEmail string `json:"contactEmail"`
+		} `json:"dataverseContacts"`
+	} `json:"data"`
+}
+
+// GetCollectionUsage returns the storage quota and usage of the collection owning the dataset,
+// the quota is 0 when the installation does not support quotas or no quota is set
+func GetCollectionUsage(ctx context.Context, token, user, persistentId string) (core.CollectionUsage, error) {
+	res := core.CollectionUsage{}
+	owners := datasetOwnersResponse{}
+	req := GetRequest(ctx, "/api/v1/datasets/:persistentId?returnOwners=true&persistentId="+persistentId, "GET", user, token, nil, nil)
+	err := api.Do(ctx, req, &owners)
+	if err != nil {
+		return res, err
+	}
+	if owners.Status != "OK" || owners.Data.IsPartOf.Identifier == "" {
+		return res, fmt.Errorf("getting the collection of %v failed: %v", persistentId, owners.Message)
+	}
+	res.Collection = owners.Data.IsPartOf.Identifier
+
+	collection := collectionResponse{}
+	req = GetRequest(ctx, "/api/v1/dataverses/"+res.Collection, "GET", user, token, nil, nil)
+	err = api.Do(ctx, req, &collection)
+	if err != nil {
+		return res, err
+	}
+	for _, c := range collection.Data.DataverseContacts {
+		if c.ContactEmail != "" {
+			res.Contacts = append(res.Contacts, c.ContactEmail)
+		}
+	}
+
+	if supports(ctx, featureCollectionQuotas) {
+		res.Quota, _ = getBytes(ctx, "/api/v1/dataverses/"+res.Collection+"/storage/quota", token, user)
+	}
+	used, ok := getBytes(ctx, "/api/v1/dataverses/"+res.Collection+"/storage/use", token, user)
+	if !ok {
+		used, ok = getBytes(ctx, "/api/v1/dataverses/"+res.Collection+"/storagesize", token, user)
+	}
+	if !ok {
+		return res, fmt.Errorf("getting the storage usage of collection %v failed", res.Collection)
+	}
+	res.Used = used
+	return res, nil
+}
+
+func getBytes(ctx context.Context, path, token, user string) (int64, bool) {
+	res := messageResponse{}
+	req := GetRequest(ctx, path, "GET", user, token, nil, nil)
+	err := api.Do(ctx, req, &res)
+	if err != nil || res.Status != "OK" {
+		return 0, false
+	}
+	match := bytesR.FindStringSubmatch(res.Data.Message)
+	if len(match) < 2 {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(strings.ReplaceAll(match[1], ",", ""), 10, 64)
+	return n, err == nil
+}
+
+type uploadLimitResponse struct {
+	api.DvResponse
+	Data struct {
+		UploadLimit struct {
+			StorageQuotaRemaining *int64 `json:"storageQuotaRemaining"`
+		} `json:"uploadLimit"`
+	} `json:"data"`
+}
+
+// GetStorageLimits returns the limits of Dataverse on the files written to the dataset: the :MaxFileUploadSizeInBytes setting
+// for the storage of the dataset, and the remaining storage quota of the dataset (Dataverse 6.3 or later) or of its collection
+func GetStorageLimits(ctx context.Context, token, user, persistentId string) (core.StorageLimits, error) {
+	res := core.StorageLimits{}
+	driver, err := GetStorageDriver(ctx, token, user, persistentId)
+	if err != nil {
+		return res, err
+	}
+	res.StorageDriver, res.MaxFileSize = driver, getMaxUploadSize(ctx, token, user, driver)
+
+	if supports(ctx, featureUploadLimit) {
+		limit := uploadLimitResponse{}
+		req := GetRequest(ctx, "/api/v1/datasets/:persistentId/uploadlimit?persistentId="+persistentId, "GET", user, token, nil, nil)
+		if api.Do(ctx, req, &limit) == nil && limit.Status == "OK" {
+			if remaining := limit.Data.UploadLimit.StorageQuotaRemaining; remaining != nil {
+				res.HasQuota, res.QuotaRemaining = true, *remaining
+			}
+			return res, nil
+		}
+	}
+	// older versions only have the quotas of the collections, or no quotas at all
+	usage, err := GetCollectionUsage(ctx, token, user, persistentId)
+	if err != nil {
+		logging.Logger.DebugContext(ctx, "no storage quota", "persistentId", persistentId, "error", err)
+		return res, nil
+	}
+	if usage.Quota > 0 {
+		res.HasQuota, res.QuotaRemaining, res.Collection = true, max(usage.Quota-usage.Used, 0), usage.Collection
+	}
+	return res, nil
+}
+
+// getMaxUploadSize reads the :MaxFileUploadSizeInBytes setting, a number or a limit per storage driver (with "default" for the
+// other drivers), 0 when not set
+func getMaxUploadSize(ctx context.Context, token, user, driver string) int64 {
+	res := messageResponse{}
+	req := GetRequest(ctx, "/api/v1/info/settings/:MaxFileUploadSizeInBytes", "GET", user, token, nil, nil)
+	if err := api.Do(ctx, req, &res); err != nil || res.Status != "OK" {
+		return 0
+	}
+	setting := strings.TrimSpace(res.Data.Message)
+	if n, err := strconv.ParseInt(setting, 10, 64); err == nil {
+		return n
+	}
+	perDriver := map[string]json.Number{}
+	if json.Unmarshal([]byte(setting), &perDriver) != nil {
+		return 0
+	}
+	n, ok := perDriver[driver]
+	if !ok {
+		n = perDriver["default"]
+	}
+	size, _ := n.Int64()
+	return size
+}
@@ -8,19 +8,19 @@ import (
 	"fmt"
 	"integration/app/config"
 	"integration/app/core"
+	"integration/app/httpclient"
 	"io"
 	"net/http"
-	"sync"
 )
 
 func swordDelete(ctx context.Context, token, _ string, id int64) error {
-	url := fmt.Sprintf("%s/dvn/api/data-deposit/v1.1/swordv2/edit-media/file/%d", config.GetConfig().DataverseServer, id)
+	url := fmt.Sprintf("%s/dvn/api/data-deposit/v1.1/swordv2/edit-media/file/%d", config.GetTarget(ctx).DataverseServer, id)
 	request, err := http.NewRequestWithContext(ctx, "DELETE", url, nil)
 	if err != nil {
 		return err
 	}
-	request.SetBasicAuth(token, "")
-	r, err := http.DefaultClient.Do(request)
+	setSwordAuth(request, token)
+	r, err := httpclient.Get("dataverse").Do(request)
 	if err != nil {
 		return err
 	}
@@ -32,34 +32,55 @@ func swordDelete(ctx context.Context, token, _ string, id int64) error {
 	return nil
 }
 
-func uploadViaSword(ctx context.Context, _ int64, id, token, _, persistentId string, wg *sync.WaitGroup, async_err *core.ErrorHolder) (io.WriteCloser, error) {
-	url := config.GetConfig().DataverseServer + "/dvn/api/data-deposit/v1.1/swordv2/edit-media/study/" + persistentId
+// setSwordAuth authenticates the SWORD request with the API token as the user name, or with the bearer token (see bearerAuth)
+func setSwordAuth(request *http.Request, token string) {
+	if bearerAuth() {
+		request.Header.Set("Authorization", "Bearer "+apiToken(token))
+		return
+	}
+	request.SetBasicAuth(apiToken(token), "")
+}
+
+// uploadViaSword posts the file zipped through a pipe, the request runs in the group: when it fails, the pipe is closed with its
+// error, so that the writes of the zip fail promptly with the real cause
+func uploadViaSword(ctx context.Context, _ int64, id, token, _, persistentId string, group *core.ErrGroup) (io.WriteCloser, error) {
+	url := config.GetTarget(ctx).DataverseServer + "/dvn/api/data-deposit/v1.1/swordv2/edit-media/study/" + persistentId
 	pr, pw := io.Pipe()
-	zipWriter := zip.NewWriter(pw)
-	writer, _ := zipWriter.Create(id)
-	request, _ := http.NewRequestWithContext(ctx, "POST", url, pr)
+	request, err := http.NewRequestWithContext(ctx, "POST", url, pr)
+	if err != nil {
+		return nil, err
+	}
 	request.Header.Add("Content-Type", "application/zip")
 	request.Header.Add("Content-Disposition", "attachment;filename=example.zip")
 	request.Header.Add("Packaging", "http://purl.org/net/sword/package/SimpleZip")
-	request.SetBasicAuth(token, "")
+	setSwordAuth(request, token)
+	zipWriter := zip.NewWriter(pw)
+	writer, err := zipWriter.Create(id)
+	if err != nil {
+		return nil, err
+	}
 
-	wg.Add(1)
-	go func(req http.Request) {
-		defer wg.Done()
-		defer pr.Close()
-		resp, err := http.DefaultClient.Do(request)
+	group.Go(func() error {
+		err := doSwordUpload(request, persistentId)
 		if err != nil {
-			if async_err != nil {
-				async_err.Err = err
-			}
-			return
-		}
-		defer resp.Body.Close()
-		if resp.StatusCode != 201 && async_err != nil {
-			b, _ := io.ReadAll(resp.Body)
-			async_err.Err = fmt.Errorf("writing file in %s failed: %d - %s", persistentId, resp.StatusCode, string(b))
+			pr.CloseWithError(err)
+			return err
 		}
-	}(*request)
+		return pr.Close()
+	})
 
 	return core.NewWritterCloser(writer, zipWriter, pw), nil
 }
+
+func doSwordUpload(request *http.Request, persistentId string) error {
+	resp, err := httpclient.Get("dataverse").Do(request)
+	if err != nil {
+		return fmt.Errorf("writing file in %s failed: %w", persistentId, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 201 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("writing file in %s failed: %d - %s", persistentId, resp.StatusCode, string(b))
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dataverse
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"io"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+// streamedFile is a file as it was uploaded, compared with the file registered by Dataverse
+type streamedFile struct {
+	nodeId            string
+	storageIdentifier string
+	hashType          string // empty when the hash was not calculated
+	hash              string
+	size              int64
+}
+
+// verifyRegistered compares the checksums and the sizes recorded by Dataverse (the response of the add or replace call) with the
+// streamed files, catching the corruption introduced by the proxies or the storage before the user publishes the dataset
+func verifyRegistered(ctx context.Context, persistentId string, streamed []streamedFile, registered []api.MetaData) error {
+	if config.GetConfig().Options.SkipRegistrationCheck {
+		return nil
+	}
+	byStorage := map[string]api.DataFile{}
+	byPath := map[string]api.DataFile{}
+	for _, v := range registered {
+		byStorage[v.DataFile.StorageIdentifier] = v.DataFile
+		byPath[path.Join(v.DirectoryLabel, v.Label)] = v.DataFile
+	}
+	mismatch := &core.ChecksumMismatchError{Files: map[string]int64{}}
+	for _, s := range streamed {
+		f, ok := byStorage[s.storageIdentifier]
+		if !ok || s.storageIdentifier == "" {
+			f, ok = byPath[s.nodeId]
+		}
+		if !ok && len(streamed) == 1 && len(registered) == 1 {
+			f, ok = registered[0].DataFile, true
+		}
+		if !ok || f.Id == 0 {
+			// not in the response (e.g., the label was changed by Dataverse), nothing to compare with
+			continue
+		}
+		if detail := compareRegistered(s, f); detail != "" {
+			logging.Logger.ErrorContext(ctx, "registered file does not match the uploaded file", "persistentId", persistentId, "file", s.nodeId, "id", f.Id, "mismatch", detail)
+			mismatch.Files[s.nodeId] = f.Id
+			mismatch.Details = append(mismatch.Details, s.nodeId+": "+detail)
+		}
+	}
+	if len(mismatch.Files) > 0 {
+		return mismatch
+	}
+	return nil
+}
+
+// compareRegistered describes the difference between the streamed and the registered file, empty when they match; the size is not
+// compared when Dataverse does not report it, the checksum when it was calculated with another algorithm
+func compareRegistered(s streamedFile, f api.DataFile) string {
+	if f.FileSize != 0 && f.FileSize != s.size {
+		return fmt.Sprintf("size %d, expected %d", f.FileSize, s.size)
+	}
+	if s.hashType == "" || s.hash == "" {
+		return ""
+	}
+	hashType, value := "", ""
+	if f.Checksum != nil {
+		hashType, value = f.Checksum.Type, f.Checksum.Value
+	} else if f.Md5 != "" {
+		hashType, value = types.Md5, f.Md5
+	}
+	if value == "" || types.NormalizeHashType(hashType) != types.NormalizeHashType(s.hashType) {
+		return ""
+	}
+	if !strings.EqualFold(value, s.hash) {
+		return fmt.Sprintf("%s checksum %s, expected %s", hashType, value, s.hash)
+	}
+	return ""
+}
+
+// checksumHasher returns the hasher of the checksum algorithm of Dataverse (the default hash), nil when Dataverse does not use
+// that algorithm and the registered checksum can not be compared
+func checksumHasher() (string, hash.Hash) {
+	hashType := types.NormalizeHashType(config.GetConfig().Options.DefaultHash)
+	switch hashType {
+	case types.Md5:
+		return hashType, md5.New()
+	case types.SHA1:
+		return hashType, sha1.New()
+	case types.SHA256:
+		return hashType, sha256.New()
+	case types.SHA512:
+		return hashType, sha512.New()
+	}
+	return "", nil
+}
+
+// streamingWriter calculates the size and the checksum of the file streamed over the API, done is closed when the file is complete
+type streamingWriter struct {
+	writer   io.Writer
+	closer   io.Closer
+	mu       sync.Mutex
+	hashType string
+	hasher   hash.Hash
+	size     int64
+	done     chan struct{}
+}
+
+func newStreamingWriter(writer io.Writer, closer io.Closer) *streamingWriter {
+	hashType, hasher := checksumHasher()
+	return &streamingWriter{writer: writer, closer: closer, hashType: hashType, hasher: hasher, done: make(chan struct{})}
+}
+
+func (w *streamingWriter) Write(p []byte) (int, error) {
+	n, err := w.writer.Write(p)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.hasher != nil {
+		w.hasher.Write(p[:n])
+	}
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *streamingWriter) Close() error {
+	defer close(w.done)
+	return w.closer.Close()
+}
+
+// streamed waits until the file is complete and returns it for verifyRegistered
+func (w *streamingWriter) streamed(ctx context.Context, nodeId string) (streamedFile, error) {
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		return streamedFile{}, ctx.Err()
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	res := streamedFile{nodeId: nodeId, size: w.size}
+	if w.hasher != nil {
+		res.hashType, res.hash = w.hashType, fmt.Sprintf("%x", w.hasher.Sum(nil))
+	}
+	return res, nil
+}
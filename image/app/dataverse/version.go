@@ -8,23 +8,57 @@ import (
 	"fmt"
 	"github.com/libis/rdm-dataverse-go-api/api"
 	"integration/app/config"
+	"integration/app/core"
+	"integration/app/httpclient"
 	"integration/app/logging"
 	"io"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type dvVersion string
 
-var version dvVersion
 var defaultVersion dvVersion = "5.14"
 
-var filesCleanup = "5.13"
-var urlSigning = "5.14"
-var directUpload = "5.14"
-var slashInPermissions = "https://github.com/IQSS/dataverse/pull/8995" // will be replaced with verion when pull request is merged
-var nativeApiDelete = "5.14"
+// the optional features of Dataverse used by this tool, enabled per installation by its version (see featureSince)
+const (
+	featureFilesCleanup       = "filesCleanup"
+	featureUrlSigning         = "urlSigning"
+	featureDirectUpload       = "directUpload"
+	featureSlashInPermissions = "slashInPermissions"
+	featureNativeApiDelete    = "nativeApiDelete"
+	featureCollectionQuotas   = "collectionQuotas"
+	featureUploadLimit        = "uploadLimit"
+)
+
+// featureSince is the version introducing the feature
+var featureSince = map[string]string{
+	featureFilesCleanup:       "5.13",
+	featureUrlSigning:         "5.14",
+	featureDirectUpload:       "5.14",
+	featureSlashInPermissions: "https://github.com/IQSS/dataverse/pull/8995", // will be replaced with verion when pull request is merged
+	featureNativeApiDelete:    "5.14",
+	featureCollectionQuotas:   "6.1",
+	featureUploadLimit:        "6.3",
+}
+
+// the version of an installation that could not be read is read again after that time, the default version is assumed meanwhile
+var reprobeInterval = time.Minute
+
+// capabilities are the version of a Dataverse installation and its features
+type capabilities struct {
+	version  dvVersion
+	detected bool // false when the version could not be read and the default version is assumed
+	probed   time.Time
+	features map[string]bool
+}
+
+var capabilitiesMutex sync.RWMutex
+var installations = map[string]capabilities{} // by target name, "" is the default installation (dataverseServer)
 
 func init() {
 	if config.GetConfig().DataverseServer != "" {
@@ -32,60 +66,140 @@ func init() {
 	}
 }
 
+// Init detects the features of the default installation and of the configured targets, the targets added later (e.g., by
+// reloading the configuration) are probed at their first call
 func Init() {
-	version = getVersion()
-	if version.GreaterOrEqual(filesCleanup) {
-		logging.Logger.Printf("version %v >= %v: files cleanup feature is on", version, filesCleanup)
-		filesCleanup = "true"
+	capabilitiesMutex.Lock()
+	installations = map[string]capabilities{}
+	capabilitiesMutex.Unlock()
+	targets := []string{""}
+	for name := range config.GetConfig().Options.DataverseTargets {
+		targets = append(targets, name)
 	}
-	if version.GreaterOrEqual(urlSigning) {
-		logging.Logger.Printf("version %v >= %v: url signing feature is on", version, urlSigning)
-		urlSigning = "true"
+	sort.Strings(targets)
+	for _, target := range targets {
+		c := capabilitiesOf(config.WithTarget(context.Background(), target))
+		if !c.features[featureDirectUpload] && directUploadConfigured(config.WithTarget(context.Background(), target)) {
+			logging.Logger.Warn("direct upload is configured but not supported by the Dataverse version, the files are uploaded through the API",
+				"target", target, "version", c.version, "since", featureSince[featureDirectUpload])
+		}
 	}
-	if version.GreaterOrEqual(directUpload) {
-		logging.Logger.Printf("version %v >= %v: direct upload feature is on", version, directUpload)
-		directUpload = "true"
+	initDefaultHash()
+}
+
+// capabilitiesOf returns the features of the installation of the context, the installation is probed at the first call
+func capabilitiesOf(ctx context.Context) capabilities {
+	target := config.TargetName(ctx)
+	capabilitiesMutex.RLock()
+	c, ok := installations[target]
+	capabilitiesMutex.RUnlock()
+	if ok && (c.detected || time.Since(c.probed) < reprobeInterval) {
+		return c
 	}
-	if version.GreaterOrEqual(slashInPermissions) {
-		logging.Logger.Printf("version %v >= %v: slash in permissions feature is on", version, slashInPermissions)
-		slashInPermissions = "true"
+	c = probe(ctx)
+	capabilitiesMutex.Lock()
+	installations[target] = c
+	capabilitiesMutex.Unlock()
+	return c
+}
+
+func probe(ctx context.Context) capabilities {
+	version, detected := getVersion(ctx)
+	c := capabilities{version: version, detected: detected, probed: time.Now(), features: map[string]bool{}}
+	for name, since := range featureSince {
+		c.features[name] = version.GreaterOrEqual(since)
 	}
-	if version.GreaterOrEqual(nativeApiDelete) {
-		logging.Logger.Printf("version %v >= %v: native API delete feature is on", version, nativeApiDelete)
-		nativeApiDelete = "true"
+	logging.Logger.Info("Dataverse features", "target", config.TargetName(ctx), "version", version, "detected", detected, "features", c.enabled())
+	return c
+}
+
+func (c capabilities) enabled() []string {
+	res := []string{}
+	for name, on := range c.features {
+		if on {
+			res = append(res, name)
+		}
 	}
+	sort.Strings(res)
+	return res
 }
 
-func getVersion() dvVersion {
-	ctx, cancel := context.WithTimeout(context.Background(), dvContextDuration)
-	defer cancel()
+// supports tells whether the installation of the context has the feature
+func supports(ctx context.Context, feature string) bool {
+	return capabilitiesOf(ctx).features[feature]
+}
+
+// requireFeature returns an error wrapping core.ErrUnsupported when the installation of the context does not have the feature
+func requireFeature(ctx context.Context, feature string) error {
+	c := capabilitiesOf(ctx)
+	if c.features[feature] {
+		return nil
+	}
+	installation := "the Dataverse installation"
+	if target := config.TargetName(ctx); target != "" {
+		installation = "the Dataverse target " + target
+	}
+	return fmt.Errorf("%w: %v needs Dataverse %v or later, %v runs version %v", core.ErrUnsupported, feature, featureSince[feature], installation, c.version)
+}
+
+// DestinationInfo returns the version and the features of the installation of the context
+func DestinationInfo(ctx context.Context) core.DestinationInfo {
+	c := capabilitiesOf(ctx)
+	return core.DestinationInfo{
+		Target:   config.TargetName(ctx),
+		Server:   config.GetTarget(ctx).DataverseServer,
+		Version:  string(c.version),
+		Detected: c.detected,
+		Features: c.enabled(),
+	}
+}
+
+// Ping checks that the Dataverse API is reachable
+func Ping(ctx context.Context) error {
 	url := fmt.Sprintf("%s/api/v1/info/version", config.GetConfig().DataverseServer)
 	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		logging.Logger.Println("error when getting version:", err)
-		logging.Logger.Println("using default " + defaultVersion + " version")
-		return defaultVersion
+		return err
+	}
+	r, err := httpclient.Get("dataverse").Do(request)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return fmt.Errorf("dataverse responded with status %v", r.StatusCode)
+	}
+	return nil
+}
+
+// getVersion reads the version of the installation of the context, the default version is returned when it can not be read
+func getVersion(ctx context.Context) (dvVersion, bool) {
+	ctx, cancel := context.WithTimeout(ctx, dvContextDuration)
+	defer cancel()
+	url := fmt.Sprintf("%s/api/v1/info/version", config.GetTarget(ctx).DataverseServer)
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		logging.Logger.Warn("error when getting version, using default version", "version", defaultVersion, "error", err)
+		return defaultVersion, false
 	}
-	r, err := http.DefaultClient.Do(request)
+	r, err := httpclient.Get("dataverse").Do(request)
 	if err != nil {
-		logging.Logger.Println("error when getting version:", err)
-		logging.Logger.Println("using default " + defaultVersion + " version")
-		return defaultVersion
+		logging.Logger.Warn("error when getting version, using default version", "version", defaultVersion, "error", err)
+		return defaultVersion, false
 	}
 	defer r.Body.Close()
 	b, _ := io.ReadAll(r.Body)
 	res := api.VersionResponse{}
 	if r.StatusCode != 200 {
-		logging.Logger.Println("error when getting version:", res.Message)
+		logging.Logger.Warn("error when getting version", "status", r.StatusCode, "message", res.Message)
 	}
 	json.Unmarshal(b, &res)
-	logging.Logger.Println("Dataverse version:", res.Data.Version)
 	ver := res.Data.Version
 	if ver == "" {
-		logging.Logger.Println("using default " + defaultVersion + " version")
-		ver = string(defaultVersion)
+		logging.Logger.Info("using default version", "version", defaultVersion)
+		return defaultVersion, false
 	}
-	return dvVersion(ver)
+	return dvVersion(ver), true
 }
 
 func (v1 dvVersion) GreaterOrEqual(v2 string) bool {
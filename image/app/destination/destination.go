@@ -5,11 +5,17 @@ package destination
 import (
 	"integration/app/core"
 	"integration/app/dataverse"
+	"integration/app/httpclient"
+	"net/http"
 )
 
 func SetDataverseAsDestination() {
+	// the Dataverse API library only uses the default client
+	http.DefaultClient = httpclient.Dataverse()
 	core.Destination = core.DestinationPlugin{
 		IsDirectUpload:        dataverse.IsDirectUpload,
+		IsSignedUrlUpload:     dataverse.IsSignedUrlUpload,
+		UploadToSignedUrls:    dataverse.UploadToSignedUrls,
 		CheckPermission:       dataverse.CheckPermission,
 		CreateNewRepo:         dataverse.CreateNewDataset,
 		GetRepoUrl:            dataverse.GetDatasetUrl,
@@ -21,5 +27,18 @@ func SetDataverseAsDestination() {
 		GetStream:             dataverse.DownloadFile,
 		Query:                 dataverse.GetNodeMap,
 		GetUserEmail:          dataverse.GetUserEmail,
+		Publish:               dataverse.PublishDataset,
+		GetCollectionUsage:    dataverse.GetCollectionUsage,
+		GetStorageDriver:      dataverse.GetStorageDriver,
+		StorageIdentifiers:    dataverse.StorageIdentifiers,
+		GetStorageLimits:      dataverse.GetStorageLimits,
+		GetLastUpdateTime:     dataverse.GetLastUpdateTime,
+		IsSuperuser:           dataverse.IsSuperuser,
+		CreateApiToken:        dataverse.CreateApiToken,
+		ListDatasets:          dataverse.ListDatasets,
+		CollectionContents:    dataverse.CollectionContents,
+		DatasetCollections:    dataverse.DatasetCollections,
+		Info:                  dataverse.DestinationInfo,
+		Ping:                  dataverse.Ping,
 	}
 }
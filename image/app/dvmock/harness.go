@@ -0,0 +1,165 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dvmock
+
+import (
+	"context"
+	"fmt"
+	"integration/app/client"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/dataverse"
+	"integration/app/destination"
+	"integration/app/plugin/types"
+	"integration/app/server"
+	"integration/app/tree"
+	"net/http/httptest"
+	"time"
+)
+
+// Token is the API token of the user of the harness
+const Token = "dvmock-token"
+
+const pollInterval = 100 * time.Millisecond
+
+// Harness runs the application (the API and the workers) against the fake Dataverse with the in-memory backend, the state of the
+// application is global: only one harness can run at a time
+type Harness struct {
+	Dataverse *Server
+	Api       *httptest.Server
+	Client    *client.Client
+	quit      chan struct{}
+}
+
+// NewHarness starts the fake Dataverse, the API and the workers, the harness must be closed after use
+func NewHarness(workers int) *Harness {
+	dv := New()
+	dv.AddUser(Token, "harness")
+	config.SetConfig(dv.URL, "root", "", nil, false, 0)
+	config.SetRedis(config.NewMemoryClient())
+	destination.SetDataverseAsDestination()
+	dataverse.Init()
+	api := httptest.NewServer(server.Handler())
+	h := &Harness{Dataverse: dv, Api: api, Client: client.New(api.URL, ""), quit: make(chan struct{})}
+	for i := 0; i < workers; i++ {
+		core.Wait.Add(1)
+		go core.ProcessJobs(h.quit)
+	}
+	return h
+}
+
+// Close stops the workers (after their current job) and the servers
+func (h *Harness) Close() {
+	close(h.quit)
+	core.Wait.Wait()
+	h.Api.Close()
+	h.Dataverse.Close()
+}
+
+// Compare compares the local folder with the dataset, through the API as done by the frontend, and waits for the result
+// (including the re-hashing jobs started by the comparison)
+func (h *Harness) Compare(ctx context.Context, dir, persistentId string) (core.CompareResponse, error) {
+	for {
+		key, err := h.Client.CompareRepository(ctx, compareRequest(dir, persistentId))
+		if err != nil {
+			return core.CompareResponse{}, err
+		}
+		res, err := h.cached(ctx, key.Key)
+		if err != nil || res.Status != core.Updating {
+			return res, err
+		}
+		if err = h.WaitForJob(ctx, persistentId); err != nil {
+			return res, err
+		}
+	}
+}
+
+// Sync compares the local folder with the dataset and stores the new, updated and deleted files, it returns the report of the
+// finished job (nil when the dataset was already up to date)
+func (h *Harness) Sync(ctx context.Context, dir, persistentId string) (*core.JobReport, error) {
+	res, err := h.Compare(ctx, dir, persistentId)
+	if err != nil {
+		return nil, err
+	}
+	selected := []tree.Node{}
+	for _, v := range res.Data {
+		switch v.Status {
+		case tree.New:
+			v.Action = tree.Copy
+		case tree.Updated:
+			v.Action = tree.Update
+		case tree.Deleted:
+			v.Action = tree.Delete
+		default:
+			continue
+		}
+		selected = append(selected, v)
+	}
+	if len(selected) == 0 {
+		return nil, nil
+	}
+	_, err = h.Client.Store(ctx, common.StoreRequest{
+		Plugin:        "local",
+		StreamParams:  types.StreamParams{PluginId: "local", Url: dir},
+		PersistentId:  persistentId,
+		DataverseKey:  Token,
+		SelectedNodes: selected,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = h.WaitForJob(ctx, persistentId); err != nil {
+		return nil, err
+	}
+	report, err := h.Client.Report(ctx, common.ReportRequest{PersistentId: persistentId, DataverseKey: Token})
+	if err != nil {
+		return nil, err
+	}
+	if !report.Found {
+		return nil, fmt.Errorf("no report for dataset %v", persistentId)
+	}
+	return &report.Report, nil
+}
+
+// WaitForJob waits until the dataset is no longer locked by a job
+func (h *Harness) WaitForJob(ctx context.Context, persistentId string) error {
+	for core.IsLocked(ctx, persistentId) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+	return nil
+}
+
+func (h *Harness) cached(ctx context.Context, key string) (core.CompareResponse, error) {
+	for {
+		res, err := h.Client.CachedResponse(ctx, common.CachedRequest{Key: key})
+		if err != nil {
+			return core.CompareResponse{}, err
+		}
+		if res.ErrorMessage != "" {
+			return core.CompareResponse{}, fmt.Errorf("compare failed: %v", res.ErrorMessage)
+		}
+		if res.Ready {
+			return res.Response, nil
+		}
+		select {
+		case <-ctx.Done():
+			return core.CompareResponse{}, ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+func compareRequest(dir, persistentId string) types.CompareRequest {
+	return types.CompareRequest{
+		PluginId:     "local",
+		Plugin:       "local",
+		Url:          dir,
+		PersistentId: persistentId,
+		DataverseKey: Token,
+	}
+}
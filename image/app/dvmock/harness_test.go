@@ -0,0 +1,207 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package dvmock
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/md5"
+	"fmt"
+	"integration/app/common"
+	"integration/app/core"
+	"integration/app/tree"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testPid = "doi:10.5072/FK2/DVMOCK"
+
+func newTestHarness(t *testing.T) (*Harness, context.Context) {
+	h := NewHarness(1)
+	t.Cleanup(h.Close)
+	h.Dataverse.AddDataset(testPid)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	return h, ctx
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	h, ctx := newTestHarness(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"empty.txt": "", "data/results.csv": "a,b\n1,2\n"})
+
+	report, err := h.Sync(ctx, dir, testPid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report == nil || report.FilesWritten != 2 {
+		t.Fatalf("expected 2 written files, got %+v", report)
+	}
+	stored, ok := h.Dataverse.Files(testPid)["empty.txt"]
+	if !ok {
+		t.Fatal("the empty file was not uploaded")
+	}
+	if len(stored.Content) != 0 || stored.Md5 != fmt.Sprintf("%x", md5.Sum(nil)) {
+		t.Fatalf("the empty file was stored with %d bytes and MD5 %v", len(stored.Content), stored.Md5)
+	}
+
+	res, err := h.Compare(ctx, dir, testPid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Data) != 2 {
+		t.Fatalf("expected 2 compared files, got %d", len(res.Data))
+	}
+	for _, v := range res.Data {
+		if v.Status != tree.Equal {
+			t.Errorf("%v: expected equal after the sync, got status %v", v.Id, v.Status)
+		}
+	}
+
+	// the fixity verification hashes the files stored in Dataverse
+	req := common.ReportRequest{PersistentId: testPid, DataverseKey: Token}
+	if err = h.Client.Fixity(ctx, req); err != nil {
+		t.Fatal(err)
+	}
+	if err = h.WaitForJob(ctx, testPid); err != nil {
+		t.Fatal(err)
+	}
+	fixity, err := h.Client.FixityReport(ctx, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fixity.Report.Passed != 2 || fixity.Report.Failed != 0 || fixity.Report.Errors != 0 {
+		t.Fatalf("expected 2 passed files, got %+v", fixity.Report)
+	}
+}
+
+func TestCorruptUpload(t *testing.T) {
+	h, ctx := newTestHarness(t)
+	dir := t.TempDir()
+	content := "a,b\n1,2\n"
+	writeFiles(t, dir, map[string]string{"data/results.csv": content})
+	h.Dataverse.CorruptUpload("data/results.csv")
+
+	// the registered checksum does not match the streamed file: the registered file is replaced in the next attempt
+	report, err := h.Sync(ctx, dir, testPid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := report.Files["data/results.csv"]; result.Result != "updated" {
+		t.Fatalf("expected the corrupted file to be replaced, got %+v", result)
+	}
+	stored := h.Dataverse.Files(testPid)["data/results.csv"]
+	if string(stored.Content) != content {
+		t.Fatalf("expected %q to be stored, got %q", content, stored.Content)
+	}
+	if !slices.ContainsFunc(h.Dataverse.Requests(), func(r string) bool { return strings.HasSuffix(r, "/replace") }) {
+		t.Fatal("the corrupted file was not replaced")
+	}
+	if report, err = h.Sync(ctx, dir, testPid); err != nil || report != nil {
+		t.Fatalf("expected the dataset to be up to date, got %+v (%v)", report, err)
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	h, ctx := newTestHarness(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"data/results.csv": "a,b\n1,2\n"})
+	h.Dataverse.SetQuota(testPid, 4)
+
+	res, err := h.Compare(ctx, dir, testPid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(res.Warnings, func(w core.Warning) bool { return w.Type == core.WarningQuotaExceeded }) {
+		t.Fatalf("expected a quota warning, got %+v", res.Warnings)
+	}
+	if _, err = h.Sync(ctx, dir, testPid); err == nil {
+		t.Fatal("the store exceeding the quota was accepted")
+	}
+	if files := h.Dataverse.Files(testPid); len(files) != 0 {
+		t.Fatalf("expected no uploaded files, got %d", len(files))
+	}
+}
+
+func TestUpToDate(t *testing.T) {
+	h, ctx := newTestHarness(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"a.txt": "a", "b/c.txt": "c"})
+	h.Dataverse.AddStrayFile(testPid, "18b4d6a2c1e-0123456789ab")
+
+	if _, err := h.Sync(ctx, dir, testPid); err != nil {
+		t.Fatal(err)
+	}
+	uploaded := len(h.Dataverse.Requests())
+	report, err := h.Sync(ctx, dir, testPid)
+	if err != nil || report != nil {
+		t.Fatalf("expected the dataset to be up to date, got %+v (%v)", report, err)
+	}
+	for _, r := range h.Dataverse.Requests()[uploaded:] {
+		if !strings.HasPrefix(r, "GET ") {
+			t.Errorf("unexpected request after the dataset was synchronized: %v", r)
+		}
+	}
+	// the jobs without failed direct uploads never call cleanStorage, the unregistered files of other tools are kept
+	if stray := h.Dataverse.StrayFiles(testPid); len(stray) != 1 {
+		t.Fatalf("expected the stray file to be kept, got %v", stray)
+	}
+}
+
+func zipContent(t *testing.T, name, content string) string {
+	b := &bytes.Buffer{}
+	w := zip.NewWriter(b)
+	entry, err := w.Create(name)
+	if err == nil {
+		_, err = entry.Write([]byte(content))
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+func TestZipReplace(t *testing.T) {
+	h, ctx := newTestHarness(t)
+	dir := t.TempDir()
+	h.Dataverse.AddFile(testPid, "data/archive.zip", []byte(zipContent(t, "a.txt", "old")))
+	archive := zipContent(t, "a.txt", "new")
+	writeFiles(t, dir, map[string]string{"data/archive.zip": archive})
+
+	// the archive is replaced with the native API, sent double-zipped so that it is not unpacked
+	report, err := h.Sync(ctx, dir, testPid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result := report.Files["data/archive.zip"]; result.Result != "updated" {
+		t.Fatalf("expected the archive to be replaced, got %+v", result)
+	}
+	if stored := h.Dataverse.Files(testPid)["data/archive.zip"]; string(stored.Content) != archive {
+		t.Fatal("the stored archive differs from the source")
+	}
+	for _, r := range h.Dataverse.Requests() {
+		if strings.HasPrefix(r, "DELETE ") {
+			t.Errorf("the archive was deleted instead of replaced: %v", r)
+		}
+	}
+}
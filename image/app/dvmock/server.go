@@ -0,0 +1,676 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+// Package dvmock is a fake Dataverse (an httptest server) implementing the part of the API used by this tool: listing the files,
+// adding, replacing and deleting files (also after direct upload, the uploaded zip files are unpacked), downloading, permissions (admin and userPermissions), users/:me, recreating the API tokens, the signed URLs, cleanStorage, locks, the
+// upload limits, listing the datasets (my data and the contents of the collections) and creating datasets in collections (with the
+// citation metadata block only).
+// Together with the Harness it runs the compare and store pipeline (plugins, jobs and workers) without a Dataverse installation.
+package dvmock
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/libis/rdm-dataverse-go-api/api"
+)
+
+// Subjects are the values of the subject field of the citation metadata block of the fake server
+var Subjects = []string{"Agricultural Sciences", "Computer and Information Science", "Earth and Environmental Sciences", "Medicine, Health and Life Sciences", "Physics", "Other"}
+
+// Version is the Dataverse version reported by the fake server, all optional features of the tool are enabled for it
+const Version = "6.3"
+
+// File is a file of a fake dataset, the content is not known for the files added after a direct upload
+type File struct {
+	Id                int64
+	Path              string // directory label and file name, e.g., "data/results.csv"
+	Description       string
+	Content           []byte
+	Md5               string
+	StorageIdentifier string
+	Created           time.Time
+}
+
+type dataset struct {
+	id          int64
+	files       map[string]*File // by path
+	locks       []string
+	permissions []string
+	quota       *int64 // remaining storage quota, no quota when nil
+	updated     time.Time
+	collection  string   // set for the datasets created through the API
+	stray       []string // names of the unregistered files in the storage of the dataset, see AddStrayFile
+	body        []byte   // the request creating the dataset, with its metadata
+}
+
+type Server struct {
+	*httptest.Server
+	mu          sync.Mutex
+	datasets    map[string]*dataset
+	collections map[string][]string // alias -> permissions of the users, see AddCollection
+	users       map[string]string   // API token -> user identifier
+	nextId      int64
+	requests    []string
+	maxSize     string          // the :MaxFileUploadSizeInBytes setting, not set when empty
+	corrupt     map[string]bool // paths of the files stored truncated at their next upload, see CorruptUpload
+}
+
+// New starts a fake Dataverse without datasets, all API tokens are accepted until a user is added
+func New() *Server {
+	s := &Server{datasets: map[string]*dataset{}, collections: map[string][]string{}, users: map[string]string{}, nextId: 1, corrupt: map[string]bool{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// AddUser registers the API token of a user, the requests with other tokens are then rejected
+func (s *Server) AddUser(token, identifier string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[token] = identifier
+}
+
+// AddDataset creates an empty dataset, the users can edit it
+func (s *Server) AddDataset(persistentId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.datasets[persistentId] = &dataset{id: s.newId(), files: map[string]*File{}, permissions: []string{"ViewUnpublishedDataset", "EditDataset"}, updated: time.Now()}
+}
+
+// AddCollection adds a collection where the users have a role and the given permissions (e.g., "AddDataset"), listed by my data
+func (s *Server) AddCollection(alias string, permissions ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.collections[alias] = permissions
+}
+
+// AddFile adds (or replaces) a file of the dataset and returns its id
+func (s *Server) AddFile(persistentId, filePath string, content []byte) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds := s.dataset(persistentId)
+	f := &File{Id: s.newId(), Path: filePath, Content: content, Md5: fmt.Sprintf("%x", md5.Sum(content)), Created: time.Now()}
+	ds.files[filePath] = f
+	ds.updated = time.Now()
+	return f.Id
+}
+
+// Files returns the files of the dataset by path
+func (s *Server) Files(persistentId string) map[string]File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := map[string]File{}
+	for k, v := range s.dataset(persistentId).files {
+		res[k] = *v
+	}
+	return res
+}
+
+// CreatedDataset returns the collection of a dataset created through the API, with the body of the request that created it
+// (the "datasetVersion" with the metadata blocks)
+func (s *Server) CreatedDataset(persistentId string) (collection string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds := s.dataset(persistentId)
+	return ds.collection, ds.body
+}
+
+// SetPermissions replaces the permissions of the users on the dataset, e.g., without "EditDataset" for a read-only dataset
+func (s *Server) SetPermissions(persistentId string, permissions ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dataset(persistentId).permissions = permissions
+}
+
+// SetQuota sets the remaining storage quota of the dataset in bytes, as returned by the upload limit API
+func (s *Server) SetQuota(persistentId string, remaining int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dataset(persistentId).quota = &remaining
+}
+
+// SetMaxUploadSize sets the :MaxFileUploadSizeInBytes setting, e.g., "1000" or {"default": "1000", "s3": "5000"}
+func (s *Server) SetMaxUploadSize(setting string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.maxSize = setting
+}
+
+// SetLocks replaces the locks of the dataset (e.g., "Ingest" or "finalizePublication"), no locks when empty
+func (s *Server) SetLocks(persistentId string, lockTypes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dataset(persistentId).locks = lockTypes
+}
+
+// CorruptUpload stores the next upload of the file (e.g., "data/results.csv") without its last byte, as a faulty proxy would
+func (s *Server) CorruptUpload(filePath string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.corrupt[filePath] = true
+}
+
+// AddStrayFile adds an unregistered file (the storage file name) to the storage of the dataset, listed and removed by cleanStorage
+func (s *Server) AddStrayFile(persistentId, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ds := s.dataset(persistentId)
+	ds.stray = append(ds.stray, name)
+}
+
+// StrayFiles returns the unregistered files that were not removed by cleanStorage
+func (s *Server) StrayFiles(persistentId string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.dataset(persistentId).stray...)
+}
+
+// Requests returns the received requests as "METHOD path", in the order they were received
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) newId() int64 {
+	s.nextId++
+	return s.nextId
+}
+
+func (s *Server) dataset(persistentId string) *dataset {
+	ds, ok := s.datasets[persistentId]
+	if !ok {
+		panic("dvmock: unknown dataset " + persistentId)
+	}
+	return ds
+}
+
+type response struct {
+	Status  string      `json:"status"`
+	Message string      `json:"message,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+}
+
+func writeJson(w http.ResponseWriter, status int, data interface{}) {
+	res := response{Status: "OK", Data: data}
+	if status >= 300 {
+		res = response{Status: "ERROR", Message: fmt.Sprint(data)}
+	}
+	b, _ := json.Marshal(res)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	// the uploads are streamed by the tool while it can call other endpoints: the body is read before locking the state
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, err)
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+	p := strings.TrimPrefix(r.URL.Path, "/api/v1")
+	switch {
+	case p == "/info/version":
+		writeJson(w, http.StatusOK, api.VersionData{Version: Version, Build: "dvmock"})
+		return
+	case p == "/admin/settings/:FileFixityChecksumAlgorithm":
+		writeJson(w, http.StatusOK, map[string]string{"message": "MD5"})
+		return
+	case p == "/info/settings/:MaxFileUploadSizeInBytes":
+		if s.maxSize == "" {
+			writeJson(w, http.StatusNotFound, "Setting :MaxFileUploadSizeInBytes not found")
+		} else {
+			writeJson(w, http.StatusOK, map[string]string{"message": s.maxSize})
+		}
+		return
+	}
+	if p == "/admin/requestSignedUrl" {
+		s.signUrl(w, r)
+		return
+	}
+	user, ok := s.user(r)
+	if !ok {
+		writeJson(w, http.StatusUnauthorized, "Bad API key")
+		return
+	}
+	switch {
+	case p == "/users/token/recreate" && r.Method == "POST":
+		s.recreateToken(w, user)
+	case p == "/users/:me":
+		writeJson(w, http.StatusOK, api.UserData{Identifier: user, DisplayName: user, FirstName: user, LastName: user})
+	case strings.HasPrefix(p, "/admin/permissions/"):
+		s.permissions(w, r, user, strings.TrimPrefix(p, "/admin/permissions/"))
+	case strings.HasPrefix(p, "/datasets/:persistentId"):
+		ds, ok := s.datasets[r.URL.Query().Get("persistentId")]
+		if !ok {
+			writeJson(w, http.StatusNotFound, "Dataset with Persistent ID "+r.URL.Query().Get("persistentId")+" not found.")
+			return
+		}
+		s.datasetApi(w, r, ds, strings.TrimPrefix(p, "/datasets/:persistentId"))
+	case p == "/mydata/retrieve":
+		s.myData(w, r)
+	case strings.HasPrefix(p, "/dataverses/"):
+		s.collectionApi(w, r, strings.TrimPrefix(p, "/dataverses/"))
+	case p == "/metadatablocks/citation":
+		writeJson(w, http.StatusOK, map[string]interface{}{"name": "citation", "fields": map[string]interface{}{
+			"subject": map[string]interface{}{"name": "subject", "controlledVocabularyValues": Subjects},
+		}})
+	case strings.HasPrefix(p, "/files/"):
+		s.fileApi(w, r, strings.TrimPrefix(p, "/files/"))
+	case strings.HasPrefix(p, "/access/datafile/"):
+		_, f := s.file(strings.TrimPrefix(p, "/access/datafile/"))
+		if f == nil || f.Content == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(f.Content)
+	default:
+		writeJson(w, http.StatusNotFound, "API endpoint does not exist on this server")
+	}
+}
+
+// signature is the token of the URLs signed by the fake server
+const signature = "dvmock-signature"
+
+// signUrl signs the URL for the user, the admin API key is not checked
+func (s *Server) signUrl(w http.ResponseWriter, r *http.Request) {
+	req := api.SigningRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJson(w, http.StatusBadRequest, err)
+		return
+	}
+	q := url.Values{"until": {time.Now().Add(time.Duration(req.TimeOut) * time.Second).Format(time.RFC3339)}, "user": {req.User}, "method": {req.HttpMethod}, "token": {signature}}
+	sep := "?"
+	if strings.Contains(req.Url, "?") {
+		sep = "&"
+	}
+	writeJson(w, http.StatusOK, map[string]string{"signedUrl": req.Url + sep + q.Encode()})
+}
+
+// recreateToken replaces the API tokens of the user with a new token
+func (s *Server) recreateToken(w http.ResponseWriter, user string) {
+	for token, u := range s.users {
+		if u == user {
+			delete(s.users, token)
+		}
+	}
+	token := fmt.Sprintf("dvmock-token-%d", s.newId())
+	s.users[token] = user
+	writeJson(w, http.StatusOK, map[string]string{"message": "New token for " + user + " is " + token + " and expires on " + time.Now().AddDate(1, 0, 0).Format("2006-01-02")})
+}
+
+func (s *Server) user(r *http.Request) (string, bool) {
+	if q := r.URL.Query(); q.Get("token") == signature && q.Get("user") != "" {
+		return q.Get("user"), true
+	}
+	token := r.Header.Get("X-Dataverse-key")
+	if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		token = bearer
+	}
+	if token == "" {
+		token = r.URL.Query().Get("key")
+	}
+	if len(s.users) == 0 {
+		return "dataverseAdmin", true
+	}
+	user, ok := s.users[token]
+	return user, ok
+}
+
+func (s *Server) permissions(w http.ResponseWriter, r *http.Request, user, id string) {
+	if permissions, ok := s.collections[id]; ok {
+		writeJson(w, http.StatusOK, api.PermissionsData{User: "@" + user, Permissions: permissions})
+		return
+	}
+	var ds *dataset
+	if id == ":persistentId" {
+		ds = s.datasets[r.URL.Query().Get("persistentId")]
+	} else {
+		for _, v := range s.datasets {
+			if fmt.Sprint(v.id) == id {
+				ds = v
+			}
+		}
+	}
+	if ds == nil {
+		writeJson(w, http.StatusNotFound, "dataset not found")
+		return
+	}
+	writeJson(w, http.StatusOK, api.PermissionsData{User: "@" + user, Permissions: ds.permissions})
+}
+
+func (s *Server) datasetApi(w http.ResponseWriter, r *http.Request, ds *dataset, p string) {
+	switch {
+	case p == "":
+		writeJson(w, http.StatusOK, map[string]interface{}{"id": ds.id, "persistentId": r.URL.Query().Get("persistentId")})
+	case p == "/versions":
+		writeJson(w, http.StatusOK, []map[string]interface{}{{"versionState": "DRAFT", "files": ds.metadata()}})
+	case strings.HasPrefix(p, "/versions/") && strings.HasSuffix(p, "/files"):
+		writeJson(w, http.StatusOK, ds.metadata())
+	case strings.HasPrefix(p, "/versions/"):
+		writeJson(w, http.StatusOK, map[string]interface{}{"versionState": "DRAFT", "lastUpdateTime": ds.updated.UTC().Format(time.RFC3339Nano)})
+	case p == "/userPermissions":
+		writeJson(w, http.StatusOK, map[string]bool{
+			"canViewUnpublishedDataset": slices.Contains(ds.permissions, "ViewUnpublishedDataset"),
+			"canEditDataset":            slices.Contains(ds.permissions, "EditDataset"),
+		})
+	case p == "/uploadlimit":
+		limit := map[string]interface{}{}
+		if ds.quota != nil {
+			limit["storageQuotaRemaining"] = *ds.quota
+		}
+		writeJson(w, http.StatusOK, map[string]interface{}{"uploadLimit": limit})
+	case p == "/storageDriver":
+		writeJson(w, http.StatusOK, map[string]string{"name": "file", "type": "file", "label": "file"})
+	case p == "/locks":
+		locks := []map[string]string{}
+		for _, l := range ds.locks {
+			locks = append(locks, map[string]string{"lockType": l})
+		}
+		writeJson(w, http.StatusOK, locks)
+	case p == "/cleanStorage":
+		found := []string{}
+		for _, m := range ds.metadata() {
+			found = append(found, m.DataFile.StorageIdentifier[strings.LastIndex(m.DataFile.StorageIdentifier, ":")+1:])
+		}
+		deleted := ds.stray
+		if r.URL.Query().Get("dryrun") != "true" {
+			ds.stray = nil
+		}
+		writeJson(w, http.StatusOK, map[string]string{"message": "Found: " + strings.Join(found, ", ") + "\nDeleted: " + strings.Join(deleted, ", ")})
+	case p == "/add" && r.Method == "POST":
+		s.upload(w, r, ds, nil)
+	case (p == "/addFiles" || p == "/replaceFiles") && r.Method == "POST":
+		s.addFiles(w, r, ds)
+	default:
+		writeJson(w, http.StatusNotFound, "API endpoint does not exist on this server")
+	}
+}
+
+// collectionApi serves the metadata blocks of the collections and creates the datasets, any collection alias exists
+func (s *Server) collectionApi(w http.ResponseWriter, r *http.Request, p string) {
+	alias, p, _ := strings.Cut(p, "/")
+	switch {
+	case p == "contents":
+		s.contents(w, alias)
+	case p == "userPermissions":
+		permissions, ok := s.collections[alias]
+		if !ok {
+			writeJson(w, http.StatusNotFound, "Can't find dataverse with identifier='"+alias+"'")
+			return
+		}
+		writeJson(w, http.StatusOK, map[string]bool{"canAddDataset": slices.Contains(permissions, "AddDataset")})
+	case p == "metadatablocks":
+		writeJson(w, http.StatusOK, []map[string]string{{"name": "citation", "displayName": "Citation Metadata"}})
+	case p == "datasets" && r.Method == "POST":
+		body, _ := io.ReadAll(r.Body)
+		if !json.Valid(body) {
+			writeJson(w, http.StatusBadRequest, "Error parsing Json")
+			return
+		}
+		id := s.newId()
+		persistentId := fmt.Sprintf("doi:10.5072/FK2/DVMOCK%d", id)
+		s.datasets[persistentId] = &dataset{id: id, files: map[string]*File{}, permissions: []string{"ViewUnpublishedDataset", "EditDataset"}, updated: time.Now(), collection: alias, body: body}
+		writeJson(w, http.StatusCreated, api.CreateNewDatasetResponseData{Id: int(id), PersistentId: persistentId})
+	default:
+		writeJson(w, http.StatusNotFound, "API endpoint does not exist on this server")
+	}
+}
+
+// myDataPageSize is the number of the items of a page of the my data call, as in Dataverse
+const myDataPageSize = 10
+
+// myData lists the datasets by persistent identifier, or the collections by alias (all of them, the search term and the roles are not used)
+func (s *Server) myData(w http.ResponseWriter, r *http.Request) {
+	collections := r.URL.Query().Get("dvobject_types") == "Dataverse"
+	ids := []string{}
+	if collections {
+		for alias := range s.collections {
+			ids = append(ids, alias)
+		}
+	} else {
+		for id := range s.datasets {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	page, _ := strconv.Atoi(r.URL.Query().Get("selected_page"))
+	page = max(page, 1)
+	start, end := min((page-1)*myDataPageSize, len(ids)), min(page*myDataPageSize, len(ids))
+	items := []map[string]interface{}{}
+	for _, id := range ids[start:end] {
+		if collections {
+			items = append(items, map[string]interface{}{"name": "Collection " + id, "type": "dataverse", "identifier": id, "user_roles": []string{"Dataset Creator"}})
+			continue
+		}
+		items = append(items, map[string]interface{}{"name": "Dataset " + id, "type": "dataset", "global_id": id,
+			"identifier_of_dataverse": s.datasets[id].collection, "versionState": "DRAFT", "is_draft_state": true, "user_roles": []string{"Contributor"}})
+	}
+	if len(items) == 0 {
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error_message": "Sorry, no results were found."})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "data": map[string]interface{}{
+		"items":       items,
+		"total_count": len(ids),
+		"pagination":  map[string]interface{}{"selectedPageNumber": page, "hasNextPageNumber": end < len(ids)},
+	}})
+}
+
+// contents lists the datasets of the collection, the datasets added with AddDataset are in the root collection
+func (s *Server) contents(w http.ResponseWriter, alias string) {
+	data := []map[string]interface{}{}
+	for id, ds := range s.datasets {
+		if ds.collection == alias || (ds.collection == "" && (alias == "root" || alias == ":root")) {
+			protocol, rest, _ := strings.Cut(id, ":")
+			authority, identifier, _ := strings.Cut(rest, "/")
+			data = append(data, map[string]interface{}{"type": "dataset", "id": ds.id, "protocol": protocol, "authority": authority, "identifier": identifier})
+		}
+	}
+	writeJson(w, http.StatusOK, data)
+}
+
+func (s *Server) fileApi(w http.ResponseWriter, r *http.Request, p string) {
+	id, replace := strings.CutSuffix(p, "/replace")
+	ds, f := s.file(id)
+	switch {
+	case f == nil:
+		writeJson(w, http.StatusNotFound, "File with ID "+id+" not found.")
+	case replace && r.Method == "POST":
+		s.upload(w, r, ds, f)
+	case !replace && r.Method == "DELETE":
+		if len(ds.locks) > 0 {
+			writeJson(w, http.StatusForbidden, "Dataset is locked")
+			return
+		}
+		delete(ds.files, f.Path)
+		ds.updated = time.Now()
+		writeJson(w, http.StatusOK, map[string]string{"message": "Deleted file " + id})
+	default:
+		writeJson(w, http.StatusNotFound, "API endpoint does not exist on this server")
+	}
+}
+
+func (s *Server) file(id string) (*dataset, *File) {
+	for _, ds := range s.datasets {
+		for _, f := range ds.files {
+			if strconv.FormatInt(f.Id, 10) == id {
+				return ds, f
+			}
+		}
+	}
+	return nil, nil
+}
+
+// upload adds (or replaces) a file sent as multipart form, with the "jsonData" field and the "file" part
+func (s *Server) upload(w http.ResponseWriter, r *http.Request, ds *dataset, replaced *File) {
+	if len(ds.locks) > 0 {
+		writeJson(w, http.StatusForbidden, "Dataset is locked")
+		return
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJson(w, http.StatusBadRequest, err)
+		return
+	}
+	jsonData := api.JsonData{}
+	var f *File
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, err)
+			return
+		}
+		switch part.FormName() {
+		case "jsonData":
+			err = json.NewDecoder(part).Decode(&jsonData)
+		case "file":
+			name := part.FileName()
+			var content []byte
+			content, err = io.ReadAll(part)
+			if err == nil && strings.HasSuffix(name, ".zip") {
+				name, content, err = unpackZip(content)
+			}
+			f = &File{Path: name, Content: content, Md5: fmt.Sprintf("%x", md5.Sum(content))}
+		}
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	if f == nil {
+		writeJson(w, http.StatusBadRequest, "file is missing")
+		return
+	}
+	f.Path, f.Description = path.Join(jsonData.DirectoryLabel, f.Path), jsonData.Description
+	if s.corrupt[f.Path] && len(f.Content) > 0 {
+		delete(s.corrupt, f.Path)
+		f.Content = f.Content[:len(f.Content)-1]
+		f.Md5 = fmt.Sprintf("%x", md5.Sum(f.Content))
+	}
+	if err := ds.store(s, f, replaced); err != nil {
+		writeJson(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJson(w, http.StatusOK, api.AddReplaceFileData{Files: []api.MetaData{f.metadata()}})
+}
+
+// unpackZip unpacks the uploaded zip file as Dataverse does, only the zip files with a single entry (e.g., a double-zipped archive)
+// are supported
+func unpackZip(content []byte) (string, []byte, error) {
+	r, err := zip.NewReader(bytes.NewReader(content), int64(len(content)))
+	if err != nil {
+		return "", nil, err
+	}
+	if len(r.File) != 1 {
+		return "", nil, fmt.Errorf("zip files with %d entries are not supported", len(r.File))
+	}
+	entry, err := r.File[0].Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer entry.Close()
+	unpacked, err := io.ReadAll(entry)
+	return path.Base(r.File[0].Name), unpacked, err
+}
+
+// addFiles registers the files written directly to the storage, the content of these files is not known
+func (s *Server) addFiles(w http.ResponseWriter, r *http.Request, ds *dataset) {
+	if len(ds.locks) > 0 {
+		writeJson(w, http.StatusForbidden, "Dataset is locked")
+		return
+	}
+	jsonData := []api.JsonData{}
+	if err := json.Unmarshal([]byte(r.FormValue("jsonData")), &jsonData); err != nil {
+		writeJson(w, http.StatusBadRequest, err)
+		return
+	}
+	res := []api.MetaData{}
+	for _, d := range jsonData {
+		f := &File{Path: path.Join(d.DirectoryLabel, d.FileName), Description: d.Description, StorageIdentifier: d.StorageIdentifier}
+		if d.Checksum != nil {
+			f.Md5 = d.Checksum.Value
+		}
+		var replaced *File
+		if d.FileToReplaceId != 0 {
+			_, replaced = s.file(strconv.FormatInt(d.FileToReplaceId, 10))
+			if replaced == nil {
+				writeJson(w, http.StatusBadRequest, fmt.Sprintf("file to replace %v not found", d.FileToReplaceId))
+				return
+			}
+		}
+		if err := ds.store(s, f, replaced); err != nil {
+			writeJson(w, http.StatusBadRequest, err)
+			return
+		}
+		res = append(res, f.metadata())
+	}
+	writeJson(w, http.StatusOK, api.AddReplaceFileData{Files: res})
+}
+
+func (ds *dataset) store(s *Server, f *File, replaced *File) error {
+	if existing, ok := ds.files[f.Path]; ok && existing != replaced {
+		return fmt.Errorf("duplicate file name: %v already exists in the dataset", f.Path)
+	}
+	if replaced != nil {
+		delete(ds.files, replaced.Path)
+	}
+	f.Id, f.Created = s.newId(), time.Now()
+	ds.files[f.Path] = f
+	ds.updated = time.Now()
+	return nil
+}
+
+func (ds *dataset) metadata() []api.MetaData {
+	paths := []string{}
+	for k := range ds.files {
+		paths = append(paths, k)
+	}
+	sort.Strings(paths)
+	res := []api.MetaData{}
+	for _, k := range paths {
+		res = append(res, ds.files[k].metadata())
+	}
+	return res
+}
+
+func (f *File) metadata() api.MetaData {
+	dir, name := path.Split(f.Path)
+	return api.MetaData{
+		Label:          name,
+		Description:    f.Description,
+		DirectoryLabel: strings.TrimSuffix(dir, "/"),
+		DataFile: api.DataFile{
+			Id:                f.Id,
+			FileName:          name,
+			ContentType:       "application/octet-stream",
+			FileSize:          int64(len(f.Content)),
+			Description:       f.Description,
+			StorageIdentifier: f.StorageIdentifier,
+			Md5:               f.Md5,
+			Checksum:          &api.ResChecksum{Type: "MD5", Value: f.Md5},
+			CreationDate:      f.Created.Format(time.DateOnly),
+		},
+	}
+}
@@ -0,0 +1,17 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package export
+
+import (
+	"context"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+)
+
+// writeGlobus uploads the file through the HTTPS access of a Globus collection (Globus Connect Server v5), the token must be
+// issued for the HTTPS scope of the collection; the HTTPS access does not create folders: the chosen folder must exist
+func writeGlobus(ctx context.Context, target config.ExportTarget, token, path string, reader io.Reader, size int64) error {
+	target.User = "" // always a bearer token
+	return put(ctx, httpclient.Get("globus"), targetUrl(target.Url, path), target, token, reader, size)
+}
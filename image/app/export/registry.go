@@ -0,0 +1,90 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+// Package export writes the dataset files to the configured export targets (e.g., S3 buckets, WebDAV folders, Globus collections or
+// SFTP servers), the reverse direction of the plugins streaming the files of the repositories to the datasets
+package export
+
+import (
+	"context"
+	"fmt"
+	"integration/app/config"
+	"io"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+)
+
+type Target struct {
+	// Write streams the file to the target, size is -1 when not known on beforehand; the missing folders are created when the target supports it
+	Write func(ctx context.Context, target config.ExportTarget, token, path string, reader io.Reader, size int64) error
+}
+
+type TargetInfo struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+var targetMap map[string]Target = map[string]Target{
+	"storage": {
+		Write: writeStorage,
+	},
+	"webdav": {
+		Write: writeWebdav,
+	},
+	"globus": {
+		Write: writeGlobus,
+	},
+	"sftp": {
+		Write: writeSftp,
+	},
+}
+
+// Targets returns the configured export targets, sorted by their id
+func Targets() []TargetInfo {
+	res := []TargetInfo{}
+	for id, t := range config.GetConfig().Options.ExportTargets {
+		name := t.Name
+		if name == "" {
+			name = id
+		}
+		res = append(res, TargetInfo{Id: id, Name: name, Type: t.Type})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Id < res[j].Id })
+	return res
+}
+
+// Check returns an error when the target is not configured or the folder is not a relative path within the target
+func Check(id, folder string) error {
+	t, ok := config.GetConfig().Options.ExportTargets[id]
+	if !ok {
+		return fmt.Errorf("unknown export target: %v", id)
+	}
+	if _, ok := targetMap[t.Type]; !ok {
+		return fmt.Errorf("export target %v has unsupported type: %v", id, t.Type)
+	}
+	if folder != "" && (path.IsAbs(folder) || strings.HasPrefix(path.Clean(folder), "..")) {
+		return fmt.Errorf("export folder must be a relative path within the target: %v", folder)
+	}
+	return nil
+}
+
+// Write streams the file to the target, the file path is relative to the folder chosen by the user within the prefix of the target
+func Write(ctx context.Context, id, token, folder, file string, reader io.Reader, size int64) error {
+	if err := Check(id, folder); err != nil {
+		return err
+	}
+	t := config.GetConfig().Options.ExportTargets[id]
+	p := strings.TrimPrefix(path.Join(t.Prefix, folder, file), "/")
+	return targetMap[t.Type].Write(ctx, t, token, p, reader, size)
+}
+
+// targetUrl is the base URL of the target followed by the escaped path segments
+func targetUrl(base, p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.TrimSuffix(base, "/") + "/" + strings.Join(segments, "/")
+}
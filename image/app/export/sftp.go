@@ -0,0 +1,45 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package export
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"integration/app/config"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// writeSftp uploads the file with curl (built with SFTP support), the missing folders are created; the credentials are passed
+// in a temporary configuration file, in order to keep them out of the command line
+func writeSftp(ctx context.Context, target config.ExportTarget, token, path string, reader io.Reader, _ int64) error {
+	conf, err := os.CreateTemp("", "sftp-*.conf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(conf.Name())
+	quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	if target.User != "" && target.IdentityFile != "" {
+		// the token is the passphrase of the key
+		fmt.Fprintf(conf, "user = \"%s:\"\nkey = \"%s\"\n", quote.Replace(target.User), quote.Replace(target.IdentityFile))
+		if token != "" {
+			fmt.Fprintf(conf, "pass = \"%s\"\n", quote.Replace(token))
+		}
+	} else if target.User != "" {
+		fmt.Fprintf(conf, "user = \"%s:%s\"\n", quote.Replace(target.User), quote.Replace(token))
+	}
+	if err = conf.Close(); err != nil {
+		return err
+	}
+	cmd := exec.CommandContext(ctx, "curl", "--silent", "--show-error", "--fail", "--ftp-create-dirs", "--config", conf.Name(), "--upload-file", "-", targetUrl(target.Url, path))
+	cmd.Stdin = reader
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("sftp upload failed: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
@@ -0,0 +1,18 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package export
+
+import (
+	"context"
+	"integration/app/config"
+	"integration/app/storage"
+	"io"
+)
+
+func writeStorage(ctx context.Context, target config.ExportTarget, _, path string, reader io.Reader, size int64) error {
+	st, err := storage.New(target.Storage, target.Bucket)
+	if err != nil {
+		return err
+	}
+	return st.Create(ctx, path, reader, size)
+}
@@ -0,0 +1,67 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package export
+
+import (
+	"context"
+	"fmt"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+	"net/http"
+	"strings"
+)
+
+func writeWebdav(ctx context.Context, target config.ExportTarget, token, path string, reader io.Reader, size int64) error {
+	client := httpclient.Get("webdav")
+	segments := strings.Split(path, "/")
+	// MKCOL of an existing collection fails with 405 (Method Not Allowed)
+	for i := 1; i < len(segments); i++ {
+		request, err := http.NewRequestWithContext(ctx, "MKCOL", targetUrl(target.Url, strings.Join(segments[:i], "/"))+"/", nil)
+		if err != nil {
+			return err
+		}
+		authorize(request, target, token)
+		r, err := client.Do(request)
+		if err != nil {
+			return err
+		}
+		r.Body.Close()
+		if r.StatusCode != http.StatusCreated && r.StatusCode != http.StatusMethodNotAllowed && r.StatusCode != http.StatusOK {
+			return fmt.Errorf("creating folder %v failed: %v", strings.Join(segments[:i], "/"), r.Status)
+		}
+	}
+	return put(ctx, client, targetUrl(target.Url, path), target, token, reader, size)
+}
+
+// put uploads the file with a PUT request, as used by WebDAV and the HTTPS access of the Globus collections
+func put(ctx context.Context, client *http.Client, u string, target config.ExportTarget, token string, reader io.Reader, size int64) error {
+	request, err := http.NewRequestWithContext(ctx, "PUT", u, reader)
+	if err != nil {
+		return err
+	}
+	if size >= 0 {
+		request.ContentLength = size
+	}
+	request.Header.Add("Content-Type", "application/octet-stream")
+	authorize(request, target, token)
+	r, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode > 299 {
+		b, _ := io.ReadAll(io.LimitReader(r.Body, 1024))
+		return fmt.Errorf("upload failed: %v: %s", r.Status, strings.TrimSpace(string(b)))
+	}
+	return nil
+}
+
+// authorize uses basic authentication when the target has a user (the token given by the user is then the password), the token as bearer token otherwise
+func authorize(request *http.Request, target config.ExportTarget, token string) {
+	if target.User != "" {
+		request.SetBasicAuth(target.User, token)
+	} else if token != "" {
+		request.Header.Add("Authorization", "Bearer "+token)
+	}
+}
@@ -0,0 +1,136 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package frontend
+
+import (
+	"encoding/json"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/plugin"
+	"net/http"
+	"net/url"
+)
+
+// CatalogPlugin describes a source system of the frontend configuration, so that the GUI can render its form without knowing the plugin
+type CatalogPlugin struct {
+	Id         string         `json:"id"` // the pluginId of the requests
+	Name       string         `json:"name"`
+	Plugin     string         `json:"plugin"` // the plugin type (e.g., "github")
+	PluginName string         `json:"pluginName"`
+	Fields     []CatalogField `json:"fields"`          // in the order of the form
+	Oauth      *CatalogOauth  `json:"oauth,omitempty"` // the OAuth login of the plugin, when configured
+	Search     bool           `json:"search"`          // the repository names can be searched (/api/plugin/search)
+	Options    bool           `json:"options"`         // the options (e.g., the branches) can be listed (/api/plugin/options)
+	Public     bool           `json:"public"`          // the public repositories can be read without a token
+}
+
+// CatalogField is a field of the form, named after the field of the compare request it fills
+type CatalogField struct {
+	Name        string   `json:"name"` // "sourceUrl", "user", "token", "repoName" or "option"
+	Label       string   `json:"label,omitempty"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Value       string   `json:"value,omitempty"`  // the fixed value of a hidden field (e.g., the URL of GitHub)
+	Values      []string `json:"values,omitempty"` // the values to choose from
+	Hidden      bool     `json:"hidden,omitempty"`
+	Editable    bool     `json:"editable,omitempty"`    // a value can be typed, also when it can be chosen
+	Interactive bool     `json:"interactive,omitempty"` // the options are browsed level by level (e.g., the folders)
+	Required    bool     `json:"required"`
+}
+
+type CatalogOauth struct {
+	AuthorizeUrl string `json:"authorizeUrl"` // with the client id, the redirect URI and the response type, the GUI adds the state
+	TokenName    string `json:"tokenName,omitempty"`
+}
+
+// PluginCatalog returns the source systems of the frontend configuration implemented by the backend: a source system added to the
+// frontend configuration is shown by the GUI after a restart, without rebuilding the GUI
+func PluginCatalog(w http.ResponseWriter, r *http.Request) {
+	res := []CatalogPlugin{}
+	for _, p := range Config.Plugins {
+		if !plugin.IsRegistered(p.Plugin) {
+			continue
+		}
+		res = append(res, catalogPlugin(p))
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+func catalogPlugin(p config.RepoPlugin) CatalogPlugin {
+	impl := plugin.GetPlugin(p.Plugin)
+	res := CatalogPlugin{
+		Id:         p.Id,
+		Name:       p.Name,
+		Plugin:     p.Plugin,
+		PluginName: p.PluginName,
+		Fields:     []CatalogField{},
+		Search:     impl.Search != nil && p.RepoNameFieldHasSearch,
+		Options:    impl.Options != nil,
+		Public:     impl.Public,
+	}
+	if p.TokenGetter.Url != "" && p.TokenGetter.OauthClientId != "" {
+		res.Oauth = &CatalogOauth{AuthorizeUrl: authorizeUrl(p.TokenGetter), TokenName: p.TokenName}
+	}
+	if p.SourceUrlFieldName != "" || p.SourceUrlFieldValue != "" {
+		res.Fields = append(res.Fields, CatalogField{
+			Name:        "sourceUrl",
+			Label:       p.SourceUrlFieldName,
+			Placeholder: p.SourceUrlFieldPlaceholder,
+			Value:       p.SourceUrlFieldValue,
+			Hidden:      p.SourceUrlFieldName == "",
+			Required:    true,
+		})
+	}
+	if p.UsernameFieldName != "" {
+		res.Fields = append(res.Fields, CatalogField{Name: "user", Label: p.UsernameFieldName, Placeholder: p.UsernameFieldPlaceholder, Required: true})
+	}
+	if p.TokenFieldName != "" {
+		res.Fields = append(res.Fields, CatalogField{
+			Name:        "token",
+			Label:       p.TokenFieldName,
+			Placeholder: p.TokenFieldPlaceholder,
+			// the OAuth login replaces the token
+			Required: res.Oauth == nil && !impl.Public,
+		})
+	}
+	if p.RepoNameFieldName != "" || len(p.RepoNameFieldValues) > 0 {
+		res.Fields = append(res.Fields, CatalogField{
+			Name:        "repoName",
+			Label:       p.RepoNameFieldName,
+			Placeholder: p.RepoNameFieldPlaceholder,
+			Values:      p.RepoNameFieldValues,
+			Editable:    p.RepoNameFieldEditable || len(p.RepoNameFieldValues) == 0,
+			Required:    !p.ParseSourceUrlField, // otherwise parsed from the source URL
+		})
+	}
+	if p.OptionFieldName != "" {
+		res.Fields = append(res.Fields, CatalogField{
+			Name:        "option",
+			Label:       p.OptionFieldName,
+			Placeholder: p.OptionPlaceholder,
+			Interactive: p.OptionFieldInteractive,
+			Required:    !p.OptionFieldInteractive,
+		})
+	}
+	return res
+}
+
+// authorizeUrl adds the OAuth parameters to the configured authorize URL (which can already have parameters, e.g., the scope)
+func authorizeUrl(getter config.TokenGetter) string {
+	u, err := url.Parse(getter.Url)
+	if err != nil {
+		return getter.Url
+	}
+	q := u.Query()
+	q.Set("client_id", getter.OauthClientId)
+	q.Set("response_type", "code")
+	if Config.RedirectUri != "" {
+		q.Set("redirect_uri", Config.RedirectUri)
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
@@ -6,6 +6,7 @@ import (
 	_ "embed"
 	"encoding/json"
 	"fmt"
+	"integration/app/common"
 	"integration/app/config"
 	"integration/app/core"
 	"integration/app/logging"
@@ -24,7 +25,7 @@ func init() {
 	configFile := os.Getenv("FRONTEND_CONFIG_FILE")
 	b, err := os.ReadFile(configFile)
 	if err == nil {
-		logging.Logger.Printf("using frontend configuration from %v\n", configFile)
+		logging.Logger.Info("using frontend configuration", "file", configFile)
 		configBytes = b
 	}
 	err = json.Unmarshal(configBytes, &Config)
@@ -34,21 +35,23 @@ func init() {
 	for _, v := range Config.Plugins {
 		core.PluginConfig[v.Id] = v
 	}
+	if Config.Orcid != nil {
+		core.PluginConfig[core.OrcidPluginId] = config.RepoPlugin{Id: core.OrcidPluginId, Name: "ORCID", TokenGetter: *Config.Orcid}
+	}
 	core.RedirectUri = Config.RedirectUri
 }
 
 func GetConfig(w http.ResponseWriter, r *http.Request) {
 	if Config.ExternalURL == "" {
 		Config.ExternalURL = config.GetExternalDestinationURL()
-		logging.Logger.Println(Config.ExternalURL)
+		logging.Logger.InfoContext(r.Context(), "external destination url", "url", Config.ExternalURL)
 		if strings.Contains(Config.ExternalURL, "kuleuven") {
 			Config.CollectionOptionsHidden = true
 		}
 	}
 	b, err := json.Marshal(Config)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		common.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
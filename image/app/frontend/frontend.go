@@ -4,8 +4,16 @@ package frontend
 
 import (
 	"embed"
+	"integration/app/config"
+	"integration/app/logging"
+	"io"
+	"io/fs"
 	"net/http"
+	"os"
+	"path"
+	"regexp"
 	"strings"
+	"sync"
 )
 
 // content is our static web server content.
@@ -13,14 +21,69 @@ import (
 //go:embed all:dist/datasync
 var content embed.FS
 
-var fs http.Handler = http.FileServer(http.FS(content))
+var (
+	assetsOnce sync.Once
+	assets     fs.FS
+)
+
+// the file names of the builds with the content hash (e.g., main.0123456789abcdef.js or main-ABCD1234.js) never change content
+var hashedName = regexp.MustCompile(`(\.[0-9a-f]{16,}|-[0-9A-Z]{8})\.[a-z0-9]+$`)
 
-func init() {}
+// frontendAssets returns the assets of the frontendDir option, or the assets embedded in the binary
+func frontendAssets() fs.FS {
+	assetsOnce.Do(func() {
+		if dir := config.GetConfig().Options.FrontendDir; dir != "" {
+			logging.Logger.Info("serving the frontend from disk", "dir", dir)
+			assets = os.DirFS(dir)
+			return
+		}
+		assets, _ = fs.Sub(content, "dist/datasync")
+	})
+	return assets
+}
 
+// Frontend serves the assets of the GUI, the other paths (the routes of the single page application, e.g., /connect) get the index.html
 func Frontend(w http.ResponseWriter, r *http.Request) {
-	if strings.HasPrefix(r.URL.Path, "/connect") || strings.HasPrefix(r.URL.Path, "/connect/") || r.URL.Path == "" {
-		r.URL.Path = "/"
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	if info, err := fs.Stat(frontendAssets(), name); err != nil || info.IsDir() {
+		if path.Ext(name) != "" {
+			// a missing asset, not a route
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+	}
+	serveAsset(w, r, name)
+}
+
+func serveAsset(w http.ResponseWriter, r *http.Request, name string) {
+	f, err := frontendAssets().Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	seeker, ok := f.(io.ReadSeeker)
+	if err != nil || !ok {
+		http.Error(w, "the file can not be served", http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case name == "index.html":
+		// always revalidated: it references the assets of the current build
+		w.Header().Set("Cache-Control", "no-cache")
+	case hashedName.MatchString(name):
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	default:
+		w.Header().Set("Cache-Control", "public, max-age=3600")
 	}
-	r.URL.Path = "/dist/datasync" + r.URL.Path
-	fs.ServeHTTP(w, r)
+	http.ServeContent(w, r, path.Base(name), info.ModTime(), seeker)
 }
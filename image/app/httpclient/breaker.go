@@ -0,0 +1,146 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package httpclient
+
+import (
+	"errors"
+	"integration/app/config"
+	"integration/app/logging"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerPause     = 30 // seconds
+)
+
+// ErrCircuitOpen is returned without calling the server while its circuit breaker is open, the server is considered down (e.g.,
+// during a maintenance window)
+var ErrCircuitOpen = errors.New("circuit breaker open: the server is unavailable")
+
+// IsCircuitOpen tells whether the error was caused by an open circuit breaker, also when it was only kept as a message
+func IsCircuitOpen(err error) bool {
+	return err != nil && (errors.Is(err, ErrCircuitOpen) || strings.Contains(err.Error(), ErrCircuitOpen.Error()))
+}
+
+// breaker counts the consecutive failed requests to a host: after threshold failures, the requests fail at once for the pause,
+// then one request is let through to probe the host, closing the breaker when it succeeds
+type breaker struct {
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+var breakers = map[string]*breaker{} // by host, shared by the clients of all destinations
+var breakersMu sync.Mutex
+
+func breakerOf(host string) *breaker {
+	breakersMu.Lock()
+	defer breakersMu.Unlock()
+	b, ok := breakers[host]
+	if !ok {
+		b = &breaker{}
+		breakers[host] = b
+	}
+	return b
+}
+
+// Available tells whether the requests to the host of the URL are let through, i.e., its circuit breaker is not open
+func Available(rawUrl string) bool {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return true
+	}
+	b := breakerOf(u.Host)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return !time.Now().Before(b.openUntil)
+}
+
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openUntil.IsZero() {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release ends the probe that tells nothing about the server (e.g., cancelled by the caller)
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) record(host string, failed bool, threshold int, pause time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	wasOpen := !b.openUntil.IsZero()
+	b.probing = false
+	if !failed {
+		if wasOpen {
+			logging.Logger.Info("circuit breaker closed, the server is available again", "host", host)
+		}
+		b.failures, b.openUntil = 0, time.Time{}
+		return
+	}
+	b.failures++
+	if b.failures >= threshold {
+		if !wasOpen {
+			logging.Logger.Warn("circuit breaker opened, the server is unavailable", "host", host, "failures", b.failures, "pause", pause.String())
+		}
+		b.openUntil = time.Now().Add(pause)
+	}
+}
+
+type breakerTransport struct {
+	threshold int
+	pause     time.Duration
+	next      http.RoundTripper
+}
+
+func newBreakerTransport(o config.HttpClient, next http.RoundTripper) http.RoundTripper {
+	if o.BreakerThreshold < 0 {
+		return next
+	}
+	return &breakerTransport{o.BreakerThreshold, time.Duration(o.BreakerPause) * time.Second, next}
+}
+
+// failed: the server could not be reached or answered that it is unavailable, after the retries
+func failed(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func (t *breakerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	b := breakerOf(r.URL.Host)
+	if !b.allow() {
+		if r.Body != nil {
+			r.Body.Close()
+		}
+		return nil, ErrCircuitOpen
+	}
+	resp, err := t.next.RoundTrip(r)
+	if err != nil && r.Context().Err() != nil {
+		b.release()
+		return resp, err
+	}
+	b.record(r.URL.Host, failed(resp, err), t.threshold, t.pause)
+	return resp, err
+}
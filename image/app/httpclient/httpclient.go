@@ -0,0 +1,112 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+// Package httpclient provides the outbound HTTP clients, configured per destination (e.g., "dataverse", "github", "gitlab" or "s3")
+package httpclient
+
+import (
+	"integration/app/config"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxRetries   = 3
+	defaultRetryBackoff = 1000 // milliseconds
+)
+
+var clients = map[string]*http.Client{}
+var mu sync.Mutex
+
+// Options returns the configuration of the destination, the fields that are not set are taken from the "default" configuration
+func Options(destination string) config.HttpClient {
+	all := config.GetConfig().Options.HttpClients
+	res, d := all[destination], all["default"]
+	if res.Timeout == 0 {
+		res.Timeout = d.Timeout
+	}
+	if res.ResponseHeaderTimeout == 0 {
+		res.ResponseHeaderTimeout = d.ResponseHeaderTimeout
+	}
+	if res.Proxy == "" {
+		res.Proxy = d.Proxy
+	}
+	if res.MaxIdleConnsPerHost == 0 {
+		res.MaxIdleConnsPerHost = d.MaxIdleConnsPerHost
+	}
+	if res.IdleConnTimeout == 0 {
+		res.IdleConnTimeout = d.IdleConnTimeout
+	}
+	if res.MaxRetries == 0 {
+		res.MaxRetries = d.MaxRetries
+	}
+	if res.MaxRetries == 0 {
+		res.MaxRetries = defaultMaxRetries
+	}
+	if res.RetryBackoff == 0 {
+		res.RetryBackoff = d.RetryBackoff
+	}
+	if res.RetryBackoff <= 0 {
+		res.RetryBackoff = defaultRetryBackoff
+	}
+	if res.BreakerThreshold == 0 {
+		res.BreakerThreshold = d.BreakerThreshold
+	}
+	if res.BreakerThreshold == 0 {
+		res.BreakerThreshold = defaultBreakerThreshold
+	}
+	if res.BreakerPause <= 0 {
+		res.BreakerPause = d.BreakerPause
+	}
+	if res.BreakerPause <= 0 {
+		res.BreakerPause = defaultBreakerPause
+	}
+	return res
+}
+
+// Get returns the shared client of the destination, with retries on 429 and 5xx responses and a circuit breaker per host
+func Get(destination string) *http.Client {
+	mu.Lock()
+	defer mu.Unlock()
+	if c, ok := clients[destination]; ok {
+		return c
+	}
+	o := Options(destination)
+	c := &http.Client{
+		Transport: newBreakerTransport(o, newRetryTransport(o, NewTransport(destination))),
+		Timeout:   config.LockMaxDuration, // the streams of large files can take very long, use the response header timeout instead
+	}
+	if o.Timeout > 0 {
+		c.Timeout = time.Duration(o.Timeout) * time.Second
+	}
+	clients[destination] = c
+	return c
+}
+
+// Dataverse returns the shared client of the Dataverse API, see SetDataverseAsDestination: the Dataverse API library sends its
+// requests with http.DefaultClient, which is replaced with this client when Dataverse is the destination
+func Dataverse() *http.Client {
+	return Get("dataverse")
+}
+
+// NewTransport returns a transport without retries, e.g., for the SDKs with their own retry logic (S3)
+func NewTransport(destination string) http.RoundTripper {
+	o := Options(destination)
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	if o.Proxy != "" {
+		if proxy, err := url.Parse(o.Proxy); err == nil {
+			t.Proxy = http.ProxyURL(proxy)
+		}
+	}
+	if o.MaxIdleConnsPerHost > 0 {
+		t.MaxIdleConnsPerHost = o.MaxIdleConnsPerHost
+	}
+	if o.IdleConnTimeout > 0 {
+		t.IdleConnTimeout = time.Duration(o.IdleConnTimeout) * time.Second
+	}
+	if o.ResponseHeaderTimeout > 0 {
+		t.ResponseHeaderTimeout = time.Duration(o.ResponseHeaderTimeout) * time.Second
+	}
+	return config.NewTLSTransport(t)
+}
@@ -0,0 +1,88 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package httpclient
+
+import (
+	"integration/app/config"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const maxBackoff = 60 * time.Second
+
+type retryTransport struct {
+	maxRetries int
+	backoff    time.Duration
+	next       http.RoundTripper
+}
+
+func newRetryTransport(o config.HttpClient, next http.RoundTripper) http.RoundTripper {
+	if o.MaxRetries < 0 {
+		return next
+	}
+	return &retryTransport{o.MaxRetries, time.Duration(o.RetryBackoff) * time.Millisecond, next}
+}
+
+// idempotent: the request can be sent again, by its method or because it is marked with an Idempotency-Key header
+func idempotent(r *http.Request) bool {
+	switch r.Method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return r.Header.Get("Idempotency-Key") != ""
+}
+
+// retryable: 429 means that the request was not processed, other failures (a 503 can come from a proxy after the request was
+// processed) are only retried for idempotent requests
+func retryable(r *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		return r.Context().Err() == nil && idempotent(r)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests:
+		return true
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(r)
+	}
+	return false
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := t.next.RoundTrip(r)
+		// requests with a streamed body can't be sent again
+		replayable := r.Body == nil || r.Body == http.NoBody || r.GetBody != nil
+		if attempt >= t.maxRetries || !replayable || !retryable(r, resp, err) {
+			return resp, err
+		}
+		// jittered, so that the clients waiting for the same server do not retry at once
+		wait := t.backoff << attempt
+		wait = wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+		if resp != nil {
+			if s, parseErr := strconv.Atoi(resp.Header.Get("Retry-After")); parseErr == nil {
+				wait = time.Duration(s) * time.Second
+			}
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+		if wait > maxBackoff {
+			wait = maxBackoff
+		}
+		select {
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		case <-time.After(wait):
+		}
+		if r.GetBody != nil {
+			body, err := r.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			r = r.Clone(r.Context())
+			r.Body = body
+		}
+	}
+}
@@ -3,7 +3,6 @@
 package main
 
 import (
-	"context"
 	"flag"
 	"fmt"
 	"integration/app/config"
@@ -13,21 +12,19 @@ import (
 	"integration/app/logging"
 	"integration/app/server"
 	"integration/app/workers/spinner"
+	"os"
 	"os/exec"
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
-
-	"github.com/redis/go-redis/v9"
 )
 
 var (
 	DataverseServer     string
 	DataverseServerName string
 	RootDataverseId     string
-	DefaultHash         string = "MD5"
+	DefaultHash         string
 	MyDataRoleIds       string = "1,6,7"
 	MaxFileSize         string = "21474836480"
 )
@@ -36,14 +33,15 @@ var (
 	serverUrl   = flag.String("server", DataverseServer, "URL to the Dataverse server")
 	serverName  = flag.String("servername", DataverseServerName, "Dataverse server display name")
 	dvID        = flag.String("dvID", RootDataverseId, "Root Dataverse ID")
-	hashAlg     = flag.String("hash", DefaultHash, "Default hashing algorithm in Dataverse: MD5, SHA-1")
+	hashAlg     = flag.String("hash", DefaultHash, "Default hashing algorithm in Dataverse: MD5, SHA-1, SHA-256 or SHA-512 (default: the :FileFixityChecksumAlgorithm setting of Dataverse)")
 	roleIDs     = flag.String("roleIDs", MyDataRoleIds, "My data query role IDs: comma separated ints")
 	maxFileSize = flag.String("maxFileSize", MaxFileSize, "Maximum file size in bytes for upload.")
+	insecure    = flag.Bool("insecure", false, "Do not verify the TLS certificates (e.g., of self-signed test servers)")
 )
 
 func main() {
 	destination.SetDataverseAsDestination()
-	logging.Logger.Println("execute with -h to see the list of possible arguments")
+	logging.Logger.Info("execute with -h to see the list of possible arguments")
 	flag.Parse()
 	DataverseServer = *serverUrl
 	DataverseServerName = *serverName
@@ -61,6 +59,9 @@ func main() {
 	}
 	MaxFileSize = *maxFileSize
 	mfs, _ := strconv.Atoi(MaxFileSize)
+	if *insecure {
+		config.SetInsecure()
+	}
 	config.SetConfig(DataverseServer, RootDataverseId, DefaultHash, roles, true, int64(mfs))
 	dataverse.Init()
 	frontend.Config.DataverseHeader = DataverseServerName
@@ -73,7 +74,7 @@ func main() {
 		SourceUrlFieldPlaceholder: "Path to a directory on your filesystem",
 	}}, frontend.Config.Plugins...)
 	go server.Start()
-	fr := newFakeRedis()
+	fr := config.NewMemoryClient()
 	config.SetRedis(fr)
 	openbrowser("http://localhost:7788/")
 
@@ -85,7 +86,7 @@ func main() {
 			case <-done:
 				return
 			case <-ticker.C:
-				fr.cleanupExpired()
+				fr.CleanupExpired()
 			}
 		}
 	}()
@@ -109,132 +110,7 @@ func openbrowser(url string) {
 		err = fmt.Errorf("unsupported platform")
 	}
 	if err != nil {
-		logging.Logger.Fatal(err)
-	}
-}
-
-type fakeRedis struct {
-	sync.Mutex
-	values      map[string]string
-	expirations map[string]time.Time
-	valueSlices map[string][]string
-}
-
-func newFakeRedis() *fakeRedis {
-	f := fakeRedis{
-		values:      make(map[string]string),
-		expirations: make(map[string]time.Time),
-		valueSlices: make(map[string][]string),
-	}
-	return &f
-}
-
-func (f *fakeRedis) Ping(ctx context.Context) *redis.StatusCmd {
-	cmd := redis.NewStatusCmd(ctx)
-	cmd.SetVal("PONG")
-	return cmd
-}
-
-func (f *fakeRedis) Get(ctx context.Context, key string) *redis.StringCmd {
-	f.Lock()
-	defer f.Unlock()
-	v := f.values[key]
-	exp, ok := f.expirations[key]
-	if ok && exp.Before(time.Now()) {
-		v = ""
-		delete(f.values, key)
-		delete(f.expirations, key)
-	}
-	cmd := redis.NewStringCmd(ctx)
-	cmd.SetVal(v)
-	return cmd
-}
-
-func (f *fakeRedis) Set(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.StatusCmd {
-	f.Lock()
-	defer f.Unlock()
-	f.values[key] = fmt.Sprintf("%v", value)
-	if expiration > 0 {
-		f.expirations[key] = time.Now().Add(expiration)
-	} else {
-		delete(f.expirations, key)
-	}
-	cmd := redis.NewStatusCmd(ctx)
-	cmd.SetVal("OK")
-	return cmd
-}
-
-// set if Not eXists
-func (f *fakeRedis) SetNX(ctx context.Context, key string, value interface{}, expiration time.Duration) *redis.BoolCmd {
-	f.Lock()
-	defer f.Unlock()
-	cmd := redis.NewBoolCmd(ctx)
-	_, ok := f.values[key]
-	if ok {
-		exp, ok2 := f.expirations[key]
-		if !ok2 || exp.After(time.Now()) {
-			cmd.SetVal(false)
-			return cmd
-		}
-	}
-	f.values[key] = fmt.Sprintf("%v", value)
-	if expiration > 0 {
-		f.expirations[key] = time.Now().Add(expiration)
-	} else {
-		delete(f.expirations, key)
-	}
-	cmd.SetVal(true)
-	return cmd
-}
-
-func (f *fakeRedis) Del(ctx context.Context, keys ...string) *redis.IntCmd {
-	f.Lock()
-	defer f.Unlock()
-	for _, key := range keys {
-		delete(f.values, key)
-		delete(f.expirations, key)
-	}
-	cmd := redis.NewIntCmd(ctx)
-	cmd.SetVal(int64(len(keys)))
-	return cmd
-}
-
-func (f *fakeRedis) LPush(ctx context.Context, key string, values ...interface{}) *redis.IntCmd {
-	f.Lock()
-	defer f.Unlock()
-	newValues := []string{}
-	for _, v := range values {
-		newValues = append(newValues, fmt.Sprintf("%v", v))
-	}
-	f.valueSlices[key] = append(newValues, f.valueSlices[key]...)
-	cmd := redis.NewIntCmd(ctx)
-	cmd.SetVal(int64(len(key)))
-	return cmd
-}
-
-func (f *fakeRedis) RPop(ctx context.Context, key string) *redis.StringCmd {
-	f.Lock()
-	defer f.Unlock()
-	l := len(f.valueSlices[key])
-	if l == 0 {
-		res := redis.NewStringCmd(ctx)
-		res.SetErr(fmt.Errorf("queue is empty"))
-		return res
-	}
-	v := f.valueSlices[key][l-1]
-	f.valueSlices[key] = f.valueSlices[key][:l-1]
-	cmd := redis.NewStringCmd(ctx)
-	cmd.SetVal(v)
-	return cmd
-}
-
-func (f *fakeRedis) cleanupExpired() {
-	f.Lock()
-	defer f.Unlock()
-	for k, v := range f.expirations {
-		if v.Before(time.Now()) {
-			delete(f.expirations, k)
-			delete(f.values, k)
-		}
+		logging.Logger.Error("opening browser failed", "error", err)
+		os.Exit(1)
 	}
 }
@@ -2,6 +2,105 @@
 
 package logging
 
-import "log"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
 
-var Logger = log.Default()
+	"github.com/google/uuid"
+)
+
+// Logger is the structured logger of the application, configured with the environment variables:
+// LOG_FORMAT ("text" by default or "json") and LOG_LEVEL ("debug", "info" by default, "warn" or "error"),
+// the level can also be set with the "logLevel" option of the backend configuration.
+// Use the *Context variants (e.g., Logger.InfoContext) to include the correlation id of the request or job.
+var Logger = slog.New(correlationHandler{newHandler()})
+
+func init() {
+	// the log package (e.g., used by the libraries) writes through the same handler
+	slog.SetDefault(Logger)
+}
+
+// level can be changed at runtime, see SetLevel
+var level = new(slog.LevelVar)
+
+func newHandler() slog.Handler {
+	if err := SetLevel(os.Getenv("LOG_LEVEL")); err != nil {
+		level.Set(slog.LevelInfo)
+	}
+	opts := &slog.HandlerOptions{Level: level}
+	if strings.ToLower(os.Getenv("LOG_FORMAT")) == "json" {
+		return slog.NewJSONHandler(os.Stderr, opts)
+	}
+	return slog.NewTextHandler(os.Stderr, opts)
+}
+
+// SetLevel sets the minimal level of the logged records: "debug", "info" (also when empty), "warn" or "error"
+func SetLevel(name string) error {
+	l, ok := parseLevel(name)
+	if !ok {
+		return fmt.Errorf("unknown log level: %v", name)
+	}
+	level.Set(l)
+	return nil
+}
+
+func ValidLevel(name string) bool {
+	_, ok := parseLevel(name)
+	return ok
+}
+
+func parseLevel(name string) (slog.Level, bool) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, true
+	case "", "info":
+		return slog.LevelInfo, true
+	case "warn", "warning":
+		return slog.LevelWarn, true
+	case "error":
+		return slog.LevelError, true
+	}
+	return slog.LevelInfo, false
+}
+
+type correlationIdKey struct{}
+
+func NewCorrelationId() string {
+	return uuid.NewString()
+}
+
+// WithCorrelationId returns a context whose log lines carry the correlation id
+func WithCorrelationId(ctx context.Context, id string) context.Context {
+	if id == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, correlationIdKey{}, id)
+}
+
+func CorrelationId(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIdKey{}).(string)
+	return id
+}
+
+// correlationHandler adds the correlation id from the context to each record
+type correlationHandler struct {
+	slog.Handler
+}
+
+func (h correlationHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := CorrelationId(ctx); id != "" {
+		r.AddAttrs(slog.String("correlationId", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h correlationHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return correlationHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h correlationHandler) WithGroup(name string) slog.Handler {
+	return correlationHandler{h.Handler.WithGroup(name)}
+}
@@ -3,7 +3,10 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"integration/app/config"
+	"integration/app/core"
 	"integration/app/destination"
 	"integration/app/logging"
 	"integration/app/server"
@@ -13,22 +16,51 @@ import (
 )
 
 func main() {
+	worker := flag.Bool("worker", false, "run the workers only, without the HTTP server (as the workers command)")
+	labels := flag.String("labels", os.Getenv("WORKER_LABELS"), "comma separated labels of the workers, see the jobRouting option")
+	flag.Parse()
+	if err := config.Validate(); err != nil {
+		logging.Logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+	destination.SetDataverseAsDestination()
 	// spin workers if required (otherwise the workers are run independetly, see also workers/main.go)
 	numberWorkers := 0
 	var err error
-	if len(os.Args) > 1 {
-		numberWorkers, err = strconv.Atoi(os.Args[1])
+	if flag.NArg() > 0 {
+		numberWorkers, err = strconv.Atoi(flag.Arg(0))
 		if err != nil {
-			panic(fmt.Errorf("failed to parse number of workers from %v: %v", numberWorkers, err))
+			panic(fmt.Errorf("failed to parse number of workers from %v: %v", flag.Arg(0), err))
 		}
 	}
-	if numberWorkers > 0 {
-		destination.SetDataverseAsDestination()
-		logging.Logger.Println("nuber workers:", numberWorkers)
-		go server.Start()
+	if *worker {
+		if numberWorkers <= 0 {
+			numberWorkers = 200
+		}
+		if config.GetConfig().Options.Backend == "memory" {
+			logging.Logger.Warn("the in-memory backend is not shared with the HTTP server, no jobs will be queued for these workers")
+		}
+		core.SetWorkerLabels(spinner.ParseLabels(*labels))
+		logging.Logger.Info("spinning workers only", "workers", numberWorkers, "labels", *labels)
+		spinner.SpinWorkers(numberWorkers)
+	} else if numberWorkers > 0 {
+		core.SetWorkerLabels(spinner.ParseLabels(*labels))
+		logging.Logger.Info("spinning workers", "workers", numberWorkers, "labels", *labels)
+		core.Wait.Add(1)
+		go func() {
+			defer core.Wait.Done()
+			server.Start()
+		}()
 		spinner.SpinWorkers(numberWorkers)
 	} else {
-		logging.Logger.Println("http server only")
+		logging.Logger.Info("http server only")
+		if config.GetConfig().Options.Backend == "memory" {
+			logging.Logger.Warn("the in-memory backend requires workers in the same process, the jobs will not be processed")
+		}
+		core.StopOnSignal()
+		// the finished jobs are archived by the workers of other instances, the server exports them as well
+		core.Wait.Add(1)
+		go core.ExportJobArchive()
 		server.Start()
 	}
 }
@@ -0,0 +1,144 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package openapi
+
+import (
+	"integration/app/common"
+	"reflect"
+	"strings"
+	"time"
+)
+
+type object = map[string]interface{}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// Document returns the OpenAPI 3 document of the API, the schemas are generated from the Go types of the requests and responses
+func Document(version string) object {
+	schemas := object{}
+	paths := object{}
+	errorSchema := schemaRef(reflect.TypeOf(common.ApiError{}), schemas)
+	for _, e := range Endpoints {
+		operation := object{
+			"operationId": e.Name,
+			"tags":        []string{e.Tag},
+			"summary":     e.Summary,
+		}
+		if e.Request != nil {
+			operation["requestBody"] = object{
+				"required": true,
+				"content":  object{"application/json": object{"schema": schemaRef(reflect.TypeOf(e.Request), schemas)}},
+			}
+		}
+		if len(e.Query) > 0 {
+			parameters := []object{}
+			for _, q := range e.Query {
+				parameters = append(parameters, object{"name": q, "in": "query", "schema": object{"type": "string"}})
+			}
+			operation["parameters"] = parameters
+		}
+		ok := object{"description": "OK"}
+		if e.Stream {
+			ok["content"] = object{"text/event-stream": object{"schema": schemaRef(reflect.TypeOf(e.Response), schemas)}}
+		} else if e.Binary != "" {
+			ok["content"] = object{e.Binary: object{"schema": object{"type": "string", "format": "binary"}}}
+		} else if e.Response != nil {
+			ok["content"] = object{"application/json": object{"schema": schemaRef(reflect.TypeOf(e.Response), schemas)}}
+		} else {
+			ok["content"] = object{"text/plain": object{"schema": object{"type": "string"}}}
+		}
+		operation["responses"] = object{
+			"200":     ok,
+			"default": object{"description": "error, see the code of the error", "content": object{"application/json": object{"schema": errorSchema}}},
+		}
+		paths[e.Path] = object{strings.ToLower(e.method()): operation}
+	}
+	return object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       "RDM integration API",
+			"description": "API of the synchronization of the repositories (GitHub, GitLab, iRODS, etc.) with the Dataverse datasets",
+			"version":     version,
+		},
+		"paths": paths,
+		"components": object{
+			"schemas": schemas,
+			"securitySchemes": object{
+				"apiKey":  object{"type": "apiKey", "in": "header", "name": "Authorization", "description": "service API key: \"ApiKey rdmk_...\""},
+				"bearer":  object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"session": object{"type": "apiKey", "in": "cookie", "name": "rdm_session"},
+			},
+		},
+		"security": []object{{"apiKey": []string{}}, {"bearer": []string{}}, {"session": []string{}}},
+	}
+}
+
+// SchemaName is the name of the schema of a named Go type, e.g., "common.StoreRequest"
+func SchemaName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	return pkg[strings.LastIndex(pkg, "/")+1:] + "." + t.Name()
+}
+
+// schemaRef returns the schema of the type, the structs are added to the schemas and referenced
+func schemaRef(t reflect.Type, schemas object) object {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+		return object{"type": "array", "items": schemaRef(t.Elem(), schemas)}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": schemaRef(t.Elem(), schemas)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return structSchema(t, schemas)
+		}
+		name := SchemaName(t)
+		if _, ok := schemas[name]; !ok {
+			schemas[name] = object{} // placeholder for the recursive types
+			schemas[name] = structSchema(t, schemas)
+		}
+		return object{"$ref": "#/components/schemas/" + name}
+	}
+	return object{} // any value (interface{})
+}
+
+func structSchema(t reflect.Type, schemas object) object {
+	properties := object{}
+	addProperties(t, properties, schemas)
+	return object{"type": "object", "properties": properties}
+}
+
+func addProperties(t reflect.Type, properties, schemas object) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() || f.Type.Kind() == reflect.Func || f.Type.Kind() == reflect.Chan {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addProperties(f.Type, properties, schemas) // the fields of the embedded structs are inlined
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = schemaRef(f.Type, schemas)
+	}
+}
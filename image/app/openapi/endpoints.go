@@ -0,0 +1,110 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package openapi
+
+import (
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/frontend"
+	"integration/app/plugin/funcs/compare"
+	"integration/app/plugin/funcs/estimate"
+	"integration/app/plugin/types"
+)
+
+// Endpoint describes an API call, for the OpenAPI document and the generated client (see the client package)
+type Endpoint struct {
+	Path     string
+	Method   string // "POST" when not set
+	Name     string // operation id, also the name of the method of the generated client
+	Tag      string
+	Summary  string
+	Request  interface{} // zero value of the request body, nil when the call has no body
+	Response interface{} // zero value of the response body, nil when the call responds with a plain text "OK"
+	NoClient bool        // browser only calls (e.g., redirects), not in the generated client
+	Query    []string    // names of the (optional) query parameters
+	Stream   bool        // Server-Sent Events: the response is a stream of the Response events
+	Binary   string      // content type of a binary response (e.g., "application/zip" for the downloads)
+}
+
+func (e Endpoint) method() string {
+	if e.Method == "" {
+		return "POST"
+	}
+	return e.Method
+}
+
+// Endpoints lists the calls of the API, keep it in sync with the routes of the server
+var Endpoints = []Endpoint{
+	// plugin
+	{Path: "/api/plugin/compare", Name: "CompareRepository", Tag: "compare", Summary: "Starts the comparison of a repository with a dataset, poll the result with the returned key at /api/common/cached", Request: types.CompareRequest{}, Response: common.Key{}},
+	{Path: "/api/plugin/options", Name: "Options", Tag: "plugins", Summary: "Lists the options (e.g., branches or folders) of a repository", Request: types.OptionsRequest{}, Response: []types.SelectItem{}},
+	{Path: "/api/plugin/search", Name: "Search", Tag: "plugins", Summary: "Searches the repositories of the plugin", Request: types.OptionsRequest{}, Response: []types.SelectItem{}},
+	{Path: "/api/plugin/estimate", Name: "Estimate", Tag: "plugins", Summary: "Estimates the size of a repository before the comparison", Request: types.CompareRequest{}, Response: estimate.EstimateResponse{}},
+
+	// compare and store
+	{Path: "/api/plugin/batch", Name: "Batch", Tag: "jobs", Summary: "Syncs the same source (or its subfolders) with several datasets: the datasets are compared one by one and their store jobs are queued", Request: compare.BatchRequest{}, Response: compare.BatchResponse{}},
+	{Path: "/api/plugin/batchstatus", Name: "BatchStatus", Tag: "jobs", Summary: "Returns the status of the datasets of a batch, with the progress and the reports of their jobs", Request: compare.BatchStatusRequest{}, Response: compare.BatchStatus{}},
+	{Path: "/api/plugin/migrate", Name: "Migrate", Tag: "jobs", Summary: "Creates a dataset for each source (or folder) in its collection, with the metadata of the metadata file of the source, and syncs the files", Request: compare.MigrationRequest{}, Response: compare.BatchResponse{}},
+	{Path: "/api/plugin/migrationstatus", Name: "MigrationStatus", Tag: "jobs", Summary: "Returns the status of the rows of a migration, with the created datasets and the progress and the reports of their jobs", Request: compare.BatchStatusRequest{}, Response: compare.MigrationStatus{}},
+	{Path: "/api/plugin/schedule", Name: "Schedule", Tag: "jobs", Summary: "Repeats a batch every interval (in minutes), with the credentials of the request stored encrypted in the history database", Request: compare.ScheduleRequest{}, Response: core.Schedule{}},
+	{Path: "/api/plugin/schedules", Method: "GET", Name: "Schedules", Tag: "jobs", Summary: "Lists the schedules of the user, with the batch started by their last run", Response: compare.SchedulesResponse{}},
+	{Path: "/api/plugin/unschedule", Name: "Unschedule", Tag: "jobs", Summary: "Deletes the schedule of the user, with its credentials", Request: compare.ScheduleIdRequest{}},
+	{Path: "/api/common/compare", Name: "Compare", Tag: "compare", Summary: "Compares the given nodes with the dataset", Request: common.CompareRequest{}, Response: core.CompareResponse{}},
+	{Path: "/api/common/events", Method: "GET", Name: "Events", Tag: "compare", Summary: "Streams the progress events of a comparison (key) or of the jobs of a dataset (persistentId)", Query: []string{"key", "persistentId"}, Response: core.ProgressEvent{}, NoClient: true, Stream: true},
+	{Path: "/api/common/cached", Name: "CachedResponse", Tag: "compare", Summary: "Returns the result of a comparison started in the background when ready, optionally filtered, sorted and paged", Request: common.CachedRequest{}, Response: common.CachedResponse{}},
+	{Path: "/api/common/selection", Name: "Selection", Tag: "compare", Summary: "Changes (or returns) the persisted selection of the nodes of a comparison, stored by its key with /api/common/store", Request: common.SelectionRequest{}, Response: common.SelectionResponse{}},
+	{Path: "/api/common/store", Name: "Store", Tag: "jobs", Summary: "Starts the job writing the selected nodes to the dataset", Request: common.StoreRequest{}, Response: common.StoreResult{}},
+	{Path: "/api/common/newdataset", Name: "NewDataset", Tag: "datasets", Summary: "Creates a new dataset", Request: common.NewDatasetRequest{}, Response: common.NewDatasetResponse{}},
+	{Path: "/api/common/newdatasetcollections", Name: "DatasetCollections", Tag: "datasets", Summary: "Lists the collections where the user can create datasets, for choosing the collection of a new dataset", Request: common.DatasetCollectionsRequest{}, Response: []types.SelectItem{}},
+	{Path: "/api/common/dvobjects", Name: "DvObjects", Tag: "datasets", Summary: "Lists the collections or the datasets of the user", Request: common.DvObjectsRequest{}, Response: []types.SelectItem{}},
+	{Path: "/api/common/datasets", Name: "Datasets", Tag: "datasets", Summary: "Lists a page of the datasets where the user has a role (or a role allowing to edit), for the dataset picker", Request: common.DatasetsRequest{}, Response: core.DatasetPage{}},
+	{Path: "/api/common/collection", Name: "Collection", Tag: "datasets", Summary: "Lists the subcollections and the datasets of a collection, for browsing the collection tree", Request: common.CollectionRequest{}, Response: common.CollectionResponse{}},
+
+	// jobs
+	{Path: "/api/common/report", Name: "Report", Tag: "jobs", Summary: "Returns the report of the last (or running) job of the dataset", Request: common.ReportRequest{}, Response: common.ReportResponse{}},
+	{Path: "/api/common/archivedjobs", Name: "ArchivedJobs", Tag: "jobs", Summary: "Lists the archived jobs of the dataset", Request: common.ReportRequest{}, Response: common.ArchivedJobsResponse{}},
+	{Path: "/api/common/history", Name: "History", Tag: "jobs", Summary: "Lists the finished jobs of the dataset or the user", Request: common.HistoryRequest{}, Response: common.HistoryResponse{}},
+	{Path: "/api/common/fixity", Name: "Fixity", Tag: "jobs", Summary: "Starts the fixity verification of the dataset", Request: common.ReportRequest{}},
+	{Path: "/api/common/fixityreport", Name: "FixityReport", Tag: "jobs", Summary: "Returns the report of the last (or running) fixity verification of the dataset", Request: common.ReportRequest{}, Response: common.FixityResponse{}},
+	{Path: "/api/common/bag", Name: "Bag", Tag: "jobs", Summary: "Starts the export of the dataset version (or of the selected files) as a BagIt bag to the export storage", Request: common.BagRequest{}},
+	{Path: "/api/common/bagdownload", Name: "BagDownload", Tag: "jobs", Summary: "Streams the dataset version (or the selected files) as a BagIt bag (zip)", Request: common.BagRequest{}, NoClient: true, Binary: "application/zip"},
+	{Path: "/api/common/bagreport", Name: "BagReport", Tag: "jobs", Summary: "Returns the report of the last (or running) bag export of the dataset", Request: common.BagRequest{}, Response: common.BagResponse{}},
+	{Path: "/api/common/exporttargets", Method: "GET", Name: "ExportTargets", Tag: "jobs", Summary: "Lists the targets the dataset files can be exported to", Response: common.ExportTargetsResponse{}},
+	{Path: "/api/common/export", Name: "Export", Tag: "jobs", Summary: "Starts the export of the dataset version (or of the selected files) to a folder of an export target", Request: common.ExportRequest{}},
+	{Path: "/api/common/exportreport", Name: "ExportReport", Tag: "jobs", Summary: "Returns the report of the last export job of the dataset", Request: common.ExportRequest{}, Response: common.ExportReportResponse{}},
+	{Path: "/api/common/invalidatecache", Name: "InvalidateCache", Tag: "jobs", Summary: "Removes the cached hashes of the dataset", Request: common.ReportRequest{}},
+
+	// connections and user data
+	{Path: "/api/common/connections", Method: "GET", Name: "Connections", Tag: "connections", Summary: "Lists the repositories previously synchronized by the user", Response: common.ConnectionsResponse{}},
+	{Path: "/api/common/userdata", Method: "GET", Name: "UserData", Tag: "connections", Summary: "Lists the data stored for the user", Response: common.UserDataResponse{}},
+	{Path: "/api/common/revoke", Name: "RevokeUserData", Tag: "connections", Summary: "Deletes the requested (or all) data stored for the user", Request: common.RevokeRequest{}, Response: common.UserDataResponse{}},
+
+	// oauth and authentication
+	{Path: "/api/common/credential", Name: "Credential", Tag: "oauth", Summary: "Stores the Dataverse API key on the server and returns the reference sent instead of the key", Request: common.CredentialRequest{}, Response: common.CredentialResponse{}},
+	{Path: "/api/common/credential/provision", Name: "ProvisionedCredential", Tag: "oauth", Summary: "Looks up or (re)creates the Dataverse API token of the logged in user and returns the reference sent instead of the key", Request: common.ProvisionedCredentialRequest{}, Response: common.CredentialResponse{}},
+	{Path: "/api/common/oauthtoken", Name: "OauthToken", Tag: "oauth", Summary: "Exchanges the OAuth authorization code of a plugin for a token, kept by the server", Request: common.OauthTokenRequest{}, Response: core.TokenResponse{}},
+	{Path: "/api/auth/login", Method: "GET", Name: "Login", Tag: "oauth", Summary: "Redirects to the OIDC login", NoClient: true},
+	{Path: "/api/auth/callback", Method: "GET", Name: "LoginCallback", Tag: "oauth", Summary: "Completes the OIDC login", NoClient: true},
+	{Path: "/api/auth/logout", Name: "Logout", Tag: "oauth", Summary: "Revokes the session and its tokens (all sessions of the user with all=true)", NoClient: true},
+	{Path: "/api/auth/session", Name: "Session", Tag: "oauth", Summary: "Starts or updates the server side session with the Dataverse API key and the plugin tokens of the user", Request: common.SessionRequest{}, Response: common.SessionResponse{}},
+	{Path: "/api/auth/me", Method: "GET", Name: "Me", Tag: "oauth", Summary: "Returns the identity of the authenticated user", Response: core.Identity{}},
+
+	// admin
+	{Path: "/api/admin/adoptjob", Name: "AdoptJob", Tag: "admin", Summary: "Takes over the job of a dataset", Request: common.AdoptJobRequest{}},
+	{Path: "/api/admin/audit", Name: "Audit", Tag: "admin", Summary: "Returns the audit log", Request: common.AuditRequest{}, Response: common.AuditResponse{}},
+	{Path: "/api/admin/status", Name: "AdminStatus", Tag: "admin", Summary: "Returns the locks, the queues, the running jobs and the cached responses", Request: common.AdminRequest{}, Response: common.AdminStatusResponse{}},
+	{Path: "/api/admin/config", Name: "AdminConfig", Tag: "admin", Summary: "Returns the backend configuration with the secrets redacted", Request: common.AdminRequest{}, Response: map[string]interface{}{}},
+	{Path: "/api/admin/unlock", Name: "ForceUnlock", Tag: "admin", Summary: "Removes the lock of the dataset", Request: common.AdminRequest{}},
+	{Path: "/api/admin/flush", Name: "FlushCaches", Tag: "admin", Summary: "Removes the cached responses and hashes of the dataset (or of all datasets)", Request: common.AdminRequest{}},
+	{Path: "/api/admin/orphans", Name: "Orphans", Tag: "admin", Summary: "Reports (and optionally removes) the stored files that are not registered in Dataverse", Request: common.OrphansRequest{}, Response: common.OrphansResponse{}},
+	{Path: "/api/admin/apikeys", Name: "ApiKeys", Tag: "admin", Summary: "Lists the service API keys", Request: common.ApiKeyRequest{}, Response: []core.ServiceApiKey{}},
+	{Path: "/api/admin/apikeys/create", Name: "CreateApiKey", Tag: "admin", Summary: "Creates a service API key, the key is only returned once", Request: common.ApiKeyRequest{}, Response: common.ApiKeyResponse{}},
+	{Path: "/api/admin/apikeys/revoke", Name: "RevokeApiKey", Tag: "admin", Summary: "Revokes a service API key", Request: common.ApiKeyRequest{}},
+
+	// health and configuration
+	{Path: "/healthz", Method: "GET", Name: "Healthz", Tag: "health", Summary: "Reports that the process is up"},
+	{Path: "/readyz", Method: "GET", Name: "Readyz", Tag: "health", Summary: "Reports whether the application can serve requests and process jobs", Response: common.ReadinessResponse{}},
+	{Path: "/api/frontend/config", Method: "GET", Name: "FrontendConfig", Tag: "health", Summary: "Returns the configuration of the frontend", Response: config.Configuration{}},
+	{Path: "/api/frontend/plugins", Method: "GET", Name: "PluginCatalog", Tag: "health", Summary: "Returns the source systems of the frontend configuration with the fields of their forms and their OAuth login", Response: []frontend.CatalogPlugin{}},
+}
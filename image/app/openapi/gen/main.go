@@ -0,0 +1,97 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+// gen generates the methods of the Go client (client/client_gen.go) from the endpoints of the OpenAPI document
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"integration/app/openapi"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func main() {
+	output := flag.String("o", "client_gen.go", "output file")
+	flag.Parse()
+	imports := map[string]bool{"context": true}
+	body := bytes.Buffer{}
+	for _, e := range openapi.Endpoints {
+		if e.NoClient {
+			continue
+		}
+		method := e.Method
+		if method == "" {
+			method = "POST"
+		}
+		params := "ctx context.Context"
+		request := "nil"
+		if e.Request != nil {
+			params += ", req " + typeExpr(reflect.TypeOf(e.Request), imports)
+			request = "req"
+		}
+		fmt.Fprintf(&body, "\n// %v %v (%v %v)\n", e.Name, lowerFirst(e.Summary), method, e.Path)
+		if e.Response == nil {
+			fmt.Fprintf(&body, "func (c *Client) %v(%v) error {\n", e.Name, params)
+			fmt.Fprintf(&body, "\treturn c.call(ctx, %q, %q, %v, nil)\n}\n", method, e.Path, request)
+			continue
+		}
+		response := typeExpr(reflect.TypeOf(e.Response), imports)
+		fmt.Fprintf(&body, "func (c *Client) %v(%v) (%v, error) {\n", e.Name, params, response)
+		fmt.Fprintf(&body, "\tres := %v{}\n", response)
+		fmt.Fprintf(&body, "\terr := c.call(ctx, %q, %q, %v, &res)\n", method, e.Path, request)
+		fmt.Fprintf(&body, "\treturn res, err\n}\n")
+	}
+
+	paths := []string{}
+	for path := range imports {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	src := bytes.Buffer{}
+	src.WriteString("// Code generated by openapi/gen from the endpoints of the OpenAPI document; DO NOT EDIT.\n\npackage client\n\nimport (\n")
+	for _, path := range paths {
+		fmt.Fprintf(&src, "\t%q\n", path)
+	}
+	src.WriteString(")\n")
+	src.Write(body.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output, formatted, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// typeExpr returns the Go expression of the type, the packages of the named types are added to the imports
+func typeExpr(t reflect.Type, imports map[string]bool) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + typeExpr(t.Elem(), imports)
+	case reflect.Slice:
+		return "[]" + typeExpr(t.Elem(), imports)
+	case reflect.Map:
+		return "map[" + typeExpr(t.Key(), imports) + "]" + typeExpr(t.Elem(), imports)
+	case reflect.Interface:
+		return "interface{}"
+	}
+	if t.PkgPath() == "" {
+		return t.Name()
+	}
+	imports[t.PkgPath()] = true
+	return t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:] + "." + t.Name()
+}
+
+func lowerFirst(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	return string(unicode.ToLower(r)) + s[size:]
+}
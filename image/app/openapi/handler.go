@@ -0,0 +1,44 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package openapi
+
+import (
+	"encoding/json"
+	"integration/app/common"
+	"integration/app/config"
+	"net/http"
+)
+
+// Spec serves the OpenAPI document at /api/openapi.json
+func Spec(w http.ResponseWriter, r *http.Request) {
+	b, err := json.Marshal(Document(config.GetVersion()))
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// Docs serves the Swagger UI of the OpenAPI document at /api/docs, the UI itself is loaded from the CDN
+func Docs(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUi))
+}
+
+const swaggerUi = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>RDM integration API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => { window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" }); };
+  </script>
+</body>
+</html>
+`
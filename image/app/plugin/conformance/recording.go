@@ -0,0 +1,154 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package conformance
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// serverPlaceholder replaces the URL of the backend in the recorded responses (e.g., in the pagination links and the download URLs)
+const serverPlaceholder = "{{server}}"
+
+// Recording holds the responses of a backend by request ("GET /path?query"), the request bodies are not part of the key
+type Recording struct {
+	Responses map[string]RecordedResponse `json:"responses"`
+}
+
+type RecordedResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   string            `json:"body"`
+	Base64 bool              `json:"base64,omitempty"` // the body is base64 encoded (binary content)
+}
+
+func (res RecordedResponse) body(server string) []byte {
+	if res.Base64 {
+		b, _ := base64.StdEncoding.DecodeString(res.Body)
+		return b
+	}
+	return []byte(strings.ReplaceAll(res.Body, serverPlaceholder, server))
+}
+
+func requestKey(r *http.Request) string {
+	return r.Method + " " + r.URL.RequestURI()
+}
+
+// LoadRecording reads a recording saved with Save (e.g., from the testdata folder of the plugin)
+func LoadRecording(path string) (*Recording, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	res := &Recording{}
+	return res, json.Unmarshal(b, res)
+}
+
+func (rec *Recording) Save(path string) error {
+	b, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0644)
+}
+
+// Server serves the recorded responses, the requests that were not recorded get 404; the URL of the server is the URL of the
+// backend for the plugin (e.g., the Url of the compare request)
+func (rec *Recording) Server() *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res, ok := rec.Responses[requestKey(r)]
+		if !ok {
+			http.Error(w, "not recorded: "+requestKey(r), http.StatusNotFound)
+			return
+		}
+		for k, v := range res.Header {
+			w.Header().Set(k, strings.ReplaceAll(v, serverPlaceholder, srv.URL))
+		}
+		w.WriteHeader(res.Status)
+		w.Write(res.body(srv.URL))
+	}))
+	return srv
+}
+
+// Keys returns the recorded requests, sorted
+func (rec *Recording) Keys() []string {
+	res := []string{}
+	for k := range rec.Responses {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// backendClient records the responses of the backend as they are, without the retries of the clients of the plugins
+var backendClient = &http.Client{}
+
+// Recorder is a proxy to the real backend recording its responses: the suite is run once with the URL of the recorder as URL of
+// the backend, the recording is then saved and used with Recording.Server
+type Recorder struct {
+	*httptest.Server
+	Recording *Recording
+	target    string
+	mu        sync.Mutex
+}
+
+// NewRecorder starts the proxy to the backend, e.g., "https://gitlab.example.org"
+func NewRecorder(target string) *Recorder {
+	rec := &Recorder{Recording: &Recording{Responses: map[string]RecordedResponse{}}, target: strings.TrimSuffix(target, "/")}
+	rec.Server = httptest.NewServer(http.HandlerFunc(rec.proxy))
+	return rec
+}
+
+func (rec *Recorder) proxy(w http.ResponseWriter, r *http.Request) {
+	u, err := url.Parse(rec.target + r.URL.RequestURI())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request, err := http.NewRequestWithContext(r.Context(), r.Method, u.String(), r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.Header = r.Header.Clone()
+	request.Header.Del("Accept-Encoding") // recorded decompressed
+	response, err := backendClient.Do(request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	// the links to the backend are recorded with the placeholder and returned with the URL of the proxy
+	recorded := RecordedResponse{Status: response.StatusCode, Header: map[string]string{}, Body: strings.ReplaceAll(string(body), rec.target, serverPlaceholder)}
+	if !utf8.Valid(body) {
+		recorded.Body, recorded.Base64 = base64.StdEncoding.EncodeToString(body), true
+	}
+	for _, k := range []string{"Content-Type", "Link", "Location", "X-Next-Page", "X-Total", "X-Total-Pages"} {
+		if v := response.Header.Get(k); v != "" {
+			recorded.Header[k] = strings.ReplaceAll(v, rec.target, serverPlaceholder)
+		}
+	}
+	rec.mu.Lock()
+	rec.Recording.Responses[requestKey(r)] = recorded
+	rec.mu.Unlock()
+	for k, v := range recorded.Header {
+		w.Header().Set(k, strings.ReplaceAll(v, serverPlaceholder, rec.URL))
+	}
+	w.WriteHeader(recorded.Status)
+	w.Write(recorded.body(rec.URL))
+}
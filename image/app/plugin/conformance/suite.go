@@ -0,0 +1,270 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+// Package conformance is the test kit of the plugins: it runs a plugin against a recorded (see Recording) or mocked backend and
+// checks the behavior expected from all plugins, i.e., the files returned by Query (including the pages of large listings), the
+// remote hashes, the content of the streams and the errors of the rejected credentials
+package conformance
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"integration/app/core"
+	"integration/app/plugin"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Case is a repository served by the backend, with the content the plugin must find
+type Case struct {
+	Name    string
+	Request types.CompareRequest // points to the backend, e.g., Url set to the URL of the recording server
+	Files   map[string][]byte    // expected content by file id (the path in the dataset), a case with more files than a page of the backend checks the pagination
+}
+
+type Suite struct {
+	Plugin string // name in the plugin registry
+	Cases  []Case
+	// optional: request with the credentials rejected by the backend, Query must return an error wrapping types.ErrUnauthorized
+	Unauthorized *types.CompareRequest
+	// optional: request for a repository that does not exist, Query must return an error that does not wrap types.ErrUnauthorized
+	NotFound *types.CompareRequest
+	Timeout  time.Duration // per check, 1 minute by default
+}
+
+// Run runs the checks as subtests: "<case>/query", "<case>/hashes" and "<case>/streams", followed by "unauthorized" and "notFound"
+func (s Suite) Run(t *testing.T) {
+	p := plugin.GetPlugin(s.Plugin)
+	if p.Query == nil || p.Streams == nil {
+		t.Fatalf("plugin %v is not registered or does not implement Query and Streams", s.Plugin)
+	}
+	for _, c := range s.Cases {
+		t.Run(c.Name, func(t *testing.T) {
+			var nodes map[string]tree.Node
+			ok := t.Run("query", func(t *testing.T) {
+				ctx, cancel := s.context()
+				defer cancel()
+				var err error
+				nodes, err = p.Query(ctx, c.Request, DatasetNodes(c.Files))
+				if err != nil {
+					t.Fatalf("query failed: %v", err)
+				}
+				for _, e := range CheckQuery(nodes, c.Files) {
+					t.Error(e)
+				}
+			})
+			if !ok {
+				return
+			}
+			t.Run("hashes", func(t *testing.T) {
+				for _, e := range CheckHashes(nodes, c.Files) {
+					t.Error(e)
+				}
+			})
+			t.Run("streams", func(t *testing.T) {
+				ctx, cancel := s.context()
+				defer cancel()
+				for _, e := range CheckStreams(ctx, p, StreamParams(c.Request), nodes, c.Files) {
+					t.Error(e)
+				}
+			})
+		})
+	}
+	if s.Unauthorized != nil {
+		t.Run("unauthorized", func(t *testing.T) {
+			ctx, cancel := s.context()
+			defer cancel()
+			_, err := p.Query(ctx, *s.Unauthorized, map[string]tree.Node{})
+			if !errors.Is(err, types.ErrUnauthorized) {
+				t.Errorf("expected an error wrapping types.ErrUnauthorized, got: %v", err)
+			}
+		})
+	}
+	if s.NotFound != nil {
+		t.Run("notFound", func(t *testing.T) {
+			ctx, cancel := s.context()
+			defer cancel()
+			_, err := p.Query(ctx, *s.NotFound, map[string]tree.Node{})
+			if err == nil || errors.Is(err, types.ErrUnauthorized) {
+				t.Errorf("expected an error not wrapping types.ErrUnauthorized, got: %v", err)
+			}
+		})
+	}
+}
+
+func (s Suite) context() (context.Context, context.CancelFunc) {
+	timeout := s.Timeout
+	if timeout == 0 {
+		timeout = time.Minute
+	}
+	return context.WithTimeout(context.Background(), timeout)
+}
+
+// DatasetNodes are the nodes of a dataset containing the files, passed to Query: the plugins computing the hashes only for
+// the files that are in the dataset (e.g., the local plugin) then hash all files
+func DatasetNodes(files map[string][]byte) map[string]tree.Node {
+	res := map[string]tree.Node{}
+	for id, content := range files {
+		hash, _ := hashContent(types.Md5, content)
+		res[id] = tree.Node{
+			Id:   id,
+			Name: path.Base(id),
+			Path: strings.TrimSuffix(strings.TrimSuffix(id, path.Base(id)), "/"),
+			Attributes: tree.Attributes{
+				IsFile:          true,
+				DestinationFile: tree.DestinationFile{Id: int64(len(res) + 1), Filesize: int64(len(content)), Hash: hash, HashType: types.Md5},
+			},
+		}
+	}
+	return res
+}
+
+// StreamParams are the stream parameters of the store job following the compare request
+func StreamParams(req types.CompareRequest) types.StreamParams {
+	return types.StreamParams{PluginId: req.PluginId, RepoName: req.RepoName, Url: req.Url, Option: req.Option, User: req.User, Token: req.Token}
+}
+
+// CheckQuery compares the nodes with the expected files: the same ids, the ids are the paths of the nodes, and the known sizes match
+func CheckQuery(nodes map[string]tree.Node, files map[string][]byte) []error {
+	errs := []error{}
+	for _, id := range sortedIds(nodes) {
+		v := nodes[id]
+		content, ok := files[id]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%v: unexpected file", id))
+			continue
+		case !v.Attributes.IsFile:
+			errs = append(errs, fmt.Errorf("%v: not marked as file", id))
+		case v.Id != id || v.Id != path.Join(v.Path, v.Name):
+			errs = append(errs, fmt.Errorf("%v: id %q does not match the path %q and the name %q", id, v.Id, v.Path, v.Name))
+		case v.Attributes.RemoteFilesize != 0 && v.Attributes.RemoteFilesize != int64(len(content)):
+			errs = append(errs, fmt.Errorf("%v: remote file size is %v, expected %v", id, v.Attributes.RemoteFilesize, len(content)))
+		}
+	}
+	for id := range files {
+		if _, ok := nodes[id]; !ok {
+			errs = append(errs, fmt.Errorf("%v: missing (check the pagination of the listing)", id))
+		}
+	}
+	return errs
+}
+
+// CheckHashes verifies the remote hashes of the nodes against the expected content, the hash types must be supported by the application
+func CheckHashes(nodes map[string]tree.Node, files map[string][]byte) []error {
+	errs := []error{}
+	for _, id := range sortedIds(nodes) {
+		v, content := nodes[id].Attributes, files[id]
+		switch {
+		case v.RemoteHash == types.NotNeeded || v.RemoteHashType == types.NotNeeded:
+			continue
+		case v.RemoteHashType == types.SizeAndTime:
+			if v.RemoteFilesize != int64(len(content)) || v.RemoteHash != types.SizeAndTimeHash(v.RemoteFilesize, v.RemoteModified) {
+				errs = append(errs, fmt.Errorf("%v: %v hash %q does not match the size %v and the modification time %v", id, v.RemoteHashType, v.RemoteHash, len(content), v.RemoteModified))
+			}
+			continue
+		case v.RemoteHashType == types.FileSize:
+			if v.RemoteFilesize != int64(len(content)) {
+				errs = append(errs, fmt.Errorf("%v: %v hash requires the file size", id, v.RemoteHashType))
+			}
+			continue
+		}
+		expected, err := hashContent(v.RemoteHashType, content)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %v", id, err))
+		} else if v.RemoteHash != expected {
+			errs = append(errs, fmt.Errorf("%v: %v hash is %q, expected %q (hex encoded)", id, v.RemoteHashType, v.RemoteHash, expected))
+		}
+	}
+	return errs
+}
+
+// CheckStreams opens the stream of each node and compares the content with the expected content, the streams must close without error
+func CheckStreams(ctx context.Context, p plugin.Plugin, params types.StreamParams, nodes map[string]tree.Node, files map[string][]byte) (errs []error) {
+	// the nodes are selected for copying, as in the store job of a new dataset
+	selected := map[string]tree.Node{}
+	for id, v := range nodes {
+		v.Action = tree.Copy
+		selected[id] = v
+	}
+	streams, err := p.Streams(ctx, selected, params)
+	if err != nil {
+		return append(errs, fmt.Errorf("streams failed: %v", err))
+	}
+	if streams.Cleanup != nil {
+		defer func() {
+			if err := streams.Cleanup(); err != nil {
+				errs = append(errs, fmt.Errorf("cleanup failed: %v", err))
+			}
+		}()
+	}
+	for _, id := range sortedIds(nodes) {
+		s, ok := streams.Streams[id]
+		if !ok {
+			errs = append(errs, fmt.Errorf("%v: no stream", id))
+			continue
+		}
+		reader, err := s.Open(ctx)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: opening the stream failed: %v", id, err))
+			continue
+		}
+		content, err := io.ReadAll(reader)
+		if closeErr := s.Close(); closeErr != nil {
+			errs = append(errs, fmt.Errorf("%v: closing the stream failed: %v", id, closeErr))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: reading the stream failed: %v", id, err))
+		} else if string(content) != string(files[id]) {
+			errs = append(errs, fmt.Errorf("%v: streamed %v bytes that differ from the expected %v bytes", id, len(content), len(files[id])))
+		}
+	}
+	return errs
+}
+
+// hashContent returns the hex encoded hash of the content, calculated independently of the hashing of the application
+func hashContent(hashType string, content []byte) (string, error) {
+	var hasher hash.Hash
+	switch strings.ToLower(types.NormalizeHashType(hashType)) {
+	case strings.ToLower(types.Md5):
+		hasher = md5.New()
+	case strings.ToLower(types.SHA1):
+		hasher = sha1.New()
+	case strings.ToLower(types.SHA256):
+		hasher = sha256.New()
+	case strings.ToLower(types.SHA512):
+		hasher = sha512.New()
+	case strings.ToLower(types.GitHash):
+		hasher = sha1.New()
+		fmt.Fprintf(hasher, "blob %d\x00", len(content))
+	case strings.ToLower(types.QuickXorHash):
+		hasher = &core.QuickXorHash{}
+	case strings.ToLower(types.CRC32C):
+		hasher = crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	default:
+		return "", fmt.Errorf("unsupported hash type: %v", hashType)
+	}
+	hasher.Write(content)
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
+
+func sortedIds(nodes map[string]tree.Node) []string {
+	res := []string{}
+	for k := range nodes {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return res
+}
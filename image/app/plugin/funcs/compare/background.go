@@ -0,0 +1,111 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package compare
+
+import (
+	"context"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBackgroundWorkers = 2
+	// the durations are kept as long as the prewarm registrations
+	compareDurationExpiration = 30 * 24 * time.Hour
+	reclaimInterval           = 30 * time.Second
+)
+
+func compareDurationKey(id string) string {
+	return "compare duration: " + id
+}
+
+// recordCompareDuration remembers how long the compare of the connection (dataset, version and repository) of the user took
+func recordCompareDuration(ctx context.Context, req types.CompareRequest, user string, d time.Duration) {
+	config.GetRedis().Set(ctx, compareDurationKey(core.PrewarmId(ctx, user, req)), int(d.Seconds()), compareDurationExpiration)
+}
+
+// backgroundCompare tells whether the compare is queued as a background job: the last compare of the connection took longer
+// than the backgroundAfter seconds (see the compare option)
+func backgroundCompare(ctx context.Context, req types.CompareRequest, user string) bool {
+	after := config.GetConfig().Options.Compare.BackgroundAfter
+	if after <= 0 {
+		return false
+	}
+	cached, _ := config.GetRedis().Get(ctx, compareDurationKey(core.PrewarmId(ctx, user, req)))
+	last, err := strconv.Atoi(cached)
+	return err == nil && last > after
+}
+
+func backgroundWorkers() int64 {
+	if n := config.GetConfig().Options.Compare.BackgroundWorkers; n > 0 {
+		return int64(n)
+	}
+	return defaultBackgroundWorkers
+}
+
+// ProcessCompares runs the queued compares on this instance (at most backgroundWorkers at a time) and re-queues the compares of
+// the stopped instances (also the compares started by their handlers), until the shutdown
+func ProcessCompares() {
+	running := atomic.Int64{}
+	lastReclaim := time.Time{}
+	for {
+		select {
+		case <-core.Stop:
+			return
+		case <-time.After(time.Second):
+		}
+		if time.Since(lastReclaim) >= reclaimInterval {
+			for _, job := range core.ReclaimOrphanedCompares() {
+				// the client polling the key gets a terminal answer
+				common.CacheResponse(common.CachedResponse{Key: job.Key, ErrorMessage: "the compare was interrupted (e.g., by a restart of the server), compare again"})
+			}
+			lastReclaim = time.Now()
+		}
+		for running.Load() < backgroundWorkers() {
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			job, ok := core.PopCompare(ctx)
+			cancel()
+			if !ok {
+				break
+			}
+			running.Add(1)
+			go func() {
+				defer running.Add(-1)
+				runCompare(job)
+			}()
+		}
+	}
+}
+
+// runCompare caches the result of the compare under its key; the compare holds a lease while it runs, so that it is queued again
+// when this instance stops (the compare interrupted by the shutdown is left for another instance)
+func runCompare(job core.CompareJob) {
+	ctx, cancel := context.WithCancel(config.WithTarget(logging.WithCorrelationId(context.Background(), job.CorrelationId), job.Target))
+	defer cancel()
+	go func() {
+		select {
+		case <-core.Stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	endLease := core.StartCompareLease(job)
+	logging.Logger.DebugContext(ctx, "compare started", "key", job.Key, "persistentId", job.Request.PersistentId, "attempt", job.Attempts+1, "waited", time.Since(job.Queued).Round(time.Second).String())
+	res := compareResponse(ctx, job.Request, job.Key, job.User)
+	select {
+	case <-core.Stop:
+		logging.Logger.InfoContext(ctx, "compare interrupted by shutdown", "key", job.Key)
+		endLease(false)
+		return
+	default:
+	}
+	cacheCompare(res, job.Key, job.User)
+	endLease(true)
+	logging.Logger.DebugContext(ctx, "compare ended", "key", job.Key, "persistentId", job.Request.PersistentId)
+}
@@ -0,0 +1,310 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package compare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// the status of a batch is kept for a week after it was started
+var batchCacheDuration = 7 * 24 * time.Hour
+
+const (
+	BatchPending   = "pending"
+	BatchComparing = "comparing"
+	BatchQueued    = "queued"
+	BatchRunning   = "running"
+	BatchDone      = "done"
+	BatchUpToDate  = "upToDate"
+	BatchFailed    = "failed"
+)
+
+// BatchRequest syncs the same source with several datasets, e.g., each subfolder of a repository with its own dataset
+type BatchRequest struct {
+	Request          types.CompareRequest `json:"request"`                    // the source with its credentials and the Dataverse API key, the persistentId and the folder are taken from the items
+	Items            []BatchItem          `json:"items"`                      // the datasets with the folders of the source that are synced with them
+	Delete           bool                 `json:"delete,omitempty"`           // the dataset files that are not in the source (or folder) are deleted
+	Publish          string               `json:"publish,omitempty"`          // "major" or "minor" for publishing the datasets after the sync
+	ContinueOnError  bool                 `json:"continueOnError,omitempty"`  // a failed file does not stop the job of a dataset, only the failed files are retried
+	SkipCleanStorage bool                 `json:"skipCleanStorage,omitempty"` // the cleanStorage API is not called after the jobs, also when enabled in the configuration
+}
+
+type BatchItem struct {
+	PersistentId string `json:"persistentId"`
+	Folder       string `json:"folder,omitempty"` // folder of the source, the whole source when empty
+}
+
+type BatchStatusRequest struct {
+	Id string `json:"id"`
+}
+
+type BatchResponse struct {
+	Id string `json:"id"`
+}
+
+type BatchStatus struct {
+	Id      string            `json:"id"`
+	Started time.Time         `json:"started"`
+	Done    bool              `json:"done"` // all items are done, up to date or failed
+	Items   []BatchItemStatus `json:"items"`
+}
+
+type BatchItemStatus struct {
+	BatchItem
+	Status    string          `json:"status"` // "pending", "comparing", "queued", "running", "done", "upToDate" or "failed"
+	Error     string          `json:"error,omitempty"`
+	Files     int             `json:"files,omitempty"` // number of the files in the job of the item
+	Processed int             `json:"processed,omitempty"`
+	QueuedAt  time.Time       `json:"queuedAt,omitempty"`
+	Report    *core.JobReport `json:"report,omitempty"` // the report of the job, when done
+}
+
+// stored with the user, who is not part of the response
+type storedBatch struct {
+	BatchStatus
+	User string `json:"user"`
+}
+
+func batchKey(id string) string {
+	return "batch: " + id
+}
+
+// Batch starts the batch: the items are compared one by one and their store jobs are queued, the jobs run in parallel on the workers
+func Batch(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		common.WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := BatchRequest{}
+	if !common.DecodeRequest(w, r, &req) {
+		return
+	}
+	if err := validateBatch(r.Context(), req); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errScope) {
+			status = http.StatusForbidden
+		}
+		common.WriteError(w, r, status, err)
+		return
+	}
+	batch := newBatch(req, core.GetUserFromHeader(r.Header))
+	if err := saveBatch(r.Context(), batch); err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	logging.Logger.InfoContext(r.Context(), "batch started", "batch", batch.Id, "items", len(batch.Items))
+	ctx := config.WithTarget(logging.WithCorrelationId(context.Background(), logging.CorrelationId(r.Context())), config.TargetName(r.Context()))
+	go runBatch(ctx, req, batch)
+	b, err := json.Marshal(BatchResponse{Id: batch.Id})
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// errScope wraps the errors of the datasets or plugins not allowed for the API key of the request
+var errScope = errors.New("not allowed")
+
+// validateBatch checks the batch request, as sent to /api/plugin/batch or stored in a schedule
+func validateBatch(ctx context.Context, req BatchRequest) error {
+	if len(req.Items) == 0 {
+		return fmt.Errorf("no items")
+	}
+	if req.Publish != "" && req.Publish != "major" && req.Publish != "minor" {
+		return fmt.Errorf("unsupported publish version type: %v", req.Publish)
+	}
+	if !core.ValidVersion(req.Request.Version) {
+		return fmt.Errorf("unsupported dataset version: %v", req.Request.Version)
+	}
+	seen := map[string]bool{}
+	for _, item := range req.Items {
+		if seen[item.PersistentId] {
+			return fmt.Errorf("dataset %v is listed more than once", item.PersistentId)
+		}
+		seen[item.PersistentId] = true
+		if !ValidFolder(item.Folder) {
+			return fmt.Errorf("invalid folder: %v", item.Folder)
+		}
+		if err := core.CheckScope(ctx, []string{req.Request.Plugin, req.Request.PluginId}, item.PersistentId); err != nil {
+			return fmt.Errorf("%w: %v", errScope, err)
+		}
+	}
+	return nil
+}
+
+func newBatch(req BatchRequest, user string) storedBatch {
+	batch := storedBatch{BatchStatus: BatchStatus{Id: uuid.New().String(), Started: time.Now()}, User: user}
+	for _, item := range req.Items {
+		batch.Items = append(batch.Items, BatchItemStatus{BatchItem: item, Status: BatchPending})
+	}
+	return batch
+}
+
+// BatchStatusHandler returns the status of the items of the batch, with the progress of the running jobs
+func BatchStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		common.WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := BatchStatusRequest{}
+	if !common.DecodeRequest(w, r, &req) {
+		return
+	}
+	batch, ok := loadBatch(r.Context(), req.Id)
+	if !ok || batch.User != core.GetUserFromHeader(r.Header) {
+		common.WriteError(w, r, http.StatusNotFound, fmt.Errorf("batch %v not found", req.Id))
+		return
+	}
+	res := batch.BatchStatus
+	res.Done = true
+	for i, item := range res.Items {
+		res.Items[i] = jobStatus(r.Context(), item)
+		if s := res.Items[i].Status; s != BatchDone && s != BatchUpToDate && s != BatchFailed {
+			res.Done = false
+		}
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// jobStatus adds the state of the job of a queued item: running with its progress, or done with its report
+func jobStatus(ctx context.Context, item BatchItemStatus) BatchItemStatus {
+	if item.Status != BatchQueued {
+		return item
+	}
+	if core.IsLocked(ctx, item.PersistentId) {
+		if processed, _, ok := core.GetProgress(ctx, item.PersistentId); ok {
+			item.Status, item.Processed = BatchRunning, processed
+		}
+		return item
+	}
+	report, ok := core.GetJobReport(ctx, item.PersistentId)
+	if !ok || report.Started.Before(item.QueuedAt) {
+		item.Status, item.Error = BatchFailed, "the job ended without a report"
+		return item
+	}
+	item.Status, item.Processed, item.Report = BatchDone, report.FilesWritten, &report
+	if missing := item.Files - len(report.Files); missing > 0 {
+		item.Error = fmt.Sprintf("%d files were not processed", missing)
+	}
+	return item
+}
+
+func runBatch(ctx context.Context, req BatchRequest, batch storedBatch) {
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		item.Status = BatchComparing
+		saveBatch(ctx, batch)
+		// before the job is added, the report of the job starts later
+		queuedAt := time.Now()
+		files, err := syncItem(ctx, req, item.BatchItem, batch.User)
+		switch {
+		case err != nil:
+			item.Status, item.Error = BatchFailed, err.Error()
+			logging.Logger.WarnContext(ctx, "batch item failed", "batch", batch.Id, "persistentId", item.PersistentId, "error", err)
+		case files == 0:
+			item.Status = BatchUpToDate
+		default:
+			item.Status, item.Files, item.QueuedAt = BatchQueued, files, queuedAt
+		}
+		saveBatch(ctx, batch)
+	}
+	logging.Logger.InfoContext(ctx, "batch queued", "batch", batch.Id, "items", len(batch.Items))
+}
+
+// syncItem compares the folder with the dataset and queues the job writing the changes, it returns the number of the files of the job
+func syncItem(ctx context.Context, req BatchRequest, item BatchItem, user string) (int, error) {
+	compareReq := req.Request
+	compareReq.PersistentId, compareReq.Folder = item.PersistentId, item.Folder
+	compareReq.NewlyCreated, compareReq.Prewarm = false, false
+	compareCtx, cancel := context.WithTimeout(ctx, core.CompareTimeout())
+	defer cancel()
+	res := compareRepository(compareCtx, compareReq, "", user)
+	if res.ErrorMessage != "" {
+		return 0, errors.New(res.ErrorMessage)
+	}
+	selected := map[string]tree.Node{}
+	for _, v := range res.Response.Data {
+		switch {
+		case v.Status == tree.New:
+			v.Action = tree.Copy
+		case v.Status == tree.Updated:
+			v.Action = tree.Update
+		case v.Status == tree.Deleted && req.Delete:
+			v.Action = tree.Delete
+		default:
+			continue
+		}
+		selected[v.Id] = v
+	}
+	if len(selected) == 0 {
+		return 0, nil
+	}
+	if err := core.CheckJobLimits(compareReq.Plugin, compareReq.PluginId, item.PersistentId, selected, nil); err != nil {
+		return 0, err
+	}
+	streamParams := types.StreamParams{
+		PluginId: compareReq.PluginId,
+		RepoName: compareReq.RepoName,
+		Url:      compareReq.Url,
+		Option:   compareReq.Option,
+		User:     compareReq.User,
+		Token:    compareReq.Token,
+	}
+	if streamParams.User == "" {
+		streamParams.User = user
+	}
+	job := core.Job{
+		DataverseKey:     compareReq.DataverseKey,
+		User:             user,
+		SessionId:        compareReq.Token,
+		PersistentId:     item.PersistentId,
+		WritableNodes:    selected,
+		Plugin:           compareReq.Plugin,
+		StreamParams:     streamParams,
+		Version:          compareReq.Version,
+		Publish:          req.Publish,
+		ContinueOnError:  req.ContinueOnError,
+		SkipCleanStorage: req.SkipCleanStorage,
+	}
+	if err := core.CheckStorageLimits(ctx, job); err != nil {
+		return 0, err
+	}
+	err := core.AddJob(ctx, job)
+	return len(selected), err
+}
+
+func saveBatch(ctx context.Context, batch storedBatch) error {
+	b, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	return config.GetRedis().Set(ctx, batchKey(batch.Id), string(b), batchCacheDuration)
+}
+
+func loadBatch(ctx context.Context, id string) (storedBatch, bool) {
+	res := storedBatch{}
+	cached, _ := config.GetRedis().Get(ctx, batchKey(id))
+	if cached == "" || json.Unmarshal([]byte(cached), &res) != nil {
+		return res, false
+	}
+	return res, true
+}
@@ -5,102 +5,161 @@ package compare
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"integration/app/common"
 	"integration/app/config"
 	"integration/app/core"
+	"integration/app/logging"
 	"integration/app/plugin"
 	"integration/app/plugin/types"
 	"integration/app/tree"
-	"io"
 	"net/http"
-	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
-var fileNameR, _ = regexp.Compile(`^[^:<>;#"\/\*\|\?\\]*$`)
-var folderNameR, _ = regexp.Compile(`^[a-zA-Z0-9_\.\/\- \\]*$`)
-
 func Compare(w http.ResponseWriter, r *http.Request) {
 	if !config.RedisReady(r.Context()) {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - cache not ready"))
+		common.WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
 		return
 	}
 	user := core.GetUserFromHeader(r.Header)
 	//process request
 	req := types.CompareRequest{}
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !common.DecodeRequest(w, r, &req) {
 		return
 	}
-	err = json.Unmarshal(b, &req)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !core.ValidVersion(req.Version) {
+		common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("unsupported dataset version: %v", req.Version))
+		return
+	}
+	if !ValidFolder(req.Folder) {
+		common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("invalid folder: %v", req.Folder))
 		return
 	}
+	if err := checkCredentials(r.Context(), req, user); err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if req.Prewarm && core.PrewarmEnabled() {
+		if err := core.RegisterPrewarm(r.Context(), user, req); err != nil {
+			logging.Logger.WarnContext(r.Context(), "registering prewarm failed", "persistentId", req.PersistentId, "error", err)
+		}
+	}
 	key := uuid.New().String()
-	go doCompare(req, key, user)
+	job := core.CompareJob{Key: key, User: user, Request: req, CorrelationId: logging.CorrelationId(r.Context()), Target: config.TargetName(r.Context()), Queued: time.Now()}
+	if backgroundCompare(r.Context(), req, user) {
+		// the compare took long the last time: it waits for a free background worker
+		err := core.QueueCompare(r.Context(), job)
+		if err != nil {
+			common.WriteError(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		publishStage(r.Context(), key, "queued")
+	} else {
+		go runCompare(job)
+	}
 	res := common.Key{Key: key}
-	b, err = json.Marshal(res)
+	b, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		common.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
 }
 
-func doCompare(req types.CompareRequest, key, user string) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Hour)
+// checkCredentials fails the compare at once when the user can not edit the dataset or the token can not read the repository (e.g.,
+// a token without the needed scopes), instead of failing in the background compare
+func checkCredentials(ctx context.Context, req types.CompareRequest, user string) error {
+	if err := core.Destination.CheckPermission(ctx, req.DataverseKey, user, req.PersistentId); err != nil {
+		return err
+	}
+	scopes := plugin.GetPlugin(req.Plugin).Scopes
+	if scopes == nil {
+		return nil
+	}
+	req.Token = core.GetTokenFromCache(ctx, req.Token, req.Token, req.PluginId)
+	return scopes(ctx, req)
+}
+
+// cacheCompare caches the result under the key of the compare, the compared nodes are kept for the selection
+func cacheCompare(res common.CachedResponse, key, user string) {
+	res.Key = key
+	if res.ErrorMessage == "" {
+		common.KeepSelection(key, user, res.Response)
+	}
+	common.CacheResponse(res)
+}
+
+// compareResponse returns the pre-warmed result when it is still valid, or compares the repository within the compare timeout
+func compareResponse(ctx context.Context, req types.CompareRequest, key, user string) common.CachedResponse {
+	ctx, cancel := context.WithTimeout(ctx, core.CompareTimeout())
 	defer cancel()
-	cachedRes := common.CachedResponse{
-		Key: key,
+	if !req.Refresh {
+		if res, ok := prewarmedResponse(ctx, req, user); ok {
+			return res
+		}
+	}
+	started := time.Now()
+	res := compareRepository(ctx, req, key, user)
+	if res.ErrorMessage == "" {
+		recordCompareDuration(ctx, req, user, time.Since(started))
 	}
+	return res
+}
+
+// compareRepository compares the repository with the dataset, the stages are published on the events of the key (when set)
+func compareRepository(ctx context.Context, req types.CompareRequest, key, user string) common.CachedResponse {
+	cachedRes := common.CachedResponse{}
 	//check permission
+	publishStage(ctx, key, "checking permission")
 	err := core.Destination.CheckPermission(ctx, req.DataverseKey, user, req.PersistentId)
 	if err != nil {
 		cachedRes.ErrorMessage = err.Error()
-		common.CacheResponse(cachedRes)
-		return
+		return cachedRes
 	}
 
 	//query dataverse
-	nm, err := core.Destination.Query(ctx, req.PersistentId, req.DataverseKey, user)
+	publishStage(ctx, key, "querying dataverse")
+	nm, err := core.Destination.Query(ctx, req.PersistentId, req.Version, req.DataverseKey, user)
 	if err != nil {
 		cachedRes.ErrorMessage = err.Error()
-		common.CacheResponse(cachedRes)
-		return
+		return cachedRes
 	}
 
 	//query repository
+	publishStage(ctx, key, "querying repository")
 	nmCopy := map[string]tree.Node{}
 	for k, v := range nm {
+		// the plugins see the dataset files at their place in the repository
+		if req.Folder != "" {
+			k = strings.Trim(req.Folder, "/") + "/" + k
+			v.Id, v.Path = k, strings.TrimSuffix(strings.TrimSuffix(k, v.Name), "/")
+		}
 		nmCopy[k] = v
 	}
 	req.Token = core.GetTokenFromCache(ctx, req.Token, req.Token, req.PluginId)
-	repoNm, err := plugin.GetPlugin(req.Plugin).Query(ctx, req, nmCopy)
+	repoNm, err := queryRepository(ctx, req, nmCopy)
 	if err != nil {
 		cachedRes.ErrorMessage = err.Error()
-		common.CacheResponse(cachedRes)
-		return
+		return cachedRes
+	}
+	if req.Folder != "" {
+		repoNm = folderNodes(repoNm, req.Folder)
 	}
-	rejected := []string{}
-	maxFileSize := config.GetMaxFileSize()
+	repoNm, rejected, warnings := sanitizeNodes(repoNm, nm)
+	// the files exceeding their size limit (including the maximum upload size of Dataverse) are rejected now, not when their upload fails
+	limits := core.GetStorageLimits(ctx, req.DataverseKey, user, req.PersistentId)
+	sizeLimits := core.NewFileSizeLimits(ctx, req.Plugin, req.PluginId, limits.StorageDriver, limits.MaxFileSize, false)
+	tooLarge := map[string]core.FileSizeLimit{}
 	for k, v := range repoNm {
-		if maxFileSize > 0 && v.Attributes.RemoteFilesize > maxFileSize {
+		if limit := sizeLimits.For(k); limit.Exceeded(v.Attributes.RemoteFilesize) {
 			delete(repoNm, k)
-			rejected = append(rejected, v.Id)
-		} else if !fileNameR.MatchString(v.Name) || !folderNameR.MatchString(v.Path) {
-			delete(repoNm, k)
-			rejected = append(rejected, v.Id)
+			rejected = append(rejected, v.SourceId())
+			tooLarge[v.SourceId()] = limit
 		} else if len(strings.TrimSpace(v.Name)) == 0 {
 			delete(repoNm, k)
 		}
@@ -108,20 +167,39 @@ func doCompare(req types.CompareRequest, key, user string) {
 	nm = core.MergeNodeMaps(nm, repoNm)
 
 	//compare and write response
+	publishStage(ctx, key, "comparing")
 	res := core.Compare(ctx, nm, req.PersistentId, req.DataverseKey, user, true)
+	if warning, exceeded := core.JobLimitsWarning(req.Plugin, req.PluginId, req.PersistentId, res.Data); exceeded {
+		warnings = append(warnings, warning)
+	}
+	if warning, exceeded := limits.StorageQuotaWarning(res.Data); exceeded {
+		warnings = append(warnings, warning)
+	}
 
 	//copy metadata if the source is a Dataverse installation and destination is a newly created dataset
 	if req.Plugin == "dataverse" && req.NewlyCreated {
 		err = copyMetaData(req, user)
 		if err != nil {
 			cachedRes.ErrorMessage = err.Error()
-			common.CacheResponse(cachedRes)
-			return
+			return cachedRes
 		}
 	}
 
 	cachedRes.Response = res
-	cachedRes.Response.MaxFileSize = maxFileSize
+	cachedRes.Response.MaxFileSize = sizeLimits.Files().Limit
+	if len(tooLarge) > 0 {
+		cachedRes.Response.TooLarge = tooLarge
+	}
 	cachedRes.Response.Rejected = rejected
-	common.CacheResponse(cachedRes)
+	cachedRes.Response.Warnings = warnings
+	cachedRes.ComparedAt = time.Now()
+	return cachedRes
+}
+
+// publishStage lets the GUI show what the compare is doing, the result itself is still fetched from the cache
+func publishStage(ctx context.Context, key, stage string) {
+	if key == "" {
+		return
+	}
+	core.PublishEvent(ctx, core.ProgressEvent{Type: core.EventCompare, Key: key, Stage: stage})
 }
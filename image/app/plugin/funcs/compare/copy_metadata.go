@@ -44,7 +44,7 @@ func getMetadata(ctx context.Context, compareRequest types.CompareRequest, user
 
 func putMetadata(ctx context.Context, compareRequest types.CompareRequest, user string, data []byte) error {
 	to := "/api/v1/datasets/:persistentId/versions/:draft?persistentId=" + compareRequest.PersistentId
-	toReq := dataverse.GetRequest(to, "PUT", user, compareRequest.DataverseKey, bytes.NewBuffer(data), api.JsonContentHeader())
+	toReq := dataverse.GetRequest(ctx, to, "PUT", user, compareRequest.DataverseKey, bytes.NewBuffer(data), api.JsonContentHeader())
 	res := map[string]interface{}{}
 	err := api.Do(ctx, toReq, &res)
 	if err != nil {
@@ -0,0 +1,371 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package compare
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"integration/app/plugin"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// the metadata files are small, larger files are not read
+const maxMetadataFileSize = 1 << 20
+
+// the status of a migration row before the comparison of the new dataset
+const MigrationCreating = "creating"
+
+// MigrationRequest creates a dataset for each source (or folder of a source) in its collection, with the metadata of the metadata
+// file of the source (CITATION.cff or codemeta.json), and syncs the files of the source with the new dataset
+type MigrationRequest struct {
+	Request  types.CompareRequest `json:"request"`           // the source plugin with its credentials and the Dataverse API key, the repository and the option can be set per row
+	Rows     []MigrationRow       `json:"rows,omitempty"`    // the sources with their collections
+	Csv      string               `json:"csv,omitempty"`     // alternative to the rows: CSV with a header line naming the columns as the JSON fields of the rows
+	Metadata core.DatasetMetadata `json:"metadata"`          // defaults for the metadata missing in the rows and the metadata files, e.g., the subjects
+	Publish  string               `json:"publish,omitempty"` // "major" or "minor" for publishing the datasets after the sync
+}
+
+type MigrationRow struct {
+	RepoName    string   `json:"repoName,omitempty"`    // the repository of the request when empty, e.g., with subfolders of the same repository
+	Option      string   `json:"option,omitempty"`      // e.g., the branch, the option of the request when empty
+	Folder      string   `json:"folder,omitempty"`      // folder of the source, the whole source when empty
+	Collection  string   `json:"collection,omitempty"`  // alias of the collection, the root collection of the configuration when empty
+	Title       string   `json:"title,omitempty"`       // overrides the title of the metadata file
+	Description string   `json:"description,omitempty"` // overrides the description of the metadata file
+	Subjects    []string `json:"subjects,omitempty"`    // ";" separated in CSV
+}
+
+type MigrationStatus struct {
+	Id      string               `json:"id"`
+	Started time.Time            `json:"started"`
+	Done    bool                 `json:"done"` // all rows are done, up to date or failed
+	Rows    []MigrationRowStatus `json:"rows"`
+}
+
+// MigrationRowStatus is the status of the sync of the row with its new dataset, "creating" while the dataset is created
+type MigrationRowStatus struct {
+	Row MigrationRow `json:"row"`
+	BatchItemStatus
+	MetadataFile string `json:"metadataFile,omitempty"` // the metadata file of the source used for the dataset metadata
+}
+
+type storedMigration struct {
+	MigrationStatus
+	User string `json:"user"`
+}
+
+func migrationKey(id string) string {
+	return "migration: " + id
+}
+
+// migrationLeaseKey is held by the instance running the migration, the rows that are not queued yet fail once it is gone
+func migrationLeaseKey(id string) string {
+	return "migration lease: " + id
+}
+
+// Migrate starts the migration, the rows are processed one by one and their store jobs run in parallel on the workers
+func Migrate(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		common.WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := MigrationRequest{}
+	if !common.DecodeRequest(w, r, &req) {
+		return
+	}
+	if req.Csv != "" {
+		rows, err := parseMigrationCsv(req.Csv)
+		if err != nil {
+			common.WriteError(w, r, http.StatusBadRequest, err)
+			return
+		}
+		req.Rows = append(req.Rows, rows...)
+	}
+	if len(req.Rows) == 0 {
+		common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("no rows"))
+		return
+	}
+	if req.Publish != "" && req.Publish != "major" && req.Publish != "minor" {
+		common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("unsupported publish version type: %v", req.Publish))
+		return
+	}
+	if plugin.GetPlugin(req.Request.Plugin).Query == nil {
+		common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("unknown plugin: %v", req.Request.Plugin))
+		return
+	}
+	for i, row := range req.Rows {
+		if !ValidFolder(row.Folder) {
+			common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("row %d: invalid folder: %v", i+1, row.Folder))
+			return
+		}
+	}
+	// the datasets do not exist yet: API keys limited to datasets cannot migrate
+	if err := core.CheckScope(r.Context(), []string{req.Request.Plugin, req.Request.PluginId}, ""); err != nil {
+		common.WriteError(w, r, http.StatusForbidden, err)
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	migration := storedMigration{MigrationStatus: MigrationStatus{Id: uuid.New().String(), Started: time.Now()}, User: user}
+	for _, row := range req.Rows {
+		migration.Rows = append(migration.Rows, MigrationRowStatus{Row: row, BatchItemStatus: BatchItemStatus{BatchItem: BatchItem{Folder: row.Folder}, Status: BatchPending}})
+	}
+	if err := saveMigration(r.Context(), migration); err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	logging.Logger.InfoContext(r.Context(), "migration started", "migration", migration.Id, "rows", len(migration.Rows))
+	ctx := config.WithTarget(logging.WithCorrelationId(context.Background(), logging.CorrelationId(r.Context())), config.TargetName(r.Context()))
+	release := core.HoldLease(migrationLeaseKey(migration.Id))
+	go func() {
+		defer release()
+		runMigration(ctx, req, migration)
+	}()
+	b, err := json.Marshal(BatchResponse{Id: migration.Id})
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// MigrationStatusHandler returns the status of the rows of the migration, with the new datasets and the progress of their jobs
+func MigrationStatusHandler(w http.ResponseWriter, r *http.Request) {
+	if !config.RedisReady(r.Context()) {
+		common.WriteError(w, r, http.StatusServiceUnavailable, errors.New("cache not ready"))
+		return
+	}
+	req := BatchStatusRequest{}
+	if !common.DecodeRequest(w, r, &req) {
+		return
+	}
+	migration, ok := loadMigration(r.Context(), req.Id)
+	if !ok || migration.User != core.GetUserFromHeader(r.Header) {
+		common.WriteError(w, r, http.StatusNotFound, fmt.Errorf("migration %v not found", req.Id))
+		return
+	}
+	if failInterruptedRows(r.Context(), &migration) {
+		saveMigration(r.Context(), migration)
+	}
+	res := migration.MigrationStatus
+	res.Done = true
+	for i, row := range res.Rows {
+		res.Rows[i].BatchItemStatus = jobStatus(r.Context(), row.BatchItemStatus)
+		if s := res.Rows[i].Status; s != BatchDone && s != BatchUpToDate && s != BatchFailed {
+			res.Done = false
+		}
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// parseMigrationCsv reads the rows from CSV, the header names the columns, unknown columns are rejected
+func parseMigrationCsv(s string) ([]MigrationRow, error) {
+	records, err := csv.NewReader(strings.NewReader(s)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+	header := records[0]
+	for _, column := range header {
+		switch column {
+		case "repoName", "option", "folder", "collection", "title", "description", "subjects":
+		default:
+			return nil, fmt.Errorf("unknown CSV column: %q", column)
+		}
+	}
+	res := []MigrationRow{}
+	for _, record := range records[1:] {
+		row := MigrationRow{}
+		for i, v := range record {
+			v = strings.TrimSpace(v)
+			switch header[i] {
+			case "repoName":
+				row.RepoName = v
+			case "option":
+				row.Option = v
+			case "folder":
+				row.Folder = v
+			case "collection":
+				row.Collection = v
+			case "title":
+				row.Title = v
+			case "description":
+				row.Description = v
+			case "subjects":
+				for _, subject := range strings.Split(v, ";") {
+					if subject = strings.TrimSpace(subject); subject != "" {
+						row.Subjects = append(row.Subjects, subject)
+					}
+				}
+			}
+		}
+		res = append(res, row)
+	}
+	return res, nil
+}
+
+func runMigration(ctx context.Context, req MigrationRequest, migration storedMigration) {
+	for i := range migration.Rows {
+		row := &migration.Rows[i]
+		row.Status = MigrationCreating
+		saveMigration(ctx, migration)
+		source := migrationSource(req.Request, row.Row)
+		pid, file, err := createDataset(ctx, source, req.Metadata, row.Row, migration.User)
+		if err == nil {
+			row.PersistentId, row.MetadataFile, row.Status = pid, file, BatchComparing
+			saveMigration(ctx, migration)
+			// before the job is added, the report of the job starts later
+			queuedAt := time.Now()
+			row.Files, err = syncItem(ctx, BatchRequest{Request: source, Publish: req.Publish}, row.BatchItem, migration.User)
+			if row.Status, row.QueuedAt = BatchQueued, queuedAt; row.Files == 0 {
+				row.Status, row.QueuedAt = BatchUpToDate, time.Time{}
+			}
+		}
+		if err != nil {
+			row.Status, row.Error = BatchFailed, err.Error()
+			logging.Logger.WarnContext(ctx, "migration row failed", "migration", migration.Id, "repo", row.Row.RepoName, "folder", row.Row.Folder, "error", err)
+		}
+		saveMigration(ctx, migration)
+	}
+	logging.Logger.InfoContext(ctx, "migration queued", "migration", migration.Id, "rows", len(migration.Rows))
+}
+
+// failInterruptedRows fails the rows that were not queued when the instance running the migration is gone (e.g., restarted),
+// it tells whether rows were failed
+func failInterruptedRows(ctx context.Context, migration *storedMigration) bool {
+	failed := false
+	for i, row := range migration.Rows {
+		if row.Status != BatchPending && row.Status != MigrationCreating && row.Status != BatchComparing {
+			continue
+		}
+		if !failed && core.LeaseHeld(ctx, migrationLeaseKey(migration.Id)) {
+			return false
+		}
+		migration.Rows[i].Status, migration.Rows[i].Error = BatchFailed, "the migration was interrupted before the row was queued"
+		failed = true
+	}
+	if failed {
+		logging.Logger.WarnContext(ctx, "migration interrupted", "migration", migration.Id)
+	}
+	return failed
+}
+
+func migrationSource(req types.CompareRequest, row MigrationRow) types.CompareRequest {
+	if row.RepoName != "" {
+		req.RepoName = row.RepoName
+	}
+	if row.Option != "" {
+		req.Option = row.Option
+	}
+	return req
+}
+
+// createDataset creates the dataset of the row in its collection, the metadata of the row goes before the metadata of the metadata
+// file of the source, followed by the defaults of the request; it returns the persistent id and the metadata file that was read
+func createDataset(ctx context.Context, source types.CompareRequest, defaults core.DatasetMetadata, row MigrationRow, user string) (string, string, error) {
+	source.Token = core.GetTokenFromCache(ctx, source.Token, source.Token, source.PluginId)
+	fileMetadata, file, err := readMetadataFile(ctx, source, row.Folder)
+	if err != nil {
+		return "", "", err
+	}
+	metadata := core.DatasetMetadata{Title: row.Title, Description: row.Description, Subjects: row.Subjects}
+	metadata = metadata.Merge(fileMetadata).Merge(defaults).WithOrcidContributor(ctx, user)
+	pid, err := core.Destination.CreateNewRepo(ctx, row.Collection, source.DataverseKey, user, metadata)
+	if err != nil {
+		return "", "", fmt.Errorf("creating the dataset failed: %w", err)
+	}
+	core.AuditDatasetCreated(ctx, user, row.Collection, pid)
+	return pid, file, nil
+}
+
+// readMetadataFile reads the first metadata file found in the folder of the source, it returns empty metadata when there is none;
+// the folder must contain files, no dataset is created for a mistyped folder
+func readMetadataFile(ctx context.Context, req types.CompareRequest, folder string) (core.DatasetMetadata, string, error) {
+	queryCtx, cancel := context.WithTimeout(ctx, core.CompareTimeout())
+	defer cancel()
+	nodes, err := queryRepository(queryCtx, req, map[string]tree.Node{})
+	if err != nil {
+		return core.DatasetMetadata{}, "", fmt.Errorf("querying the repository failed: %w", err)
+	}
+	folder = strings.Trim(folder, "/")
+	if folder != "" && len(folderNodes(nodes, folder)) == 0 {
+		return core.DatasetMetadata{}, "", fmt.Errorf("no files found in the source folder %q", folder)
+	}
+	for _, name := range core.MetadataFiles {
+		id := path.Join(folder, name)
+		node, ok := nodes[id]
+		if !ok || !node.Attributes.IsFile || node.Attributes.RemoteFilesize > maxMetadataFileSize {
+			continue
+		}
+		content, err := readSourceFile(queryCtx, req, node)
+		if err != nil {
+			return core.DatasetMetadata{}, "", fmt.Errorf("reading %v failed: %w", id, err)
+		}
+		md, err := core.ParseMetadataFile(name, content)
+		return md, id, err
+	}
+	return core.DatasetMetadata{}, "", nil
+}
+
+func readSourceFile(ctx context.Context, req types.CompareRequest, node tree.Node) (content []byte, err error) {
+	params := types.StreamParams{PluginId: req.PluginId, RepoName: req.RepoName, Url: req.Url, Option: req.Option, User: req.User, Token: req.Token}
+	streams, err := plugin.GetPlugin(req.Plugin).Streams(ctx, map[string]tree.Node{node.Id: node}, params)
+	if err != nil {
+		return nil, err
+	}
+	if streams.Cleanup != nil {
+		defer func() {
+			if cleanupErr := streams.Cleanup(); err == nil {
+				err = cleanupErr
+			}
+		}()
+	}
+	s, ok := streams.Streams[node.Id]
+	if !ok {
+		return nil, fmt.Errorf("no stream")
+	}
+	reader, err := s.Open(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	return io.ReadAll(io.LimitReader(reader, maxMetadataFileSize))
+}
+
+func saveMigration(ctx context.Context, migration storedMigration) error {
+	b, err := json.Marshal(migration)
+	if err != nil {
+		return err
+	}
+	return config.GetRedis().Set(ctx, migrationKey(migration.Id), string(b), batchCacheDuration)
+}
+
+func loadMigration(ctx context.Context, id string) (storedMigration, bool) {
+	res := storedMigration{}
+	cached, _ := config.GetRedis().Get(ctx, migrationKey(id))
+	if cached == "" || json.Unmarshal([]byte(cached), &res) != nil {
+		return res, false
+	}
+	return res, true
+}
@@ -0,0 +1,103 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package compare
+
+import (
+	"fmt"
+	"integration/app/core"
+	"integration/app/tree"
+	"path"
+	"sort"
+	"strings"
+)
+
+// sanitizeNodes maps the paths of the repository to the paths accepted by Dataverse (see tree.SanitizeId), the files whose
+// paths collide after the mapping are rejected; the files added to the dataset before the mapping existed keep their path
+func sanitizeNodes(repoNm, dvNm map[string]tree.Node) (map[string]tree.Node, []string, []core.Warning) {
+	res := map[string]tree.Node{}
+	origins := map[string][]string{}
+	for _, v := range repoNm {
+		id := tree.SanitizeId(v.Id)
+		if _, ok := dvNm[v.Id]; ok {
+			id = v.Id
+		}
+		origins[id] = append(origins[id], v.Id)
+		if id != v.Id {
+			v.Attributes.OriginalPath = v.SourceId()
+			v.Id = id
+			v.Name = id[strings.LastIndex(id, "/")+1:]
+			v.Path = strings.TrimSuffix(strings.TrimSuffix(id, v.Name), "/")
+		}
+		res[id] = v
+	}
+	rejected := []string{}
+	warnings := []core.Warning{}
+	for id, o := range origins {
+		if len(o) > 1 {
+			delete(res, id)
+			rejected = append(rejected, o...)
+			sort.Strings(o)
+			warnings = append(warnings, core.Warning{
+				Type:    core.WarningCollision,
+				Id:      id,
+				Paths:   o,
+				Message: fmt.Sprintf("%v map to the same path %v in the dataset and are not synchronized: rename all but one of them in the repository", strings.Join(o, ", "), id),
+			})
+		}
+	}
+	warnings = append(warnings, caseCollisions(res)...)
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Id < warnings[j].Id })
+	return res, rejected, warnings
+}
+
+// ValidFolder checks the folder of a compare request, a relative path within the repository
+func ValidFolder(folder string) bool {
+	f := strings.Trim(folder, "/")
+	return folder == "" || (f != "" && path.Clean(f) == f && f != ".." && !strings.HasPrefix(f, "../"))
+}
+
+// folderNodes keeps the nodes within the folder, with the folder removed from their ids (the source path is kept in the
+// original path), so that the folder is compared with the root of the dataset
+func folderNodes(repoNm map[string]tree.Node, folder string) map[string]tree.Node {
+	prefix := strings.Trim(folder, "/") + "/"
+	res := map[string]tree.Node{}
+	for _, v := range repoNm {
+		id, ok := strings.CutPrefix(v.Id, prefix)
+		if !ok || id == "" {
+			continue
+		}
+		v.Attributes.OriginalPath = v.SourceId()
+		v.Id = id
+		v.Path = strings.TrimSuffix(strings.TrimSuffix(id, v.Name), "/")
+		res[id] = v
+	}
+	return res
+}
+
+// caseCollisions: Dataverse accepts the files that only differ in case, they are synchronized but the user is warned
+func caseCollisions(nodes map[string]tree.Node) []core.Warning {
+	ids := map[string][]string{}
+	for id, v := range nodes {
+		if v.Attributes.IsFile {
+			ids[strings.ToLower(id)] = append(ids[strings.ToLower(id)], id)
+		}
+	}
+	res := []core.Warning{}
+	for _, same := range ids {
+		if len(same) < 2 {
+			continue
+		}
+		sort.Strings(same)
+		paths := []string{}
+		for _, id := range same {
+			paths = append(paths, nodes[id].SourceId())
+		}
+		res = append(res, core.Warning{
+			Type:    core.WarningCaseCollision,
+			Id:      same[0],
+			Paths:   paths,
+			Message: fmt.Sprintf("%v only differ in case and overwrite each other when the dataset is downloaded on a case-insensitive file system (e.g., Windows or macOS): rename all but one of them in the repository", strings.Join(paths, ", ")),
+		})
+	}
+	return res
+}
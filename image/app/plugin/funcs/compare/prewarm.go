@@ -0,0 +1,115 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package compare
+
+import (
+	"context"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"integration/app/plugin/types"
+	"os"
+	"time"
+)
+
+const prewarmLockKey = "prewarm lock"
+
+// prewarmedResult is the result of a background compare, usable as long as the dataset did not change
+type prewarmedResult struct {
+	Response       common.CachedResponse `json:"response"`
+	DatasetVersion string                `json:"datasetVersion"` // last update time of the dataset when compared
+}
+
+func prewarmedKey(id string) string {
+	return "prewarmed: " + id
+}
+
+// Prewarm refreshes the compare results of the registered connections every interval (see the prewarm option), one replica at a time
+func Prewarm() {
+	for {
+		wait := time.Duration(config.GetConfig().Options.Prewarm.Interval) * time.Minute
+		if wait <= 0 {
+			// not enabled (yet), the option can be changed with a reload
+			wait = time.Minute
+		}
+		select {
+		case <-core.Stop:
+			return
+		case <-time.After(wait):
+		}
+		if core.PrewarmEnabled() {
+			prewarmAll(time.Duration(config.GetConfig().Options.Prewarm.Interval) * time.Minute)
+		}
+	}
+}
+
+func prewarmAll(interval time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), interval)
+	defer cancel()
+	// the lock expires just before the next interval, on whichever replica reaches it first
+	host, _ := os.Hostname()
+	if ok, _ := config.GetRedis().SetNX(ctx, prewarmLockKey, host, interval-10*time.Second); !ok {
+		return
+	}
+	prewarms, err := core.ListPrewarms(ctx)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "listing prewarm registrations failed", "error", err)
+		return
+	}
+	refreshed := 0
+	for _, p := range prewarms {
+		select {
+		case <-core.Stop:
+			return
+		case <-ctx.Done():
+			logging.Logger.WarnContext(ctx, "prewarming did not finish within the interval", "refreshed", refreshed, "registered", len(prewarms))
+			return
+		default:
+		}
+		targetCtx := config.WithTarget(ctx, p.Target)
+		version := datasetVersion(targetCtx, p.Request, p.User)
+		res := compareRepository(targetCtx, p.Request, "", p.User)
+		if res.ErrorMessage != "" {
+			logging.Logger.WarnContext(ctx, "prewarming compare failed", "persistentId", p.Request.PersistentId, "repo", p.Request.RepoName, "user", p.User, "error", res.ErrorMessage)
+			continue
+		}
+		encoded, err := core.EncodeCached(prewarmedResult{res, version})
+		if err != nil {
+			logging.Logger.WarnContext(ctx, "prewarming compare could not be cached", "persistentId", p.Request.PersistentId, "error", err)
+			continue
+		}
+		config.GetRedis().Set(ctx, prewarmedKey(p.Id), encoded, 2*interval)
+		refreshed++
+	}
+	logging.Logger.InfoContext(ctx, "prewarmed compares", "refreshed", refreshed, "registered", len(prewarms))
+}
+
+// prewarmedResponse returns the result of the background compare of the connection, when the dataset did not change since then
+func prewarmedResponse(ctx context.Context, req types.CompareRequest, user string) (common.CachedResponse, bool) {
+	if !core.PrewarmEnabled() {
+		return common.CachedResponse{}, false
+	}
+	cached, _ := config.GetRedis().Get(ctx, prewarmedKey(core.PrewarmId(ctx, user, req)))
+	res := prewarmedResult{}
+	if cached == "" || core.DecodeCached(cached, &res) != nil {
+		return common.CachedResponse{}, false
+	}
+	// the status of a running job must be current, and the permission could have been revoked in the meantime
+	if core.IsLocked(ctx, req.PersistentId) || core.Destination.CheckPermission(ctx, req.DataverseKey, user, req.PersistentId) != nil {
+		return common.CachedResponse{}, false
+	}
+	if v := datasetVersion(ctx, req, user); v == "" || v != res.DatasetVersion {
+		return common.CachedResponse{}, false
+	}
+	res.Response.Prewarmed = true
+	return res.Response, true
+}
+
+func datasetVersion(ctx context.Context, req types.CompareRequest, user string) string {
+	if core.Destination.GetLastUpdateTime == nil {
+		return ""
+	}
+	v, _ := core.Destination.GetLastUpdateTime(ctx, req.DataverseKey, user, req.PersistentId)
+	return v
+}
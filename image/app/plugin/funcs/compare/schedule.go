@@ -0,0 +1,189 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package compare
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"net/http"
+	"time"
+)
+
+const (
+	minScheduleInterval = 15 // minutes
+	// the due schedules are claimed in portions, the remaining ones on the next tick
+	schedulesPerTick = 10
+	scheduleTick     = time.Minute
+)
+
+// ScheduleRequest repeats the batch every interval, with the credentials of the request
+type ScheduleRequest struct {
+	Batch    BatchRequest `json:"batch"`
+	Interval int          `json:"interval"` // minutes between the runs, at least 15
+}
+
+type ScheduleIdRequest struct {
+	Id string `json:"id"`
+}
+
+type SchedulesResponse struct {
+	Schedules []core.Schedule `json:"schedules"`
+}
+
+// Schedule stores the batch for the periodic runs, the first run is one interval later
+func Schedule(w http.ResponseWriter, r *http.Request) {
+	if !core.SchedulesEnabled() {
+		common.WriteError(w, r, http.StatusNotImplemented, errors.New("the schedules need the history database, which is not configured"))
+		return
+	}
+	req := ScheduleRequest{}
+	if !common.DecodeRequest(w, r, &req) {
+		return
+	}
+	if req.Interval < minScheduleInterval {
+		common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("the interval must be at least %d minutes", minScheduleInterval))
+		return
+	}
+	if err := validateBatch(r.Context(), req.Batch); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, errScope) {
+			status = http.StatusForbidden
+		}
+		common.WriteError(w, r, status, err)
+		return
+	}
+	// a credential reference expires, the schedule keeps the API key itself
+	dataverseKey, err := core.ResolveCredential(r.Context(), req.Batch.Request.DataverseKey)
+	if err != nil {
+		common.WriteError(w, r, http.StatusForbidden, err)
+		return
+	}
+	user := core.GetUserFromHeader(r.Header)
+	s := core.Schedule{
+		User:         user,
+		Target:       config.TargetName(r.Context()),
+		Interval:     req.Interval,
+		DataverseKey: dataverseKey,
+		Token:        req.Batch.Request.Token,
+	}
+	// the credentials are stored encrypted, next to the request
+	req.Batch.Request.DataverseKey, req.Batch.Request.Token = "", ""
+	s.Request, err = json.Marshal(req.Batch)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	s, err = core.CreateSchedule(r.Context(), s)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	logging.Logger.InfoContext(r.Context(), "batch scheduled", "schedule", s.Id, "interval", s.Interval, "items", len(req.Batch.Items))
+	b, err := json.Marshal(s)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// Schedules lists the schedules of the user, with the outcome of their last run
+func Schedules(w http.ResponseWriter, r *http.Request) {
+	user := core.GetUserFromHeader(r.Header)
+	if user == "" {
+		common.WriteError(w, r, http.StatusForbidden, errors.New("unknown user"))
+		return
+	}
+	schedules, err := core.ListSchedules(r.Context(), user)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	b, err := json.Marshal(SchedulesResponse{Schedules: schedules})
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
+
+// Unschedule deletes the schedule of the user, with its credentials
+func Unschedule(w http.ResponseWriter, r *http.Request) {
+	req := ScheduleIdRequest{}
+	if !common.DecodeRequest(w, r, &req) {
+		return
+	}
+	deleted, err := core.DeleteSchedule(r.Context(), core.GetUserFromHeader(r.Header), req.Id)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	if !deleted {
+		common.WriteError(w, r, http.StatusNotFound, fmt.Errorf("schedule %v not found", req.Id))
+		return
+	}
+	w.Write([]byte("OK"))
+}
+
+// RunSchedules starts the batches of the due schedules, on whichever instance claims them first
+func RunSchedules() {
+	for {
+		select {
+		case <-core.Stop:
+			return
+		case <-time.After(scheduleTick):
+		}
+		if core.SchedulesEnabled() && config.RedisReady(context.Background()) {
+			runDueSchedules()
+		}
+	}
+}
+
+func runDueSchedules() {
+	ctx, cancel := context.WithTimeout(context.Background(), scheduleTick)
+	schedules, err := core.ClaimDueSchedules(ctx, schedulesPerTick)
+	cancel()
+	if err != nil {
+		logging.Logger.Error("claiming the due schedules failed", "error", err)
+		return
+	}
+	for _, s := range schedules {
+		batchId, err := startScheduledBatch(s)
+		runErr := ""
+		if err != nil {
+			runErr = err.Error()
+			logging.Logger.Warn("scheduled batch could not be started", "schedule", s.Id, "user", s.User, "error", err)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), scheduleTick)
+		if err := core.SetScheduleRun(ctx, s.Id, batchId, runErr); err != nil {
+			logging.Logger.Error("recording the scheduled run failed", "schedule", s.Id, "error", err)
+		}
+		cancel()
+	}
+}
+
+// startScheduledBatch starts the batch of the schedule as a batch request of the user, its status is available at /api/plugin/batchstatus
+func startScheduledBatch(s core.Schedule) (string, error) {
+	req := BatchRequest{}
+	if err := json.Unmarshal(s.Request, &req); err != nil {
+		return "", err
+	}
+	req.Request.DataverseKey, req.Request.Token = s.DataverseKey, s.Token
+	ctx := config.WithTarget(logging.WithCorrelationId(context.Background(), logging.NewCorrelationId()), s.Target)
+	if err := validateBatch(ctx, req); err != nil {
+		return "", err
+	}
+	batch := newBatch(req, s.User)
+	if err := saveBatch(ctx, batch); err != nil {
+		return "", err
+	}
+	logging.Logger.InfoContext(ctx, "scheduled batch started", "schedule", s.Id, "batch", batch.Id, "items", len(batch.Items))
+	go runBatch(ctx, req, batch)
+	return batch.Id, nil
+}
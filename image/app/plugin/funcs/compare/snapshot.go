@@ -0,0 +1,56 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package compare
+
+import (
+	"context"
+	"errors"
+	"integration/app/core"
+	"integration/app/logging"
+	"integration/app/plugin"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"maps"
+)
+
+// queryRepository returns the tree of the repository from the cached snapshot when the revision did not change,
+// applies the changes since the revision of the snapshot when the plugin supports it, or queries the full tree
+func queryRepository(ctx context.Context, req types.CompareRequest, nm map[string]tree.Node) (map[string]tree.Node, error) {
+	p := plugin.GetPlugin(req.Plugin)
+	if p.Revision == nil || !core.SnapshotsEnabled() {
+		return p.Query(ctx, req, nm)
+	}
+	revision, err := p.Revision(ctx, req)
+	if err != nil || revision == "" {
+		logging.Logger.WarnContext(ctx, "getting repository revision failed, querying the full tree", "plugin", req.Plugin, "repo", req.RepoName, "error", err)
+		return p.Query(ctx, req, nm)
+	}
+	key := core.RepositorySnapshotKey(req.Plugin, req.Url, req.RepoName, req.Option)
+	snapshot, ok := core.GetSnapshot(ctx, key)
+	if ok && snapshot.Revision == revision {
+		logging.Logger.DebugContext(ctx, "repository tree from snapshot", "plugin", req.Plugin, "repo", req.RepoName, "revision", revision)
+		return snapshot.Nodes, nil
+	}
+	var res map[string]tree.Node
+	if ok && p.Changes != nil {
+		res, err = p.Changes(ctx, req, snapshot.Revision, revision, maps.Clone(snapshot.Nodes))
+		if errors.Is(err, types.ErrUnauthorized) {
+			return nil, err
+		}
+		if err != nil {
+			logging.Logger.InfoContext(ctx, "incremental query failed, querying the full tree", "plugin", req.Plugin, "repo", req.RepoName, "error", err)
+			res = nil
+		}
+	}
+	if res == nil {
+		// the tree of the revision itself, the branch could have moved in the meantime
+		atRevision := req
+		atRevision.Option = revision
+		res, err = p.Query(ctx, atRevision, nm)
+		if err != nil {
+			return nil, err
+		}
+	}
+	core.StoreSnapshot(ctx, key, revision, res)
+	return res, nil
+}
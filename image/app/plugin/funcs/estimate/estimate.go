@@ -0,0 +1,62 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package estimate
+
+import (
+	"encoding/json"
+	"fmt"
+	"integration/app/common"
+	"integration/app/core"
+	"integration/app/plugin"
+	"integration/app/plugin/types"
+	"net/http"
+)
+
+type EstimateResponse struct {
+	types.Estimate
+	MaxFileSize int64                         `json:"maxFileSize,omitempty"`
+	TooLarge    []string                      `json:"tooLarge,omitempty"` // files from the largest files list that exceed the maximum file size
+	Limits      map[string]core.FileSizeLimit `json:"limits,omitempty"`   // the applied limit of each file of tooLarge
+}
+
+// Estimate returns the repository statistics (file count, total size, largest files) without building the full node map,
+// so the UI can warn about infeasible transfers before starting the compare
+func Estimate(w http.ResponseWriter, r *http.Request) {
+	req := types.CompareRequest{}
+	if !common.DecodeRequest(w, r, &req) {
+		return
+	}
+	estimate := plugin.GetPlugin(req.Plugin).Estimate
+	if estimate == nil {
+		common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("estimate is not supported for plugin %v", req.Plugin))
+		return
+	}
+	req.Token = core.GetTokenFromCache(r.Context(), req.Token, req.Token, req.PluginId)
+	res, err := estimate(r.Context(), req)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	// the limits of the dataset are known when the estimate is for a dataset
+	limits := core.StorageLimits{}
+	if req.PersistentId != "" {
+		limits = core.GetStorageLimits(r.Context(), req.DataverseKey, core.GetUserFromHeader(r.Header), req.PersistentId)
+	}
+	sizeLimits := core.NewFileSizeLimits(r.Context(), req.Plugin, req.PluginId, limits.StorageDriver, limits.MaxFileSize, false)
+	response := EstimateResponse{Estimate: res, MaxFileSize: sizeLimits.Files().Limit}
+	for _, f := range res.LargestFiles {
+		if limit := sizeLimits.For(f.Id); limit.Exceeded(f.Size) {
+			response.TooLarge = append(response.TooLarge, f.Id)
+			if response.Limits == nil {
+				response.Limits = map[string]core.FileSizeLimit{}
+			}
+			response.Limits[f.Id] = limit
+		}
+	}
+	b, err := json.Marshal(response)
+	if err != nil {
+		common.WriteError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	w.Write(b)
+}
@@ -4,29 +4,18 @@ package options
 
 import (
 	"encoding/json"
-	"fmt"
+	"integration/app/common"
 	"integration/app/core"
 	"integration/app/plugin"
 	"integration/app/plugin/types"
-	"io"
 	"net/http"
 )
 
 func Options(w http.ResponseWriter, r *http.Request) {
 	//process requeststream
-	b, err := io.ReadAll(r.Body)
-	r.Body.Close()
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
-		return
-	}
 
 	params := types.OptionsRequest{}
-	err = json.Unmarshal(b, &params)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("500 - bad request"))
+	if !common.DecodeRequest(w, r, &params) {
 		return
 	}
 
@@ -36,20 +25,17 @@ func Options(w http.ResponseWriter, r *http.Request) {
 	}
 	res, err := plugin.GetPlugin(params.Plugin).Options(r.Context(), params)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		common.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		common.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
-	b, err = json.Marshal(res)
+	b, err := json.Marshal(res)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(fmt.Sprintf("500 - %v", err)))
+		common.WriteError(w, r, http.StatusInternalServerError, err)
 		return
 	}
 	w.Write(b)
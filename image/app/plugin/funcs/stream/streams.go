@@ -12,3 +12,20 @@ import (
 func Streams(ctx context.Context, nodeMap map[string]tree.Node, pluginName string, streamParams types.StreamParams) (types.StreamsType, error) {
 	return plugin.GetPlugin(pluginName).Streams(ctx, nodeMap, streamParams)
 }
+
+// Revision returns the current revision (e.g., the commit) of the repository, empty when the plugin has no revisions
+func Revision(ctx context.Context, pluginName string, p types.StreamParams) (string, error) {
+	revision := plugin.GetPlugin(pluginName).Revision
+	if revision == nil {
+		return "", nil
+	}
+	return revision(ctx, types.CompareRequest{
+		PluginId: p.PluginId,
+		Plugin:   pluginName,
+		RepoName: p.RepoName,
+		Url:      p.Url,
+		Option:   p.Option,
+		User:     p.User,
+		Token:    p.CurrentToken(),
+	})
+}
@@ -10,7 +10,7 @@ import (
 	"io"
 )
 
-func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
+func Streams(_ context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
 	res := map[string]types.Stream{}
 	client := NewClient(streamParams.PluginId, streamParams.Url, streamParams.User, streamParams.Token)
 	for k, v := range in {
@@ -18,7 +18,7 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 		var err error
 		req := client.NewRequest(v.Attributes.URL, "GET", nil, nil)
 		res[k] = types.Stream{
-			Open: func() (io.Reader, error) {
+			Open: func(ctx context.Context) (io.Reader, error) {
 				reader, err = api.DoStream(ctx, req)
 				return reader, err
 			},
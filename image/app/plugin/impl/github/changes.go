@@ -0,0 +1,125 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package github
+
+import (
+	"context"
+	"integration/app/httpclient"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"path"
+	"strings"
+
+	"github.com/google/go-github/github"
+	"golang.org/x/oauth2"
+)
+
+// the compare API lists at most 300 files
+const maxCompareFiles = 300
+
+// the rate limit (per hour) of the requests without a token
+const anonymousRateLimit = 60
+
+// apiClient returns the client authenticated with the token source, or an unauthenticated client for the public repositories when there
+// is no token (GitHub allows only 60 requests per hour without a token)
+func apiClient(ctx context.Context, ts oauth2.TokenSource) (*github.Client, func()) {
+	if ts == nil {
+		return github.NewClient(httpclient.Get("github")), func() {}
+	}
+	tc := oauth2.NewClient(context.WithValue(ctx, oauth2.HTTPClient, httpclient.Get("github")), ts)
+	return github.NewClient(tc), tc.CloseIdleConnections
+}
+
+// staticToken is the token source of the token, nil when there is no token
+func staticToken(token string) oauth2.TokenSource {
+	if token == "" {
+		return nil
+	}
+	return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: token})
+}
+
+func newClient(ctx context.Context, req types.CompareRequest) (*github.Client, func(), string, string) {
+	client, closeIdle := apiClient(ctx, staticToken(req.Token))
+	user := ""
+	repo := ""
+	splitted := strings.Split(req.RepoName, "/")
+	if len(splitted) > 1 {
+		user = splitted[0]
+		repo = strings.Join(splitted[1:], "/")
+	}
+	return client, closeIdle, user, repo
+}
+
+// Revision returns the commit of the branch (or tag) to compare
+func Revision(ctx context.Context, req types.CompareRequest) (string, error) {
+	client, closeIdle, user, repo := newClient(ctx, req)
+	defer closeIdle()
+	sha, _, err := client.Repositories.GetCommitSHA1(ctx, user, repo, req.Option, "")
+	if err != nil {
+		return "", githubError(err)
+	}
+	return sha, nil
+}
+
+// Changes applies the files changed between the commits to the nodes, the changed folders are listed to get the sizes of the files
+func Changes(ctx context.Context, req types.CompareRequest, from, to string, nodes map[string]tree.Node) (map[string]tree.Node, error) {
+	client, closeIdle, user, repo := newClient(ctx, req)
+	defer closeIdle()
+	comparison, _, err := client.Repositories.CompareCommits(ctx, user, repo, from, to)
+	if err != nil {
+		return nil, githubError(err)
+	}
+	// the status is "diverged" or "behind" when the history was rewritten, the renamed files do not have their previous name in this API version
+	if (comparison.GetStatus() != "ahead" && comparison.GetStatus() != "identical") || len(comparison.Files) >= maxCompareFiles {
+		return nil, types.ErrTooManyChanges
+	}
+	folders := map[string]bool{}
+	changed := map[string]bool{}
+	for _, f := range comparison.Files {
+		switch f.GetStatus() {
+		case "removed":
+			delete(nodes, f.GetFilename())
+		case "renamed":
+			return nil, types.ErrTooManyChanges
+		default:
+			folders[parentFolder(f.GetFilename())] = true
+			changed[f.GetFilename()] = true
+		}
+	}
+	for folder := range folders {
+		_, entries, _, err := client.Repositories.GetContents(ctx, user, repo, folder, &github.RepositoryContentGetOptions{Ref: to})
+		if err != nil {
+			return nil, githubError(err)
+		}
+		for _, e := range entries {
+			if e.GetType() != "file" {
+				continue
+			}
+			delete(changed, e.GetPath())
+			nodes[e.GetPath()] = tree.Node{
+				Id:   e.GetPath(),
+				Name: e.GetName(),
+				Path: parentFolder(e.GetPath()),
+				Attributes: tree.Attributes{
+					URL:            e.GetGitURL(),
+					IsFile:         true,
+					RemoteHash:     e.GetSHA(),
+					RemoteHashType: types.GitHash,
+					RemoteFilesize: int64(e.GetSize()),
+				},
+			}
+		}
+	}
+	// e.g., symbolic links or the folders with more than 1000 files
+	if len(changed) > 0 {
+		return nil, types.ErrTooManyChanges
+	}
+	return nodes, nil
+}
+
+func parentFolder(id string) string {
+	if dir := path.Dir(id); dir != "." {
+		return dir
+	}
+	return ""
+}
@@ -0,0 +1,45 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package github
+
+import (
+	"context"
+	"integration/app/plugin/types"
+	"sort"
+)
+
+const largestFilesCount = 10
+
+func Estimate(ctx context.Context, req types.CompareRequest) (types.Estimate, error) {
+	client, closeIdle, user, repo := newClient(ctx, req)
+	defer closeIdle()
+	tr, _, err := client.Git.GetTree(ctx, user, repo, req.Option, true)
+	if err != nil {
+		return types.Estimate{}, githubError(err)
+	}
+	res := types.Estimate{Approximate: tr.GetTruncated()}
+	files := []types.LargeFile{}
+	for _, e := range tr.Entries {
+		if e.GetType() != "blob" {
+			continue
+		}
+		res.FileCount++
+		res.TotalSize += int64(e.GetSize())
+		files = append(files, types.LargeFile{Id: e.GetPath(), Size: int64(e.GetSize())})
+	}
+	if tr.GetTruncated() {
+		// the tree is too large to be returned at once, fall back on the repository size (in KB, including the history)
+		r, _, err := client.Repositories.Get(ctx, user, repo)
+		if err != nil {
+			return types.Estimate{}, err
+		}
+		res.FileCount = -1
+		res.TotalSize = int64(r.GetSize()) * 1024
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Size > files[j].Size })
+	if len(files) > largestFilesCount {
+		files = files[:largestFilesCount]
+	}
+	res.LargestFiles = files
+	return res, nil
+}
@@ -10,7 +10,6 @@ import (
 	"strings"
 
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 func Options(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error) {
@@ -21,21 +20,16 @@ func Options(ctx context.Context, params types.OptionsRequest) ([]types.SelectIt
 		user = splitted[0]
 		repo = strings.Join(splitted[1:], "/")
 	}
-	token := params.Token
-	if user == "" || repo == "" || token == "" {
-		return nil, fmt.Errorf("branches: missing parameters: expected user, repo and token")
+	if user == "" || repo == "" {
+		return nil, fmt.Errorf("branches: missing parameters: expected user and repo")
 	}
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	defer tc.CloseIdleConnections()
-	client := github.NewClient(tc)
+	client, closeIdle := apiClient(ctx, staticToken(params.Token))
+	defer closeIdle()
 
 	opt := &github.ListOptions{Page: 1, PerPage: 100}
 	b, _, err := client.Repositories.ListBranches(ctx, user, repo, opt)
 	if err != nil {
-		return nil, err
+		return nil, githubError(err)
 	}
 	branches := []*github.Branch{}
 	branches = append(branches, b...)
@@ -43,14 +37,14 @@ func Options(ctx context.Context, params types.OptionsRequest) ([]types.SelectIt
 	for ; len(b) > 0; opt.Page++ {
 		b, _, err = client.Repositories.ListBranches(ctx, user, repo, opt)
 		if err != nil {
-			return nil, err
+			return nil, githubError(err)
 		}
 		branches = append(branches, b...)
 	}
 
 	r, _, err := client.Repositories.Get(ctx, user, repo)
 	if err != nil {
-		return nil, err
+		return nil, githubError(err)
 	}
 	defaultBranch := r.GetDefaultBranch()
 	masterBranch := r.GetMasterBranch()
@@ -4,31 +4,23 @@ package github
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"integration/app/plugin/types"
 	"integration/app/tree"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
-	"golang.org/x/oauth2"
 )
 
 func Query(ctx context.Context, req types.CompareRequest, _ map[string]tree.Node) (map[string]tree.Node, error) {
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: req.Token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	defer tc.CloseIdleConnections()
-	client := github.NewClient(tc)
-	user := ""
-	repo := ""
-	splitted := strings.Split(req.RepoName, "/")
-	if len(splitted) > 1 {
-		user = splitted[0]
-		repo = strings.Join(splitted[1:], "/")
-	}
+	client, closeIdle, user, repo := newClient(ctx, req)
+	defer closeIdle()
 	tr, _, err := client.Git.GetTree(ctx, user, repo, req.Option, true)
 	if err != nil {
-		return nil, err
+		return nil, githubError(err)
 	}
 	return toNodeMap(tr), nil
 }
@@ -65,3 +57,25 @@ func toNodeMap(tr *github.Tree) map[string]tree.Node {
 	}
 	return res
 }
+
+// githubError wraps types.ErrUnauthorized in the errors of the rejected tokens and types.ErrRateLimited in the errors of the exceeded
+// rate limits, with the time when the limit is reset
+func githubError(err error) error {
+	var rateErr *github.RateLimitError
+	if errors.As(err, &rateErr) {
+		hint := ""
+		if rateErr.Rate.Limit <= anonymousRateLimit {
+			hint = ", log in to GitHub for a higher limit"
+		}
+		return fmt.Errorf("%w: retry after %v%v: %v", types.ErrRateLimited, rateErr.Rate.Reset.Time.Format(time.RFC3339), hint, err)
+	}
+	var abuseErr *github.AbuseRateLimitError
+	if errors.As(err, &abuseErr) {
+		return fmt.Errorf("%w: %v", types.ErrRateLimited, err)
+	}
+	var e *github.ErrorResponse
+	if errors.As(err, &e) && e.Response != nil && e.Response.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %v", types.ErrUnauthorized, err)
+	}
+	return err
+}
@@ -0,0 +1,40 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package github
+
+import (
+	"context"
+	"fmt"
+	"integration/app/plugin/types"
+	"net/http"
+	"strings"
+)
+
+// Scopes checks that the token can read the repository: GitHub answers "not found" for the private repositories that the token can not
+// access, e.g., a classic token without the repo scope (its scopes are listed in the X-OAuth-Scopes header) or a fine-grained token
+// not granted that repository
+func Scopes(ctx context.Context, req types.CompareRequest) error {
+	if req.Token == "" {
+		// the public repositories are read without a token
+		return nil
+	}
+	client, closeIdle, user, repo := newClient(ctx, req)
+	defer closeIdle()
+	if user == "" || repo == "" {
+		return fmt.Errorf("missing parameters: expected user and repo")
+	}
+	r, resp, err := client.Repositories.Get(ctx, user, repo)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		if scopes, ok := resp.Header["X-Oauth-Scopes"]; ok {
+			return fmt.Errorf("%w: repository %v not found or not accessible with the token (scopes: %q), the repo scope is needed for the private repositories", types.ErrInsufficientScope, req.RepoName, strings.Join(scopes, ", "))
+		}
+		return fmt.Errorf("%w: repository %v not found or not accessible with the token, the token must be granted read access to its contents", types.ErrInsufficientScope, req.RepoName)
+	}
+	if err != nil {
+		return githubError(err)
+	}
+	if r.Permissions != nil && !(*r.Permissions)["pull"] {
+		return fmt.Errorf("%w: the token can not read the contents of repository %v", types.ErrInsufficientScope, req.RepoName)
+	}
+	return nil
+}
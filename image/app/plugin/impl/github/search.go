@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"io"
 	"net/http"
@@ -21,22 +22,25 @@ type Item struct {
 
 func Search(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error) {
 	token := params.Token
-	if token == "" {
-		return nil, fmt.Errorf("not authorized")
-	}
 	url := "https://api.github.com/search/repositories?q=" + params.RepoName
 	request, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
 	request.Header.Add("Accept", "application/vnd.github+json")
-	request.Header.Add("Authorization", "Bearer "+token)
+	if token != "" {
+		// without a token, GitHub allows 10 searches per minute
+		request.Header.Add("Authorization", "Bearer "+token)
+	}
 	request.Header.Add("X-GitHub-Api-Version", "2022-11-28")
-	r, err := http.DefaultClient.Do(request)
+	r, err := httpclient.Get("github").Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %v", err)
 	}
 	defer r.Body.Close()
 	if r.StatusCode != 200 {
 		b, _ := io.ReadAll(r.Body)
-		return nil, fmt.Errorf("search failed: %d - %s", r.StatusCode, string(b))
+		if r.Header.Get("X-RateLimit-Remaining") == "0" {
+			return nil, fmt.Errorf("search failed: %w: %s", types.ErrRateLimited, b)
+		}
+		return nil, fmt.Errorf("search failed: %w", types.StatusError(r.StatusCode, b))
 	}
 	b, _ := io.ReadAll(r.Body)
 	results := SearchResults{}
@@ -9,6 +9,7 @@ import (
 	"integration/app/tree"
 	"io"
 	"strings"
+	"time"
 
 	"github.com/google/go-github/github"
 	"golang.org/x/oauth2"
@@ -22,18 +23,17 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 		user = splitted[0]
 		repo = strings.Join(splitted[1:], "/")
 	}
-	token := streamParams.Token
-	if user == "" || repo == "" || token == "" {
-		return types.StreamsType{}, fmt.Errorf("streams: missing parameters: expected user, repo and token")
+	if user == "" || repo == "" {
+		return types.StreamsType{}, fmt.Errorf("streams: missing parameters: expected user and repo")
 	}
 	res := map[string]types.Stream{}
-	ts := oauth2.StaticTokenSource(
-		&oauth2.Token{AccessToken: token},
-	)
-	tc := oauth2.NewClient(ctx, ts)
-	defer tc.CloseIdleConnections()
+	var ts oauth2.TokenSource
+	if streamParams.Token != "" {
+		ts = currentToken{streamParams}
+	}
+	client, closeIdle := apiClient(ctx, ts)
+	defer closeIdle()
 
-	client := github.NewClient(tc)
 	for k, v := range in {
 		sha := v.Attributes.RemoteHash
 		if !v.Attributes.IsFile || (v.Action != tree.Update && v.Action != tree.Copy) {
@@ -42,25 +42,34 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 		if sha == "" {
 			return types.StreamsType{}, fmt.Errorf("streams: sha not found")
 		}
-		var gitErr error
-		var err error
 		var reader io.ReadCloser
 
 		res[k] = types.Stream{
-			Open: func() (io.Reader, error) {
-				reader, err = GetBlobRaw(client, ctx, user, repo, sha, gitErr)
+			Open: func(ctx context.Context) (io.Reader, error) {
+				var err error
+				reader, err = GetBlobRaw(client, ctx, user, repo, sha)
 				return reader, err
 			},
 			Close: func() error {
-				reader.Close()
-				return gitErr
+				return reader.Close()
 			},
 		}
 	}
 	return types.StreamsType{Streams: res, Cleanup: nil}, nil
 }
 
-func GetBlobRaw(client *github.Client, ctx context.Context, owner, repo, sha string, err error) (io.ReadCloser, error) {
+// currentToken follows the refreshed tokens during the long running jobs
+type currentToken struct {
+	params types.StreamParams
+}
+
+func (t currentToken) Token() (*oauth2.Token, error) {
+	// the short expiry makes the client ask for the token again, the refresh itself is done by the TokenSource of the stream parameters
+	return &oauth2.Token{AccessToken: t.params.CurrentToken(), Expiry: time.Now().Add(time.Minute)}, nil
+}
+
+// GetBlobRaw streams the content of the blob, the reading fails with the error of the download (e.g., when the context is cancelled)
+func GetBlobRaw(client *github.Client, ctx context.Context, owner, repo, sha string) (io.ReadCloser, error) {
 	u := fmt.Sprintf("repos/%v/%v/git/blobs/%v", owner, repo, sha)
 	req, reqErr := client.NewRequest("GET", u, nil)
 	if reqErr != nil {
@@ -69,8 +78,8 @@ func GetBlobRaw(client *github.Client, ctx context.Context, owner, repo, sha str
 	req.Header.Set("Accept", "application/vnd.github.v3.raw")
 	pr, pw := io.Pipe()
 	go func() {
-		_, err = client.Do(ctx, req, pw)
-		pw.Close()
+		_, err := client.Do(ctx, req, pw)
+		pw.CloseWithError(githubError(err))
 	}()
 	return pr, nil
 }
@@ -0,0 +1,50 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package gitlab
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// the prefixes of the tokens created by GitLab 15.x and later
+const (
+	accessTokenPrefix = "glpat-" // personal, project and group access tokens
+	deployTokenPrefix = "gldt-"
+)
+
+// credentials are the kinds of tokens accepted by the plugin: the OAuth tokens (of the login flow), the access tokens (personal,
+// project or group access tokens, e.g., provisioned in CI) and the deploy tokens with the read_repository scope, entered as
+// "username:token" (e.g., "gitlab+deploy-token-12:gldt-...") since the user name of the deploy token is needed to clone
+type credentials struct {
+	user   string // only for the deploy tokens
+	token  string
+	deploy bool
+}
+
+func parseToken(token string) credentials {
+	if user, secret, ok := strings.Cut(token, ":"); ok {
+		return credentials{user: user, token: secret, deploy: true}
+	}
+	return credentials{token: token, deploy: strings.HasPrefix(token, deployTokenPrefix)}
+}
+
+// setAuth authenticates the API request: the access tokens are sent in the PRIVATE-TOKEN header, the OAuth tokens (and the tokens
+// without a known prefix, e.g., the access tokens of older GitLab versions, also accepted as bearer tokens) as bearer tokens; the
+// requests without a token are anonymous (only the public projects)
+func setAuth(request *http.Request, token string) {
+	if token == "" {
+		return
+	}
+	if strings.HasPrefix(token, accessTokenPrefix) {
+		request.Header.Set("PRIVATE-TOKEN", token)
+		return
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+}
+
+// errDeployToken is returned by the calls that need the API, which does not accept the deploy tokens
+func errDeployToken(what string) error {
+	return fmt.Errorf("%v is not possible with a deploy token: use an access token (personal, project or group) or log in with GitLab", what)
+}
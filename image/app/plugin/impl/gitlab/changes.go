@@ -0,0 +1,87 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"net/url"
+	"path"
+)
+
+// the compare API lists at most 1000 changed files (the default diff limits of GitLab)
+const maxCompareDiffs = 1000
+
+type gitlabDiff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	DeletedFile bool   `json:"deleted_file"`
+	RenamedFile bool   `json:"renamed_file"`
+}
+
+// Revision returns the commit of the branch (or tag) to compare
+func Revision(ctx context.Context, req types.CompareRequest) (string, error) {
+	if c := parseToken(req.Token); c.deploy {
+		return gitRevision(ctx, c, req.Url, req.RepoName, req.Option)
+	}
+	commit := struct {
+		Id string `json:"id"`
+	}{}
+	u := fmt.Sprintf("%s/api/v4/projects/%s/repository/commits/%s", req.Url, url.PathEscape(req.RepoName), url.PathEscape(req.Option))
+	err := getJson(ctx, u, req.Token, &commit)
+	return commit.Id, err
+}
+
+// Changes applies the files changed between the commits to the nodes, the changed folders are listed to get the blob ids of the files
+func Changes(ctx context.Context, req types.CompareRequest, from, to string, nodes map[string]tree.Node) (map[string]tree.Node, error) {
+	if parseToken(req.Token).deploy {
+		// the compare API is not available, the ref is listed completely
+		return nil, types.ErrTooManyChanges
+	}
+	comparison := struct {
+		Diffs          []gitlabDiff `json:"diffs"`
+		CompareTimeout bool         `json:"compare_timeout"`
+	}{}
+	u := fmt.Sprintf("%s/api/v4/projects/%s/repository/compare?from=%s&to=%s&straight=true", req.Url, url.PathEscape(req.RepoName), from, to)
+	if err := getJson(ctx, u, req.Token, &comparison); err != nil {
+		return nil, err
+	}
+	if comparison.CompareTimeout || len(comparison.Diffs) >= maxCompareDiffs {
+		return nil, types.ErrTooManyChanges
+	}
+	folders := map[string]bool{}
+	changed := map[string]bool{}
+	for _, d := range comparison.Diffs {
+		if d.DeletedFile || d.RenamedFile {
+			delete(nodes, d.OldPath)
+		}
+		if !d.DeletedFile {
+			folders[parentFolder(d.NewPath)] = true
+			changed[d.NewPath] = true
+		}
+	}
+	for folder := range folders {
+		entries, err := listEntries(ctx, req, "ref="+to+"&path="+url.QueryEscape(folder))
+		if err != nil {
+			return nil, err
+		}
+		for id, node := range toNodeMap(GitlabTree{entries}) {
+			delete(changed, id)
+			nodes[id] = node
+		}
+	}
+	// e.g., the submodules
+	if len(changed) > 0 {
+		return nil, types.ErrTooManyChanges
+	}
+	return nodes, nil
+}
+
+func parentFolder(id string) string {
+	if dir := path.Dir(id); dir != "." {
+		return dir
+	}
+	return ""
+}
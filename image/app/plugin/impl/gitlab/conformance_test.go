@@ -0,0 +1,35 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package gitlab_test
+
+import (
+	"integration/app/plugin/conformance"
+	"integration/app/plugin/types"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	rec, err := conformance.LoadRecording("testdata/conformance.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := rec.Server()
+	defer srv.Close()
+	request := func(project string) *types.CompareRequest {
+		return &types.CompareRequest{Plugin: "gitlab", PluginId: "gitlab", RepoName: project, Url: srv.URL, Option: "main", Token: "glpat-conformance"}
+	}
+	conformance.Suite{
+		Plugin: "gitlab",
+		Cases: []conformance.Case{{
+			Name:    "paged",
+			Request: *request("group/project"),
+			Files: map[string][]byte{
+				"README.md":        []byte("# Test project\n"),
+				"data/results.csv": []byte("a,b\n1,2\n"),
+				"data/empty.txt":   {},
+			},
+		}},
+		Unauthorized: request("group/private"),
+		NotFound:     request("group/missing"),
+	}.Run(t)
+}
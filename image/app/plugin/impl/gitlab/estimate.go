@@ -0,0 +1,72 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/httpclient"
+	"integration/app/plugin/types"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+func Estimate(ctx context.Context, req types.CompareRequest) (types.Estimate, error) {
+	if c := parseToken(req.Token); c.deploy {
+		return gitEstimate(ctx, c, req)
+	}
+	type Statistics struct {
+		RepositorySize int64 `json:"repository_size"`
+	}
+	type Project struct {
+		Statistics *Statistics `json:"statistics"` // only for the members of the project
+	}
+	project := Project{}
+	err := getJson(ctx, fmt.Sprintf("%s/api/v4/projects/%s?statistics=true", req.Url, url.PathEscape(req.RepoName)), req.Token, &project)
+	if err != nil {
+		return types.Estimate{}, err
+	}
+	// the tree can not be filtered on the entry type: the X-Total header would also count the folders
+	entries, err := listEntries(ctx, req, "recursive=true&ref="+req.Option)
+	if err != nil {
+		return types.Estimate{}, err
+	}
+	count := 0
+	for _, e := range entries {
+		if e.Type == "blob" {
+			count++
+		}
+	}
+	size := int64(-1)
+	if project.Statistics != nil {
+		size = project.Statistics.RepositorySize
+	}
+	return types.Estimate{
+		FileCount:   count,
+		TotalSize:   size,
+		Approximate: true,
+	}, nil
+}
+
+func getJson(ctx context.Context, url, token string, res interface{}) error {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	setAuth(request, token)
+	r, err := httpclient.Get("gitlab").Do(request)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return err
+	}
+	if r.StatusCode != 200 {
+		return fmt.Errorf("GitLab API call failed: %w", types.StatusError(r.StatusCode, b))
+	}
+	return json.Unmarshal(b, res)
+}
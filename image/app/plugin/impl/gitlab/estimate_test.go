@@ -0,0 +1,29 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package gitlab_test
+
+import (
+	"context"
+	"integration/app/plugin/conformance"
+	"integration/app/plugin/impl/gitlab"
+	"integration/app/plugin/types"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	rec, err := conformance.LoadRecording("testdata/conformance.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := rec.Server()
+	defer srv.Close()
+	req := types.CompareRequest{Plugin: "gitlab", PluginId: "gitlab", RepoName: "group/project", Url: srv.URL, Option: "main", Token: "glpat-conformance"}
+	res, err := gitlab.Estimate(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the "data" folder is not counted
+	if res.FileCount != 3 || res.TotalSize != 2048 {
+		t.Fatalf("expected 3 files of 2048 bytes, got %+v", res)
+	}
+}
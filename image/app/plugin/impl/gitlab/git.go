@@ -0,0 +1,267 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package gitlab
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// The deploy tokens are only accepted by the git endpoints of GitLab, not by the API: the repository is read with the git
+// command line, as a shallow clone without the file contents (the blobs are fetched when the files are streamed).
+
+// gitCommand runs git with the deploy token in the environment (not on the command line), the prompts for credentials are disabled
+func gitCommand(ctx context.Context, c credentials, dir string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	basic := base64.StdEncoding.EncodeToString([]byte(c.user + ":" + c.token))
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.extraHeader",
+		"GIT_CONFIG_VALUE_0=Authorization: Basic "+basic,
+	)
+	return cmd
+}
+
+func runGit(ctx context.Context, c credentials, dir string, args ...string) ([]byte, error) {
+	if c.user == "" {
+		return nil, fmt.Errorf("the user name of the deploy token is missing: enter the token as username:token")
+	}
+	cmd := gitCommand(ctx, c, dir, args...)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if strings.Contains(message, "Authentication failed") || strings.Contains(message, "could not read Username") {
+			return nil, fmt.Errorf("git %v failed: %w", args[0], types.ErrUnauthorized)
+		}
+		return nil, fmt.Errorf("git %v failed: %v: %s", args[0], err, message)
+	}
+	return out, nil
+}
+
+// cloneUrl is the HTTP(S) URL of the repository, the project is its path (e.g., "group/project")
+func cloneUrl(base, project string) string {
+	return strings.TrimSuffix(base, "/") + "/" + strings.Trim(project, "/") + ".git"
+}
+
+// gitRefs lists the branches (or the given refs) of the repository: ref name -> commit
+func gitRefs(ctx context.Context, c credentials, base, project string, args ...string) (map[string]string, error) {
+	out, err := runGit(ctx, c, "", append([]string{"ls-remote", cloneUrl(base, project)}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	res := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		commit, ref, ok := strings.Cut(scanner.Text(), "\t")
+		if ok {
+			res[ref] = commit
+		}
+	}
+	return res, scanner.Err()
+}
+
+func gitBranches(ctx context.Context, c credentials, base, project string) ([]types.SelectItem, error) {
+	refs, err := gitRefs(ctx, c, base, project, "--heads")
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for ref := range refs {
+		names = append(names, strings.TrimPrefix(ref, "refs/heads/"))
+	}
+	sort.Strings(names)
+	res := []types.SelectItem{}
+	for _, name := range names {
+		res = append(res, types.SelectItem{Label: name, Value: name})
+	}
+	return res, nil
+}
+
+// gitRevision returns the commit of the branch or tag
+func gitRevision(ctx context.Context, c credentials, base, project, ref string) (string, error) {
+	refs, err := gitRefs(ctx, c, base, project, "refs/heads/"+ref, "refs/tags/"+ref+"^{}", "refs/tags/"+ref)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range []string{"refs/heads/" + ref, "refs/tags/" + ref + "^{}", "refs/tags/" + ref} {
+		if commit, ok := refs[name]; ok {
+			return commit, nil
+		}
+	}
+	return "", fmt.Errorf("branch or tag %v not found", ref)
+}
+
+// gitClone clones the branch or tag without the file contents in a temporary folder, which must be removed after use
+func gitClone(ctx context.Context, c credentials, base, project, ref string) (string, error) {
+	dir, err := os.MkdirTemp("", "gitlab-*")
+	if err != nil {
+		return "", err
+	}
+	_, err = runGit(ctx, c, dir, "clone", "--quiet", "--bare", "--depth", "1", "--filter=blob:none", "--branch", ref, cloneUrl(base, project), ".")
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+// gitEntries lists the files of the cloned ref, as the entries of the tree API
+func gitEntries(ctx context.Context, c credentials, dir string) ([]GitlabEntry, error) {
+	out, err := runGit(ctx, c, dir, "ls-tree", "-r", "-z", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	entries := []GitlabEntry{}
+	for _, line := range strings.Split(string(out), "\x00") {
+		// <mode> SP <type> SP <object> TAB <path>
+		meta, p, ok := strings.Cut(line, "\t")
+		fields := strings.Fields(meta)
+		if !ok || len(fields) != 3 {
+			continue
+		}
+		entries = append(entries, GitlabEntry{Mode: fields[0], Type: fields[1], Id: fields[2], Path: p, Name: path.Base(p)})
+	}
+	return entries, nil
+}
+
+func gitQuery(ctx context.Context, c credentials, req types.CompareRequest) (map[string]tree.Node, error) {
+	dir, err := gitClone(ctx, c, req.Url, req.RepoName, req.Option)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	entries, err := gitEntries(ctx, c, dir)
+	if err != nil {
+		return nil, err
+	}
+	return toNodeMap(GitlabTree{entries}), nil
+}
+
+func gitEstimate(ctx context.Context, c credentials, req types.CompareRequest) (types.Estimate, error) {
+	dir, err := gitClone(ctx, c, req.Url, req.RepoName, req.Option)
+	if err != nil {
+		return types.Estimate{}, err
+	}
+	defer os.RemoveAll(dir)
+	entries, err := gitEntries(ctx, c, dir)
+	if err != nil {
+		return types.Estimate{}, err
+	}
+	// the sizes are not known without fetching the contents
+	return types.Estimate{FileCount: len(entries), TotalSize: -1}, nil
+}
+
+// gitStreams reads the blobs from a clone made when the first file is opened, the clone is removed by the cleanup
+func gitStreams(in map[string]tree.Node, c credentials, streamParams types.StreamParams) (types.StreamsType, error) {
+	var mu sync.Mutex
+	dir := ""
+	clone := func(ctx context.Context) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if dir != "" {
+			return dir, nil
+		}
+		var err error
+		dir, err = gitClone(ctx, c, streamParams.Url, streamParams.RepoName, streamParams.Option)
+		return dir, err
+	}
+	res := map[string]types.Stream{}
+	for k, v := range in {
+		sha := v.Attributes.RemoteHash
+		if !v.Attributes.IsFile || (v.Action != tree.Update && v.Action != tree.Copy) {
+			continue
+		}
+		if sha == "" {
+			return types.StreamsType{}, fmt.Errorf("streams: sha not found")
+		}
+		var r *blobReader
+		res[k] = types.Stream{
+			Open: func(ctx context.Context) (io.Reader, error) {
+				d, err := clone(ctx)
+				if err != nil {
+					return nil, err
+				}
+				r, err = openBlob(ctx, c, d, sha)
+				return r, err
+			},
+			Close: func() error {
+				if r == nil {
+					return nil
+				}
+				return r.Close()
+			},
+		}
+	}
+	cleanup := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		if dir == "" {
+			return nil
+		}
+		return os.RemoveAll(dir)
+	}
+	return types.StreamsType{Streams: res, Cleanup: cleanup}, nil
+}
+
+// blobReader streams the output of git cat-file, a failed command (e.g., the blob could not be fetched) fails the last read
+// instead of ending the file early
+type blobReader struct {
+	cmd    *exec.Cmd
+	out    io.ReadCloser
+	stderr *bytes.Buffer
+	exited bool
+}
+
+func openBlob(ctx context.Context, c credentials, dir, sha string) (*blobReader, error) {
+	// the missing blob is fetched from the repository by git
+	cmd := gitCommand(ctx, c, dir, "cat-file", "blob", sha)
+	r := &blobReader{cmd: cmd, stderr: &bytes.Buffer{}}
+	cmd.Stderr = r.stderr
+	var err error
+	if r.out, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	if err = cmd.Start(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *blobReader) Read(p []byte) (int, error) {
+	n, err := r.out.Read(p)
+	if err == io.EOF && !r.exited {
+		r.exited = true
+		if waitErr := r.cmd.Wait(); waitErr != nil {
+			return n, fmt.Errorf("getting file failed: %v: %s", waitErr, strings.TrimSpace(r.stderr.String()))
+		}
+	}
+	return n, err
+}
+
+// Close stops the command when the file was not read completely
+func (r *blobReader) Close() error {
+	if r.exited {
+		return nil
+	}
+	r.exited = true
+	r.out.Close()
+	r.cmd.Process.Kill()
+	r.cmd.Wait()
+	return nil
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"io"
 	"net/http"
@@ -17,16 +18,19 @@ func Options(ctx context.Context, params types.OptionsRequest) ([]types.SelectIt
 	base := params.Url
 	project := params.RepoName
 	token := params.Token
-	if project == "" || token == "" || base == "" {
-		return nil, fmt.Errorf("branches: missing parameters: expected base, group (optional), project and token")
+	if project == "" || base == "" {
+		return nil, fmt.Errorf("branches: missing parameters: expected base, group (optional) and project")
+	}
+	if c := parseToken(token); c.deploy {
+		return gitBranches(ctx, c, base, project)
 	}
 	url := base + "/api/v4/projects/" + url.PathEscape(project) + "/repository/branches"
 	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Add("Authorization", "Bearer "+token)
-	r, err := http.DefaultClient.Do(request)
+	setAuth(request, token)
+	r, err := httpclient.Get("gitlab").Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +40,7 @@ func Options(ctx context.Context, params types.OptionsRequest) ([]types.SelectIt
 		return nil, err
 	}
 	if r.StatusCode != 200 {
-		return nil, fmt.Errorf("getting branches failed: %s", string(b))
+		return nil, fmt.Errorf("getting branches failed: %w", types.StatusError(r.StatusCode, b))
 	}
 	type Commit struct {
 		CommittedDate string `json:"committed_date"`
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
@@ -27,33 +28,45 @@ type GitlabEntry struct {
 }
 
 func Query(ctx context.Context, req types.CompareRequest, _ map[string]tree.Node) (map[string]tree.Node, error) {
+	if c := parseToken(req.Token); c.deploy {
+		return gitQuery(ctx, c, req)
+	}
+	entries, err := listEntries(ctx, req, "recursive=true&ref="+req.Option)
+	if err != nil {
+		return nil, err
+	}
+	tr := GitlabTree{entries}
+	return toNodeMap(tr), nil
+}
+
+// listEntries lists all pages of the tree selected by the query (ref, path and recursive parameters)
+func listEntries(ctx context.Context, req types.CompareRequest, query string) ([]GitlabEntry, error) {
 	entries := []GitlabEntry{}
 	page := 1
-	pageEntries, err := getPageEntries(ctx, req, page)
+	pageEntries, err := getPageEntries(ctx, req, query, page)
 	if err != nil {
 		return nil, err
 	}
 	for len(pageEntries) > 0 {
 		entries = append(entries, pageEntries...)
 		page = page + 1
-		pageEntries, err = getPageEntries(ctx, req, page)
+		pageEntries, err = getPageEntries(ctx, req, query, page)
 		if err != nil {
 			return nil, err
 		}
 	}
-	tr := GitlabTree{entries}
-	return toNodeMap(tr), nil
+	return entries, nil
 }
 
-func getPageEntries(ctx context.Context, req types.CompareRequest, page int) ([]GitlabEntry, error) {
+func getPageEntries(ctx context.Context, req types.CompareRequest, query string, page int) ([]GitlabEntry, error) {
 	res := []GitlabEntry{}
-	url := fmt.Sprintf("%s/api/v4/projects/%s/repository/tree?recursive=true&ref=%s&per_page=100&page=%d", req.Url, url.PathEscape(req.RepoName), req.Option, page)
+	url := fmt.Sprintf("%s/api/v4/projects/%s/repository/tree?%s&per_page=100&page=%d", req.Url, url.PathEscape(req.RepoName), query, page)
 	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
-	request.Header.Add("Authorization", "Bearer "+req.Token)
-	r, err := http.DefaultClient.Do(request)
+	setAuth(request, req.Token)
+	r, err := httpclient.Get("gitlab").Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -62,6 +75,9 @@ func getPageEntries(ctx context.Context, req types.CompareRequest, page int) ([]
 	if err != nil {
 		return nil, err
 	}
+	if r.StatusCode != 200 {
+		return nil, fmt.Errorf("listing files failed: %w", types.StatusError(r.StatusCode, b))
+	}
 	err = json.Unmarshal(b, &res)
 	return res, err
 }
@@ -0,0 +1,94 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"integration/app/httpclient"
+	"integration/app/plugin/types"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// the scopes that let the plugin read the repository
+var readScopes = []string{"api", "read_api", "read_repository"}
+
+// Scopes checks that the token has one of the read scopes; the deploy tokens can not be inspected with the API, listing the branches
+// with git checks their read_repository scope
+func Scopes(ctx context.Context, req types.CompareRequest) error {
+	if req.Token == "" {
+		// the public projects are read without a token
+		return nil
+	}
+	if req.RepoName == "" || req.Url == "" {
+		return fmt.Errorf("missing parameters: expected base, group (optional) and project")
+	}
+	c := parseToken(req.Token)
+	if c.deploy {
+		_, err := gitRefs(ctx, c, req.Url, req.RepoName, "--heads")
+		return err
+	}
+	scopes, err := tokenScopes(ctx, req.Url, req.Token)
+	if err != nil || scopes == nil {
+		return err
+	}
+	for _, s := range scopes {
+		for _, r := range readScopes {
+			if s == r {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w: the token has the scopes %q, one of %q is needed", types.ErrInsufficientScope, strings.Join(scopes, ", "), strings.Join(readScopes, ", "))
+}
+
+// tokenScopes returns the scopes of the OAuth token or of the access token (personal, project or group), nil when GitLab can not
+// tell (e.g., the versions before 15.5 have no API for the access tokens)
+func tokenScopes(ctx context.Context, base, token string) ([]string, error) {
+	if !strings.HasPrefix(token, accessTokenPrefix) {
+		// the OAuth tokens of the login flow, the other tokens are rejected by the token info
+		scopes, status, err := getScopes(ctx, base+"/oauth/token/info", token)
+		if err != nil || status == http.StatusOK {
+			return scopes, err
+		}
+	}
+	scopes, status, err := getScopes(ctx, base+"/api/v4/personal_access_tokens/self", token)
+	switch {
+	case err != nil:
+		return nil, err
+	case status == http.StatusUnauthorized:
+		return nil, fmt.Errorf("checking the token failed: %w", types.ErrUnauthorized)
+	case status != http.StatusOK:
+		return nil, nil
+	}
+	return scopes, nil
+}
+
+func getScopes(ctx context.Context, url, token string) ([]string, int, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	setAuth(request, token)
+	r, err := httpclient.Get("gitlab").Do(request)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil || r.StatusCode != http.StatusOK {
+		return nil, r.StatusCode, err
+	}
+	// "scope" in the token info, "scopes" in the access token
+	res := struct {
+		Scope  []string `json:"scope"`
+		Scopes []string `json:"scopes"`
+	}{}
+	if err = json.Unmarshal(b, &res); err != nil {
+		return nil, r.StatusCode, err
+	}
+	return append(res.Scope, res.Scopes...), r.StatusCode, nil
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"io"
 	"net/http"
@@ -17,20 +18,24 @@ type Item struct {
 
 func Search(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error) {
 	token := params.Token
-	if token == "" {
-		return nil, fmt.Errorf("not authorized")
+	if parseToken(token).deploy {
+		return nil, errDeployToken("searching projects")
 	}
 	url := params.Url + "/api/v4/search?scope=projects&search=" + params.RepoName
+	if token == "" {
+		// the search API needs a token, the public projects are listed instead
+		url = params.Url + "/api/v4/projects?simple=true&search=" + params.RepoName
+	}
 	request, _ := http.NewRequestWithContext(ctx, "GET", url, nil)
-	request.Header.Add("Authorization", "Bearer "+token)
-	r, err := http.DefaultClient.Do(request)
+	setAuth(request, token)
+	r, err := httpclient.Get("gitlab").Do(request)
 	if err != nil {
 		return nil, fmt.Errorf("search failed: %v", err)
 	}
 	defer r.Body.Close()
 	if r.StatusCode != 200 && r.StatusCode != 404 {
 		b, _ := io.ReadAll(r.Body)
-		return nil, fmt.Errorf("search failed: %d - %s", r.StatusCode, string(b))
+		return nil, fmt.Errorf("search failed: %w", types.StatusError(r.StatusCode, b))
 	}
 	b, _ := io.ReadAll(r.Body)
 	results := []Item{}
@@ -5,6 +5,7 @@ package gitlab
 import (
 	"context"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
@@ -12,12 +13,15 @@ import (
 	"net/url"
 )
 
-func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
+func Streams(_ context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
 	base := streamParams.Url
 	project := streamParams.RepoName
 	token := streamParams.Token
-	if project == "" || token == "" || base == "" {
-		return types.StreamsType{}, fmt.Errorf("streams: missing parameters: expected base, group (optional), project and token")
+	if project == "" || base == "" {
+		return types.StreamsType{}, fmt.Errorf("streams: missing parameters: expected base, group (optional) and project")
+	}
+	if c := parseToken(token); c.deploy {
+		return gitStreams(in, c, streamParams)
 	}
 	res := map[string]types.Stream{}
 
@@ -30,16 +34,16 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 			return types.StreamsType{}, fmt.Errorf("streams: sha not found")
 		}
 		url := base + "/api/v4/projects/" + url.PathEscape(project) + "/repository/blobs/" + sha + "/raw"
-		request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			return types.StreamsType{}, err
-		}
-		request.Header.Add("Authorization", "Bearer "+token)
 		var r *http.Response
 
 		res[k] = types.Stream{
-			Open: func() (io.Reader, error) {
-				r, err = http.DefaultClient.Do(request)
+			Open: func(ctx context.Context) (io.Reader, error) {
+				request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+				if err != nil {
+					return nil, err
+				}
+				setAuth(request, streamParams.CurrentToken())
+				r, err = httpclient.Get("gitlab").Do(request)
 				if err != nil {
 					return nil, err
 				}
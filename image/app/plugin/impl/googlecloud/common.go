@@ -0,0 +1,100 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package googlecloud
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"integration/app/httpclient"
+	"integration/app/plugin/types"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+type ListResponse struct {
+	Items         []Object `json:"items"`
+	NextPageToken string   `json:"nextPageToken"`
+}
+
+type Object struct {
+	Name    string `json:"name"`
+	Size    string `json:"size"` // int64 as string in the JSON API
+	Md5Hash string `json:"md5Hash"`
+	Crc32c  string `json:"crc32c"`
+	Updated string `json:"updated"`
+}
+
+func listObjects(ctx context.Context, server, bucket, prefix, token string) ([]Object, error) {
+	res := []Object{}
+	pageToken := ""
+	for {
+		query := url.Values{}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if pageToken != "" {
+			query.Set("pageToken", pageToken)
+		}
+		u := fmt.Sprintf("%s/storage/v1/b/%s/o", server, url.PathEscape(bucket))
+		if len(query) > 0 {
+			u = u + "?" + query.Encode()
+		}
+		b, err := get(ctx, u, token)
+		if err != nil {
+			return nil, err
+		}
+		page := ListResponse{}
+		err = json.Unmarshal(b, &page)
+		if err != nil {
+			return nil, fmt.Errorf("listing objects failed: %v", err)
+		}
+		res = append(res, page.Items...)
+		if page.NextPageToken == "" {
+			return res, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+func get(ctx context.Context, url, token string) ([]byte, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		request.Header.Add("Authorization", "Bearer "+token)
+	}
+	r, err := httpclient.Get("googlecloud").Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		return nil, types.StatusError(r.StatusCode, b)
+	}
+	return b, nil
+}
+
+// objectHash returns the MD5 of the object when it is known, the composite objects (e.g., parallel composite uploads) only have
+// the CRC32C; both are base64 encoded by GCS and are converted to hex (the CRC32C is the big-endian value)
+func objectHash(o Object) (string, string) {
+	if o.Md5Hash != "" {
+		if b, err := base64.StdEncoding.DecodeString(o.Md5Hash); err == nil {
+			return hex.EncodeToString(b), types.Md5
+		}
+	}
+	if o.Crc32c != "" {
+		if b, err := base64.StdEncoding.DecodeString(o.Crc32c); err == nil && len(b) == 4 {
+			return hex.EncodeToString(b), types.CRC32C
+		}
+	}
+	return "", ""
+}
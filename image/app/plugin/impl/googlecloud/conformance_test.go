@@ -0,0 +1,36 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package googlecloud_test
+
+import (
+	"integration/app/plugin/conformance"
+	"integration/app/plugin/types"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	rec, err := conformance.LoadRecording("testdata/conformance.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := rec.Server()
+	defer srv.Close()
+	request := func(bucket string) *types.CompareRequest {
+		return &types.CompareRequest{Plugin: "googlecloud", PluginId: "googlecloud", RepoName: bucket, Url: srv.URL, Token: "ya29.conformance"}
+	}
+	conformance.Suite{
+		Plugin: "googlecloud",
+		Cases: []conformance.Case{{
+			// data/results.csv is a composite object, without MD5: it is compared with the CRC32C
+			Name:    "paged",
+			Request: *request("rdm-conformance"),
+			Files: map[string][]byte{
+				"README.md":        []byte("# Test bucket\n"),
+				"data/results.csv": []byte("a,b\n1,2\n"),
+				"data/empty.txt":   {},
+			},
+		}},
+		Unauthorized: request("rdm-private"),
+		NotFound:     request("rdm-missing"),
+	}.Run(t)
+}
@@ -0,0 +1,57 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package googlecloud
+
+import (
+	"context"
+	"fmt"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+func Query(ctx context.Context, req types.CompareRequest, nm map[string]tree.Node) (map[string]tree.Node, error) {
+	if req.Url == "" || req.RepoName == "" {
+		return nil, fmt.Errorf("query: missing parameters: expected url and bucket, got %+v", req)
+	}
+	prefix := strings.TrimPrefix(req.Option, "/")
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix = prefix + "/"
+	}
+	objects, err := listObjects(ctx, req.Url, req.RepoName, prefix, req.Token)
+	if err != nil {
+		return nil, err
+	}
+	return toNodeMap(req, prefix, objects), nil
+}
+
+func toNodeMap(req types.CompareRequest, prefix string, objects []Object) map[string]tree.Node {
+	res := map[string]tree.Node{}
+	for _, o := range objects {
+		// the folders created in the console are empty objects with a trailing slash
+		if strings.HasSuffix(o.Name, "/") {
+			continue
+		}
+		id := strings.TrimPrefix(o.Name, prefix)
+		size, _ := strconv.ParseInt(o.Size, 10, 64)
+		hash, hashType := objectHash(o)
+		node := tree.Node{
+			Id:   id,
+			Name: path.Base(id),
+			Path: strings.TrimSuffix(strings.TrimSuffix(id, path.Base(id)), "/"),
+			Attributes: tree.Attributes{
+				URL:            fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", req.Url, url.PathEscape(req.RepoName), url.PathEscape(o.Name)),
+				IsFile:         true,
+				RemoteHash:     hash,
+				RemoteHashType: hashType,
+				RemoteFilesize: size,
+				RemoteModified: types.ParseModified(o.Updated),
+			},
+		}
+		res[node.Id] = node
+	}
+	return res
+}
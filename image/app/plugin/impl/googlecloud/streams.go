@@ -0,0 +1,47 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package googlecloud
+
+import (
+	"context"
+	"integration/app/httpclient"
+	"integration/app/plugin/types"
+	"integration/app/tree"
+	"io"
+	"net/http"
+)
+
+func Streams(_ context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
+	res := map[string]types.Stream{}
+
+	for k, v := range in {
+		url := v.Attributes.URL
+		var r *http.Response
+
+		res[k] = types.Stream{
+			Open: func(ctx context.Context) (io.Reader, error) {
+				request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+				if err != nil {
+					return nil, err
+				}
+				if token := streamParams.CurrentToken(); token != "" {
+					request.Header.Set("Authorization", "Bearer "+token)
+				}
+				r, err = httpclient.Get("googlecloud").Do(request)
+				if err != nil {
+					return nil, err
+				}
+				if r.StatusCode != http.StatusOK {
+					b, _ := io.ReadAll(r.Body)
+					r.Body.Close()
+					return nil, types.StatusError(r.StatusCode, b)
+				}
+				return r.Body, nil
+			},
+			Close: func() error {
+				return r.Body.Close()
+			},
+		}
+	}
+	return types.StreamsType{Streams: res, Cleanup: nil}, nil
+}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"integration/app/httpclient"
 	"io"
 	"net/http"
 	"strconv"
@@ -76,7 +77,7 @@ var serverMap = map[string]Server{
 	"default":                                {Server: "ghum.irods.icts.kuleuven.be", AuthScheme: "PAM", Port: 1247},
 }
 
-func NewIrodsClient(server, zone, username, password string) (*IrodsClient, error) {
+func NewIrodsClient(ctx context.Context, server, zone, username, password string) (*IrodsClient, error) {
 	s := getServer(server)
 	i := &IrodsClient{}
 	i.Zone = zone
@@ -88,7 +89,7 @@ func NewIrodsClient(server, zone, username, password string) (*IrodsClient, erro
 
 	var err error
 	if strings.Contains(server, "kuleuven") {
-		info, err := getConnectionInfo(zone, password)
+		info, err := getConnectionInfo(ctx, zone, password)
 		if err != nil {
 			return nil, err
 		}
@@ -192,19 +193,19 @@ func (i *IrodsClient) StreamFile(irodsPath string) (io.ReadCloser, error) {
 	return nil, errors.New("file not found")
 }
 
-func getConnectionInfo(zone, token string) (ConnectionInfo, error) {
-	zoneId, err := getZoneId(zone, token)
+func getConnectionInfo(ctx context.Context, zone, token string) (ConnectionInfo, error) {
+	zoneId, err := getZoneId(ctx, zone, token)
 	if err != nil {
 		return ConnectionInfo{}, err
 	}
 	url := "https://icts-p-coz-data-platform-api.cloud.icts.kuleuven.be/v1/irods/zones/" + zoneId + "/connection_info"
-	shortContext, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	shortContext, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 	res := ConnectionInfo{}
 	request, _ := http.NewRequestWithContext(shortContext, "GET", url, nil)
 	request.Header.Add("accept", "application/json")
 	request.Header.Add("Authorization", "Bearer "+token)
-	response, err := http.DefaultClient.Do(request)
+	response, err := httpclient.Get("irods").Do(request)
 	if err != nil {
 		return ConnectionInfo{}, err
 	}
@@ -214,8 +215,8 @@ func getConnectionInfo(zone, token string) (ConnectionInfo, error) {
 	return res, err
 }
 
-func getZoneId(zone, token string) (string, error) {
-	zones, err := getZones(token)
+func getZoneId(ctx context.Context, zone, token string) (string, error) {
+	zones, err := getZones(ctx, token)
 	if err != nil {
 		return "", err
 	}
@@ -227,15 +228,15 @@ func getZoneId(zone, token string) (string, error) {
 	return "", fmt.Errorf("zone %s not found", zone)
 }
 
-func getZones(token string) ([]Zone, error) {
+func getZones(ctx context.Context, token string) ([]Zone, error) {
 	url := "https://icts-p-coz-data-platform-api.cloud.icts.kuleuven.be/v1/irods/zones"
-	shortContext, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	shortContext, cancel := context.WithTimeout(ctx, 5*time.Minute)
 	defer cancel()
 	res := []Zone{}
 	request, _ := http.NewRequestWithContext(shortContext, "GET", url, nil)
 	request.Header.Add("accept", "application/json")
 	request.Header.Add("Authorization", "Bearer "+token)
-	response, err := http.DefaultClient.Do(request)
+	response, err := httpclient.Get("irods").Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -9,7 +9,7 @@ import (
 	"sort"
 )
 
-func Options(_ context.Context, params types.OptionsRequest) ([]types.SelectItem, error) {
+func Options(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error) {
 	user := params.User
 	password := params.Token
 	server := params.Url
@@ -17,7 +17,7 @@ func Options(_ context.Context, params types.OptionsRequest) ([]types.SelectItem
 	if user == "" || password == "" || server == "" || zone == "" {
 		return nil, fmt.Errorf("folders: missing parameters: expected server, zone, user and password, got: %+v", params)
 	}
-	cl, err := NewIrodsClient(server, zone, user, password)
+	cl, err := NewIrodsClient(ctx, server, zone, user, password)
 	if err != nil {
 		return nil, err
 	}
@@ -11,8 +11,8 @@ import (
 	"github.com/cyverse/go-irodsclient/fs"
 )
 
-func Query(_ context.Context, req types.CompareRequest, nm map[string]tree.Node) (map[string]tree.Node, error) {
-	cl, err := NewIrodsClient(req.Url, req.RepoName, req.User, req.Token)
+func Query(ctx context.Context, req types.CompareRequest, nm map[string]tree.Node) (map[string]tree.Node, error) {
+	cl, err := NewIrodsClient(ctx, req.Url, req.RepoName, req.User, req.Token)
 	if err != nil {
 		return nil, err
 	}
@@ -21,10 +21,11 @@ func Query(_ context.Context, req types.CompareRequest, nm map[string]tree.Node)
 	if err != nil {
 		return nil, err
 	}
-	return toNodeMap(cl, req.Option, entries, nm)
+	return toNodeMap(ctx, cl, req.Option, entries, nm)
 }
 
-func toNodeMap(cl *IrodsClient, folder string, entries []*fs.Entry, nm map[string]tree.Node) (map[string]tree.Node, error) {
+// toNodeMap lists the folders recursively, the iRODS client is not context aware: the context is checked for each folder
+func toNodeMap(ctx context.Context, cl *IrodsClient, folder string, entries []*fs.Entry, nm map[string]tree.Node) (map[string]tree.Node, error) {
 	res := map[string]tree.Node{}
 	dirs := []string{}
 	for _, e := range entries {
@@ -62,11 +63,14 @@ func toNodeMap(cl *IrodsClient, folder string, entries []*fs.Entry, nm map[strin
 		res[id] = node
 	}
 	for _, d := range dirs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		subEntries, err := cl.FileSystem.List(d)
 		if err != nil {
 			return nil, err
 		}
-		irodsNm, err := toNodeMap(cl, folder, subEntries, nm)
+		irodsNm, err := toNodeMap(ctx, cl, folder, subEntries, nm)
 		if err != nil {
 			return nil, err
 		}
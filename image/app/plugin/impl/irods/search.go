@@ -9,9 +9,9 @@ import (
 )
 
 func Search(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error) {
-	zones, err := getZones(params.Token)
+	zones, err := getZones(ctx, params.Token)
 	if err != nil {
-		logging.Logger.Println("getting zones failed: " + err.Error())
+		logging.Logger.WarnContext(ctx, "getting zones failed", "error", err)
 		return nil, nil
 	}
 	res := []types.SelectItem{}
@@ -19,13 +19,13 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 	if user == "" || password == "" || server == "" || zone == "" || folder == "" {
 		return types.StreamsType{}, fmt.Errorf("folders: missing parameters: expected server, zone, folder, user and password, got: %+v", streamParams)
 	}
-	cl, clientErr := NewIrodsClient(server, zone, user, password)
+	cl, clientErr := NewIrodsClient(ctx, server, zone, user, password)
 	if clientErr != nil {
 		return types.StreamsType{}, clientErr
 	}
 	res := map[string]types.Stream{}
 	for k, v := range in {
-		path := v.Id
+		path := v.SourceId()
 		if !v.Attributes.IsFile || (v.Action != tree.Update && v.Action != tree.Copy) {
 			continue
 		}
@@ -35,10 +35,17 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 
 		var reader io.ReadCloser
 		res[k] = types.Stream{
-			Open: func() (io.Reader, error) {
+			Open: func(ctx context.Context) (io.Reader, error) {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
 				var err error
 				reader, err = cl.StreamFile(folder + "/" + path)
-				return reader, err
+				if err != nil {
+					return nil, err
+				}
+				// the iRODS client is not context aware
+				return types.ContextReader(ctx, reader), nil
 			},
 			Close: func() (err error) {
 				if reader == nil {
@@ -0,0 +1,39 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package local_test
+
+import (
+	"integration/app/plugin/conformance"
+	"integration/app/plugin/types"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"README.md":             []byte("# Test folder\n"),
+		"data/results.csv":      []byte("a,b\n1,2\n"),
+		"data/empty.txt":        {},
+		"data/nested/notes.txt": []byte("notes"),
+	}
+	for id, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(id))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, content, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conformance.Suite{
+		Plugin: "local",
+		Cases: []conformance.Case{{
+			Name:    "folder",
+			Request: types.CompareRequest{Plugin: "local", PluginId: "local", Url: dir},
+			Files:   files,
+		}},
+		NotFound: &types.CompareRequest{Plugin: "local", PluginId: "local", Url: filepath.Join(dir, "missing")},
+	}.Run(t)
+}
@@ -6,10 +6,13 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
+	"integration/app/config"
+	"integration/app/logging"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 )
 
@@ -23,9 +26,13 @@ type Entry struct {
 	Size     int64
 }
 
-func Query(_ context.Context, req types.CompareRequest, dvNodes map[string]tree.Node) (map[string]tree.Node, error) {
+func Query(ctx context.Context, req types.CompareRequest, dvNodes map[string]tree.Node) (map[string]tree.Node, error) {
 	path := strings.TrimSuffix(req.Url, string(os.PathSeparator))
-	entries, err := list(path, path, dvNodes)
+	visited := map[string]bool{}
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		visited[real] = true
+	}
+	entries, err := list(path, path, dvNodes, visited)
 	if err != nil {
 		return nil, err
 	}
@@ -36,7 +43,11 @@ func Query(_ context.Context, req types.CompareRequest, dvNodes map[string]tree.
 	for len(dirs) != 0 {
 		moreDirs := []string{}
 		for _, d := range dirs {
-			subEntries, err := list(path, d, dvNodes)
+			// the file system is not context aware, the context is checked for each folder
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			subEntries, err := list(path, d, dvNodes, visited)
 			if err != nil {
 				return nil, err
 			}
@@ -82,7 +93,9 @@ func toNodeMap(entries []Entry) ([]string, map[string]tree.Node, error) {
 	return dirs, res, nil
 }
 
-func list(root, folder string, dvNodes map[string]tree.Node) ([]Entry, error) {
+// list skips the special files (sockets, devices, named pipes, etc.) and handles the symbolic links with the "symlinks" option,
+// the followed links to folders that were already listed (e.g., a link to a parent folder) are skipped
+func list(root, folder string, dvNodes map[string]tree.Node, visited map[string]bool) ([]Entry, error) {
 	files, err := os.ReadDir(folder)
 	if err != nil {
 		return nil, err
@@ -90,16 +103,28 @@ func list(root, folder string, dvNodes map[string]tree.Node) ([]Entry, error) {
 	res := []Entry{}
 	for _, v := range files {
 		path := folder + string(os.PathSeparator) + v.Name()
+		info, target, ok := entryInfo(path)
+		if !ok {
+			logging.Logger.Debug("skipping file", "path", path)
+			continue
+		}
 		checkSum := types.NotNeeded
 		parentId := ""
 		id := ""
 		fileName := v.Name()
-		idDir := v.IsDir()
+		idDir := info.IsDir()
+		if idDir {
+			real, err := filepath.EvalSymlinks(path)
+			if err != nil || visited[real] {
+				continue
+			}
+			visited[real] = true
+		}
 		var size int64
 		if !idDir {
-			info, err := v.Info()
-			if err == nil {
-				size = info.Size()
+			size = info.Size()
+			if target != "" {
+				size = int64(len(target))
 			}
 			id = fileName
 			if len(folder) > len(root) {
@@ -107,7 +132,9 @@ func list(root, folder string, dvNodes map[string]tree.Node) ([]Entry, error) {
 				parentId = strings.Join(ancestors, "/")
 				id = parentId + "/" + fileName
 			}
-			if _, ok := dvNodes[id]; ok {
+			if _, ok := dvNodes[id]; ok && target != "" {
+				checkSum = fmt.Sprintf("%x", md5.Sum([]byte(target)))
+			} else if ok {
 				checkSum, err = hash(path)
 				if err != nil {
 					return nil, err
@@ -127,6 +154,29 @@ func list(root, folder string, dvNodes map[string]tree.Node) ([]Entry, error) {
 	return res, nil
 }
 
+// entryInfo returns the info of the file or folder (of the link target when the link is followed), or the link target when the
+// link is recorded as a pointer; ok is false for the entries that are skipped
+func entryInfo(path string) (info os.FileInfo, target string, ok bool) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, "", false
+	}
+	if info.Mode()&os.ModeSymlink != 0 {
+		switch config.GetConfig().Options.Symlinks {
+		case "skip":
+			return nil, "", false
+		case "pointer":
+			target, err = os.Readlink(path)
+			return info, target, err == nil && target != ""
+		}
+		info, err = os.Stat(path)
+		if err != nil { // broken link
+			return nil, "", false
+		}
+	}
+	return info, "", info.Mode().IsRegular() || info.IsDir()
+}
+
 func hash(path string) (string, error) {
 	f, err := os.Open(path)
 	if err != nil {
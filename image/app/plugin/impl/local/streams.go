@@ -21,14 +21,27 @@ func Streams(_ context.Context, in map[string]tree.Node, streamParams types.Stre
 	for k, v := range in {
 		var err error
 		var reader io.ReadCloser
-		id := v.Id
+		path := url + string(os.PathSeparator) + v.SourceId()
 
 		res[k] = types.Stream{
-			Open: func() (io.Reader, error) {
-				reader, err = os.Open(url + string(os.PathSeparator) + id)
-				return reader, err
+			Open: func(ctx context.Context) (io.Reader, error) {
+				info, target, ok := entryInfo(path)
+				if !ok || info.IsDir() {
+					return nil, fmt.Errorf("%v is not a regular file", path)
+				}
+				if target != "" {
+					return strings.NewReader(target), nil
+				}
+				reader, err = os.Open(path)
+				if err != nil {
+					return nil, err
+				}
+				return types.ContextReader(ctx, reader), nil
 			},
 			Close: func() error {
+				if reader == nil {
+					return nil
+				}
 				return reader.Close()
 			},
 		}
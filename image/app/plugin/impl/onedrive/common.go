@@ -7,6 +7,7 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"io"
 	"net/http"
@@ -24,12 +25,13 @@ type Error struct {
 }
 
 type GraphItem struct {
-	Id     string `json:"id"`
-	Name   string `json:"name"`
-	Folder Folder `json:"folder"`
-	File   File   `json:"file"`
-	Size   int64  `json:"size"`
-	Url    string `json:"@microsoft.graph.downloadUrl"`
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Folder   Folder `json:"folder"`
+	File     File   `json:"file"`
+	Size     int64  `json:"size"`
+	Modified string `json:"lastModifiedDateTime"`
+	Url      string `json:"@microsoft.graph.downloadUrl"`
 }
 
 type Folder struct {
@@ -56,6 +58,7 @@ type Entry struct {
 	Hash     string
 	HashType string
 	Size     int64
+	Modified int64 // unix time in nanoseconds
 }
 
 func listGraphItems(ctx context.Context, path, url, token string, recursive bool) ([]Entry, error) {
@@ -73,7 +76,8 @@ func listGraphItems(ctx context.Context, path, url, token string, recursive bool
 		sep = ""
 	}
 	for _, v := range response {
-		isDir := !(v.File.Hashes.Sha1Hash != "" || v.File.Hashes.Sha256Hash != "" || v.File.Hashes.QuickXorHash != "")
+		// the file facet is also present without hashes (e.g., in some SharePoint libraries)
+		isDir := !(v.File.Hashes.Sha1Hash != "" || v.File.Hashes.Sha256Hash != "" || v.File.Hashes.QuickXorHash != "" || v.File.MimeType != "")
 		id := path + sep + v.Name
 		if recursive && isDir && v.Folder.ChildCount > 0 {
 			folderEntries, err := listGraphItems(ctx, id, url, token, true)
@@ -104,6 +108,7 @@ func listGraphItems(ctx context.Context, path, url, token string, recursive bool
 			HashType: hashType,
 			Hash:     hash,
 			Size:     v.Size,
+			Modified: types.ParseModified(v.Modified),
 		})
 	}
 	return res, nil
@@ -130,7 +135,7 @@ func getParialResponse(ctx context.Context, url string, token string) (Response,
 	}
 	request.Header.Add("Accept", "application/json")
 	request.Header.Add("Authorization", "Bearer "+token)
-	r, err := http.DefaultClient.Do(request)
+	r, err := httpclient.Get("onedrive").Do(request)
 	if err != nil {
 		return Response{}, err
 	}
@@ -139,6 +144,9 @@ func getParialResponse(ctx context.Context, url string, token string) (Response,
 	if err != nil {
 		return Response{}, err
 	}
+	if r.StatusCode == http.StatusUnauthorized {
+		return Response{}, types.StatusError(r.StatusCode, b)
+	}
 	response := Response{}
 	err = json.Unmarshal(b, &response)
 	if err != nil {
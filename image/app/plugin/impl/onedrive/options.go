@@ -50,7 +50,7 @@ func listFolderGrapthItems(ctx context.Context, params types.OptionsRequest) (re
 	items, err := listGraphItems(ctx, folder, params.Url+"/drives/"+s[0]+"/root", params.Token, false)
 	res = []types.SelectItem{}
 	if err != nil {
-		logging.Logger.Printf("onedrive plugin err: %v\n", err)
+		logging.Logger.WarnContext(ctx, "listing onedrive folder failed", "error", err)
 		return res, nil // errors break the gui dropdown; most likely the path is a file, not a folder
 	}
 	for _, e := range items {
@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
@@ -26,16 +27,16 @@ func Query(ctx context.Context, req types.CompareRequest, nm map[string]tree.Nod
 	if err != nil {
 		return nil, err
 	}
-	return toNodeMap(folder, entries, nm, req.Token)
+	return toNodeMap(ctx, folder, entries, nm, req.Token)
 }
 
-func toNodeMap(folder string, entries []Entry, nm map[string]tree.Node, token string) (map[string]tree.Node, error) {
+func toNodeMap(ctx context.Context, folder string, entries []Entry, nm map[string]tree.Node, token string) (map[string]tree.Node, error) {
 	res := map[string]tree.Node{}
 	for _, e := range entries {
 		if e.IsDir {
 			continue
 		}
-		hashType, hash, err := hash(e, nm, token)
+		hashType, hash, err := hash(ctx, e, nm, token)
 		if err != nil {
 			return nil, err
 		}
@@ -52,6 +53,7 @@ func toNodeMap(folder string, entries []Entry, nm map[string]tree.Node, token st
 				RemoteHash:     hash,
 				RemoteHashType: hashType,
 				RemoteFilesize: e.Size,
+				RemoteModified: e.Modified,
 			},
 		}
 		res[id] = node
@@ -59,17 +61,25 @@ func toNodeMap(folder string, entries []Entry, nm map[string]tree.Node, token st
 	return res, nil
 }
 
-func hash(entry Entry, nm map[string]tree.Node, token string) (string, string, error) {
+func hash(ctx context.Context, entry Entry, nm map[string]tree.Node, token string) (string, string, error) {
 	if entry.HashType != "" {
 		return entry.HashType, entry.Hash, nil
 	}
+	if entry.Modified > 0 {
+		// the items without hashes (e.g., in some SharePoint libraries) are compared on the size and the modification time
+		return types.SizeAndTime, types.SizeAndTimeHash(entry.Size, entry.Modified), nil
+	}
 	if _, ok := nm[entry.Id]; !ok {
 		return types.Md5, types.NotNeeded, nil
 	}
-	req, _ := http.NewRequest("GET", entry.URL, nil)
+	if entry.Size == 0 {
+		// the Graph API does not return the hashes of the empty files, there is nothing to download
+		return types.Md5, fmt.Sprintf("%x", md5.Sum(nil)), nil
+	}
+	req, _ := http.NewRequestWithContext(ctx, "GET", entry.URL, nil)
 	req.Header.Add("Accept", "application/json")
 	req.Header.Add("Authorization", "Bearer "+token)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpclient.Get("onedrive").Do(req)
 	if err != nil {
 		return "", "", err
 	}
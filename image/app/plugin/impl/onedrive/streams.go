@@ -5,13 +5,14 @@ package onedrive
 import (
 	"context"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
 	"net/http"
 )
 
-func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
+func Streams(_ context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
 	token := streamParams.Token
 	if token == "" {
 		return types.StreamsType{}, fmt.Errorf("streams: missing parameters: token")
@@ -19,17 +20,18 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 	res := map[string]types.Stream{}
 
 	for k, v := range in {
-		request, err := http.NewRequestWithContext(ctx, "GET", v.Attributes.URL, nil)
-		if err != nil {
-			return types.StreamsType{}, err
-		}
-		request.Header.Add("Accept", "application/json")
-		request.Header.Add("Authorization", "Bearer "+token)
+		url := v.Attributes.URL
 		var r *http.Response
 
 		res[k] = types.Stream{
-			Open: func() (io.Reader, error) {
-				r, err = http.DefaultClient.Do(request)
+			Open: func(ctx context.Context) (io.Reader, error) {
+				request, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+				if err != nil {
+					return nil, err
+				}
+				request.Header.Add("Accept", "application/json")
+				request.Header.Set("Authorization", "Bearer "+streamParams.CurrentToken())
+				r, err = httpclient.Get("onedrive").Do(request)
 				if err != nil {
 					return nil, err
 				}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"io"
 	"net/http"
@@ -36,6 +37,7 @@ type Attributes struct {
 	Materialized_path string `json:"materialized_path"`
 	Guid              string `json:"guid"`
 	Size              int64  `json:"size"`
+	DateModified      string `json:"date_modified"`
 }
 
 type Extra struct {
@@ -78,6 +80,7 @@ type File struct {
 	Hash     string
 	HashType string
 	Size     int64
+	Modified int64
 }
 
 func getPage(ctx context.Context, url, token string) ([]Data, string, error) {
@@ -114,12 +117,16 @@ func query(ctx context.Context, url, token string) ([]byte, error) {
 	if token != "" {
 		request.Header.Add("Authorization", "Bearer "+token)
 	}
-	r, err := http.DefaultClient.Do(request)
+	r, err := httpclient.Get("osf").Do(request)
 	if err != nil {
 		return nil, err
 	}
 	defer r.Body.Close()
-	return io.ReadAll(r.Body)
+	b, err := io.ReadAll(r.Body)
+	if err == nil && r.StatusCode == http.StatusUnauthorized {
+		err = types.StatusError(r.StatusCode, b)
+	}
+	return b, err
 }
 
 func getFiles(ctx context.Context, server, repoName, token string) ([]File, error) {
@@ -152,12 +159,17 @@ func getFilesFrom(ctx context.Context, url, token string) ([]File, error) {
 		path = strings.TrimSuffix(path, "/")
 		hashType := ""
 		hash := ""
+		modified := types.ParseModified(v.Attributes.DateModified)
 		if v.Attributes.Extra.Hashes.Md5 != "" {
 			hashType = types.Md5
 			hash = v.Attributes.Extra.Hashes.Md5
 		} else if v.Attributes.Extra.Hashes.Sha256 != "" {
 			hashType = types.SHA256
 			hash = v.Attributes.Extra.Hashes.Sha256
+		} else if modified > 0 {
+			// the add-on storages (e.g., Dropbox or ownCloud) do not report the hashes
+			hashType = types.SizeAndTime
+			hash = types.SizeAndTimeHash(v.Attributes.Size, modified)
 		}
 		files = append(files, File{
 			Id:       id,
@@ -168,6 +180,7 @@ func getFilesFrom(ctx context.Context, url, token string) ([]File, error) {
 			Hash:     hash,
 			HashType: hashType,
 			Size:     v.Attributes.Size,
+			Modified: modified,
 		})
 		href := v.Relationships.Files.LinksWithHref.Related.Href
 		if href != "" {
@@ -33,6 +33,7 @@ func toNodeMap(files []File) (map[string]tree.Node, error) {
 				RemoteHash:     file.Hash,
 				RemoteHashType: file.HashType,
 				RemoteFilesize: file.Size,
+				RemoteModified: file.Modified,
 			},
 		}
 		res[node.Id] = node
@@ -7,6 +7,8 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"integration/app/httpclient"
+	"integration/app/plugin/types"
 	"io"
 	"net/http"
 	"net/url"
@@ -51,7 +53,7 @@ func listEntries(ctx context.Context, folderId int64, path, url, token string, r
 	}
 	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	request.Header.Add("Accept", "application/json")
-	r, err := http.DefaultClient.Do(request)
+	r, err := httpclient.Get("redcap").Do(request)
 	if err != nil {
 		return nil, err
 	}
@@ -60,6 +62,10 @@ func listEntries(ctx context.Context, folderId int64, path, url, token string, r
 	if err != nil {
 		return nil, err
 	}
+	// REDCap responds with 403 to the invalid tokens
+	if r.StatusCode == http.StatusUnauthorized || r.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: %s", types.ErrUnauthorized, b)
+	}
 	response := []RedCapResponseEntry{}
 	err = json.Unmarshal(b, &response)
 	if err != nil {
@@ -6,6 +6,7 @@ import (
 	"context"
 	"crypto/md5"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
@@ -23,16 +24,16 @@ func Query(ctx context.Context, req types.CompareRequest, nm map[string]tree.Nod
 	if err != nil {
 		return nil, err
 	}
-	return toNodeMap(entries, nm, url, req.Token)
+	return toNodeMap(ctx, entries, nm, url, req.Token)
 }
 
-func toNodeMap(entries []Entry, nm map[string]tree.Node, url, token string) (map[string]tree.Node, error) {
+func toNodeMap(ctx context.Context, entries []Entry, nm map[string]tree.Node, url, token string) (map[string]tree.Node, error) {
 	res := map[string]tree.Node{}
 	for _, e := range entries {
 		if e.IsDir {
 			continue
 		}
-		checkSum, size, err := hash(e, nm, url, token)
+		checkSum, size, err := hash(ctx, e, nm, url, token)
 		if err != nil {
 			return nil, err
 		}
@@ -54,7 +55,7 @@ func toNodeMap(entries []Entry, nm map[string]tree.Node, url, token string) (map
 	return res, nil
 }
 
-func hash(entry Entry, nm map[string]tree.Node, url, token string) (string, int64, error) {
+func hash(ctx context.Context, entry Entry, nm map[string]tree.Node, url, token string) (string, int64, error) {
 	if _, ok := nm[entry.Id]; !ok {
 		return types.NotNeeded, 0, nil
 	}
@@ -65,10 +66,10 @@ func hash(entry Entry, nm map[string]tree.Node, url, token string) (string, int6
 		DocId:        entry.DocId,
 		ReturnFormat: "json",
 	}
-	req, _ := http.NewRequest("POST", url, encode(data))
+	req, _ := http.NewRequestWithContext(ctx, "POST", url, encode(data))
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Add("Accept", "application/json")
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := httpclient.Get("redcap").Do(req)
 	if err != nil {
 		return "", 0, err
 	}
@@ -5,6 +5,7 @@ package redcap
 import (
 	"context"
 	"fmt"
+	"integration/app/httpclient"
 	"integration/app/plugin/types"
 	"integration/app/tree"
 	"io"
@@ -12,7 +13,7 @@ import (
 	"strconv"
 )
 
-func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
+func Streams(_ context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error) {
 	token := streamParams.Token
 	url := fmt.Sprintf("%s/api/", streamParams.Url)
 	if token == "" || url == "" {
@@ -29,17 +30,17 @@ func Streams(ctx context.Context, in map[string]tree.Node, streamParams types.St
 			DocId:        int64(docId),
 			ReturnFormat: "json",
 		}
-		request, err := http.NewRequestWithContext(ctx, "POST", url, encode(data))
-		if err != nil {
-			return types.StreamsType{}, err
-		}
-		request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
-		request.Header.Add("Accept", "application/json")
 		var r *http.Response
 
 		res[k] = types.Stream{
-			Open: func() (io.Reader, error) {
-				r, err = http.DefaultClient.Do(request)
+			Open: func(ctx context.Context) (io.Reader, error) {
+				request, err := http.NewRequestWithContext(ctx, "POST", url, encode(data))
+				if err != nil {
+					return nil, err
+				}
+				request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+				request.Header.Add("Accept", "application/json")
+				r, err = httpclient.Get("redcap").Do(request)
 				if err != nil {
 					return nil, err
 				}
@@ -7,6 +7,7 @@ import (
 	"integration/app/plugin/impl/dataverse"
 	"integration/app/plugin/impl/github"
 	"integration/app/plugin/impl/gitlab"
+	"integration/app/plugin/impl/googlecloud"
 	"integration/app/plugin/impl/irods"
 	"integration/app/plugin/impl/local"
 	"integration/app/plugin/impl/onedrive"
@@ -17,24 +18,39 @@ import (
 )
 
 type Plugin struct {
-	Query   func(ctx context.Context, req types.CompareRequest, dvNodes map[string]tree.Node) (map[string]tree.Node, error)
-	Options func(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error)
-	Search  func(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error)
-	Streams func(ctx context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error)
+	Query    func(ctx context.Context, req types.CompareRequest, dvNodes map[string]tree.Node) (map[string]tree.Node, error)
+	Options  func(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error)
+	Search   func(ctx context.Context, params types.OptionsRequest) ([]types.SelectItem, error)
+	Streams  func(ctx context.Context, in map[string]tree.Node, streamParams types.StreamParams) (types.StreamsType, error)
+	Estimate func(ctx context.Context, req types.CompareRequest) (types.Estimate, error)                                                    // optional: cheap repository statistics
+	Revision func(ctx context.Context, req types.CompareRequest) (string, error)                                                            // optional: current revision (e.g., the commit) of the repository, enables the cached snapshots (Query must then accept the revision as option)
+	Changes  func(ctx context.Context, req types.CompareRequest, from, to string, nodes map[string]tree.Node) (map[string]tree.Node, error) // optional: applies the changes between the revisions to the nodes of the snapshot
+	Scopes   func(ctx context.Context, req types.CompareRequest) error                                                                      // optional: checks that the token can read the repository before the compare starts
+	Public   bool                                                                                                                           // the public repositories can be read without a token
 }
 
 var pluginMap map[string]Plugin = map[string]Plugin{
 	"github": {
-		Query:   github.Query,
-		Options: github.Options,
-		Search:  github.Search,
-		Streams: github.Streams,
+		Query:    github.Query,
+		Options:  github.Options,
+		Search:   github.Search,
+		Streams:  github.Streams,
+		Estimate: github.Estimate,
+		Revision: github.Revision,
+		Changes:  github.Changes,
+		Scopes:   github.Scopes,
+		Public:   true,
 	},
 	"gitlab": {
-		Query:   gitlab.Query,
-		Options: gitlab.Options,
-		Search:  gitlab.Search,
-		Streams: gitlab.Streams,
+		Query:    gitlab.Query,
+		Options:  gitlab.Options,
+		Search:   gitlab.Search,
+		Streams:  gitlab.Streams,
+		Estimate: gitlab.Estimate,
+		Revision: gitlab.Revision,
+		Changes:  gitlab.Changes,
+		Scopes:   gitlab.Scopes,
+		Public:   true,
 	},
 	"irods": {
 		Query:   irods.Query,
@@ -60,6 +76,13 @@ var pluginMap map[string]Plugin = map[string]Plugin{
 		Search:  onedrive.Search,
 		Streams: onedrive.Streams,
 	},
+	"googlecloud": {
+		Query:   googlecloud.Query,
+		Options: nil,
+		Search:  nil,
+		Streams: googlecloud.Streams,
+		Public:  true,
+	},
 	"dataverse": {
 		Query:   dataverse.Query,
 		Options: nil,
@@ -77,3 +100,9 @@ var pluginMap map[string]Plugin = map[string]Plugin{
 func GetPlugin(p string) Plugin {
 	return pluginMap[p]
 }
+
+// IsRegistered tells whether the plugin type is implemented by the backend
+func IsRegistered(p string) bool {
+	_, ok := pluginMap[p]
+	return ok
+}
@@ -13,4 +13,8 @@ type CompareRequest struct {
 	PersistentId string `json:"persistentId"`
 	NewlyCreated bool   `json:"newlyCreated"`
 	DataverseKey string `json:"dataverseKey"`
+	Version      string `json:"version,omitempty"` // dataset version to compare with, ":latest" when empty
+	Prewarm      bool   `json:"prewarm,omitempty"` // register the connection for the background compare (see the prewarm option)
+	Refresh      bool   `json:"refresh,omitempty"` // compare now, even when a pre-warmed result is available
+	Folder       string `json:"folder,omitempty"`  // folder of the repository compared with the dataset (its content is the root of the dataset), the whole repository when empty
 }
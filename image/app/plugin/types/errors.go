@@ -0,0 +1,36 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package types
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrUnauthorized is wrapped by the plugins when the repository rejects the token, so that the user can be asked to authenticate again
+var ErrUnauthorized = errors.New("the repository rejected the credentials")
+
+// ErrInsufficientScope is wrapped by the plugins when the token is accepted but does not grant the access needed to read the repository,
+// e.g., a GitHub token without the repo scope for a private repository
+var ErrInsufficientScope = errors.New("the token does not have the needed scopes")
+
+// ErrRateLimited is wrapped by the plugins when the repository rejects the requests because of its rate limit (e.g., the stricter
+// limits of the requests without a token)
+var ErrRateLimited = errors.New("the rate limit of the repository is exceeded")
+
+// ErrTooManyChanges is returned by the plugins when the changes since the cached snapshot can not be listed incrementally,
+// the full tree of the repository is then queried
+var ErrTooManyChanges = errors.New("too many changes for an incremental compare")
+
+// StatusError is the error of an unsuccessful response of the repository, wrapping ErrUnauthorized for the rejected tokens and
+// ErrRateLimited for the exceeded rate limits
+func StatusError(status int, body []byte) error {
+	if status == http.StatusUnauthorized {
+		return fmt.Errorf("%w: %s", ErrUnauthorized, body)
+	}
+	if status == http.StatusTooManyRequests {
+		return fmt.Errorf("%w: %s", ErrRateLimited, body)
+	}
+	return fmt.Errorf("%d - %s", status, body)
+}
@@ -0,0 +1,17 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package types
+
+// Estimate contains the repository statistics that can be retrieved without building the full node map,
+// negative values are used when the plugin could not determine the value
+type Estimate struct {
+	FileCount    int         `json:"fileCount"`
+	TotalSize    int64       `json:"totalSize"`
+	LargestFiles []LargeFile `json:"largestFiles,omitempty"`
+	Approximate  bool        `json:"approximate"` // e.g., GitHub reports the repository size including the history
+}
+
+type LargeFile struct {
+	Id   string `json:"id"`
+	Size int64  `json:"size"`
+}
@@ -2,6 +2,12 @@
 
 package types
 
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
 const (
 	SHA1         = "SHA-1"
 	GitHash      = "git-hash"
@@ -9,8 +15,55 @@ const (
 	SHA256       = "SHA256"
 	SHA512       = "SHA512"
 	QuickXorHash = "quickXorHash"
+	CRC32C       = "CRC32C" // e.g., Google Cloud Storage, hex of the big-endian value
 	FileSize     = "FileSize"
+	SizeAndTime  = "size+mtime" // sources without checksums (e.g., FTP or plain HTTP), see SizeAndTimeHash
 	NotNeeded    = "not needed"
 	Written      = "written"
 	Deleted      = "deleted"
 )
+
+// SizeAndTimeHash is the remote hash of the SizeAndTime hash type: the plugins set it together with RemoteFilesize and
+// RemoteModified, the files are then compared on the size and the modification time instead of being rehashed
+func SizeAndTimeHash(size, modified int64) string {
+	return fmt.Sprintf("%d@%d", size, modified)
+}
+
+// ParseModified parses the modification time reported by a source (RFC 3339, or without the time zone for UTC) to the unix time
+// in nanoseconds of RemoteModified, 0 when it is not known
+func ParseModified(value string) int64 {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05.999999999"} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t.UnixNano()
+		}
+	}
+	return 0
+}
+
+// NormalizeHashType maps the checksum algorithm names used by Dataverse (e.g., "SHA-256") to the hash types used in this application
+func NormalizeHashType(hashType string) string {
+	switch strings.ToUpper(hashType) {
+	case "MD5":
+		return Md5
+	case "SHA-1", "SHA1":
+		return SHA1
+	case "SHA-256", "SHA256":
+		return SHA256
+	case "SHA-512", "SHA512":
+		return SHA512
+	case "CRC32C", "CRC-32C":
+		return CRC32C
+	}
+	return hashType
+}
+
+// DataverseHashType maps the hash type to the checksum algorithm name expected by Dataverse
+func DataverseHashType(hashType string) string {
+	switch NormalizeHashType(hashType) {
+	case SHA256:
+		return "SHA-256"
+	case SHA512:
+		return "SHA-512"
+	}
+	return hashType
+}
@@ -2,10 +2,15 @@
 
 package types
 
-import "io"
+import (
+	"context"
+	"io"
+)
 
+// Stream reads a file of the repository: Open receives the context of the read (e.g., of the job writing the file, not of the
+// call to Streams), the reading must stop with the error of the context when it is cancelled
 type Stream struct {
-	Open  func() (io.Reader, error)
+	Open  func(ctx context.Context) (io.Reader, error)
 	Close func() error
 }
 
@@ -13,3 +18,21 @@ type StreamsType struct {
 	Streams map[string]Stream
 	Cleanup func() error
 }
+
+// ContextReader ends the reading with the error of the context once the context is cancelled, for the sources that are not
+// context aware (e.g., the local files)
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return contextReader{ctx, r}
+}
+
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func (r contextReader) Read(buf []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(buf)
+}
@@ -9,4 +9,16 @@ type StreamParams struct {
 	Option   string `json:"option"`
 	User     string `json:"user"`
 	Token    string `json:"token"`
+	// TokenSource is set by the workers for the OAuth tokens: it returns the current access token, refreshed when it is about to expire
+	TokenSource func() string `json:"-"`
+}
+
+// CurrentToken returns the token to use for the next request, the plugins streaming for a long time should call it when opening each stream
+func (p StreamParams) CurrentToken() string {
+	if p.TokenSource != nil {
+		if token := p.TokenSource(); token != "" {
+			return token
+		}
+	}
+	return p.Token
 }
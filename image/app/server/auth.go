@@ -0,0 +1,114 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"math"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// withAuthentication authenticates the service API keys, and the session cookie or the bearer token when OIDC is configured:
+// the user header is then set by the server only (a user header sent by the client is dropped); without OIDC, the session of the
+// cookie is only used by the user of the header set by the proxy
+func withAuthentication(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key, ok := strings.CutPrefix(r.Header.Get("Authorization"), "ApiKey "); ok {
+			r.Header.Del(core.UserHeaderName())
+			identity, err := core.AuthenticateApiKey(r.Context(), key)
+			if errors.Is(err, core.ErrRateLimited) {
+				w.Header().Set("Retry-After", "60")
+				common.WriteError(w, r, http.StatusTooManyRequests, err)
+				return
+			}
+			if err != nil {
+				logging.Logger.WarnContext(r.Context(), "API key rejected", "error", err)
+				common.WriteError(w, r, http.StatusUnauthorized, errors.New("invalid API key"))
+				return
+			}
+			next.ServeHTTP(w, authenticated(r, identity))
+			return
+		}
+		if !core.OidcEnabled() {
+			if c, err := r.Cookie(core.SessionCookieName); err == nil {
+				if session, ok := core.GetSession(r.Context(), c.Value); ok && session.User == core.GetUserFromHeader(r.Header) {
+					r = r.WithContext(core.WithSession(r.Context(), c.Value, session))
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+		r.Header.Del(core.UserHeaderName())
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			identity, err := core.AuthenticateBearer(r.Context(), bearer)
+			if err != nil {
+				logging.Logger.WarnContext(r.Context(), "bearer token rejected", "error", err)
+				common.WriteError(w, r, http.StatusUnauthorized, errors.New("invalid bearer token"))
+				return
+			}
+			r = authenticated(r, identity)
+		} else if c, err := r.Cookie(core.SessionCookieName); err == nil {
+			if session, ok := core.GetSession(r.Context(), c.Value); ok {
+				r = authenticated(r, session.Identity)
+				r = r.WithContext(core.WithSession(r.Context(), c.Value, session))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func authenticated(r *http.Request, identity core.Identity) *http.Request {
+	r.Header.Set(core.UserHeaderName(), identity.User)
+	return r.WithContext(core.WithIdentity(r.Context(), identity))
+}
+
+// requireUser rejects the unauthenticated calls when OIDC is configured, used for the endpoints that change state
+func requireUser(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := core.IdentityFromContext(r.Context()); core.OidcEnabled() && !ok {
+			common.WriteError(w, r, http.StatusUnauthorized, errors.New("login required"))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+// rateLimited applies the rate limit of the group ("compare" or "store") per API key, user or IP address
+func rateLimited(group string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit, ok := config.GetConfig().Options.RateLimits[group]
+		if !ok {
+			handler(w, r)
+			return
+		}
+		allowed, wait := core.TakeToken(r.Context(), group+": "+rateLimitKey(r), limit.PerMinute, limit.Burst)
+		if !allowed {
+			w.Header().Set("Retry-After", fmt.Sprint(int(math.Ceil(wait.Seconds()))))
+			common.WriteError(w, r, http.StatusTooManyRequests, fmt.Errorf("%w: too many %v requests, retry in %v", core.ErrRateLimited, group, wait.Round(time.Second)))
+			return
+		}
+		handler(w, r)
+	}
+}
+
+func rateLimitKey(r *http.Request) string {
+	if identity, ok := core.IdentityFromContext(r.Context()); ok && identity.ApiKey != nil {
+		return "api key: " + identity.ApiKey.Id
+	}
+	if user := core.GetUserFromHeader(r.Header); user != "" {
+		return "user: " + user
+	}
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+	return "ip: " + ip
+}
@@ -0,0 +1,166 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package server
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"integration/app/config"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// the smaller responses are not worth compressing
+const minCompressSize = 1024
+
+var gzipWriters = sync.Pool{New: func() any { w, _ := gzip.NewWriterLevel(io.Discard, gzip.BestSpeed); return w }}
+var flateWriters = sync.Pool{New: func() any { w, _ := flate.NewWriter(io.Discard, flate.BestSpeed); return w }}
+
+// withCompression compresses the text and JSON responses (e.g., the large cached compare responses) with gzip or deflate, as
+// accepted by the client, unless the compression is disabled (e.g., when done by the proxy)
+func withCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding := acceptedEncoding(r.Header.Get("Accept-Encoding"))
+		if config.GetConfig().Options.DisableCompression || encoding == "" || r.Header.Get("Range") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Accept-Encoding")
+		cw := &compressWriter{ResponseWriter: w, encoding: encoding}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// acceptedEncoding returns "gzip" or "deflate" (gzip is preferred), empty when the client accepts neither
+func acceptedEncoding(header string) string {
+	res := ""
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				continue
+			}
+		}
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "gzip":
+			return "gzip"
+		case "deflate":
+			res = "deflate"
+		}
+	}
+	return res
+}
+
+// compressWriter decides at the first write whether the response is compressed, based on its status, type and length
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	decided     bool
+	status      int
+	compressor  io.WriteCloser
+	release     func()
+	wroteHeader bool
+}
+
+func (cw *compressWriter) WriteHeader(status int) {
+	if cw.wroteHeader {
+		return
+	}
+	cw.status = status
+	if status < 200 || status == http.StatusNoContent || status == http.StatusNotModified || status == http.StatusPartialContent {
+		cw.decided = true
+		cw.writeHeader()
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if !cw.decided {
+		cw.decide(p)
+	}
+	cw.writeHeader()
+	if cw.compressor != nil {
+		return cw.compressor.Write(p)
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *compressWriter) decide(p []byte) {
+	cw.decided = true
+	h := cw.Header()
+	if h.Get("Content-Encoding") != "" {
+		return
+	}
+	contentType := h.Get("Content-Type")
+	if contentType == "" {
+		contentType = http.DetectContentType(p)
+		h.Set("Content-Type", contentType)
+	}
+	if !compressible(contentType) {
+		return
+	}
+	if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil && length < minCompressSize {
+		return
+	}
+	if h.Get("Content-Length") == "" && len(p) < minCompressSize {
+		// the handlers writing the whole response at once (the JSON responses)
+		return
+	}
+	h.Del("Content-Length")
+	h.Set("Content-Encoding", cw.encoding)
+	if etag := h.Get("ETag"); strings.HasPrefix(etag, `"`) {
+		// the compressed bytes differ: the strong ETag of the content only weakly matches them
+		h.Set("ETag", "W/"+etag)
+	}
+	if cw.encoding == "gzip" {
+		gz := gzipWriters.Get().(*gzip.Writer)
+		gz.Reset(cw.ResponseWriter)
+		cw.compressor, cw.release = gz, func() { gzipWriters.Put(gz) }
+	} else {
+		fl := flateWriters.Get().(*flate.Writer)
+		fl.Reset(cw.ResponseWriter)
+		cw.compressor, cw.release = fl, func() { flateWriters.Put(fl) }
+	}
+}
+
+func (cw *compressWriter) writeHeader() {
+	if cw.wroteHeader {
+		return
+	}
+	cw.wroteHeader = true
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) close() {
+	if !cw.wroteHeader && cw.status != 0 {
+		// a response without a body
+		cw.writeHeader()
+	}
+	if cw.compressor != nil {
+		cw.compressor.Close()
+		cw.release()
+	}
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	switch {
+	case strings.HasPrefix(mediaType, "text/"):
+		return mediaType != "text/event-stream"
+	case mediaType == "application/json", strings.HasSuffix(mediaType, "+json"), mediaType == "application/javascript",
+		mediaType == "application/xml", strings.HasSuffix(mediaType, "+xml"), mediaType == "image/svg+xml":
+		return true
+	}
+	return false
+}
@@ -3,14 +3,16 @@
 package server
 
 import (
-	"crypto/tls"
+	"context"
 	"fmt"
 	"integration/app/common"
 	"integration/app/config"
 	"integration/app/core"
 	"integration/app/frontend"
 	"integration/app/logging"
+	"integration/app/openapi"
 	"integration/app/plugin/funcs/compare"
+	"integration/app/plugin/funcs/estimate"
 	"integration/app/plugin/funcs/options"
 	"integration/app/plugin/funcs/search"
 	"net/http"
@@ -19,32 +21,91 @@ import (
 
 const timeout = 5 * time.Minute
 
-func Start() {
+// Handler returns the API and the frontend with the middleware (authentication, origin check and correlation ids)
+func Handler() http.Handler {
 	srvMux := http.NewServeMux()
 
 	// serve plugin api
-	srvMux.HandleFunc("/api/plugin/compare", compare.Compare)
+	srvMux.HandleFunc("/api/plugin/compare", requireUser(rateLimited("compare", compare.Compare)))
+	srvMux.HandleFunc("/api/plugin/batch", requireUser(rateLimited("store", compare.Batch)))
+	srvMux.HandleFunc("/api/plugin/batchstatus", compare.BatchStatusHandler)
+	srvMux.HandleFunc("/api/plugin/migrate", requireUser(rateLimited("store", compare.Migrate)))
+	srvMux.HandleFunc("/api/plugin/migrationstatus", compare.MigrationStatusHandler)
+	srvMux.HandleFunc("/api/plugin/schedule", requireUser(rateLimited("store", compare.Schedule)))
+	srvMux.HandleFunc("/api/plugin/schedules", requireUser(compare.Schedules))
+	srvMux.HandleFunc("/api/plugin/unschedule", requireUser(compare.Unschedule))
 	srvMux.HandleFunc("/api/plugin/options", options.Options)
 	srvMux.HandleFunc("/api/plugin/search", search.Search)
+	srvMux.HandleFunc("/api/plugin/estimate", estimate.Estimate)
 
 	// common
-	srvMux.HandleFunc("/api/common/oauthtoken", common.GetOauthToken)
-	srvMux.HandleFunc("/api/common/newdataset", common.NewDataset)
-	srvMux.HandleFunc("/api/common/compare", common.Compare)
+	srvMux.HandleFunc("/api/common/oauthtoken", requireUser(common.GetOauthToken))
+	srvMux.HandleFunc("/api/common/credential", requireUser(common.Credential))
+	srvMux.HandleFunc("/api/common/credential/provision", requireUser(common.ProvisionedCredential))
+	srvMux.HandleFunc("/api/common/newdataset", requireUser(common.NewDataset))
+	srvMux.HandleFunc("/api/common/newdatasetcollections", common.DatasetCollections)
+	srvMux.HandleFunc("/api/common/compare", requireUser(common.Compare))
 	srvMux.HandleFunc("/api/common/cached", common.GetCachedResponse)
-	srvMux.HandleFunc("/api/common/store", common.Store)
+	srvMux.HandleFunc("/api/common/selection", common.Selection)
+	srvMux.HandleFunc("/api/common/store", requireUser(rateLimited("store", common.Store)))
 	srvMux.HandleFunc("/api/common/dvobjects", common.DvObjects)
+	srvMux.HandleFunc("/api/common/datasets", common.Datasets)
+	srvMux.HandleFunc("/api/common/collection", common.Collection)
+	srvMux.HandleFunc("/api/common/report", requireUser(common.Report))
+	srvMux.HandleFunc("/api/common/archivedjobs", common.ArchivedJobs)
+	srvMux.HandleFunc("/api/common/history", requireUser(common.History))
+	srvMux.HandleFunc("/api/common/connections", requireUser(common.Connections))
+	srvMux.HandleFunc("/api/common/userdata", requireUser(common.UserData))
+	srvMux.HandleFunc("/api/common/revoke", requireUser(common.RevokeUserData))
+	srvMux.HandleFunc("/api/common/fixity", requireUser(common.Fixity))
+	srvMux.HandleFunc("/api/common/fixityreport", common.FixityReport)
+	srvMux.HandleFunc("/api/common/bag", requireUser(common.Bag))
+	srvMux.HandleFunc("/api/common/bagdownload", requireUser(common.BagDownload))
+	srvMux.HandleFunc("/api/common/bagreport", common.BagReport)
+	srvMux.HandleFunc("/api/common/exporttargets", common.ExportTargets)
+	srvMux.HandleFunc("/api/common/export", requireUser(common.Export))
+	srvMux.HandleFunc("/api/common/exportreport", common.ExportReport)
+	srvMux.HandleFunc("/api/common/invalidatecache", requireUser(common.InvalidateCache))
+	srvMux.HandleFunc("/api/common/events", requireUser(common.Events))
+
+	// authentication (OIDC) and the sessions
+	srvMux.HandleFunc("/api/auth/login", common.Login)
+	srvMux.HandleFunc("/api/auth/callback", common.LoginCallback)
+	srvMux.HandleFunc("/api/auth/logout", common.Logout)
+	srvMux.HandleFunc("/api/auth/session", requireUser(common.Session))
+	srvMux.HandleFunc("/api/auth/me", common.Me)
+
+	// admin
+	srvMux.HandleFunc("/api/admin/adoptjob", requireUser(common.AdoptJob))
+	srvMux.HandleFunc("/api/admin/audit", common.Audit)
+	srvMux.HandleFunc("/api/admin/status", common.AdminStatus)
+	srvMux.HandleFunc("/api/admin/config", common.AdminConfig)
+	srvMux.HandleFunc("/api/admin/unlock", requireUser(common.ForceUnlock))
+	srvMux.HandleFunc("/api/admin/flush", requireUser(common.FlushCaches))
+	srvMux.HandleFunc("/api/admin/orphans", requireUser(common.Orphans))
+	srvMux.HandleFunc("/api/admin/apikeys", common.ApiKeys)
+	srvMux.HandleFunc("/api/admin/apikeys/create", requireUser(common.CreateApiKey))
+	srvMux.HandleFunc("/api/admin/apikeys/revoke", requireUser(common.RevokeApiKey))
+
+	// health
+	srvMux.HandleFunc("/healthz", common.Healthz)
+	srvMux.HandleFunc("/readyz", common.Readyz)
+
+	// API documentation
+	srvMux.HandleFunc("/api/openapi.json", openapi.Spec)
+	srvMux.HandleFunc("/api/docs", openapi.Docs)
 
 	// frontend config
 	srvMux.HandleFunc("/api/frontend/config", frontend.GetConfig)
+	srvMux.HandleFunc("/api/frontend/plugins", frontend.PluginCatalog)
 
 	// quit
 	if config.AllowQuit {
 		srvMux.HandleFunc("/quit", func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte("Server shut down and all jobs are cancelled. You can close the browser window now."))
 			defer func() {
-				logging.Logger.Println("quiting...")
-				close(core.Stop)
+				logging.Logger.Info("quiting...")
+				core.StopAll()
 			}()
 		})
 	}
@@ -52,17 +113,76 @@ func Start() {
 	// serve html
 	srvMux.Handle("/", http.HandlerFunc(frontend.Frontend))
 
-	// allow bad certificates
-	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	// the event streams stay open: they are not wrapped in the timeout handler, that also buffers the response, and not compressed
+	api := withCorrelationId(withOriginCheck(withAuthentication(withTarget(srvMux))))
+	handler := http.NewServeMux()
+	handler.Handle("/api/common/events", api)
+	handler.Handle("/", withCompression(http.TimeoutHandler(api, timeout, fmt.Sprintf("processing the request took longer than %v: cancelled", timeout))))
+	return handler
+}
 
+func Start() {
 	srv := &http.Server{
 		Addr:              ":7788",
 		ReadTimeout:       timeout,
 		WriteTimeout:      timeout,
 		IdleTimeout:       timeout,
 		ReadHeaderTimeout: timeout,
-		TLSConfig:         tlsConfig,
-		Handler:           http.TimeoutHandler(srvMux, timeout, fmt.Sprintf("processing the request took longer than %v: cancelled", timeout)),
+		Handler:           Handler(),
+	}
+
+	// background refresh of the registered compares (when enabled)
+	go compare.Prewarm()
+
+	// the periodic batch syncs (when the history database is configured)
+	go compare.RunSchedules()
+
+	// the compares queued as background jobs (see the compare option)
+	go compare.ProcessCompares()
+
+	// stop accepting new requests on shutdown and give the running requests the grace period to finish
+	shutdown := make(chan struct{})
+	go func() {
+		<-core.Stop
+		ctx, cancel := context.WithTimeout(context.Background(), core.ShutdownGracePeriod())
+		defer cancel()
+		err := srv.Shutdown(ctx)
+		if err != nil {
+			logging.Logger.Warn("http server shutdown", "error", err)
+		}
+		close(shutdown)
+	}()
+	err := srv.ListenAndServe()
+	if err == http.ErrServerClosed {
+		<-shutdown
+		logging.Logger.Info("http server stopped")
+		return
 	}
-	srv.ListenAndServe()
+	logging.Logger.Error("http server failed", "error", err)
+}
+
+// withCorrelationId attaches the correlation id (from the X-Request-Id header or a new one) to the request context and the response,
+// the jobs added by the request inherit it
+func withCorrelationId(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-Id")
+		if id == "" || len(id) > 128 {
+			id = logging.NewCorrelationId()
+		}
+		w.Header().Set("X-Request-Id", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithCorrelationId(r.Context(), id)))
+	})
+}
+
+// withTarget selects the Dataverse installation of the request (one of the dataverseTargets) with the X-Dataverse-Target header,
+// the default installation is used without the header
+func withTarget(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := r.Header.Get("X-Dataverse-Target")
+		if !config.TargetExists(name) {
+			common.WriteError(w, r, http.StatusBadRequest, fmt.Errorf("unknown Dataverse target: %v", name))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(config.WithTarget(r.Context(), name)))
+	})
 }
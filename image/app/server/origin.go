@@ -0,0 +1,92 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package server
+
+import (
+	"errors"
+	"fmt"
+	"integration/app/common"
+	"integration/app/config"
+	"integration/app/logging"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+const defaultCorsMaxAge = 600
+
+// withOriginCheck rejects the state changing calls made by the browsers from other origins (CSRF) and answers the CORS requests
+// of the origins allowed in the "cors" option
+func withOriginCheck(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := config.GetConfig().Options.Cors
+		origin := r.Header.Get("Origin")
+		allowed := origin != "" && corsAllowed(c, origin)
+		if allowed {
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+			w.Header().Set("Access-Control-Expose-Headers", "X-Request-Id")
+			if c.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			if !allowed {
+				common.WriteError(w, r, http.StatusForbidden, errors.New("origin not allowed"))
+				return
+			}
+			maxAge := c.MaxAge
+			if maxAge <= 0 {
+				maxAge = defaultCorsMaxAge
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Request-Id, X-Dataverse-Target")
+			w.Header().Set("Access-Control-Max-Age", fmt.Sprint(maxAge))
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if !safeMethod(r.Method) && !allowedSource(r, c) {
+			logging.Logger.WarnContext(r.Context(), "cross-origin request rejected", "origin", origin, "referer", r.Referer(), "path", r.URL.Path)
+			common.WriteError(w, r, http.StatusForbidden, errors.New("cross-origin request rejected"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func safeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// allowedSource checks the Origin header, or the Referer header when the browser did not send the origin: the calls must come
+// from the application itself or an allowed origin. The calls without both headers are not made by a browser (e.g., scripts using
+// an API key) and can not be forged by another site.
+func allowedSource(r *http.Request, c config.CorsConfig) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Referer()
+	}
+	if source == "" {
+		return true
+	}
+	u, err := url.Parse(source)
+	if err != nil || u.Host == "" {
+		return false // e.g., "null" origin of sandboxed frames and local files
+	}
+	// behind a reverse proxy not preserving the Host header, the original host is in X-Forwarded-Host (a header that a forged
+	// cross-origin call can not set without the preflight)
+	if strings.EqualFold(u.Host, r.Host) || strings.EqualFold(u.Host, r.Header.Get("X-Forwarded-Host")) {
+		return true
+	}
+	return corsAllowed(c, u.Scheme+"://"+u.Host)
+}
+
+func corsAllowed(c config.CorsConfig, origin string) bool {
+	if slices.Contains(c.AllowedOrigins, "*") {
+		return true
+	}
+	return slices.ContainsFunc(c.AllowedOrigins, func(o string) bool {
+		return strings.EqualFold(strings.TrimSuffix(o, "/"), origin)
+	})
+}
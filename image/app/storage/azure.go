@@ -0,0 +1,234 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	azureApiVersion       = "2021-08-06"
+	azureDefaultBlockSize = 16 * 1024 * 1024
+	azureMaxBlocks        = 50000
+)
+
+func azureEndpoint(c config.AzureConfig) string {
+	if c.Endpoint != "" {
+		return strings.TrimSuffix(c.Endpoint, "/")
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net", c.AccountName)
+}
+
+func azureBlockSize(c config.AzureConfig, fileSize int64) int64 {
+	blockSize := c.BlockSize
+	if blockSize <= 0 {
+		blockSize = azureDefaultBlockSize
+	}
+	if fileSize > 0 && fileSize/blockSize >= azureMaxBlocks {
+		blockSize = fileSize/azureMaxBlocks + 1
+	}
+	return blockSize
+}
+
+// azureRequest creates a request authenticated with the SAS token (AZURE_STORAGE_SAS_TOKEN) or signed with the account key (AZURE_STORAGE_KEY)
+func azureRequest(ctx context.Context, c config.AzureConfig, method, container, blob string, query url.Values, body []byte) (*http.Request, error) {
+	u := fmt.Sprintf("%s/%s/%s", azureEndpoint(c), container, (&url.URL{Path: blob}).EscapedPath())
+	sas := strings.TrimPrefix(os.Getenv("AZURE_STORAGE_SAS_TOKEN"), "?")
+	rawQuery := query.Encode()
+	if sas != "" {
+		if rawQuery != "" {
+			rawQuery = rawQuery + "&"
+		}
+		rawQuery = rawQuery + sas
+	}
+	if rawQuery != "" {
+		u = u + "?" + rawQuery
+	}
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	request, err := http.NewRequestWithContext(ctx, method, u, reader)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	request.Header.Set("x-ms-version", azureApiVersion)
+	if sas != "" {
+		return request, nil
+	}
+	key, err := base64.StdEncoding.DecodeString(os.Getenv("AZURE_STORAGE_KEY"))
+	if err != nil || len(key) == 0 {
+		return nil, fmt.Errorf("azure credentials are not configured: set AZURE_STORAGE_SAS_TOKEN or AZURE_STORAGE_KEY")
+	}
+	account := c.AccountName
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(azureStringToSign(request, account, int64(len(body)))))
+	request.Header.Set("Authorization", fmt.Sprintf("SharedKey %s:%s", account, base64.StdEncoding.EncodeToString(mac.Sum(nil))))
+	return request, nil
+}
+
+func azureStringToSign(r *http.Request, account string, contentLength int64) string {
+	length := ""
+	if contentLength > 0 {
+		length = strconv.FormatInt(contentLength, 10)
+	}
+	msHeaders := []string{}
+	for k, v := range r.Header {
+		if k = strings.ToLower(k); strings.HasPrefix(k, "x-ms-") {
+			msHeaders = append(msHeaders, k+":"+strings.Join(v, ","))
+		}
+	}
+	sort.Strings(msHeaders)
+	resource := "/" + account + r.URL.EscapedPath()
+	params := []string{}
+	for k, v := range r.URL.Query() {
+		sort.Strings(v)
+		params = append(params, strings.ToLower(k)+":"+strings.Join(v, ","))
+	}
+	sort.Strings(params)
+	for _, p := range params {
+		resource = resource + "\n" + p
+	}
+	return strings.Join([]string{
+		r.Method, r.Header.Get("Content-Encoding"), r.Header.Get("Content-Language"), length, r.Header.Get("Content-MD5"),
+		r.Header.Get("Content-Type"), "", r.Header.Get("If-Modified-Since"), r.Header.Get("If-Match"), r.Header.Get("If-None-Match"),
+		r.Header.Get("If-Unmodified-Since"), r.Header.Get("Range"),
+	}, "\n") + "\n" + strings.Join(msHeaders, "\n") + "\n" + resource
+}
+
+func azureDo(request *http.Request, expected int) (*http.Response, error) {
+	r, err := httpclient.Get("azure").Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != expected {
+		b, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		return nil, fmt.Errorf("azure request failed: %d - %s", r.StatusCode, string(b))
+	}
+	return r, nil
+}
+
+// azureUpload streams the reader to a block blob: the blocks are uploaded one by one (bounded memory) and committed with the block list
+func azureUpload(ctx context.Context, c config.AzureConfig, container, blob string, reader io.Reader, fileSize int64) error {
+	buf := make([]byte, azureBlockSize(c, fileSize))
+	blockList := &bytes.Buffer{}
+	blockList.WriteString(`<?xml version="1.0" encoding="utf-8"?><BlockList>`)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(reader, buf)
+		if n > 0 {
+			blockId := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%06d", i)))
+			request, err := azureRequest(ctx, c, "PUT", container, blob, url.Values{"comp": {"block"}, "blockid": {blockId}}, buf[:n])
+			if err != nil {
+				return err
+			}
+			r, err := azureDo(request, http.StatusCreated)
+			if err != nil {
+				return err
+			}
+			r.Body.Close()
+			blockList.WriteString("<Latest>" + blockId + "</Latest>")
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	blockList.WriteString("</BlockList>")
+	request, err := azureRequest(ctx, c, "PUT", container, blob, url.Values{"comp": {"blocklist"}}, blockList.Bytes())
+	if err != nil {
+		return err
+	}
+	r, err := azureDo(request, http.StatusCreated)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	return nil
+}
+
+func azureDownload(ctx context.Context, c config.AzureConfig, container, blob string) (io.ReadCloser, error) {
+	request, err := azureRequest(ctx, c, "GET", container, blob, url.Values{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := azureDo(request, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+	return r.Body, nil
+}
+
+type azureStorage struct {
+	conf      config.AzureConfig
+	container string
+}
+
+func init() {
+	Register("azure", func(d config.StorageDriver, container string) Storage {
+		return azureStorage{d.AzureConfig, container}
+	})
+}
+
+func (s azureStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return azureDownload(ctx, s.conf, s.container, key)
+}
+
+func (s azureStorage) Create(ctx context.Context, key string, reader io.Reader, size int64) error {
+	return azureUpload(ctx, s.conf, s.container, key, reader, size)
+}
+
+func (s azureStorage) Delete(ctx context.Context, key string) error {
+	request, err := azureRequest(ctx, s.conf, "DELETE", s.container, key, url.Values{}, nil)
+	if err != nil {
+		return err
+	}
+	r, err := azureDo(request, http.StatusAccepted)
+	if err != nil {
+		return err
+	}
+	r.Body.Close()
+	return nil
+}
+
+func (s azureStorage) Exists(ctx context.Context, key string) (bool, error) {
+	request, err := azureRequest(ctx, s.conf, "HEAD", s.container, key, url.Values{}, nil)
+	if err != nil {
+		return false, err
+	}
+	r, err := httpclient.Get("azure").Do(request)
+	if err != nil {
+		return false, err
+	}
+	r.Body.Close()
+	if r.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+	if r.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("azure request failed: %d", r.StatusCode)
+	}
+	return true, nil
+}
+
+func (s azureStorage) Checksum(ctx context.Context, key string, hasher hash.Hash) ([]byte, error) {
+	return checksum(ctx, s, key, hasher)
+}
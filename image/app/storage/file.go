@@ -0,0 +1,84 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"integration/app/config"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+type fileStorage struct {
+	dir string
+}
+
+func init() {
+	Register("file", func(d config.StorageDriver, _ string) Storage {
+		return fileStorage{d.PathToFilesDir}
+	})
+}
+
+func (s fileStorage) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	return os.Open(s.dir + key)
+}
+
+func (s fileStorage) Create(_ context.Context, key string, reader io.Reader, _ int64) error {
+	path := s.dir + key
+	err := os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (s fileStorage) Delete(_ context.Context, key string) error {
+	return os.Remove(s.dir + key)
+}
+
+func (s fileStorage) Exists(_ context.Context, key string) (bool, error) {
+	_, err := os.Stat(s.dir + key)
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s fileStorage) Checksum(ctx context.Context, key string, hasher hash.Hash) ([]byte, error) {
+	return checksum(ctx, s, key, hasher)
+}
+
+func (s fileStorage) List(ctx context.Context, prefix string) ([]Object, error) {
+	res := []Object{}
+	err := filepath.WalkDir(s.dir+prefix, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		res = append(res, Object{Key: strings.TrimPrefix(path, s.dir), Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	return res, err
+}
@@ -0,0 +1,166 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_write"
+const gcsDefaultEndpoint = "https://storage.googleapis.com"
+
+type gcsCredentials struct {
+	ClientEmail  string `json:"client_email"`
+	PrivateKey   string `json:"private_key"`
+	PrivateKeyId string `json:"private_key_id"`
+	TokenUri     string `json:"token_uri"`
+}
+
+func gcsEndpoint(c config.GCSConfig) string {
+	if e := c.Endpoint; e != "" {
+		return e
+	}
+	return gcsDefaultEndpoint
+}
+
+// newGCSClient returns a client authenticated with the service account key, or the default client when no key is configured (e.g., emulators)
+func newGCSClient(ctx context.Context, c config.GCSConfig) (*http.Client, error) {
+	path := c.PathToCredentials
+	if path == "" {
+		return httpclient.Get("gcs"), nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	creds := gcsCredentials{}
+	err = json.Unmarshal(b, &creds)
+	if err != nil {
+		return nil, fmt.Errorf("parsing GCS credentials failed: %v", err)
+	}
+	conf := &jwt.Config{
+		Email:        creds.ClientEmail,
+		PrivateKey:   []byte(creds.PrivateKey),
+		PrivateKeyID: creds.PrivateKeyId,
+		Scopes:       []string{gcsScope},
+		TokenURL:     creds.TokenUri,
+	}
+	return conf.Client(context.WithValue(ctx, oauth2.HTTPClient, httpclient.Get("gcs"))), nil
+}
+
+func gcsUpload(ctx context.Context, c config.GCSConfig, bucket, object string, reader io.Reader) error {
+	client, err := newGCSClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/upload/storage/v1/b/%s/o?uploadType=media&name=%s", gcsEndpoint(c), url.PathEscape(bucket), url.QueryEscape(object))
+	request, err := http.NewRequestWithContext(ctx, "POST", u, reader)
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/octet-stream")
+	r, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != 200 {
+		b, _ := io.ReadAll(r.Body)
+		return fmt.Errorf("writing to gcs failed: %d - %s", r.StatusCode, string(b))
+	}
+	return nil
+}
+
+func gcsDownload(ctx context.Context, c config.GCSConfig, bucket, object string) (io.ReadCloser, error) {
+	client, err := newGCSClient(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s?alt=media", gcsEndpoint(c), url.PathEscape(bucket), url.PathEscape(object))
+	request, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	r, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != 200 {
+		b, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		return nil, fmt.Errorf("reading from gcs failed: %d - %s", r.StatusCode, string(b))
+	}
+	return r.Body, nil
+}
+
+type gcsStorage struct {
+	conf   config.GCSConfig
+	bucket string
+}
+
+func init() {
+	Register("gcs", func(d config.StorageDriver, bucket string) Storage {
+		return gcsStorage{d.GCSConfig, bucket}
+	})
+}
+
+func (s gcsStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return gcsDownload(ctx, s.conf, s.bucket, key)
+}
+
+func (s gcsStorage) Create(ctx context.Context, key string, reader io.Reader, _ int64) error {
+	return gcsUpload(ctx, s.conf, s.bucket, key, reader)
+}
+
+func (s gcsStorage) do(ctx context.Context, method, key string) (int, error) {
+	client, err := newGCSClient(ctx, s.conf)
+	if err != nil {
+		return 0, err
+	}
+	u := fmt.Sprintf("%s/storage/v1/b/%s/o/%s", gcsEndpoint(s.conf), url.PathEscape(s.bucket), url.PathEscape(key))
+	request, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return 0, err
+	}
+	r, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	r.Body.Close()
+	return r.StatusCode, nil
+}
+
+func (s gcsStorage) Delete(ctx context.Context, key string) error {
+	status, err := s.do(ctx, "DELETE", key)
+	if err == nil && status != http.StatusNoContent {
+		err = fmt.Errorf("deleting from gcs failed: %d", status)
+	}
+	return err
+}
+
+func (s gcsStorage) Exists(ctx context.Context, key string) (bool, error) {
+	status, err := s.do(ctx, "GET", key)
+	if err != nil || status == http.StatusNotFound {
+		return false, err
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("reading metadata from gcs failed: %d", status)
+	}
+	return true, nil
+}
+
+func (s gcsStorage) Checksum(ctx context.Context, key string, hasher hash.Hash) ([]byte, error) {
+	return checksum(ctx, s, key, hasher)
+}
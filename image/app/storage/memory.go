@@ -0,0 +1,67 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"io"
+	"io/fs"
+	"sync"
+)
+
+// memoryStorage keeps the objects in memory, it is meant for testing the upload path without a real storage
+type memoryStorage struct {
+	bucket string
+}
+
+var memoryObjects = map[string][]byte{}
+var memoryMutex = sync.RWMutex{}
+
+func init() {
+	Register("memory", func(_ config.StorageDriver, bucket string) Storage {
+		return memoryStorage{bucket}
+	})
+}
+
+func (s memoryStorage) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	memoryMutex.RLock()
+	defer memoryMutex.RUnlock()
+	b, ok := memoryObjects[s.bucket+":"+key]
+	if !ok {
+		return nil, fmt.Errorf("object %v: %w", key, fs.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(b)), nil
+}
+
+func (s memoryStorage) Create(_ context.Context, key string, reader io.Reader, _ int64) error {
+	b, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	memoryObjects[s.bucket+":"+key] = b
+	return nil
+}
+
+func (s memoryStorage) Delete(_ context.Context, key string) error {
+	memoryMutex.Lock()
+	defer memoryMutex.Unlock()
+	delete(memoryObjects, s.bucket+":"+key)
+	return nil
+}
+
+func (s memoryStorage) Exists(_ context.Context, key string) (bool, error) {
+	memoryMutex.RLock()
+	defer memoryMutex.RUnlock()
+	_, ok := memoryObjects[s.bucket+":"+key]
+	return ok, nil
+}
+
+func (s memoryStorage) Checksum(ctx context.Context, key string, hasher hash.Hash) ([]byte, error) {
+	return checksum(ctx, s, key, hasher)
+}
@@ -0,0 +1,158 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"context"
+	"errors"
+	"hash"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cfg "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	defaultPartSize       = 64 * 1024 * 1024
+	defaultConcurrency    = 2
+	defaultMaxUploadParts = 10000
+)
+
+type s3Storage struct {
+	conf   config.S3Config
+	bucket string
+}
+
+func init() {
+	Register("s3", func(d config.StorageDriver, bucket string) Storage {
+		return s3Storage{d.S3Config, bucket}
+	})
+}
+
+func NewS3Client(ctx context.Context, s3Config config.S3Config) (*s3.Client, error) {
+	// the SDK retries the requests itself, the transport is configured as the "s3" destination of the http clients
+	options := []func(*cfg.LoadOptions) error{
+		cfg.WithRegion(s3Config.AWSRegion),
+		cfg.WithHTTPClient(&http.Client{Transport: httpclient.NewTransport("s3")}),
+	}
+	if o := httpclient.Options("s3"); o.MaxRetries > 0 {
+		options = append(options, cfg.WithRetryMaxAttempts(o.MaxRetries+1))
+	}
+	if config.Secret(config.SecretAwsAccessKeyId) != "" {
+		options = append(options, cfg.WithCredentialsProvider(aws.NewCredentialsCache(secretsCredentials{})))
+	}
+	awsConfig, err := cfg.LoadDefaultConfig(ctx, options...)
+	if err != nil {
+		return nil, err
+	}
+	return s3.NewFromConfig(awsConfig, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(s3Config.AWSEndpoint)
+		o.UsePathStyle = s3Config.AWSPathstyle
+	}), nil
+}
+
+// secretsCredentials reads the S3 credentials from the secrets, the SDK asks for them again after they expire in order to pick up the rotated keys
+type secretsCredentials struct{}
+
+func (secretsCredentials) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	return aws.Credentials{
+		AccessKeyID:     config.Secret(config.SecretAwsAccessKeyId),
+		SecretAccessKey: config.Secret(config.SecretAwsSecretAccessKey),
+		Source:          "secrets",
+		CanExpire:       true,
+		Expires:         time.Now().Add(5 * time.Minute),
+	}, nil
+}
+
+// uploaderOptions keeps the memory bounded (the uploader buffers partSize * concurrency bytes) and avoids "too many parts" failures:
+// the part size is increased when the known file size does not fit in the maximum number of parts
+func uploaderOptions(s3Config config.S3Config, fileSize int64) func(*manager.Uploader) {
+	return func(u *manager.Uploader) {
+		u.PartSize = defaultPartSize
+		if s3Config.PartSize > 0 {
+			u.PartSize = s3Config.PartSize
+		}
+		if u.PartSize < manager.MinUploadPartSize {
+			u.PartSize = manager.MinUploadPartSize
+		}
+		u.Concurrency = defaultConcurrency
+		if s3Config.Concurrency > 0 {
+			u.Concurrency = s3Config.Concurrency
+		}
+		u.MaxUploadParts = defaultMaxUploadParts
+		if s3Config.MaxUploadParts > 0 {
+			u.MaxUploadParts = s3Config.MaxUploadParts
+		}
+		if fileSize > 0 && fileSize/u.PartSize >= int64(u.MaxUploadParts) {
+			u.PartSize = fileSize/int64(u.MaxUploadParts) + 1
+		}
+	}
+}
+
+func (s s3Storage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	client, err := NewS3Client(ctx, s.conf)
+	if err != nil {
+		return nil, err
+	}
+	rawObject, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rawObject.Body, nil
+}
+
+func (s s3Storage) Create(ctx context.Context, key string, reader io.Reader, size int64) error {
+	client, err := NewS3Client(ctx, s.conf)
+	if err != nil {
+		return err
+	}
+	uploader := manager.NewUploader(client, uploaderOptions(s.conf, size))
+	_, err = uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+		Body:   reader,
+	})
+	return err
+}
+
+func (s s3Storage) Delete(ctx context.Context, key string) error {
+	client, err := NewS3Client(ctx, s.conf)
+	if err != nil {
+		return err
+	}
+	_, err = client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (s s3Storage) Exists(ctx context.Context, key string) (bool, error) {
+	client, err := NewS3Client(ctx, s.conf)
+	if err != nil {
+		return false, err
+	}
+	_, err = client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	var notFound *types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s s3Storage) Checksum(ctx context.Context, key string, hasher hash.Hash) ([]byte, error) {
+	return checksum(ctx, s, key, hasher)
+}
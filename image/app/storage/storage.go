@@ -0,0 +1,64 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"io"
+	"time"
+)
+
+// Storage is implemented by the storage drivers used for direct upload, the keys are relative to the bucket (or folder) of the driver
+type Storage interface {
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Create streams the reader to a new object, size is -1 when not known on beforehand
+	Create(ctx context.Context, key string, reader io.Reader, size int64) error
+	Delete(ctx context.Context, key string) error
+	Exists(ctx context.Context, key string) (bool, error)
+	// Checksum writes the content of the object to the hasher and returns the sum
+	Checksum(ctx context.Context, key string, hasher hash.Hash) ([]byte, error)
+}
+
+// Object is a stored object as returned by a Lister
+type Object struct {
+	Key      string
+	Size     int64
+	Modified time.Time
+}
+
+// Lister is implemented by the storage drivers that can list their objects (the file driver), used by the orphan scan
+type Lister interface {
+	// List returns the objects with keys under the prefix, none when the prefix does not exist
+	List(ctx context.Context, prefix string) ([]Object, error)
+}
+
+type factory func(d config.StorageDriver, bucket string) Storage
+
+var drivers = map[string]factory{}
+
+// Register makes the driver type available for the storage driver configurations
+func Register(driverType string, f factory) {
+	drivers[driverType] = f
+}
+
+// New returns the storage for the configured driver and the bucket (or container) from the storage identifier
+func New(d config.StorageDriver, bucket string) (Storage, error) {
+	f, ok := drivers[d.Type]
+	if !ok {
+		return nil, fmt.Errorf("unsupported driver: %s", d.Type)
+	}
+	return f(d, bucket), nil
+}
+
+func checksum(ctx context.Context, s Storage, key string, hasher hash.Hash) ([]byte, error) {
+	reader, err := s.Open(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	_, err = io.Copy(hasher, reader)
+	return hasher.Sum(nil), err
+}
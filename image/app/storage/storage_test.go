@@ -0,0 +1,79 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"errors"
+	"integration/app/config"
+	"io"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+// testStorage checks the behavior shared by all drivers: an object is written, read, hashed and deleted
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	key := "doi-10.5072-FK2-TEST/18b4d6a2c1e-0123456789ab"
+	content := "a,b\n1,2\n"
+	if ok, err := s.Exists(ctx, key); err != nil || ok {
+		t.Fatalf("expected the object not to exist, got %v (%v)", ok, err)
+	}
+	if _, err := s.Open(ctx, key); !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("expected fs.ErrNotExist when opening a missing object, got %v", err)
+	}
+	if err := s.Create(ctx, key, strings.NewReader(content), -1); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Exists(ctx, key); err != nil || !ok {
+		t.Fatalf("expected the object to exist, got %v (%v)", ok, err)
+	}
+	reader, err := s.Open(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || string(b) != content {
+		t.Fatalf("expected %q, got %q (%v)", content, b, err)
+	}
+	sum, err := s.Checksum(ctx, key, md5.New())
+	if expected := md5.Sum([]byte(content)); err != nil || string(sum) != string(expected[:]) {
+		t.Fatalf("expected MD5 %x, got %x (%v)", expected, sum, err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := s.Exists(ctx, key); err != nil || ok {
+		t.Fatalf("expected the object to be deleted, got %v (%v)", ok, err)
+	}
+}
+
+func TestMemoryStorage(t *testing.T) {
+	s, err := New(config.StorageDriver{Type: "memory"}, "bucket")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+	other, _ := New(config.StorageDriver{Type: "memory"}, "other")
+	s.Create(context.Background(), "key", strings.NewReader("content"), 7)
+	if ok, _ := other.Exists(context.Background(), "key"); ok {
+		t.Fatal("the object is visible in another bucket")
+	}
+}
+
+func TestFileStorage(t *testing.T) {
+	s, err := New(config.StorageDriver{Type: "file", PathToFilesDir: t.TempDir() + "/"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+}
+
+func TestUnsupportedDriver(t *testing.T) {
+	if _, err := New(config.StorageDriver{Type: "tape"}, ""); err == nil {
+		t.Fatal("expected an error for an unsupported driver")
+	}
+}
@@ -0,0 +1,275 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"integration/app/config"
+	"integration/app/httpclient"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const swiftDefaultSegmentSize = 64 * 1024 * 1024
+
+type swiftAuth struct {
+	token      string
+	storageUrl string
+}
+
+type swiftSegment struct {
+	Path      string `json:"path"`
+	Etag      string `json:"etag"`
+	SizeBytes int64  `json:"size_bytes"`
+}
+
+// swiftAuthenticate uses the OS_AUTH_TOKEN and OS_STORAGE_URL environment variables when set,
+// otherwise it authenticates with Keystone v3 (password method) using the usual OS_* environment variables
+func swiftAuthenticate(ctx context.Context, c config.SwiftConfig) (swiftAuth, error) {
+	if os.Getenv("OS_AUTH_TOKEN") != "" && os.Getenv("OS_STORAGE_URL") != "" {
+		return swiftAuth{os.Getenv("OS_AUTH_TOKEN"), strings.TrimSuffix(os.Getenv("OS_STORAGE_URL"), "/")}, nil
+	}
+	domain := func(name string) map[string]string {
+		if name == "" {
+			name = "Default"
+		}
+		return map[string]string{"name": name}
+	}
+	body := map[string]interface{}{
+		"auth": map[string]interface{}{
+			"identity": map[string]interface{}{
+				"methods": []string{"password"},
+				"password": map[string]interface{}{
+					"user": map[string]interface{}{
+						"name":     os.Getenv("OS_USERNAME"),
+						"password": os.Getenv("OS_PASSWORD"),
+						"domain":   domain(os.Getenv("OS_USER_DOMAIN_NAME")),
+					},
+				},
+			},
+			"scope": map[string]interface{}{
+				"project": map[string]interface{}{
+					"name":   os.Getenv("OS_PROJECT_NAME"),
+					"domain": domain(os.Getenv("OS_PROJECT_DOMAIN_NAME")),
+				},
+			},
+		},
+	}
+	b, _ := json.Marshal(body)
+	request, err := http.NewRequestWithContext(ctx, "POST", strings.TrimSuffix(c.AuthUrl, "/")+"/auth/tokens", bytes.NewReader(b))
+	if err != nil {
+		return swiftAuth{}, err
+	}
+	request.Header.Add("Content-Type", "application/json")
+	r, err := httpclient.Get("swift").Do(request)
+	if err != nil {
+		return swiftAuth{}, err
+	}
+	defer r.Body.Close()
+	b, _ = io.ReadAll(r.Body)
+	if r.StatusCode != http.StatusCreated {
+		return swiftAuth{}, fmt.Errorf("swift authentication failed: %d - %s", r.StatusCode, string(b))
+	}
+	type endpoint struct {
+		Interface string `json:"interface"`
+		Region    string `json:"region"`
+		Url       string `json:"url"`
+	}
+	type catalogEntry struct {
+		Type      string     `json:"type"`
+		Endpoints []endpoint `json:"endpoints"`
+	}
+	res := struct {
+		Token struct {
+			Catalog []catalogEntry `json:"catalog"`
+		} `json:"token"`
+	}{}
+	err = json.Unmarshal(b, &res)
+	if err != nil {
+		return swiftAuth{}, err
+	}
+	for _, entry := range res.Token.Catalog {
+		if entry.Type != "object-store" {
+			continue
+		}
+		for _, e := range entry.Endpoints {
+			if e.Interface == "public" && (c.Region == "" || c.Region == e.Region) {
+				return swiftAuth{r.Header.Get("X-Subject-Token"), strings.TrimSuffix(e.Url, "/")}, nil
+			}
+		}
+	}
+	return swiftAuth{}, fmt.Errorf("swift authentication failed: no public object-store endpoint found in the catalog")
+}
+
+func swiftObjectUrl(auth swiftAuth, container, object string) string {
+	return fmt.Sprintf("%s/%s/%s", auth.storageUrl, url.PathEscape(container), (&url.URL{Path: object}).EscapedPath())
+}
+
+func swiftPut(ctx context.Context, auth swiftAuth, u string, body []byte) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, "PUT", u, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	request.Header.Add("X-Auth-Token", auth.token)
+	r, err := httpclient.Get("swift").Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusCreated {
+		b, _ := io.ReadAll(r.Body)
+		return "", fmt.Errorf("writing to swift failed: %d - %s", r.StatusCode, string(b))
+	}
+	return strings.Trim(r.Header.Get("Etag"), "\""), nil
+}
+
+// swiftUpload writes small files as a single object, larger files are written as segments (bounded memory)
+// combined by a static large object (SLO) manifest
+func swiftUpload(ctx context.Context, c config.SwiftConfig, container, object string, reader io.Reader) error {
+	auth, err := swiftAuthenticate(ctx, c)
+	if err != nil {
+		return err
+	}
+	segmentSize := c.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = swiftDefaultSegmentSize
+	}
+	segmentContainer := c.SegmentContainer
+	if segmentContainer == "" {
+		segmentContainer = container + "_segments"
+	}
+	buf := make([]byte, segmentSize)
+	segments := []swiftSegment{}
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(reader, buf)
+		last := err == io.EOF || err == io.ErrUnexpectedEOF
+		if err != nil && !last {
+			return err
+		}
+		if i == 0 && last {
+			_, err = swiftPut(ctx, auth, swiftObjectUrl(auth, container, object), buf[:n])
+			return err
+		}
+		if n > 0 {
+			segment := fmt.Sprintf("%s/%08d", object, i)
+			etag, err := swiftPut(ctx, auth, swiftObjectUrl(auth, segmentContainer, segment), buf[:n])
+			if err != nil {
+				return err
+			}
+			segments = append(segments, swiftSegment{"/" + segmentContainer + "/" + segment, etag, int64(n)})
+		}
+		if last {
+			break
+		}
+	}
+	manifest, err := json.Marshal(segments)
+	if err != nil {
+		return err
+	}
+	_, err = swiftPut(ctx, auth, swiftObjectUrl(auth, container, object)+"?multipart-manifest=put", manifest)
+	return err
+}
+
+func swiftDownload(ctx context.Context, c config.SwiftConfig, container, object string) (io.ReadCloser, error) {
+	auth, err := swiftAuthenticate(ctx, c)
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET", swiftObjectUrl(auth, container, object), nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Add("X-Auth-Token", auth.token)
+	r, err := httpclient.Get("swift").Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(r.Body)
+		r.Body.Close()
+		return nil, fmt.Errorf("reading from swift failed: %d - %s", r.StatusCode, string(b))
+	}
+	return r.Body, nil
+}
+
+type swiftStorage struct {
+	conf      config.SwiftConfig
+	container string
+}
+
+func init() {
+	Register("swift", func(d config.StorageDriver, container string) Storage {
+		return swiftStorage{d.SwiftConfig, container}
+	})
+}
+
+func (s swiftStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return swiftDownload(ctx, s.conf, s.container, key)
+}
+
+func (s swiftStorage) Create(ctx context.Context, key string, reader io.Reader, _ int64) error {
+	return swiftUpload(ctx, s.conf, s.container, key, reader)
+}
+
+func (s swiftStorage) do(ctx context.Context, method, u string) (int, error) {
+	auth, err := swiftAuthenticate(ctx, s.conf)
+	if err != nil {
+		return 0, err
+	}
+	request, err := http.NewRequestWithContext(ctx, method, swiftObjectUrl(auth, s.container, u), nil)
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Add("X-Auth-Token", auth.token)
+	r, err := httpclient.Get("swift").Do(request)
+	if err != nil {
+		return 0, err
+	}
+	r.Body.Close()
+	return r.StatusCode, nil
+}
+
+// Delete removes the object, for static large objects the segments are removed as well
+func (s swiftStorage) Delete(ctx context.Context, key string) error {
+	auth, err := swiftAuthenticate(ctx, s.conf)
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, "DELETE", swiftObjectUrl(auth, s.container, key)+"?multipart-manifest=delete", nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Add("X-Auth-Token", auth.token)
+	r, err := httpclient.Get("swift").Do(request)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK && r.StatusCode != http.StatusNoContent {
+		b, _ := io.ReadAll(r.Body)
+		return fmt.Errorf("deleting from swift failed: %d - %s", r.StatusCode, string(b))
+	}
+	return nil
+}
+
+func (s swiftStorage) Exists(ctx context.Context, key string) (bool, error) {
+	status, err := s.do(ctx, "HEAD", key)
+	if err != nil || status == http.StatusNotFound {
+		return false, err
+	}
+	if status != http.StatusOK {
+		return false, fmt.Errorf("reading metadata from swift failed: %d", status)
+	}
+	return true, nil
+}
+
+func (s swiftStorage) Checksum(ctx context.Context, key string, hasher hash.Hash) ([]byte, error) {
+	return checksum(ctx, s, key, hasher)
+}
@@ -8,8 +8,30 @@ const (
 	Updated = 2
 	Deleted = 3
 	Unknown = 4
+	// WeakEqual: the source provides no checksum (types.SizeAndTime) and the file has the size and the modification time of the version copied to the dataset
+	WeakEqual = 5
 )
 
+// StatusNames are the names of the statuses in the API (e.g., the filters of the cached responses and the summaries)
+var StatusNames = map[int]string{
+	Equal:     "equal",
+	New:       "new",
+	Updated:   "updated",
+	Deleted:   "deleted",
+	Unknown:   "unknown",
+	WeakEqual: "weak",
+}
+
+// StatusByName returns the status of the name in the API
+func StatusByName(name string) (int, bool) {
+	for status, n := range StatusNames {
+		if n == name {
+			return status, true
+		}
+	}
+	return 0, false
+}
+
 const (
 	Ignore = 0
 	Copy   = 1
@@ -26,11 +48,21 @@ type Node struct {
 	Action     int        `json:"action"`
 }
 
+// Size is the size of the file in the repository, or in the dataset for the deleted files
+func (n Node) Size() int64 {
+	if n.Attributes.RemoteFilesize != 0 {
+		return n.Attributes.RemoteFilesize
+	}
+	return n.Attributes.DestinationFile.Filesize
+}
+
 type Attributes struct {
 	URL             string          `json:"url"`
 	RemoteHash      string          `json:"remoteHash"`
 	RemoteHashType  string          `json:"remoteHashType"`
 	RemoteFilesize  int64           `json:"remoteFilesize"`
+	RemoteModified  int64           `json:"remoteModified,omitempty"` // unix time in nanoseconds of the last modification at the source, set by the plugins without checksums
+	OriginalPath    string          `json:"originalPath,omitempty"`   // path in the source repository when it differs from the id (see SanitizeId)
 	IsFile          bool            `json:"isFile"`
 	DestinationFile DestinationFile `json:"destinatinFile"`
 }
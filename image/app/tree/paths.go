@@ -0,0 +1,103 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package tree
+
+import (
+	"fmt"
+	"strings"
+)
+
+// the characters Dataverse does not accept in the file names, the directory labels only accept the folderChars
+const (
+	forbiddenFileChars = `:<>;#"*|?\`
+	folderChars        = `abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789_.- \`
+)
+
+// SanitizeId maps a path of the source repository to a path accepted by Dataverse: the path is normalized to NFC (e.g.,
+// the decomposed accents of the macOS file names) and the characters that are not allowed (in the directory labels: all
+// characters except ASCII letters, digits, "_", ".", "-", " " and "\") are replaced by their code point, e.g., "é" by "_u00E9_"
+func SanitizeId(id string) string {
+	parts := strings.Split(composeNFC(id), "/")
+	for i, p := range parts {
+		allowed := func(r rune) bool { return strings.ContainsRune(folderChars, r) }
+		if i == len(parts)-1 {
+			allowed = func(r rune) bool { return r >= ' ' && !strings.ContainsRune(forbiddenFileChars, r) }
+		}
+		parts[i] = escape(p, allowed)
+	}
+	return strings.Join(parts, "/")
+}
+
+// DesanitizeId reverses the replacement of the characters by SanitizeId (the NFC normalization is not reversed)
+func DesanitizeId(id string) string {
+	sb := strings.Builder{}
+	for len(id) > 0 {
+		var r rune
+		if strings.HasPrefix(id, "_u") {
+			if n, _ := fmt.Sscanf(id, "_u%X_", &r); n == 1 && strings.HasPrefix(id, fmt.Sprintf("_u%04X_", r)) {
+				sb.WriteRune(r)
+				id = id[len(fmt.Sprintf("_u%04X_", r)):]
+				continue
+			}
+		}
+		sb.WriteByte(id[0])
+		id = id[1:]
+	}
+	return sb.String()
+}
+
+func escape(s string, allowed func(r rune) bool) string {
+	sb := strings.Builder{}
+	for _, r := range s {
+		if allowed(r) {
+			sb.WriteRune(r)
+		} else {
+			sb.WriteString(fmt.Sprintf("_u%04X_", r))
+		}
+	}
+	return sb.String()
+}
+
+// composeNFC composes the base letters with the combining marks that follow them, the marks are expected in the canonical order
+func composeNFC(s string) string {
+	res := []rune{}
+	for _, r := range s {
+		if n := len(res); n > 0 {
+			if c, ok := compose(res[n-1], r); ok {
+				res[n-1] = c
+				continue
+			}
+		}
+		res = append(res, r)
+	}
+	return string(res)
+}
+
+// compose uses the composition table, or the algorithm of the Unicode standard for the Hangul syllables
+func compose(a, b rune) (rune, bool) {
+	const sBase, lBase, vBase, tBase, vCount, tCount = 0xAC00, 0x1100, 0x1161, 0x11A7, 21, 28
+	switch {
+	case a >= lBase && a < lBase+19 && b >= vBase && b < vBase+vCount:
+		return sBase + ((a-lBase)*vCount+(b-vBase))*tCount, true
+	case a >= sBase && a < sBase+11172 && (a-sBase)%tCount == 0 && b > tBase && b < tBase+tCount:
+		return a + (b - tBase), true
+	}
+	c, ok := compositions[[2]rune{a, b}]
+	return c, ok
+}
+
+// SourceId is the path of the file in the source repository, it differs from the id when the path was sanitized
+func (n Node) SourceId() string {
+	if n.Attributes.OriginalPath != "" {
+		return n.Attributes.OriginalPath
+	}
+	return n.Id
+}
+
+// Description is the file description stored in Dataverse: the original path of the sanitized paths
+func (n Node) Description() string {
+	if n.Attributes.OriginalPath == "" {
+		return ""
+	}
+	return "original path: " + n.Attributes.OriginalPath
+}
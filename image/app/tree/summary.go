@@ -0,0 +1,79 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package tree
+
+import "path"
+
+// Summary counts the compared files per status, in total and per folder, so that the clients do not aggregate the nodes themselves
+type Summary struct {
+	Total   FolderSummary            `json:"total"`
+	Folders map[string]FolderSummary `json:"folders"` // by folder path ("" is the root folder)
+}
+
+// FolderSummary counts the files of a folder, including the files of its subfolders
+type FolderSummary struct {
+	Status string           `json:"status"` // the status of all files when they have the same status ("equal" also when some are "weak"), "updated" otherwise
+	Files  map[string]int   `json:"files"`  // number of files by status name
+	Size   map[string]int64 `json:"size"`   // bytes by status name (the size in the repository, or in the dataset for the deleted files)
+}
+
+func newFolderSummary() FolderSummary {
+	return FolderSummary{Files: map[string]int{}, Size: map[string]int64{}}
+}
+
+func (s FolderSummary) add(n Node) {
+	name := StatusNames[n.Status]
+	s.Files[name]++
+	s.Size[name] += n.Size()
+}
+
+// status aggregates the statuses of the files
+func (s FolderSummary) status() string {
+	switch {
+	case len(s.Files) == 1:
+		for name := range s.Files {
+			return name
+		}
+	case len(s.Files) == 2 && s.Files[StatusNames[Equal]] > 0 && s.Files[StatusNames[WeakEqual]] > 0:
+		return StatusNames[Equal]
+	case len(s.Files) == 0:
+		return StatusNames[Equal]
+	}
+	return StatusNames[Updated]
+}
+
+// Summarize counts the compared files (with their status set) per status, in total and for each folder and its parent folders
+func Summarize(nodes []Node) Summary {
+	res := Summary{Total: newFolderSummary(), Folders: map[string]FolderSummary{}}
+	for _, n := range nodes {
+		if !n.Attributes.IsFile {
+			continue
+		}
+		res.Total.add(n)
+		for folder := n.Path; ; folder = parentFolder(folder) {
+			s, ok := res.Folders[folder]
+			if !ok {
+				s = newFolderSummary()
+				res.Folders[folder] = s
+			}
+			s.add(n)
+			if folder == "" {
+				break
+			}
+		}
+	}
+	res.Total.Status = res.Total.status()
+	for folder, s := range res.Folders {
+		s.Status = s.status()
+		res.Folders[folder] = s
+	}
+	return res
+}
+
+func parentFolder(folder string) string {
+	parent := path.Dir(folder)
+	if parent == "." || parent == "/" {
+		return ""
+	}
+	return parent
+}
@@ -3,29 +3,36 @@
 package main
 
 import (
-	"crypto/tls"
+	"flag"
+	"integration/app/config"
+	"integration/app/core"
 	"integration/app/destination"
 	"integration/app/logging"
 	"integration/app/workers/spinner"
-	"net/http"
 	"os"
 	"strconv"
 )
 
 func main() {
+	labels := flag.String("labels", os.Getenv("WORKER_LABELS"), "comma separated labels of the workers, see the jobRouting option")
+	flag.Parse()
+	if err := config.Validate(); err != nil {
+		logging.Logger.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
 	destination.SetDataverseAsDestination()
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
 	numberWorkers := 0
 	var err error
-	if len(os.Args) > 1 {
-		numberWorkers, err = strconv.Atoi(os.Args[1])
+	if flag.NArg() > 0 {
+		numberWorkers, err = strconv.Atoi(flag.Arg(0))
 		if err != nil {
-			logging.Logger.Println("failed to parse number of workers from", numberWorkers)
+			logging.Logger.Warn("failed to parse number of workers", "argument", flag.Arg(0))
 		}
 	}
 	if numberWorkers <= 0 {
 		numberWorkers = 200
 	}
-	logging.Logger.Println("nuber workers:", numberWorkers)
+	core.SetWorkerLabels(spinner.ParseLabels(*labels))
+	logging.Logger.Info("spinning workers", "workers", numberWorkers, "labels", *labels)
 	spinner.SpinWorkers(numberWorkers)
 }
@@ -0,0 +1,105 @@
+// Author: Eryk Kulikowski @ KU Leuven (2023). Apache 2.0 License
+
+package spinner
+
+import (
+	"context"
+	"integration/app/config"
+	"integration/app/core"
+	"integration/app/logging"
+	"math"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	defaultScalingInterval = 10 * time.Second
+	defaultIdleTimeout     = 300 * time.Second
+)
+
+// autoscale adjusts the number of workers to the depth of the queue when the autoscaling is configured (checked on each interval,
+// so that it can be enabled or changed with a reload): more workers are started at once, the workers in surplus are stopped when
+// they remain in surplus for the idle timeout
+func autoscale() {
+	defer core.Wait.Done()
+	var surplusSince time.Time
+	for {
+		interval := defaultScalingInterval
+		if s := config.GetConfig().Options.Autoscaling.Interval; s > 0 {
+			interval = time.Duration(s) * time.Second
+		}
+		select {
+		case <-core.Stop:
+			return
+		case <-time.After(interval):
+		}
+		a := config.GetConfig().Options.Autoscaling
+		if a.MaxWorkers == 0 {
+			surplusSince = time.Time{}
+			continue
+		}
+		target, err := targetWorkers(a)
+		if err != nil {
+			logging.Logger.Warn("autoscaling: reading the queue depth failed", "error", err)
+			continue
+		}
+		current := runningWorkers()
+		switch {
+		case target > current:
+			surplusSince = time.Time{}
+			scaleWorkers(target)
+		case target == current:
+			surplusSince = time.Time{}
+		case surplusSince.IsZero():
+			surplusSince = time.Now()
+		case time.Since(surplusSince) >= idleTimeout(a):
+			surplusSince = time.Time{}
+			scaleWorkers(target)
+		}
+	}
+}
+
+// targetWorkers is the number of workers needed for the running and the queued jobs, between the minimum and the maximum number of
+// workers, and limited by the memory available for the additional workers
+func targetWorkers(a config.Autoscaling) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	queued, err := core.QueuedJobs(ctx)
+	if err != nil {
+		return 0, err
+	}
+	perWorker := a.JobsPerWorker
+	if perWorker <= 0 {
+		perWorker = 1
+	}
+	target := core.BusyWorkers() + (queued+perWorker-1)/perWorker
+	target = min(target, a.MaxWorkers)
+	if current := runningWorkers(); target > current && a.MemoryPerWorker > 0 {
+		target = min(target, current+availableWorkerMemory(a.MemoryPerWorker))
+	}
+	return max(target, getMinWorkers()), nil
+}
+
+// availableWorkerMemory returns the number of additional workers fitting in the memory limit of the process (GOMEMLIMIT), unlimited
+// when no limit is set
+func availableWorkerMemory(memoryPerWorker int64) int {
+	limit := debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		return math.MaxInt32
+	}
+	m := runtime.MemStats{}
+	runtime.ReadMemStats(&m)
+	free := limit - int64(m.Sys-m.HeapReleased)
+	if free <= 0 {
+		return 0
+	}
+	return int(min(free/memoryPerWorker, math.MaxInt32))
+}
+
+func idleTimeout(a config.Autoscaling) time.Duration {
+	if a.IdleTimeout > 0 {
+		return time.Duration(a.IdleTimeout) * time.Second
+	}
+	return defaultIdleTimeout
+}
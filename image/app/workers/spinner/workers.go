@@ -3,38 +3,107 @@
 package spinner
 
 import (
+	"integration/app/config"
 	"integration/app/core"
 	"integration/app/logging"
 	"math/rand"
-	"os"
-	"os/signal"
-	"syscall"
+	"strings"
+	"sync"
 	"time"
 )
 
+// quit channels of the running workers, closed when the number of workers is reduced
+var workers []chan struct{}
+var workersMutex sync.Mutex
+
+// number of workers given on the command line or by the workers option, the minimum when autoscaling
+var minWorkers int
+
 func SpinWorkers(numberWorkers int) {
+	if n := config.GetConfig().Options.Workers; n > 0 {
+		numberWorkers = n
+	}
+	setMinWorkers(numberWorkers)
 	// start workers in background
 	for i := 0; i < numberWorkers; i++ {
 		if numberWorkers > 1 {
 			time.Sleep(time.Duration(rand.Intn(10000/numberWorkers)) * time.Millisecond)
 		}
-		core.Wait.Add(1)
-		go core.ProcessJobs()
+		scaleWorkers(i + 1)
 	}
+	config.OnReload(func(c config.Config) {
+		if c.Options.Workers > 0 {
+			setMinWorkers(c.Options.Workers)
+		}
+		// when autoscaling, the workers above the minimum are stopped by the autoscaling once idle
+		if n := getMinWorkers(); c.Options.Autoscaling.MaxWorkers == 0 || n > runningWorkers() {
+			scaleWorkers(n)
+		}
+	})
+	core.Wait.Add(1)
+	go autoscale()
+	core.Wait.Add(1)
+	go core.ExportJobArchive()
+	core.Wait.Add(1)
+	go core.ReclaimOrphanedLocks()
 
 	// wait for termination
-	signalChannel := make(chan os.Signal, 2)
-	signal.Notify(signalChannel, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		sig := <-signalChannel
-		switch sig {
-		case os.Interrupt, syscall.SIGTERM:
-			logging.Logger.Println("quiting...")
-			close(core.Stop)
-		}
-	}()
-	logging.Logger.Println("workers ready")
+	core.StopOnSignal()
+	logging.Logger.Info("workers ready")
 
 	core.Wait.Wait()
-	logging.Logger.Println("exit")
+	logging.Logger.Info("exit")
+}
+
+// ParseLabels splits the comma separated labels of the workers
+func ParseLabels(labels string) []string {
+	res := []string{}
+	for _, l := range strings.Split(labels, ",") {
+		if l = strings.TrimSpace(l); l != "" {
+			res = append(res, l)
+		}
+	}
+	return res
+}
+
+func setMinWorkers(n int) {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	minWorkers = n
+}
+
+func getMinWorkers() int {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	return minWorkers
+}
+
+func runningWorkers() int {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	return len(workers)
+}
+
+// scaleWorkers starts or stops workers until n workers are running, the stopped workers finish their current job first
+func scaleWorkers(n int) {
+	workersMutex.Lock()
+	defer workersMutex.Unlock()
+	select {
+	case <-core.Stop:
+		return
+	default:
+	}
+	if n != len(workers) && len(workers) > 0 {
+		logging.Logger.Info("scaling workers", "from", len(workers), "to", n)
+	}
+	for len(workers) < n {
+		quit := make(chan struct{})
+		workers = append(workers, quit)
+		core.Wait.Add(1)
+		go core.ProcessJobs(quit)
+	}
+	for len(workers) > n {
+		close(workers[len(workers)-1])
+		workers = workers[:len(workers)-1]
+	}
 }
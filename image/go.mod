@@ -7,12 +7,16 @@ require (
 	github.com/aws/aws-sdk-go-v2/config v1.27.9
 	github.com/aws/aws-sdk-go-v2/feature/s3/manager v1.16.13
 	github.com/aws/aws-sdk-go-v2/service/s3 v1.53.0
+	github.com/coreos/go-oidc/v3 v3.10.0
 	github.com/cyverse/go-irodsclient v0.14.1
 	github.com/google/go-github v17.0.0+incompatible
 	github.com/google/uuid v1.6.0
+	github.com/lib/pq v1.12.3
 	github.com/libis/rdm-dataverse-go-api v1.0.6
 	github.com/redis/go-redis/v9 v9.5.1
+	golang.org/x/crypto v0.21.0
 	golang.org/x/oauth2 v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
@@ -33,6 +37,7 @@ require (
 	github.com/aws/smithy-go v1.20.1 // indirect
 	github.com/cespare/xxhash/v2 v2.2.0 // indirect
 	github.com/dgryski/go-rendezvous v0.0.0-20200823014737-9f7001d12a5f // indirect
+	github.com/go-jose/go-jose/v4 v4.0.1 // indirect
 	github.com/golang/protobuf v1.5.3 // indirect
 	github.com/google/go-querystring v1.1.0 // indirect
 	github.com/hashicorp/go-rootcerts v1.0.2 // indirect
@@ -42,10 +47,8 @@ require (
 	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
 	github.com/rs/xid v1.3.0 // indirect
 	github.com/sirupsen/logrus v1.7.0 // indirect
-	golang.org/x/net v0.22.0 // indirect
 	golang.org/x/sys v0.18.0 // indirect
 	golang.org/x/xerrors v0.0.0-20220907171357-04be3eba64a2 // indirect
-	google.golang.org/appengine v1.6.7 // indirect
+	google.golang.org/appengine v1.6.8 // indirect
 	google.golang.org/protobuf v1.31.0 // indirect
-	gopkg.in/yaml.v3 v3.0.1 // indirect
 )